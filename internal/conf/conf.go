@@ -314,6 +314,26 @@ type Conf struct {
 	AppID               string `json:"appid"`               // 应用 ID
 	AppSecret           string `json:"appsecret"`           // 应用密钥
 	CodecServerAddress  string `json:"codecServerAddress"`  // R-Video 协议服务器地址
+
+	// 解码进程池（H264/H265 截图与 MJPEG 预览）
+	DecoderFFmpegPath  string   `json:"decoderFFmpegPath"`  // FFmpeg 可执行文件路径
+	DecoderFrameRate   int      `json:"decoderFrameRate"`   // 解码输出帧率
+	DecoderWidth       int      `json:"decoderWidth"`       // 解码输出宽度，0 表示保持原始尺寸
+	DecoderIdleTimeout Duration `json:"decoderIdleTimeout"` // 无人使用时关闭解码进程的时间
+
+	// 导出任务队列
+	ExportWorkers      int      `json:"exportWorkers"`      // 同时运行的导出任务数
+	ExportJobRetention Duration `json:"exportJobRetention"` // 结束的导出任务及其结果文件的保留时间
+
+	// 回收站
+	TrashRetention Duration `json:"trashRetention"` // 删除的文件在回收站中的保留时间，之后永久删除
+
+	// PACS 发送
+	DICOMAETitle      string            `json:"dicomAETitle"`      // C-STORE 时本机的 AE Title
+	DICOMDestinations DICOMDestinations `json:"dicomDestinations"` // DICOM 文件的发送目标
+
+	// 采集设备
+	DeviceCredentials DeviceCredentials `json:"deviceCredentials"` // 采集设备 HTTP 接口的账号，按设备地址匹配
 }
 
 func (conf *Conf) setDefaults() {
@@ -432,6 +452,15 @@ func (conf *Conf) setDefaults() {
 	// Pro Extension
 	conf.APIAuth = true
 	conf.CodecServerAddress = ":1688"
+	conf.DecoderFFmpegPath = "ffmpeg"
+	conf.DecoderFrameRate = 5
+	conf.DecoderIdleTimeout = 60 * Duration(time.Second)
+	conf.ExportWorkers = 2
+	conf.ExportJobRetention = 24 * Duration(time.Hour)
+	conf.TrashRetention = 7 * 24 * Duration(time.Hour)
+	conf.DICOMAETitle = "MEDIAMTX"
+	conf.DICOMDestinations = DICOMDestinations{}
+	conf.DeviceCredentials = DeviceCredentials{}
 
 	conf.PathDefaults.setDefaults()
 }
@@ -732,6 +761,55 @@ func (conf *Conf) Validate(l logger.Writer) error {
 		}
 	}
 
+	// Decoder pool
+
+	if conf.DecoderFrameRate <= 0 || conf.DecoderFrameRate > 30 {
+		return fmt.Errorf("'decoderFrameRate' must be between 1 and 30")
+	}
+	if conf.DecoderWidth < 0 || conf.DecoderWidth%2 != 0 {
+		return fmt.Errorf("'decoderWidth' must be zero or a positive even number")
+	}
+	if conf.DecoderIdleTimeout <= 0 {
+		return fmt.Errorf("'decoderIdleTimeout' must be greater than zero")
+	}
+
+	// Export jobs
+
+	if conf.ExportWorkers <= 0 {
+		return fmt.Errorf("'exportWorkers' must be greater than zero")
+	}
+	if conf.ExportJobRetention <= 0 {
+		return fmt.Errorf("'exportJobRetention' must be greater than zero")
+	}
+
+	// Trash
+
+	if conf.TrashRetention <= 0 {
+		return fmt.Errorf("'trashRetention' must be greater than zero")
+	}
+
+	// PACS
+
+	if err := validateAETitle(conf.DICOMAETitle); err != nil {
+		return fmt.Errorf("invalid 'dicomAETitle': %w", err)
+	}
+	destinationNames := make(map[string]struct{})
+	for i, d := range conf.DICOMDestinations {
+		if err := d.validate(); err != nil {
+			return fmt.Errorf("invalid DICOM destination %d: %w", i, err)
+		}
+		if _, ok := destinationNames[d.Name]; ok {
+			return fmt.Errorf("duplicate DICOM destination name: '%s'", d.Name)
+		}
+		destinationNames[d.Name] = struct{}{}
+	}
+
+	// Capture devices
+
+	if err := conf.DeviceCredentials.validate(); err != nil {
+		return err
+	}
+
 	// Record (deprecated)
 
 	if conf.Record != nil {
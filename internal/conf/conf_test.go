@@ -294,6 +294,64 @@ func TestConfErrors(t *testing.T) {
 			"udpMaxPayloadSize: 5000\n",
 			"'udpMaxPayloadSize' must be less than 1472",
 		},
+		{
+			"invalid decoderFrameRate",
+			"decoderFrameRate: 0\n",
+			"'decoderFrameRate' must be between 1 and 30",
+		},
+		{
+			"invalid decoderWidth",
+			"decoderWidth: 641\n",
+			"'decoderWidth' must be zero or a positive even number",
+		},
+		{
+			"invalid exportWorkers",
+			"exportWorkers: 0\n",
+			"'exportWorkers' must be greater than zero",
+		},
+		{
+			"invalid trashRetention",
+			"trashRetention: 0s\n",
+			"'trashRetention' must be greater than zero",
+		},
+		{
+			"invalid dicomAETitle",
+			"dicomAETitle: THIS_AE_TITLE_IS_TOO_LONG\n",
+			"invalid 'dicomAETitle': AE title must be between 1 and 16 characters",
+		},
+		{
+			"invalid DICOM destination",
+			"dicomDestinations:\n" +
+				"  - name: pacs\n" +
+				"    aeTitle: PACS\n" +
+				"    host: 127.0.0.1\n",
+			"invalid DICOM destination 0: invalid port: 0",
+		},
+		{
+			"duplicate DICOM destination",
+			"dicomDestinations:\n" +
+				"  - name: pacs\n" +
+				"    url: http://127.0.0.1/dicom-web\n" +
+				"  - name: pacs\n" +
+				"    url: http://127.0.0.2/dicom-web\n",
+			"duplicate DICOM destination name: 'pacs'",
+		},
+		{
+			"duplicate device credential",
+			"deviceCredentials:\n" +
+				"  - host: 192.168.3.33\n" +
+				"    username: admin\n" +
+				"  - host: 192.168.3.33\n" +
+				"    username: user\n",
+			"duplicate device credential host: '192.168.3.33'",
+		},
+		{
+			"invalid device host",
+			"paths:\n" +
+				"  cam:\n" +
+				"    deviceHost: http://192.168.3.33\n",
+			"'deviceHost' must be an address with an optional port, like 192.168.1.10:8080",
+		},
 		{
 			"invalid ICE server",
 			"webrtcICEServers: [testing]\n",
@@ -438,6 +496,28 @@ func TestConfErrors(t *testing.T) {
 				"    recordDeleteAfter: 20m\n",
 			`'recordDeleteAfter' cannot be lower than 'recordSegmentDuration'`,
 		},
+		{
+			"invalid health check interval",
+			"paths:\n" +
+				"  my_path:\n" +
+				"    healthCheckInterval: 0s\n",
+			`'healthCheckInterval' must be greater than zero`,
+		},
+		{
+			"invalid health bitrate ratio",
+			"paths:\n" +
+				"  my_path:\n" +
+				"    healthMinBitrateRatio: 1.5\n",
+			`'healthMinBitrateRatio' must be between 0 and 1`,
+		},
+		{
+			"invalid frame black level",
+			"paths:\n" +
+				"  my_path:\n" +
+				"    frameCheck: yes\n" +
+				"    frameBlackLevel: 300\n",
+			`'frameBlackLevel' must be between 0 and 255`,
+		},
 	} {
 		t.Run(ca.name, func(t *testing.T) {
 			tmpf, err := createTempFile([]byte(ca.conf))
@@ -0,0 +1,49 @@
+package conf
+
+import (
+	"fmt"
+
+	"github.com/bluenviron/mediamtx/internal/conf/jsonwrapper"
+)
+
+// DeviceCredential contains the account of the HTTP interface of a capture device.
+type DeviceCredential struct {
+	Host     string `json:"host"` // address of the device, with an optional port
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// DeviceCredentials is a list of DeviceCredential.
+type DeviceCredentials []DeviceCredential
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *DeviceCredentials) UnmarshalJSON(b []byte) error {
+	// remove default value before loading new value
+	// https://github.com/golang/go/issues/21092
+	*s = nil
+	return jsonwrapper.Unmarshal(b, (*[]DeviceCredential)(s))
+}
+
+// Find returns the credential of a device address.
+func (s DeviceCredentials) Find(host string) (DeviceCredential, bool) {
+	for _, c := range s {
+		if c.Host == host {
+			return c, true
+		}
+	}
+	return DeviceCredential{}, false
+}
+
+func (s DeviceCredentials) validate() error {
+	hosts := make(map[string]struct{})
+	for i, c := range s {
+		if c.Host == "" {
+			return fmt.Errorf("invalid device credential %d: host is empty", i)
+		}
+		if _, ok := hosts[c.Host]; ok {
+			return fmt.Errorf("duplicate device credential host: '%s'", c.Host)
+		}
+		hosts[c.Host] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package conf
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/bluenviron/mediamtx/internal/conf/jsonwrapper"
+)
+
+// DICOMDestination is a PACS that receives DICOM exports,
+// either with C-STORE (DIMSE) or with STOW-RS (DICOMweb).
+type DICOMDestination struct {
+	Name string `json:"name"`
+
+	// C-STORE
+	AETitle string `json:"aeTitle"`
+	Host    string `json:"host"`
+	Port    int    `json:"port"`
+
+	// STOW-RS
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// STOWRS checks whether the destination uses STOW-RS.
+func (d DICOMDestination) STOWRS() bool {
+	return d.URL != ""
+}
+
+func validateAETitle(ae string) error {
+	if ae == "" || len(ae) > 16 {
+		return fmt.Errorf("AE title must be between 1 and 16 characters")
+	}
+	for _, c := range ae {
+		if c < 0x20 || c > 0x7E || c == '\\' {
+			return fmt.Errorf("AE title contains invalid characters")
+		}
+	}
+	return nil
+}
+
+func (d DICOMDestination) validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+
+	if d.STOWRS() {
+		if d.Host != "" || d.AETitle != "" {
+			return fmt.Errorf("'url' can't be used together with 'host' or 'aeTitle'")
+		}
+		u, err := url.Parse(d.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid URL: '%s'", d.URL)
+		}
+		return nil
+	}
+
+	if d.Host == "" {
+		return fmt.Errorf("one between 'host' or 'url' must be filled")
+	}
+	if d.Port <= 0 || d.Port > 65535 {
+		return fmt.Errorf("invalid port: %d", d.Port)
+	}
+	return validateAETitle(d.AETitle)
+}
+
+// DICOMDestinations is a list of DICOMDestination.
+type DICOMDestinations []DICOMDestination
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *DICOMDestinations) UnmarshalJSON(b []byte) error {
+	// remove default value before loading new value
+	// https://github.com/golang/go/issues/21092
+	*s = nil
+	return jsonwrapper.Unmarshal(b, (*[]DICOMDestination)(s))
+}
+
+// Find returns the destination with the given name.
+func (s DICOMDestinations) Find(name string) (DICOMDestination, bool) {
+	for _, d := range s {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return DICOMDestination{}, false
+}
@@ -235,6 +235,7 @@ type Path struct {
 	RecordClearDaysAgo          int      `json:"recordClearDaysAgo"`
 	RecordCreateWebhook         string   `json:"recordCreateWebhook"`
 	RecordDelWebhook            string   `json:"recordDelWebhook"`
+	RecordWebhookSecret         string   `json:"recordWebhookSecret"`       // 录制回调的 HMAC-SHA256 签名密钥（为空表示不签名）
 	ThumbnailSize               int      `json:"thumbnailSize"`
 	VideoSnapshotEnable         bool     `json:"videoSnapshotEnable"`
 	VideoSnapshotModulePath     string   `json:"videoSnapshotModulePath"`
@@ -249,8 +250,31 @@ type Path struct {
 	AutoRecordTaskOutDuration   Duration `json:"autoRecordTaskOutDuration"` // 自动录制的最大时长（默认30分钟）
 	ShowList                    bool     `json:"showList"`                  // 是否在列表中显示
 	Order                       int      `json:"order"`                     // 排序顺序
-	DeviceType                  string   `json:"deviceType"`                // 设备类型：network_capture=网络采集卡，其他值或空=普通网络流
+	DeviceType                  string   `json:"deviceType"`                // 设备驱动：network_capture=网络采集卡，http_jpeg=HTTP 截图设备，空=普通网络流
+	DeviceHost                  string   `json:"deviceHost"`                // 设备 HTTP 接口地址（可带端口），空=使用源地址的主机
+	DeviceUsername              string   `json:"deviceUsername"`            // 设备 HTTP 接口账号，空=使用 deviceCredentials
+	DevicePassword              string   `json:"devicePassword"`            // 设备 HTTP 接口密码
 	RecordMinThreshold          int      `json:"recordMinThreshold"`        // 智能录制的彩色阈值（仅对 network_capture 且 record=yes 有效）
+	RecordPreEventDuration      Duration `json:"recordPreEventDuration"`    // 预录缓存时长，API 录制从缓存中最早的关键帧开始（0=关闭）
+	RecordMP4Fragmented         bool     `json:"recordMP4Fragmented"`       // MP4 分片写入，崩溃或断电后文件仍可播放
+	RecordSchedules             RecordSchedules `json:"recordSchedules"`    // 定时录制规则（cron、单次、每周时间段）
+	KeyFrameCache               bool     `json:"keyFrameCache"`             // 缓存最新关键帧，截图立即返回，新的 RTMP/WebRTC 读者从关键帧开始播放
+	HealthCheck                 bool     `json:"healthCheck"`               // 是否对该路径进行健康检查
+	HealthCheckInterval         Duration `json:"healthCheckInterval"`       // 健康检查间隔
+	HealthNoDataTimeout         Duration `json:"healthNoDataTimeout"`       // 超过该时长未收到数据视为异常（0=关闭）
+	HealthMinBitrateRatio       float64  `json:"healthMinBitrateRatio"`     // 码率低于基线的该比例视为码率骤降（0=关闭）
+	HealthMinFrameRateRatio     float64  `json:"healthMinFrameRateRatio"`   // 帧率低于基线的该比例视为掉帧（0=关闭）
+	HealthMaxTimestampJump      Duration `json:"healthMaxTimestampJump"`    // 相邻帧时间戳跳变超过该值视为时间戳不连续（0=关闭）
+	HealthKeyframeTimeout       Duration `json:"healthKeyframeTimeout"`     // 超过该时长没有关键帧视为关键帧停滞（0=关闭）
+	HealthFailureThreshold      int      `json:"healthFailureThreshold"`    // 连续失败多少次后进入 unhealthy（network_capture 设备会被重启）
+	HealthRecoveryThreshold     int      `json:"healthRecoveryThreshold"`   // 连续成功多少次后恢复为 healthy
+	HealthRebootOnSoftFailures  bool     `json:"healthRebootOnSoftFailures"` // 码率、帧率、时间戳、画面异常也重启设备（默认只有无数据和截图失败）
+	FrameCheck                  bool     `json:"frameCheck"`                // 解码画面，检测冻结、黑屏和纯色画面
+	FrameCheckInterval          Duration `json:"frameCheckInterval"`        // 画面采样间隔
+	FrameCheckDuration          Duration `json:"frameCheckDuration"`        // 异常画面持续该时长后才上报
+	FrameBlackLevel             int      `json:"frameBlackLevel"`           // 亮度（0-255）不超过该值的像素视为黑色
+	FrameSolidDeviation         float64  `json:"frameSolidDeviation"`       // 颜色标准差低于该值视为纯色画面
+	FrameFreezeDifference       float64  `json:"frameFreezeDifference"`     // 与上一帧的平均亮度差低于该值视为画面未变化
 }
 
 func (pconf *Path) setDefaults() {
@@ -308,6 +332,24 @@ func (pconf *Path) setDefaults() {
 	pconf.Order = 0                                               // 默认排序为0
 	pconf.DeviceType = ""                                         // 默认为普通网络流
 	pconf.RecordMinThreshold = 60                                 // 默认彩色阈值60
+	pconf.RecordPreEventDuration = 0                              // 默认不开启预录缓存
+	pconf.RecordMP4Fragmented = false                             // 默认写入普通 MP4
+	pconf.KeyFrameCache = false                                   // 默认不缓存关键帧
+	pconf.HealthCheck = true
+	pconf.HealthCheckInterval = 5 * Duration(time.Second)
+	pconf.HealthNoDataTimeout = 10 * Duration(time.Second)
+	pconf.HealthMinBitrateRatio = 0.2
+	pconf.HealthMinFrameRateRatio = 0.5
+	pconf.HealthMaxTimestampJump = 2 * Duration(time.Second)
+	pconf.HealthKeyframeTimeout = 15 * Duration(time.Second)
+	pconf.HealthFailureThreshold = 6
+	pconf.HealthRecoveryThreshold = 2
+	pconf.FrameCheck = false // 默认不检测画面，需要解码
+	pconf.FrameCheckInterval = 2 * Duration(time.Second)
+	pconf.FrameCheckDuration = 6 * Duration(time.Second)
+	pconf.FrameBlackLevel = 20
+	pconf.FrameSolidDeviation = 4
+	pconf.FrameFreezeDifference = 1
 }
 
 func newPath(defaults *Path, partial *OptionalPath) *Path {
@@ -720,6 +762,59 @@ func (pconf *Path) validate(
 		return fmt.Errorf("'recordDeleteAfter' cannot be lower than 'recordSegmentDuration'")
 	}
 
+	// Pro Extension
+
+	if len(pconf.RecordSchedules) != 0 {
+		if pconf.Regexp != nil {
+			return fmt.Errorf("a path with a regular expression (or path 'all') does not support 'recordSchedules'")
+		}
+
+		err := pconf.RecordSchedules.validate()
+		if err != nil {
+			return fmt.Errorf("invalid 'recordSchedules': %w", err)
+		}
+	}
+
+	if pconf.HealthCheck {
+		if pconf.HealthCheckInterval <= 0 {
+			return fmt.Errorf("'healthCheckInterval' must be greater than zero")
+		}
+		if pconf.HealthNoDataTimeout < 0 || pconf.HealthMaxTimestampJump < 0 || pconf.HealthKeyframeTimeout < 0 {
+			return fmt.Errorf("health check timeouts cannot be negative")
+		}
+		if pconf.HealthMinBitrateRatio < 0 || pconf.HealthMinBitrateRatio >= 1 {
+			return fmt.Errorf("'healthMinBitrateRatio' must be between 0 and 1")
+		}
+		if pconf.HealthMinFrameRateRatio < 0 || pconf.HealthMinFrameRateRatio >= 1 {
+			return fmt.Errorf("'healthMinFrameRateRatio' must be between 0 and 1")
+		}
+		if pconf.HealthFailureThreshold < 1 {
+			return fmt.Errorf("'healthFailureThreshold' must be at least 1")
+		}
+		if pconf.HealthRecoveryThreshold < 1 {
+			return fmt.Errorf("'healthRecoveryThreshold' must be at least 1")
+		}
+	}
+
+	if strings.Contains(pconf.DeviceHost, "/") {
+		return fmt.Errorf("'deviceHost' must be an address with an optional port, like 192.168.1.10:8080")
+	}
+
+	if pconf.FrameCheck {
+		if pconf.FrameCheckInterval <= 0 {
+			return fmt.Errorf("'frameCheckInterval' must be greater than zero")
+		}
+		if pconf.FrameCheckDuration < 0 {
+			return fmt.Errorf("'frameCheckDuration' cannot be negative")
+		}
+		if pconf.FrameBlackLevel < 0 || pconf.FrameBlackLevel > 255 {
+			return fmt.Errorf("'frameBlackLevel' must be between 0 and 255")
+		}
+		if pconf.FrameSolidDeviation < 0 || pconf.FrameFreezeDifference < 0 {
+			return fmt.Errorf("frame check thresholds cannot be negative")
+		}
+	}
+
 	// Authentication (deprecated)
 
 	if deprecatedCredentialsMode {
@@ -0,0 +1,422 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf/jsonwrapper"
+)
+
+// RecordScheduleType is the type of a recording schedule.
+type RecordScheduleType string
+
+// recording schedule types.
+const (
+	RecordScheduleTypeCron   RecordScheduleType = "cron"
+	RecordScheduleTypeOnce   RecordScheduleType = "once"
+	RecordScheduleTypeWeekly RecordScheduleType = "weekly"
+)
+
+// recordScheduleSearchLimit is the maximum distance between a time and the next window of a schedule.
+const recordScheduleSearchLimit = 5 * 365 * 24 * time.Hour
+
+var recordScheduleDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+var recordScheduleCronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// RecordSchedule is a rule that starts and stops the recording of a path.
+type RecordSchedule struct {
+	ID       string             `json:"id"`
+	Type     RecordScheduleType `json:"type"`
+	Disabled bool               `json:"disabled,omitempty"`
+	Format   string             `json:"format,omitempty"` // "mp4" (default) or "ts"
+
+	// cron: recordings start when the expression matches (minute hour day-of-month month day-of-week)
+	// and last Duration.
+	Cron     string   `json:"cron,omitempty"`
+	Duration Duration `json:"duration,omitempty"`
+
+	// once: Start and End are RFC3339 times.
+	// weekly: Start and End are times of day (HH:MM), the window crosses midnight when End precedes Start.
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+
+	// weekly: days of the week (mon, tue, wed, thu, fri, sat, sun). Empty means every day.
+	Days []string `json:"days,omitempty"`
+}
+
+// Validate checks the rule.
+func (s RecordSchedule) Validate() error {
+	if s.Format != "" && s.Format != "mp4" && s.Format != "ts" {
+		return fmt.Errorf("invalid format '%s', must be 'mp4' or 'ts'", s.Format)
+	}
+
+	switch s.Type {
+	case RecordScheduleTypeCron:
+		if s.Duration <= 0 {
+			return fmt.Errorf("'duration' is required")
+		}
+		_, err := parseCronExpr(s.Cron)
+		return err
+
+	case RecordScheduleTypeOnce:
+		start, end, err := s.onceWindow()
+		if err != nil {
+			return err
+		}
+		if !end.After(start) {
+			return fmt.Errorf("'end' must be after 'start'")
+		}
+		return nil
+
+	case RecordScheduleTypeWeekly:
+		start, err := parseTimeOfDay(s.Start)
+		if err != nil {
+			return fmt.Errorf("invalid 'start': %w", err)
+		}
+		end, err := parseTimeOfDay(s.End)
+		if err != nil {
+			return fmt.Errorf("invalid 'end': %w", err)
+		}
+		if start == end {
+			return fmt.Errorf("'start' and 'end' must be different")
+		}
+		_, err = s.weekDays()
+		return err
+	}
+
+	return fmt.Errorf("invalid type '%s', must be 'cron', 'once' or 'weekly'", s.Type)
+}
+
+// NextWindow returns the first window of the rule that ends after t.
+// The window may have started before t.
+func (s RecordSchedule) NextWindow(t time.Time) (time.Time, time.Time, bool) {
+	switch s.Type {
+	case RecordScheduleTypeCron:
+		return s.nextCronWindow(t)
+
+	case RecordScheduleTypeOnce:
+		start, end, err := s.onceWindow()
+		if err != nil || !end.After(t) {
+			return time.Time{}, time.Time{}, false
+		}
+		return start, end, true
+
+	case RecordScheduleTypeWeekly:
+		return s.nextWeeklyWindow(t)
+	}
+
+	return time.Time{}, time.Time{}, false
+}
+
+func (s RecordSchedule) onceWindow() (time.Time, time.Time, error) {
+	start, err := time.Parse(time.RFC3339, s.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid 'start': %w", err)
+	}
+
+	end, err := time.Parse(time.RFC3339, s.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid 'end': %w", err)
+	}
+
+	return start, end, nil
+}
+
+func (s RecordSchedule) nextCronWindow(t time.Time) (time.Time, time.Time, bool) {
+	expr, err := parseCronExpr(s.Cron)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	d := time.Duration(s.Duration)
+	from := t.Add(-d)
+
+	for {
+		start, ok := expr.next(from)
+		if !ok {
+			return time.Time{}, time.Time{}, false
+		}
+
+		end := start.Add(d)
+		if end.After(t) {
+			return start, end, true
+		}
+
+		from = start.Add(time.Minute)
+	}
+}
+
+func (s RecordSchedule) weekDays() (uint8, error) {
+	if len(s.Days) == 0 {
+		return 0x7F, nil
+	}
+
+	var mask uint8
+
+	for _, day := range s.Days {
+		found := false
+		for i, name := range recordScheduleDays {
+			if strings.HasPrefix(strings.ToLower(day), name) {
+				mask |= 1 << i
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("invalid day '%s'", day)
+		}
+	}
+
+	return mask, nil
+}
+
+func (s RecordSchedule) nextWeeklyWindow(t time.Time) (time.Time, time.Time, bool) {
+	startMin, err1 := parseTimeOfDay(s.Start)
+	endMin, err2 := parseTimeOfDay(s.End)
+	days, err3 := s.weekDays()
+	if err1 != nil || err2 != nil || err3 != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	// start from the previous day, since its window may cross midnight
+	y, m, d := t.Date()
+
+	for i := -1; i <= 7; i++ {
+		day := time.Date(y, m, d+i, 0, 0, 0, 0, t.Location())
+		if days&(1<<day.Weekday()) == 0 {
+			continue
+		}
+
+		start := time.Date(y, m, d+i, 0, startMin, 0, 0, t.Location())
+		end := time.Date(y, m, d+i, 0, endMin, 0, 0, t.Location())
+		if endMin < startMin {
+			end = time.Date(y, m, d+i+1, 0, endMin, 0, 0, t.Location())
+		}
+
+		if end.After(t) {
+			return start, end, true
+		}
+	}
+
+	return time.Time{}, time.Time{}, false
+}
+
+// parseTimeOfDay parses a HH:MM time and returns the minutes from midnight.
+func parseTimeOfDay(v string) (int, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("'%s' is not in HH:MM format", v)
+	}
+
+	h, err := strconv.Atoi(parts[0])
+	if err != nil || h < 0 || h > 23 {
+		return 0, fmt.Errorf("invalid hour in '%s'", v)
+	}
+
+	m, err := strconv.Atoi(parts[1])
+	if err != nil || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid minute in '%s'", v)
+	}
+
+	return h*60 + m, nil
+}
+
+// cronExpr is a parsed cron expression. Fields are bitmasks of allowed values.
+type cronExpr struct {
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool
+	dowStar bool
+}
+
+func parseCronExpr(v string) (*cronExpr, error) {
+	if macro, ok := recordScheduleCronMacros[strings.TrimSpace(v)]; ok {
+		v = macro
+	}
+
+	fields := strings.Fields(v)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression '%s': 5 fields are required", v)
+	}
+
+	e := &cronExpr{
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+
+	for i, f := range []struct {
+		dest   *uint64
+		minVal int
+		maxVal int
+	}{
+		{&e.minute, 0, 59},
+		{&e.hour, 0, 23},
+		{&e.dom, 1, 31},
+		{&e.month, 1, 12},
+		{&e.dow, 0, 7},
+	} {
+		mask, err := parseCronField(fields[i], f.minVal, f.maxVal)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s': %w", v, err)
+		}
+		*f.dest = mask
+	}
+
+	// 7 is an alias of sunday
+	if e.dow&(1<<7) != 0 {
+		e.dow |= 1
+	}
+
+	return e, nil
+}
+
+func parseCronField(v string, minVal int, maxVal int) (uint64, error) {
+	var mask uint64
+
+	for _, item := range strings.Split(v, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step '%s'", stepPart)
+			}
+		}
+
+		lo, hi := minVal, maxVal
+
+		if rangePart != "*" {
+			loPart, hiPart, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+			lo, err = strconv.Atoi(loPart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", item)
+			}
+
+			hi = lo
+			if isRange {
+				hi, err = strconv.Atoi(hiPart)
+				if err != nil {
+					return 0, fmt.Errorf("invalid value '%s'", item)
+				}
+			} else if hasStep {
+				hi = maxVal
+			}
+
+			if lo < minVal || hi > maxVal || lo > hi {
+				return 0, fmt.Errorf("value '%s' out of range %d-%d", item, minVal, maxVal)
+			}
+		}
+
+		for i := lo; i <= hi; i += step {
+			mask |= 1 << i
+		}
+	}
+
+	return mask, nil
+}
+
+func (e *cronExpr) dayMatches(t time.Time) bool {
+	domMatch := e.dom&(1<<t.Day()) != 0
+	dowMatch := e.dow&(1<<t.Weekday()) != 0
+
+	// when both fields are restricted, a day matches either of them
+	if !e.domStar && !e.dowStar {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// next returns the first time, at or after t, that matches the expression.
+func (e *cronExpr) next(t time.Time) (time.Time, bool) {
+	if tr := t.Truncate(time.Minute); !tr.Equal(t) {
+		t = tr.Add(time.Minute)
+	}
+
+	limit := t.Add(recordScheduleSearchLimit)
+	loc := t.Location()
+
+	for t.Before(limit) {
+		y, mo, d := t.Date()
+
+		switch {
+		case e.month&(1<<mo) == 0:
+			t = time.Date(y, mo+1, 1, 0, 0, 0, 0, loc)
+
+		case !e.dayMatches(t):
+			t = time.Date(y, mo, d+1, 0, 0, 0, 0, loc)
+
+		case e.hour&(1<<t.Hour()) == 0:
+			t = time.Date(y, mo, d, t.Hour()+1, 0, 0, 0, loc)
+
+		case e.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+
+		default:
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// RecordSchedules is a list of RecordSchedule.
+type RecordSchedules []RecordSchedule
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *RecordSchedules) UnmarshalJSON(b []byte) error {
+	// remove default value before loading new value
+	// https://github.com/golang/go/issues/21092
+	*s = nil
+	return jsonwrapper.Unmarshal(b, (*[]RecordSchedule)(s))
+}
+
+// validate checks the rules and assigns an ID to rules without one.
+func (s RecordSchedules) validate() error {
+	ids := make(map[string]struct{})
+
+	for i := range s {
+		if s[i].ID == "" {
+			s[i].ID = strconv.Itoa(i + 1)
+		}
+
+		if _, ok := ids[s[i].ID]; ok {
+			return fmt.Errorf("duplicate ID '%s'", s[i].ID)
+		}
+		ids[s[i].ID] = struct{}{}
+
+		err := s[i].Validate()
+		if err != nil {
+			return fmt.Errorf("schedule '%s': %w", s[i].ID, err)
+		}
+	}
+
+	return nil
+}
+
+// SetPathRecordSchedules replaces the recording schedules of a path.
+func (conf *Conf) SetPathRecordSchedules(name string, schedules RecordSchedules) error {
+	optional, ok := conf.OptionalPaths[name]
+	if !ok || optional == nil {
+		return ErrPathNotFound
+	}
+
+	reflect.ValueOf(optional.Values).Elem().FieldByName("RecordSchedules").Set(reflect.ValueOf(&schedules))
+	return nil
+}
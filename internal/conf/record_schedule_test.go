@@ -0,0 +1,107 @@
+package conf
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordScheduleNextWindow(t *testing.T) {
+	loc := time.FixedZone("test", 8*3600)
+	now := time.Date(2025, 10, 15, 14, 30, 0, 0, loc) // wednesday
+
+	for _, ca := range []struct {
+		name  string
+		s     RecordSchedule
+		start time.Time
+		end   time.Time
+	}{
+		{
+			"cron in progress",
+			RecordSchedule{Type: RecordScheduleTypeCron, Cron: "0 * * * *", Duration: Duration(45 * time.Minute)},
+			time.Date(2025, 10, 15, 14, 0, 0, 0, loc),
+			time.Date(2025, 10, 15, 14, 45, 0, 0, loc),
+		},
+		{
+			"cron weekdays",
+			RecordSchedule{Type: RecordScheduleTypeCron, Cron: "*/20 8-9 * * 1-5", Duration: Duration(10 * time.Minute)},
+			time.Date(2025, 10, 16, 8, 0, 0, 0, loc),
+			time.Date(2025, 10, 16, 8, 10, 0, 0, loc),
+		},
+		{
+			"cron day of month or day of week",
+			RecordSchedule{Type: RecordScheduleTypeCron, Cron: "0 6 1 * 5", Duration: Duration(time.Hour)},
+			time.Date(2025, 10, 17, 6, 0, 0, 0, loc),
+			time.Date(2025, 10, 17, 7, 0, 0, 0, loc),
+		},
+		{
+			"cron macro",
+			RecordSchedule{Type: RecordScheduleTypeCron, Cron: "@monthly", Duration: Duration(time.Hour)},
+			time.Date(2025, 11, 1, 0, 0, 0, 0, loc),
+			time.Date(2025, 11, 1, 1, 0, 0, 0, loc),
+		},
+		{
+			"once",
+			RecordSchedule{Type: RecordScheduleTypeOnce, Start: "2025-10-15T15:00:00+08:00", End: "2025-10-15T16:00:00+08:00"},
+			time.Date(2025, 10, 15, 15, 0, 0, 0, loc),
+			time.Date(2025, 10, 15, 16, 0, 0, 0, loc),
+		},
+		{
+			"weekly across midnight",
+			RecordSchedule{Type: RecordScheduleTypeWeekly, Start: "22:00", End: "15:00", Days: []string{"tue"}},
+			time.Date(2025, 10, 14, 22, 0, 0, 0, loc),
+			time.Date(2025, 10, 15, 15, 0, 0, 0, loc),
+		},
+		{
+			"weekly next week",
+			RecordSchedule{Type: RecordScheduleTypeWeekly, Start: "08:00", End: "12:00", Days: []string{"mon", "wed"}},
+			time.Date(2025, 10, 20, 8, 0, 0, 0, loc),
+			time.Date(2025, 10, 20, 12, 0, 0, 0, loc),
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.NoError(t, ca.s.Validate())
+			start, end, ok := ca.s.NextWindow(now)
+			require.True(t, ok)
+			require.True(t, ca.start.Equal(start), start.String())
+			require.True(t, ca.end.Equal(end), end.String())
+		})
+	}
+}
+
+func TestRecordScheduleOnceElapsed(t *testing.T) {
+	s := RecordSchedule{Type: RecordScheduleTypeOnce, Start: "2025-10-15T10:00:00Z", End: "2025-10-15T11:00:00Z"}
+	_, _, ok := s.NextWindow(time.Date(2025, 10, 15, 11, 0, 0, 0, time.UTC))
+	require.False(t, ok)
+}
+
+func TestRecordScheduleValidate(t *testing.T) {
+	for _, s := range []RecordSchedule{
+		{Type: "daily"},
+		{Type: RecordScheduleTypeCron, Cron: "0 * * *", Duration: Duration(time.Hour)},
+		{Type: RecordScheduleTypeCron, Cron: "60 * * * *", Duration: Duration(time.Hour)},
+		{Type: RecordScheduleTypeCron, Cron: "0 * * * *"},
+		{Type: RecordScheduleTypeOnce, Start: "2025-10-15T11:00:00Z", End: "2025-10-15T10:00:00Z"},
+		{Type: RecordScheduleTypeWeekly, Start: "8:00", End: "25:00"},
+		{Type: RecordScheduleTypeWeekly, Start: "08:00", End: "09:00", Days: []string{"someday"}},
+		{Type: RecordScheduleTypeWeekly, Start: "08:00", End: "09:00", Format: "avi"},
+	} {
+		require.Error(t, s.Validate())
+	}
+}
+
+func TestRecordSchedulesUnmarshal(t *testing.T) {
+	var s RecordSchedules
+	err := json.Unmarshal([]byte(`[{"type":"weekly","start":"08:00","end":"09:00"},`+
+		`{"id":"night","type":"cron","cron":"0 22 * * *","duration":"8h"}]`), &s)
+	require.NoError(t, err)
+	require.NoError(t, s.validate())
+	require.Equal(t, "1", s[0].ID)
+	require.Equal(t, "night", s[1].ID)
+	require.Equal(t, Duration(8*time.Hour), s[1].Duration)
+
+	s = append(s, RecordSchedule{ID: "night", Type: RecordScheduleTypeWeekly, Start: "08:00", End: "09:00"})
+	require.Error(t, s.validate())
+}
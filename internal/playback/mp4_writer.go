@@ -0,0 +1,68 @@
+package playback
+
+import (
+	"io"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+)
+
+// MP4Writer writes samples into a MP4 file.
+// It uses the same muxers that serve recordings in MP4 and fMP4 format,
+// and allows to build files out of samples that do not come from fMP4 segments.
+type MP4Writer struct {
+	W          io.Writer
+	Tracks     []*fmp4.InitTrack
+	Fragmented bool // writes a fMP4 file, whose parts are written while samples are added
+
+	m muxer
+}
+
+// Initialize initializes MP4Writer.
+func (w *MP4Writer) Initialize() {
+	if w.Fragmented {
+		w.m = &muxerFMP4{w: w.W}
+	} else {
+		w.m = &muxerMP4{w: w.W}
+	}
+	w.m.writeInit(&fmp4.Init{Tracks: w.Tracks})
+}
+
+// WriteSample writes a sample of a track.
+// Samples of each track must be written in decode order.
+func (w *MP4Writer) WriteSample(
+	trackID int,
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	payloadSize uint32,
+	getPayload func() ([]byte, error),
+) error {
+	w.m.setTrack(trackID)
+	return w.m.writeSample(dts, ptsOffset, isNonSyncSample, payloadSize, getPayload)
+}
+
+// WriteFinalDTS sets the DTS that follows the last sample of a track,
+// in order to compute the duration of the last sample.
+func (w *MP4Writer) WriteFinalDTS(trackID int, dts int64) {
+	w.m.setTrack(trackID)
+	w.m.writeFinalDTS(dts)
+}
+
+// Flush writes the file, or the last part of a fMP4 file.
+// Payloads of samples of MP4 files are read at this point.
+func (w *MP4Writer) Flush() error {
+	m, ok := w.m.(*muxerMP4)
+	if !ok {
+		return w.m.flush()
+	}
+
+	for _, track := range m.tracks {
+		if len(track.Samples) != 0 {
+			m.curTrack = track
+			return m.flush()
+		}
+	}
+	return recordstore.ErrNoSegmentsFound
+}
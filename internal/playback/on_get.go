@@ -140,11 +140,13 @@ func (s *Server) onGet(ctx *gin.Context) {
 
 	ww := &writerWrapper{ctx: ctx}
 	var m muxer
+	var fragmented bool
 
 	format := ctx.Query("format")
 	switch format {
 	case "", "fmp4":
 		m = &muxerFMP4{w: ww}
+		fragmented = true
 
 	case "mp4":
 		m = &muxerMP4{w: ww}
@@ -171,7 +173,15 @@ func (s *Server) onGet(ctx *gin.Context) {
 		return
 	}
 
-	err = seekAndMux(pathConf.RecordFormat, segments, start, duration, m)
+	if recordstore.ProLayout(pathConf.RecordPath) {
+		if s.Exporter == nil {
+			s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("recordings of the Pro layout are not supported"))
+			return
+		}
+		err = s.Exporter.Export(consecutiveProSegments(segments), start, duration, ww, fragmented)
+	} else {
+		err = seekAndMux(pathConf.RecordFormat, segments, start, duration, m)
+	}
 	if err != nil {
 		// user aborted the download
 		var neterr *net.OpError
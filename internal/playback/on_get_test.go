@@ -2,6 +2,7 @@ package playback
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -1047,3 +1048,100 @@ func TestOnGetBetweenSegments(t *testing.T) {
 		})
 	}
 }
+
+type testSegmentExporter struct {
+	segments   []*recordstore.Segment
+	start      time.Time
+	duration   time.Duration
+	fragmented bool
+}
+
+func (e *testSegmentExporter) Export(
+	segments []*recordstore.Segment,
+	start time.Time,
+	duration time.Duration,
+	w io.Writer,
+	fragmented bool,
+) error {
+	e.segments = segments
+	e.start = start
+	e.duration = duration
+	e.fragmented = fragmented
+	_, err := w.Write([]byte("test"))
+	return err
+}
+
+func TestOnGetProLayout(t *testing.T) {
+	dir := t.TempDir()
+
+	start := time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC)
+
+	var fpaths []string
+
+	for i, seg := range []struct {
+		start    time.Time
+		duration float64
+	}{
+		{start, 60},
+		{start.Add(60 * time.Second), 30},
+		{start.Add(8 * time.Minute), 10}, // after a gap
+	} {
+		fpath := filepath.Join(dir, "20081107", fmt.Sprintf("20081107-112%d-aaaaaaaa.mp4", i))
+		fpaths = append(fpaths, fpath)
+
+		err := os.MkdirAll(filepath.Dir(fpath), 0o755)
+		require.NoError(t, err)
+		err = os.WriteFile(fpath, []byte{byte(i)}, 0o644)
+		require.NoError(t, err)
+		err = recordstore.WriteMetadata(fpath, &recordstore.Metadata{
+			PathName: "mypath",
+			Start:    seg.start,
+			Duration: seg.duration,
+		})
+		require.NoError(t, err)
+	}
+
+	exporter := &testSegmentExporter{}
+
+	s := &Server{
+		Address:      "127.0.0.1:9996",
+		ReadTimeout:  conf.Duration(10 * time.Second),
+		WriteTimeout: conf.Duration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				Name:       "mypath",
+				RecordPath: dir,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Exporter:    exporter,
+		Parent:      test.NilLogger,
+	}
+	err := s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	v := url.Values{}
+	v.Set("path", "mypath")
+	v.Set("start", start.Add(30*time.Second).Format(time.RFC3339Nano))
+	v.Set("duration", "600")
+	v.Set("format", "mp4")
+
+	res, err := http.Get("http://localhost:9996/get?" + v.Encode())
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	buf, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, []byte("test"), buf)
+
+	// segments after the gap are not exported
+	require.Len(t, exporter.segments, 2)
+	require.Equal(t, fpaths[0], exporter.segments[0].Fpath)
+	require.Equal(t, fpaths[1], exporter.segments[1].Fpath)
+	require.True(t, start.Add(30*time.Second).Equal(exporter.start))
+	require.Equal(t, 600*time.Second, exporter.duration)
+	require.False(t, exporter.fragmented)
+}
@@ -179,10 +179,16 @@ func (s *Server) onList(ctx *gin.Context) {
 		return
 	}
 
-	entries, err := parseAndConcatenate(pathConf.RecordFormat, segments)
-	if err != nil {
-		s.writeError(ctx, http.StatusInternalServerError, err)
-		return
+	var entries []listEntry
+
+	if recordstore.ProLayout(pathConf.RecordPath) {
+		entries = concatenateProSegments(segments)
+	} else {
+		entries, err = parseAndConcatenate(pathConf.RecordFormat, segments)
+		if err != nil {
+			s.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
 	}
 
 	if start != nil {
@@ -18,6 +18,7 @@ import (
 	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
 	"github.com/bluenviron/mediamtx/internal/auth"
 	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/test"
 	"github.com/stretchr/testify/require"
 )
@@ -335,3 +336,65 @@ func TestOnListCachedDuration(t *testing.T) {
 		},
 	}, out)
 }
+
+func TestOnListProLayout(t *testing.T) {
+	dir := t.TempDir()
+
+	start := time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC)
+
+	for i, seg := range []struct {
+		fpath    string
+		start    time.Time
+		duration float64
+	}{
+		{filepath.Join("20081107", "20081107-1122-aaaaaaaa.mp4"), start, 60},
+		{filepath.Join("20081107", "20081107-1123-bbbbbbbb.ts"), start.Add(60500 * time.Millisecond), 30},
+		{filepath.Join("20081107", "20081107-1130-cccccccc.mp4"), start.Add(8 * time.Minute), 10},
+	} {
+		fpath := filepath.Join(dir, seg.fpath)
+		err := os.MkdirAll(filepath.Dir(fpath), 0o755)
+		require.NoError(t, err)
+		err = os.WriteFile(fpath, []byte{byte(i)}, 0o644)
+		require.NoError(t, err)
+		err = recordstore.WriteMetadata(fpath, &recordstore.Metadata{
+			PathName: "mypath",
+			Start:    seg.start,
+			Duration: seg.duration,
+		})
+		require.NoError(t, err)
+	}
+
+	s := &Server{
+		Address:      "127.0.0.1:9996",
+		ReadTimeout:  conf.Duration(10 * time.Second),
+		WriteTimeout: conf.Duration(10 * time.Second),
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				Name:       "mypath",
+				RecordPath: dir,
+			},
+		},
+		AuthManager: test.NilAuthManager,
+		Parent:      test.NilLogger,
+	}
+	err := s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	res, err := http.Get("http://localhost:9996/list?path=mypath")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var out []map[string]interface{}
+	err = json.NewDecoder(res.Body).Decode(&out)
+	require.NoError(t, err)
+
+	// the first two recordings are consecutive and are merged
+	require.Len(t, out, 2)
+	require.Equal(t, start.Format(time.RFC3339Nano), out[0]["start"])
+	require.Equal(t, 90.5, out[0]["duration"])
+	require.Equal(t, start.Add(8*time.Minute).Format(time.RFC3339Nano), out[1]["start"])
+	require.Equal(t, float64(10), out[1]["duration"])
+}
@@ -0,0 +1,49 @@
+package playback
+
+import (
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+)
+
+// proSegmentsAreConsecutive returns whether a segment of the Pro layout starts where the previous one ends.
+func proSegmentsAreConsecutive(prevEnd time.Time, seg *recordstore.Segment) bool {
+	gap := seg.Start.Sub(prevEnd)
+	return gap <= concatenationTolerance && gap >= -concatenationTolerance
+}
+
+// concatenateProSegments merges consecutive segments of the Pro layout.
+// Their start and duration are read from metadata, therefore files are not parsed.
+func concatenateProSegments(segments []*recordstore.Segment) []listEntry {
+	out := []listEntry{}
+
+	for _, seg := range segments {
+		if len(out) != 0 {
+			last := &out[len(out)-1]
+			lastEnd := last.Start.Add(time.Duration(last.Duration))
+
+			if proSegmentsAreConsecutive(lastEnd, seg) {
+				last.Duration = listEntryDuration(seg.Start.Add(seg.Duration).Sub(last.Start))
+				continue
+			}
+		}
+
+		out = append(out, listEntry{
+			Start:    seg.Start,
+			Duration: listEntryDuration(seg.Duration),
+		})
+	}
+
+	return out
+}
+
+// consecutiveProSegments returns the first segments of the Pro layout that can be played without gaps.
+func consecutiveProSegments(segments []*recordstore.Segment) []*recordstore.Segment {
+	for i := 1; i < len(segments); i++ {
+		prevEnd := segments[i-1].Start.Add(segments[i-1].Duration)
+		if !proSegmentsAreConsecutive(prevEnd, segments[i]) {
+			return segments[:i]
+		}
+	}
+	return segments
+}
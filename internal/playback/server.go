@@ -2,6 +2,7 @@
 package playback
 
 import (
+	"io"
 	"net"
 	"net/http"
 	"sync"
@@ -11,6 +12,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/gin-gonic/gin"
 )
 
@@ -18,6 +20,20 @@ type serverAuthManager interface {
 	Authenticate(req *auth.Request) *auth.Error
 }
 
+// SegmentExporter writes segments of the Pro layout, that are MP4 and MPEG-TS files
+// that can't be read like fMP4 segments.
+type SegmentExporter interface {
+	// Export writes the interval of segments between start and start+duration.
+	// Segments are consecutive and ordered by start time.
+	Export(
+		segments []*recordstore.Segment,
+		start time.Time,
+		duration time.Duration,
+		w io.Writer,
+		fragmented bool,
+	) error
+}
+
 // Server is the playback server.
 type Server struct {
 	Address        string
@@ -30,6 +46,7 @@ type Server struct {
 	WriteTimeout   conf.Duration
 	PathConfs      map[string]*conf.Path
 	AuthManager    serverAuthManager
+	Exporter       SegmentExporter // optional, serves segments of the Pro layout
 	Parent         logger.Writer
 
 	httpServer *httpp.Server
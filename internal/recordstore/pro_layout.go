@@ -0,0 +1,279 @@
+package recordstore
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// metadataSuffix is appended to the path of a recording of the Pro layout
+// to obtain the path of its metadata file.
+const metadataSuffix = ".meta.json"
+
+// proDateFolderFormat is the format of the date folders of the Pro layout.
+const proDateFolderFormat = "20060102"
+
+// proSkippedFolders are folders of the record path that don't contain recordings to play.
+var proSkippedFolders = map[string]struct{}{
+	"tmp":   {},
+	"trash": {},
+}
+
+// Metadata describes a recording of the Pro layout.
+//
+// The Pro recorder writes MP4 and MPEG-TS files into date folders (recordPath/YYYYMMDD/*.mp4),
+// with names that don't contain the path name nor the precise start time,
+// therefore they are saved into a metadata file next to the recording.
+// The metadata file is written when the first sample is written and updated while the recording grows.
+type Metadata struct {
+	PathName string    `json:"pathName"`
+	Start    time.Time `json:"start"`    // NTP timestamp of the first sample
+	Duration float64   `json:"duration"` // seconds
+
+	// intervals of the file separated by pauses, present only when the recording has been paused.
+	// Paused intervals are not part of the file, therefore the file time of each part
+	// doesn't follow the time elapsed since Start.
+	Parts []MetadataPart `json:"parts,omitempty"`
+}
+
+// MetadataPart is an interval of a recording in which samples were written without pauses.
+type MetadataPart struct {
+	Start    time.Time `json:"start"`    // NTP timestamp of the first sample
+	Offset   float64   `json:"offset"`   // position in the file, in seconds
+	Duration float64   `json:"duration"` // seconds
+}
+
+// SetDuration sets the duration of the recording, adjusting the duration of its last part.
+func (m *Metadata) SetDuration(d time.Duration) {
+	m.Duration = d.Seconds()
+
+	if len(m.Parts) != 0 {
+		last := &m.Parts[len(m.Parts)-1]
+		last.Duration = max(0, m.Duration-last.Offset)
+	}
+}
+
+// End returns the NTP timestamp of the end of the recording.
+func (m *Metadata) End() time.Time {
+	if len(m.Parts) != 0 {
+		last := m.Parts[len(m.Parts)-1]
+		return last.Start.Add(seconds(last.Duration))
+	}
+	return m.Start.Add(seconds(m.Duration))
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
+
+// ProLayout returns whether a record path uses the Pro layout.
+// Record paths of the Pro layout are the root folder of recordings, without any placeholder.
+func ProLayout(recordPath string) bool {
+	return !strings.Contains(recordPath, "%")
+}
+
+// MetadataPath returns the path of the metadata file of a recording.
+func MetadataPath(fpath string) string {
+	return fpath + metadataSuffix
+}
+
+// ReadMetadata reads the metadata of a recording.
+func ReadMetadata(fpath string) (*Metadata, error) {
+	buf, err := os.ReadFile(MetadataPath(fpath))
+	if err != nil {
+		return nil, err
+	}
+
+	var m Metadata
+	err = json.Unmarshal(buf, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// WriteMetadata writes the metadata of a recording.
+func WriteMetadata(fpath string, m *Metadata) error {
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := MetadataPath(fpath) + ".tmp"
+
+	err = os.WriteFile(tmpPath, buf, 0o644)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpPath, MetadataPath(fpath))
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+// MoveMetadata moves the metadata file of a recording that has been renamed or moved.
+func MoveMetadata(oldPath string, newPath string) error {
+	err := os.Rename(MetadataPath(oldPath), MetadataPath(newPath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// RemoveMetadata removes the metadata file of a recording that has been deleted.
+func RemoveMetadata(fpath string) error {
+	err := os.Remove(MetadataPath(fpath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func isProRecording(fpath string) bool {
+	switch strings.ToLower(filepath.Ext(fpath)) {
+	case ".mp4", ".ts":
+		return true
+	}
+	return false
+}
+
+// proFolderInRange returns whether a folder of the record path may contain recordings between start and end.
+// Date folders are named after the day in which files were created, while the first sample of a file
+// can precede its creation (pre-event buffer) and files can be longer than the rest of the day,
+// therefore a day of margin is added on both sides.
+func proFolderInRange(name string, start *time.Time, end *time.Time) bool {
+	if _, err := time.ParseInLocation(proDateFolderFormat, name, time.Local); err != nil {
+		return true
+	}
+
+	if start != nil && name < start.In(time.Local).AddDate(0, 0, -1).Format(proDateFolderFormat) {
+		return false
+	}
+
+	if end != nil && name > end.In(time.Local).AddDate(0, 0, 1).Format(proDateFolderFormat) {
+		return false
+	}
+
+	return true
+}
+
+// walkProRecordings calls cb for each recording of the Pro layout that has a metadata file.
+// Date folders outside of the interval between start and end, when set, are not read.
+// Recordings without metadata, like the ones written by previous versions, are skipped.
+func walkProRecordings(recordPath string, start *time.Time, end *time.Time, cb func(fpath string, m *Metadata)) error {
+	recordPath, _ = filepath.Abs(recordPath)
+
+	entries, err := os.ReadDir(recordPath)
+	if err != nil {
+		return err
+	}
+
+	visit := func(fpath string, info fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && isProRecording(fpath) {
+			m, err := ReadMetadata(fpath)
+			if err == nil {
+				cb(fpath, m)
+			}
+		}
+
+		return nil
+	}
+
+	for _, entry := range entries {
+		fpath := filepath.Join(recordPath, entry.Name())
+
+		if !entry.IsDir() {
+			visit(fpath, entry, nil) //nolint:errcheck
+			continue
+		}
+
+		if _, ok := proSkippedFolders[entry.Name()]; ok || !proFolderInRange(entry.Name(), start, end) {
+			continue
+		}
+
+		err = filepath.WalkDir(fpath, visit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func proPathFindPathsWithSegments(pathConf *conf.Path) map[string]struct{} {
+	ret := make(map[string]struct{})
+
+	walkProRecordings(pathConf.RecordPath, nil, nil, func(_ string, m *Metadata) { //nolint:errcheck
+		if pathConf.Regexp == nil {
+			if m.PathName == pathConf.Name {
+				ret[m.PathName] = struct{}{}
+			}
+		} else if conf.IsValidPathName(m.PathName) == nil &&
+			pathConf.Regexp.FindStringSubmatch(m.PathName) != nil {
+			ret[m.PathName] = struct{}{}
+		}
+	})
+
+	return ret
+}
+
+func proPathFindSegments(
+	pathConf *conf.Path,
+	pathName string,
+	start *time.Time,
+	end *time.Time,
+) ([]*Segment, error) {
+	var segments []*Segment
+
+	err := walkProRecordings(pathConf.RecordPath, start, end, func(fpath string, m *Metadata) {
+		if m.PathName != pathName {
+			return
+		}
+
+		// recordings that have been paused are split into a segment for each part,
+		// since paused intervals are not part of the file.
+		if len(m.Parts) != 0 {
+			for i, part := range m.Parts {
+				if end == nil || !end.Before(part.Start) {
+					segments = append(segments, &Segment{
+						Fpath:     fpath,
+						Start:     part.Start,
+						Duration:  seconds(part.Duration),
+						Offset:    seconds(part.Offset),
+						Continued: i < len(m.Parts)-1,
+					})
+				}
+			}
+			return
+		}
+
+		// gather all segments that start before the end of the playback
+		if end == nil || !end.Before(m.Start) {
+			segments = append(segments, &Segment{
+				Fpath:    fpath,
+				Start:    m.Start,
+				Duration: seconds(m.Duration),
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
@@ -0,0 +1,180 @@
+package recordstore
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/stretchr/testify/require"
+)
+
+func writeProRecording(t *testing.T, fpath string, m *Metadata) {
+	err := os.MkdirAll(filepath.Dir(fpath), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(fpath, []byte{1}, 0o644)
+	require.NoError(t, err)
+
+	if m != nil {
+		err = WriteMetadata(fpath, m)
+		require.NoError(t, err)
+	}
+}
+
+func TestProLayoutFindSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	writeProRecording(t, filepath.Join(dir, "20150519", "20150519-2215-aaaaaaaa.mp4"), &Metadata{
+		PathName: "cam1",
+		Start:    time.Date(2015, 5, 19, 22, 15, 25, 0, time.UTC),
+		Duration: 60,
+	})
+	writeProRecording(t, filepath.Join(dir, "20150519", "20150519-2216-bbbbbbbb.ts"), &Metadata{
+		PathName: "cam1",
+		Start:    time.Date(2015, 5, 19, 22, 16, 25, 0, time.UTC),
+		Duration: 30,
+	})
+	writeProRecording(t, filepath.Join(dir, "20150520", "20150520-1000-cccccccc.mp4"), &Metadata{
+		PathName: "cam2",
+		Start:    time.Date(2015, 5, 20, 10, 0, 0, 0, time.UTC),
+		Duration: 10,
+	})
+
+	// recordings without metadata are skipped
+	writeProRecording(t, filepath.Join(dir, "20150520", "20150520-1100-dddddddd.mp4"), nil)
+
+	paths := FindAllPathsWithSegments(map[string]*conf.Path{
+		"~^cam.*$": {
+			Name:       "~^cam.*$",
+			Regexp:     regexp.MustCompile("^cam.*$"),
+			RecordPath: dir,
+		},
+	})
+	require.Equal(t, []string{"cam1", "cam2"}, paths)
+
+	start := time.Date(2015, 5, 19, 22, 16, 0, 0, time.UTC)
+
+	segments, err := FindSegments(
+		&conf.Path{
+			Name:       "cam1",
+			RecordPath: dir,
+		},
+		"cam1",
+		&start,
+		nil,
+	)
+	require.NoError(t, err)
+	require.Equal(t, []*Segment{
+		{
+			Fpath:    filepath.Join(dir, "20150519", "20150519-2215-aaaaaaaa.mp4"),
+			Start:    time.Date(2015, 5, 19, 22, 15, 25, 0, time.UTC),
+			Duration: 60 * time.Second,
+		},
+		{
+			Fpath:    filepath.Join(dir, "20150519", "20150519-2216-bbbbbbbb.ts"),
+			Start:    time.Date(2015, 5, 19, 22, 16, 25, 0, time.UTC),
+			Duration: 30 * time.Second,
+		},
+	}, segments)
+
+	// date folders outside of the requested interval are not read
+	writeProRecording(t, filepath.Join(dir, "20150601", "20150601-1000-eeeeeeee.mp4"), &Metadata{
+		PathName: "cam1",
+		Start:    time.Date(2015, 5, 19, 22, 17, 0, 0, time.UTC),
+		Duration: 10,
+	})
+	writeProRecording(t, filepath.Join(dir, "trash", "20150519", "20150519-2218-ffffffff.mp4"), &Metadata{
+		PathName: "cam1",
+		Start:    time.Date(2015, 5, 19, 22, 18, 0, 0, time.UTC),
+		Duration: 10,
+	})
+
+	end := time.Date(2015, 5, 19, 23, 0, 0, 0, time.UTC)
+
+	segments2, err := FindSegments(
+		&conf.Path{
+			Name:       "cam1",
+			RecordPath: dir,
+		},
+		"cam1",
+		&start,
+		&end,
+	)
+	require.NoError(t, err)
+	require.Equal(t, segments, segments2)
+
+	// metadata follows recordings that are moved
+	err = os.Rename(segments[0].Fpath, filepath.Join(dir, "moved.mp4"))
+	require.NoError(t, err)
+	err = MoveMetadata(segments[0].Fpath, filepath.Join(dir, "moved.mp4"))
+	require.NoError(t, err)
+
+	m, err := ReadMetadata(filepath.Join(dir, "moved.mp4"))
+	require.NoError(t, err)
+	require.Equal(t, "cam1", m.PathName)
+
+	err = RemoveMetadata(filepath.Join(dir, "moved.mp4"))
+	require.NoError(t, err)
+	_, err = os.Stat(MetadataPath(filepath.Join(dir, "moved.mp4")))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestProLayoutFindSegmentsParts(t *testing.T) {
+	dir := t.TempDir()
+
+	m := &Metadata{
+		PathName: "cam1",
+		Start:    time.Date(2015, 5, 19, 22, 15, 0, 0, time.UTC),
+		Duration: 30,
+		Parts: []MetadataPart{
+			{
+				Start:    time.Date(2015, 5, 19, 22, 15, 0, 0, time.UTC),
+				Offset:   0,
+				Duration: 10,
+			},
+			{
+				Start:    time.Date(2015, 5, 19, 22, 20, 0, 0, time.UTC),
+				Offset:   10,
+				Duration: 20,
+			},
+		},
+	}
+
+	// the file grew after the last update of the metadata
+	m.SetDuration(40 * time.Second)
+	require.Equal(t, 30.0, m.Parts[1].Duration)
+	require.Equal(t, time.Date(2015, 5, 19, 22, 20, 30, 0, time.UTC), m.End())
+
+	fpath := filepath.Join(dir, "20150519", "20150519-2215-aaaaaaaa.mp4")
+	writeProRecording(t, fpath, m)
+
+	start := time.Date(2015, 5, 19, 22, 15, 5, 0, time.UTC)
+
+	segments, err := FindSegments(
+		&conf.Path{
+			Name:       "cam1",
+			RecordPath: dir,
+		},
+		"cam1",
+		&start,
+		nil,
+	)
+	require.NoError(t, err)
+	require.Equal(t, []*Segment{
+		{
+			Fpath:     fpath,
+			Start:     time.Date(2015, 5, 19, 22, 15, 0, 0, time.UTC),
+			Duration:  10 * time.Second,
+			Continued: true,
+		},
+		{
+			Fpath:    fpath,
+			Start:    time.Date(2015, 5, 19, 22, 20, 0, 0, time.UTC),
+			Duration: 30 * time.Second,
+			Offset:   10 * time.Second,
+		},
+	}, segments)
+}
@@ -20,6 +20,15 @@ var errFound = errors.New("found")
 type Segment struct {
 	Fpath string
 	Start time.Time
+
+	// duration of segments of the Pro layout, read from their metadata
+	Duration time.Duration
+
+	// position of the segment in the file, for parts of Pro recordings that have been paused
+	Offset time.Duration
+
+	// whether the file continues after the end of the segment, with another part
+	Continued bool
 }
 
 func fixedPathHasSegments(pathConf *conf.Path) bool {
@@ -97,7 +106,11 @@ func FindAllPathsWithSegments(pathConfs map[string]*conf.Path) []string {
 	pathNames := make(map[string]struct{})
 
 	for _, pathConf := range pathConfs {
-		if pathConf.Regexp == nil {
+		if ProLayout(pathConf.RecordPath) {
+			for name := range proPathFindPathsWithSegments(pathConf) {
+				pathNames[name] = struct{}{}
+			}
+		} else if pathConf.Regexp == nil {
 			if fixedPathHasSegments(pathConf) {
 				pathNames[pathConf.Name] = struct{}{}
 			}
@@ -127,38 +140,14 @@ func FindSegments(
 	start *time.Time,
 	end *time.Time,
 ) ([]*Segment, error) {
-	recordPath := PathAddExtension(
-		strings.ReplaceAll(pathConf.RecordPath, "%path", pathName),
-		pathConf.RecordFormat,
-	)
-
-	// we have to convert to absolute paths
-	// otherwise, recordPath and fpath inside Walk() won't have common elements
-	recordPath, _ = filepath.Abs(recordPath)
-
-	commonPath := CommonPath(recordPath)
 	var segments []*Segment
+	var err error
 
-	err := filepath.WalkDir(commonPath, func(fpath string, info fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !info.IsDir() {
-			var pa Path
-			ok := pa.Decode(recordPath, fpath)
-
-			// gather all segments that start before the end of the playback
-			if ok && (end == nil || !end.Before(pa.Start)) {
-				segments = append(segments, &Segment{
-					Fpath: fpath,
-					Start: pa.Start,
-				})
-			}
-		}
-
-		return nil
-	})
+	if ProLayout(pathConf.RecordPath) {
+		segments, err = proPathFindSegments(pathConf, pathName, start, end)
+	} else {
+		segments, err = pathFindSegments(pathConf, pathName, end)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -197,3 +186,47 @@ func FindSegments(
 
 	return segments, nil
 }
+
+func pathFindSegments(
+	pathConf *conf.Path,
+	pathName string,
+	end *time.Time,
+) ([]*Segment, error) {
+	recordPath := PathAddExtension(
+		strings.ReplaceAll(pathConf.RecordPath, "%path", pathName),
+		pathConf.RecordFormat,
+	)
+
+	// we have to convert to absolute paths
+	// otherwise, recordPath and fpath inside Walk() won't have common elements
+	recordPath, _ = filepath.Abs(recordPath)
+
+	commonPath := CommonPath(recordPath)
+	var segments []*Segment
+
+	err := filepath.WalkDir(commonPath, func(fpath string, info fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			var pa Path
+			ok := pa.Decode(recordPath, fpath)
+
+			// gather all segments that start before the end of the playback
+			if ok && (end == nil || !end.Before(pa.Start)) {
+				segments = append(segments, &Segment{
+					Fpath: fpath,
+					Start: pa.Start,
+				})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
@@ -183,7 +183,11 @@ func (c *conn) runRead() error {
 	c.query = c.rconn.URL.RawQuery
 	c.mutex.Unlock()
 
-	r := &stream.Reader{Parent: c}
+	r := &stream.Reader{
+		Parent: c,
+		// start from the cached key frame, if the path caches key frames
+		StartFromKeyFrame: true,
+	}
 
 	err = rtmp.FromStream(strm.Desc, r, c.rconn, c.nconn, time.Duration(c.writeTimeout))
 	if err != nil {
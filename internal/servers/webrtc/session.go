@@ -315,7 +315,11 @@ func (s *session) runRead() (int, error) {
 		Log:                   s,
 	}
 
-	r := &stream.Reader{Parent: s}
+	r := &stream.Reader{
+		Parent: s,
+		// start from the cached key frame, if the path caches key frames
+		StartFromKeyFrame: true,
+	}
 
 	err = webrtc.FromStream(strm.Desc, r, pc)
 	if err != nil {
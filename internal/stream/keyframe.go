@@ -0,0 +1,123 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+// maxCachedGOPUnits is the maximum number of units that follow a key frame
+// and are kept in order to allow readers to start from it.
+const maxCachedGOPUnits = 256
+
+// KeyFrame is the latest random access unit of a video track.
+type KeyFrame struct {
+	Media  *description.Media
+	Format format.Format
+	Unit   *unit.Unit
+
+	// parameter sets (VPS, SPS, PPS) in use when the key frame was received.
+	Params [][]byte
+
+	Received time.Time
+}
+
+// keyFrameCache keeps the latest key frame of a format and the units that followed it.
+type keyFrameCache struct {
+	keyFrame   *KeyFrame
+	gop        []*unit.Unit
+	gopTooLong bool
+}
+
+func canCacheKeyFrames(forma format.Format) bool {
+	switch forma.(type) {
+	case *format.H264, *format.H265, *format.MJPEG:
+		return true
+	}
+	return false
+}
+
+func isRandomAccess(u *unit.Unit) bool {
+	switch payload := u.Payload.(type) {
+	case unit.PayloadH264:
+		return h264.IsRandomAccess(payload)
+
+	case unit.PayloadH265:
+		return h265.IsRandomAccess(payload)
+
+	case unit.PayloadMJPEG:
+		return true
+	}
+	return false
+}
+
+func formatParams(forma format.Format) [][]byte {
+	var params [][]byte
+
+	switch forma := forma.(type) {
+	case *format.H264:
+		sps, pps := forma.SafeParams()
+		params = [][]byte{sps, pps}
+
+	case *format.H265:
+		vps, sps, pps := forma.SafeParams()
+		params = [][]byte{vps, sps, pps}
+	}
+
+	ret := params[:0]
+	for _, p := range params {
+		if p != nil {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+func (c *keyFrameCache) add(medi *description.Media, forma format.Format, u *unit.Unit) {
+	if u.NilPayload() {
+		return
+	}
+
+	if isRandomAccess(u) {
+		c.keyFrame = &KeyFrame{
+			Media:    medi,
+			Format:   forma,
+			Unit:     u,
+			Params:   formatParams(forma),
+			Received: time.Now(),
+		}
+		c.gop = nil
+		c.gopTooLong = false
+		return
+	}
+
+	if c.keyFrame == nil || c.gopTooLong {
+		return
+	}
+
+	// the group of pictures is too long to be replayed: only the key frame is kept
+	if len(c.gop) >= maxCachedGOPUnits {
+		c.gop = nil
+		c.gopTooLong = true
+		return
+	}
+
+	c.gop = append(c.gop, u)
+}
+
+// units returns the key frame and the units that followed it.
+// It returns nil when the group of pictures can't be replayed.
+func (c *keyFrameCache) units() []*unit.Unit {
+	if c.keyFrame == nil || c.gopTooLong {
+		return nil
+	}
+
+	ret := make([]*unit.Unit, 0, 1+len(c.gop))
+	ret = append(ret, c.keyFrame.Unit)
+	return append(ret, c.gop...)
+}
@@ -19,6 +19,10 @@ type Reader struct {
 	SkipBytesSent bool
 	Parent        logger.Writer
 
+	// receive the cached key frame, and the units that followed it, before live units.
+	// It requires Stream.CacheKeyFrames.
+	StartFromKeyFrame bool
+
 	onDatas         map[*description.Media]map[format.Format]OnDataFunc
 	queueSize       int
 	buffer          *ringbuffer.RingBuffer
@@ -24,6 +24,7 @@ type Stream struct {
 	Desc               *description.Session
 	GenerateRTPPackets bool
 	FillNTP            bool
+	CacheKeyFrames     bool // keep the latest key frame of each video track
 	Parent             logger.Writer
 
 	bytesReceived    *uint64
@@ -63,6 +64,7 @@ func (s *Stream) Initialize() error {
 			media:              media,
 			generateRTPPackets: s.GenerateRTPPackets,
 			fillNTP:            s.FillNTP,
+			cacheKeyFrames:     s.CacheKeyFrames,
 			processingErrors:   s.processingErrors,
 			parent:             s.Parent,
 		}
@@ -166,6 +168,18 @@ func (s *Stream) AddReader(r *Reader) {
 
 	r.queueSize = s.WriteQueueSize
 	r.start()
+
+	// units are written while holding a read lock, therefore cached units
+	// are pushed before any live unit.
+	if r.StartFromKeyFrame {
+		for medi, formats := range r.onDatas {
+			sm := s.medias[medi]
+
+			for forma, onData := range formats {
+				sm.formats[forma].replayKeyFrame(s, r, onData)
+			}
+		}
+	}
 }
 
 // RemoveReader removes a reader.
@@ -188,6 +202,22 @@ func (s *Stream) RemoveReader(r *Reader) {
 	delete(s.readers, r)
 }
 
+// KeyFrame returns the latest key frame of a format.
+// It returns nil when CacheKeyFrames is false or no key frame has been received yet.
+func (s *Stream) KeyFrame(medi *description.Media, forma format.Format) *KeyFrame {
+	sm, ok := s.medias[medi]
+	if !ok {
+		return nil
+	}
+
+	sf, ok := sm.formats[forma]
+	if !ok {
+		return nil
+	}
+
+	return sf.keyFrame()
+}
+
 // WriteUnit writes a Unit.
 func (s *Stream) WriteUnit(medi *description.Media, forma format.Format, u *unit.Unit) {
 	sm := s.medias[medi]
@@ -1,6 +1,7 @@
 package stream
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -28,12 +29,15 @@ type streamFormat struct {
 	format             format.Format
 	generateRTPPackets bool
 	fillNTP            bool
+	cacheKeyFrames     bool
 	processingErrors   *counterdumper.CounterDumper
 	parent             logger.Writer
 
-	proc         codecprocessor.Processor
-	ntpEstimator *ntpestimator.Estimator
-	onDatas      map[*Reader]OnDataFunc
+	proc          codecprocessor.Processor
+	ntpEstimator  *ntpestimator.Estimator
+	onDatas       map[*Reader]OnDataFunc
+	keyFrameMutex sync.RWMutex
+	keyFrameCache *keyFrameCache
 }
 
 func (sf *streamFormat) initialize() error {
@@ -49,6 +53,10 @@ func (sf *streamFormat) initialize() error {
 		ClockRate: sf.format.ClockRate(),
 	}
 
+	if sf.cacheKeyFrames && canCacheKeyFrames(sf.format) {
+		sf.keyFrameCache = &keyFrameCache{}
+	}
+
 	return nil
 }
 
@@ -69,7 +77,8 @@ func (sf *streamFormat) writeRTPPacket(
 	ntp time.Time,
 	pts int64,
 ) {
-	hasNonRTSPReaders := len(sf.onDatas) > 0
+	// the key frame cache needs decoded payloads
+	hasNonRTSPReaders := len(sf.onDatas) > 0 || sf.keyFrameCache != nil
 
 	u := &unit.Unit{
 		PTS:        pts,
@@ -107,14 +116,53 @@ func (sf *streamFormat) writeUnitInner(s *Stream, medi *description.Media, u *un
 		}
 	}
 
+	if sf.keyFrameCache != nil {
+		sf.keyFrameMutex.Lock()
+		sf.keyFrameCache.add(medi, sf.format, u)
+		sf.keyFrameMutex.Unlock()
+	}
+
 	for sr, onData := range sf.onDatas {
-		csr := sr
-		cOnData := onData
-		sr.push(func() error {
-			if !csr.SkipBytesSent {
-				atomic.AddUint64(s.bytesSent, size)
-			}
-			return cOnData(u)
-		})
+		sf.pushUnit(s, sr, onData, u, size)
+	}
+}
+
+func (sf *streamFormat) pushUnit(s *Stream, sr *Reader, onData OnDataFunc, u *unit.Unit, size uint64) {
+	sr.push(func() error {
+		if !sr.SkipBytesSent {
+			atomic.AddUint64(s.bytesSent, size)
+		}
+		return onData(u)
+	})
+}
+
+func (sf *streamFormat) keyFrame() *KeyFrame {
+	if sf.keyFrameCache == nil {
+		return nil
+	}
+
+	sf.keyFrameMutex.RLock()
+	defer sf.keyFrameMutex.RUnlock()
+
+	return sf.keyFrameCache.keyFrame
+}
+
+// replayKeyFrame sends the cached key frame, and the units that followed it, to a reader.
+func (sf *streamFormat) replayKeyFrame(s *Stream, sr *Reader, onData OnDataFunc) {
+	if sf.keyFrameCache == nil {
+		return
+	}
+
+	sf.keyFrameMutex.RLock()
+	units := sf.keyFrameCache.units()
+	sf.keyFrameMutex.RUnlock()
+
+	// units would be discarded by the reader queue, making the group of pictures undecodable
+	if len(units) == 0 || len(units) > sr.queueSize/2 {
+		return
+	}
+
+	for _, u := range units {
+		sf.pushUnit(s, sr, onData, u, unitSize(u))
 	}
 }
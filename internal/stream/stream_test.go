@@ -104,3 +104,95 @@ func TestStreamSkipBytesSent(t *testing.T) {
 	require.Equal(t, uint64(14), strm.BytesReceived())
 	require.Equal(t, uint64(0), strm.BytesSent())
 }
+
+func TestStreamKeyFrameCache(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{
+		{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.H264{
+				PayloadTyp: 96,
+				SPS:        []byte{0x67, 1, 2},
+				PPS:        []byte{0x68, 3},
+			}},
+		},
+	}}
+
+	strm := &Stream{
+		WriteQueueSize:     512,
+		RTPMaxPayloadSize:  1450,
+		Desc:               desc,
+		GenerateRTPPackets: true,
+		CacheKeyFrames:     true,
+	}
+	err := strm.Initialize()
+	require.NoError(t, err)
+	defer strm.Close()
+
+	medi := desc.Medias[0]
+	forma := medi.Formats[0]
+
+	require.Nil(t, strm.KeyFrame(medi, forma))
+
+	// units that precede the first key frame are not cached
+	strm.WriteUnit(medi, forma, &unit.Unit{
+		PTS:     30000 * 1,
+		Payload: unit.PayloadH264{{1, 1}},
+	})
+	require.Nil(t, strm.KeyFrame(medi, forma))
+
+	strm.WriteUnit(medi, forma, &unit.Unit{
+		PTS:     30000 * 2,
+		Payload: unit.PayloadH264{{5, 2}}, // IDR
+	})
+	strm.WriteUnit(medi, forma, &unit.Unit{
+		PTS:     30000 * 3,
+		Payload: unit.PayloadH264{{1, 3}},
+	})
+
+	kf := strm.KeyFrame(medi, forma)
+	require.NotNil(t, kf)
+	require.Equal(t, int64(30000*2), kf.Unit.PTS)
+	require.Equal(t, [][]byte{{0x67, 1, 2}, {0x68, 3}}, kf.Params)
+
+	r := &Reader{
+		StartFromKeyFrame: true,
+	}
+
+	recv := make(chan int64, 3)
+
+	r.OnData(medi, forma, func(u *unit.Unit) error {
+		recv <- u.PTS
+		return nil
+	})
+
+	strm.AddReader(r)
+	defer strm.RemoveReader(r)
+
+	strm.WriteUnit(medi, forma, &unit.Unit{
+		PTS:     30000 * 4,
+		Payload: unit.PayloadH264{{1, 4}},
+	})
+
+	require.Equal(t, int64(30000*2), <-recv)
+	require.Equal(t, int64(30000*3), <-recv)
+	require.Equal(t, int64(30000*4), <-recv)
+}
+
+func TestStreamKeyFrameCacheGOPTooLong(t *testing.T) {
+	c := &keyFrameCache{}
+	medi := &description.Media{Type: description.MediaTypeVideo}
+	forma := &format.H264{}
+
+	c.add(medi, forma, &unit.Unit{Payload: unit.PayloadH264{{5, 1}}})
+	for range maxCachedGOPUnits {
+		c.add(medi, forma, &unit.Unit{Payload: unit.PayloadH264{{1, 1}}})
+	}
+	require.Len(t, c.units(), 1+maxCachedGOPUnits)
+
+	c.add(medi, forma, &unit.Unit{Payload: unit.PayloadH264{{1, 1}}})
+	require.Nil(t, c.units())
+	require.NotNil(t, c.keyFrame)
+
+	c.add(medi, forma, &unit.Unit{Payload: unit.PayloadH264{{5, 1}}})
+	require.Len(t, c.units(), 1)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/pro/recorder"
+)
+
+const (
+	// defaultBookmarkClip is the duration exported before and after a bookmark, when not specified.
+	defaultBookmarkClip = 10 * time.Second
+
+	// wsCmdRecordBookmark is the WebSocket command that adds a bookmark.
+	wsCmdRecordBookmark = "record.bookmark"
+)
+
+// apiV2BookmarksReq is the request for listing the bookmarks of a recording.
+type apiV2BookmarksReq struct {
+	ResPath string `form:"resPath" binding:"required"`
+}
+
+// onRecordBookmark handles POST /v2/record/bookmark
+func (a *APIV2) onRecordBookmark(ctx *gin.Context) {
+	var params recorder.BookmarkParams
+	err := ctx.BindJSON(&params)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	bookmark, err := a.RecordManager.AddBookmark(&params)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  bookmark,
+	})
+}
+
+// onWSRecordBookmark handles the record.bookmark WebSocket command.
+func (a *APIV2) onWSRecordBookmark(raw json.RawMessage) (interface{}, error) {
+	var params recorder.BookmarkParams
+	err := json.Unmarshal(raw, &params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	if params.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	return a.RecordManager.AddBookmark(&params)
+}
+
+// onRecordBookmarksGet handles GET /v2/record/bookmarks?resPath=/20260301/xxx.mp4
+func (a *APIV2) onRecordBookmarksGet(ctx *gin.Context) {
+	var req apiV2BookmarksReq
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	a.mutex.RLock()
+	recordPath := a.Conf.PathDefaults.RecordPath
+	a.mutex.RUnlock()
+
+	fullPath, err := a.validateFilePath(req.ResPath, recordPath)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err = os.Stat(fullPath); os.IsNotExist(err) {
+		a.writeError(ctx, http.StatusNotFound, fmt.Errorf("file not found: %s", req.ResPath))
+		return
+	}
+
+	bookmarks, err := recorder.ReadBookmarks(fullPath)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"bookmarks": bookmarks,
+			"total":     len(bookmarks),
+		},
+	})
+}
+
+// resolveBookmarkClip replaces the interval of an export with the interval that surrounds its bookmark.
+func (a *APIV2) resolveBookmarkClip(recordPath string, c *ExportMP4Config) error {
+	fullPath, err := a.validateFilePath(c.ResPath, recordPath)
+	if err != nil {
+		return err
+	}
+
+	bookmark, err := recorder.FindBookmark(fullPath, c.BookmarkID)
+	if err != nil {
+		return err
+	}
+
+	before, after := defaultBookmarkClip, defaultBookmarkClip
+	if c.Before > 0 {
+		before = time.Duration(c.Before * float64(time.Second))
+	}
+	if c.After > 0 {
+		after = time.Duration(c.After * float64(time.Second))
+	}
+
+	c.InputStart, c.InputEnd = bookmark.ClipAround(before, after)
+	return nil
+}
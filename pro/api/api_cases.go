@@ -0,0 +1,243 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/pro/cases"
+)
+
+// apiV2CaseOpenReq is the body of POST /v2/cases/open
+type apiV2CaseOpenReq struct {
+	PathName string `json:"pathName" binding:"required"`
+	cases.Metadata
+}
+
+// apiV2CaseSearchReq represents case search query parameters
+type apiV2CaseSearchReq struct {
+	Search          string     `form:"search"`
+	PathName        string     `form:"pathName"`
+	Status          string     `form:"status"` // "open", "closed"
+	PatientID       string     `form:"patientId"`
+	AccessionNumber string     `form:"accessionNumber"`
+	Start           *time.Time `form:"start"`
+	End             *time.Time `form:"end"`
+	Page            int        `form:"page"`
+	PageSize        int        `form:"pageSize"`
+}
+
+func (a *APIV2) writeCaseError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, cases.ErrCaseNotFound):
+		a.writeError(ctx, http.StatusNotFound, err)
+	case errors.Is(err, cases.ErrCaseOpen), errors.Is(err, cases.ErrCaseClosed):
+		a.writeError(ctx, http.StatusConflict, err)
+	default:
+		a.writeError(ctx, http.StatusInternalServerError, err)
+	}
+}
+
+// onCaseOpen handles POST /v2/cases/open
+func (a *APIV2) onCaseOpen(ctx *gin.Context) {
+	var req apiV2CaseOpenReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	c, err := a.Cases.Open(req.PathName, req.Metadata)
+	if err != nil {
+		a.writeCaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  c,
+	})
+}
+
+// onCaseClose handles POST /v2/cases/:id/close
+func (a *APIV2) onCaseClose(ctx *gin.Context) {
+	c, err := a.Cases.Close(ctx.Param("id"))
+	if err != nil {
+		a.writeCaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  c,
+	})
+}
+
+// onCasesList handles GET /v2/cases
+func (a *APIV2) onCasesList(ctx *gin.Context) {
+	var req apiV2CaseSearchReq
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	switch cases.Status(req.Status) {
+	case "", cases.StatusOpen, cases.StatusClosed:
+	default:
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid status: %s", req.Status))
+		return
+	}
+
+	res := a.Cases.Search(cases.Query{
+		Text:            req.Search,
+		PathName:        req.PathName,
+		Status:          cases.Status(req.Status),
+		PatientID:       req.PatientID,
+		AccessionNumber: req.AccessionNumber,
+		Start:           req.Start,
+		End:             req.End,
+		Page:            req.Page,
+		PageSize:        req.PageSize,
+	})
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  res,
+	})
+}
+
+// onCaseGet handles GET /v2/cases/:id
+func (a *APIV2) onCaseGet(ctx *gin.Context) {
+	c, err := a.Cases.Get(ctx.Param("id"))
+	if err != nil {
+		a.writeCaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  c,
+	})
+}
+
+// onCasePackage handles GET /v2/cases/:id/package
+// The ZIP archive is streamed, therefore errors after the first byte can't be reported.
+func (a *APIV2) onCasePackage(ctx *gin.Context) {
+	c, err := a.Cases.Get(ctx.Param("id"))
+	if err != nil {
+		a.writeCaseError(ctx, err)
+		return
+	}
+
+	name := c.ID
+	if c.AccessionNumber != "" {
+		name = c.AccessionNumber
+	}
+
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"case-%s.zip\"", name))
+	ctx.Status(http.StatusOK)
+
+	_, err = a.Cases.Package(c.ID, ctx.Writer)
+	if err != nil {
+		a.Log(logger.Error, "failed to package case %s: %v", c.ID, err)
+	}
+}
+
+// exportCaseID returns the case of an export: the requested one,
+// or the case that contains the first source file.
+func (a *APIV2) exportCaseID(body *ExportMP4Body, recordPath string) (string, error) {
+	if a.Cases == nil {
+		return "", nil
+	}
+
+	if body.CaseID != "" {
+		_, err := a.Cases.Get(body.CaseID)
+		if err != nil {
+			return "", err
+		}
+		return body.CaseID, nil
+	}
+
+	for _, c := range body.ExportConfig {
+		fullPath, err := a.validateFilePath(c.ResPath, recordPath)
+		if err != nil {
+			continue
+		}
+		if rel, ok := a.caseRelPath(fullPath); ok {
+			if id, ok := a.Cases.FindByFile(rel); ok {
+				return id, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// keepCaseExport moves the result of an export from its job folder, that expires,
+// into the date folder and links it to a case.
+func (a *APIV2) keepCaseExport(caseID string, resultFile string) (string, error) {
+	dest := filepath.Join(a.Cases.RecordPath, time.Now().Format("20060102"), filepath.Base(resultFile))
+
+	err := os.MkdirAll(filepath.Dir(dest), 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(resultFile, dest)
+	if err != nil {
+		return "", err
+	}
+
+	a.indexAdd(dest)
+
+	rel, _ := a.caseRelPath(dest)
+	err = a.Cases.LinkTo(caseID, rel, cases.KindExport)
+	if err != nil {
+		a.Log(logger.Warn, "failed to link %s to case %s: %v", dest, caseID, err)
+	}
+
+	return dest, nil
+}
+
+// caseRelPath returns the path of a file relative to the record path of cases.
+func (a *APIV2) caseRelPath(fullPath string) (string, bool) {
+	root, _ := filepath.Abs(a.Cases.RecordPath)
+	abs, _ := filepath.Abs(fullPath)
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// casesLink links a file produced on a path to the open cases, if available.
+func (a *APIV2) casesLink(pathName string, fullPath string, kind string, start time.Time, end time.Time) []string {
+	if a.Cases == nil {
+		return nil
+	}
+	rel, ok := a.caseRelPath(fullPath)
+	if !ok {
+		return nil
+	}
+	return a.Cases.Link(pathName, rel, kind, start, end)
+}
+
+// casesMove updates the cases after a file has been moved, if available.
+func (a *APIV2) casesMove(oldPath string, newPath string) {
+	if a.Cases == nil {
+		return
+	}
+	oldRel, ok1 := a.caseRelPath(oldPath)
+	newRel, ok2 := a.caseRelPath(newPath)
+	if ok1 && ok2 {
+		a.Cases.Move(oldRel, newRel)
+	}
+}
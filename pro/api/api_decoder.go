@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// onDecodersList handles GET /v2/decoders
+func (a *APIV2) onDecodersList(ctx *gin.Context) {
+	workers := a.DecoderPool.Workers()
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"workers": workers,
+			"total":   len(workers),
+		},
+	})
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/pro/devicedriver"
+)
+
+// deviceInfoTimeout is the maximum duration of a request to a device.
+const deviceInfoTimeout = 5 * time.Second
+
+// onDeviceGet handles GET /v2/devices/get/*name
+func (a *APIV2) onDeviceGet(ctx *gin.Context) {
+	name := ctx.Param("name")
+	if len(name) < 2 || name[0] != '/' {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+	name = name[1:]
+
+	a.mutex.RLock()
+	pathConf, _, err := conf.FindPathConf(a.Conf.Paths, name)
+	a.mutex.RUnlock()
+
+	if err != nil {
+		a.writeError(ctx, http.StatusNotFound, err)
+		return
+	}
+
+	if pathConf.DeviceType == "" {
+		a.writeError(ctx, http.StatusNotFound, fmt.Errorf("path '%s' has no device type", name))
+		return
+	}
+
+	drv, dev, err := devicedriver.Open(pathConf.DeviceType, pathConf)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx.Request.Context(), deviceInfoTimeout)
+	defer cancel()
+
+	info, err := drv.Info(reqCtx, dev)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadGateway, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  info,
+	})
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+	"github.com/bluenviron/mediamtx/pro/cases"
+	"github.com/bluenviron/mediamtx/pro/dicom"
+)
+
+// apiV2DicomExportReq is the body of POST /v2/dicom/export
+type apiV2DicomExportReq struct {
+	Files        []string `json:"files" binding:"required"` // snapshots (.jpg) and clips (.mp4, .ts), relative to the record path
+	CaseID       string   `json:"caseId"`
+	Endoscopic   bool     `json:"endoscopic"`
+	Destinations []string `json:"destinations"` // optional, PACS that receive the files
+	dicom.Metadata
+}
+
+// apiV2DicomFile is a DICOM file produced by POST /v2/dicom/export
+type apiV2DicomFile struct {
+	Source         string `json:"source"`
+	Path           string `json:"path"`
+	SOPInstanceUID string `json:"sopInstanceUid"`
+}
+
+// dicomMetadataFromCase fills empty attributes with the ones of a case.
+// The study instance UID is derived from the case ID, therefore all exports of a case
+// belong to the same study.
+func dicomMetadataFromCase(m *dicom.Metadata, c *cases.Case) {
+	if m.PatientID == "" {
+		m.PatientID = c.PatientID
+	}
+	if m.AccessionNumber == "" {
+		m.AccessionNumber = c.AccessionNumber
+	}
+	if m.OperatorsName == "" {
+		m.OperatorsName = c.Operator
+	}
+	if m.StudyInstanceUID == "" {
+		if u, err := uuid.Parse(c.ID); err == nil {
+			m.StudyInstanceUID = dicom.UUIDToUID(u)
+		}
+	}
+}
+
+// dicomContentTime returns the acquisition time of a file:
+// the start of recordings, when available, or the modification time.
+func dicomContentTime(fullPath string, fi os.FileInfo) time.Time {
+	if md, err := recordstore.ReadMetadata(fullPath); err == nil && !md.Start.IsZero() {
+		return md.Start
+	}
+	return fi.ModTime()
+}
+
+// onDicomExport handles POST /v2/dicom/export
+// Every file is converted into a .dcm file placed next to it. Images and videos
+// are placed into two series of the same study.
+func (a *APIV2) onDicomExport(ctx *gin.Context) {
+	var req apiV2DicomExportReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(req.Files) == 0 {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("files is required"))
+		return
+	}
+
+	a.mutex.RLock()
+	recordPath := strings.Split(a.Conf.PathDefaults.RecordPath, "%")[0]
+	a.mutex.RUnlock()
+
+	if err := a.pacsCheckDestinations(req.Destinations); err != nil {
+		a.writePACSError(ctx, err)
+		return
+	}
+
+	var studyTime time.Time
+
+	if req.CaseID != "" {
+		if a.Cases == nil {
+			a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("cases are not available"))
+			return
+		}
+
+		c, err := a.Cases.Get(req.CaseID)
+		if err != nil {
+			a.writeCaseError(ctx, err)
+			return
+		}
+
+		dicomMetadataFromCase(&req.Metadata, c)
+		studyTime = c.OpenedAt
+	}
+
+	if req.StudyInstanceUID == "" {
+		req.StudyInstanceUID = dicom.NewUID()
+	}
+
+	// validate all files before writing anything
+	fullPaths := make([]string, len(req.Files))
+	for i, f := range req.Files {
+		fullPath, err := a.validateFilePath(f, recordPath)
+		if err != nil {
+			a.writeError(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		switch strings.ToLower(filepath.Ext(fullPath)) {
+		case ".jpg", ".jpeg", ".mp4", ".ts":
+		default:
+			a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("unsupported file type: %s", f))
+			return
+		}
+
+		if _, err := os.Stat(fullPath); err != nil {
+			a.writeError(ctx, http.StatusNotFound, fmt.Errorf("file not found: %s", f))
+			return
+		}
+
+		fullPaths[i] = fullPath
+	}
+
+	tempDir := filepath.Join(recordPath, "tmp", "dicom")
+	err := os.MkdirAll(tempDir, 0o755)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	imageSeries := req.Metadata
+	imageSeries.SeriesInstanceUID = dicom.NewUID()
+	videoSeries := req.Metadata
+	videoSeries.SeriesInstanceUID = dicom.NewUID()
+	imageCount, videoCount := 0, 0
+
+	files := make([]apiV2DicomFile, 0, len(fullPaths))
+	dests := make([]string, 0, len(fullPaths))
+
+	for i, fullPath := range fullPaths {
+		fi, err := os.Stat(fullPath)
+		if err != nil {
+			a.writeError(ctx, http.StatusNotFound, fmt.Errorf("file not found: %s", req.Files[i]))
+			return
+		}
+
+		dest := strings.TrimSuffix(fullPath, filepath.Ext(fullPath)) + ".dcm"
+
+		f, err := os.Create(dest)
+		if err != nil {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+
+		opts := dicom.Options{
+			Endoscopic:  req.Endoscopic,
+			StudyTime:   studyTime,
+			ContentTime: dicomContentTime(fullPath, fi),
+		}
+
+		var uid string
+
+		switch strings.ToLower(filepath.Ext(fullPath)) {
+		case ".jpg", ".jpeg":
+			var buf []byte
+			buf, err = os.ReadFile(fullPath)
+			if err == nil {
+				imageCount++
+				opts.SeriesNumber = 1
+				opts.InstanceNumber = imageCount
+				uid, err = dicom.WriteImage(f, buf, imageSeries, opts)
+			}
+
+		default:
+			videoCount++
+			opts.SeriesNumber = 2
+			opts.InstanceNumber = videoCount
+			uid, err = dicom.WriteVideo(f, fullPath, tempDir, videoSeries, opts, a)
+		}
+
+		f.Close()
+
+		if err != nil {
+			os.Remove(dest)
+			a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("failed to convert %s: %w", req.Files[i], err))
+			return
+		}
+
+		a.Log(logger.Info, "DICOM file written: %s", dest)
+		dests = append(dests, dest)
+
+		files = append(files, apiV2DicomFile{
+			Source:         req.Files[i],
+			Path:           filepath.ToSlash(a.PathToURL(dest)),
+			SOPInstanceUID: uid,
+		})
+	}
+
+	jobs, err := a.pacsEnqueue(req.Destinations, dests)
+	if err != nil {
+		a.writePACSError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"studyInstanceUid": req.StudyInstanceUID,
+			"files":            files,
+			"jobs":             jobs,
+		},
+	})
+}
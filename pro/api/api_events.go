@@ -0,0 +1,171 @@
+package api
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/pro/healthcheck"
+	"github.com/bluenviron/mediamtx/pro/recorder"
+	"github.com/bluenviron/mediamtx/pro/websocketapi"
+)
+
+// WebSocket events of paths, recordings and health checks.
+// Clients can subscribe to them by topic and path pattern.
+const (
+	wsEventPathReady        = "path.ready"
+	wsEventPathNotReady     = "path.notready"
+	wsEventPublisherJoin    = "path.publisher.join"
+	wsEventPublisherLeave   = "path.publisher.leave"
+	wsEventReaderJoin       = "path.reader.join"
+	wsEventReaderLeave      = "path.reader.leave"
+	wsEventHealthTransition = "health.transition"
+	wsEventRecordPrefix     = "record." // followed by the type of recorder.RecordingEvent
+)
+
+// wsPathReady is the data of the path.ready event.
+type wsPathReady struct {
+	Source    *defs.APIPathSourceOrReader `json:"source"`
+	ReadyTime *time.Time                  `json:"readyTime"`
+	Tracks    []string                    `json:"tracks"`
+}
+
+// OnPathPublisherJoin is called by a path when its publisher, or its static source, is attached.
+func (a *APIV2) OnPathPublisherJoin(pathName string, source defs.APIPathSourceOrReader) {
+	a.wsHub.BroadcastPathEvent(wsEventPublisherJoin, pathName, source)
+}
+
+// OnPathPublisherLeave is called by a path when its publisher, or its static source, is detached.
+func (a *APIV2) OnPathPublisherLeave(pathName string, source defs.APIPathSourceOrReader) {
+	a.wsHub.BroadcastPathEvent(wsEventPublisherLeave, pathName, source)
+}
+
+// OnPathReady is called by a path when its stream becomes available.
+func (a *APIV2) OnPathReady(pathName string, source defs.APIPathSourceOrReader, readyTime time.Time, tracks []string) {
+	a.wsHub.BroadcastPathEvent(wsEventPathReady, pathName, &wsPathReady{
+		Source:    &source,
+		ReadyTime: &readyTime,
+		Tracks:    tracks,
+	})
+}
+
+// OnPathNotReady is called by a path when its stream is no longer available.
+func (a *APIV2) OnPathNotReady(pathName string) {
+	a.wsHub.BroadcastPathEvent(wsEventPathNotReady, pathName, nil)
+}
+
+// OnPathReaderJoin is called by a path when a reader is added.
+func (a *APIV2) OnPathReaderJoin(pathName string, reader defs.APIPathSourceOrReader) {
+	a.wsHub.BroadcastPathEvent(wsEventReaderJoin, pathName, reader)
+}
+
+// OnPathReaderLeave is called by a path when a reader is removed.
+func (a *APIV2) OnPathReaderLeave(pathName string, reader defs.APIPathSourceOrReader) {
+	a.wsHub.BroadcastPathEvent(wsEventReaderLeave, pathName, reader)
+}
+
+// replayPathEvents returns the events that describe the current state of paths.
+func (a *APIV2) replayPathEvents() []*websocketapi.Event {
+	list, err := a.PathManager.APIPathsList()
+	if err != nil {
+		a.Log(logger.Warn, "unable to list paths: %v", err)
+		return nil
+	}
+
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].Name < list.Items[j].Name
+	})
+
+	var ret []*websocketapi.Event
+	for _, p := range list.Items {
+		if p.Source != nil {
+			ret = append(ret, &websocketapi.Event{Event: wsEventPublisherJoin, Path: p.Name, Data: *p.Source})
+		}
+		if p.Ready {
+			ret = append(ret, &websocketapi.Event{
+				Event: wsEventPathReady,
+				Path:  p.Name,
+				Data:  &wsPathReady{Source: p.Source, ReadyTime: p.ReadyTime, Tracks: p.Tracks},
+			})
+		}
+		for _, r := range sortedReaders(p.Readers) {
+			ret = append(ret, &websocketapi.Event{Event: wsEventReaderJoin, Path: p.Name, Data: r})
+		}
+	}
+	return ret
+}
+
+func sortedReaders(readers []defs.APIPathSourceOrReader) []defs.APIPathSourceOrReader {
+	ret := append([]defs.APIPathSourceOrReader(nil), readers...)
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Type != ret[j].Type {
+			return ret[i].Type < ret[j].Type
+		}
+		return ret[i].ID < ret[j].ID
+	})
+	return ret
+}
+
+// initEvents starts the generation of the events of recordings.
+// Events of paths are generated by the path manager through the OnPath* methods.
+func (a *APIV2) initEvents() {
+	if a.RecordManager != nil {
+		a.RecordManager.SetEventHandler(a.onRecordingEvent)
+	}
+
+	a.wsHub.SetReplay(a.replayEvents)
+}
+
+func (a *APIV2) closeEvents() {
+	if a.RecordManager != nil {
+		a.RecordManager.SetEventHandler(nil)
+	}
+}
+
+func (a *APIV2) onRecordingEvent(e recorder.RecordingEvent) {
+	a.wsHub.BroadcastPathEvent(wsEventRecordPrefix+e.Type, e.PathName, e)
+}
+
+// OnHealthTransition is called by the health checker when the state of a path changes.
+func (a *APIV2) OnHealthTransition(pathName string, t healthcheck.Transition) {
+	if a.wsHub != nil {
+		a.wsHub.BroadcastPathEvent(wsEventHealthTransition, pathName, t)
+	}
+}
+
+// replayEvents returns the events that describe the current state, sent to clients when they subscribe.
+func (a *APIV2) replayEvents() []*websocketapi.Event {
+	ret := a.replayPathEvents()
+
+	if a.RecordManager != nil {
+		for _, e := range a.RecordManager.RecordingEvents() {
+			ret = append(ret, &websocketapi.Event{Event: wsEventRecordPrefix + e.Type, Path: e.PathName, Data: e})
+		}
+	}
+
+	a.mutex.RLock()
+	c := a.healthChecker
+	a.mutex.RUnlock()
+
+	if c != nil {
+		for _, h := range c.Paths() {
+			if len(h.History) == 0 {
+				continue
+			}
+			ret = append(ret, &websocketapi.Event{
+				Event: wsEventHealthTransition,
+				Path:  h.Name,
+				Data:  h.History[len(h.History)-1],
+			})
+		}
+	}
+
+	for _, job := range a.exportJobs.List() {
+		if !job.Finished() {
+			ret = append(ret, &websocketapi.Event{Event: wsEventExportJob, Data: job})
+		}
+	}
+
+	return ret
+}
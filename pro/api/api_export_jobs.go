@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/pro/exportjobs"
+)
+
+// wsEventExportJob is the WebSocket event sent when the status or the progress of an export job changes.
+const wsEventExportJob = "export.job"
+
+// initExportJobs starts the export job queue. Jobs work inside tmp/exports of the record path.
+func (a *APIV2) initExportJobs() error {
+	recordPaths := strings.Split(a.Conf.PathDefaults.RecordPath, "%")
+	baseWorkPath := ""
+	if recordPaths[0] != "" {
+		baseWorkPath = recordPaths[0]
+	}
+
+	a.exportJobs = &exportjobs.Queue{
+		Workers:   a.Conf.ExportWorkers,
+		Retention: time.Duration(a.Conf.ExportJobRetention),
+		WorkDir:   filepath.Join(baseWorkPath, "tmp", "exports"),
+		URL:       a.PathToURL,
+		OnUpdate:  a.onExportJobUpdate,
+		Parent:    a,
+	}
+	return a.exportJobs.Initialize()
+}
+
+func (a *APIV2) onExportJobUpdate(job exportjobs.Job) {
+	if a.wsHub != nil {
+		a.wsHub.BroadcastEvent(wsEventExportJob, job)
+	}
+}
+
+func (a *APIV2) writeExportJobError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, exportjobs.ErrJobNotFound):
+		a.writeError(ctx, http.StatusNotFound, err)
+	case errors.Is(err, exportjobs.ErrJobFinished):
+		a.writeError(ctx, http.StatusConflict, err)
+	default:
+		a.writeError(ctx, http.StatusInternalServerError, err)
+	}
+}
+
+// onExportJobSubmit handles POST /v2/file/export/jobs
+func (a *APIV2) onExportJobSubmit(ctx *gin.Context) {
+	job, ok := a.submitExportMP4(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  job,
+	})
+}
+
+// onExportJobsList handles GET /v2/file/export/jobs
+func (a *APIV2) onExportJobsList(ctx *gin.Context) {
+	jobs := a.exportJobs.List()
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"jobs":  jobs,
+			"total": len(jobs),
+		},
+	})
+}
+
+// onExportJobGet handles GET /v2/file/export/jobs/:id
+func (a *APIV2) onExportJobGet(ctx *gin.Context) {
+	job, err := a.exportJobs.Get(ctx.Param("id"))
+	if err != nil {
+		a.writeExportJobError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  job,
+	})
+}
+
+// onExportJobCancel handles POST /v2/file/export/jobs/:id/cancel
+func (a *APIV2) onExportJobCancel(ctx *gin.Context) {
+	job, err := a.exportJobs.Cancel(ctx.Param("id"))
+	if err != nil {
+		a.writeExportJobError(ctx, err)
+		return
+	}
+
+	a.Log(logger.Info, "export job %s canceled", job.ID)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  job,
+	})
+}
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -14,6 +16,9 @@ import (
 	_ "image/png"
 
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/pro/clipexport"
+	"github.com/bluenviron/mediamtx/pro/exportjobs"
+	"github.com/bluenviron/mediamtx/pro/recorder"
 	"github.com/gin-gonic/gin"
 	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
@@ -33,13 +38,21 @@ type VideoMark struct {
 
 type ExportMP4Config struct {
 	ID         string       `json:"id" form:"id"  binding:"required"`
-	InputStart float64      `json:"inputStart" form:"inputStart"  binding:"required"`
-	InputEnd   float64      `json:"inputEnd" form:"inputEnd"  binding:"required"`
+	InputStart float64      `json:"inputStart" form:"inputStart"`
+	InputEnd   float64      `json:"inputEnd" form:"inputEnd"`
 	ResPath    string       `json:"resPath" form:"resPath"  binding:"required"`
 	VideoMarks *[]VideoMark `json:"videoMarks" form:"videoMarks"`
+
+	// 围绕书签截取：设置后 inputStart/inputEnd 由书签位置计算
+	BookmarkID string  `json:"bookmarkId" form:"bookmarkId"`
+	Before     float64 `json:"before" form:"before"` // 书签前的秒数，默认 10
+	After      float64 `json:"after" form:"after"`   // 书签后的秒数，默认 10
 }
 type ExportMP4Body struct {
 	ExportConfig []ExportMP4Config `json:"exportConfig" form:"exportConfig"  binding:"required"`
+
+	// 关联的病例：为空时使用第一个源文件所属的病例。关联病例的导出结果保存在日期文件夹中
+	CaseID string `json:"caseId" form:"caseId"`
 }
 
 // FormatSRTTime formats a time.Duration as an SRT timestamp (e.g., "00:01:20,000")
@@ -80,45 +93,33 @@ func WriteSRTFile(filename string, subtitles []Subtitle) error {
 	return nil
 }
 
-// CreateListFile generates a list.txt file with video file paths for FFmpeg concatenation
-func CreateListFile(filename string, videoFiles []string) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	for _, videoFile := range videoFiles {
-		_, err := fmt.Fprintf(file, "file '%s'\n", videoFile)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
 type VideoInfo struct {
 	Streams []struct {
-		// CodecType string `json:"codec_type"`
-		Width  int
-		Height int
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int
+		Height    int
 	} `json:"streams"`
 }
 
-func (a *APIV2) splitVideo(betweenStart float64, betweenEnd float64, baseOutName string, idx int, inputFile string, tmpFolderPath string, btArgs ffmpeg.KwArgs) string {
-	splitbetweentime := strconv.FormatFloat(betweenStart, 'f', 2, 64) + "-" + strconv.FormatFloat(betweenEnd, 'f', 2, 64)
-	outBetweenFileName := baseOutName + "_split_" + strconv.Itoa(idx) + "_0______" + splitbetweentime + ".mp4"
-	outBetweenFile := filepath.Join(tmpFolderPath, outBetweenFileName)
-
-	err := ffmpeg.Input(inputFile, btArgs).
-		Output(outBetweenFile, ffmpeg.KwArgs{"c": "copy"}).OverWriteOutput().ErrorToStdOut().Run()
+// encoderFor returns the FFmpeg encoder that keeps the codec of the recording,
+// so that re-encoded segments can be concatenated with the copied ones.
+func encoderFor(codecName string) string {
+	if codecName == "hevc" {
+		return "libx265"
+	}
+	return "libx264"
+}
 
-	if err != nil {
-		a.Log(logger.Error, "splitVideo", err)
+// secondsClip returns a clip of a recording that is copied without re-encoding.
+func secondsClip(inputFile string, start float64, end float64) clipexport.Clip {
+	return clipexport.Clip{
+		Path:  inputFile,
+		Start: time.Duration(start * float64(time.Second)),
+		End:   time.Duration(end * float64(time.Second)),
 	}
-	return outBetweenFile
 }
+
 func (a *APIV2) PathToURL(inputPath string) string {
 	a.mutex.RLock()
 	recordPath := a.Conf.PathDefaults.RecordPath
@@ -135,11 +136,42 @@ func (a *APIV2) PathToURL(inputPath string) string {
 	return newStr
 }
 
+// ExportMP4 handles POST /v2/file/export/mp4.
+// It waits for the export to complete and returns the result file, the job is canceled when the client disconnects.
+// POST /v2/file/export/jobs submits the same export without waiting.
 func (a *APIV2) ExportMP4(ctx *gin.Context) {
+	job, ok := a.submitExportMP4(ctx)
+	if !ok {
+		return
+	}
+
+	id := job.ID
+	job, err := a.exportJobs.Wait(ctx.Request.Context(), id)
+	if err != nil {
+		a.exportJobs.Cancel(id) //nolint:errcheck
+		return
+	}
+
+	if job.Status != exportjobs.StatusCompleted {
+		ctx.JSON(http.StatusOK, gin.H{"success": false, "error": job.Error})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"outfile": job.Outfile,
+		},
+	})
+}
+
+// submitExportMP4 validates an export request and submits its job.
+// When false is returned, the error response has already been written.
+func (a *APIV2) submitExportMP4(ctx *gin.Context) (exportjobs.Job, bool) {
 	var editFileBody ExportMP4Body
 	if err := ctx.ShouldBindJSON(&editFileBody); err != nil {
 		ctx.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
-		return
+		return exportjobs.Job{}, false
 	}
 
 	a.mutex.RLock()
@@ -151,282 +183,328 @@ func (a *APIV2) ExportMP4(ctx *gin.Context) {
 	if recordPaths[0] != "" {
 		baseWorkPath = recordPaths[0]
 	}
-	var outfiles []string
-	// var outerr error
 
-	unixName := strconv.FormatInt(time.Now().Unix(), 10)
-	tmpFolderPath := filepath.Join(baseWorkPath, "/tmp", "/", unixName)
+	for i := range editFileBody.ExportConfig {
+		buildConfig := &editFileBody.ExportConfig[i]
 
-	for idx, buildConfig := range editFileBody.ExportConfig {
-
-		// idx 防止相同文件的截取拼接
-		outfile, err := a.BuildMP4(idx, baseWorkPath, tmpFolderPath, buildConfig)
+		if buildConfig.BookmarkID != "" {
+			err := a.resolveBookmarkClip(baseWorkPath, buildConfig)
+			if err != nil {
+				if errors.Is(err, recorder.ErrBookmarkNotFound) {
+					a.writeError(ctx, http.StatusNotFound, fmt.Errorf("bookmark '%s' not found in %s", buildConfig.BookmarkID, buildConfig.ResPath))
+				} else {
+					a.writeError(ctx, http.StatusBadRequest, err)
+				}
+				return exportjobs.Job{}, false
+			}
+		}
 
-		if err != nil {
-			a.Log(logger.Error, "BuildMP4:", err)
-		} else {
-			outfiles = append(outfiles, outfile)
+		if buildConfig.InputEnd <= buildConfig.InputStart {
+			a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("inputEnd must be greater than inputStart"))
+			return exportjobs.Job{}, false
 		}
+	}
 
+	caseID, err := a.exportCaseID(&editFileBody, baseWorkPath)
+	if err != nil {
+		a.writeCaseError(ctx, err)
+		return exportjobs.Job{}, false
 	}
 
-	if len(outfiles) == 0 {
-		defer ctx.JSON(http.StatusOK, gin.H{"success": false, "error": "outfiles=0"})
-	} else if len(outfiles) == 1 {
-		defer ctx.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"result": gin.H{
-				"outfile": a.PathToURL(outfiles[0]),
+	job, err := a.exportJobs.Submit(a.exportJob(editFileBody.ExportConfig, baseWorkPath, caseID))
+	if err != nil {
+		a.writeError(ctx, http.StatusServiceUnavailable, err)
+		return exportjobs.Job{}, false
+	}
+
+	return job, true
+}
+
+// exportJob returns the job that builds clips of export configurations
+// and concatenates them into a MP4 file. Results of cases are kept with the case files.
+func (a *APIV2) exportJob(configs []ExportMP4Config, baseWorkPath string, caseID string) exportjobs.RunFunc {
+	return func(ctx context.Context, dir string, progress func(float64)) (string, error) {
+		var clips []clipexport.Clip
+
+		// 构建片段（FFmpeg 处理标记）占前 20% 进度，拼接占其余部分
+		for idx, buildConfig := range configs {
+			// idx 防止相同文件的截取拼接
+			configClips, err := a.BuildMP4(ctx, idx, baseWorkPath, dir, buildConfig)
+			if err != nil {
+				if ctx.Err() != nil {
+					return "", ctx.Err()
+				}
+				a.Log(logger.Error, "BuildMP4: %v", err)
+			} else {
+				clips = append(clips, configClips...)
+			}
+
+			progress(0.2 * float64(idx+1) / float64(len(configs)))
+		}
+
+		if len(clips) == 0 {
+			return "", fmt.Errorf("outfiles=0")
+		}
+
+		// 所有片段在关键帧处截取后直接拼接为一个 MP4，不经过 FFmpeg
+		resultFile := filepath.Join(dir, filepath.Base(dir)+"_result.mp4")
+
+		exporter := &clipexport.Exporter{
+			Clips:   clips,
+			OutPath: resultFile,
+			TempDir: dir,
+			Parent:  a,
+			Context: ctx,
+			OnProgress: func(p float64) {
+				progress(0.2 + 0.8*p)
 			},
-		})
-		// defer ctx.File(outfiles[0])
-	} else if len(outfiles) > 1 {
+		}
 
-		concatFilesName := unixName + "_concatfiles.txt"
-		concatFiles := filepath.Join(tmpFolderPath, concatFilesName)
-		errf := CreateListFile(concatFiles, outfiles)
+		err := exporter.Run()
+		if err != nil {
+			return "", err
+		}
 
-		if errf != nil {
-			a.Log(logger.Error, "CreateListFile", errf)
+		if caseID != "" {
+			return a.keepCaseExport(caseID, resultFile)
 		}
 
-		resultFileName := unixName + "_result.mp4"
-		resultFile := filepath.Join(tmpFolderPath, resultFileName)
-
-		outerr := ffmpeg.Input(concatFiles,
-			ffmpeg.KwArgs{"f": "concat", "safe": 0},
-		).Output(resultFile, ffmpeg.KwArgs{"c": "copy"}).OverWriteOutput().Run()
-
-		if outerr != nil {
-			defer ctx.JSON(http.StatusOK, gin.H{"success": false, "error": outerr.Error()})
-		} else {
-			defer ctx.JSON(http.StatusOK, gin.H{
-				"success": true,
-				"result": gin.H{
-					"outfile": a.PathToURL(resultFile),
-				},
-			})
-			// defer ctx.File(resultFile)
+		return resultFile, nil
+	}
+}
+
+// runFFmpeg runs a FFmpeg command and kills it when ctx is canceled.
+func runFFmpeg(ctx context.Context, s *ffmpeg.Stream) error {
+	cmd := s.Compile()
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill() //nolint:errcheck
+		case <-done:
 		}
+	}()
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
+	return err
 }
 
-// go test examples/run3_test.go -v
-func (a *APIV2) BuildMP4(idx int, baseWorkPath string, tmpFolderPath string, exportMP4Config ExportMP4Config) (resultFile string, err error) {
+// BuildMP4 returns the clips of an export configuration.
+// Clips are copied without re-encoding; FFmpeg is only used to burn VideoMarks
+// (subtitles and overlays) into the segments around them.
+func (a *APIV2) BuildMP4(ctx context.Context, idx int, baseWorkPath string, tmpFolderPath string, exportMP4Config ExportMP4Config) ([]clipexport.Clip, error) {
 	inputStart := exportMP4Config.InputStart
 	inputEnd := exportMP4Config.InputEnd
-	//
 
 	baseOutName := exportMP4Config.ID + "-" + strconv.Itoa(idx) + "-"
 
-	// inputFile := "/Users/lele/Downloads/4k.mp4"
-	// inputFile := "/Users/lele/WebstormProjects/2024/ffmpeg-go-master/examples/sample_data/4k.mp4"
 	inputFile := filepath.Join(baseWorkPath, exportMP4Config.ResPath)
 
-	a.Log(logger.Info, "splitVideo", "inputFile start rebuild:", inputFile, inputStart, inputEnd)
+	_, err := os.Stat(inputFile)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Log(logger.Info, "build clips of %s (%.2f-%.2f)", inputFile, inputStart, inputEnd)
 
-	if _, err := os.Stat(tmpFolderPath); os.IsNotExist(err) {
-		// 必须分成两步
-		// 先创建文件夹
-		os.MkdirAll(tmpFolderPath, 0777)
-		// 再修改权限
-		os.Chmod(tmpFolderPath, 0777)
+	if exportMP4Config.VideoMarks == nil || len(*exportMP4Config.VideoMarks) == 0 {
+		return []clipexport.Clip{secondsClip(inputFile, inputStart, inputEnd)}, nil
 	}
 
-	videoFiles := []string{}
+	var clips []clipexport.Clip
 
 	inputdata, errProbe := ffmpeg.Probe(inputFile)
 
 	if errProbe != nil {
-		a.Log(logger.Error, "get inputVideo error", errProbe)
-		return resultFile, errProbe
+		a.Log(logger.Error, "get inputVideo error: %v", errProbe)
+		return nil, errProbe
 	}
 
 	vInfo := &VideoInfo{}
 	err = json.Unmarshal([]byte(inputdata), vInfo)
 	if err != nil {
-		a.Log(logger.Error, "get inputVideo Parse error", err, inputdata)
-		return resultFile, err
+		a.Log(logger.Error, "get inputVideo Parse error: %v", err)
+		return nil, err
 	}
 
-	if exportMP4Config.VideoMarks != nil && len(*exportMP4Config.VideoMarks) > 0 {
-		VideoMarks := *exportMP4Config.VideoMarks
-
-		for _, mask := range VideoMarks {
-			// 当第一个mask不包含全局开始
-			// 从全局开始截图到第一个mask开始
-			firstVideoMask := mask
-			// isAppend := false
-			firstStart := inputStart
-
-			if inputStart == 0 && firstVideoMask.Seconds == 0 {
-				break
-			}
-			if mask.Seconds > inputStart+2 {
-				firstEnd := mask.Seconds - 2
-				if inputStart > firstEnd {
-					firstEnd = mask.Seconds
-				}
-				firstbtArgs := ffmpeg.KwArgs{"ss": inputStart, "to": firstEnd}
-				outBetweenFile := a.splitVideo(firstStart, firstEnd, baseOutName, 0, inputFile, tmpFolderPath, firstbtArgs)
-				videoFiles = append(videoFiles, outBetweenFile)
-				break
+	videoIdx := -1
+	hasAudio := false
+	for i, stream := range vInfo.Streams {
+		switch stream.CodecType {
+		case "video":
+			if videoIdx < 0 {
+				videoIdx = i
 			}
+		case "audio":
+			hasAudio = true
 		}
-		// 迭代结构体数组
-		for idx, mask := range VideoMarks {
-
-			// mask.Seconds = mask.Seconds - inputStart
-			// 超出截取范围的蒙版
-			if mask.Seconds < inputStart || mask.Seconds > inputEnd {
-				continue
-			}
-
-			srtfilename := baseOutName + "_subtitle" + strconv.Itoa(idx) + ".srt"
-			srtoutfile := filepath.Join(tmpFolderPath, srtfilename)
-
-			subtitle := Subtitle{
-				Index:     1,
-				StartTime: 0 * time.Second,
-				EndTime:   4 * time.Second,
-				Text:      mask.Content,
-			}
+	}
+	if videoIdx < 0 {
+		return nil, fmt.Errorf("video stream not found in %s", inputFile)
+	}
+	width := vInfo.Streams[videoIdx].Width
+	height := vInfo.Streams[videoIdx].Height
+	encoder := encoderFor(vInfo.Streams[videoIdx].CodecName)
 
-			err = WriteSRTFile(srtoutfile, []Subtitle{subtitle})
+	VideoMarks := *exportMP4Config.VideoMarks
 
-			if err != nil {
-				a.Log(logger.Error, "Error writing SRT file:", err)
-				return
-			}
+	for _, mask := range VideoMarks {
+		// 当第一个mask不包含全局开始
+		// 从全局开始截图到第一个mask开始
+		firstVideoMask := mask
 
-			start := mask.Seconds - 2
-			end := mask.Seconds + 2
-			if mask.Seconds <= 0 {
-				start = 0
-				end = mask.Seconds + 4
+		if inputStart == 0 && firstVideoMask.Seconds == 0 {
+			break
+		}
+		if mask.Seconds > inputStart+2 {
+			firstEnd := mask.Seconds - 2
+			if inputStart > firstEnd {
+				firstEnd = mask.Seconds
 			}
+			clips = append(clips, secondsClip(inputFile, inputStart, firstEnd))
+			break
+		}
+	}
+	// 迭代结构体数组
+	for idx, mask := range VideoMarks {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 
-			a.Log(logger.Info, "start split:", start, end)
-
-			if mask.Content != "" {
-				// 先添加字幕
-				splitInput := ffmpeg.Input(inputFile, ffmpeg.KwArgs{"ss": start, "to": end})
-				splittime := strconv.FormatFloat(start, 'f', 2, 64) + "-" + strconv.FormatFloat(end, 'f', 2, 64)
-				outSplitFileName := baseOutName + "_split_" + strconv.Itoa(idx) + "_1______" + splittime + ".mp4"
-				outSplitFile := filepath.Join(tmpFolderPath, outSplitFileName)
+		// 超出截取范围的蒙版
+		if mask.Seconds < inputStart || mask.Seconds > inputEnd {
+			continue
+		}
 
-				err1 := splitInput.Output(outSplitFile, ffmpeg.KwArgs{"vf": "subtitles=" + srtoutfile, "c:a": "copy"}).
-					OverWriteOutput().
-					Run()
+		srtfilename := baseOutName + "_subtitle" + strconv.Itoa(idx) + ".srt"
+		srtoutfile := filepath.Join(tmpFolderPath, srtfilename)
 
-				if err1 != nil {
-					a.Log(logger.Error, "output file", err)
-				}
+		subtitle := Subtitle{
+			Index:     1,
+			StartTime: 0 * time.Second,
+			EndTime:   4 * time.Second,
+			Text:      mask.Content,
+		}
 
-				// a.Log(logger.Info, "", vInfo.Streams[0].Height)
-				// a.Log(logger.Info, "", vInfo.Streams[0].Width)
+		err = WriteSRTFile(srtoutfile, []Subtitle{subtitle})
 
-				// 再添加圈画
-				if mask.URL != "" {
-					if err1 == nil {
-						outSplitFileName2 := baseOutName + "_split_" + strconv.Itoa(idx) + "_2______" + splittime + ".mp4"
-						outSplitFile2 := filepath.Join(tmpFolderPath, outSplitFileName2)
+		if err != nil {
+			a.Log(logger.Error, "Error writing SRT file: %v", err)
+			return nil, err
+		}
 
-						overlay := ffmpeg.Input(mask.URL).Filter("scale", ffmpeg.Args{strconv.Itoa(vInfo.Streams[0].Width) + ":" + strconv.Itoa(vInfo.Streams[0].Height)})
+		start := mask.Seconds - 2
+		end := mask.Seconds + 2
+		if mask.Seconds <= 0 {
+			start = 0
+			end = mask.Seconds + 4
+		}
 
-						err2 := ffmpeg.Filter(
-							[]*ffmpeg.Stream{
-								ffmpeg.Input(outSplitFile),
-								overlay,
-							}, "overlay", ffmpeg.Args{"0:0"}).
-							Output(outSplitFile2).OverWriteOutput().ErrorToStdOut().Run()
+		a.Log(logger.Info, "start split: %.2f-%.2f", start, end)
 
-						if err2 == nil {
-							videoFiles = append(videoFiles, outSplitFile2)
+		if mask.Content != "" {
+			// 先添加字幕（需要重新编码）
+			splitInput := ffmpeg.Input(inputFile, ffmpeg.KwArgs{"ss": start, "to": end})
+			splittime := strconv.FormatFloat(start, 'f', 2, 64) + "-" + strconv.FormatFloat(end, 'f', 2, 64)
+			outSplitFileName := baseOutName + "_split_" + strconv.Itoa(idx) + "_1______" + splittime + ".mp4"
+			outSplitFile := filepath.Join(tmpFolderPath, outSplitFileName)
 
-						} else {
-							a.Log(logger.Error, "mask.URL output file", err)
-						}
-					}
+			err1 := runFFmpeg(ctx, splitInput.Output(outSplitFile, ffmpeg.KwArgs{"vf": "subtitles=" + srtoutfile, "c:v": encoder, "c:a": "copy"}).
+				OverWriteOutput())
 
-				} else {
-					videoFiles = append(videoFiles, outSplitFile)
-				}
+			if err1 != nil {
+				a.Log(logger.Error, "output file: %v", err1)
+			}
 
-				if idx < len(VideoMarks)-1 {
+			// 再添加圈画
+			if mask.URL != "" {
+				if err1 == nil {
+					outSplitFileName2 := baseOutName + "_split_" + strconv.Itoa(idx) + "_2______" + splittime + ".mp4"
+					outSplitFile2 := filepath.Join(tmpFolderPath, outSplitFileName2)
 
-					nextMask := VideoMarks[idx+1]
+					overlay := ffmpeg.Input(mask.URL).Filter("scale", ffmpeg.Args{strconv.Itoa(width) + ":" + strconv.Itoa(height)})
 
-					betweenStart := mask.Seconds + 2
-					if mask.Seconds <= 0 {
-						betweenStart = mask.Seconds + 4
+					splitStream := ffmpeg.Input(outSplitFile)
+					streams := []*ffmpeg.Stream{
+						ffmpeg.Filter(
+							[]*ffmpeg.Stream{
+								splitStream,
+								overlay,
+							}, "overlay", ffmpeg.Args{"0:0"}),
 					}
-					betweenEnd := nextMask.Seconds - 2
+					outArgs := ffmpeg.KwArgs{"c:v": encoder}
 
-					if betweenStart > betweenEnd {
-						betweenStart = mask.Seconds
+					// 保留音频，否则拼接时整个导出的音轨会被丢弃
+					if hasAudio {
+						streams = append(streams, splitStream.Audio())
+						outArgs["c:a"] = "copy"
 					}
 
-					btArgs := ffmpeg.KwArgs{"ss": betweenStart}
+					err2 := runFFmpeg(ctx, ffmpeg.Output(streams, outSplitFile2, outArgs).OverWriteOutput().ErrorToStdOut())
 
-					if idx <= len(VideoMarks) {
-						btArgs["to"] = betweenEnd
+					if err2 == nil {
+						clips = append(clips, clipexport.Clip{Path: outSplitFile2})
+					} else {
+						a.Log(logger.Error, "mask.URL output file: %v", err2)
 					}
-					outBetweenFile := a.splitVideo(betweenStart, betweenEnd, baseOutName, idx, inputFile, tmpFolderPath, btArgs)
-
-					videoFiles = append(videoFiles, outBetweenFile)
 				}
 
+			} else if err1 == nil {
+				clips = append(clips, clipexport.Clip{Path: outSplitFile})
 			}
-		}
 
-		lastIndex := len(VideoMarks) - 1
+			if idx < len(VideoMarks)-1 {
 
-		if lastIndex >= 0 {
-			lastVideoMask := VideoMarks[len(VideoMarks)-1]
+				nextMask := VideoMarks[idx+1]
 
-			lastStart := lastVideoMask.Seconds + 2
+				betweenStart := mask.Seconds + 2
+				if mask.Seconds <= 0 {
+					betweenStart = mask.Seconds + 4
+				}
+				betweenEnd := nextMask.Seconds - 2
 
-			if lastVideoMask.Seconds <= 0 {
-				lastStart = lastVideoMask.Seconds + 4
-			}
+				if betweenStart > betweenEnd {
+					betweenStart = mask.Seconds
+				}
 
-			if lastStart > inputEnd {
-				lastStart = lastVideoMask.Seconds
+				if betweenEnd > betweenStart {
+					clips = append(clips, secondsClip(inputFile, betweenStart, betweenEnd))
+				}
 			}
 
-			lastbtArgs := ffmpeg.KwArgs{"ss": lastStart, "to": inputEnd}
-			outBetweenFile := a.splitVideo(lastStart, inputEnd, baseOutName, 0, inputFile, tmpFolderPath, lastbtArgs)
-			videoFiles = append(videoFiles, outBetweenFile)
 		}
-
-	} else {
-		lastbtArgs := ffmpeg.KwArgs{"ss": inputStart, "to": inputEnd}
-		outBetweenFile := a.splitVideo(inputStart, inputEnd, baseOutName, 0, inputFile, tmpFolderPath, lastbtArgs)
-		videoFiles = append(videoFiles, outBetweenFile)
 	}
 
-	concatFilesName := baseOutName + "_concatfiles.txt"
-	concatFiles := filepath.Join(tmpFolderPath, concatFilesName)
-	errf := CreateListFile(concatFiles, videoFiles)
+	lastIndex := len(VideoMarks) - 1
 
-	if errf != nil {
-		a.Log(logger.Error, "CreateListFile", errf)
-		return resultFile, err
-	}
+	if lastIndex >= 0 {
+		lastVideoMask := VideoMarks[len(VideoMarks)-1]
 
-	resultFileName := baseOutName + "_result.mp4"
-	resultFile = filepath.Join(tmpFolderPath, resultFileName)
+		lastStart := lastVideoMask.Seconds + 2
 
-	outerr := ffmpeg.Input(concatFiles,
-		ffmpeg.KwArgs{"f": "concat", "safe": 0},
-	).Output(resultFile, ffmpeg.KwArgs{"c": "copy"}).OverWriteOutput().Run()
+		if lastVideoMask.Seconds <= 0 {
+			lastStart = lastVideoMask.Seconds + 4
+		}
 
-	if outerr != nil {
-		a.Log(logger.Error, "CreateListFile", outerr.Error())
-		return resultFile, err
-	} else {
-		return resultFile, err
+		if lastStart > inputEnd {
+			lastStart = lastVideoMask.Seconds
+		}
+
+		if inputEnd > lastStart {
+			clips = append(clips, secondsClip(inputFile, lastStart, inputEnd))
+		}
 	}
 
+	return clips, nil
 }
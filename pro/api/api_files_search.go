@@ -0,0 +1,218 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/pro/fileindex"
+)
+
+// apiV2FileSearchReq represents file search query parameters
+type apiV2FileSearchReq struct {
+	Search      string     `form:"search"`
+	Type        string     `form:"type"` // "video", "image"
+	PathName    string     `form:"pathName"`
+	SourceName  string     `form:"sourceName"`
+	GroupName   string     `form:"groupName"`
+	Tag         string     `form:"tag"`
+	Favorite    *bool      `form:"favorite"`
+	Start       *time.Time `form:"start"`
+	End         *time.Time `form:"end"`
+	MinDuration *float64   `form:"minDuration"`
+	MaxDuration *float64   `form:"maxDuration"`
+	MinSize     *int64     `form:"minSize"`
+	MaxSize     *int64     `form:"maxSize"`
+	Sort        string     `form:"sort"`  // "time", "name", "size", "duration"
+	Order       string     `form:"order"` // "asc", "desc"
+	Page        int        `form:"page"`
+	PageSize    int        `form:"pageSize"`
+}
+
+// apiV2FileSearchEntry is a search result, with the URL of the file
+type apiV2FileSearchEntry struct {
+	fileindex.Entry
+	URL string `json:"url"`
+}
+
+// onFilesSearch handles GET /v2/files/search
+func (a *APIV2) onFilesSearch(ctx *gin.Context) {
+	var req apiV2FileSearchReq
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	switch req.Sort {
+	case "", fileindex.SortTime, fileindex.SortName, fileindex.SortSize, fileindex.SortDuration:
+	default:
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid sort: %s", req.Sort))
+		return
+	}
+
+	if req.Order != "" && req.Order != "asc" && req.Order != "desc" {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid order: %s", req.Order))
+		return
+	}
+
+	res := a.FileIndex.Search(fileindex.Query{
+		Text:        req.Search,
+		Type:        req.Type,
+		PathName:    req.PathName,
+		SourceName:  req.SourceName,
+		GroupName:   req.GroupName,
+		Tag:         req.Tag,
+		Favorite:    req.Favorite,
+		Start:       req.Start,
+		End:         req.End,
+		MinDuration: req.MinDuration,
+		MaxDuration: req.MaxDuration,
+		MinSize:     req.MinSize,
+		MaxSize:     req.MaxSize,
+		Sort:        req.Sort,
+		Asc:         req.Order == "asc",
+		Page:        req.Page,
+		PageSize:    req.PageSize,
+	})
+
+	a.mutex.RLock()
+	recordPath := a.Conf.PathDefaults.RecordPath
+	a.mutex.RUnlock()
+
+	files := make([]apiV2FileSearchEntry, len(res.Entries))
+	for i, e := range res.Entries {
+		files[i] = apiV2FileSearchEntry{
+			Entry: e,
+			URL:   a.PathToURL(filepath.Join(recordPath, filepath.FromSlash(e.Path))),
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"files":    files,
+			"total":    res.Total,
+			"page":     res.Page,
+			"pageSize": res.PageSize,
+		},
+	})
+}
+
+// onFilesIndexRebuild handles POST /v2/files/index/rebuild
+func (a *APIV2) onFilesIndexRebuild(ctx *gin.Context) {
+	count, err := a.FileIndex.Rebuild()
+	if err != nil {
+		a.writeError(ctx, http.StatusConflict, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"files": count,
+		},
+	})
+}
+
+// onFilesIndexStats handles GET /v2/files/index/stats
+func (a *APIV2) onFilesIndexStats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  a.FileIndex.Stats(),
+	})
+}
+
+// listIndexedFiles lists files in a directory from the file index.
+// Subdirectories are still read from disk, since the index contains files only.
+func (a *APIV2) listIndexedFiles(recordPath string, dir string, fileType *string, search *string) []FileInfo {
+	files := []FileInfo{}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		a.Log(logger.Warn, "Failed to read directory %s: %v", dir, err)
+		return files
+	}
+
+	if fileType == nil || *fileType == "" {
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			files = append(files, FileInfo{
+				Name:     entry.Name(),
+				Path:     a.PathToURL(filepath.Join(dir, entry.Name())),
+				ModTime:  info.ModTime(),
+				IsDir:    true,
+				FileType: "other",
+			})
+		}
+	}
+
+	rel, err := filepath.Rel(recordPath, dir)
+	if err != nil {
+		return files
+	}
+
+	q := fileindex.Query{
+		Dir:  filepath.ToSlash(rel),
+		Sort: fileindex.SortName,
+		Asc:  true,
+	}
+	if fileType != nil {
+		q.Type = *fileType
+	}
+	if search != nil {
+		q.Text = *search
+	}
+
+	for _, e := range a.FileIndex.List(q) {
+		files = append(files, FileInfo{
+			Name:     e.Name,
+			Path:     a.PathToURL(filepath.Join(recordPath, filepath.FromSlash(e.Path))),
+			Size:     e.Size,
+			ModTime:  e.ModTime,
+			FileType: e.Type,
+		})
+	}
+
+	return files
+}
+
+// indexAdd adds a file to the file index, if available.
+func (a *APIV2) indexAdd(fullPath string) {
+	if a.FileIndex == nil {
+		return
+	}
+	if err := a.FileIndex.Add(fullPath); err != nil {
+		a.Log(logger.Warn, "failed to index %s: %v", fullPath, err)
+	}
+}
+
+// indexMove updates the file index after a file has been moved, if available.
+func (a *APIV2) indexMove(oldPath string, newPath string) {
+	if a.FileIndex == nil {
+		return
+	}
+	if err := a.FileIndex.Move(oldPath, newPath); err != nil {
+		a.Log(logger.Warn, "failed to index %s: %v", newPath, err)
+	}
+}
+
+// indexRemove removes a file from the file index, if available.
+func (a *APIV2) indexRemove(fullPath string) {
+	if a.FileIndex == nil {
+		return
+	}
+	if err := a.FileIndex.Remove(fullPath); err != nil {
+		a.Log(logger.Warn, "failed to remove %s from index: %v", fullPath, err)
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/bluenviron/mediamtx/pro/decoderpool"
+	"github.com/bluenviron/mediamtx/pro/framecheck"
+)
+
+// wsEventFrameCondition is the WebSocket event sent when the video condition of a path changes.
+const wsEventFrameCondition = "frame.condition"
+
+// GetFrame implements frameGetter interface for the frame detector.
+// H264/H265 paths are decoded by the decoder pool, MJPEG paths are read from the stream.
+func (a *APIV2) GetFrame(pathName string) ([]byte, error) {
+	if a.DecoderPool != nil {
+		frame, err := a.snapshotFromDecoderPool(pathName)
+		if !errors.Is(err, decoderpool.ErrUnsupportedCodec) {
+			return frame, err
+		}
+	}
+
+	frame, _, err := a.captureFrameFromStream(apiV2SnapshotReq{Name: pathName})
+	return frame, err
+}
+
+// OnFrameConditionChange is called by the frame detector when the video condition of a path changes.
+func (a *APIV2) OnFrameConditionChange(s framecheck.Status) {
+	if a.wsHub != nil {
+		a.wsHub.BroadcastPathEvent(wsEventFrameCondition, s.Path, s)
+	}
+}
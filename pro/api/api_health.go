@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/pro/healthcheck"
+)
+
+// SetHealthChecker sets the health checker, that is created after the API since it takes snapshots through it.
+func (a *APIV2) SetHealthChecker(c *healthcheck.Checker) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.healthChecker = c
+}
+
+func (a *APIV2) getHealthChecker(ctx *gin.Context) *healthcheck.Checker {
+	a.mutex.RLock()
+	c := a.healthChecker
+	a.mutex.RUnlock()
+
+	if c == nil {
+		a.writeError(ctx, http.StatusServiceUnavailable, fmt.Errorf("health checker is not available"))
+	}
+	return c
+}
+
+// onHealthPathsList handles GET /v2/health/paths
+func (a *APIV2) onHealthPathsList(ctx *gin.Context) {
+	c := a.getHealthChecker(ctx)
+	if c == nil {
+		return
+	}
+
+	state := healthcheck.State(ctx.Query("state"))
+
+	switch state {
+	case "", healthcheck.StateUnknown, healthcheck.StateIdle, healthcheck.StateHealthy,
+		healthcheck.StateDegraded, healthcheck.StateUnhealthy:
+	default:
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid state: %s", state))
+		return
+	}
+
+	ret := []healthcheck.PathHealth{}
+	for _, h := range c.Paths() {
+		if state == "" || h.State == state {
+			ret = append(ret, h)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  ret,
+	})
+}
+
+// onHealthPathGet handles GET /v2/health/paths/get/*name
+func (a *APIV2) onHealthPathGet(ctx *gin.Context) {
+	c := a.getHealthChecker(ctx)
+	if c == nil {
+		return
+	}
+
+	name := ctx.Param("name")
+	if len(name) < 2 || name[0] != '/' {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	h, err := c.Path(name[1:])
+	if err != nil {
+		if errors.Is(err, healthcheck.ErrPathNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  h,
+	})
+}
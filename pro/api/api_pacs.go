@@ -0,0 +1,230 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/pro/pacs"
+)
+
+// wsEventPACSJob is the WebSocket event sent when the status of a PACS job changes.
+const wsEventPACSJob = "pacs.job"
+
+// apiV2PACSSendReq is the body of POST /v2/pacs/send
+type apiV2PACSSendReq struct {
+	Destination string   `json:"destination" binding:"required"`
+	Files       []string `json:"files" binding:"required"` // .dcm files, relative to the record path
+}
+
+// apiV2PACSDestination is a destination returned by GET /v2/pacs/destinations, without credentials.
+type apiV2PACSDestination struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"` // "dimse" or "stow-rs"
+	AETitle  string `json:"aeTitle,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// initPACS starts the queue that sends DICOM files to the configured destinations.
+func (a *APIV2) initPACS() error {
+	a.pacs = &pacs.Queue{
+		RecordPath:   strings.Split(a.Conf.PathDefaults.RecordPath, "%")[0],
+		AETitle:      a.Conf.DICOMAETitle,
+		Destinations: a.Conf.DICOMDestinations,
+		OnUpdate:     a.onPACSJobUpdate,
+		Parent:       a,
+	}
+	return a.pacs.Initialize()
+}
+
+func (a *APIV2) onPACSJobUpdate(job pacs.Job) {
+	if a.wsHub != nil {
+		a.wsHub.BroadcastEvent(wsEventPACSJob, job)
+	}
+}
+
+func (a *APIV2) writePACSError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, pacs.ErrJobNotFound), errors.Is(err, pacs.ErrDestinationNotFound):
+		a.writeError(ctx, http.StatusNotFound, err)
+	case errors.Is(err, pacs.ErrJobBusy):
+		a.writeError(ctx, http.StatusConflict, err)
+	default:
+		a.writeError(ctx, http.StatusInternalServerError, err)
+	}
+}
+
+// pacsRelPath returns the path of a file relative to the record path.
+func (a *APIV2) pacsRelPath(fullPath string) (string, bool) {
+	root, _ := filepath.Abs(a.pacs.RecordPath)
+	abs, _ := filepath.Abs(fullPath)
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// pacsCheckDestinations checks that destinations exist.
+func (a *APIV2) pacsCheckDestinations(names []string) error {
+	for _, name := range names {
+		if _, ok := a.pacs.Destinations.Find(name); !ok {
+			return fmt.Errorf("%w: %s", pacs.ErrDestinationNotFound, name)
+		}
+	}
+	return nil
+}
+
+// pacsEnqueue sends files, given with their full path, to destinations.
+func (a *APIV2) pacsEnqueue(destinations []string, fullPaths []string) ([]*pacs.Job, error) {
+	rels := make([]string, 0, len(fullPaths))
+	for _, p := range fullPaths {
+		rel, ok := a.pacsRelPath(p)
+		if !ok {
+			return nil, fmt.Errorf("path outside allowed directory")
+		}
+		rels = append(rels, rel)
+	}
+
+	jobs := make([]*pacs.Job, 0, len(destinations))
+	for _, name := range destinations {
+		j, err := a.pacs.Enqueue(name, rels)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// onPACSDestinations handles GET /v2/pacs/destinations
+func (a *APIV2) onPACSDestinations(ctx *gin.Context) {
+	ret := make([]apiV2PACSDestination, 0, len(a.pacs.Destinations))
+
+	for _, d := range a.pacs.Destinations {
+		if d.STOWRS() {
+			ret = append(ret, apiV2PACSDestination{
+				Name:     d.Name,
+				Protocol: "stow-rs",
+				URL:      d.URL,
+			})
+		} else {
+			ret = append(ret, apiV2PACSDestination{
+				Name:     d.Name,
+				Protocol: "dimse",
+				AETitle:  d.AETitle,
+				Host:     d.Host,
+				Port:     d.Port,
+			})
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  ret,
+	})
+}
+
+// onPACSSend handles POST /v2/pacs/send
+func (a *APIV2) onPACSSend(ctx *gin.Context) {
+	var req apiV2PACSSendReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(req.Files) == 0 {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("files is required"))
+		return
+	}
+
+	if err := a.pacsCheckDestinations([]string{req.Destination}); err != nil {
+		a.writePACSError(ctx, err)
+		return
+	}
+
+	fullPaths := make([]string, len(req.Files))
+	for i, f := range req.Files {
+		fullPath, err := a.validateFilePath(f, a.pacs.RecordPath)
+		if err != nil {
+			a.writeError(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		if strings.ToLower(filepath.Ext(fullPath)) != ".dcm" {
+			a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("not a DICOM file: %s", f))
+			return
+		}
+
+		if _, err := os.Stat(fullPath); err != nil {
+			a.writeError(ctx, http.StatusNotFound, fmt.Errorf("file not found: %s", f))
+			return
+		}
+
+		fullPaths[i] = fullPath
+	}
+
+	jobs, err := a.pacsEnqueue([]string{req.Destination}, fullPaths)
+	if err != nil {
+		a.writePACSError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  jobs[0],
+	})
+}
+
+// onPACSJobsList handles GET /v2/pacs/jobs
+func (a *APIV2) onPACSJobsList(ctx *gin.Context) {
+	status := pacs.Status(ctx.Query("status"))
+
+	switch status {
+	case "", pacs.StatusPending, pacs.StatusSending, pacs.StatusDone, pacs.StatusFailed:
+	default:
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid status: %s", status))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  a.pacs.List(status),
+	})
+}
+
+// onPACSJobGet handles GET /v2/pacs/jobs/:id
+func (a *APIV2) onPACSJobGet(ctx *gin.Context) {
+	j, err := a.pacs.Get(ctx.Param("id"))
+	if err != nil {
+		a.writePACSError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  j,
+	})
+}
+
+// onPACSJobRetry handles POST /v2/pacs/jobs/:id/retry
+func (a *APIV2) onPACSJobRetry(ctx *gin.Context) {
+	j, err := a.pacs.Retry(ctx.Param("id"))
+	if err != nil {
+		a.writePACSError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  j,
+	})
+}
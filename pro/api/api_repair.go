@@ -0,0 +1,56 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/pro/recordrepair"
+)
+
+// apiV2RecordRepairReq represents record repair parameters
+type apiV2RecordRepairReq struct {
+	Date   string `json:"date"`   // optional, YYYYMMDD
+	DryRun bool   `json:"dryRun"` // only report, don't modify files
+}
+
+// onRecordRepair handles POST /v2/record/repair
+func (a *APIV2) onRecordRepair(ctx *gin.Context) {
+	var req apiV2RecordRepairReq
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+			return
+		}
+	}
+
+	if !a.repairMutex.TryLock() {
+		a.writeError(ctx, http.StatusConflict, fmt.Errorf("a repair is already running"))
+		return
+	}
+	defer a.repairMutex.Unlock()
+
+	a.mutex.RLock()
+	recordPath := a.Conf.PathDefaults.RecordPath
+	a.mutex.RUnlock()
+
+	repairer := &recordrepair.Repairer{
+		RecordPath: recordPath,
+		Date:       req.Date,
+		DryRun:     req.DryRun,
+		IsActive:   a.RecordManager.IsRecordingFile,
+		Parent:     a,
+	}
+
+	report, err := repairer.Run()
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  report,
+	})
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+var errScheduleNotFound = errors.New("schedule not found")
+
+// apiV2ScheduleReq is a schedule rule of a path.
+type apiV2ScheduleReq struct {
+	PathName string `json:"pathName" binding:"required"`
+	conf.RecordSchedule
+}
+
+// updateSchedules applies a change to the recording schedules of a path.
+// Schedules are part of the path configuration: like the other configuration endpoints,
+// the change is applied to the running configuration and it's not written to the configuration file.
+func (a *APIV2) updateSchedules(pathName string, cb func(conf.RecordSchedules) (conf.RecordSchedules, error)) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	pathConf, ok := a.Conf.Paths[pathName]
+	if !ok {
+		return conf.ErrPathNotFound
+	}
+
+	schedules, err := cb(append(conf.RecordSchedules{}, pathConf.RecordSchedules...))
+	if err != nil {
+		return err
+	}
+
+	newConf := a.Conf.Clone()
+
+	err = newConf.SetPathRecordSchedules(pathName, schedules)
+	if err != nil {
+		return err
+	}
+
+	err = newConf.Validate(nil)
+	if err != nil {
+		return err
+	}
+
+	a.Conf = newConf
+	go a.Parent.APIConfigSet(newConf)
+
+	return nil
+}
+
+func (a *APIV2) writeScheduleError(ctx *gin.Context, err error) {
+	if errors.Is(err, conf.ErrPathNotFound) || errors.Is(err, errScheduleNotFound) {
+		a.writeError(ctx, http.StatusNotFound, err)
+		return
+	}
+	a.writeError(ctx, http.StatusBadRequest, err)
+}
+
+// onRecordSchedulesList handles GET /v2/record/schedules
+func (a *APIV2) onRecordSchedulesList(ctx *gin.Context) {
+	pathName := ctx.Query("pathName")
+
+	statuses := a.RecordManager.GetScheduleStatuses()
+
+	if pathName != "" {
+		filtered := statuses[:0]
+		for _, status := range statuses {
+			if status.PathName == pathName {
+				filtered = append(filtered, status)
+			}
+		}
+		statuses = filtered
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"schedules": statuses,
+			"total":     len(statuses),
+		},
+	})
+}
+
+// onRecordScheduleCreate handles POST /v2/record/schedules
+func (a *APIV2) onRecordScheduleCreate(ctx *gin.Context) {
+	var req apiV2ScheduleReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	if req.ID == "" {
+		req.ID = uuid.New().String()[:8]
+	}
+
+	err := a.updateSchedules(req.PathName, func(schedules conf.RecordSchedules) (conf.RecordSchedules, error) {
+		for _, s := range schedules {
+			if s.ID == req.ID {
+				return nil, fmt.Errorf("schedule '%s' already exists", req.ID)
+			}
+		}
+		return append(schedules, req.RecordSchedule), nil
+	})
+	if err != nil {
+		a.writeScheduleError(ctx, err)
+		return
+	}
+
+	a.Log(logger.Info, "schedule '%s' created for path '%s'", req.ID, req.PathName)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  req,
+	})
+}
+
+// onRecordScheduleUpdate handles PUT /v2/record/schedules/:id
+func (a *APIV2) onRecordScheduleUpdate(ctx *gin.Context) {
+	var req apiV2ScheduleReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	req.ID = ctx.Param("id")
+
+	err := a.updateSchedules(req.PathName, func(schedules conf.RecordSchedules) (conf.RecordSchedules, error) {
+		for i, s := range schedules {
+			if s.ID == req.ID {
+				schedules[i] = req.RecordSchedule
+				return schedules, nil
+			}
+		}
+		return nil, errScheduleNotFound
+	})
+	if err != nil {
+		a.writeScheduleError(ctx, err)
+		return
+	}
+
+	a.Log(logger.Info, "schedule '%s' of path '%s' updated", req.ID, req.PathName)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  req,
+	})
+}
+
+// onRecordScheduleDelete handles DELETE /v2/record/schedules/:id?pathName=
+func (a *APIV2) onRecordScheduleDelete(ctx *gin.Context) {
+	id := ctx.Param("id")
+	pathName := ctx.Query("pathName")
+	if pathName == "" {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("pathName is required"))
+		return
+	}
+
+	err := a.updateSchedules(pathName, func(schedules conf.RecordSchedules) (conf.RecordSchedules, error) {
+		for i, s := range schedules {
+			if s.ID == id {
+				return append(schedules[:i], schedules[i+1:]...), nil
+			}
+		}
+		return nil, errScheduleNotFound
+	})
+	if err != nil {
+		a.writeScheduleError(ctx, err)
+		return
+	}
+
+	a.Log(logger.Info, "schedule '%s' of path '%s' deleted", id, pathName)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+	})
+}
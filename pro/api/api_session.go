@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/pro/recorder"
+)
+
+// apiV2SessionStopReq is the request for stopping a recording session.
+type apiV2SessionStopReq struct {
+	ID string `json:"id" binding:"required"`
+}
+
+// onRecordSessionStart handles POST /v2/record/sessions/start
+func (a *APIV2) onRecordSessionStart(ctx *gin.Context) {
+	var params recorder.SessionParams
+	err := ctx.BindJSON(&params)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	// Validate format
+	if params.VideoFormat != "mp4" && params.VideoFormat != "ts" {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("videoFormat must be 'mp4' or 'ts'"))
+		return
+	}
+
+	manifest, err := a.RecordManager.StartSession(&params)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  manifest,
+	})
+}
+
+// onRecordSessionStop handles POST /v2/record/sessions/stop
+func (a *APIV2) onRecordSessionStop(ctx *gin.Context) {
+	var req apiV2SessionStopReq
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	manifest, err := a.RecordManager.StopSession(req.ID)
+	if err != nil {
+		if errors.Is(err, recorder.ErrSessionNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  manifest,
+	})
+}
+
+// onRecordSessionsList handles GET /v2/record/sessions
+func (a *APIV2) onRecordSessionsList(ctx *gin.Context) {
+	sessions := a.RecordManager.GetSessions()
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"sessions": sessions,
+			"total":    len(sessions),
+		},
+	})
+}
+
+// onRecordSessionGet handles GET /v2/record/sessions/:id
+func (a *APIV2) onRecordSessionGet(ctx *gin.Context) {
+	manifest, err := a.RecordManager.GetSession(ctx.Param("id"))
+	if err != nil {
+		a.writeError(ctx, http.StatusNotFound, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  manifest,
+	})
+}
@@ -2,17 +2,16 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
-	"io"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/anthonynsimon/bild/adjust"
@@ -25,6 +24,10 @@ import (
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+	"github.com/bluenviron/mediamtx/pro/cases"
+	"github.com/bluenviron/mediamtx/pro/decoderpool"
+	"github.com/bluenviron/mediamtx/pro/devicedriver"
 )
 
 // ImageCopyReq represents image cropping parameters
@@ -48,42 +51,23 @@ type apiV2SnapshotReq struct {
 	ThumbnailSize int           `json:"thumbnailSize" form:"thumbnailSize"` // Thumbnail width (default 320)
 }
 
+// decoderPoolSnapshotTimeout is the maximum wait for the first frame of a decoder worker.
+const decoderPoolSnapshotTimeout = 10 * time.Second
+
 // apiV2SnapshotRes represents snapshot response
 type apiV2SnapshotRes struct {
-	Success   bool   `json:"success"`
-	FilePath  string `json:"filePath,omitempty"`
-	FileURL   string `json:"fileURL,omitempty"`
-	Filename  string `json:"filename,omitempty"`
-	FullPath  string `json:"fullPath,omitempty"`
-	Original  string `json:"original,omitempty"`
-	Thumbnail string `json:"thumbnail,omitempty"`
-	Width     int    `json:"width,omitempty"`
-	Height    int    `json:"height,omitempty"`
-}
-
-// getJPGData represents RPC response for device snapshot
-type getJPGData struct {
-	ID      string `json:"id"`
-	Jsonrpc string `json:"jsonrpc"`
-	Result  string `json:"result"`
-}
-
-// deviceInfo contains parsed device information from RTSP source
-type deviceInfo struct {
-	IPAddress  string
-	StreamPath string
-	StreamName string
+	Success   bool     `json:"success"`
+	FilePath  string   `json:"filePath,omitempty"`
+	FileURL   string   `json:"fileURL,omitempty"`
+	Filename  string   `json:"filename,omitempty"`
+	FullPath  string   `json:"fullPath,omitempty"`
+	Original  string   `json:"original,omitempty"`
+	Thumbnail string   `json:"thumbnail,omitempty"`
+	Width     int      `json:"width,omitempty"`
+	Height    int      `json:"height,omitempty"`
+	CaseIDs   []string `json:"caseIds,omitempty"` // cases open on the path
 }
 
-// deviceType represents the type of network device
-type deviceType int
-
-const (
-	deviceTypeUnknown deviceType = iota
-	deviceType1                  // Simple HTTP GET to /1.jpg
-	deviceType2                  // RPC + snapshot fetch
-)
-
 // snapshot handles GET /v2/snapshot - capture from network device
 func (a *APIV2) snapshot(ctx *gin.Context) {
 	var req apiV2SnapshotReq
@@ -142,141 +126,6 @@ func (a *APIV2) snapshotStream(ctx *gin.Context) {
 	a.processSnapshotResponse(ctx, imageBytes, finalReq)
 }
 
-// parseDeviceInfo extracts device information from RTSP source URL
-// Format: rtsp://192.168.3.33/stream0 or rtsp://192.168.3.33/0
-func (a *APIV2) parseDeviceInfo(source string) (*deviceInfo, error) {
-	parts := strings.Split(source, "/")
-	if len(parts) < 3 {
-		return nil, errors.New("invalid source format")
-	}
-
-	// Extract IP address (remove port if exists)
-	ipAddress := strings.Split(parts[2], ":")[0]
-	if net.ParseIP(ipAddress) == nil {
-		return nil, fmt.Errorf("invalid IP address: %s", ipAddress)
-	}
-
-	// Extract stream path and name
-	streamPath := ""
-	if len(parts) > 3 {
-		streamPath = parts[len(parts)-1]
-	}
-
-	streamName := filepath.Base(streamPath)
-	if streamName == "" {
-		streamName = "stream0" // default
-	}
-
-	return &deviceInfo{
-		IPAddress:  ipAddress,
-		StreamPath: streamPath,
-		StreamName: streamName,
-	}, nil
-}
-
-// detectDeviceType determines which device type based on source URL
-func (a *APIV2) detectDeviceType(source string, info *deviceInfo) deviceType {
-	// Device type 1: path ends with /0 or contains v=0
-	if info.StreamPath == "0" || strings.Contains(source, "v=0") {
-		return deviceType1
-	}
-	return deviceType2
-}
-
-// fetchSnapshotFromDevice1 fetches snapshot from device type 1 (simple HTTP GET)
-func (a *APIV2) fetchSnapshotFromDevice1(info *deviceInfo) ([]byte, error) {
-	remoteAddress := fmt.Sprintf("http://%s:80/1.jpg", info.IPAddress)
-	a.Log(logger.Info, "Fetching snapshot from device type 1: %s", remoteAddress)
-
-	client := &http.Client{Timeout: 1500 * time.Millisecond}
-
-	req, err := http.NewRequest("GET", remoteAddress, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch snapshot: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("device returned status: %s", resp.Status)
-	}
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	return bodyBytes, nil
-}
-
-// fetchSnapshotFromDevice2 fetches snapshot from device type 2 (RPC + fetch)
-func (a *APIV2) fetchSnapshotFromDevice2(info *deviceInfo) ([]byte, error) {
-	a.Log(logger.Info, "Fetching snapshot from device type 2 for stream: %s", info.StreamName)
-
-	client := &http.Client{Timeout: 1500 * time.Millisecond}
-
-	// Step 1: Call RPC to prepare snapshot
-	rpcData := fmt.Sprintf(`{"jsonrpc":"2.0","method":"enc.getJPG","params":["%s"],"id":1}`, info.StreamName)
-	rpcURL := fmt.Sprintf("http://%s/RPC", info.IPAddress)
-
-	rpcReq, err := http.NewRequest("POST", rpcURL, bytes.NewBufferString(rpcData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create RPC request: %w", err)
-	}
-	rpcReq.Header.Set("Content-Type", "application/json; charset=UTF-8")
-
-	rpcResp, err := client.Do(rpcReq)
-	if err != nil {
-		return nil, fmt.Errorf("RPC request failed: %w", err)
-	}
-	defer rpcResp.Body.Close()
-
-	if rpcResp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("RPC returned status: %s", rpcResp.Status)
-	}
-
-	// Parse RPC response
-	rpcBody, err := io.ReadAll(rpcResp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read RPC response: %w", err)
-	}
-
-	var jpgData getJPGData
-	if err := json.Unmarshal(rpcBody, &jpgData); err != nil {
-		return nil, fmt.Errorf("failed to parse RPC response: %w", err)
-	}
-
-	a.Log(logger.Info, "RPC response - ID: %s, Result: %s", jpgData.ID, jpgData.Result)
-
-	// Step 2: Fetch the actual snapshot
-	snapURL := fmt.Sprintf("http://%s/snap/%s.jpg", info.IPAddress, info.StreamName)
-	snapReq, err := http.NewRequest("GET", snapURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create snapshot request: %w", err)
-	}
-
-	snapResp, err := client.Do(snapReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch snapshot: %w", err)
-	}
-	defer snapResp.Body.Close()
-
-	if snapResp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("snapshot returned status: %s", snapResp.Status)
-	}
-
-	bodyBytes, err := io.ReadAll(snapResp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read snapshot: %w", err)
-	}
-
-	return bodyBytes, nil
-}
-
 // applyPathConfigDefaults applies default values from path configuration
 func (a *APIV2) applyPathConfigDefaults(snapshotReq *apiV2SnapshotReq, pathConf *conf.Path) {
 	// Apply cut defaults
@@ -334,30 +183,19 @@ func (a *APIV2) snapshotRequest(snapshotReq apiV2SnapshotReq) ([]byte, apiV2Snap
 	}
 
 	// Get source URL
-	source := pathConf.Source
-	if source == "" {
+	if pathConf.Source == "" {
 		return nil, snapshotReq, errors.New("path source not configured")
 	}
 
-	// Parse device information from source URL
-	deviceInfo, err := a.parseDeviceInfo(source)
+	// Fetch snapshot with the driver of the device
+	drv, dev, err := devicedriver.Open(devicedriver.Detect(pathConf), pathConf)
 	if err != nil {
 		return nil, snapshotReq, err
 	}
 
-	// Detect device type and fetch snapshot
-	var imageBytes []byte
-	devType := a.detectDeviceType(source, deviceInfo)
-
-	switch devType {
-	case deviceType1:
-		imageBytes, err = a.fetchSnapshotFromDevice1(deviceInfo)
-	case deviceType2:
-		imageBytes, err = a.fetchSnapshotFromDevice2(deviceInfo)
-	default:
-		return nil, snapshotReq, errors.New("unknown device type")
-	}
+	a.Log(logger.Info, "Fetching snapshot from %s device %s", dev.Type, dev.Host)
 
+	imageBytes, err := drv.Snapshot(context.Background(), dev)
 	if err != nil {
 		return nil, snapshotReq, err
 	}
@@ -393,15 +231,65 @@ func (a *APIV2) snapshotStreamFFmpeg(snapshotReq apiV2SnapshotReq) ([]byte, apiV
 		return nil, snapshotReq, fmt.Errorf("path configuration not found: %s", snapshotReq.Name)
 	}
 
+	var bodyBytes []byte
+
+	// H264/H265 路径优先使用常驻解码进程，其他格式仍然为每次请求启动 FFmpeg
+	if a.DecoderPool != nil {
+		bodyBytes, err = a.snapshotFromDecoderPool(snapshotReq.Name)
+		if err != nil && !errors.Is(err, decoderpool.ErrUnsupportedCodec) {
+			return nil, snapshotReq, err
+		}
+	}
+
+	if bodyBytes == nil {
+		bodyBytes, err = a.snapshotFromSource(pathConf.Source)
+		if err != nil {
+			return nil, snapshotReq, err
+		}
+	}
+
+	// Apply path configuration defaults
+	if pathConf.Cut != nil && snapshotReq.ImageCopyReq == nil {
+		cut := *pathConf.Cut
+		snapshotReq.ImageCopyReq = &ImageCopyReq{
+			X: cut[0],
+			Y: cut[1],
+			W: cut[2],
+			H: cut[3],
+		}
+	}
+
+	if snapshotReq.Contrast == 0 && pathConf.Contrast != nil {
+		snapshotReq.Contrast = *pathConf.Contrast
+	}
+	if snapshotReq.Saturation == 0 && pathConf.Saturation != nil {
+		snapshotReq.Saturation = *pathConf.Saturation
+	}
+	if snapshotReq.Brightness == 0 && pathConf.Brightness != nil {
+		snapshotReq.Brightness = *pathConf.Brightness
+	}
+
+	return bodyBytes, snapshotReq, nil
+}
+
+// snapshotFromDecoderPool returns the latest frame decoded by the worker of a path.
+func (a *APIV2) snapshotFromDecoderPool(pathName string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), decoderPoolSnapshotTimeout)
+	defer cancel()
+
+	return a.DecoderPool.Snapshot(ctx, pathName)
+}
+
+// snapshotFromSource captures a single frame by running FFmpeg on the source of a path.
+func (a *APIV2) snapshotFromSource(source string) ([]byte, error) {
 	// Get record path
 	a.mutex.RLock()
 	recordPath := a.Conf.PathDefaults.RecordPath
 	a.mutex.RUnlock()
 
 	// Get stream URL
-	source := pathConf.Source
 	if source == "" {
-		return nil, snapshotReq, errors.New("path source not configured")
+		return nil, errors.New("path source not configured")
 	}
 
 	a.Log(logger.Info, "Capturing snapshot from stream: %s", source)
@@ -409,14 +297,14 @@ func (a *APIV2) snapshotStreamFFmpeg(snapshotReq apiV2SnapshotReq) ([]byte, apiV
 	// Create temp file for snapshot
 	tmpDir := filepath.Join(recordPath, "tmp")
 	if err := os.MkdirAll(tmpDir, 0755); err != nil {
-		return nil, snapshotReq, fmt.Errorf("failed to create temp directory: %w", err)
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 
 	tmpFile := filepath.Join(tmpDir, fmt.Sprintf("snapshot_%s.jpg", uuid.New().String()[:8]))
 	defer os.Remove(tmpFile) // Clean up temp file
 
 	// Use FFmpeg to capture single frame
-	err = ffmpeg.Input(source, ffmpeg.KwArgs{
+	err := ffmpeg.Input(source, ffmpeg.KwArgs{
 		"rtsp_transport": "tcp",
 		"timeout":        "5000000", // 5 seconds
 	}).Output(tmpFile, ffmpeg.KwArgs{
@@ -425,37 +313,16 @@ func (a *APIV2) snapshotStreamFFmpeg(snapshotReq apiV2SnapshotReq) ([]byte, apiV
 	}).OverWriteOutput().Run()
 
 	if err != nil {
-		return nil, snapshotReq, fmt.Errorf("FFmpeg snapshot failed: %w", err)
+		return nil, fmt.Errorf("FFmpeg snapshot failed: %w", err)
 	}
 
 	// Read the captured image
 	bodyBytes, err := os.ReadFile(tmpFile)
 	if err != nil {
-		return nil, snapshotReq, fmt.Errorf("failed to read snapshot: %w", err)
-	}
-
-	// Apply path configuration defaults
-	if pathConf.Cut != nil && snapshotReq.ImageCopyReq == nil {
-		cut := *pathConf.Cut
-		snapshotReq.ImageCopyReq = &ImageCopyReq{
-			X: cut[0],
-			Y: cut[1],
-			W: cut[2],
-			H: cut[3],
-		}
-	}
-
-	if snapshotReq.Contrast == 0 && pathConf.Contrast != nil {
-		snapshotReq.Contrast = *pathConf.Contrast
-	}
-	if snapshotReq.Saturation == 0 && pathConf.Saturation != nil {
-		snapshotReq.Saturation = *pathConf.Saturation
-	}
-	if snapshotReq.Brightness == 0 && pathConf.Brightness != nil {
-		snapshotReq.Brightness = *pathConf.Brightness
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
 	}
 
-	return bodyBytes, snapshotReq, nil
+	return bodyBytes, nil
 }
 
 // processSnapshotResponse processes the snapshot image and sends response
@@ -568,7 +435,8 @@ func (a *APIV2) saveSnapshotToFile(croppedImg image.Image, req apiV2SnapshotReq)
 	a.mutex.RUnlock()
 
 	// Generate filename
-	timestamp := time.Now().UnixMilli()
+	now := time.Now()
+	timestamp := now.UnixMilli()
 	randomID := uuid.New().String()[:16]
 	baseFilename := fmt.Sprintf("%d-%s", timestamp, randomID)
 
@@ -577,7 +445,7 @@ func (a *APIV2) saveSnapshotToFile(croppedImg image.Image, req apiV2SnapshotReq)
 	}
 
 	// Create date-based directory
-	dateDir := time.Now().Format("20060102")
+	dateDir := now.Format("20060102")
 	saveDir := filepath.Join(recordPath, dateDir)
 
 	if err := os.MkdirAll(saveDir, 0755); err != nil {
@@ -644,23 +512,21 @@ func (a *APIV2) saveSnapshotToFile(croppedImg image.Image, req apiV2SnapshotReq)
 		}
 	}
 
-	a.Log(logger.Info, "Snapshot saved: %s", originalPath)
-
-	return res, nil
-}
-
-// GetSnapshot implements snapshotGetter interface for health checker.
-// Returns raw image bytes and content type.
-func (a *APIV2) GetSnapshot(pathName string) ([]byte, string, error) {
-	req := apiV2SnapshotReq{
-		Name:     pathName,
-		FileType: "stream", // Return raw bytes
-	}
-
-	imageBytes, _, err := a.snapshotRequest(req)
+	// the path name is kept for the file index, that can be rebuilt from disk
+	err = recordstore.WriteMetadata(originalPath, &recordstore.Metadata{
+		PathName: req.Name,
+		Start:    now,
+	})
 	if err != nil {
-		return nil, "", err
+		a.Log(logger.Warn, "failed to write metadata of %s: %v", originalPath, err)
 	}
+	a.indexAdd(originalPath)
+	if res.Thumbnail != "" {
+		a.indexAdd(filepath.Join(saveDir, res.Thumbnail))
+	}
+	res.CaseIDs = a.casesLink(req.Name, originalPath, cases.KindSnapshot, now, now)
+
+	a.Log(logger.Info, "Snapshot saved: %s", originalPath)
 
-	return imageBytes, "image/jpeg", nil
+	return res, nil
 }
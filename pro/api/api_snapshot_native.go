@@ -1,20 +1,26 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"image/jpeg"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v5/pkg/description"
 	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
 	"github.com/bluenviron/mediamtx/internal/auth"
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/stream"
 	"github.com/bluenviron/mediamtx/internal/unit"
+	"github.com/bluenviron/mediamtx/pro/decoderpool"
+	"github.com/bluenviron/mediamtx/pro/h264dec"
 	"github.com/gin-gonic/gin"
 )
 
@@ -70,7 +76,7 @@ func (a *APIV2) captureFrameFromStream(snapshotReq apiV2SnapshotReq) ([]byte, ap
 		return nil, snapshotReq, err
 	}
 
-	a.Log(logger.Info, "Found video track: %s", videoFormat.Codec())
+	a.Log(logger.Debug, "Found video track: %s", videoFormat.Codec())
 
 	// Create frame capturer based on format
 	var capturer frameCapturer
@@ -114,12 +120,24 @@ func (a *APIV2) captureFrame(
 	forma format.Format,
 	capturer frameCapturer,
 ) ([]byte, error) {
+	// 路径开启了关键帧缓存时，直接使用最新的关键帧，无需等待下一个关键帧
+	if kf := st.KeyFrame(media, forma); kf != nil {
+		frameData, err := capturer.extractFrame(kf.Unit)
+		if err == nil && frameData != nil {
+			return frameData, nil
+		}
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	frameChan := make(chan []byte, 1)
 	errorChan := make(chan error, 1)
 
+	// 记录最后一次提取失败的原因，超时时返回给调用方
+	var lastErrMutex sync.Mutex
+	var lastErr error
+
 	// Create reader
 	reader := &stream.Reader{
 		Parent: a,
@@ -136,6 +154,9 @@ func (a *APIV2) captureFrame(
 		// Try to extract frame
 		frameData, err := capturer.extractFrame(u)
 		if err != nil {
+			lastErrMutex.Lock()
+			lastErr = err
+			lastErrMutex.Unlock()
 			return nil // Skip this unit, continue waiting
 		}
 
@@ -173,6 +194,12 @@ func (a *APIV2) captureFrame(
 
 	case <-ctx.Done():
 		st.RemoveReader(reader)
+
+		lastErrMutex.Lock()
+		defer lastErrMutex.Unlock()
+		if lastErr != nil {
+			return nil, fmt.Errorf("timeout waiting for frame: %w", lastErr)
+		}
 		return nil, errors.New("timeout waiting for frame")
 	}
 }
@@ -195,15 +222,50 @@ func (c *mjpegCapturer) extractFrame(u *unit.Unit) ([]byte, error) {
 
 // h264Capturer captures H264 frames and converts to JPEG
 type h264Capturer struct {
-	format *format.H264
-	// We would need a decoder here - for now, return error
-	// In production, you'd use something like github.com/nareix/joy4 or cgo with ffmpeg
+	format  *format.H264
+	decoder *h264dec.Decoder
 }
 
 func (c *h264Capturer) extractFrame(u *unit.Unit) ([]byte, error) {
-	// H264 decoding requires external library
-	// For now, return error to indicate this needs implementation
-	return nil, fmt.Errorf("H264 decoding not implemented - use FFmpeg endpoint or MJPEG format")
+	au, ok := u.Payload.(unit.PayloadH264)
+	if !ok || !h264.IsRandomAccess(au) {
+		return nil, nil
+	}
+
+	if c.decoder == nil {
+		c.decoder = &h264dec.Decoder{}
+		err := c.decoder.Initialize()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 带外参数集（SDP 中的 SPS/PPS）放在前面，流内的参数集会覆盖它们
+	sps, pps := c.format.SafeParams()
+	nalus := make([][]byte, 0, len(au)+2)
+	if sps != nil {
+		nalus = append(nalus, sps)
+	}
+	if pps != nil {
+		nalus = append(nalus, pps)
+	}
+	nalus = append(nalus, au...)
+
+	img, err := c.decoder.Decode(nalus)
+	if err != nil {
+		if errors.Is(err, h264dec.ErrNotIntra) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to decode H264 frame: %w", err)
+	}
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
 }
 
 // h265Capturer captures H265 frames and converts to JPEG
@@ -216,10 +278,8 @@ func (c *h265Capturer) extractFrame(u *unit.Unit) ([]byte, error) {
 	return nil, fmt.Errorf("H265 decoding not implemented - use FFmpeg endpoint or MJPEG format")
 }
 
-// For streams that already provide MJPEG, this is the ideal solution
-// For H264/H265 streams, we have two options:
-// 1. Use FFmpeg (current snapshotStreamFFmpeg implementation)
-// 2. Implement pure Go decoder (complex, would need cgo or joy4-like library)
+// For streams that already provide MJPEG or H264, frames are captured natively.
+// H265 streams still need FFmpeg (snapshotStreamFFmpeg implementation).
 
 // snapshotNativeMJPEG handles continuous MJPEG stream
 // This endpoint can be used as an <img src="/v2/snapshot/mjpeg?name=xxx"> in HTML
@@ -267,8 +327,13 @@ func (a *APIV2) snapshotNativeMJPEG(ctx *gin.Context) {
 		}
 	}
 
+	// H264/H265 路径由解码进程池转换为 MJPEG
 	if mjpegFormat == nil {
-		a.writeError(ctx, http.StatusBadRequest, errors.New("no MJPEG track found - only MJPEG format supported for streaming"))
+		if a.DecoderPool == nil {
+			a.writeError(ctx, http.StatusBadRequest, errors.New("no MJPEG track found - only MJPEG format supported for streaming"))
+			return
+		}
+		a.streamDecodedMJPEG(ctx, pathName)
 		return
 	}
 
@@ -296,18 +361,7 @@ func (a *APIV2) snapshotNativeMJPEG(ctx *gin.Context) {
 		}
 
 		if payload, ok := u.Payload.(unit.PayloadMJPEG); ok {
-			// Write MJPEG frame in multipart format
-			boundary := fmt.Sprintf("--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(payload))
-			if _, err := ctx.Writer.Write([]byte(boundary)); err != nil {
-				return err
-			}
-			if _, err := ctx.Writer.Write(payload); err != nil {
-				return err
-			}
-			if _, err := ctx.Writer.Write([]byte("\r\n")); err != nil {
-				return err
-			}
-			ctx.Writer.Flush()
+			return writeMJPEGPart(ctx.Writer, payload)
 		}
 
 		return nil
@@ -330,16 +384,72 @@ func (a *APIV2) snapshotNativeMJPEG(ctx *gin.Context) {
 	}
 }
 
-// h264ToJPEGWithFFmpeg is a helper that uses FFmpeg to convert H264 to JPEG
-// This bridges the gap between native streaming and FFmpeg conversion
-func (a *APIV2) h264ToJPEGWithFFmpeg(h264Data []byte) ([]byte, error) {
-	// This would require:
-	// 1. Write H264 data to temp file or pipe
-	// 2. Use FFmpeg to decode and encode to JPEG
-	// 3. Return JPEG bytes
-	// For now, return not implemented
-	return nil, errors.New("H264 to JPEG conversion not implemented")
-}
-
 // Alternative approach: If the source is RTSP, we can re-encode to MJPEG
 // This would be done at the stream level, not per-request
+
+// writeMJPEGPart writes a JPEG frame in multipart format.
+func writeMJPEGPart(w gin.ResponseWriter, frame []byte) error {
+	boundary := fmt.Sprintf("--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(frame))
+	if _, err := w.Write([]byte(boundary)); err != nil {
+		return err
+	}
+	if _, err := w.Write(frame); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte("\r\n")); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
+
+// streamDecodedMJPEG streams the frames decoded by the worker of a H264/H265 path.
+func (a *APIV2) streamDecodedMJPEG(ctx *gin.Context, pathName string) {
+	sub, err := a.DecoderPool.Subscribe(pathName)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	defer sub.Close()
+
+	a.Log(logger.Info, "Started decoded MJPEG stream for path: %s", pathName)
+
+	written := false
+
+	for {
+		select {
+		case frame := <-sub.Frames():
+			if !written {
+				ctx.Header("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+				ctx.Header("Cache-Control", "no-cache")
+				ctx.Header("Connection", "close")
+				written = true
+			}
+
+			err = writeMJPEGPart(ctx.Writer, frame)
+			if err != nil {
+				return
+			}
+
+		case <-sub.Done():
+			err = sub.Err()
+
+			// nothing has been sent yet, the error can still be returned
+			if !written {
+				status := http.StatusInternalServerError
+				if errors.Is(err, decoderpool.ErrUnsupportedCodec) {
+					status = http.StatusBadRequest
+				}
+				a.writeError(ctx, status, err)
+				return
+			}
+
+			a.Log(logger.Warn, "decoded MJPEG stream of path %s ended: %v", pathName, err)
+			return
+
+		case <-ctx.Request.Context().Done():
+			a.Log(logger.Info, "Client disconnected from MJPEG stream: %s", pathName)
+			return
+		}
+	}
+}
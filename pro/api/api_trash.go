@@ -0,0 +1,166 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/pro/trash"
+)
+
+// initTrash starts the recycle bins. Deleted files are kept inside trash/YYYYMMDD of their record path.
+func (a *APIV2) initTrash() {
+	a.trash = &trash.Bins{
+		Retention: time.Duration(a.Conf.TrashRetention),
+		OnPurge: func(recordPath string, item trash.Item) {
+			a.notifyRecordDeleted(filepath.Join(recordPath, filepath.FromSlash(item.OriginalPath)), recordPath)
+		},
+		Parent: a,
+	}
+	a.trash.Initialize()
+
+	// bins of existing record paths are started in order to purge expired items
+	for _, recordPath := range a.recordPaths() {
+		a.trash.Get(recordPath)
+	}
+}
+
+// recordPaths returns the record path of the path defaults, followed by the ones of paths
+// that have their own. Variables (%path, %Y, ...) and what follows them are removed.
+func (a *APIV2) recordPaths() []string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	recordPaths := []string{recordDir(a.Conf.PathDefaults.RecordPath)}
+
+	var others []string
+	for _, pconf := range a.Conf.Paths {
+		dir := recordDir(pconf.RecordPath)
+		if !slices.Contains(recordPaths, dir) && !slices.Contains(others, dir) {
+			others = append(others, dir)
+		}
+	}
+	sort.Strings(others)
+
+	return append(recordPaths, others...)
+}
+
+func recordDir(recordPath string) string {
+	return filepath.Clean(strings.Split(recordPath, "%")[0])
+}
+
+// validateRecordFile validates the path of a file relative to a record path, and returns its full path
+// and the record path that contains it. Record paths are tried in the order of recordPaths(),
+// when the file doesn't exist in any of them, the record path of the path defaults is returned.
+func (a *APIV2) validateRecordFile(userPath string) (string, string, error) {
+	recordPaths := a.recordPaths()
+	var fallback string
+
+	for i, recordPath := range recordPaths {
+		fullPath, err := a.validateFilePath(userPath, recordPath)
+		if err != nil {
+			return "", "", err
+		}
+
+		if i == 0 {
+			fallback = fullPath
+		}
+
+		if _, err = os.Stat(fullPath); err == nil {
+			return fullPath, recordPath, nil
+		}
+	}
+
+	return fallback, recordPaths[0], nil
+}
+
+// trashIDsBody is the body of the trash restore and purge requests.
+type trashIDsBody struct {
+	IDs []string `json:"ids"`
+}
+
+func (a *APIV2) writeTrashError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, trash.ErrItemNotFound):
+		a.writeError(ctx, http.StatusNotFound, err)
+	case errors.Is(err, trash.ErrFileExists):
+		a.writeError(ctx, http.StatusConflict, err)
+	default:
+		a.writeError(ctx, http.StatusInternalServerError, err)
+	}
+}
+
+// onTrashList handles GET /v2/trash
+func (a *APIV2) onTrashList(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"items": a.trash.List(),
+		},
+	})
+}
+
+// onTrashRestore handles POST /v2/trash/restore
+func (a *APIV2) onTrashRestore(ctx *gin.Context) {
+	var body trashIDsBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(body.IDs) == 0 {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("ids is required"))
+		return
+	}
+
+	restored := []trash.Item{}
+
+	for _, id := range body.IDs {
+		item, err := a.trash.Restore(id)
+		if err != nil {
+			a.writeTrashError(ctx, fmt.Errorf("%w: %s", err, id))
+			return
+		}
+
+		a.indexAdd(filepath.Join(item.RecordPath, filepath.FromSlash(item.OriginalPath)))
+		restored = append(restored, item)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"items": restored,
+		},
+	})
+}
+
+// onTrashPurge handles POST /v2/trash/purge
+// When ids is empty, the whole recycle bin is emptied.
+func (a *APIV2) onTrashPurge(ctx *gin.Context) {
+	var body trashIDsBody
+	if err := ctx.ShouldBindJSON(&body); err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	purged, err := a.trash.Purge(body.IDs)
+	if err != nil {
+		a.writeTrashError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"items": purged,
+		},
+	})
+}
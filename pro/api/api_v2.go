@@ -15,7 +15,15 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/bluenviron/mediamtx/pro/cases"
+	"github.com/bluenviron/mediamtx/pro/decoderpool"
+	"github.com/bluenviron/mediamtx/pro/exportjobs"
+	"github.com/bluenviron/mediamtx/pro/fileindex"
+	"github.com/bluenviron/mediamtx/pro/healthcheck"
+	"github.com/bluenviron/mediamtx/pro/pacs"
 	"github.com/bluenviron/mediamtx/pro/recorder"
+	"github.com/bluenviron/mediamtx/pro/trash"
+	"github.com/bluenviron/mediamtx/pro/webhook"
 	"github.com/bluenviron/mediamtx/pro/websocketapi"
 )
 
@@ -49,12 +57,21 @@ type APIV2 struct {
 	RTMPSServer       defs.APIRTMPServer
 	WebRTCServer      defs.APIWebRTCServer
 	RecordManager     *recorder.Manager
+	Webhooks          *webhook.Outbox
+	DecoderPool       *decoderpool.Pool
+	FileIndex         *fileindex.Index // optional, speeds up file lists and enables search
+	Cases             *cases.Store     // optional, links files to exam cases
 	Parent            apiParent
 	APIAuthMiddleware *APIKeyAuthMiddleware
 
-	httpServer *httpp.Server
-	wsHub      *websocketapi.Hub
-	mutex      sync.RWMutex
+	httpServer    *httpp.Server
+	wsHub         *websocketapi.Hub
+	exportJobs    *exportjobs.Queue
+	trash         *trash.Bins
+	pacs          *pacs.Queue
+	healthChecker *healthcheck.Checker
+	mutex         sync.RWMutex
+	repairMutex   sync.Mutex // only one repair runs at a time
 }
 
 // Initialize initializes the Pro API.
@@ -67,7 +84,14 @@ func (a *APIV2) Initialize() error {
 
 	// Use API token auth if enabled, otherwise use default auth
 	if a.Conf.APIAuth && a.APIAuthMiddleware != nil {
-		router.Use(a.APIAuthMiddleware.AuthMiddleware())
+		tokenAuth := a.APIAuthMiddleware.AuthMiddleware()
+		router.Use(func(ctx *gin.Context) {
+			// the WebSocket endpoint verifies the same token, see initWS()
+			if ctx.Request.URL.Path == wsPath {
+				return
+			}
+			tokenAuth(ctx)
+		})
 		a.Log(logger.Info, "API token authentication enabled")
 	} else {
 		router.Use(a.middlewareAuth)
@@ -79,6 +103,9 @@ func (a *APIV2) Initialize() error {
 	// Basic endpoints
 	group.GET("/info", a.onInfo)
 	group.GET("/health", a.onHealth)
+	group.GET("/health/paths", a.onHealthPathsList)
+	group.GET("/health/paths/get/*name", a.onHealthPathGet)
+	group.GET("/devices/get/*name", a.onDeviceGet)
 	group.GET("/stats", a.onStats)
 
 	// Config endpoints
@@ -110,8 +137,33 @@ func (a *APIV2) Initialize() error {
 	if a.RecordManager != nil {
 		group.POST("/record/start", a.onRecordStart)
 		group.POST("/record/stop", a.onRecordStop)
+		group.POST("/record/pause", a.onRecordPause)
+		group.POST("/record/resume", a.onRecordResume)
+		group.POST("/record/bookmark", a.onRecordBookmark)
+		group.GET("/record/bookmarks", a.onRecordBookmarksGet)
 		group.GET("/record/task/*name", a.getRecordTask)
 		group.GET("/record/tasks", a.getRecordTasks)
+		group.GET("/record/interruptions", a.onRecordInterruptions)
+		group.POST("/record/repair", a.onRecordRepair)
+		group.GET("/record/schedules", a.onRecordSchedulesList)
+		group.POST("/record/schedules", a.onRecordScheduleCreate)
+		group.PUT("/record/schedules/:id", a.onRecordScheduleUpdate)
+		group.DELETE("/record/schedules/:id", a.onRecordScheduleDelete)
+		group.POST("/record/sessions/start", a.onRecordSessionStart)
+		group.POST("/record/sessions/stop", a.onRecordSessionStop)
+		group.GET("/record/sessions", a.onRecordSessionsList)
+		group.GET("/record/sessions/:id", a.onRecordSessionGet)
+	}
+
+	// Webhook endpoints
+	if a.Webhooks != nil {
+		group.GET("/webhooks/deliveries", a.onWebhookDeliveries)
+		group.POST("/webhooks/replay", a.onWebhookReplay)
+	}
+
+	// Decoder pool endpoints
+	if a.DecoderPool != nil {
+		group.GET("/decoders", a.onDecodersList)
 	}
 
 	// Dashboard endpoint
@@ -124,19 +176,66 @@ func (a *APIV2) Initialize() error {
 	group.GET("/record/date/files", a.onFilesListGet)
 	group.GET("/record/favorite/files", a.onFilesFavoriteGet)
 
+	// File index endpoints
+	if a.FileIndex != nil {
+		group.GET("/files/search", a.onFilesSearch)
+		group.GET("/files/index/stats", a.onFilesIndexStats)
+		group.POST("/files/index/rebuild", a.onFilesIndexRebuild)
+	}
+
+	// Case endpoints
+	if a.Cases != nil {
+		group.POST("/cases/open", a.onCaseOpen)
+		group.GET("/cases", a.onCasesList)
+		group.GET("/cases/:id", a.onCaseGet)
+		group.POST("/cases/:id/close", a.onCaseClose)
+		group.GET("/cases/:id/package", a.onCasePackage)
+	}
+
+	// DICOM endpoints
+	group.POST("/dicom/export", a.onDicomExport)
+
 	// Path endpoints (additional)
 	group.GET("/paths/get2/*name", a.onPathsGet2)
 	group.POST("/paths/message", a.PostMessage)
 
 	// WebSocket endpoint for real-time messaging
-	a.wsHub = websocketapi.NewHub(a)
-	go a.wsHub.Run()
-	router.GET("/ws", func(c *gin.Context) {
+	a.initWS()
+	router.GET(wsPath, func(c *gin.Context) {
 		websocketapi.ServeWS(a.wsHub, c)
 	})
 
-	// FFmpeg export endpoint
+	// Export endpoints
+	err := a.initExportJobs()
+	if err != nil {
+		a.wsHub.Close()
+		return err
+	}
 	group.POST("/file/export/mp4", a.ExportMP4)
+	group.POST("/file/export/jobs", a.onExportJobSubmit)
+	group.GET("/file/export/jobs", a.onExportJobsList)
+	group.GET("/file/export/jobs/:id", a.onExportJobGet)
+	group.POST("/file/export/jobs/:id/cancel", a.onExportJobCancel)
+
+	// Recycle bin endpoints
+	a.initTrash()
+	group.GET("/trash", a.onTrashList)
+	group.POST("/trash/restore", a.onTrashRestore)
+	group.POST("/trash/purge", a.onTrashPurge)
+
+	// PACS endpoints
+	err = a.initPACS()
+	if err != nil {
+		a.trash.Close()
+		a.exportJobs.Close()
+		a.wsHub.Close()
+		return err
+	}
+	group.GET("/pacs/destinations", a.onPACSDestinations)
+	group.POST("/pacs/send", a.onPACSSend)
+	group.GET("/pacs/jobs", a.onPACSJobsList)
+	group.GET("/pacs/jobs/:id", a.onPACSJobGet)
+	group.POST("/pacs/jobs/:id/retry", a.onPACSJobRetry)
 
 	// Snapshot configuration endpoints
 	group.GET("/snapshot/config/*name", a.snapshotConfGet)
@@ -144,7 +243,7 @@ func (a *APIV2) Initialize() error {
 
 	// Snapshot capture endpoints
 	group.GET("/snapshot", a.snapshot)                  // Device HTTP API snapshot
-	group.GET("/publish/snapshot", a.snapshotStream)    // FFmpeg snapshot from stream
+	group.GET("/publish/snapshot", a.snapshotStream)    // FFmpeg snapshot (decoder pool for H264/H265)
 	group.GET("/snapshot/native", a.snapshotNative)     // Pure Go snapshot from MediaMTX stream
 	group.GET("/snapshot/mjpeg", a.snapshotNativeMJPEG) // MJPEG streaming endpoint
 
@@ -173,11 +272,18 @@ func (a *APIV2) Initialize() error {
 		Handler:      router,
 		Parent:       a,
 	}
-	err := a.httpServer.Initialize()
+	err = a.httpServer.Initialize()
 	if err != nil {
+		a.pacs.Close()
+		a.trash.Close()
+		a.exportJobs.Close()
+		a.wsHub.Close()
 		return err
 	}
 
+	// WebSocket events of paths and recordings
+	a.initEvents()
+
 	a.Log(logger.Info, "Pro API listener opened on "+a.Address)
 
 	return nil
@@ -186,10 +292,20 @@ func (a *APIV2) Initialize() error {
 // Close closes the API.
 func (a *APIV2) Close() {
 	a.Log(logger.Info, "Pro API listener is closing")
+	a.httpServer.Close()
+	a.closeEvents()
+	if a.pacs != nil {
+		a.pacs.Close()
+	}
+	if a.trash != nil {
+		a.trash.Close()
+	}
+	if a.exportJobs != nil {
+		a.exportJobs.Close()
+	}
 	if a.wsHub != nil {
 		a.wsHub.Close()
 	}
-	a.httpServer.Close()
 }
 
 // Log implements logger.Writer.
@@ -488,6 +604,61 @@ func (a *APIV2) onRecordStop(ctx *gin.Context) {
 	})
 }
 
+// onRecordPause handles POST /v2/record/pause
+func (a *APIV2) onRecordPause(ctx *gin.Context) {
+	var params recorder.StopParams
+	err := ctx.BindJSON(&params)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	status, err := a.RecordManager.PauseRecording(params.Name)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  status,
+	})
+}
+
+// onRecordResume handles POST /v2/record/resume
+func (a *APIV2) onRecordResume(ctx *gin.Context) {
+	var params recorder.StopParams
+	err := ctx.BindJSON(&params)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	status, err := a.RecordManager.ResumeRecording(params.Name)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  status,
+	})
+}
+
+// onRecordInterruptions handles GET /v2/record/interruptions
+func (a *APIV2) onRecordInterruptions(ctx *gin.Context) {
+	interruptions := a.RecordManager.GetInterruptions()
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"interruptions": interruptions,
+			"total":         len(interruptions),
+		},
+	})
+}
+
 // PathQueryItem represents a single path item in the query response
 type PathQueryItem struct {
 	Name          string     `json:"name"`
@@ -15,6 +15,8 @@ import (
 	"github.com/shirou/gopsutil/v3/disk"
 
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+	"github.com/bluenviron/mediamtx/pro/recorder"
 )
 
 // DiskStatus represents disk usage information
@@ -92,15 +94,9 @@ func (a *APIV2) dashboard(ctx *gin.Context) {
 		pathCount = len(pathsData.Items)
 	}
 
-	// Count files in record directory
-	allFiles, jpgFiles := a.countRecordFiles(recordPath)
-
 	res := apiV2DashboardRes{
-		ID:         "dashboard",
-		FilesCount: len(allFiles),
-		JpgCount:   len(jpgFiles),
-		VideoCount: len(allFiles) - len(jpgFiles),
-		PathCount:  pathCount,
+		ID:        "dashboard",
+		PathCount: pathCount,
 		DiskStatus: DiskStatus{
 			All:  stat.Total,
 			Free: stat.Free,
@@ -108,6 +104,19 @@ func (a *APIV2) dashboard(ctx *gin.Context) {
 		},
 	}
 
+	// Count files in record directory
+	if a.FileIndex != nil {
+		stats := a.FileIndex.Stats()
+		res.FilesCount = stats.Files
+		res.JpgCount = stats.Images
+		res.VideoCount = stats.Videos
+	} else {
+		allFiles, jpgFiles := a.countRecordFiles(recordPath)
+		res.FilesCount = len(allFiles)
+		res.JpgCount = len(jpgFiles)
+		res.VideoCount = len(allFiles) - len(jpgFiles)
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"result":  res,
@@ -154,22 +163,16 @@ func (a *APIV2) getRecordTask(ctx *gin.Context) {
 		return
 	}
 
-	// Get recording state for this path
-	states := a.RecordManager.GetRecordingStates()
-	endTime, exists := states[pathName]
-
-	if !exists {
-		a.writeError(ctx, http.StatusNotFound, fmt.Errorf("no recording task found for path: %s", pathName))
+	// Get recording task status for this path
+	status, err := a.RecordManager.GetTaskStatus(pathName)
+	if err != nil {
+		a.writeError(ctx, http.StatusNotFound, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"result": gin.H{
-			"pathName":    pathName,
-			"taskEndTime": endTime,
-			"isRecording": true,
-		},
+		"result":  status,
 	})
 }
 
@@ -237,6 +240,15 @@ func (a *APIV2) fileRename(ctx *gin.Context) {
 
 	a.Log(logger.Info, "File renamed: %s -> %s", fullPath, newPath)
 
+	if err := recorder.MoveBookmarks(fullPath, newPath); err != nil {
+		a.Log(logger.Warn, "failed to rename bookmarks of %s: %v", fullPath, err)
+	}
+	if err := recordstore.MoveMetadata(fullPath, newPath); err != nil {
+		a.Log(logger.Warn, "failed to rename metadata of %s: %v", fullPath, err)
+	}
+	a.indexMove(fullPath, newPath)
+	a.casesMove(fullPath, newPath)
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"result": gin.H{
@@ -254,12 +266,8 @@ func (a *APIV2) fileDel(ctx *gin.Context) {
 		return
 	}
 
-	a.mutex.RLock()
-	recordPath := a.Conf.PathDefaults.RecordPath
-	a.mutex.RUnlock()
-
-	// Validate path
-	fullPath, err := a.validateFilePath(body.FullPath, recordPath)
+	// Validate path, the file can be inside the record path of the path defaults or of a path
+	fullPath, recordPath, err := a.validateRecordFile(body.FullPath)
 	if err != nil {
 		a.writeError(ctx, http.StatusBadRequest, err)
 		return
@@ -271,18 +279,23 @@ func (a *APIV2) fileDel(ctx *gin.Context) {
 		return
 	}
 
-	// Delete file
-	if err := os.Remove(fullPath); err != nil {
+	// Move file to the recycle bin of its record path, together with bookmarks and metadata.
+	// The record delete webhook is sent when the file is purged.
+	item, err := a.trash.Get(recordPath).Delete(fullPath)
+	if err != nil {
 		a.writeError(ctx, http.StatusInternalServerError, fmt.Errorf("failed to delete file: %w", err))
 		return
 	}
 
-	a.Log(logger.Info, "File deleted: %s", fullPath)
+	a.Log(logger.Info, "File moved to the trash: %s", fullPath)
+
+	a.indexRemove(fullPath)
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"result": gin.H{
-			"path": body.FullPath,
+			"path":    body.FullPath,
+			"trashId": item.ID,
 		},
 	})
 }
@@ -330,6 +343,15 @@ func (a *APIV2) fileMove(ctx *gin.Context) {
 
 	a.Log(logger.Info, "File moved to favorite: %s -> %s", fullPath, destPath)
 
+	if err := recorder.MoveBookmarks(fullPath, destPath); err != nil {
+		a.Log(logger.Warn, "failed to move bookmarks of %s: %v", fullPath, err)
+	}
+	if err := recordstore.MoveMetadata(fullPath, destPath); err != nil {
+		a.Log(logger.Warn, "failed to move metadata of %s: %v", fullPath, err)
+	}
+	a.indexMove(fullPath, destPath)
+	a.casesMove(fullPath, destPath)
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"result": gin.H{
@@ -398,6 +420,14 @@ func (a *APIV2) onFilesFavoriteGet(ctx *gin.Context) {
 
 // listFiles lists files in a directory with optional filtering
 func (a *APIV2) listFiles(dir string, fileType *string, search *string) []FileInfo {
+	if a.FileIndex != nil {
+		a.mutex.RLock()
+		recordPath := a.Conf.PathDefaults.RecordPath
+		a.mutex.RUnlock()
+
+		return a.listIndexedFiles(recordPath, dir, fileType, search)
+	}
+
 	files := []FileInfo{}
 
 	entries, err := os.ReadDir(dir)
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/pro/webhook"
+)
+
+// apiV2WebhookReplayReq is the request for replaying deliveries.
+type apiV2WebhookReplayReq struct {
+	IDs []string `json:"ids"` // empty: all failed deliveries
+}
+
+// recordDeletePayload is the payload of the record delete webhook.
+type recordDeletePayload struct {
+	ResName string `json:"resName"`
+	ResPath string `json:"resPath"`
+}
+
+// notifyRecordDeleted queues the record delete webhook if configured.
+func (a *APIV2) notifyRecordDeleted(fullPath string, recordPath string) {
+	a.mutex.RLock()
+	url := a.Conf.PathDefaults.RecordDelWebhook
+	a.mutex.RUnlock()
+
+	if url == "" {
+		return
+	}
+
+	if a.Webhooks == nil {
+		a.Log(logger.Warn, "webhook outbox is not available, %s event to %s dropped", webhook.EventRecordDelete, url)
+		return
+	}
+
+	relPath, err := filepath.Rel(recordPath, fullPath)
+	if err != nil {
+		relPath = filepath.Base(fullPath)
+	}
+
+	_, err = a.Webhooks.Enqueue(webhook.EventRecordDelete, url, &recordDeletePayload{
+		ResName: filepath.Base(fullPath),
+		ResPath: "/" + filepath.ToSlash(relPath),
+	})
+	if err != nil {
+		a.Log(logger.Error, "failed to queue %s webhook: %v", webhook.EventRecordDelete, err)
+	}
+}
+
+// onWebhookDeliveries handles GET /v2/webhooks/deliveries?status=failed
+func (a *APIV2) onWebhookDeliveries(ctx *gin.Context) {
+	status := webhook.Status(ctx.Query("status"))
+
+	switch status {
+	case "", webhook.StatusPending, webhook.StatusDelivered, webhook.StatusFailed:
+	default:
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid status '%s'", status))
+		return
+	}
+
+	deliveries := a.Webhooks.Deliveries(status)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"deliveries": deliveries,
+			"total":      len(deliveries),
+		},
+	})
+}
+
+// onWebhookReplay handles POST /v2/webhooks/replay
+func (a *APIV2) onWebhookReplay(ctx *gin.Context) {
+	var req apiV2WebhookReplayReq
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+			return
+		}
+	}
+
+	deliveries, err := a.Webhooks.Replay(req.IDs)
+	if err != nil {
+		if errors.Is(err, webhook.ErrDeliveryNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	a.Log(logger.Info, "%d webhook deliveries replayed", len(deliveries))
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result": gin.H{
+			"deliveries": deliveries,
+			"total":      len(deliveries),
+		},
+	})
+}
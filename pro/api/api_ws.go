@@ -0,0 +1,75 @@
+package api
+
+import (
+	"github.com/livekit/protocol/auth"
+
+	"github.com/bluenviron/mediamtx/pro/websocketapi"
+)
+
+// wsPath is the path of the WebSocket endpoint.
+// It authenticates clients itself, since browsers can't set headers on WebSocket connections
+// and clients can send their token in the first message.
+const wsPath = "/ws"
+
+// Topics and commands allowed by the grants of a token.
+// Tokens without a video grant are application tokens, that can access the whole API.
+var (
+	wsListTopics     = []string{"path.*", "health.*", "frame.*"}
+	wsRecordTopics   = []string{"record.*", "export.*", "pacs.*"}
+	wsRecordCommands = []string{wsCmdRecordBookmark}
+	wsJoinTopics     = []string{"message"}
+)
+
+// wsAuthenticate verifies the token of a WebSocket client, the same used by the HTTP API.
+func (a *APIV2) wsAuthenticate(token string) (*websocketapi.Permissions, error) {
+	grants, err := a.APIAuthMiddleware.VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	perms := wsPermissions(grants)
+	perms.Expires = tokenExpiry(token)
+	return perms, nil
+}
+
+func wsPermissions(grants *auth.ClaimGrants) *websocketapi.Permissions {
+	if grants.Video == nil || grants.Video.RoomAdmin {
+		return &websocketapi.Permissions{}
+	}
+
+	perms := &websocketapi.Permissions{
+		Topics:   []string{},
+		Commands: []string{},
+	}
+
+	if grants.Video.RoomList {
+		perms.Topics = append(perms.Topics, wsListTopics...)
+	}
+
+	if grants.Video.RoomRecord {
+		perms.Topics = append(perms.Topics, wsRecordTopics...)
+		perms.Commands = append(perms.Commands, wsRecordCommands...)
+	}
+
+	if grants.Video.RoomJoin {
+		perms.Topics = append(perms.Topics, wsJoinTopics...)
+	}
+
+	return perms
+}
+
+// initWS creates the WebSocket hub.
+func (a *APIV2) initWS() {
+	a.wsHub = websocketapi.NewHub(a)
+	a.wsHub.SetAllowOrigin(a.AllowOrigin)
+
+	if a.Conf.APIAuth && a.APIAuthMiddleware != nil {
+		a.wsHub.SetAuthenticator(a.wsAuthenticate)
+	}
+
+	if a.RecordManager != nil {
+		a.wsHub.Handle(wsCmdRecordBookmark, a.onWSRecordBookmark)
+	}
+
+	go a.wsHub.Run()
+}
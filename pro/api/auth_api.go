@@ -2,9 +2,12 @@ package api
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/twitchtv/twirp"
@@ -61,24 +64,9 @@ func (m *APIKeyAuthMiddleware) AuthMiddleware() gin.HandlerFunc {
 		}
 
 		if authToken != "" {
-			v, err := auth.ParseAPIToken(authToken)
-
-			if err != nil {
-				ctx.String(http.StatusUnauthorized, ErrInvalidAuthorizationToken.Error())
-				ctx.Abort()
-				return
-			}
-			secret := m.provider.GetSecret(v.APIKey())
-
-			if secret == "" {
-				ctx.String(http.StatusUnauthorized, "invalid API key")
-				ctx.Abort()
-				return
-			}
-
-			grants, err := v.Verify(secret)
+			grants, err := m.VerifyToken(authToken)
 			if err != nil {
-				ctx.String(http.StatusUnauthorized, "invalid token:, error: "+err.Error())
+				ctx.String(http.StatusUnauthorized, err.Error())
 				ctx.Abort()
 				return
 			}
@@ -96,6 +84,50 @@ func (m *APIKeyAuthMiddleware) AuthMiddleware() gin.HandlerFunc {
 		ctx.Abort()
 	}
 }
+
+// VerifyToken verifies the signature and the validity period of a token and returns its grants.
+// It is shared by the HTTP middleware and the WebSocket endpoint.
+func (m *APIKeyAuthMiddleware) VerifyToken(token string) (*auth.ClaimGrants, error) {
+	v, err := auth.ParseAPIToken(token)
+	if err != nil {
+		return nil, ErrInvalidAuthorizationToken
+	}
+
+	secret := m.provider.GetSecret(v.APIKey())
+	if secret == "" {
+		return nil, errors.New("invalid API key")
+	}
+
+	grants, err := v.Verify(secret)
+	if err != nil {
+		return nil, errors.New("invalid token:, error: " + err.Error())
+	}
+
+	return grants, nil
+}
+
+// tokenExpiry returns the expiration time of a token that has been verified.
+// It returns the zero time when the token doesn't expire.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Expiry int64 `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil || claims.Expiry == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.Expiry, 0)
+}
 func GetGrants(ctx context.Context) *auth.ClaimGrants {
 	val := ctx.Value(grantsKey{})
 	claims, ok := val.(*auth.ClaimGrants)
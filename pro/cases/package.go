@@ -0,0 +1,121 @@
+package cases
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// ManifestFileName is the name of the manifest inside packages.
+const ManifestFileName = "manifest.json"
+
+// ManifestFile is a file of a package.
+type ManifestFile struct {
+	File
+	Size    int64 `json:"size"`
+	Missing bool  `json:"missing,omitempty"` // the file has been deleted or moved outside of the record path
+}
+
+// Manifest describes the content of a package.
+type Manifest struct {
+	Case      *Case          `json:"case"`
+	Files     []ManifestFile `json:"files"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// Package writes a ZIP archive that contains the files of a case inside the "files" folder,
+// with their paths relative to the record path, and a JSON manifest.
+func (s *Store) Package(id string, w io.Writer) (*Manifest, error) {
+	c, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{
+		Case:      c,
+		Files:     []ManifestFile{},
+		CreatedAt: time.Now(),
+	}
+
+	for _, f := range c.Files {
+		mf := ManifestFile{File: f}
+
+		fi, err := os.Stat(filepath.Join(s.RecordPath, filepath.FromSlash(f.Path)))
+		if err != nil || fi.IsDir() {
+			mf.Missing = true
+		} else {
+			mf.Size = fi.Size()
+		}
+
+		m.Files = append(m.Files, mf)
+	}
+
+	zw := zip.NewWriter(w)
+
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	mw, err := zw.Create(ManifestFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = mw.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mf := range m.Files {
+		if mf.Missing {
+			continue
+		}
+
+		err = addFile(zw, filepath.Join(s.RecordPath, filepath.FromSlash(mf.Path)), path.Join("files", mf.Path))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// addFile copies a file into an archive.
+// Media files are already compressed, therefore they are stored as they are.
+func addFile(zw *zip.Writer, fpath string, name string) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	h, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	h.Name = name
+	h.Method = zip.Store
+
+	fw, err := zw.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fw, f)
+	return err
+}
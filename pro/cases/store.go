@@ -0,0 +1,448 @@
+// Package cases contains exam cases, that group the recordings, snapshots and exports
+// produced on a path together with patient metadata.
+package cases
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// FileName is the name of the case store, in the record path.
+const FileName = "record_cases.json"
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// Errors.
+var (
+	ErrCaseNotFound = errors.New("case not found")
+	ErrCaseOpen     = errors.New("a case is already open on the path")
+	ErrCaseClosed   = errors.New("case is already closed")
+)
+
+// Status is the status of a case.
+type Status string
+
+// statuses.
+const (
+	StatusOpen   Status = "open"
+	StatusClosed Status = "closed"
+)
+
+// File kinds.
+const (
+	KindRecording = "recording"
+	KindSnapshot  = "snapshot"
+	KindExport    = "export"
+)
+
+// File is a file linked to a case.
+type File struct {
+	Path    string    `json:"path"` // relative to the record path, slash separated
+	Kind    string    `json:"kind"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// Metadata is the structured metadata of a case.
+type Metadata struct {
+	PatientID       string            `json:"patientId"`
+	AccessionNumber string            `json:"accessionNumber"`
+	Operator        string            `json:"operator"`
+	Fields          map[string]string `json:"fields,omitempty"` // free-form fields
+}
+
+// Case is an exam: the files produced on a path while the case is open.
+type Case struct {
+	ID       string     `json:"id"`
+	PathName string     `json:"pathName"`
+	Status   Status     `json:"status"`
+	OpenedAt time.Time  `json:"openedAt"`
+	ClosedAt *time.Time `json:"closedAt,omitempty"`
+	Metadata
+	Files []File `json:"files"`
+}
+
+// overlaps checks whether the case was open during part of an interval.
+func (c *Case) overlaps(start time.Time, end time.Time) bool {
+	if end.Before(c.OpenedAt) {
+		return false
+	}
+	return c.ClosedAt == nil || !start.After(*c.ClosedAt)
+}
+
+func (c *Case) hasFile(fpath string) bool {
+	for _, f := range c.Files {
+		if f.Path == fpath {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Case) clone() *Case {
+	ret := *c
+	ret.Files = append([]File{}, c.Files...)
+	return &ret
+}
+
+// Query filters and paginates cases. Empty fields are ignored.
+type Query struct {
+	Text            string // part of the patient ID, accession number, operator or fields, case insensitive
+	PathName        string
+	Status          Status
+	PatientID       string
+	AccessionNumber string
+	Start           *time.Time // cases that end after Start
+	End             *time.Time // cases that start before End
+	Page            int        // starts from 1
+	PageSize        int        // defaults to 50
+}
+
+func containsFold(s string, sub string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+}
+
+func (q *Query) matchText(c *Case) bool {
+	if containsFold(c.PatientID, q.Text) ||
+		containsFold(c.AccessionNumber, q.Text) ||
+		containsFold(c.Operator, q.Text) {
+		return true
+	}
+	for _, v := range c.Fields {
+		if containsFold(v, q.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Query) match(c *Case) bool {
+	switch {
+	case q.Text != "" && !q.matchText(c):
+		return false
+	case q.PathName != "" && c.PathName != q.PathName:
+		return false
+	case q.Status != "" && c.Status != q.Status:
+		return false
+	case q.PatientID != "" && c.PatientID != q.PatientID:
+		return false
+	case q.AccessionNumber != "" && c.AccessionNumber != q.AccessionNumber:
+		return false
+	case q.Start != nil && c.ClosedAt != nil && c.ClosedAt.Before(*q.Start):
+		return false
+	case q.End != nil && c.OpenedAt.After(*q.End):
+		return false
+	}
+	return true
+}
+
+// Result is a page of cases.
+type Result struct {
+	Cases    []*Case `json:"cases"`
+	Total    int     `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"pageSize"`
+}
+
+// Store keeps cases in a JSON file.
+type Store struct {
+	RecordPath string
+	FilePath   string // defaults to FileName inside RecordPath
+	Parent     logger.Writer
+
+	mutex sync.Mutex
+	cases []*Case
+}
+
+// Initialize initializes the Store.
+func (s *Store) Initialize() error {
+	if s.FilePath == "" {
+		s.FilePath = filepath.Join(s.RecordPath, FileName)
+	}
+
+	return s.load()
+}
+
+// Log implements logger.Writer.
+func (s *Store) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[cases] "+format, args...)
+}
+
+// Open opens a case on a path. Only one case at a time can be open on a path.
+func (s *Store) Open(pathName string, m Metadata) (*Case, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.openCase(pathName) != nil {
+		return nil, ErrCaseOpen
+	}
+
+	c := &Case{
+		ID:       uuid.New().String(),
+		PathName: pathName,
+		Status:   StatusOpen,
+		OpenedAt: time.Now(),
+		Metadata: m,
+		Files:    []File{},
+	}
+
+	s.cases = append(s.cases, c)
+	s.save()
+
+	s.Log(logger.Info, "case %s opened on path '%s'", c.ID, pathName)
+
+	return c.clone(), nil
+}
+
+// Close closes a case. Files produced after this are not linked to it anymore.
+func (s *Store) Close(id string) (*Case, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c := s.find(id)
+	if c == nil {
+		return nil, ErrCaseNotFound
+	}
+
+	if c.Status == StatusClosed {
+		return nil, ErrCaseClosed
+	}
+
+	now := time.Now()
+	c.Status = StatusClosed
+	c.ClosedAt = &now
+	s.save()
+
+	s.Log(logger.Info, "case %s closed, %d files", c.ID, len(c.Files))
+
+	return c.clone(), nil
+}
+
+// Get returns a case.
+func (s *Store) Get(id string) (*Case, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c := s.find(id)
+	if c == nil {
+		return nil, ErrCaseNotFound
+	}
+
+	return c.clone(), nil
+}
+
+// OpenCase returns the case that is open on a path, if any.
+func (s *Store) OpenCase(pathName string) *Case {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c := s.openCase(pathName)
+	if c == nil {
+		return nil
+	}
+	return c.clone()
+}
+
+// Search returns a page of the cases that match a query, newest first.
+func (s *Store) Search(q Query) Result {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = defaultPageSize
+	} else if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var matches []*Case
+	for _, c := range s.cases {
+		if q.match(c) {
+			matches = append(matches, c)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].OpenedAt.After(matches[j].OpenedAt)
+	})
+
+	res := Result{
+		Cases:    []*Case{},
+		Total:    len(matches),
+		Page:     q.Page,
+		PageSize: q.PageSize,
+	}
+
+	for i := (q.Page - 1) * q.PageSize; i < len(matches) && i < q.Page*q.PageSize; i++ {
+		res.Cases = append(res.Cases, matches[i].clone())
+	}
+
+	return res
+}
+
+// Link links a file produced on a path between start and end
+// to the cases that were open on the path meanwhile.
+// It returns the IDs of these cases.
+func (s *Store) Link(pathName string, fpath string, kind string, start time.Time, end time.Time) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var ids []string
+
+	for _, c := range s.cases {
+		if c.PathName == pathName && c.overlaps(start, end) && !c.hasFile(fpath) {
+			c.Files = append(c.Files, File{
+				Path:    fpath,
+				Kind:    kind,
+				AddedAt: time.Now(),
+			})
+			ids = append(ids, c.ID)
+		}
+	}
+
+	if ids != nil {
+		s.save()
+	}
+
+	return ids
+}
+
+// LinkTo links a file to a case, even when the case is closed.
+func (s *Store) LinkTo(id string, fpath string, kind string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c := s.find(id)
+	if c == nil {
+		return ErrCaseNotFound
+	}
+
+	if !c.hasFile(fpath) {
+		c.Files = append(c.Files, File{
+			Path:    fpath,
+			Kind:    kind,
+			AddedAt: time.Now(),
+		})
+		s.save()
+	}
+
+	return nil
+}
+
+// FindByFile returns the ID of the first case that contains a file.
+func (s *Store) FindByFile(fpath string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, c := range s.cases {
+		if c.hasFile(fpath) {
+			return c.ID, true
+		}
+	}
+	return "", false
+}
+
+// Move updates the links of a file that has been renamed or moved.
+func (s *Store) Move(oldPath string, newPath string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	changed := false
+
+	for _, c := range s.cases {
+		for i := range c.Files {
+			if c.Files[i].Path == oldPath {
+				c.Files[i].Path = newPath
+				changed = true
+			}
+		}
+	}
+
+	if changed {
+		s.save()
+	}
+}
+
+// openCase returns the case that is open on a path. Must be called with the mutex held.
+func (s *Store) openCase(pathName string) *Case {
+	for _, c := range s.cases {
+		if c.PathName == pathName && c.Status == StatusOpen {
+			return c
+		}
+	}
+	return nil
+}
+
+// find returns a case. Must be called with the mutex held.
+func (s *Store) find(id string) *Case {
+	for _, c := range s.cases {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Store) load() error {
+	buf, err := os.ReadFile(s.FilePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	err = json.Unmarshal(buf, &s.cases)
+	if err != nil {
+		return fmt.Errorf("failed to read case store %s: %w", s.FilePath, err)
+	}
+
+	open := 0
+	for _, c := range s.cases {
+		if c.Status == StatusOpen {
+			open++
+		}
+	}
+	if open != 0 {
+		s.Log(logger.Info, "%d open cases loaded from %s", open, s.FilePath)
+	}
+
+	return nil
+}
+
+// save writes the store to disk. Must be called with the mutex held.
+func (s *Store) save() {
+	buf, err := json.MarshalIndent(s.cases, "", "  ")
+	if err != nil {
+		s.Log(logger.Error, "failed to encode case store: %v", err)
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.FilePath), 0o755)
+	if err == nil {
+		// the file is replaced atomically, therefore a crash never leaves a partial store
+		tmpPath := s.FilePath + ".tmp"
+		err = os.WriteFile(tmpPath, buf, 0o644)
+		if err == nil {
+			err = os.Rename(tmpPath, s.FilePath)
+		}
+	}
+	if err != nil {
+		s.Log(logger.Error, "failed to write case store %s: %v", s.FilePath, err)
+	}
+}
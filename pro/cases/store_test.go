@@ -0,0 +1,171 @@
+package cases
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+
+	s := &Store{
+		RecordPath: dir,
+		Parent:     test.NilLogger,
+	}
+	err := s.Initialize()
+	require.NoError(t, err)
+
+	before := time.Now().Add(-time.Hour)
+
+	c1, err := s.Open("cam1", Metadata{
+		PatientID:       "P0001",
+		AccessionNumber: "A-123",
+		Operator:        "Dr. Rossi",
+		Fields:          map[string]string{"procedure": "Gastroscopy"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusOpen, c1.Status)
+
+	_, err = s.Open("cam1", Metadata{PatientID: "P0002"})
+	require.ErrorIs(t, err, ErrCaseOpen)
+
+	c2, err := s.Open("cam2", Metadata{PatientID: "P0002"})
+	require.NoError(t, err)
+
+	// files produced on the path while the case is open are linked to it
+	now := time.Now()
+	require.Equal(t, []string{c1.ID}, s.Link("cam1", "20240519/rec.mp4", KindRecording, before, now))
+	require.Equal(t, []string{c1.ID}, s.Link("cam1", "20240519/snap.jpg", KindSnapshot, now, now))
+	require.Nil(t, s.Link("cam1", "20240519/old.mp4", KindRecording, before, before.Add(time.Minute)))
+	require.Nil(t, s.Link("cam3", "20240519/other.mp4", KindRecording, now, now))
+
+	// files are linked once
+	require.Nil(t, s.Link("cam1", "20240519/rec.mp4", KindRecording, before, now))
+
+	_, err = s.Close(c1.ID)
+	require.NoError(t, err)
+	_, err = s.Close(c1.ID)
+	require.ErrorIs(t, err, ErrCaseClosed)
+	_, err = s.Close("invalid")
+	require.ErrorIs(t, err, ErrCaseNotFound)
+
+	require.Nil(t, s.Link("cam1", "20240519/after.jpg", KindSnapshot, time.Now().Add(time.Second), time.Now().Add(time.Second)))
+	require.Nil(t, s.OpenCase("cam1"))
+	require.Equal(t, c2.ID, s.OpenCase("cam2").ID)
+
+	err = s.LinkTo(c1.ID, "20240520/export.mp4", KindExport)
+	require.NoError(t, err)
+
+	id, ok := s.FindByFile("20240519/snap.jpg")
+	require.True(t, ok)
+	require.Equal(t, c1.ID, id)
+
+	s.Move("20240519/snap.jpg", "favorite/snap.jpg")
+
+	// the store is loaded at the next start
+	s = &Store{
+		RecordPath: dir,
+		Parent:     test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+
+	c, err := s.Get(c1.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusClosed, c.Status)
+	require.NotNil(t, c.ClosedAt)
+	require.Equal(t, "Gastroscopy", c.Fields["procedure"])
+	require.Equal(t, []string{"20240519/rec.mp4", "favorite/snap.jpg", "20240520/export.mp4"}, func() []string {
+		var ret []string
+		for _, f := range c.Files {
+			ret = append(ret, f.Path)
+		}
+		return ret
+	}())
+
+	for _, ca := range []struct {
+		name string
+		q    Query
+		ids  []string
+	}{
+		{"all", Query{}, []string{c2.ID, c1.ID}},
+		{"text", Query{Text: "gastro"}, []string{c1.ID}},
+		{"status", Query{Status: StatusOpen}, []string{c2.ID}},
+		{"patient", Query{PatientID: "P0002"}, []string{c2.ID}},
+		{"accession", Query{AccessionNumber: "A-123"}, []string{c1.ID}},
+		{"pagination", Query{Page: 2, PageSize: 1}, []string{c1.ID}},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			ids := []string{}
+			for _, c := range s.Search(ca.q).Cases {
+				ids = append(ids, c.ID)
+			}
+			require.Equal(t, ca.ids, ids)
+		})
+	}
+}
+
+func TestPackage(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.MkdirAll(filepath.Join(dir, "20240519"), 0o755)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "20240519", "rec.mp4"), []byte("video"), 0o644)
+	require.NoError(t, err)
+
+	s := &Store{
+		RecordPath: dir,
+		Parent:     test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+
+	c, err := s.Open("cam1", Metadata{PatientID: "P0001"})
+	require.NoError(t, err)
+
+	s.Link("cam1", "20240519/rec.mp4", KindRecording, time.Now(), time.Now())
+	s.Link("cam1", "20240519/deleted.jpg", KindSnapshot, time.Now(), time.Now())
+
+	var buf bytes.Buffer
+	m, err := s.Package(c.ID, &buf)
+	require.NoError(t, err)
+	require.Len(t, m.Files, 2)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+	require.Equal(t, ManifestFileName, zr.File[0].Name)
+	require.Equal(t, "files/20240519/rec.mp4", zr.File[1].Name)
+
+	r, err := zr.File[0].Open()
+	require.NoError(t, err)
+	var manifest Manifest
+	err = json.NewDecoder(r).Decode(&manifest)
+	require.NoError(t, err)
+	r.Close()
+
+	require.Equal(t, "P0001", manifest.Case.PatientID)
+	require.Equal(t, int64(5), manifest.Files[0].Size)
+	require.False(t, manifest.Files[0].Missing)
+	require.True(t, manifest.Files[1].Missing)
+
+	r, err = zr.File[1].Open()
+	require.NoError(t, err)
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	r.Close()
+	require.Equal(t, []byte("video"), content)
+
+	_, err = s.Package("invalid", io.Discard)
+	require.ErrorIs(t, err, ErrCaseNotFound)
+}
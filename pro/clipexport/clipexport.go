@@ -0,0 +1,478 @@
+// Package clipexport contains the Pro clip exporter.
+// It cuts MP4 and MPEG-TS recordings at key frames and concatenates clips
+// into a single MP4 file, without re-encoding and without FFmpeg.
+package clipexport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/playback"
+)
+
+// Clip is a time range of a recording.
+type Clip struct {
+	Path  string
+	Start time.Duration // from the beginning of the recording
+	End   time.Duration // optional, defaults to the end of the recording
+}
+
+// Exporter cuts clips and concatenates them into a MP4 file.
+// Clips start from the key frame that precedes Start, and end before the first frame at or after End.
+type Exporter struct {
+	Clips   []Clip
+	OutPath string
+	W       io.Writer // optional, the file is written here instead of OutPath
+	TempDir string    // optional, where payloads of MPEG-TS recordings are spooled
+	Parent  logger.Writer
+
+	// optional, writes a fMP4 file, whose parts are written while clips are read
+	Fragmented bool
+
+	// optional, the export stops when the context is canceled
+	Context context.Context
+
+	// optional, called with the fraction of written samples, from 0 to 1
+	OnProgress func(float64)
+}
+
+// cut is a clip resolved against its recording.
+type cut struct {
+	src *source
+
+	// absolute times of the recording
+	start time.Duration
+	end   time.Duration
+
+	// selected samples of each track, [first, last)
+	ranges map[*sourceTrack][2]int
+}
+
+// outTrack is a track of the exported file.
+type outTrack struct {
+	id        int
+	timeScale uint32
+	codec     mp4.Codec
+
+	// track of each clip
+	tracks []*sourceTrack
+
+	// whether parameters of each clip must be sent in band,
+	// since they differ from the ones of the first clip
+	inBand []bool
+}
+
+// Log implements logger.Writer.
+func (e *Exporter) Log(level logger.Level, format string, args ...interface{}) {
+	e.Parent.Log(level, "[clip export] "+format, args...)
+}
+
+// Run runs the export.
+func (e *Exporter) Run() error {
+	if len(e.Clips) == 0 {
+		return fmt.Errorf("no clips provided")
+	}
+
+	if e.Context == nil {
+		e.Context = context.Background()
+	}
+
+	cuts := make([]*cut, len(e.Clips))
+
+	defer func() {
+		for _, c := range cuts {
+			if c != nil {
+				c.src.close()
+			}
+		}
+	}()
+
+	for i, clip := range e.Clips {
+		src, err := openSource(clip.Path, e.TempDir, e)
+		if err != nil {
+			return fmt.Errorf("clip %d (%s): %w", i, clip.Path, err)
+		}
+
+		c, err := cutSource(src, clip)
+		if err != nil {
+			src.close()
+			return fmt.Errorf("clip %d (%s): %w", i, clip.Path, err)
+		}
+		cuts[i] = c
+	}
+
+	tracks, err := e.matchTracks(cuts)
+	if err != nil {
+		return err
+	}
+
+	for i, c := range cuts {
+		if e.Context.Err() != nil {
+			return e.Context.Err()
+		}
+
+		if c.src.load != nil {
+			err = c.src.load()
+			if err != nil {
+				return fmt.Errorf("clip %d (%s): %w", i, e.Clips[i].Path, err)
+			}
+		}
+	}
+
+	err = e.write(cuts, tracks)
+	if err != nil {
+		if e.W == nil {
+			os.Remove(e.OutPath)
+		}
+		return err
+	}
+
+	var duration time.Duration
+	for _, c := range cuts {
+		duration += c.end - c.start
+	}
+
+	if e.W == nil {
+		e.Log(logger.Info, "exported %d clips (%v) to %s", len(cuts), duration, e.OutPath)
+	} else {
+		e.Log(logger.Debug, "exported %d clips (%v)", len(cuts), duration)
+	}
+
+	return nil
+}
+
+func cutSource(src *source, clip Clip) (*cut, error) {
+	// the video track drives the cut, since it's the only one with non-sync samples
+	main := src.video
+	if main == nil {
+		if len(src.audios) == 0 {
+			return nil, fmt.Errorf("no supported tracks found")
+		}
+		main = src.audios[0]
+	}
+
+	if len(main.samples) == 0 {
+		return nil, fmt.Errorf("recording is empty")
+	}
+
+	origin := src.origin()
+	start := origin + clip.Start
+
+	end := main.endTime()
+	if clip.End > 0 && (origin+clip.End) < end {
+		end = origin + clip.End
+	}
+
+	if start >= end {
+		return nil, fmt.Errorf("clip is outside of the recording")
+	}
+
+	// start from the last key frame before the start of the clip,
+	// or from the first key frame when the clip starts before it
+	first := -1
+	for i, smp := range main.samples {
+		if main.sampleTime(i) > start && first >= 0 {
+			break
+		}
+		if !smp.nonSync {
+			first = i
+		}
+	}
+
+	if first < 0 || main.sampleTime(first) >= end {
+		return nil, fmt.Errorf("no key frames found inside the clip")
+	}
+
+	c := &cut{
+		src:    src,
+		start:  main.sampleTime(first),
+		end:    end,
+		ranges: make(map[*sourceTrack][2]int),
+	}
+
+	for _, track := range src.tracks() {
+		r := [2]int{len(track.samples), len(track.samples)}
+
+		for i := range track.samples {
+			t := track.sampleTime(i)
+
+			if t >= c.end {
+				if i < r[0] {
+					r[0] = i
+				}
+				r[1] = i
+				break
+			}
+
+			if t >= c.start && i < r[0] {
+				r[0] = i
+			}
+		}
+
+		for i := r[0]; i < r[1]; i++ {
+			track.samples[i].selected = true
+		}
+
+		c.ranges[track] = r
+	}
+
+	return c, nil
+}
+
+func codecParams(codec mp4.Codec) [][]byte {
+	switch codec := codec.(type) {
+	case *mp4.CodecH264:
+		return [][]byte{codec.SPS, codec.PPS}
+
+	case *mp4.CodecH265:
+		return [][]byte{codec.VPS, codec.SPS, codec.PPS}
+	}
+	return nil
+}
+
+func paramsEqual(a [][]byte, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTracks builds tracks of the exported file from tracks of the first clip,
+// and finds the corresponding tracks of the other clips.
+func (e *Exporter) matchTracks(cuts []*cut) ([]*outTrack, error) {
+	var tracks []*outTrack
+
+	first := cuts[0].src
+
+	if first.video != nil {
+		ot := &outTrack{
+			timeScale: first.video.timeScale,
+			codec:     first.video.codec,
+			tracks:    []*sourceTrack{first.video},
+			inBand:    []bool{false},
+		}
+
+		for i, c := range cuts[1:] {
+			video := c.src.video
+			if video == nil || reflect.TypeOf(video.codec) != reflect.TypeOf(ot.codec) {
+				return nil, fmt.Errorf("clip %d (%s): video codec differs from the one of the first clip",
+					i+1, e.Clips[i+1].Path)
+			}
+
+			ot.tracks = append(ot.tracks, video)
+			ot.inBand = append(ot.inBand, !paramsEqual(codecParams(video.codec), codecParams(ot.codec)))
+		}
+
+		tracks = append(tracks, ot)
+	} else {
+		for i, c := range cuts[1:] {
+			if c.src.video != nil {
+				e.Log(logger.Warn, "clip %d (%s): the first clip has no video, skipping video track",
+					i+1, e.Clips[i+1].Path)
+			}
+		}
+	}
+
+outer:
+	for j, audio := range first.audios {
+		ot := &outTrack{
+			timeScale: audio.timeScale,
+			codec:     audio.codec,
+			tracks:    []*sourceTrack{audio},
+			inBand:    []bool{false},
+		}
+
+		for i, c := range cuts[1:] {
+			if j >= len(c.src.audios) || !reflect.DeepEqual(c.src.audios[j].codec, ot.codec) {
+				e.Log(logger.Warn, "clip %d (%s): audio track %d is missing or has a different codec, "+
+					"skipping it in the whole export", i+1, e.Clips[i+1].Path, j)
+				continue outer
+			}
+
+			ot.tracks = append(ot.tracks, c.src.audios[j])
+			ot.inBand = append(ot.inBand, false)
+		}
+
+		tracks = append(tracks, ot)
+	}
+
+	// tracks without samples can't be written
+	ret := tracks[:0]
+
+	for _, ot := range tracks {
+		count := 0
+		for i, c := range cuts {
+			r := c.ranges[ot.tracks[i]]
+			count += r[1] - r[0]
+		}
+
+		if count != 0 {
+			ot.id = len(ret) + 1
+			ret = append(ret, ot)
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no samples found inside clips")
+	}
+
+	return ret, nil
+}
+
+// withParams prepends parameters to the payload of a sync sample.
+func withParams(smp *sample, params [][]byte) (uint32, func() ([]byte, error)) {
+	prefix := make([]byte, 0, 64)
+	for _, p := range params {
+		prefix = append(prefix, byte(len(p)>>24), byte(len(p)>>16), byte(len(p)>>8), byte(len(p)))
+		prefix = append(prefix, p...)
+	}
+
+	return uint32(len(prefix)) + smp.size, func() ([]byte, error) {
+		payload, err := smp.getPayload()
+		if err != nil {
+			return nil, err
+		}
+		return append(append([]byte(nil), prefix...), payload...), nil
+	}
+}
+
+func (e *Exporter) write(cuts []*cut, tracks []*outTrack) error {
+	out := e.W
+
+	var f *os.File
+	if out == nil {
+		var err error
+		f, err = os.Create(e.OutPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	initTracks := make([]*fmp4.InitTrack, len(tracks))
+	for i, ot := range tracks {
+		initTracks[i] = &fmp4.InitTrack{
+			ID:        ot.id,
+			TimeScale: ot.timeScale,
+			Codec:     ot.codec,
+		}
+	}
+
+	w := &playback.MP4Writer{
+		W:          out,
+		Tracks:     initTracks,
+		Fragmented: e.Fragmented,
+	}
+	w.Initialize()
+
+	total := 0
+	for i, c := range cuts {
+		for _, ot := range tracks {
+			r := c.ranges[ot.tracks[i]]
+			total += r[1] - r[0]
+		}
+	}
+
+	// payloads of MP4 files are read when the file is flushed,
+	// the ones of fMP4 files when samples are written
+	read := 0
+	percent := -1
+
+	withProgress := func(getPayload func() ([]byte, error)) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			read++
+			if p := read * 100 / total; p != percent {
+				percent = p
+
+				if e.Context.Err() != nil {
+					return nil, e.Context.Err()
+				}
+				if e.OnProgress != nil {
+					e.OnProgress(float64(read) / float64(total))
+				}
+			}
+			return getPayload()
+		}
+	}
+
+	// position of the current clip inside the exported file
+	var base time.Duration
+
+	for i, c := range cuts {
+		// next sample of each track
+		next := make([]int, len(tracks))
+		for k, ot := range tracks {
+			next[k] = c.ranges[ot.tracks[i]][0]
+		}
+
+		// samples are interleaved by time, that is needed by parts of fMP4 files
+		for {
+			k := -1
+			for l, ot := range tracks {
+				st := ot.tracks[i]
+				if next[l] < c.ranges[st][1] &&
+					(k < 0 || st.sampleTime(next[l]) < tracks[k].tracks[i].sampleTime(next[k])) {
+					k = l
+				}
+			}
+			if k < 0 {
+				break
+			}
+
+			ot := tracks[k]
+			st := ot.tracks[i]
+			smp := st.samples[next[k]]
+			next[k]++
+
+			t := base + durationMp4ToGo(smp.dts, st.timeScale) - c.start
+			ptsOffset := durationMp4ToGo(int64(smp.ptsOffset), st.timeScale)
+
+			size, getPayload := smp.size, smp.getPayload
+			if ot.inBand[i] && !smp.nonSync {
+				size, getPayload = withParams(smp, codecParams(st.codec))
+			}
+
+			err := w.WriteSample(
+				ot.id,
+				durationGoToMp4(t, ot.timeScale),
+				int32(durationGoToMp4(ptsOffset, ot.timeScale)),
+				smp.nonSync,
+				size,
+				withProgress(getPayload))
+			if err != nil {
+				return err
+			}
+		}
+
+		base += c.end - c.start
+	}
+
+	for _, ot := range tracks {
+		w.WriteFinalDTS(ot.id, durationGoToMp4(base, ot.timeScale))
+	}
+
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+
+	if f != nil {
+		return f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package clipexport
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
+	"github.com/stretchr/testify/require"
+	gmp4 "github.com/yapingcat/gomedia/go-mp4"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+type nilLogger struct{}
+
+func (nilLogger) Log(_ logger.Level, _ string, _ ...interface{}) {}
+
+var testAudioConfig = mpeg4audio.AudioSpecificConfig{
+	Type:         2,
+	SampleRate:   44100,
+	ChannelCount: 2,
+}
+
+var testPPS = []byte{0x68, 0xce, 0x3c, 0x80}
+
+// test recordings have 10 frames per second and a key frame every second.
+const testFrameDuration = 100 * time.Millisecond
+
+func testAccessUnit(sps []byte, i int) [][]byte {
+	if i%10 == 0 {
+		return [][]byte{sps, testPPS, {0x65, 0x88, 0x84, 0x00, 0x33, 0xff, 0xff, 0xff, byte(i)}}
+	}
+	return [][]byte{{0x41, 0x9a, 0x24, 0x6c, 0x42, 0xff, 0xff, 0xff, byte(i)}}
+}
+
+func testAudioFrames(frames int) int {
+	return int(time.Duration(frames) * testFrameDuration * 44100 / 1024 / time.Second)
+}
+
+// writeTestMP4 writes a recording with the same muxer used by the MP4 recorder.
+func writeTestMP4(t *testing.T, fpath string, fragmented bool, frames int) {
+	f, err := os.Create(fpath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var options []gmp4.MuxerOption
+	if fragmented {
+		options = append(options, gmp4.WithMp4Flag(gmp4.MP4_FLAG_FRAGMENT))
+	}
+
+	m, err := gmp4.CreateMp4Muxer(f, options...)
+	require.NoError(t, err)
+
+	video := m.AddVideoTrack(gmp4.MP4_CODEC_H264)
+	audio := m.AddAudioTrack(gmp4.MP4_CODEC_AAC,
+		gmp4.WithAudioSampleRate(44100),
+		gmp4.WithAudioChannelCount(2))
+
+	audioFrames := testAudioFrames(frames)
+	a := 0
+
+	for i := 0; i < frames; i++ {
+		ts := uint64(time.Duration(i) * testFrameDuration / time.Millisecond)
+
+		if fragmented && i != 0 && i%10 == 0 {
+			err = m.FlushFragment()
+			require.NoError(t, err)
+		}
+
+		buf, err2 := h264.AnnexB(testAccessUnit(test.FormatH264.SPS, i)).Marshal()
+		require.NoError(t, err2)
+		err = m.Write(video, buf, ts, ts)
+		require.NoError(t, err)
+
+		for ; a < audioFrames && a*1024*1000/44100 < int(ts)+100; a++ {
+			pkts := mpeg4audio.ADTSPackets{{
+				Type:         testAudioConfig.Type,
+				SampleRate:   testAudioConfig.SampleRate,
+				ChannelCount: testAudioConfig.ChannelCount,
+				AU:           []byte{byte(a), 1, 2, 3},
+			}}
+			buf, err2 = pkts.Marshal()
+			require.NoError(t, err2)
+			ats := uint64(a * 1024 * 1000 / 44100)
+			err = m.Write(audio, buf, ats, ats)
+			require.NoError(t, err)
+		}
+	}
+
+	err = m.WriteTrailer()
+	require.NoError(t, err)
+}
+
+func writeTestTS(t *testing.T, fpath string, sps []byte, frames int) {
+	f, err := os.Create(fpath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	videoTrack := &mpegts.Track{Codec: &mpegts.CodecH264{}}
+	audioTrack := &mpegts.Track{Codec: &mpegts.CodecMPEG4Audio{Config: testAudioConfig}}
+
+	w := &mpegts.Writer{W: f, Tracks: []*mpegts.Track{videoTrack, audioTrack}}
+	err = w.Initialize()
+	require.NoError(t, err)
+
+	audioFrames := testAudioFrames(frames)
+	a := 0
+
+	for i := 0; i < frames; i++ {
+		pts := 90000 + int64(time.Duration(i)*testFrameDuration*90000/time.Second)
+
+		err = w.WriteH264(videoTrack, pts, pts, testAccessUnit(sps, i))
+		require.NoError(t, err)
+
+		for ; a < audioFrames && int64(a)*1024*90000/44100 < pts-90000+9000; a++ {
+			err = w.WriteMPEG4Audio(audioTrack, 90000+int64(a)*1024*90000/44100, [][]byte{{byte(a), 1, 2, 3}})
+			require.NoError(t, err)
+		}
+	}
+}
+
+func readTestOutput(t *testing.T, fpath string) *source {
+	src, err := openMP4(fpath, nilLogger{})
+	require.NoError(t, err)
+	t.Cleanup(func() { src.close() })
+
+	require.NotNil(t, src.video)
+	require.Len(t, src.audios, 1)
+	return src
+}
+
+func samplePayload(t *testing.T, smp *sample) [][]byte {
+	buf, err := smp.getPayload()
+	require.NoError(t, err)
+
+	var avcc h264.AVCC
+	err = avcc.Unmarshal(buf)
+	require.NoError(t, err)
+	return avcc
+}
+
+func TestExportCut(t *testing.T) {
+	for _, ca := range []string{"mp4", "fmp4", "ts"} {
+		t.Run(ca, func(t *testing.T) {
+			dir := t.TempDir()
+
+			var fpath string
+			switch ca {
+			case "mp4":
+				fpath = filepath.Join(dir, "rec.mp4")
+				writeTestMP4(t, fpath, false, 40)
+
+			case "fmp4":
+				fpath = filepath.Join(dir, "rec.mp4")
+				writeTestMP4(t, fpath, true, 40)
+
+			case "ts":
+				fpath = filepath.Join(dir, "rec.ts")
+				writeTestTS(t, fpath, test.FormatH264.SPS, 40)
+			}
+
+			e := &Exporter{
+				Clips: []Clip{{
+					Path:  fpath,
+					Start: 1500 * time.Millisecond,
+					End:   2500 * time.Millisecond,
+				}},
+				OutPath: filepath.Join(dir, "out.mp4"),
+				TempDir: dir,
+				Parent:  nilLogger{},
+			}
+			err := e.Run()
+			require.NoError(t, err)
+
+			out := readTestOutput(t, e.OutPath)
+
+			// the clip starts from the key frame at 1s and ends before the frame at 2.5s
+			require.Len(t, out.video.samples, 15)
+			require.False(t, out.video.samples[0].nonSync)
+			require.True(t, out.video.samples[1].nonSync)
+			require.Equal(t, 1500*time.Millisecond, out.video.endTime())
+
+			au := samplePayload(t, out.video.samples[0])
+			require.Equal(t, []byte{0x65, 0x88, 0x84, 0x00, 0x33, 0xff, 0xff, 0xff, 10}, au[len(au)-1])
+
+			require.Equal(t, &mp4.CodecMPEG4Audio{Config: testAudioConfig}, out.audios[0].codec)
+			require.NotEmpty(t, out.audios[0].samples)
+			require.InDelta(t, 1500*time.Millisecond, out.audios[0].endTime(), float64(30*time.Millisecond))
+		})
+	}
+}
+
+func TestExportConcat(t *testing.T) {
+	dir := t.TempDir()
+
+	// a recording with different parameters
+	sps2 := append([]byte(nil), test.FormatH264.SPS...)
+	sps2[3] = 0x1f
+
+	writeTestMP4(t, filepath.Join(dir, "rec1.mp4"), false, 30)
+	writeTestTS(t, filepath.Join(dir, "rec2.ts"), sps2, 30)
+
+	e := &Exporter{
+		Clips: []Clip{
+			{
+				Path:  filepath.Join(dir, "rec1.mp4"),
+				Start: 500 * time.Millisecond,
+				End:   1500 * time.Millisecond,
+			},
+			{
+				Path:  filepath.Join(dir, "rec2.ts"),
+				Start: 2 * time.Second,
+			},
+		},
+		OutPath: filepath.Join(dir, "out.mp4"),
+		TempDir: dir,
+		Parent:  nilLogger{},
+	}
+	err := e.Run()
+	require.NoError(t, err)
+
+	out := readTestOutput(t, e.OutPath)
+
+	require.Equal(t, &mp4.CodecH264{SPS: test.FormatH264.SPS, PPS: testPPS}, out.video.codec)
+	require.Len(t, out.video.samples, 15+10)
+	require.Equal(t, 2500*time.Millisecond, out.video.endTime())
+
+	// the second clip follows the first one
+	second := out.video.samples[15]
+	require.False(t, second.nonSync)
+	require.Equal(t, 1500*time.Millisecond, out.video.sampleTime(15))
+
+	// and carries its own parameters
+	au := samplePayload(t, second)
+	require.True(t, bytes.Equal(sps2, au[0]))
+	require.Equal(t, []byte{0x65, 0x88, 0x84, 0x00, 0x33, 0xff, 0xff, 0xff, 20}, au[len(au)-1])
+
+	require.NotEmpty(t, out.audios[0].samples)
+}
+
+func TestExportOutsideRecording(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMP4(t, filepath.Join(dir, "rec.mp4"), false, 10)
+
+	e := &Exporter{
+		Clips: []Clip{{
+			Path:  filepath.Join(dir, "rec.mp4"),
+			Start: 5 * time.Second,
+			End:   6 * time.Second,
+		}},
+		OutPath: filepath.Join(dir, "out.mp4"),
+		Parent:  nilLogger{},
+	}
+	err := e.Run()
+	require.EqualError(t, err, "clip 0 ("+filepath.Join(dir, "rec.mp4")+"): clip is outside of the recording")
+
+	_, err = os.Stat(e.OutPath)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestExportProgress(t *testing.T) {
+	dir := t.TempDir()
+	writeTestMP4(t, filepath.Join(dir, "rec.mp4"), false, 30)
+
+	var progress []float64
+
+	e := &Exporter{
+		Clips:   []Clip{{Path: filepath.Join(dir, "rec.mp4")}},
+		OutPath: filepath.Join(dir, "out.mp4"),
+		Parent:  nilLogger{},
+		OnProgress: func(p float64) {
+			progress = append(progress, p)
+		},
+	}
+	err := e.Run()
+	require.NoError(t, err)
+
+	require.NotEmpty(t, progress)
+	require.IsIncreasing(t, progress)
+	require.Equal(t, 1.0, progress[len(progress)-1])
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	e = &Exporter{
+		Clips:   []Clip{{Path: filepath.Join(dir, "rec.mp4")}},
+		OutPath: filepath.Join(dir, "out2.mp4"),
+		Parent:  nilLogger{},
+		Context: ctx,
+		OnProgress: func(p float64) {
+			if p >= 0.5 {
+				cancel()
+			}
+		},
+	}
+	err = e.Run()
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = os.Stat(e.OutPath)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestDuration(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTestMP4(t, filepath.Join(dir, "rec.mp4"), false, 30)
+	writeTestTS(t, filepath.Join(dir, "rec.ts"), test.FormatH264.SPS, 30)
+
+	d, err := Duration(filepath.Join(dir, "rec.mp4"), nilLogger{})
+	require.NoError(t, err)
+	require.InDelta(t, 3*time.Second, d, float64(testFrameDuration))
+
+	d, err = Duration(filepath.Join(dir, "rec.ts"), nilLogger{})
+	require.NoError(t, err)
+	require.InDelta(t, 3*time.Second, d, float64(testFrameDuration))
+}
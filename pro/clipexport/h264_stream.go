@@ -0,0 +1,117 @@
+package clipexport
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// H264Stream describes the video track of a recording written as H264 byte stream.
+type H264Stream struct {
+	Width      int
+	Height     int
+	ProfileIdc uint8
+	LevelIdc   uint8
+	Frames     int
+	Duration   time.Duration
+}
+
+// FrameRate returns the average frame rate.
+func (s *H264Stream) FrameRate() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Frames) / s.Duration.Seconds()
+}
+
+func hasParams(au [][]byte) bool {
+	for _, nalu := range au {
+		if h264.NALUType(nalu[0]&0x1F) == h264.NALUTypeSPS {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteH264 writes the H264 video track of a recording as Annex-B byte stream,
+// with SPS and PPS before every key frame, in decode order.
+// TempDir is used by MPEG-TS recordings, as in Exporter.
+func WriteH264(fpath string, tempDir string, w io.Writer, l logger.Writer) (*H264Stream, error) {
+	src, err := openSource(fpath, tempDir, l)
+	if err != nil {
+		return nil, err
+	}
+	defer src.close() //nolint:errcheck
+
+	if src.video == nil {
+		return nil, fmt.Errorf("%s doesn't contain a video track", fpath)
+	}
+
+	codec, ok := src.video.codec.(*mp4.CodecH264)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported video codec, only H264 is supported", fpath)
+	}
+
+	var sps h264.SPS
+	err = sps.Unmarshal(codec.SPS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SPS: %w", err)
+	}
+
+	samples := src.video.samples
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("%s doesn't contain video samples", fpath)
+	}
+
+	for _, smp := range samples {
+		smp.selected = true
+	}
+
+	if src.load != nil {
+		err = src.load()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, smp := range samples {
+		payload, err2 := smp.getPayload()
+		if err2 != nil {
+			return nil, err2
+		}
+
+		var au h264.AVCC
+		err2 = au.Unmarshal(payload)
+		if err2 != nil {
+			return nil, err2
+		}
+
+		if !smp.nonSync && !hasParams(au) {
+			au = append([][]byte{codec.SPS, codec.PPS}, au...)
+		}
+
+		buf, err2 := h264.AnnexB(au).Marshal()
+		if err2 != nil {
+			return nil, err2
+		}
+
+		_, err2 = w.Write(buf)
+		if err2 != nil {
+			return nil, err2
+		}
+	}
+
+	return &H264Stream{
+		Width:      sps.Width(),
+		Height:     sps.Height(),
+		ProfileIdc: sps.ProfileIdc,
+		LevelIdc:   sps.LevelIdc,
+		Frames:     len(samples),
+		Duration:   src.video.endTime() - src.video.sampleTime(0),
+	}, nil
+}
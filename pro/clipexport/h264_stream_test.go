@@ -0,0 +1,49 @@
+package clipexport
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestWriteH264(t *testing.T) {
+	for _, ca := range []string{"mp4", "ts"} {
+		t.Run(ca, func(t *testing.T) {
+			dir := t.TempDir()
+			fpath := filepath.Join(dir, "rec."+ca)
+
+			if ca == "mp4" {
+				writeTestMP4(t, fpath, false, 25)
+			} else {
+				writeTestTS(t, fpath, test.FormatH264.SPS, 25)
+			}
+
+			var buf bytes.Buffer
+			s, err := WriteH264(fpath, dir, &buf, nilLogger{})
+			require.NoError(t, err)
+
+			require.Equal(t, 1920, s.Width)
+			require.Equal(t, 1080, s.Height)
+			require.Equal(t, 25, s.Frames)
+			require.InDelta(t, 10, s.FrameRate(), 0.5)
+
+			var au h264.AnnexB
+			err = au.Unmarshal(buf.Bytes())
+			require.NoError(t, err)
+
+			// every key frame is preceded by parameters
+			sps := 0
+			for _, nalu := range au {
+				if h264.NALUType(nalu[0]&0x1F) == h264.NALUTypeSPS {
+					sps++
+				}
+			}
+			require.Equal(t, 3, sps)
+		})
+	}
+}
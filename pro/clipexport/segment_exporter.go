@@ -0,0 +1,72 @@
+package clipexport
+
+import (
+	"io"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/playback"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+)
+
+// SegmentExporter serves recordings of the Pro layout through the playback server.
+// Intervals start from the key frame that precedes the requested start.
+// Segments of recordings that have been paused are parts of a file, placed at their offset.
+type SegmentExporter struct {
+	TempDir string // optional, where payloads of MPEG-TS recordings are spooled
+	Parent  logger.Writer
+}
+
+var _ playback.SegmentExporter = (*SegmentExporter)(nil)
+
+// Export implements playback.SegmentExporter.
+func (e *SegmentExporter) Export(
+	segments []*recordstore.Segment,
+	start time.Time,
+	duration time.Duration,
+	w io.Writer,
+	fragmented bool,
+) error {
+	end := start.Add(duration)
+	var clips []Clip
+
+	for _, seg := range segments {
+		clipStart := max(0, start.Sub(seg.Start))
+		clipEnd := end.Sub(seg.Start)
+
+		if clipEnd <= 0 || (seg.Duration > 0 && clipStart >= seg.Duration) {
+			continue
+		}
+
+		clip := Clip{
+			Path:  seg.Fpath,
+			Start: seg.Offset + clipStart,
+			End:   seg.Offset + clipEnd,
+		}
+
+		if seg.Duration > 0 && clipEnd >= seg.Duration {
+			if seg.Continued {
+				// stop at the pause that ends the part
+				clip.End = seg.Offset + seg.Duration
+			} else {
+				// read until the end of the recording
+				clip.End = 0
+			}
+		}
+
+		clips = append(clips, clip)
+	}
+
+	if len(clips) == 0 {
+		return recordstore.ErrNoSegmentsFound
+	}
+
+	ex := &Exporter{
+		Clips:      clips,
+		W:          w,
+		TempDir:    e.TempDir,
+		Parent:     e.Parent,
+		Fragmented: fragmented,
+	}
+	return ex.Run()
+}
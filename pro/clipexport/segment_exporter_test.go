@@ -0,0 +1,116 @@
+package clipexport
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+)
+
+func TestSegmentExporter(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTestMP4(t, filepath.Join(dir, "rec1.mp4"), false, 30)
+	writeTestMP4(t, filepath.Join(dir, "rec2.mp4"), false, 30)
+
+	start := time.Date(2008, 11, 7, 11, 22, 0, 0, time.Local)
+
+	segments := []*recordstore.Segment{
+		{
+			Fpath:    filepath.Join(dir, "rec1.mp4"),
+			Start:    start,
+			Duration: 3 * time.Second,
+		},
+		{
+			Fpath:    filepath.Join(dir, "rec2.mp4"),
+			Start:    start.Add(3 * time.Second),
+			Duration: 3 * time.Second,
+		},
+	}
+
+	e := &SegmentExporter{
+		TempDir: dir,
+		Parent:  nilLogger{},
+	}
+
+	var buf bytes.Buffer
+	err := e.Export(segments, start.Add(1500*time.Millisecond), 3*time.Second, &buf, true)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "out.mp4"), buf.Bytes(), 0o644)
+	require.NoError(t, err)
+
+	out := readTestOutput(t, filepath.Join(dir, "out.mp4"))
+
+	// the first clip starts from the key frame at 1s, the second one ends before the frame at 1.5s
+	require.Len(t, out.video.samples, 20+15)
+	require.False(t, out.video.samples[0].nonSync)
+	require.False(t, out.video.samples[20].nonSync)
+	require.InDelta(t, 2*time.Second, out.video.sampleTime(20), float64(testFrameDuration))
+
+	au := samplePayload(t, out.video.samples[20])
+	require.Equal(t, []byte{0x65, 0x88, 0x84, 0x00, 0x33, 0xff, 0xff, 0xff, 0}, au[len(au)-1])
+	require.NotEmpty(t, out.audios[0].samples)
+
+	// the interval is after the end of the recordings
+	err = e.Export(segments, start.Add(10*time.Second), 3*time.Second, &buf, true)
+	require.Equal(t, recordstore.ErrNoSegmentsFound, err)
+}
+
+func TestSegmentExporterParts(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTestMP4(t, filepath.Join(dir, "rec.mp4"), false, 30)
+
+	start := time.Date(2008, 11, 7, 11, 22, 0, 0, time.Local)
+
+	// the recording has been paused for 10s after 1.5s
+	segments := []*recordstore.Segment{
+		{
+			Fpath:     filepath.Join(dir, "rec.mp4"),
+			Start:     start,
+			Duration:  1500 * time.Millisecond,
+			Continued: true,
+		},
+		{
+			Fpath:    filepath.Join(dir, "rec.mp4"),
+			Start:    start.Add(11500 * time.Millisecond),
+			Duration: 1500 * time.Millisecond,
+			Offset:   1500 * time.Millisecond,
+		},
+	}
+
+	e := &SegmentExporter{
+		TempDir: dir,
+		Parent:  nilLogger{},
+	}
+
+	// the first part ends at the pause
+	var buf bytes.Buffer
+	err := e.Export(segments[:1], start, 5*time.Second, &buf, true)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "out1.mp4"), buf.Bytes(), 0o644)
+	require.NoError(t, err)
+
+	out := readTestOutput(t, filepath.Join(dir, "out1.mp4"))
+	require.Len(t, out.video.samples, 15)
+
+	// the second part is read from its offset, starting from the key frame at 2s
+	buf.Reset()
+	err = e.Export(segments[1:], start.Add(12*time.Second), 5*time.Second, &buf, true)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "out2.mp4"), buf.Bytes(), 0o644)
+	require.NoError(t, err)
+
+	out = readTestOutput(t, filepath.Join(dir, "out2.mp4"))
+	require.Len(t, out.video.samples, 10)
+	au := samplePayload(t, out.video.samples[0])
+	require.Equal(t, []byte{0x65, 0x88, 0x84, 0x00, 0x33, 0xff, 0xff, 0xff, 20}, au[len(au)-1])
+}
@@ -0,0 +1,150 @@
+package clipexport
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// sample is a sample of a source track.
+// Timestamps are expressed in the time scale of the track.
+type sample struct {
+	dts       int64
+	ptsOffset int32
+	nonSync   bool
+	size      uint32
+
+	// set when the sample is part of the exported clip
+	selected bool
+
+	// returns the payload, in the format used inside MP4 files (AVCC for H264/H265).
+	getPayload func() ([]byte, error)
+}
+
+// sourceTrack is a track of a recording.
+type sourceTrack struct {
+	timeScale uint32
+	codec     mp4.Codec
+	samples   []*sample
+
+	// DTS that follows the last sample
+	endDTS int64
+}
+
+func (t *sourceTrack) sampleTime(i int) time.Duration {
+	return durationMp4ToGo(t.samples[i].dts, t.timeScale)
+}
+
+func (t *sourceTrack) endTime() time.Duration {
+	return durationMp4ToGo(t.endDTS, t.timeScale)
+}
+
+// source is a recording opened for reading.
+type source struct {
+	video  *sourceTrack // optional
+	audios []*sourceTrack
+
+	// optional, called once samples have been selected, before payloads are read
+	load  func() error
+	close func() error
+}
+
+func (s *source) tracks() []*sourceTrack {
+	var ret []*sourceTrack
+	if s.video != nil {
+		ret = append(ret, s.video)
+	}
+	return append(ret, s.audios...)
+}
+
+// origin returns the time of the first sample of the recording.
+func (s *source) origin() time.Duration {
+	first := true
+	var ret time.Duration
+
+	for _, track := range s.tracks() {
+		if len(track.samples) != 0 {
+			t := track.sampleTime(0)
+			if first || t < ret {
+				ret = t
+				first = false
+			}
+		}
+	}
+
+	return ret
+}
+
+func durationGoToMp4(v time.Duration, timeScale uint32) int64 {
+	timeScale64 := int64(timeScale)
+	secs := v / time.Second
+	dec := v % time.Second
+	return int64(secs)*timeScale64 + int64(dec)*timeScale64/int64(time.Second)
+}
+
+func durationMp4ToGo(v int64, timeScale uint32) time.Duration {
+	timeScale64 := int64(timeScale)
+	secs := v / timeScale64
+	dec := v % timeScale64
+	return time.Duration(secs)*time.Second + time.Duration(dec)*time.Second/time.Duration(timeScale64)
+}
+
+// fillEndDTS estimates the DTS that follows the last sample of a track,
+// when the container doesn't provide the duration of samples.
+func (t *sourceTrack) fillEndDTS() {
+	switch n := len(t.samples); n {
+	case 0:
+
+	case 1:
+		t.endDTS = t.samples[0].dts
+
+	default:
+		t.endDTS = t.samples[n-1].dts + (t.samples[n-1].dts - t.samples[n-2].dts)
+	}
+}
+
+// openSource opens a recording, choosing the reader from the file extension.
+// Payloads of samples are read lazily.
+func openSource(fpath string, tempDir string, l logger.Writer) (*source, error) {
+	switch strings.ToLower(filepath.Ext(fpath)) {
+	case ".mp4", ".m4v", ".m4a", ".mov":
+		return openMP4(fpath, l)
+
+	case ".ts", ".m2ts":
+		return openTS(fpath, tempDir, l)
+
+	default:
+		return nil, fmt.Errorf("unsupported file format: %s", filepath.Ext(fpath))
+	}
+}
+
+// Duration returns the duration of a recording, from its first sample to the end of its longest track.
+// It is used with recordings whose metadata is missing or outdated.
+func Duration(fpath string, l logger.Writer) (time.Duration, error) {
+	src, err := openSource(fpath, "", l)
+	if err != nil {
+		return 0, err
+	}
+	defer src.close() //nolint:errcheck
+
+	var end time.Duration
+	found := false
+
+	for _, track := range src.tracks() {
+		if len(track.samples) != 0 && (!found || track.endTime() > end) {
+			end = track.endTime()
+			found = true
+		}
+	}
+
+	if !found {
+		return 0, fmt.Errorf("recording is empty")
+	}
+
+	return end - src.origin(), nil
+}
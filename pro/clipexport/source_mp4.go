@@ -0,0 +1,561 @@
+package clipexport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	amp4 "github.com/abema/go-mp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/g711"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	// sample_is_non_sync_sample inside sample flags.
+	sampleFlagIsNonSync = 1 << 16
+
+	decSpecificInfoTag = 0x05
+
+	trunDataOffsetPresent                  = 0x000001
+	trunFirstSampleFlagsPresent            = 0x000004
+	trunSampleDurationPresent              = 0x000100
+	trunSampleSizePresent                  = 0x000200
+	trunSampleFlagsPresent                 = 0x000400
+	trunSampleCompositionTimeOffsetPresent = 0x000800
+)
+
+// mp4Track is a track of a MP4 file, while it's being parsed.
+type mp4Track struct {
+	id        uint32
+	timeScale uint32
+	codec     mp4.Codec
+	entryType string
+	alaw      bool
+	mulaw     bool
+
+	// sample table of regular files
+	stts         []amp4.SttsEntry
+	ctts         *amp4.Ctts
+	stss         *amp4.Stss
+	stsc         []amp4.StscEntry
+	stsz         *amp4.Stsz
+	chunkOffsets []uint64
+
+	// defaults of fragmented files
+	trex *amp4.Trex
+
+	// samples of fragmented files
+	fragSamples []*mp4Sample
+	fragDTS     int64
+}
+
+type mp4Sample struct {
+	dts       int64
+	ptsOffset int32
+	nonSync   bool
+	offset    uint64
+	size      uint32
+}
+
+// mp4Fragment is the state of the track fragment that is being parsed.
+type mp4Fragment struct {
+	track      *mp4Track
+	moofOffset uint64
+	tfhd       *amp4.Tfhd
+	dataOffset uint64
+}
+
+func findMP4Track(tracks []*mp4Track, id uint32) *mp4Track {
+	for _, track := range tracks {
+		if track.id == id {
+			return track
+		}
+	}
+	return nil
+}
+
+// openMP4 opens a MP4 file, either regular or fragmented.
+// The moov box can be placed anywhere inside the file.
+func openMP4(fpath string, l logger.Writer) (*source, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks, err := readMP4Tracks(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	src := &source{close: f.Close}
+
+	for _, mt := range tracks {
+		if mt.codec == nil {
+			l.Log(logger.Warn, "%s: skipping track %d with unsupported codec '%s'", fpath, mt.id, mt.entryType)
+			continue
+		}
+
+		if mt.timeScale == 0 {
+			l.Log(logger.Warn, "%s: skipping track %d without time scale", fpath, mt.id)
+			continue
+		}
+
+		samples, endDTS, err2 := mt.samples()
+		if err2 != nil {
+			f.Close()
+			return nil, fmt.Errorf("track %d: %w", mt.id, err2)
+		}
+
+		st := &sourceTrack{
+			timeScale: mt.timeScale,
+			codec:     mt.codec,
+			samples:   make([]*sample, len(samples)),
+			endDTS:    endDTS,
+		}
+
+		for i, s := range samples {
+			st.samples[i] = mt.wrapSample(f, s)
+		}
+
+		if mt.codec.IsVideo() {
+			if src.video == nil {
+				src.video = st
+			} else {
+				l.Log(logger.Warn, "%s: skipping additional video track %d", fpath, mt.id)
+			}
+		} else {
+			src.audios = append(src.audios, st)
+		}
+	}
+
+	return src, nil
+}
+
+func (t *mp4Track) wrapSample(f *os.File, s *mp4Sample) *sample {
+	getRaw := func() ([]byte, error) {
+		buf := make([]byte, s.size)
+		_, err := f.ReadAt(buf, int64(s.offset))
+		return buf, err
+	}
+
+	if !t.alaw && !t.mulaw {
+		return &sample{
+			dts:        s.dts,
+			ptsOffset:  s.ptsOffset,
+			nonSync:    s.nonSync,
+			size:       s.size,
+			getPayload: getRaw,
+		}
+	}
+
+	// G711 is converted to 16-bit LPCM, like the fMP4 recorder does
+	return &sample{
+		dts:     s.dts,
+		nonSync: false,
+		size:    s.size * 2,
+		getPayload: func() ([]byte, error) {
+			raw, err := getRaw()
+			if err != nil {
+				return nil, err
+			}
+
+			if t.mulaw {
+				var mu g711.Mulaw
+				mu.Unmarshal(raw)
+				return mu, nil
+			}
+
+			var al g711.Alaw
+			al.Unmarshal(raw)
+			return al, nil
+		},
+	}
+}
+
+func readMP4Tracks(f *os.File) ([]*mp4Track, error) {
+	var tracks []*mp4Track
+	var curTrack *mp4Track
+	var curMoofOffset uint64
+	var curFrag *mp4Fragment
+
+	_, err := amp4.ReadBoxStructure(f, func(h *amp4.ReadHandle) (interface{}, error) {
+		switch h.BoxInfo.Type.String() {
+		case "moov", "mdia", "minf", "stbl", "stsd", "mvex", "avc1", "hvc1", "hev1", "mp4a", "Opus":
+			return h.Expand()
+
+		case "trak":
+			curTrack = &mp4Track{}
+			tracks = append(tracks, curTrack)
+			return h.Expand()
+
+		case "moof":
+			curMoofOffset = h.BoxInfo.Offset
+			return h.Expand()
+
+		case "traf":
+			curFrag = &mp4Fragment{moofOffset: curMoofOffset}
+			return h.Expand()
+		}
+
+		if h.BoxInfo.Type.String() == "alaw" || h.BoxInfo.Type.String() == "ulaw" {
+			var buf bytes.Buffer
+			_, err := h.ReadData(&buf)
+			if err != nil {
+				return nil, err
+			}
+			return nil, curTrack.setG711(h.BoxInfo.Type.String(), buf.Bytes())
+		}
+
+		switch h.BoxInfo.Type.String() {
+		case "tkhd", "mdhd", "avcC", "hvcC", "esds", "dOps",
+			"stts", "ctts", "stss", "stsc", "stsz", "stco", "co64",
+			"trex", "tfhd", "tfdt", "trun":
+		default:
+			// sample entries are the only children of stsd
+			if len(h.Path) >= 2 && h.Path[len(h.Path)-2].String() == "stsd" && curTrack != nil {
+				curTrack.entryType = h.BoxInfo.Type.String()
+			}
+			return nil, nil
+		}
+
+		box, _, err := h.ReadPayload()
+		if err != nil {
+			return nil, err
+		}
+
+		switch box := box.(type) {
+		case *amp4.Tkhd:
+			curTrack.id = box.TrackID
+
+		case *amp4.Mdhd:
+			curTrack.timeScale = box.Timescale
+
+		case *amp4.AVCDecoderConfiguration:
+			curTrack.entryType = "avc1"
+			if len(box.SequenceParameterSets) == 0 || len(box.PictureParameterSets) == 0 {
+				return nil, fmt.Errorf("H264 parameters are missing")
+			}
+			curTrack.codec = &mp4.CodecH264{
+				SPS: box.SequenceParameterSets[0].NALUnit,
+				PPS: box.PictureParameterSets[0].NALUnit,
+			}
+
+		case *amp4.HvcC:
+			curTrack.entryType = "hvc1"
+			codec := &mp4.CodecH265{}
+			for _, arr := range box.NaluArrays {
+				if len(arr.Nalus) == 0 {
+					continue
+				}
+				switch arr.NaluType {
+				case 32:
+					codec.VPS = arr.Nalus[0].NALUnit
+				case 33:
+					codec.SPS = arr.Nalus[0].NALUnit
+				case 34:
+					codec.PPS = arr.Nalus[0].NALUnit
+				}
+			}
+			if codec.VPS == nil || codec.SPS == nil || codec.PPS == nil {
+				return nil, fmt.Errorf("H265 parameters are missing")
+			}
+			curTrack.codec = codec
+
+		case *amp4.Esds:
+			curTrack.entryType = "mp4a"
+			for _, desc := range box.Descriptors {
+				if desc.Tag == decSpecificInfoTag {
+					var conf mpeg4audio.AudioSpecificConfig
+					err = conf.Unmarshal(desc.Data)
+					if err != nil {
+						return nil, fmt.Errorf("invalid MPEG-4 audio configuration: %w", err)
+					}
+					curTrack.codec = &mp4.CodecMPEG4Audio{Config: conf}
+				}
+			}
+
+		case *amp4.DOps:
+			curTrack.entryType = "Opus"
+			curTrack.codec = &mp4.CodecOpus{ChannelCount: int(box.OutputChannelCount)}
+
+		case *amp4.Stts:
+			curTrack.stts = box.Entries
+
+		case *amp4.Ctts:
+			curTrack.ctts = box
+
+		case *amp4.Stss:
+			curTrack.stss = box
+
+		case *amp4.Stsc:
+			curTrack.stsc = box.Entries
+
+		case *amp4.Stsz:
+			curTrack.stsz = box
+
+		case *amp4.Stco:
+			curTrack.chunkOffsets = make([]uint64, len(box.ChunkOffset))
+			for i, v := range box.ChunkOffset {
+				curTrack.chunkOffsets[i] = uint64(v)
+			}
+
+		case *amp4.Co64:
+			curTrack.chunkOffsets = box.ChunkOffset
+
+		case *amp4.Trex:
+			if track := findMP4Track(tracks, box.TrackID); track != nil {
+				track.trex = box
+			}
+
+		case *amp4.Tfhd:
+			curFrag.track = findMP4Track(tracks, box.TrackID)
+			if curFrag.track == nil {
+				return nil, fmt.Errorf("fragment of unknown track %d", box.TrackID)
+			}
+			curFrag.tfhd = box
+
+			if box.CheckFlag(amp4.TfhdBaseDataOffsetPresent) {
+				curFrag.dataOffset = box.BaseDataOffset
+			} else {
+				curFrag.dataOffset = curFrag.moofOffset
+			}
+
+		case *amp4.Tfdt:
+			if curFrag.track == nil {
+				return nil, fmt.Errorf("tfdt box before tfhd")
+			}
+			if box.GetVersion() == 0 {
+				curFrag.track.fragDTS = int64(box.BaseMediaDecodeTimeV0)
+			} else {
+				curFrag.track.fragDTS = int64(box.BaseMediaDecodeTimeV1)
+			}
+
+		case *amp4.Trun:
+			if curFrag.track == nil {
+				return nil, fmt.Errorf("trun box before tfhd")
+			}
+			curFrag.readTrun(box)
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tracks, nil
+}
+
+func (t *mp4Track) setG711(entryType string, payload []byte) error {
+	// SampleEntry (8 bytes), reserved (8 bytes), channelcount, samplesize,
+	// pre_defined, reserved, samplerate (16.16)
+	if len(payload) < 28 {
+		return fmt.Errorf("invalid %s sample entry", entryType)
+	}
+
+	t.entryType = entryType
+	t.alaw = (entryType == "alaw")
+	t.mulaw = (entryType == "ulaw")
+
+	channelCount := int(binary.BigEndian.Uint16(payload[16:]))
+	if channelCount == 0 {
+		channelCount = 1
+	}
+
+	sampleRate := int(binary.BigEndian.Uint32(payload[24:]) >> 16)
+	if sampleRate == 0 {
+		sampleRate = 8000
+	}
+
+	t.codec = &mp4.CodecLPCM{
+		LittleEndian: false,
+		BitDepth:     16,
+		SampleRate:   sampleRate,
+		ChannelCount: channelCount,
+	}
+	return nil
+}
+
+func (fr *mp4Fragment) defaultDuration() uint32 {
+	switch {
+	case fr.tfhd.CheckFlag(amp4.TfhdDefaultSampleDurationPresent):
+		return fr.tfhd.DefaultSampleDuration
+	case fr.track.trex != nil:
+		return fr.track.trex.DefaultSampleDuration
+	}
+	return 0
+}
+
+func (fr *mp4Fragment) defaultSize() uint32 {
+	switch {
+	case fr.tfhd.CheckFlag(amp4.TfhdDefaultSampleSizePresent):
+		return fr.tfhd.DefaultSampleSize
+	case fr.track.trex != nil:
+		return fr.track.trex.DefaultSampleSize
+	}
+	return 0
+}
+
+func (fr *mp4Fragment) defaultFlags() uint32 {
+	switch {
+	case fr.tfhd.CheckFlag(amp4.TfhdDefaultSampleFlagsPresent):
+		return fr.tfhd.DefaultSampleFlags
+	case fr.track.trex != nil:
+		return fr.track.trex.DefaultSampleFlags
+	}
+	return 0
+}
+
+func (fr *mp4Fragment) readTrun(trun *amp4.Trun) {
+	if trun.CheckFlag(trunDataOffsetPresent) {
+		fr.dataOffset = uint64(int64(fr.dataOffset) + int64(trun.DataOffset))
+	}
+
+	for i, e := range trun.Entries {
+		duration := fr.defaultDuration()
+		if trun.CheckFlag(trunSampleDurationPresent) {
+			duration = e.SampleDuration
+		}
+
+		size := fr.defaultSize()
+		if trun.CheckFlag(trunSampleSizePresent) {
+			size = e.SampleSize
+		}
+
+		flags := fr.defaultFlags()
+		switch {
+		case trun.CheckFlag(trunSampleFlagsPresent):
+			flags = e.SampleFlags
+		case i == 0 && trun.CheckFlag(trunFirstSampleFlagsPresent):
+			flags = trun.FirstSampleFlags
+		}
+
+		var ptsOffset int32
+		if trun.CheckFlag(trunSampleCompositionTimeOffsetPresent) {
+			if trun.GetVersion() == 0 {
+				ptsOffset = int32(e.SampleCompositionTimeOffsetV0)
+			} else {
+				ptsOffset = e.SampleCompositionTimeOffsetV1
+			}
+		}
+
+		fr.track.fragSamples = append(fr.track.fragSamples, &mp4Sample{
+			dts:       fr.track.fragDTS,
+			ptsOffset: ptsOffset,
+			nonSync:   (flags & sampleFlagIsNonSync) != 0,
+			offset:    fr.dataOffset,
+			size:      size,
+		})
+
+		fr.track.fragDTS += int64(duration)
+		fr.dataOffset += uint64(size)
+	}
+}
+
+// samples returns the samples of the track, from the sample table and from fragments.
+func (t *mp4Track) samples() ([]*mp4Sample, int64, error) {
+	samples, endDTS, err := t.tableSamples()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(t.fragSamples) != 0 {
+		samples = append(samples, t.fragSamples...)
+		endDTS = t.fragDTS
+	}
+
+	return samples, endDTS, nil
+}
+
+func (t *mp4Track) tableSamples() ([]*mp4Sample, int64, error) {
+	if t.stsz == nil || t.stsz.SampleCount == 0 {
+		return nil, 0, nil
+	}
+
+	count := int(t.stsz.SampleCount)
+	samples := make([]*mp4Sample, count)
+
+	for i := range samples {
+		samples[i] = &mp4Sample{size: t.stsz.SampleSize}
+		if t.stsz.SampleSize == 0 {
+			if i >= len(t.stsz.EntrySize) {
+				return nil, 0, fmt.Errorf("invalid stsz box")
+			}
+			samples[i].size = t.stsz.EntrySize[i]
+		}
+	}
+
+	// decode timestamps
+
+	var dts int64
+	i := 0
+	for _, e := range t.stts {
+		for j := uint32(0); j < e.SampleCount && i < count; j++ {
+			samples[i].dts = dts
+			dts += int64(e.SampleDelta)
+			i++
+		}
+	}
+	if i != count {
+		return nil, 0, fmt.Errorf("invalid stts box")
+	}
+
+	// composition time offsets
+
+	if t.ctts != nil {
+		i = 0
+		for _, e := range t.ctts.Entries {
+			for j := uint32(0); j < e.SampleCount && i < count; j++ {
+				if t.ctts.GetVersion() == 0 {
+					samples[i].ptsOffset = int32(e.SampleOffsetV0)
+				} else {
+					samples[i].ptsOffset = e.SampleOffsetV1
+				}
+				i++
+			}
+		}
+	}
+
+	// sync samples. When stss is missing, all samples are sync samples.
+
+	if t.stss != nil {
+		for _, s := range samples {
+			s.nonSync = true
+		}
+		for _, n := range t.stss.SampleNumber {
+			if n >= 1 && int(n) <= count {
+				samples[n-1].nonSync = false
+			}
+		}
+	}
+
+	// offsets
+
+	i = 0
+	for chunk := range t.chunkOffsets {
+		perChunk := uint32(0)
+		for _, e := range t.stsc {
+			if e.FirstChunk > uint32(chunk+1) {
+				break
+			}
+			perChunk = e.SamplesPerChunk
+		}
+
+		offset := t.chunkOffsets[chunk]
+		for j := uint32(0); j < perChunk && i < count; j++ {
+			samples[i].offset = offset
+			offset += uint64(samples[i].size)
+			i++
+		}
+	}
+	if i != count {
+		return nil, 0, fmt.Errorf("invalid stsc or stco box")
+	}
+
+	return samples, dts, nil
+}
@@ -0,0 +1,420 @@
+package clipexport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/opus"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const tsVideoTimeScale = 90000
+
+// tsTrack is a track of a MPEG-TS file, while it's being parsed.
+type tsTrack struct {
+	track *sourceTrack
+
+	// H264 / H265 parameters, found inside the stream
+	vps []byte
+	sps []byte
+	pps []byte
+
+	// index of the next sample, used to match samples between passes
+	next int
+}
+
+// tsSource reads MPEG-TS files in two passes: the first one indexes samples,
+// the second one copies payloads of samples that are part of the clip into a spool file,
+// since MPEG-TS files can't be accessed randomly.
+type tsSource struct {
+	fpath   string
+	tempDir string
+	l       logger.Writer
+
+	tracks []*tsTrack
+	spool  *os.File
+
+	// selected samples that still have to be spooled
+	remaining int
+}
+
+func openTS(fpath string, tempDir string, l logger.Writer) (*source, error) {
+	s := &tsSource{
+		fpath:   fpath,
+		tempDir: tempDir,
+		l:       l,
+	}
+
+	err := s.read(false)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &source{
+		load:  s.load,
+		close: s.close,
+	}
+
+	for _, tt := range s.tracks {
+		if tt.track == nil {
+			continue
+		}
+
+		tt.track.fillEndDTS()
+
+		switch codec := tt.track.codec.(type) {
+		case *mp4.CodecH264:
+			if tt.sps == nil || tt.pps == nil {
+				return nil, fmt.Errorf("H264 parameters not found")
+			}
+			codec.SPS = tt.sps
+			codec.PPS = tt.pps
+
+		case *mp4.CodecH265:
+			if tt.vps == nil || tt.sps == nil || tt.pps == nil {
+				return nil, fmt.Errorf("H265 parameters not found")
+			}
+			codec.VPS = tt.vps
+			codec.SPS = tt.sps
+			codec.PPS = tt.pps
+		}
+
+		if tt.track.codec.IsVideo() {
+			if src.video == nil {
+				src.video = tt.track
+			} else {
+				l.Log(logger.Warn, "%s: skipping additional video track", fpath)
+			}
+		} else {
+			src.audios = append(src.audios, tt.track)
+		}
+	}
+
+	return src, nil
+}
+
+// load copies payloads of selected samples into the spool file.
+func (s *tsSource) load() error {
+	var err error
+	s.spool, err = os.CreateTemp(s.tempDir, "clipexport-*.spool")
+	if err != nil {
+		return err
+	}
+
+	// the file is only used through the open descriptor
+	os.Remove(s.spool.Name())
+
+	for _, tt := range s.tracks {
+		if tt.track != nil {
+			for _, smp := range tt.track.samples {
+				if smp.selected {
+					s.remaining++
+				}
+			}
+		}
+	}
+
+	return s.read(true)
+}
+
+func (s *tsSource) close() error {
+	if s.spool != nil {
+		return s.spool.Close()
+	}
+	return nil
+}
+
+func filterNALUs(au [][]byte, isH265 bool) [][]byte {
+	ret := make([][]byte, 0, len(au))
+	for _, nalu := range au {
+		if len(nalu) == 0 {
+			continue
+		}
+		if isH265 {
+			if h265.NALUType((nalu[0]>>1)&0b111111) == h265.NALUType_AUD_NUT {
+				continue
+			}
+		} else if h264.NALUType(nalu[0]&0x1F) == h264.NALUTypeAccessUnitDelimiter {
+			continue
+		}
+		ret = append(ret, nalu)
+	}
+	return ret
+}
+
+func avccSize(au [][]byte) uint32 {
+	n := 0
+	for _, nalu := range au {
+		n += 4 + len(nalu)
+	}
+	return uint32(n)
+}
+
+// read parses the file. In the first pass, it fills tracks with samples,
+// in the second pass it spools payloads of selected samples.
+func (s *tsSource) read(spool bool) error {
+	f, err := os.Open(s.fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := &mpegts.Reader{R: bufio.NewReaderSize(f, 64*1024)}
+	err = r.Initialize()
+	if err != nil {
+		return err
+	}
+
+	r.OnDecodeError(func(_ error) {})
+
+	var spoolOffset int64
+	var spoolW *bufio.Writer
+	if spool {
+		spoolW = bufio.NewWriterSize(s.spool, 64*1024)
+	}
+
+	// adds a sample in the first pass, returns the sample to be spooled in the second one
+	addSample := func(tt *tsTrack, smp *sample) *sample {
+		if !spool {
+			tt.track.samples = append(tt.track.samples, smp)
+			return nil
+		}
+
+		if tt.next >= len(tt.track.samples) {
+			return nil
+		}
+
+		cur := tt.track.samples[tt.next]
+		tt.next++
+
+		if !cur.selected {
+			return nil
+		}
+		return cur
+	}
+
+	writeSpool := func(smp *sample, payload [][]byte, avcc bool) error {
+		offset := spoolOffset
+
+		for _, buf := range payload {
+			if avcc {
+				var l [4]byte
+				l[0] = byte(len(buf) >> 24)
+				l[1] = byte(len(buf) >> 16)
+				l[2] = byte(len(buf) >> 8)
+				l[3] = byte(len(buf))
+				_, err2 := spoolW.Write(l[:])
+				if err2 != nil {
+					return err2
+				}
+			}
+
+			_, err2 := spoolW.Write(buf)
+			if err2 != nil {
+				return err2
+			}
+		}
+
+		spoolOffset = offset + int64(smp.size)
+		s.remaining--
+		spoolFile := s.spool
+		size := smp.size
+
+		smp.getPayload = func() ([]byte, error) {
+			buf := make([]byte, size)
+			_, err2 := spoolFile.ReadAt(buf, offset)
+			return buf, err2
+		}
+		return nil
+	}
+
+	var td mpegts.TimeDecoder
+	td.Initialize()
+
+	for i, track := range r.Tracks() {
+		// tracks are matched by position between passes
+		var tt *tsTrack
+		if !spool {
+			tt = &tsTrack{}
+			s.tracks = append(s.tracks, tt)
+		} else {
+			if i >= len(s.tracks) || s.tracks[i].track == nil {
+				continue
+			}
+			tt = s.tracks[i]
+		}
+
+		switch codec := track.Codec.(type) {
+		case *mpegts.CodecH264, *mpegts.CodecH265:
+			_, isH265 := codec.(*mpegts.CodecH265)
+
+			if !spool {
+				tt.track = &sourceTrack{timeScale: tsVideoTimeScale}
+				if isH265 {
+					tt.track.codec = &mp4.CodecH265{}
+				} else {
+					tt.track.codec = &mp4.CodecH264{}
+				}
+			}
+
+			onData := func(pts int64, dts int64, au [][]byte) error {
+				dts = td.Decode(dts)
+				pts = td.Decode(pts)
+				au = filterNALUs(au, isH265)
+				if len(au) == 0 {
+					return nil
+				}
+
+				if !spool {
+					tt.saveParams(au, isH265)
+				}
+
+				var randomAccess bool
+				if isH265 {
+					randomAccess = h265.IsRandomAccess(au)
+				} else {
+					randomAccess = h264.IsRandomAccess(au)
+				}
+
+				smp := addSample(tt, &sample{
+					dts:       dts,
+					ptsOffset: int32(pts - dts),
+					nonSync:   !randomAccess,
+					size:      avccSize(au),
+				})
+				if smp == nil {
+					return nil
+				}
+				return writeSpool(smp, au, true)
+			}
+
+			if isH265 {
+				r.OnDataH265(track, onData)
+			} else {
+				r.OnDataH264(track, onData)
+			}
+
+		case *mpegts.CodecMPEG4Audio:
+			sampleRate := codec.Config.SampleRate
+			if sampleRate == 0 {
+				return fmt.Errorf("invalid MPEG-4 audio sample rate")
+			}
+
+			if !spool {
+				tt.track = &sourceTrack{
+					timeScale: uint32(sampleRate),
+					codec:     &mp4.CodecMPEG4Audio{Config: codec.Config},
+				}
+			}
+
+			r.OnDataMPEG4Audio(track, func(pts int64, aus [][]byte) error {
+				dts := td.Decode(pts) * int64(sampleRate) / tsVideoTimeScale
+
+				for j, au := range aus {
+					smp := addSample(tt, &sample{
+						dts:  dts + int64(j)*mpeg4audio.SamplesPerAccessUnit,
+						size: uint32(len(au)),
+					})
+					if smp != nil {
+						err2 := writeSpool(smp, [][]byte{au}, false)
+						if err2 != nil {
+							return err2
+						}
+					}
+				}
+				return nil
+			})
+
+		case *mpegts.CodecOpus:
+			if !spool {
+				tt.track = &sourceTrack{
+					timeScale: 48000,
+					codec:     &mp4.CodecOpus{ChannelCount: codec.ChannelCount},
+				}
+			}
+
+			r.OnDataOpus(track, func(pts int64, packets [][]byte) error {
+				dts := td.Decode(pts) * 48000 / tsVideoTimeScale
+
+				for _, pkt := range packets {
+					smp := addSample(tt, &sample{
+						dts:  dts,
+						size: uint32(len(pkt)),
+					})
+					if smp != nil {
+						err2 := writeSpool(smp, [][]byte{pkt}, false)
+						if err2 != nil {
+							return err2
+						}
+					}
+					dts += opus.PacketDuration2(pkt)
+				}
+				return nil
+			})
+
+		default:
+			if !spool {
+				s.l.Log(logger.Warn, "%s: skipping track %d with unsupported codec %T", s.fpath, track.PID, codec)
+			}
+		}
+	}
+
+	// in the second pass, the rest of the file is skipped once all selected samples have been spooled
+	for !spool || s.remaining > 0 {
+		err = r.Read()
+		if err != nil {
+			// recordings that are being written or that were truncated end abruptly
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return err
+		}
+	}
+
+	if spool {
+		return spoolW.Flush()
+	}
+	return nil
+}
+
+func (tt *tsTrack) saveParams(au [][]byte, isH265 bool) {
+	for _, nalu := range au {
+		if isH265 {
+			switch h265.NALUType((nalu[0] >> 1) & 0b111111) {
+			case h265.NALUType_VPS_NUT:
+				if tt.vps == nil {
+					tt.vps = append([]byte(nil), nalu...)
+				}
+			case h265.NALUType_SPS_NUT:
+				if tt.sps == nil {
+					tt.sps = append([]byte(nil), nalu...)
+				}
+			case h265.NALUType_PPS_NUT:
+				if tt.pps == nil {
+					tt.pps = append([]byte(nil), nalu...)
+				}
+			}
+			continue
+		}
+
+		switch h264.NALUType(nalu[0] & 0x1F) {
+		case h264.NALUTypeSPS:
+			if tt.sps == nil {
+				tt.sps = append([]byte(nil), nalu...)
+			}
+		case h264.NALUTypePPS:
+			if tt.pps == nil {
+				tt.pps = append([]byte(nil), nalu...)
+			}
+		}
+	}
+}
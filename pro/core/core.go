@@ -24,16 +24,25 @@ import (
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/metrics"
+	"github.com/bluenviron/mediamtx/internal/playback"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/rlimit"
 	"github.com/bluenviron/mediamtx/internal/servers/rtmp"
 	"github.com/bluenviron/mediamtx/internal/servers/rtsp"
 	"github.com/bluenviron/mediamtx/internal/servers/webrtc"
 
 	proapi "github.com/bluenviron/mediamtx/pro/api"
+	"github.com/bluenviron/mediamtx/pro/cases"
+	"github.com/bluenviron/mediamtx/pro/clipexport"
+	"github.com/bluenviron/mediamtx/pro/decoderpool"
+	"github.com/bluenviron/mediamtx/pro/devicedriver"
+	"github.com/bluenviron/mediamtx/pro/fileindex"
+	"github.com/bluenviron/mediamtx/pro/framecheck"
 	"github.com/bluenviron/mediamtx/pro/healthcheck"
 	"github.com/bluenviron/mediamtx/pro/recorder"
 	prorecordcleaner "github.com/bluenviron/mediamtx/pro/recordcleaner"
 	"github.com/bluenviron/mediamtx/pro/rvideo"
+	"github.com/bluenviron/mediamtx/pro/webhook"
 )
 
 // Version is the Pro version.
@@ -82,7 +91,10 @@ type Core struct {
 	externalCmdPool *externalcmd.Pool
 	authManager     *auth.Manager
 	metrics         *metrics.Metrics
+	fileIndex       *fileindex.Index
+	caseStore       *cases.Store
 	recordCleaner   *prorecordcleaner.Cleaner
+	playbackServer  *playback.Server
 	pathManager     *pathManager
 	rtspServer      *rtsp.Server
 	rtspsServer     *rtsp.Server
@@ -90,10 +102,13 @@ type Core struct {
 	rtmpsServer     *rtmp.Server
 	webRTCServer    *webrtc.Server
 	rvideoServer    *rvideo.RVideoServer
+	webhookOutbox   *webhook.Outbox
 	recordManager   *recorder.Manager
+	decoderPool     *decoderpool.Pool
 	api             *proapi.APIV2
 	authMiddleware  *proapi.APIKeyAuthMiddleware
 	healthChecker   *healthcheck.Checker
+	frameDetector   *framecheck.Detector
 	confWatcher     *confwatcher.ConfWatcher
 
 	// channels
@@ -105,6 +120,14 @@ type Core struct {
 
 // New allocates a Pro Core.
 func New(args []string) (*Core, bool) {
+	// 修复崩溃后未正常结束的录制文件：mediamtx repair [-date YYYYMMDD] [-dry-run] [配置文件]
+	if len(args) > 0 && args[0] == "repair" {
+		if !runRepair(args[1:]) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	ctx, ctxCancel := context.WithCancel(context.Background())
 
 	confPath := ""
@@ -156,6 +179,43 @@ func (p *Core) Log(level logger.Level, format string, args ...interface{}) {
 	p.logger.Log(level, format, args...)
 }
 
+// onRecordFileClosed is called by the record manager when a recording has been written.
+func (p *Core) onRecordFileClosed(fullPath string) {
+	err := p.fileIndex.Add(fullPath)
+	if err != nil {
+		p.Log(logger.Warn, "failed to index %s: %v", fullPath, err)
+	}
+
+	p.linkRecordingToCases(fullPath)
+}
+
+// linkRecordingToCases links a recording to the cases that were open on its path while it was written.
+func (p *Core) linkRecordingToCases(fullPath string) {
+	m, err := recordstore.ReadMetadata(fullPath)
+	if err != nil {
+		p.Log(logger.Warn, "failed to read metadata of %s: %v", fullPath, err)
+		return
+	}
+
+	root, _ := filepath.Abs(p.caseStore.RecordPath)
+	abs, _ := filepath.Abs(fullPath)
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return
+	}
+
+	// paused intervals are part of the time covered by the recording
+	p.caseStore.Link(m.PathName, filepath.ToSlash(rel), cases.KindRecording, m.Start, m.End())
+}
+
+// onRecordFolderRemoved is called by the record cleaner when a date folder has been removed.
+func (p *Core) onRecordFolderRemoved(folderPath string) {
+	err := p.fileIndex.RemoveDir(folderPath)
+	if err != nil {
+		p.Log(logger.Warn, "failed to remove %s from index: %v", folderPath, err)
+	}
+}
+
 func (p *Core) run() {
 	defer close(p.done)
 
@@ -289,17 +349,69 @@ func (p *Core) createResources(initial bool) error {
 		p.metrics = i
 	}
 
+	// File Index: recordings and snapshots of the record path
+	if p.fileIndex == nil {
+		i := &fileindex.Index{
+			RecordPath: p.conf.PathDefaults.RecordPath,
+			PathConfs:  p.conf.Paths,
+			Parent:     p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.fileIndex = i
+	}
+
+	// Cases: exams that group the files produced on a path
+	if p.caseStore == nil {
+		i := &cases.Store{
+			RecordPath: p.conf.PathDefaults.RecordPath,
+			Parent:     p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.caseStore = i
+	}
+
 	// Pro Record Cleaner: Use date-based folder cleanup
 	if p.recordCleaner == nil &&
 		atLeastOneRecordClearDaysAgo(p.conf.Paths) {
 		p.recordCleaner = &prorecordcleaner.Cleaner{
 			RecordPath: p.conf.PathDefaults.RecordPath,
 			PathConfs:  p.conf.Paths,
+			OnRemove:   p.onRecordFolderRemoved,
 			Parent:     p,
 		}
 		p.recordCleaner.Initialize()
 	}
 
+	// Playback Server: date-folder recordings are served by the clip exporter
+	if p.conf.Playback &&
+		p.playbackServer == nil {
+		i := &playback.Server{
+			Address:        p.conf.PlaybackAddress,
+			Encryption:     p.conf.PlaybackEncryption,
+			ServerKey:      p.conf.PlaybackServerKey,
+			ServerCert:     p.conf.PlaybackServerCert,
+			AllowOrigin:    p.conf.PlaybackAllowOrigin,
+			TrustedProxies: p.conf.PlaybackTrustedProxies,
+			ReadTimeout:    p.conf.ReadTimeout,
+			WriteTimeout:   p.conf.WriteTimeout,
+			PathConfs:      p.conf.Paths,
+			AuthManager:    p.authManager,
+			Exporter:       &clipexport.SegmentExporter{Parent: p},
+			Parent:         p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.playbackServer = i
+	}
+
 	// R-Video Server (must be initialized before pathManager)
 	if p.conf.CodecServerAddress != "" && p.rvideoServer == nil {
 		rvideoServer, err := rvideo.NewRVideoServer(p.conf.CodecServerAddress, p)
@@ -501,6 +613,20 @@ func (p *Core) createResources(initial bool) error {
 		p.webRTCServer = i
 	}
 
+	// Webhook Outbox
+	if p.webhookOutbox == nil {
+		i := &webhook.Outbox{
+			FilePath: filepath.Join(p.conf.PathDefaults.RecordPath, webhook.FileName),
+			Secret:   p.conf.PathDefaults.RecordWebhookSecret,
+			Parent:   p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.webhookOutbox = i
+	}
+
 	// Record Manager
 	if p.recordManager == nil {
 		i := &recorder.Manager{
@@ -510,6 +636,8 @@ func (p *Core) createResources(initial bool) error {
 			PathConfs:    p.conf.Paths,
 			PathDefaults: &p.conf.PathDefaults,
 			PathManager:  p.pathManager,
+			Webhooks:     p.webhookOutbox,
+			OnFileClosed: p.onRecordFileClosed,
 			Parent:       p,
 		}
 		err = i.Initialize()
@@ -522,6 +650,23 @@ func (p *Core) createResources(initial bool) error {
 		p.pathManager.recordManager = i
 	}
 
+	// Decoder Pool
+	if p.decoderPool == nil {
+		i := &decoderpool.Pool{
+			FFmpegPath:  p.conf.DecoderFFmpegPath,
+			FrameRate:   p.conf.DecoderFrameRate,
+			Width:       p.conf.DecoderWidth,
+			IdleTimeout: time.Duration(p.conf.DecoderIdleTimeout),
+			PathManager: p.pathManager,
+			Parent:      p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.decoderPool = i
+	}
+
 	// API Auth Middleware
 	if p.conf.APIAuth && p.authMiddleware == nil {
 		keys := map[string]string{
@@ -554,6 +699,10 @@ func (p *Core) createResources(initial bool) error {
 			RTMPSServer:       p.rtmpsServer,
 			WebRTCServer:      p.webRTCServer,
 			RecordManager:     p.recordManager,
+			Webhooks:          p.webhookOutbox,
+			DecoderPool:       p.decoderPool,
+			FileIndex:         p.fileIndex,
+			Cases:             p.caseStore,
 			Parent:            p,
 			APIAuthMiddleware: p.authMiddleware,
 		}
@@ -562,28 +711,52 @@ func (p *Core) createResources(initial bool) error {
 			return err
 		}
 		p.api = i
+
+		// WebSocket path events are emitted by paths
+		p.pathManager.setEventHandler(i)
+	}
+
+	// 采集设备驱动使用的账号，配置变化时直接生效
+	devicedriver.SetCredentials(p.conf.DeviceCredentials)
+
+	// Frame Detector (requires API for decoded frames)
+	if p.frameDetector == nil && p.api != nil {
+		i := &framecheck.Detector{
+			PathConfs:   p.conf.Paths,
+			PathManager: p.pathManager,
+			OnChange:    p.api.OnFrameConditionChange,
+			Parent:      p,
+		}
+		err = i.Initialize(p.api)
+		if err != nil {
+			return err
+		}
+		p.frameDetector = i
 	}
 
 	// Initialize Smart Recording (requires API for color checking)
 	if p.recordManager != nil && p.api != nil {
-		err = p.recordManager.InitializeSmartRecording(p.api)
+		err = p.recordManager.InitializeSmartRecording(p.api, p.frameDetector)
 		if err != nil {
 			return err
 		}
 	}
 
-	// Health Checker (requires API for snapshot functionality)
+	// Health Checker (requires API for its endpoints and frame detector)
 	if p.healthChecker == nil && p.api != nil {
 		i := &healthcheck.Checker{
-			PathConfs:   p.conf.Paths,
-			PathManager: p.pathManager,
-			Parent:      p,
+			PathConfs:    p.conf.Paths,
+			PathManager:  p.pathManager,
+			Frames:       p.frameDetector,
+			OnTransition: p.api.OnHealthTransition,
+			Parent:       p,
 		}
-		err = i.Initialize(p.api)
+		err = i.Initialize()
 		if err != nil {
 			return err
 		}
 		p.healthChecker = i
+		p.api.SetHealthChecker(i)
 	}
 
 	if initial && p.confPath != "" {
@@ -624,7 +797,19 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		closeAuthManager ||
 		closeLogger
 
+	closeFileIndex := newConf == nil ||
+		newConf.PathDefaults.RecordPath != p.conf.PathDefaults.RecordPath ||
+		closeLogger
+	if !closeFileIndex && p.fileIndex != nil && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
+		p.fileIndex.ReloadPathConfs(newConf.Paths)
+	}
+
+	closeCaseStore := newConf == nil ||
+		newConf.PathDefaults.RecordPath != p.conf.PathDefaults.RecordPath ||
+		closeLogger
+
 	closeRecorderCleaner := newConf == nil ||
+		closeFileIndex ||
 		atLeastOneRecordClearDaysAgo(newConf.Paths) != atLeastOneRecordClearDaysAgo(p.conf.Paths) ||
 		newConf.PathDefaults.RecordPath != p.conf.PathDefaults.RecordPath ||
 		closeLogger
@@ -632,6 +817,22 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		p.recordCleaner.ReloadPathConfs(newConf.Paths)
 	}
 
+	closePlaybackServer := newConf == nil ||
+		newConf.Playback != p.conf.Playback ||
+		newConf.PlaybackAddress != p.conf.PlaybackAddress ||
+		newConf.PlaybackEncryption != p.conf.PlaybackEncryption ||
+		newConf.PlaybackServerKey != p.conf.PlaybackServerKey ||
+		newConf.PlaybackServerCert != p.conf.PlaybackServerCert ||
+		newConf.PlaybackAllowOrigin != p.conf.PlaybackAllowOrigin ||
+		!reflect.DeepEqual(newConf.PlaybackTrustedProxies, p.conf.PlaybackTrustedProxies) ||
+		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		newConf.WriteTimeout != p.conf.WriteTimeout ||
+		closeAuthManager ||
+		closeLogger
+	if !closePlaybackServer && p.playbackServer != nil && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
+		p.playbackServer.ReloadPathConfs(newConf.Paths)
+	}
+
 	closePathManager := newConf == nil ||
 		newConf.LogLevel != p.conf.LogLevel ||
 		closeMetrics ||
@@ -659,21 +860,47 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		closePathManager ||
 		closeLogger
 
+	closeWebhookOutbox := newConf == nil ||
+		newConf.PathDefaults.RecordPath != p.conf.PathDefaults.RecordPath ||
+		closeLogger
+	if !closeWebhookOutbox && p.webhookOutbox != nil &&
+		newConf.PathDefaults.RecordWebhookSecret != p.conf.PathDefaults.RecordWebhookSecret {
+		p.webhookOutbox.SetSecret(newConf.PathDefaults.RecordWebhookSecret)
+	}
+
 	closeRecordManager := newConf == nil ||
 		closePathManager ||
+		closeFileIndex ||
+		closeCaseStore ||
+		closeWebhookOutbox ||
 		closeLogger
 	if !closeRecordManager && p.recordManager != nil && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
 		p.recordManager.ReloadPathConfs(newConf.Paths)
 	}
 
+	closeDecoderPool := newConf == nil ||
+		newConf.DecoderFFmpegPath != p.conf.DecoderFFmpegPath ||
+		newConf.DecoderFrameRate != p.conf.DecoderFrameRate ||
+		newConf.DecoderWidth != p.conf.DecoderWidth ||
+		newConf.DecoderIdleTimeout != p.conf.DecoderIdleTimeout ||
+		closePathManager ||
+		closeLogger
+
 	closeAPI := newConf == nil ||
 		newConf.API != p.conf.API ||
+		newConf.ExportWorkers != p.conf.ExportWorkers ||
+		newConf.ExportJobRetention != p.conf.ExportJobRetention ||
+		newConf.TrashRetention != p.conf.TrashRetention ||
+		newConf.DICOMAETitle != p.conf.DICOMAETitle ||
+		!reflect.DeepEqual(newConf.DICOMDestinations, p.conf.DICOMDestinations) ||
 		closeAuthManager ||
+		closeCaseStore ||
 		closePathManager ||
 		closeRTSPServer ||
 		closeRTMPServer ||
 		closeWebRTCServer ||
 		closeRecordManager ||
+		closeDecoderPool ||
 		closeLogger
 
 	closeHealthChecker := newConf == nil ||
@@ -681,7 +908,12 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		closePathManager ||
 		closeLogger
 	if !closeHealthChecker && p.healthChecker != nil && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
-		p.healthChecker.ReloadPathConfs(newConf.Paths, p.api)
+		p.healthChecker.ReloadPathConfs(newConf.Paths)
+	}
+
+	closeFrameDetector := closeHealthChecker
+	if !closeFrameDetector && p.frameDetector != nil && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
+		p.frameDetector.ReloadPathConfs(newConf.Paths)
 	}
 
 	if newConf == nil && p.confWatcher != nil {
@@ -690,12 +922,21 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 	}
 
 	if closeHealthChecker && p.healthChecker != nil {
+		if p.api != nil {
+			p.api.SetHealthChecker(nil)
+		}
 		p.healthChecker.Close()
 		p.healthChecker = nil
 	}
 
+	if closeFrameDetector && p.frameDetector != nil {
+		p.frameDetector.Close()
+		p.frameDetector = nil
+	}
+
 	if p.api != nil {
 		if closeAPI {
+			p.pathManager.setEventHandler(nil)
 			p.api.Close()
 			p.api = nil
 		} else if !calledByAPI {
@@ -703,6 +944,11 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		}
 	}
 
+	if closeDecoderPool && p.decoderPool != nil {
+		p.decoderPool.Close()
+		p.decoderPool = nil
+	}
+
 	if closeWebRTCServer && p.webRTCServer != nil {
 		p.webRTCServer.Close()
 		p.webRTCServer = nil
@@ -713,6 +959,11 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		p.recordManager = nil
 	}
 
+	if closeWebhookOutbox && p.webhookOutbox != nil {
+		p.webhookOutbox.Close()
+		p.webhookOutbox = nil
+	}
+
 	if p.rtmpsServer != nil && (closeRTMPServer || newConf == nil) {
 		p.rtmpsServer.Close()
 		p.rtmpsServer = nil
@@ -738,11 +989,25 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		p.pathManager = nil
 	}
 
+	if closePlaybackServer && p.playbackServer != nil {
+		p.playbackServer.Close()
+		p.playbackServer = nil
+	}
+
 	if closeRecorderCleaner && p.recordCleaner != nil {
 		p.recordCleaner.Close()
 		p.recordCleaner = nil
 	}
 
+	if closeCaseStore && p.caseStore != nil {
+		p.caseStore = nil
+	}
+
+	if closeFileIndex && p.fileIndex != nil {
+		p.fileIndex.Close()
+		p.fileIndex = nil
+	}
+
 	if closeMetrics && p.metrics != nil {
 		p.metrics.Close()
 		p.metrics = nil
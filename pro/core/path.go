@@ -32,6 +32,7 @@ type pathParent interface {
 	pathNotReady(*path)
 	closePath(*path)
 	AddReader(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error)
+	getEventHandler() pathEventHandler
 }
 
 type pathOnDemandState int
@@ -186,6 +187,12 @@ func (pa *path) run() {
 		}
 	}
 
+	if pa.source != nil {
+		pa.emitEvent(func(h pathEventHandler) {
+			h.OnPathPublisherJoin(pa.name, pa.source.APISourceDescribe())
+		})
+	}
+
 	onUnInitHook := hooks.OnInit(hooks.OnInitParams{
 		Logger:          pa,
 		ExternalCmdPool: pa.externalCmdPool,
@@ -220,6 +227,10 @@ func (pa *path) run() {
 	}
 
 	if pa.source != nil {
+		pa.emitEvent(func(h pathEventHandler) {
+			h.OnPathPublisherLeave(pa.name, pa.source.APISourceDescribe())
+		})
+
 		if source, ok := pa.source.(*staticsources.Handler); ok {
 			if !pa.conf.SourceOnDemand || pa.onDemandStaticSourceState != pathOnDemandStateInitial {
 				source.Close("path is closing")
@@ -475,8 +486,15 @@ func (pa *path) doAddPublisher(req defs.PathAddPublisherReq) {
 	pa.source = req.Author
 	pa.publisherQuery = req.AccessRequest.Query
 
+	pa.emitEvent(func(h pathEventHandler) {
+		h.OnPathPublisherJoin(pa.name, req.Author.APISourceDescribe())
+	})
+
 	err := pa.setReady(req.Desc, req.GenerateRTPPackets, req.FillNTP)
 	if err != nil {
+		pa.emitEvent(func(h pathEventHandler) {
+			h.OnPathPublisherLeave(pa.name, req.Author.APISourceDescribe())
+		})
 		pa.source = nil
 		req.Res <- defs.PathAddPublisherRes{Err: err}
 		return
@@ -692,6 +710,7 @@ func (pa *path) setReady(desc *description.Session, generateRTPPackets bool, fil
 		Desc:               desc,
 		GenerateRTPPackets: generateRTPPackets,
 		FillNTP:            fillNTP,
+		CacheKeyFrames:     pa.conf.KeyFrameCache,
 		Parent:             pa.source,
 	}
 	err := pa.stream.Initialize()
@@ -717,6 +736,10 @@ func (pa *path) setReady(desc *description.Session, generateRTPPackets bool, fil
 
 	pa.parent.pathReady(pa)
 
+	pa.emitEvent(func(h pathEventHandler) {
+		h.OnPathReady(pa.name, pa.source.APISourceDescribe(), pa.readyTime, defs.MediasToCodecs(desc.Medias))
+	})
+
 	return nil
 }
 
@@ -742,6 +765,10 @@ func (pa *path) setNotReady() {
 		r.Close()
 	}
 
+	pa.emitEvent(func(h pathEventHandler) {
+		h.OnPathNotReady(pa.name)
+	})
+
 	pa.onNotReadyHook()
 
 	// Pro 版本使用 pro/recorder 管理器进行录制，禁用内置录制器
@@ -801,6 +828,10 @@ func (pa *path) startRecording() {
 
 func (pa *path) executeRemoveReader(r defs.Reader) {
 	delete(pa.readers, r)
+
+	pa.emitEvent(func(h pathEventHandler) {
+		h.OnPathReaderLeave(pa.name, r.APIReaderDescribe())
+	})
 }
 
 func (pa *path) executeRemovePublisher() {
@@ -808,9 +839,22 @@ func (pa *path) executeRemovePublisher() {
 		pa.setNotReady()
 	}
 
+	if pa.source != nil {
+		pa.emitEvent(func(h pathEventHandler) {
+			h.OnPathPublisherLeave(pa.name, pa.source.APISourceDescribe())
+		})
+	}
+
 	pa.source = nil
 }
 
+// emitEvent notifies the event handler of the path manager, if any, of a change in the lifecycle of the path.
+func (pa *path) emitEvent(cb func(h pathEventHandler)) {
+	if h := pa.parent.getEventHandler(); h != nil {
+		cb(h)
+	}
+}
+
 func (pa *path) addReaderPost(req defs.PathAddReaderReq) {
 	if _, ok := pa.readers[req.Author]; ok {
 		req.Res <- defs.PathAddReaderRes{
@@ -827,6 +871,10 @@ func (pa *path) addReaderPost(req defs.PathAddReaderReq) {
 
 	pa.readers[req.Author] = struct{}{}
 
+	pa.emitEvent(func(h pathEventHandler) {
+		h.OnPathReaderJoin(pa.name, req.Author.APIReaderDescribe())
+	})
+
 	if pa.conf.HasOnDemandStaticSource() {
 		if pa.onDemandStaticSourceState == pathOnDemandStateClosing {
 			pa.onDemandStaticSourceState = pathOnDemandStateReady
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/bluenviron/mediamtx/internal/auth"
 	"github.com/bluenviron/mediamtx/internal/conf"
@@ -73,6 +74,17 @@ type pathRecordManager interface {
 	OnPathNotReady(pathName string)
 }
 
+// pathEventHandler receives the changes in the lifecycle of paths (Pro API WebSocket events).
+// Methods are called by the goroutines of paths and must not block.
+type pathEventHandler interface {
+	OnPathPublisherJoin(pathName string, source defs.APIPathSourceOrReader)
+	OnPathPublisherLeave(pathName string, source defs.APIPathSourceOrReader)
+	OnPathReady(pathName string, source defs.APIPathSourceOrReader, readyTime time.Time, tracks []string)
+	OnPathNotReady(pathName string)
+	OnPathReaderJoin(pathName string, reader defs.APIPathSourceOrReader)
+	OnPathReaderLeave(pathName string, reader defs.APIPathSourceOrReader)
+}
+
 type pathManager struct {
 	logLevel          conf.LogLevel
 	authManager       *auth.Manager
@@ -87,6 +99,9 @@ type pathManager struct {
 	parent            pathManagerParent
 	recordManager     pathRecordManager // Pro recorder manager for pathNotReady callback
 
+	eventMutex   sync.Mutex
+	eventHandler pathEventHandler
+
 	ctx       context.Context
 	ctxCancel func()
 	wg        sync.WaitGroup
@@ -693,3 +708,19 @@ func (pm *pathManager) RestartVideoSnapshot(pathName string) error {
 		return fmt.Errorf("terminated")
 	}
 }
+
+// setEventHandler sets the handler that receives the changes in the lifecycle of paths.
+func (pm *pathManager) setEventHandler(h pathEventHandler) {
+	pm.eventMutex.Lock()
+	defer pm.eventMutex.Unlock()
+
+	pm.eventHandler = h
+}
+
+// getEventHandler is called by path.
+func (pm *pathManager) getEventHandler() pathEventHandler {
+	pm.eventMutex.Lock()
+	defer pm.eventMutex.Unlock()
+
+	return pm.eventHandler
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/pro/recordrepair"
+)
+
+// files written recently may belong to a recording of a running server.
+const repairActiveThreshold = 30 * time.Second
+
+// repairLogger writes logs to the standard error, since the standard output contains the report.
+type repairLogger struct{}
+
+// Log implements logger.Writer.
+func (repairLogger) Log(level logger.Level, format string, args ...interface{}) {
+	var prefix string
+	switch level {
+	case logger.Debug:
+		return
+	case logger.Info:
+		prefix = "INF"
+	case logger.Warn:
+		prefix = "WAR"
+	default:
+		prefix = "ERR"
+	}
+
+	fmt.Fprintf(os.Stderr, "%s %s "+format+"\n",
+		append([]interface{}{time.Now().Format("2006/01/02 15:04:05"), prefix}, args...)...)
+}
+
+// runRepair runs the repair subcommand:
+//
+//	mediamtx repair [-date YYYYMMDD] [-dry-run] [config path]
+//
+// It repairs the recordings left truncated by a crash and prints the report as JSON.
+func runRepair(args []string) bool {
+	fs := flag.NewFlagSet("repair", flag.ContinueOnError)
+	date := fs.String("date", "", "limit the scan to a date folder (YYYYMMDD)")
+	dryRun := fs.Bool("dry-run", false, "only report, don't modify files")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return false
+	}
+
+	confPath := ""
+	if fs.NArg() > 0 {
+		confPath = fs.Arg(0)
+	}
+
+	l := repairLogger{}
+
+	confPaths := append([]string(nil), defaultConfPaths...)
+	if runtime.GOOS != "windows" {
+		confPaths = append(confPaths, defaultConfPathsNotWin...)
+	}
+
+	cnf, _, err := conf.Load(confPath, confPaths, l)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		return false
+	}
+
+	repairer := &recordrepair.Repairer{
+		RecordPath: cnf.PathDefaults.RecordPath,
+		Date:       *date,
+		DryRun:     *dryRun,
+		IsActive: func(fullPath string) bool {
+			info, err := os.Stat(fullPath)
+			return err == nil && time.Since(info.ModTime()) < repairActiveThreshold
+		},
+		Parent: l,
+	}
+
+	report, err := repairer.Run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERR: %s\n", err)
+		return false
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report) //nolint:errcheck
+
+	return report.Failed == 0
+}
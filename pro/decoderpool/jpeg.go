@@ -0,0 +1,189 @@
+package decoderpool
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxFrameSize is the maximum size of a JPEG frame produced by FFmpeg.
+const maxFrameSize = 32 * 1024 * 1024
+
+const (
+	markerSOI = 0xD8
+	markerEOI = 0xD9
+	markerSOS = 0xDA
+	markerTEM = 0x01
+)
+
+func isRSTMarker(m byte) bool {
+	return m >= 0xD0 && m <= 0xD7
+}
+
+// readJPEGs reads concatenated JPEG images (the output of the image2pipe muxer)
+// and calls cb for each of them. It returns when the reader returns an error or EOF.
+func readJPEGs(r io.Reader, cb func([]byte)) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	for {
+		frame, err := readJPEG(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		cb(frame)
+	}
+}
+
+// readJPEG reads a single JPEG image.
+// Segments are followed by using their length, since their payload can contain any byte;
+// after the start of scan, the entropy-coded data is scanned until the next marker.
+func readJPEG(br *bufio.Reader) ([]byte, error) {
+	err := skipToSOI(br)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := []byte{0xFF, markerSOI}
+
+	m, err := readMarker(br)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	for {
+		buf = append(buf, 0xFF, m)
+
+		if m == markerEOI {
+			return buf, nil
+		}
+
+		if m == markerSOI {
+			return nil, fmt.Errorf("unexpected start of image")
+		}
+
+		if isRSTMarker(m) || m == markerTEM {
+			m, err = readMarker(br)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			continue
+		}
+
+		var l [2]byte
+		_, err = io.ReadFull(br, l[:])
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		le := int(l[0])<<8 | int(l[1])
+		if le < 2 {
+			return nil, fmt.Errorf("invalid segment length")
+		}
+		if len(buf)+le > maxFrameSize {
+			return nil, fmt.Errorf("frame is too big")
+		}
+
+		buf = append(buf, l[:]...)
+		start := len(buf)
+		buf = append(buf, make([]byte, le-2)...)
+		_, err = io.ReadFull(br, buf[start:])
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		if m != markerSOS {
+			m, err = readMarker(br)
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			continue
+		}
+
+		buf, m, err = readEntropyCodedData(br, buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readEntropyCodedData appends entropy-coded data to buf and returns the marker that follows it.
+// Stuffed bytes (FF 00) and restart markers are part of the data.
+func readEntropyCodedData(br *bufio.Reader, buf []byte) ([]byte, byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, 0, unexpectedEOF(err)
+		}
+
+		if b != 0xFF {
+			buf = append(buf, b)
+			if len(buf) > maxFrameSize {
+				return nil, 0, fmt.Errorf("frame is too big")
+			}
+			continue
+		}
+
+		// fill bytes
+		for b == 0xFF {
+			b, err = br.ReadByte()
+			if err != nil {
+				return nil, 0, unexpectedEOF(err)
+			}
+		}
+
+		if b == 0x00 || isRSTMarker(b) {
+			buf = append(buf, 0xFF, b)
+			continue
+		}
+
+		return buf, b, nil
+	}
+}
+
+// skipToSOI discards bytes until a start of image marker.
+func skipToSOI(br *bufio.Reader) error {
+	prevFF := false
+
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		if prevFF && b == markerSOI {
+			return nil
+		}
+		prevFF = (b == 0xFF)
+	}
+}
+
+// readMarker reads a marker, skipping fill bytes.
+func readMarker(br *bufio.Reader) (byte, error) {
+	b, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xFF {
+		return 0, fmt.Errorf("marker expected, got 0x%02x", b)
+	}
+
+	for b == 0xFF {
+		b, err = br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return b, nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
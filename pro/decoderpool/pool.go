@@ -0,0 +1,209 @@
+// Package decoderpool contains long-lived FFmpeg decoders that turn H264/H265 streams into JPEG frames.
+package decoderpool
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	defaultFFmpegPath  = "ffmpeg"
+	defaultFrameRate   = 5
+	defaultIdleTimeout = 60 * time.Second
+
+	// reapInterval is the interval between checks of idle workers.
+	reapInterval = 5 * time.Second
+)
+
+// ErrUnsupportedCodec is returned when a path doesn't contain a H264 or H265 track.
+var ErrUnsupportedCodec = errors.New("no H264 or H265 track found")
+
+// errPoolClosed is returned when the pool is closed while waiting for a frame.
+var errPoolClosed = errors.New("decoder pool is closed")
+
+// WorkerInfo describes a running worker.
+type WorkerInfo struct {
+	PathName    string     `json:"pathName"`
+	Codec       string     `json:"codec"`
+	StartedAt   time.Time  `json:"startedAt"`
+	LastFrameAt *time.Time `json:"lastFrameAt,omitempty"`
+	Frames      uint64     `json:"frames"`
+	Subscribers int        `json:"subscribers"`
+}
+
+// Pool is a set of decoder workers, one per path.
+// A worker is started when a frame of a path is requested for the first time
+// and is closed when nobody requests frames for IdleTimeout.
+type Pool struct {
+	FFmpegPath  string        // defaults to "ffmpeg"
+	FrameRate   int           // frames per second produced by workers, defaults to 5
+	Width       int           // width of frames, 0 keeps the width of the stream
+	IdleTimeout time.Duration // defaults to 60s
+	PathManager defs.APIPathManager
+	Parent      logger.Writer
+
+	mutex     sync.Mutex
+	workers   map[string]*worker
+	wg        sync.WaitGroup
+	terminate chan struct{}
+	done      chan struct{}
+}
+
+// Initialize initializes the Pool.
+func (p *Pool) Initialize() error {
+	if p.FFmpegPath == "" {
+		p.FFmpegPath = defaultFFmpegPath
+	}
+	if p.FrameRate <= 0 {
+		p.FrameRate = defaultFrameRate
+	}
+	if p.IdleTimeout <= 0 {
+		p.IdleTimeout = defaultIdleTimeout
+	}
+
+	p.workers = make(map[string]*worker)
+	p.terminate = make(chan struct{})
+	p.done = make(chan struct{})
+
+	go p.run()
+
+	return nil
+}
+
+// Close closes the Pool and all workers.
+func (p *Pool) Close() {
+	close(p.terminate)
+	<-p.done
+
+	p.mutex.Lock()
+	for _, w := range p.workers {
+		w.close()
+	}
+	p.mutex.Unlock()
+
+	p.wg.Wait()
+}
+
+// Log implements logger.Writer.
+func (p *Pool) Log(level logger.Level, format string, args ...interface{}) {
+	p.Parent.Log(level, "[decoder pool] "+format, args...)
+}
+
+func (p *Pool) run() {
+	defer close(p.done)
+
+	t := time.NewTicker(reapInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			p.reapIdle()
+
+		case <-p.terminate:
+			return
+		}
+	}
+}
+
+// reapIdle closes workers that have no subscribers and haven't been used for IdleTimeout.
+func (p *Pool) reapIdle() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, w := range p.workers {
+		if w.idleSince(time.Now()) >= p.IdleTimeout {
+			w.Log(logger.Info, "closing idle worker")
+			w.close()
+		}
+	}
+}
+
+// worker returns the worker of a path, starting it when needed.
+func (p *Pool) worker(pathName string) (*worker, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	select {
+	case <-p.terminate:
+		return nil, errPoolClosed
+	default:
+	}
+
+	if w, ok := p.workers[pathName]; ok {
+		return w, nil
+	}
+
+	w := &worker{
+		pool:     p,
+		pathName: pathName,
+	}
+	w.initialize()
+	p.workers[pathName] = w
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		w.run()
+		p.onWorkerDone(w)
+	}()
+
+	return w, nil
+}
+
+func (p *Pool) onWorkerDone(w *worker) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.workers[w.pathName] == w {
+		delete(p.workers, w.pathName)
+	}
+}
+
+// Snapshot returns the latest frame of a path, encoded in JPEG.
+// When the worker of the path has just been started, it waits for the first decoded frame.
+func (p *Pool) Snapshot(ctx context.Context, pathName string) ([]byte, error) {
+	w, err := p.worker(pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.snapshot(ctx)
+}
+
+// Subscribe returns a subscription that receives the frames of a path, encoded in JPEG.
+func (p *Pool) Subscribe(pathName string) (*Subscription, error) {
+	w, err := p.worker(pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.subscribe(), nil
+}
+
+// Workers returns the running workers, sorted by path name.
+func (p *Pool) Workers() []WorkerInfo {
+	p.mutex.Lock()
+	workers := make([]*worker, 0, len(p.workers))
+	for _, w := range p.workers {
+		workers = append(workers, w)
+	}
+	p.mutex.Unlock()
+
+	ret := make([]WorkerInfo, 0, len(workers))
+	for _, w := range workers {
+		ret = append(ret, w.info())
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].PathName < ret[j].PathName
+	})
+
+	return ret
+}
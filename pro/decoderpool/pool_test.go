@@ -0,0 +1,140 @@
+package decoderpool
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+type nilLogger struct{}
+
+func (nilLogger) Log(_ logger.Level, _ string, _ ...interface{}) {}
+
+func testJPEG(t *testing.T, c uint8) []byte {
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = c + uint8(i)
+	}
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+// withComment inserts a comment segment, containing an EOI marker, after the SOI marker.
+func withComment(frame []byte) []byte {
+	com := []byte{0xFF, 0xFE, 0x00, 0x06, 0xFF, 0xD9, 0xFF, 0xD8}
+	ret := append([]byte{}, frame[:2]...)
+	ret = append(ret, com...)
+	return append(ret, frame[2:]...)
+}
+
+func TestReadJPEGs(t *testing.T) {
+	frame1 := testJPEG(t, 10)
+	frame2 := withComment(testJPEG(t, 200))
+
+	var stream []byte
+	stream = append(stream, 0x00, 0x01) // garbage before the first frame
+	stream = append(stream, frame1...)
+	stream = append(stream, frame2...)
+
+	var frames [][]byte
+	err := readJPEGs(bytes.NewReader(stream), func(f []byte) {
+		frames = append(frames, f)
+	})
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{frame1, frame2}, frames)
+
+	img, err := jpeg.Decode(bytes.NewReader(frames[1]))
+	require.NoError(t, err)
+	require.Equal(t, color.Gray{Y: 200}, color.GrayModel.Convert(img.At(0, 0)).(color.Gray))
+}
+
+func TestReadJPEGsTruncated(t *testing.T) {
+	frame := testJPEG(t, 10)
+
+	var frames [][]byte
+	err := readJPEGs(bytes.NewReader(append(frame, frame[:len(frame)/2]...)), func(f []byte) {
+		frames = append(frames, f)
+	})
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Len(t, frames, 1)
+}
+
+func TestFFmpegArgs(t *testing.T) {
+	args := ffmpegArgs("hevc", 2, 640)
+	require.Contains(t, args, "fps=2,scale=640:-2")
+	require.Contains(t, strings.Join(args, " "), "-f hevc -i pipe:0")
+
+	args = ffmpegArgs("h264", 5, 0)
+	require.Contains(t, args, "fps=5")
+}
+
+func testPool(t *testing.T) *Pool {
+	p := &Pool{
+		IdleTimeout: time.Minute,
+		Parent:      nilLogger{},
+	}
+	err := p.Initialize()
+	require.NoError(t, err)
+	return p
+}
+
+func TestSubscription(t *testing.T) {
+	p := testPool(t)
+	defer p.Close()
+
+	w := &worker{pool: p, pathName: "cam1"}
+	w.initialize()
+
+	w.onFrame([]byte{1})
+
+	s := w.subscribe()
+	require.Equal(t, []byte{1}, <-s.Frames())
+
+	// frames that are not read are replaced by newer ones
+	w.onFrame([]byte{2})
+	w.onFrame([]byte{3})
+	require.Equal(t, []byte{3}, <-s.Frames())
+
+	buf, err := w.snapshot(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, []byte{3}, buf)
+
+	require.Equal(t, time.Duration(0), w.idleSince(time.Now().Add(time.Hour)))
+	s.Close()
+	require.NotEqual(t, time.Duration(0), w.idleSince(time.Now().Add(time.Hour)))
+}
+
+func TestReapIdle(t *testing.T) {
+	p := testPool(t)
+	defer p.Close()
+
+	busy := &worker{pool: p, pathName: "busy"}
+	busy.initialize()
+	busy.subscribe()
+
+	idle := &worker{pool: p, pathName: "idle"}
+	idle.initialize()
+	idle.lastUse = time.Now().Add(-2 * time.Minute)
+
+	p.mutex.Lock()
+	p.workers["busy"] = busy
+	p.workers["idle"] = idle
+	p.mutex.Unlock()
+
+	p.reapIdle()
+
+	require.Error(t, idle.ctx.Err())
+	require.NoError(t, busy.ctx.Err())
+}
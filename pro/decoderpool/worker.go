@@ -0,0 +1,531 @@
+package decoderpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+const (
+	// inputQueueSize is the number of access units waiting to be written to FFmpeg.
+	inputQueueSize = 128
+
+	// stderrSize is the amount of FFmpeg output kept for error messages.
+	stderrSize = 2048
+)
+
+// errWorkerClosed is returned to readers of a worker that has been closed.
+var errWorkerClosed = errors.New("decoder worker closed")
+
+// track is the video track decoded by a worker.
+type track struct {
+	media       *description.Media
+	format      format.Format
+	codec       string
+	inputFormat string // FFmpeg demuxer
+
+	// accessUnit returns the access unit of a unit and whether it is a random access point.
+	// Parameters are prepended to random access points, in order to allow decoding to start from them.
+	accessUnit func(u *unit.Unit) ([][]byte, bool)
+}
+
+func findTrack(st *stream.Stream) *track {
+	for _, media := range st.Desc.Medias {
+		for _, forma := range media.Formats {
+			switch forma := forma.(type) {
+			case *format.H264:
+				return &track{
+					media:       media,
+					format:      forma,
+					codec:       "H264",
+					inputFormat: "h264",
+					accessUnit: func(u *unit.Unit) ([][]byte, bool) {
+						au, ok := u.Payload.(unit.PayloadH264)
+						if !ok || au == nil {
+							return nil, false
+						}
+						if !h264.IsRandomAccess(au) {
+							return au, false
+						}
+						sps, pps := forma.SafeParams()
+						return prependParams(au, sps, pps), true
+					},
+				}
+
+			case *format.H265:
+				return &track{
+					media:       media,
+					format:      forma,
+					codec:       "H265",
+					inputFormat: "hevc",
+					accessUnit: func(u *unit.Unit) ([][]byte, bool) {
+						au, ok := u.Payload.(unit.PayloadH265)
+						if !ok || au == nil {
+							return nil, false
+						}
+						if !h265.IsRandomAccess(au) {
+							return au, false
+						}
+						vps, sps, pps := forma.SafeParams()
+						return prependParams(au, vps, sps, pps), true
+					},
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func prependParams(au [][]byte, params ...[]byte) [][]byte {
+	ret := make([][]byte, 0, len(params)+len(au))
+	for _, p := range params {
+		if p != nil {
+			ret = append(ret, p)
+		}
+	}
+	return append(ret, au...)
+}
+
+// ffmpegArgs returns the arguments of a FFmpeg process that reads an Annex-B stream from stdin
+// and writes JPEG images to stdout.
+func ffmpegArgs(inputFormat string, frameRate int, width int) []string {
+	filter := "fps=" + strconv.Itoa(frameRate)
+	if width > 0 {
+		// height is computed from the aspect ratio and rounded to an even value
+		filter += ",scale=" + strconv.Itoa(width) + ":-2"
+	}
+
+	return []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-nostdin",
+		// timestamps are assigned on arrival, since raw streams don't contain them
+		"-use_wallclock_as_timestamps", "1",
+		"-fflags", "nobuffer",
+		"-flags", "low_delay",
+		"-probesize", "32768",
+		"-analyzeduration", "0",
+		"-f", inputFormat,
+		"-i", "pipe:0",
+		"-an",
+		"-vf", filter,
+		"-c:v", "mjpeg",
+		"-q:v", "4",
+		"-f", "image2pipe",
+		"pipe:1",
+	}
+}
+
+// tailBuffer keeps the last bytes written to it.
+type tailBuffer struct {
+	mutex sync.Mutex
+	buf   []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > stderrSize {
+		b.buf = b.buf[len(b.buf)-stderrSize:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return strings.TrimSpace(string(b.buf))
+}
+
+// Subscription receives the frames of a worker.
+type Subscription struct {
+	w      *worker
+	frames chan []byte
+	once   sync.Once
+}
+
+// Frames returns a channel that receives JPEG frames.
+// Frames are dropped when the receiver is slower than the worker.
+func (s *Subscription) Frames() <-chan []byte {
+	return s.frames
+}
+
+// Done returns a channel that is closed when the worker stops.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.w.done
+}
+
+// Err returns the reason why the worker stopped.
+func (s *Subscription) Err() error {
+	return s.w.error()
+}
+
+// Close closes the subscription.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.w.unsubscribe(s)
+	})
+}
+
+// worker decodes the video track of a path with a FFmpeg process.
+type worker struct {
+	pool     *Pool
+	pathName string
+
+	ctx        context.Context
+	ctxCancel  func()
+	startedAt  time.Time
+	firstFrame chan struct{}
+	done       chan struct{}
+
+	mutex       sync.Mutex
+	codec       string
+	lastFrame   []byte
+	lastFrameAt time.Time
+	frames      uint64
+	lastUse     time.Time
+	subscribers map[*Subscription]struct{}
+	err         error
+}
+
+func (w *worker) initialize() {
+	w.ctx, w.ctxCancel = context.WithCancel(context.Background())
+	w.startedAt = time.Now()
+	w.lastUse = w.startedAt
+	w.firstFrame = make(chan struct{})
+	w.done = make(chan struct{})
+	w.subscribers = make(map[*Subscription]struct{})
+}
+
+// Close implements defs.Reader. It is called by the path when the stream is closed.
+func (w *worker) Close() {
+	w.close()
+}
+
+func (w *worker) close() {
+	w.ctxCancel()
+}
+
+// APIReaderDescribe implements defs.Reader.
+func (w *worker) APIReaderDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "proDecoderWorker",
+		ID:   w.pathName,
+	}
+}
+
+// Log implements logger.Writer.
+func (w *worker) Log(level logger.Level, format string, args ...interface{}) {
+	w.pool.Log(level, "[path %s] "+format, append([]interface{}{w.pathName}, args...)...)
+}
+
+func (w *worker) error() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.err
+}
+
+func (w *worker) idleSince(now time.Time) time.Duration {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.subscribers) != 0 {
+		return 0
+	}
+	return now.Sub(w.lastUse)
+}
+
+func (w *worker) touch() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.lastUse = time.Now()
+}
+
+func (w *worker) snapshot(ctx context.Context) ([]byte, error) {
+	w.touch()
+
+	select {
+	case <-w.firstFrame:
+	case <-w.done:
+		return nil, w.error()
+	case <-ctx.Done():
+		return nil, fmt.Errorf("timeout waiting for the first frame")
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.lastFrame, nil
+}
+
+func (w *worker) subscribe() *Subscription {
+	s := &Subscription{
+		w:      w,
+		frames: make(chan []byte, 1),
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.subscribers[s] = struct{}{}
+
+	// the latest frame is sent immediately
+	if w.lastFrame != nil {
+		s.frames <- w.lastFrame
+	}
+
+	return s
+}
+
+func (w *worker) unsubscribe(s *Subscription) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	delete(w.subscribers, s)
+	w.lastUse = time.Now()
+}
+
+func (w *worker) info() WorkerInfo {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	info := WorkerInfo{
+		PathName:    w.pathName,
+		Codec:       w.codec,
+		StartedAt:   w.startedAt,
+		Frames:      w.frames,
+		Subscribers: len(w.subscribers),
+	}
+	if !w.lastFrameAt.IsZero() {
+		t := w.lastFrameAt
+		info.LastFrameAt = &t
+	}
+	return info
+}
+
+func (w *worker) onFrame(frame []byte) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.lastFrame = frame
+	w.lastFrameAt = time.Now()
+	w.frames++
+
+	if w.frames == 1 {
+		close(w.firstFrame)
+	}
+
+	for s := range w.subscribers {
+		// replace the frame that has not been read yet
+		select {
+		case <-s.frames:
+		default:
+		}
+		s.frames <- frame
+	}
+}
+
+func (w *worker) run() {
+	defer close(w.done)
+
+	w.Log(logger.Info, "started")
+
+	err := w.runInner()
+
+	w.mutex.Lock()
+	if err == nil {
+		err = errWorkerClosed
+	}
+	w.err = err
+	w.mutex.Unlock()
+
+	if errors.Is(err, errWorkerClosed) {
+		w.Log(logger.Info, "stopped")
+	} else {
+		w.Log(logger.Warn, "stopped: %v", err)
+	}
+}
+
+func (w *worker) runInner() error {
+	defer w.ctxCancel()
+
+	path, st, err := w.pool.PathManager.AddReader(defs.PathAddReaderReq{
+		Author: w,
+		AccessRequest: defs.PathAccessRequest{
+			Name:     w.pathName,
+			SkipAuth: true,
+			IP:       net.IPv4(127, 0, 0, 1),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add reader: %w", err)
+	}
+	defer path.RemoveReader(defs.PathRemoveReaderReq{Author: w})
+
+	if st == nil {
+		return errors.New("no stream available")
+	}
+
+	tr := findTrack(st)
+	if tr == nil {
+		return ErrUnsupportedCodec
+	}
+
+	w.mutex.Lock()
+	w.codec = tr.codec
+	w.mutex.Unlock()
+
+	cmd := exec.CommandContext(w.ctx, w.pool.FFmpegPath, ffmpegArgs(tr.inputFormat, w.pool.FrameRate, w.pool.Width)...)
+
+	stderr := &tailBuffer{}
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start FFmpeg: %w", err)
+	}
+
+	input := make(chan []byte, inputQueueSize)
+	writeErr := make(chan error, 1)
+	readErr := make(chan error, 1)
+
+	go func() {
+		writeErr <- writeInput(w.ctx, stdin, input)
+	}()
+
+	go func() {
+		readErr <- readJPEGs(stdout, w.onFrame)
+	}()
+
+	// when the path caches key frames, decoding starts immediately
+	reader := &stream.Reader{
+		SkipBytesSent:     true,
+		Parent:            w,
+		StartFromKeyFrame: true,
+	}
+
+	waitRandomAccess := true
+
+	reader.OnData(tr.media, tr.format, func(u *unit.Unit) error {
+		au, randomAccess := tr.accessUnit(u)
+		if au == nil {
+			return nil
+		}
+
+		// decoding starts from a random access point
+		if waitRandomAccess {
+			if !randomAccess {
+				return nil
+			}
+			waitRandomAccess = false
+		}
+
+		buf, err2 := h264.AnnexB(au).Marshal()
+		if err2 != nil {
+			return err2
+		}
+
+		select {
+		case input <- buf:
+		default:
+			// FFmpeg is too slow: the access unit is dropped
+			// and decoding restarts from the next random access point.
+			waitRandomAccess = true
+		}
+
+		return nil
+	})
+
+	st.AddReader(reader)
+
+	w.Log(logger.Info, "decoding %s at %d fps", tr.codec, w.pool.FrameRate)
+
+	readDone := false
+
+	select {
+	case err = <-reader.Error():
+		err = fmt.Errorf("stream error: %w", err)
+
+	case err = <-writeErr:
+
+	case err = <-readErr:
+		readDone = true
+		if err == nil {
+			err = errors.New("FFmpeg exited")
+		}
+
+	case <-w.ctx.Done():
+	}
+
+	// the worker has been closed, errors are caused by the termination of FFmpeg
+	if w.ctx.Err() != nil {
+		err = nil
+	}
+
+	st.RemoveReader(reader)
+	w.ctxCancel()
+	stdin.Close()
+
+	// stdout must be read until the end before calling Wait()
+	if !readDone {
+		<-readErr
+	}
+	cmd.Wait() //nolint:errcheck
+
+	// FFmpeg output explains why it exited
+	if err != nil {
+		if msg := stderr.String(); msg != "" {
+			err = fmt.Errorf("%w (%s)", err, msg)
+		}
+	}
+
+	return err
+}
+
+// writeInput writes access units to the standard input of FFmpeg.
+func writeInput(ctx context.Context, stdin io.Writer, input chan []byte) error {
+	for {
+		select {
+		case buf := <-input:
+			_, err := stdin.Write(buf)
+			if err != nil {
+				return fmt.Errorf("failed to write to FFmpeg: %w", err)
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
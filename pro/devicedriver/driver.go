@@ -0,0 +1,204 @@
+// Package devicedriver contains the drivers of capture devices,
+// selected by the 'deviceType' of paths.
+package devicedriver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+// ErrNotSupported is returned by drivers when an operation is not supported by the device.
+var ErrNotSupported = errors.New("operation not supported by the device")
+
+// ErrNoCredentials is returned by drivers when an operation needs an account
+// and none is configured, neither in the path nor in deviceCredentials.
+var ErrNoCredentials = errors.New("no credentials configured for the device")
+
+// Driver controls a model of capture device through its HTTP interface.
+type Driver interface {
+	// Snapshot returns a JPEG image of the input of the device.
+	Snapshot(ctx context.Context, dev *Device) ([]byte, error)
+
+	// InputStatus returns the number of inputs with a signal.
+	InputStatus(ctx context.Context, dev *Device) (int, error)
+
+	// Reboot restarts the device.
+	Reboot(ctx context.Context, dev *Device) error
+
+	// Info returns the description of the device.
+	Info(ctx context.Context, dev *Device) (*Info, error)
+}
+
+// Device is a capture device that is the source of a path.
+type Device struct {
+	Type       string
+	Host       string // address of the HTTP interface, with an optional port
+	StreamPath string // last element of the path of the source URL
+	StreamName string // encoder channel, e.g. stream0
+	Username   string // from the path configuration, see Credentials()
+	Password   string
+}
+
+// Credentials returns the account of the device, taken from the path configuration
+// or from the credential store. It returns false when the account is not configured.
+func (d *Device) Credentials() (string, string, bool) {
+	if d.Username != "" {
+		return d.Username, d.Password, true
+	}
+
+	if c, ok := findCredential(d.Host); ok {
+		return c.Username, c.Password, true
+	}
+
+	return "", "", false
+}
+
+// Input is an input of a device.
+type Input struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+}
+
+// Info is the description of a device.
+type Info struct {
+	Type   string  `json:"type"`
+	Host   string  `json:"host"`
+	Stream string  `json:"stream"`
+	Inputs []Input `json:"inputs"` // nil when the device doesn't report its inputs
+}
+
+var (
+	mutex       sync.RWMutex
+	drivers     = make(map[string]Driver) // key: device type
+	credentials conf.DeviceCredentials
+)
+
+// Register makes a driver available for a device type.
+// It panics when the device type is already registered.
+func Register(deviceType string, drv Driver) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if _, ok := drivers[deviceType]; ok {
+		panic(fmt.Sprintf("device type '%s' is already registered", deviceType))
+	}
+	drivers[deviceType] = drv
+}
+
+// Get returns the driver of a device type.
+func Get(deviceType string) (Driver, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	drv, ok := drivers[deviceType]
+	return drv, ok
+}
+
+// Types returns the registered device types, sorted by name.
+func Types() []string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	ret := make([]string, 0, len(drivers))
+	for t := range drivers {
+		ret = append(ret, t)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// SetCredentials sets the credential store, used for devices without
+// 'deviceUsername' in the path configuration.
+func SetCredentials(c conf.DeviceCredentials) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	credentials = c
+}
+
+func findCredential(host string) (conf.DeviceCredential, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	if c, ok := credentials.Find(host); ok {
+		return c, true
+	}
+
+	// credentials can be stored without the port
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		return credentials.Find(host[:i])
+	}
+
+	return conf.DeviceCredential{}, false
+}
+
+// Detect returns the device type of a path.
+// When 'deviceType' is empty, the type is guessed from the source URL,
+// like snapshots have always done: sources ending with /0 or containing v=0
+// are HTTP JPEG devices, other sources are network capture devices.
+func Detect(pathConf *conf.Path) string {
+	if pathConf.DeviceType != "" {
+		return pathConf.DeviceType
+	}
+
+	streamPath := path.Base(strings.SplitN(pathConf.Source, "?", 2)[0])
+	if streamPath == "0" || strings.Contains(pathConf.Source, "v=0") {
+		return TypeHTTPJPEG
+	}
+	return TypeNetworkCapture
+}
+
+// Open returns the driver of a device type and the device that is the source of a path.
+func Open(deviceType string, pathConf *conf.Path) (Driver, *Device, error) {
+	drv, ok := Get(deviceType)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown device type: '%s'", deviceType)
+	}
+
+	dev, err := newDevice(deviceType, pathConf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return drv, dev, nil
+}
+
+func newDevice(deviceType string, pathConf *conf.Path) (*Device, error) {
+	dev := &Device{
+		Type:     deviceType,
+		Host:     pathConf.DeviceHost,
+		Username: pathConf.DeviceUsername,
+		Password: pathConf.DevicePassword,
+	}
+
+	u, err := url.Parse(pathConf.Source)
+	if err == nil {
+		if dev.Host == "" {
+			// the port of the source is the one of the stream, not the one of the HTTP interface
+			dev.Host = u.Hostname()
+		}
+
+		dev.StreamPath = path.Base(u.Path)
+		if dev.StreamPath == "." || dev.StreamPath == "/" {
+			dev.StreamPath = ""
+		}
+	}
+
+	if dev.Host == "" {
+		return nil, fmt.Errorf("unable to find the address of the device, set 'deviceHost'")
+	}
+
+	dev.StreamName = dev.StreamPath
+	if dev.StreamName == "" {
+		dev.StreamName = "stream0"
+	}
+
+	return dev, nil
+}
@@ -0,0 +1,163 @@
+package devicedriver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+func TestDetect(t *testing.T) {
+	for _, ca := range []struct {
+		source     string
+		deviceType string
+		expected   string
+	}{
+		{"rtsp://192.168.3.33/stream0", "", TypeNetworkCapture},
+		{"rtsp://192.168.3.33/0", "", TypeHTTPJPEG},
+		{"rtsp://192.168.3.33:554/live?v=0", "", TypeHTTPJPEG},
+		{"rtsp://192.168.3.33/0", TypeNetworkCapture, TypeNetworkCapture},
+	} {
+		require.Equal(t, ca.expected, Detect(&conf.Path{Source: ca.source, DeviceType: ca.deviceType}))
+	}
+}
+
+func TestOpen(t *testing.T) {
+	SetCredentials(conf.DeviceCredentials{
+		{Host: "192.168.3.33", Username: "store", Password: "secret"},
+	})
+	defer SetCredentials(nil)
+
+	_, dev, err := Open(TypeNetworkCapture, &conf.Path{Source: "rtsp://192.168.3.33:554/stream1"})
+	require.NoError(t, err)
+	require.Equal(t, &Device{
+		Type:       TypeNetworkCapture,
+		Host:       "192.168.3.33",
+		StreamPath: "stream1",
+		StreamName: "stream1",
+	}, dev)
+
+	username, password, ok := dev.Credentials()
+	require.True(t, ok)
+	require.Equal(t, "store", username)
+	require.Equal(t, "secret", password)
+
+	// the path configuration has priority over the store
+	_, dev, err = Open(TypeNetworkCapture, &conf.Path{
+		Source:         "rtsp://192.168.3.33",
+		DeviceHost:     "192.168.3.33:8080",
+		DeviceUsername: "path",
+		DevicePassword: "pass",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "192.168.3.33:8080", dev.Host)
+	require.Equal(t, "stream0", dev.StreamName)
+
+	username, _, _ = dev.Credentials()
+	require.Equal(t, "path", username)
+
+	_, dev, err = Open(TypeNetworkCapture, &conf.Path{Source: "rtsp://192.168.3.34"})
+	require.NoError(t, err)
+	_, _, ok = dev.Credentials()
+	require.False(t, ok)
+
+	_, _, err = Open("unknown", &conf.Path{Source: "rtsp://192.168.3.33"})
+	require.EqualError(t, err, "unknown device type: 'unknown'")
+
+	_, _, err = Open(TypeNetworkCapture, &conf.Path{Source: "publisher"})
+	require.Error(t, err)
+
+	require.Equal(t, []string{TypeHTTPJPEG, TypeNetworkCapture}, Types())
+	require.Panics(t, func() { Register(TypeHTTPJPEG, &httpJPEG{}) })
+}
+
+func TestNetworkCapture(t *testing.T) {
+	rebooted := false
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/RPC":
+			body, _ := io.ReadAll(r.Body)
+			switch {
+			case strings.Contains(string(body), "enc.getInputState"):
+				io.WriteString(w, `{"id":"1","result":[{"avalible":true,"name":"HDMI"},`+ //nolint:errcheck
+					`{"avalible":false,"name":"SDI"},{"avalible":true,"name":"VGA"}]}`)
+
+			case strings.Contains(string(body), `"enc.getJPG","params":["stream1"]`):
+				io.WriteString(w, `{"id":"1","jsonrpc":"2.0","result":"ok"}`) //nolint:errcheck
+
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+
+		case "/snap/stream1.jpg":
+			w.Write([]byte{0xFF, 0xD8}) //nolint:errcheck
+
+		case "/login2.php":
+			r.ParseForm() //nolint:errcheck
+			if r.Form.Get("name") != "admin" || r.Form.Get("passwd") != "admin" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+
+		case "/func.php":
+			c, err := r.Cookie("session")
+			if err != nil || c.Value != "abc" || r.URL.Query().Get("func") != "reboot" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			rebooted = true
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	drv, dev, err := Open(TypeNetworkCapture, &conf.Path{
+		Source:     "rtsp://127.0.0.1/stream1",
+		DeviceHost: strings.TrimPrefix(s.URL, "http://"),
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	img, err := drv.Snapshot(ctx, dev)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xFF, 0xD8}, img)
+
+	n, err := drv.InputStatus(ctx, dev)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	info, err := drv.Info(ctx, dev)
+	require.NoError(t, err)
+	require.Equal(t, &Info{
+		Type:   TypeNetworkCapture,
+		Host:   dev.Host,
+		Stream: "stream1",
+		Inputs: []Input{{"HDMI", true}, {"SDI", false}, {"VGA", true}},
+	}, info)
+
+	// the device can't be rebooted without an account
+	err = drv.Reboot(ctx, dev)
+	require.ErrorIs(t, err, ErrNoCredentials)
+	require.False(t, rebooted)
+
+	dev.Username = "admin"
+	dev.Password = "admin"
+	err = drv.Reboot(ctx, dev)
+	require.NoError(t, err)
+	require.True(t, rebooted)
+
+	dev.Password = "wrong"
+	err = drv.Reboot(ctx, dev)
+	require.EqualError(t, err, "login request returned status 401")
+}
@@ -0,0 +1,40 @@
+package devicedriver
+
+import (
+	"context"
+	"fmt"
+)
+
+// TypeHTTPJPEG is the device type of devices that only serve
+// the current image at /1.jpg.
+const TypeHTTPJPEG = "http_jpeg"
+
+func init() {
+	Register(TypeHTTPJPEG, &httpJPEG{})
+}
+
+type httpJPEG struct{}
+
+// Snapshot implements Driver.
+func (httpJPEG) Snapshot(ctx context.Context, dev *Device) ([]byte, error) {
+	return httpGet(ctx, fmt.Sprintf("http://%s/1.jpg", dev.Host))
+}
+
+// InputStatus implements Driver.
+func (httpJPEG) InputStatus(_ context.Context, _ *Device) (int, error) {
+	return 0, ErrNotSupported
+}
+
+// Reboot implements Driver.
+func (httpJPEG) Reboot(_ context.Context, _ *Device) error {
+	return ErrNotSupported
+}
+
+// Info implements Driver.
+func (httpJPEG) Info(_ context.Context, dev *Device) (*Info, error) {
+	return &Info{
+		Type:   dev.Type,
+		Host:   dev.Host,
+		Stream: dev.StreamName,
+	}, nil
+}
@@ -0,0 +1,208 @@
+package devicedriver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TypeNetworkCapture is the device type of network capture cards,
+// that expose a JSON-RPC interface.
+const TypeNetworkCapture = "network_capture"
+
+const (
+	requestTimeout = 1500 * time.Millisecond
+	rebootTimeout  = 10 * time.Second
+)
+
+func init() {
+	Register(TypeNetworkCapture, &networkCapture{})
+}
+
+type rpcInputState struct {
+	Avalible bool   `json:"avalible"`
+	Name     string `json:"name"`
+}
+
+type networkCapture struct{}
+
+// rpc calls a JSON-RPC method of the device.
+func (networkCapture) rpc(ctx context.Context, dev *Device, body string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+dev.Host+"/RPC", strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	client := &http.Client{Timeout: requestTimeout}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("RPC request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RPC returned status: %s", res.Status)
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+func (d networkCapture) inputs(ctx context.Context, dev *Device) ([]Input, error) {
+	body, err := d.rpc(ctx, dev,
+		fmt.Sprintf(`{"id":%d,"jsonrpc":"2.0","method":"enc.getInputState"}`, time.Now().UnixMilli()))
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Result []rpcInputState `json:"result"`
+	}
+	// 部分固件返回的内容不是 JSON，视为没有输入，避免报错刷屏
+	if err := json.Unmarshal(body, &res); err != nil {
+		return []Input{}, nil
+	}
+
+	ret := make([]Input, len(res.Result))
+	for i, r := range res.Result {
+		ret[i] = Input{Name: r.Name, Available: r.Avalible}
+	}
+	return ret, nil
+}
+
+// Snapshot implements Driver.
+func (d networkCapture) Snapshot(ctx context.Context, dev *Device) ([]byte, error) {
+	// Step 1: Call RPC to prepare snapshot
+	_, err := d.rpc(ctx, dev,
+		fmt.Sprintf(`{"jsonrpc":"2.0","method":"enc.getJPG","params":["%s"],"id":1}`, dev.StreamName))
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 2: Fetch the actual snapshot
+	return httpGet(ctx, fmt.Sprintf("http://%s/snap/%s.jpg", dev.Host, dev.StreamName))
+}
+
+// InputStatus implements Driver.
+// Only HDMI and SDI inputs are counted.
+func (d networkCapture) InputStatus(ctx context.Context, dev *Device) (int, error) {
+	inputs, err := d.inputs(ctx, dev)
+	if err != nil {
+		return -1, err
+	}
+
+	n := 0
+	for _, in := range inputs {
+		if in.Available && (in.Name == "HDMI" || in.Name == "SDI") {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Reboot implements Driver.
+// The device requires a login, the account must be configured.
+func (networkCapture) Reboot(ctx context.Context, dev *Device) error {
+	username, password, ok := dev.Credentials()
+	if !ok {
+		return ErrNoCredentials
+	}
+
+	baseURL := "http://" + dev.Host
+	client := &http.Client{Timeout: rebootTimeout}
+
+	// Step 1: Login
+	formData := url.Values{}
+	formData.Add("name", username)
+	formData.Add("passwd", password)
+
+	req1, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/login2.php",
+		bytes.NewBufferString(formData.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create login request: %w", err)
+	}
+	req1.Header.Set("Accept", "application/json")
+	req1.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp1, err := client.Do(req1)
+	if err != nil {
+		return fmt.Errorf("login request failed: %w", err)
+	}
+	defer resp1.Body.Close()
+
+	if resp1.StatusCode != http.StatusOK {
+		return fmt.Errorf("login request returned status %d", resp1.StatusCode)
+	}
+
+	// Step 2: Reboot, with the cookies of the login
+	req2, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/func.php?func=reboot", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create reboot request: %w", err)
+	}
+	req2.Header.Set("Accept", "application/json")
+	req2.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range resp1.Cookies() {
+		req2.AddCookie(cookie)
+	}
+
+	resp2, err := client.Do(req2)
+	if err != nil {
+		return fmt.Errorf("reboot request failed: %w", err)
+	}
+	defer resp2.Body.Close()
+
+	if resp2.StatusCode != http.StatusOK {
+		return fmt.Errorf("reboot request returned status %d", resp2.StatusCode)
+	}
+
+	return nil
+}
+
+// Info implements Driver.
+func (d networkCapture) Info(ctx context.Context, dev *Device) (*Info, error) {
+	inputs, err := d.inputs(ctx, dev)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Info{
+		Type:   dev.Type,
+		Host:   dev.Host,
+		Stream: dev.StreamName,
+		Inputs: inputs,
+	}, nil
+}
+
+// httpGet returns the body of a GET request.
+func httpGet(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	client := &http.Client{Timeout: requestTimeout}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch snapshot: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("device returned status: %s", res.Status)
+	}
+
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	return buf, nil
+}
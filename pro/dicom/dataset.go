@@ -0,0 +1,226 @@
+// Package dicom contains a DICOM Part 10 writer and reader, used to export snapshots and clips.
+// Data sets are always encoded with Explicit VR Little Endian,
+// that is also the encoding of data sets of encapsulated transfer syntaxes.
+package dicom
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Tag is a data element tag, group in the upper 16 bits and element in the lower 16 bits.
+type Tag uint32
+
+// Group returns the group of the tag.
+func (t Tag) Group() uint16 {
+	return uint16(t >> 16)
+}
+
+// Element returns the element of the tag.
+func (t Tag) Element() uint16 {
+	return uint16(t)
+}
+
+// String implements fmt.Stringer.
+func (t Tag) String() string {
+	return fmt.Sprintf("(%04X,%04X)", t.Group(), t.Element())
+}
+
+// Tags.
+const (
+	TagFileMetaInformationGroupLength Tag = 0x00020000
+	TagFileMetaInformationVersion     Tag = 0x00020001
+	TagMediaStorageSOPClassUID        Tag = 0x00020002
+	TagMediaStorageSOPInstanceUID     Tag = 0x00020003
+	TagTransferSyntaxUID              Tag = 0x00020010
+	TagImplementationClassUID         Tag = 0x00020012
+	TagImplementationVersionName      Tag = 0x00020013
+
+	TagSpecificCharacterSet   Tag = 0x00080005
+	TagImageType              Tag = 0x00080008
+	TagSOPClassUID            Tag = 0x00080016
+	TagSOPInstanceUID         Tag = 0x00080018
+	TagStudyDate              Tag = 0x00080020
+	TagContentDate            Tag = 0x00080023
+	TagStudyTime              Tag = 0x00080030
+	TagContentTime            Tag = 0x00080033
+	TagAccessionNumber        Tag = 0x00080050
+	TagModality               Tag = 0x00080060
+	TagConversionType         Tag = 0x00080064
+	TagManufacturer           Tag = 0x00080070
+	TagInstitutionName        Tag = 0x00080080
+	TagReferringPhysicianName Tag = 0x00080090
+	TagStudyDescription       Tag = 0x00081030
+	TagSeriesDescription      Tag = 0x0008103E
+	TagOperatorsName          Tag = 0x00081070
+
+	TagPatientName      Tag = 0x00100010
+	TagPatientID        Tag = 0x00100020
+	TagPatientBirthDate Tag = 0x00100030
+	TagPatientSex       Tag = 0x00100040
+
+	TagCineRate  Tag = 0x00180040
+	TagFrameTime Tag = 0x00181063
+
+	TagStudyInstanceUID   Tag = 0x0020000D
+	TagSeriesInstanceUID  Tag = 0x0020000E
+	TagStudyID            Tag = 0x00200010
+	TagSeriesNumber       Tag = 0x00200011
+	TagInstanceNumber     Tag = 0x00200013
+	TagPatientOrientation Tag = 0x00200020
+
+	TagSamplesPerPixel           Tag = 0x00280002
+	TagPhotometricInterpretation Tag = 0x00280004
+	TagPlanarConfiguration       Tag = 0x00280006
+	TagNumberOfFrames            Tag = 0x00280008
+	TagFrameIncrementPointer     Tag = 0x00280009
+	TagRows                      Tag = 0x00280010
+	TagColumns                   Tag = 0x00280011
+	TagBitsAllocated             Tag = 0x00280100
+	TagBitsStored                Tag = 0x00280101
+	TagHighBit                   Tag = 0x00280102
+	TagPixelRepresentation       Tag = 0x00280103
+	TagLossyImageCompression     Tag = 0x00282110
+
+	TagAcquisitionContextSequence Tag = 0x00400555
+
+	TagPixelData Tag = 0x7FE00010
+
+	tagItem                 Tag = 0xFFFEE000
+	tagItemDelimitation     Tag = 0xFFFEE00D
+	tagSequenceDelimitation Tag = 0xFFFEE0DD
+)
+
+// undefinedLength is the length of sequences, items and encapsulated pixel data
+// whose end is marked by a delimitation item.
+const undefinedLength = 0xFFFFFFFF
+
+// Element is a data element.
+type Element struct {
+	Tag   Tag
+	VR    string
+	Value []byte
+
+	// SQ elements
+	Items []Dataset
+
+	// encapsulated pixel data, without the basic offset table
+	Fragments [][]byte
+}
+
+// Dataset is a list of data elements.
+type Dataset []*Element
+
+// Find returns an element.
+func (ds Dataset) Find(tag Tag) *Element {
+	for _, e := range ds {
+		if e.Tag == tag {
+			return e
+		}
+	}
+	return nil
+}
+
+// String returns the value of a string element, without padding.
+func (ds Dataset) String(tag Tag) string {
+	e := ds.Find(tag)
+	if e == nil {
+		return ""
+	}
+	return strings.TrimRight(string(e.Value), " \x00")
+}
+
+// Uint16 returns the first value of a US element.
+func (ds Dataset) Uint16(tag Tag) uint16 {
+	e := ds.Find(tag)
+	if e == nil || len(e.Value) < 2 {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(e.Value)
+}
+
+// Int returns the value of an IS element.
+func (ds Dataset) Int(tag Tag) int {
+	v, _ := strconv.Atoi(strings.TrimSpace(ds.String(tag)))
+	return v
+}
+
+// set adds an element, replacing an existing one with the same tag.
+func (ds *Dataset) set(e *Element) {
+	for i, cur := range *ds {
+		if cur.Tag == e.Tag {
+			(*ds)[i] = e
+			return
+		}
+	}
+	*ds = append(*ds, e)
+}
+
+// SetString sets a string element. Multiple values are joined with backslashes.
+func (ds *Dataset) SetString(tag Tag, vr string, values ...string) {
+	v := []byte(strings.Join(values, `\`))
+	if len(v)%2 != 0 {
+		if vr == "UI" {
+			v = append(v, 0)
+		} else {
+			v = append(v, ' ')
+		}
+	}
+	ds.set(&Element{Tag: tag, VR: vr, Value: v})
+}
+
+// SetUint16 sets a US element.
+func (ds *Dataset) SetUint16(tag Tag, values ...uint16) {
+	v := make([]byte, 2*len(values))
+	for i, n := range values {
+		binary.LittleEndian.PutUint16(v[2*i:], n)
+	}
+	ds.set(&Element{Tag: tag, VR: "US", Value: v})
+}
+
+// SetInt sets an IS element.
+func (ds *Dataset) SetInt(tag Tag, v int) {
+	ds.SetString(tag, "IS", strconv.Itoa(v))
+}
+
+// SetDecimal sets a DS element.
+func (ds *Dataset) SetDecimal(tag Tag, v float64) {
+	ds.SetString(tag, "DS", strconv.FormatFloat(v, 'f', 6, 64))
+}
+
+// SetTag sets an AT element.
+func (ds *Dataset) SetTag(tag Tag, v Tag) {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint16(buf, v.Group())
+	binary.LittleEndian.PutUint16(buf[2:], v.Element())
+	ds.set(&Element{Tag: tag, VR: "AT", Value: buf})
+}
+
+// SetSequence sets a SQ element.
+func (ds *Dataset) SetSequence(tag Tag, items ...Dataset) {
+	ds.set(&Element{Tag: tag, VR: "SQ", Items: items})
+}
+
+func (ds Dataset) sorted() Dataset {
+	ret := append(Dataset(nil), ds...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Tag < ret[j].Tag
+	})
+	return ret
+}
+
+// NewUID returns a new UID, derived from a UUID as described in PS3.5 B.2.
+func NewUID() string {
+	return UUIDToUID(uuid.New())
+}
+
+// UUIDToUID converts a UUID into a UID, in the 2.25 root.
+func UUIDToUID(u uuid.UUID) string {
+	return "2.25." + new(big.Int).SetBytes(u[:]).String()
+}
@@ -0,0 +1,210 @@
+package dicom
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	gmp4 "github.com/yapingcat/gomedia/go-mp4"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/pro/clipexport"
+)
+
+type nilLogger struct{}
+
+func (nilLogger) Log(_ logger.Level, _ string, _ ...interface{}) {}
+
+var testMetadata = Metadata{
+	PatientID:        "P001",
+	PatientName:      "张^三",
+	PatientBirthDate: "19800101",
+	PatientSex:       "M",
+	StudyInstanceUID: "1.2.3.4",
+	AccessionNumber:  "A123",
+}
+
+func writeTestMP4(t *testing.T, fpath string, frames int) {
+	writeTestMP4SPS(t, fpath, frames, test.FormatH264.SPS)
+}
+
+func writeTestMP4SPS(t *testing.T, fpath string, frames int, sps []byte) {
+	f, err := os.Create(fpath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	m, err := gmp4.CreateMp4Muxer(f)
+	require.NoError(t, err)
+
+	video := m.AddVideoTrack(gmp4.MP4_CODEC_H264)
+
+	for i := 0; i < frames; i++ {
+		au := [][]byte{{0x41, 0x9a, 0x24, 0x6c, 0x42, 0xff, 0xff, 0xff, byte(i)}}
+		if i%10 == 0 {
+			au = [][]byte{sps, {0x68, 0xce, 0x3c, 0x80}, {0x65, 0x88, 0x84, 0x00, 0x33, 0xff, byte(i)}}
+		}
+
+		buf, err2 := h264.AnnexB(au).Marshal()
+		require.NoError(t, err2)
+
+		ts := uint64(i * 40)
+		err = m.Write(video, buf, ts, ts)
+		require.NoError(t, err)
+	}
+
+	err = m.WriteTrailer()
+	require.NoError(t, err)
+}
+
+func TestWriteImage(t *testing.T) {
+	for _, ca := range []string{"secondary capture", "endoscopic"} {
+		t.Run(ca, func(t *testing.T) {
+			var src bytes.Buffer
+			err := jpeg.Encode(&src, image.NewRGBA(image.Rect(0, 0, 64, 48)), nil)
+			require.NoError(t, err)
+
+			contentTime := time.Date(2026, 3, 1, 10, 20, 30, 0, time.Local)
+
+			var buf bytes.Buffer
+			uid, err := WriteImage(&buf, src.Bytes(), testMetadata, Options{
+				Endoscopic:  ca == "endoscopic",
+				ContentTime: contentTime,
+			})
+			require.NoError(t, err)
+
+			f, err := Read(&buf)
+			require.NoError(t, err)
+
+			require.Equal(t, JPEGBaseline, f.TransferSyntax())
+			require.Equal(t, uid, f.Meta.String(TagMediaStorageSOPInstanceUID))
+			require.Equal(t, uid, f.Dataset.String(TagSOPInstanceUID))
+			require.Equal(t, "张^三", f.Dataset.String(TagPatientName))
+			require.Equal(t, "P001", f.Dataset.String(TagPatientID))
+			require.Equal(t, "A123", f.Dataset.String(TagAccessionNumber))
+			require.Equal(t, "1.2.3.4", f.Dataset.String(TagStudyInstanceUID))
+			require.NotEmpty(t, f.Dataset.String(TagSeriesInstanceUID))
+			require.Equal(t, "20260301", f.Dataset.String(TagContentDate))
+			require.Equal(t, "102030", f.Dataset.String(TagContentTime))
+			require.Equal(t, uint16(48), f.Dataset.Uint16(TagRows))
+			require.Equal(t, uint16(64), f.Dataset.Uint16(TagColumns))
+			require.Equal(t, uint16(3), f.Dataset.Uint16(TagSamplesPerPixel))
+			// fragments are padded to an even length
+			require.Equal(t, src.Bytes(), f.PixelData()[:src.Len()])
+
+			if ca == "endoscopic" {
+				require.Equal(t, VLEndoscopicImageStorage, f.Dataset.String(TagSOPClassUID))
+				require.Equal(t, "ES", f.Dataset.String(TagModality))
+				require.NotNil(t, f.Dataset.Find(TagAcquisitionContextSequence))
+			} else {
+				require.Equal(t, SecondaryCaptureImageStorage, f.Dataset.String(TagSOPClassUID))
+				require.Equal(t, "WSD", f.Dataset.String(TagConversionType))
+			}
+		})
+	}
+}
+
+func TestWriteImageProgressive(t *testing.T) {
+	// SOI, SOF2
+	_, err := WriteImage(&bytes.Buffer{}, []byte{0xFF, 0xD8, 0xFF, 0xC2, 0x00, 0x02}, testMetadata, Options{})
+	require.Error(t, err)
+}
+
+func TestWriteVideo(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "clip.mp4")
+	writeTestMP4(t, fpath, 25)
+
+	var buf bytes.Buffer
+	uid, err := WriteVideo(&buf, fpath, dir, testMetadata, Options{Endoscopic: true}, nilLogger{})
+	require.NoError(t, err)
+
+	f, err := Read(&buf)
+	require.NoError(t, err)
+
+	require.Equal(t, MPEG4AVCHPLevel41, f.TransferSyntax())
+	require.Equal(t, uid, f.Dataset.String(TagSOPInstanceUID))
+	require.Equal(t, VideoEndoscopicImageStorage, f.Dataset.String(TagSOPClassUID))
+	require.Equal(t, "YBR_PARTIAL_420", f.Dataset.String(TagPhotometricInterpretation))
+	require.Equal(t, uint16(1080), f.Dataset.Uint16(TagRows))
+	require.Equal(t, uint16(1920), f.Dataset.Uint16(TagColumns))
+	require.Equal(t, 25, f.Dataset.Int(TagNumberOfFrames))
+	require.InDelta(t, 25, f.Dataset.Int(TagCineRate), 1)
+	frameTime, err := strconv.ParseFloat(f.Dataset.String(TagFrameTime), 64)
+	require.NoError(t, err)
+	require.InDelta(t, 40, frameTime, 2)
+	require.Equal(t, []byte{0x18, 0x00, 0x63, 0x10}, f.Dataset.Find(TagFrameIncrementPointer).Value)
+
+	var au h264.AnnexB
+	err = au.Unmarshal(f.PixelData())
+	require.NoError(t, err)
+	require.Equal(t, test.FormatH264.SPS, [][]byte(au)[0])
+
+	// temporary files are removed
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestWriteVideoUnsupportedLevel(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "clip.mp4")
+
+	sps := append([]byte(nil), test.FormatH264.SPS...)
+	sps[3] = 51 // level_idc
+	writeTestMP4SPS(t, fpath, 25, sps)
+
+	var buf bytes.Buffer
+	_, err := WriteVideo(&buf, fpath, dir, testMetadata, Options{}, nilLogger{})
+	require.EqualError(t, err, "H264 level 5.1 is not supported by DICOM, the maximum is 4.2")
+	require.Zero(t, buf.Len())
+}
+
+func TestAVCTransferSyntax(t *testing.T) {
+	for _, ca := range []struct {
+		name     string
+		width    int
+		height   int
+		level    uint8
+		fps      int
+		expected string
+		err      string
+	}{
+		{"1080p25", 1920, 1080, 40, 25, MPEG4AVCHPLevel41, ""},
+		{"720p60", 1280, 720, 32, 60, MPEG4AVCHPLevel41, ""},
+		{"1080p60", 1920, 1080, 42, 60, MPEG4AVCHPLevel42, ""},
+		{"level 5.1", 1920, 1080, 51, 25, "", "H264 level 5.1 is not supported by DICOM, the maximum is 4.2"},
+		{"4k", 3840, 2160, 42, 25, "", "resolution 3840x2160 is not supported by DICOM, the maximum is 1920x1080"},
+		{"120 fps", 1280, 720, 42, 120, "", "frame rate 120 is not supported by DICOM, the maximum is 60"},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			ts, err := avcTransferSyntax(&clipexport.H264Stream{
+				Width:    ca.width,
+				Height:   ca.height,
+				LevelIdc: ca.level,
+				Frames:   ca.fps,
+				Duration: time.Second,
+			})
+			if ca.err != "" {
+				require.EqualError(t, err, ca.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, ca.expected, ts)
+		})
+	}
+}
+
+func TestUUIDToUID(t *testing.T) {
+	u := uuid.MustParse("f81d4fae-7dec-11d0-a765-00a0c91e6bf6")
+	require.Equal(t, "2.25.329800735698586629295641978511506172918", UUIDToUID(u))
+	require.LessOrEqual(t, len(NewUID()), 64)
+}
@@ -0,0 +1,632 @@
+package dicom
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// PDU types of the DICOM upper layer protocol (PS3.8).
+const (
+	pduAssociateRQ = 0x01
+	pduAssociateAC = 0x02
+	pduAssociateRJ = 0x03
+	pduDataTF      = 0x04
+	pduReleaseRQ   = 0x05
+	pduReleaseRP   = 0x06
+	pduAbort       = 0x07
+)
+
+// Items of association PDUs.
+const (
+	itemApplicationContext  = 0x10
+	itemPresentationContext = 0x20
+	itemPresentationResult  = 0x21
+	itemAbstractSyntax      = 0x30
+	itemTransferSyntax      = 0x40
+	itemUserInformation     = 0x50
+	itemMaxLength           = 0x51
+	itemImplementationUID   = 0x52
+	itemImplementationName  = 0x55
+)
+
+// Command elements (PS3.7).
+const (
+	tagAffectedSOPClassUID       Tag = 0x00000002
+	tagCommandField              Tag = 0x00000100
+	tagMessageID                 Tag = 0x00000110
+	tagMessageIDBeingRespondedTo Tag = 0x00000120
+	tagPriority                  Tag = 0x00000700
+	tagCommandDataSetType        Tag = 0x00000800
+	tagStatus                    Tag = 0x00000900
+	tagErrorComment              Tag = 0x00000902
+	tagAffectedSOPInstanceUID    Tag = 0x00001000
+)
+
+const (
+	applicationContextName = "1.2.840.10008.3.1.1.1"
+
+	commandCStoreRQ  = 0x0001
+	commandCStoreRSP = 0x8001
+
+	dataSetPresent = 0x0000
+	noDataSet      = 0x0101
+
+	// maxReceivedPDU is the maximum length of PDUs received from the peer.
+	maxReceivedPDU = 64 * 1024
+
+	// maxSentPDV is the maximum length of data sent in a PDU,
+	// used when the peer doesn't set any limit.
+	maxSentPDV = 1024 * 1024
+
+	// pdvHeaderSize is the overhead of a PDV inside a P-DATA-TF PDU:
+	// item length, presentation context ID and message control header.
+	pdvHeaderSize = 6
+)
+
+// ErrAssociationRejected is returned when the SCP rejects the association.
+var ErrAssociationRejected = errors.New("association rejected")
+
+// StatusError is a C-STORE failure status returned by the SCP.
+type StatusError struct {
+	Status  uint16
+	Comment string
+}
+
+// Error implements error.
+func (e *StatusError) Error() string {
+	if e.Comment != "" {
+		return fmt.Sprintf("C-STORE failed with status 0x%04X: %s", e.Status, e.Comment)
+	}
+	return fmt.Sprintf("C-STORE failed with status 0x%04X", e.Status)
+}
+
+// storeSucceeded checks whether a C-STORE status is success or warning.
+func storeSucceeded(status uint16) bool {
+	return status == 0x0000 || status == 0x0001 || status&0xF000 == 0xB000
+}
+
+func padAETitle(ae string) []byte {
+	buf := bytes.Repeat([]byte{' '}, 16)
+	copy(buf, ae)
+	return buf
+}
+
+// writeImplicit encodes a command set with Implicit VR Little Endian, prefixed by its group length.
+func writeImplicit(ds Dataset) []byte {
+	var body bytes.Buffer
+	for _, e := range ds.sorted() {
+		value := e.Value
+		if len(value)%2 != 0 {
+			value = append(append([]byte(nil), value...), 0)
+		}
+		var h [8]byte
+		binary.LittleEndian.PutUint16(h[:], e.Tag.Group())
+		binary.LittleEndian.PutUint16(h[2:], e.Tag.Element())
+		binary.LittleEndian.PutUint32(h[4:], uint32(len(value)))
+		body.Write(h[:])
+		body.Write(value)
+	}
+
+	var buf [12]byte
+	binary.LittleEndian.PutUint32(buf[4:], 4)
+	binary.LittleEndian.PutUint32(buf[8:], uint32(body.Len()))
+	return append(buf[:], body.Bytes()...)
+}
+
+// readImplicit decodes a command set encoded with Implicit VR Little Endian.
+func readImplicit(buf []byte) (Dataset, error) {
+	var ds Dataset
+	for len(buf) != 0 {
+		if len(buf) < 8 {
+			return nil, fmt.Errorf("invalid command set")
+		}
+		tag := Tag(uint32(binary.LittleEndian.Uint16(buf))<<16 | uint32(binary.LittleEndian.Uint16(buf[2:])))
+		length := binary.LittleEndian.Uint32(buf[4:])
+		buf = buf[8:]
+		if uint32(len(buf)) < length {
+			return nil, fmt.Errorf("invalid command set")
+		}
+		ds = append(ds, &Element{Tag: tag, Value: buf[:length]})
+		buf = buf[length:]
+	}
+	return ds, nil
+}
+
+func writePDU(w io.Writer, typ byte, body []byte) error {
+	var h [6]byte
+	h[0] = typ
+	binary.BigEndian.PutUint32(h[2:], uint32(len(body)))
+	_, err := w.Write(append(h[:], body...))
+	return err
+}
+
+func readPDU(r io.Reader) (byte, []byte, error) {
+	var h [6]byte
+	_, err := io.ReadFull(r, h[:])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(h[2:])
+	if length > maxReceivedPDU {
+		return 0, nil, fmt.Errorf("PDU too big (%d bytes)", length)
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return h[0], body, err
+}
+
+// appendItem appends an item with a 16-bit length.
+func appendItem(buf []byte, typ byte, value []byte) []byte {
+	buf = append(buf, typ, 0, 0, 0)
+	binary.BigEndian.PutUint16(buf[len(buf)-2:], uint16(len(value)))
+	return append(buf, value...)
+}
+
+// parseItems splits a list of items with 16-bit lengths.
+func parseItems(buf []byte, cb func(typ byte, value []byte) error) error {
+	for len(buf) != 0 {
+		if len(buf) < 4 {
+			return fmt.Errorf("invalid item")
+		}
+		typ := buf[0]
+		length := int(binary.BigEndian.Uint16(buf[2:]))
+		if len(buf) < 4+length {
+			return fmt.Errorf("invalid item")
+		}
+		err := cb(typ, buf[4:4+length])
+		if err != nil {
+			return err
+		}
+		buf = buf[4+length:]
+	}
+	return nil
+}
+
+// presentationContext is an abstract syntax and the transfer syntax
+// in which objects of that abstract syntax are sent.
+type presentationContext struct {
+	id             byte
+	abstractSyntax string
+	transferSyntax string
+	accepted       bool
+}
+
+// association is an association with a SCP.
+type association struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	contexts []*presentationContext
+	maxPDV   int
+	msgID    uint16
+}
+
+func associateRQ(callingAE string, calledAE string, contexts []*presentationContext) []byte {
+	body := []byte{0, 1, 0, 0}
+	body = append(body, padAETitle(calledAE)...)
+	body = append(body, padAETitle(callingAE)...)
+	body = append(body, make([]byte, 32)...)
+
+	body = appendItem(body, itemApplicationContext, []byte(applicationContextName))
+
+	for _, pc := range contexts {
+		var sub []byte
+		sub = appendItem(sub, itemAbstractSyntax, []byte(pc.abstractSyntax))
+		sub = appendItem(sub, itemTransferSyntax, []byte(pc.transferSyntax))
+		body = appendItem(body, itemPresentationContext, append([]byte{pc.id, 0, 0, 0}, sub...))
+	}
+
+	var user []byte
+	maxLength := make([]byte, 4)
+	binary.BigEndian.PutUint32(maxLength, maxReceivedPDU)
+	user = appendItem(user, itemMaxLength, maxLength)
+	user = appendItem(user, itemImplementationUID, []byte(ImplementationClassUID))
+	user = appendItem(user, itemImplementationName, []byte(implementationVersionName))
+	body = appendItem(body, itemUserInformation, user)
+
+	return body
+}
+
+// parseAssociateAC marks accepted presentation contexts and returns the maximum PDU length of the peer.
+func parseAssociateAC(body []byte, contexts []*presentationContext) (uint32, error) {
+	if len(body) < 68 {
+		return 0, fmt.Errorf("invalid A-ASSOCIATE-AC")
+	}
+
+	var maxLength uint32
+
+	err := parseItems(body[68:], func(typ byte, value []byte) error {
+		switch typ {
+		case itemPresentationResult:
+			if len(value) < 4 {
+				return fmt.Errorf("invalid presentation context")
+			}
+			for _, pc := range contexts {
+				if pc.id == value[0] {
+					pc.accepted = value[2] == 0
+				}
+			}
+
+		case itemUserInformation:
+			return parseItems(value, func(typ byte, value []byte) error {
+				if typ == itemMaxLength && len(value) == 4 {
+					maxLength = binary.BigEndian.Uint32(value)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+
+	return maxLength, err
+}
+
+func associate(
+	ctx context.Context,
+	address string,
+	callingAE string,
+	calledAE string,
+	contexts []*presentationContext,
+) (*association, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &association{
+		conn:     conn,
+		br:       bufio.NewReader(conn),
+		contexts: contexts,
+	}
+
+	err = writePDU(conn, pduAssociateRQ, associateRQ(callingAE, calledAE, contexts))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	typ, body, err := readPDU(a.br)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	switch typ {
+	case pduAssociateAC:
+	case pduAssociateRJ:
+		conn.Close()
+		if len(body) >= 4 {
+			return nil, fmt.Errorf("%w (result %d, source %d, reason %d)", ErrAssociationRejected, body[1], body[2], body[3])
+		}
+		return nil, ErrAssociationRejected
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("unexpected PDU type %d", typ)
+	}
+
+	maxLength, err := parseAssociateAC(body, contexts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	a.maxPDV = maxSentPDV
+	if maxLength != 0 && int(maxLength)-pdvHeaderSize < a.maxPDV {
+		a.maxPDV = int(maxLength) - pdvHeaderSize
+	}
+
+	return a, nil
+}
+
+func (a *association) close() {
+	a.conn.Close()
+}
+
+// release releases the association gracefully.
+func (a *association) release() error {
+	defer a.conn.Close()
+
+	err := writePDU(a.conn, pduReleaseRQ, make([]byte, 4))
+	if err != nil {
+		return err
+	}
+
+	typ, _, err := readPDU(a.br)
+	if err != nil {
+		return err
+	}
+	if typ != pduReleaseRP {
+		return fmt.Errorf("unexpected PDU type %d", typ)
+	}
+	return nil
+}
+
+// writePDV writes a fragment of a command or data set into a P-DATA-TF PDU.
+func (a *association) writePDV(contextID byte, command bool, last bool, data []byte) error {
+	header := byte(0)
+	if command {
+		header |= 0x01
+	}
+	if last {
+		header |= 0x02
+	}
+
+	body := make([]byte, pdvHeaderSize+len(data))
+	binary.BigEndian.PutUint32(body, uint32(2+len(data)))
+	body[4] = contextID
+	body[5] = header
+	copy(body[pdvHeaderSize:], data)
+
+	return writePDU(a.conn, pduDataTF, body)
+}
+
+// writeMessage writes a command set and a data set read from r.
+func (a *association) writeMessage(contextID byte, command []byte, r io.Reader) error {
+	for len(command) > a.maxPDV {
+		err := a.writePDV(contextID, true, false, command[:a.maxPDV])
+		if err != nil {
+			return err
+		}
+		command = command[a.maxPDV:]
+	}
+	err := a.writePDV(contextID, true, true, command)
+	if err != nil {
+		return err
+	}
+
+	// a fragment is sent when the next one is available, in order to flag the last one
+	buf := make([]byte, a.maxPDV)
+	next := make([]byte, a.maxPDV)
+
+	n, err := io.ReadFull(r, buf)
+	for {
+		switch {
+		case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+			return a.writePDV(contextID, false, true, buf[:n])
+		case err != nil:
+			return err
+		}
+
+		var n2 int
+		n2, err = io.ReadFull(r, next)
+		if n2 == 0 && errors.Is(err, io.EOF) {
+			return a.writePDV(contextID, false, true, buf[:n])
+		}
+
+		err2 := a.writePDV(contextID, false, false, buf[:n])
+		if err2 != nil {
+			return err2
+		}
+
+		buf, next = next, buf
+		n = n2
+	}
+}
+
+// readCommand reads a command set, that is not followed by a data set.
+func (a *association) readCommand() (Dataset, error) {
+	var command []byte
+
+	for {
+		typ, body, err := readPDU(a.br)
+		if err != nil {
+			return nil, err
+		}
+
+		switch typ {
+		case pduDataTF:
+		case pduAbort:
+			return nil, fmt.Errorf("association aborted by peer")
+		default:
+			return nil, fmt.Errorf("unexpected PDU type %d", typ)
+		}
+
+		for len(body) != 0 {
+			if len(body) < pdvHeaderSize {
+				return nil, fmt.Errorf("invalid PDV")
+			}
+			length := int(binary.BigEndian.Uint32(body))
+			if length < 2 || len(body) < 4+length {
+				return nil, fmt.Errorf("invalid PDV")
+			}
+			header := body[5]
+			if header&0x01 == 0 {
+				return nil, fmt.Errorf("unexpected data set")
+			}
+			command = append(command, body[pdvHeaderSize:4+length]...)
+			body = body[4+length:]
+
+			if header&0x02 != 0 {
+				return readImplicit(command)
+			}
+		}
+	}
+}
+
+// store sends an object with C-STORE.
+// data is the data set, encoded with the transfer syntax of the presentation context.
+func (a *association) store(pc *presentationContext, sopInstanceUID string, data io.Reader) error {
+	a.msgID++
+
+	var cmd Dataset
+	cmd.SetString(tagAffectedSOPClassUID, "UI", pc.abstractSyntax)
+	cmd.SetUint16(tagCommandField, commandCStoreRQ)
+	cmd.SetUint16(tagMessageID, a.msgID)
+	cmd.SetUint16(tagPriority, 0)
+	cmd.SetUint16(tagCommandDataSetType, dataSetPresent)
+	cmd.SetString(tagAffectedSOPInstanceUID, "UI", sopInstanceUID)
+
+	err := a.writeMessage(pc.id, writeImplicit(cmd), data)
+	if err != nil {
+		return err
+	}
+
+	res, err := a.readCommand()
+	if err != nil {
+		return err
+	}
+
+	if res.Uint16(tagCommandField) != commandCStoreRSP || res.Uint16(tagMessageIDBeingRespondedTo) != a.msgID {
+		return fmt.Errorf("unexpected response")
+	}
+
+	status := res.Uint16(tagStatus)
+	if !storeSucceeded(status) {
+		return &StatusError{Status: status, Comment: res.String(tagErrorComment)}
+	}
+	return nil
+}
+
+// storeFile is a file to be sent with C-STORE.
+type storeFile struct {
+	path           string
+	sopClassUID    string
+	sopInstanceUID string
+	transferSyntax string
+}
+
+func openStoreFile(fpath string) (*os.File, *bufio.Reader, *storeFile, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	br := bufio.NewReader(f)
+	meta, err := ReadMeta(br)
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+
+	return f, br, &storeFile{
+		path:           fpath,
+		sopClassUID:    meta.String(TagMediaStorageSOPClassUID),
+		sopInstanceUID: meta.String(TagMediaStorageSOPInstanceUID),
+		transferSyntax: meta.String(TagTransferSyntaxUID),
+	}, nil
+}
+
+// StoreSCU sends DICOM files to a Storage SCP with C-STORE (DIMSE).
+type StoreSCU struct {
+	Address        string // host:port
+	CallingAETitle string
+	CalledAETitle  string
+	Timeout        time.Duration // timeout of the whole association
+}
+
+// Store sends files with a single association and returns an error for each file.
+// Files are sent in the transfer syntax in which they are stored.
+func (s *StoreSCU) Store(ctx context.Context, paths []string) []error {
+	errs := make([]error, len(paths))
+
+	// failFrom sets the error of the files that have not been accepted by the SCP,
+	// starting from the one at index start. Files accepted before keep a nil error.
+	failFrom := func(start int, err error) []error {
+		for i := start; i < len(errs); i++ {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+		return errs
+	}
+
+	// read SOP classes and transfer syntaxes, in order to propose presentation contexts
+	files := make([]*storeFile, len(paths))
+	contextsByKey := make(map[string]*presentationContext)
+	var contexts []*presentationContext
+
+	for i, p := range paths {
+		f, _, sf, err := openStoreFile(p)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		f.Close()
+		files[i] = sf
+
+		key := sf.sopClassUID + "|" + sf.transferSyntax
+		if _, ok := contextsByKey[key]; !ok {
+			if len(contexts) == 128 {
+				errs[i] = fmt.Errorf("too many presentation contexts")
+				continue
+			}
+			pc := &presentationContext{
+				id:             byte(2*len(contexts) + 1),
+				abstractSyntax: sf.sopClassUID,
+				transferSyntax: sf.transferSyntax,
+			}
+			contextsByKey[key] = pc
+			contexts = append(contexts, pc)
+		}
+	}
+
+	if len(contexts) == 0 {
+		return errs
+	}
+
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	a, err := associate(ctx, s.Address, s.CallingAETitle, s.CalledAETitle, contexts)
+	if err != nil {
+		return failFrom(0, err)
+	}
+
+	// interrupt I/O when the context is canceled
+	stop := context.AfterFunc(ctx, a.close)
+	defer stop()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		a.conn.SetDeadline(deadline) //nolint:errcheck
+	}
+
+	for i, sf := range files {
+		if sf == nil {
+			continue
+		}
+
+		pc := contextsByKey[sf.sopClassUID+"|"+sf.transferSyntax]
+		if !pc.accepted {
+			errs[i] = fmt.Errorf("presentation context rejected (%s, %s)", sf.sopClassUID, sf.transferSyntax)
+			continue
+		}
+
+		f, br, _, err := openStoreFile(sf.path)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		err = a.store(pc, sf.sopInstanceUID, br)
+		f.Close()
+
+		if err != nil {
+			errs[i] = err
+
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) {
+				// the association is unusable
+				a.close()
+				return failFrom(i+1, err)
+			}
+		}
+	}
+
+	// every file has received a response, a failed release doesn't change the result
+	a.release() //nolint:errcheck
+
+	return errs
+}
@@ -0,0 +1,311 @@
+package dicom
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testStoredObject struct {
+	sopClassUID    string
+	sopInstanceUID string
+	data           []byte
+}
+
+// testSCP is a Storage SCP that accepts an association and every presentation context.
+type testSCP struct {
+	ln     net.Listener
+	status uint16
+	maxPDU uint32
+
+	dropAfter int // when greater than zero, the connection is closed after this number of responses
+
+	calledAE string
+	stored   []testStoredObject
+	done     chan struct{}
+}
+
+func newTestSCP(t *testing.T, status uint16) *testSCP {
+	return newTestSCPDropAfter(t, status, 0)
+}
+
+func newTestSCPDropAfter(t *testing.T, status uint16, dropAfter int) *testSCP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &testSCP{
+		ln:        ln,
+		status:    status,
+		maxPDU:    16384,
+		dropAfter: dropAfter,
+		done:      make(chan struct{}),
+	}
+	go s.run()
+
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *testSCP) run() {
+	defer close(s.done)
+
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+
+	typ, body, err := readPDU(br)
+	if err != nil || typ != pduAssociateRQ {
+		return
+	}
+
+	s.calledAE = string(bytes.TrimRight(body[4:20], " "))
+
+	ac := append([]byte{0, 1, 0, 0}, body[4:68]...)
+	ac = appendItem(ac, itemApplicationContext, []byte(applicationContextName))
+
+	parseItems(body[68:], func(typ byte, value []byte) error { //nolint:errcheck
+		if typ == itemPresentationContext {
+			var ts []byte
+			parseItems(value[4:], func(typ byte, value []byte) error { //nolint:errcheck
+				if typ == itemTransferSyntax {
+					ts = value
+				}
+				return nil
+			})
+			ac = appendItem(ac, itemPresentationResult, appendItem([]byte{value[0], 0, 0, 0}, itemTransferSyntax, ts))
+		}
+		return nil
+	})
+
+	maxLength := make([]byte, 4)
+	binary.BigEndian.PutUint32(maxLength, s.maxPDU)
+	ac = appendItem(ac, itemUserInformation, appendItem(nil, itemMaxLength, maxLength))
+
+	err = writePDU(conn, pduAssociateAC, ac)
+	if err != nil {
+		return
+	}
+
+	var command, data []byte
+	var cmd Dataset
+
+	for {
+		typ, body, err = readPDU(br)
+		if err != nil {
+			return
+		}
+
+		switch typ {
+		case pduReleaseRQ:
+			writePDU(conn, pduReleaseRP, make([]byte, 4)) //nolint:errcheck
+			return
+
+		case pduDataTF:
+			if uint32(len(body)) > s.maxPDU {
+				return
+			}
+
+			contextID := body[4]
+			header := body[5]
+			value := body[pdvHeaderSize:]
+
+			if header&0x01 != 0 {
+				command = append(command, value...)
+				if header&0x02 != 0 {
+					cmd, _ = readImplicit(command)
+					command = nil
+				}
+				continue
+			}
+
+			data = append(data, value...)
+			if header&0x02 == 0 {
+				continue
+			}
+
+			s.stored = append(s.stored, testStoredObject{
+				sopClassUID:    cmd.String(tagAffectedSOPClassUID),
+				sopInstanceUID: cmd.String(tagAffectedSOPInstanceUID),
+				data:           data,
+			})
+			data = nil
+
+			var res Dataset
+			res.SetString(tagAffectedSOPClassUID, "UI", cmd.String(tagAffectedSOPClassUID))
+			res.SetUint16(tagCommandField, commandCStoreRSP)
+			res.SetUint16(tagMessageIDBeingRespondedTo, cmd.Uint16(tagMessageID))
+			res.SetUint16(tagCommandDataSetType, noDataSet)
+			res.SetUint16(tagStatus, s.status)
+			res.SetString(tagAffectedSOPInstanceUID, "UI", cmd.String(tagAffectedSOPInstanceUID))
+			buf := writeImplicit(res)
+
+			pdv := make([]byte, pdvHeaderSize+len(buf))
+			binary.BigEndian.PutUint32(pdv, uint32(2+len(buf)))
+			pdv[4] = contextID
+			pdv[5] = 0x03
+			copy(pdv[pdvHeaderSize:], buf)
+
+			err = writePDU(conn, pduDataTF, pdv)
+			if err != nil {
+				return
+			}
+
+			if s.dropAfter > 0 && len(s.stored) == s.dropAfter {
+				return
+			}
+
+		default:
+			return
+		}
+	}
+}
+
+// writeTestFiles writes an image, big enough to be split into multiple PDUs, and a video.
+func writeTestFiles(t *testing.T, dir string) []string {
+	img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+	}
+
+	var src bytes.Buffer
+	err := jpeg.Encode(&src, img, nil)
+	require.NoError(t, err)
+
+	imagePath := filepath.Join(dir, "snap.dcm")
+	f, err := os.Create(imagePath)
+	require.NoError(t, err)
+	_, err = WriteImage(f, src.Bytes(), testMetadata, Options{})
+	f.Close()
+	require.NoError(t, err)
+
+	clipPath := filepath.Join(dir, "clip.mp4")
+	writeTestMP4(t, clipPath, 25)
+
+	videoPath := filepath.Join(dir, "clip.dcm")
+	f, err = os.Create(videoPath)
+	require.NoError(t, err)
+	_, err = WriteVideo(f, clipPath, dir, testMetadata, Options{}, nilLogger{})
+	f.Close()
+	require.NoError(t, err)
+
+	return []string{imagePath, videoPath}
+}
+
+// testDataSet returns the data set of a file, without the file meta information.
+func testDataSet(t *testing.T, fpath string) (Dataset, []byte) {
+	f, err := os.Open(fpath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	meta, err := ReadMeta(br)
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(br)
+	require.NoError(t, err)
+	return meta, data
+}
+
+func TestStoreSCU(t *testing.T) {
+	paths := writeTestFiles(t, t.TempDir())
+	scp := newTestSCP(t, 0x0000)
+
+	scu := &StoreSCU{
+		Address:        scp.ln.Addr().String(),
+		CallingAETitle: "MEDIAMTX",
+		CalledAETitle:  "PACS",
+		Timeout:        10 * time.Second,
+	}
+
+	errs := scu.Store(context.Background(), paths)
+	require.Equal(t, []error{nil, nil}, errs)
+
+	<-scp.done
+	require.Equal(t, "PACS", scp.calledAE)
+	require.Len(t, scp.stored, 2)
+
+	for i, p := range paths {
+		meta, data := testDataSet(t, p)
+		require.Equal(t, meta.String(TagMediaStorageSOPClassUID), scp.stored[i].sopClassUID)
+		require.Equal(t, meta.String(TagMediaStorageSOPInstanceUID), scp.stored[i].sopInstanceUID)
+		require.Equal(t, data, scp.stored[i].data)
+	}
+}
+
+func TestStoreSCUFailure(t *testing.T) {
+	dir := t.TempDir()
+	paths := writeTestFiles(t, dir)
+	scp := newTestSCP(t, 0xA700)
+
+	scu := &StoreSCU{
+		Address:       scp.ln.Addr().String(),
+		CalledAETitle: "PACS",
+		Timeout:       10 * time.Second,
+	}
+
+	errs := scu.Store(context.Background(), append(paths, filepath.Join(dir, "missing.dcm")))
+	require.Len(t, errs, 3)
+
+	// the association is kept after failure statuses
+	for _, err := range errs[:2] {
+		var statusErr *StatusError
+		require.ErrorAs(t, err, &statusErr)
+		require.Equal(t, uint16(0xA700), statusErr.Status)
+	}
+	require.ErrorIs(t, errs[2], os.ErrNotExist)
+
+	<-scp.done
+	require.Len(t, scp.stored, 2)
+}
+
+func TestStoreSCUConnectionDropped(t *testing.T) {
+	paths := writeTestFiles(t, t.TempDir())
+	scp := newTestSCPDropAfter(t, 0x0000, 1)
+
+	scu := &StoreSCU{
+		Address:       scp.ln.Addr().String(),
+		CalledAETitle: "PACS",
+		Timeout:       10 * time.Second,
+	}
+
+	errs := scu.Store(context.Background(), append(paths, paths[0]))
+	require.Len(t, errs, 3)
+
+	// the file accepted before the connection was closed is delivered
+	require.NoError(t, errs[0])
+	require.Error(t, errs[1])
+	require.Error(t, errs[2])
+
+	<-scp.done
+	require.Len(t, scp.stored, 1)
+}
+
+func TestStoreSCUUnreachable(t *testing.T) {
+	paths := writeTestFiles(t, t.TempDir())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	scu := &StoreSCU{Address: addr, Timeout: 10 * time.Second}
+
+	errs := scu.Store(context.Background(), paths)
+	require.Error(t, errs[0])
+	require.Error(t, errs[1])
+}
@@ -0,0 +1,273 @@
+package dicom
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // register decoder
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/pro/clipexport"
+)
+
+// SOP classes.
+const (
+	SecondaryCaptureImageStorage  = "1.2.840.10008.5.1.4.1.1.7"
+	VLEndoscopicImageStorage      = "1.2.840.10008.5.1.4.1.1.77.1.1"
+	VideoEndoscopicImageStorage   = "1.2.840.10008.5.1.4.1.1.77.1.1.1"
+	VideoPhotographicImageStorage = "1.2.840.10008.5.1.4.1.1.77.1.4.1"
+)
+
+// Metadata are the patient and study attributes of exported objects.
+// Empty attributes are written empty, except UIDs, that are generated.
+type Metadata struct {
+	PatientID              string `json:"patientId"`
+	PatientName            string `json:"patientName"`      // Family^Given
+	PatientBirthDate       string `json:"patientBirthDate"` // YYYYMMDD
+	PatientSex             string `json:"patientSex"`       // M, F or O
+	StudyInstanceUID       string `json:"studyInstanceUid"`
+	StudyID                string `json:"studyId"`
+	AccessionNumber        string `json:"accessionNumber"`
+	StudyDescription       string `json:"studyDescription"`
+	ReferringPhysicianName string `json:"referringPhysicianName"`
+	OperatorsName          string `json:"operatorsName"`
+	InstitutionName        string `json:"institutionName"`
+	SeriesInstanceUID      string `json:"seriesInstanceUid"`
+	SeriesDescription      string `json:"seriesDescription"`
+}
+
+// Options are the attributes of a single object.
+type Options struct {
+	Endoscopic     bool      // VL Endoscopic objects, instead of Secondary Capture and Video Photographic
+	StudyTime      time.Time // defaults to ContentTime
+	ContentTime    time.Time // defaults to now
+	SeriesNumber   int       // defaults to 1
+	InstanceNumber int       // defaults to 1
+}
+
+func (o *Options) fill() {
+	if o.ContentTime.IsZero() {
+		o.ContentTime = time.Now()
+	}
+	if o.StudyTime.IsZero() {
+		o.StudyTime = o.ContentTime
+	}
+	if o.SeriesNumber <= 0 {
+		o.SeriesNumber = 1
+	}
+	if o.InstanceNumber <= 0 {
+		o.InstanceNumber = 1
+	}
+}
+
+func (m *Metadata) fill() {
+	if m.StudyInstanceUID == "" {
+		m.StudyInstanceUID = NewUID()
+	}
+	if m.SeriesInstanceUID == "" {
+		m.SeriesInstanceUID = NewUID()
+	}
+}
+
+// baseDataset returns the patient, study, series and equipment attributes shared by all objects.
+func baseDataset(m *Metadata, o *Options, sopClassUID string, modality string) Dataset {
+	var ds Dataset
+
+	ds.SetString(TagSpecificCharacterSet, "CS", "ISO_IR 192")
+	ds.SetString(TagImageType, "CS", "ORIGINAL", "PRIMARY")
+	ds.SetString(TagSOPClassUID, "UI", sopClassUID)
+	ds.SetString(TagSOPInstanceUID, "UI", NewUID())
+	ds.SetString(TagStudyDate, "DA", o.StudyTime.Format("20060102"))
+	ds.SetString(TagStudyTime, "TM", o.StudyTime.Format("150405"))
+	ds.SetString(TagContentDate, "DA", o.ContentTime.Format("20060102"))
+	ds.SetString(TagContentTime, "TM", o.ContentTime.Format("150405"))
+	ds.SetString(TagAccessionNumber, "SH", m.AccessionNumber)
+	ds.SetString(TagModality, "CS", modality)
+	ds.SetString(TagManufacturer, "LO", "MediaMTX Pro")
+	ds.SetString(TagInstitutionName, "LO", m.InstitutionName)
+	ds.SetString(TagReferringPhysicianName, "PN", m.ReferringPhysicianName)
+	ds.SetString(TagStudyDescription, "LO", m.StudyDescription)
+	ds.SetString(TagSeriesDescription, "LO", m.SeriesDescription)
+	ds.SetString(TagOperatorsName, "PN", m.OperatorsName)
+
+	ds.SetString(TagPatientName, "PN", m.PatientName)
+	ds.SetString(TagPatientID, "LO", m.PatientID)
+	ds.SetString(TagPatientBirthDate, "DA", m.PatientBirthDate)
+	ds.SetString(TagPatientSex, "CS", m.PatientSex)
+
+	ds.SetString(TagStudyInstanceUID, "UI", m.StudyInstanceUID)
+	ds.SetString(TagSeriesInstanceUID, "UI", m.SeriesInstanceUID)
+	ds.SetString(TagStudyID, "SH", m.StudyID)
+	ds.SetInt(TagSeriesNumber, o.SeriesNumber)
+	ds.SetInt(TagInstanceNumber, o.InstanceNumber)
+	ds.SetString(TagPatientOrientation, "CS")
+
+	ds.SetUint16(TagBitsAllocated, 8)
+	ds.SetUint16(TagBitsStored, 8)
+	ds.SetUint16(TagHighBit, 7)
+	ds.SetUint16(TagPixelRepresentation, 0)
+	ds.SetString(TagLossyImageCompression, "CS", "01")
+
+	if sopClassUID == VLEndoscopicImageStorage || sopClassUID == VideoEndoscopicImageStorage {
+		ds.SetSequence(TagAcquisitionContextSequence)
+	}
+
+	return ds
+}
+
+// jpegIsBaseline checks whether a JPEG image uses the baseline process,
+// the only one allowed by the JPEG Baseline transfer syntax.
+func jpegIsBaseline(buf []byte) bool {
+	for i := 2; i+4 <= len(buf); {
+		if buf[i] != 0xFF {
+			return false
+		}
+
+		marker := buf[i+1]
+		switch {
+		case marker == 0xC0:
+			return true
+
+		case marker >= 0xC1 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			return false
+		}
+
+		i += 2 + int(buf[i+2])<<8 | int(buf[i+3])
+	}
+	return false
+}
+
+// WriteImage writes a JPEG image as a Secondary Capture or VL Endoscopic image,
+// without re-encoding it. It returns the SOP instance UID.
+func WriteImage(w io.Writer, jpegData []byte, m Metadata, o Options) (string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(jpegData))
+	if err != nil {
+		return "", err
+	}
+	if format != "jpeg" || !jpegIsBaseline(jpegData) {
+		return "", fmt.Errorf("only baseline JPEG images are supported")
+	}
+
+	m.fill()
+	o.fill()
+
+	sopClassUID, modality := SecondaryCaptureImageStorage, "OT"
+	if o.Endoscopic {
+		sopClassUID, modality = VLEndoscopicImageStorage, "ES"
+	}
+
+	ds := baseDataset(&m, &o, sopClassUID, modality)
+
+	if sopClassUID == SecondaryCaptureImageStorage {
+		ds.SetString(TagConversionType, "CS", "WSD")
+	}
+
+	if cfg.ColorModel == color.GrayModel {
+		ds.SetUint16(TagSamplesPerPixel, 1)
+		ds.SetString(TagPhotometricInterpretation, "CS", "MONOCHROME2")
+	} else {
+		ds.SetUint16(TagSamplesPerPixel, 3)
+		ds.SetString(TagPhotometricInterpretation, "CS", "YBR_FULL_422")
+		ds.SetUint16(TagPlanarConfiguration, 0)
+	}
+
+	ds.SetUint16(TagRows, uint16(cfg.Height))
+	ds.SetUint16(TagColumns, uint16(cfg.Width))
+	ds.set(&Element{Tag: TagPixelData, VR: "OB", Fragments: [][]byte{jpegData}})
+
+	err = Write(w, JPEGBaseline, ds)
+	if err != nil {
+		return "", err
+	}
+
+	return ds.String(TagSOPInstanceUID), nil
+}
+
+// avcTransferSyntax returns the transfer syntax of a H264 stream.
+// DICOM only defines transfer syntaxes for High Profile streams up to level 4.2
+// and 1920x1080: level 4.1 up to 30 fps (60 fps up to 1280x720), level 4.2 up to 60 fps.
+// Streams outside these limits must be re-encoded.
+func avcTransferSyntax(stream *clipexport.H264Stream) (string, error) {
+	if stream.LevelIdc > 42 {
+		return "", fmt.Errorf("H264 level %d.%d is not supported by DICOM, the maximum is 4.2",
+			stream.LevelIdc/10, stream.LevelIdc%10)
+	}
+
+	if stream.Width > 1920 || stream.Height > 1080 {
+		return "", fmt.Errorf("resolution %dx%d is not supported by DICOM, the maximum is 1920x1080",
+			stream.Width, stream.Height)
+	}
+
+	// allow for the rounding of the average frame rate
+	fps := math.Round(stream.FrameRate())
+	if fps > 60 {
+		return "", fmt.Errorf("frame rate %.0f is not supported by DICOM, the maximum is 60", fps)
+	}
+
+	if stream.LevelIdc <= 41 && (fps <= 30 || stream.Height <= 720) {
+		return MPEG4AVCHPLevel41, nil
+	}
+	return MPEG4AVCHPLevel42, nil
+}
+
+// WriteVideo writes the H264 track of a MP4 or MPEG-TS recording as a Video Photographic
+// or Video Endoscopic image, without re-encoding it. It returns the SOP instance UID.
+// The elementary stream is spooled into tempDir.
+func WriteVideo(w io.Writer, fpath string, tempDir string, m Metadata, o Options, l logger.Writer) (string, error) {
+	tmp, err := os.CreateTemp(tempDir, "dicom-*.h264")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	stream, err := clipexport.WriteH264(fpath, tempDir, tmp, l)
+	if err != nil {
+		return "", err
+	}
+
+	transferSyntax, err := avcTransferSyntax(stream)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	m.fill()
+	o.fill()
+
+	sopClassUID, modality := VideoPhotographicImageStorage, "XC"
+	if o.Endoscopic {
+		sopClassUID, modality = VideoEndoscopicImageStorage, "ES"
+	}
+
+	ds := baseDataset(&m, &o, sopClassUID, modality)
+
+	ds.SetUint16(TagSamplesPerPixel, 3)
+	ds.SetString(TagPhotometricInterpretation, "CS", "YBR_PARTIAL_420")
+	ds.SetUint16(TagPlanarConfiguration, 0)
+	ds.SetUint16(TagRows, uint16(stream.Height))
+	ds.SetUint16(TagColumns, uint16(stream.Width))
+	ds.SetInt(TagNumberOfFrames, stream.Frames)
+	ds.SetTag(TagFrameIncrementPointer, TagFrameTime)
+
+	if fps := stream.FrameRate(); fps > 0 {
+		ds.SetDecimal(TagFrameTime, 1000/fps)
+		ds.SetInt(TagCineRate, int(math.Round(fps)))
+	}
+
+	err = WriteEncapsulated(w, transferSyntax, ds, tmp)
+	if err != nil {
+		return "", err
+	}
+
+	return ds.String(TagSOPInstanceUID), nil
+}
@@ -0,0 +1,281 @@
+package dicom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// File is a parsed DICOM file.
+type File struct {
+	Meta    Dataset
+	Dataset Dataset
+}
+
+// TransferSyntax returns the transfer syntax of the data set.
+func (f *File) TransferSyntax() string {
+	return f.Meta.String(TagTransferSyntaxUID)
+}
+
+// PixelData returns the fragments of encapsulated pixel data, concatenated.
+func (f *File) PixelData() []byte {
+	e := f.Dataset.Find(TagPixelData)
+	if e == nil {
+		return nil
+	}
+	if e.Fragments == nil {
+		return e.Value
+	}
+	return bytes.Join(e.Fragments, nil)
+}
+
+type reader struct {
+	r   *bufio.Reader
+	pos int64
+}
+
+func (r *reader) read(n uint32) ([]byte, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r.r, buf)
+	r.pos += int64(n)
+	return buf, err
+}
+
+func (r *reader) readUint16() (uint16, error) {
+	buf, err := r.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(buf), nil
+}
+
+func (r *reader) readUint32() (uint32, error) {
+	buf, err := r.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(buf), nil
+}
+
+func (r *reader) readTag() (Tag, error) {
+	group, err := r.readUint16()
+	if err != nil {
+		return 0, err
+	}
+	element, err := r.readUint16()
+	if err != nil {
+		return 0, err
+	}
+	return Tag(uint32(group)<<16 | uint32(element)), nil
+}
+
+// readElement reads an element, whose tag has already been read.
+func (r *reader) readElement(tag Tag) (*Element, error) {
+	vrBuf, err := r.read(2)
+	if err != nil {
+		return nil, err
+	}
+	vr := string(vrBuf)
+
+	var length uint32
+
+	if _, ok := longVRs[vr]; ok {
+		_, err = r.read(2)
+		if err != nil {
+			return nil, err
+		}
+		length, err = r.readUint32()
+	} else {
+		var l uint16
+		l, err = r.readUint16()
+		length = uint32(l)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Element{Tag: tag, VR: vr}
+
+	switch {
+	case vr == "SQ":
+		e.Items, err = r.readItems(length)
+		return e, err
+
+	case length == undefinedLength:
+		e.Fragments, err = r.readFragments()
+		return e, err
+
+	default:
+		e.Value, err = r.read(length)
+		return e, err
+	}
+}
+
+// readItems reads items of a sequence.
+func (r *reader) readItems(length uint32) ([]Dataset, error) {
+	items := []Dataset{}
+	end := r.pos + int64(length)
+
+	for length == undefinedLength || r.pos < end {
+		tag, err := r.readTag()
+		if err != nil {
+			return nil, err
+		}
+
+		itemLength, err := r.readUint32()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tag {
+		case tagSequenceDelimitation:
+			return items, nil
+
+		case tagItem:
+			item, err := r.readDataset(itemLength)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+
+		default:
+			return nil, fmt.Errorf("unexpected tag %v inside sequence", tag)
+		}
+	}
+
+	return items, nil
+}
+
+// readFragments reads encapsulated pixel data. The basic offset table is discarded.
+func (r *reader) readFragments() ([][]byte, error) {
+	fragments := [][]byte{}
+	first := true
+
+	for {
+		tag, err := r.readTag()
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := r.readUint32()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tag {
+		case tagSequenceDelimitation:
+			return fragments, nil
+
+		case tagItem:
+			buf, err := r.read(length)
+			if err != nil {
+				return nil, err
+			}
+
+			if !first {
+				fragments = append(fragments, buf)
+			}
+			first = false
+
+		default:
+			return nil, fmt.Errorf("unexpected tag %v inside encapsulated pixel data", tag)
+		}
+	}
+}
+
+// readDataset reads elements until length bytes have been read, the item delimitation or the end of file.
+func (r *reader) readDataset(length uint32) (Dataset, error) {
+	var ds Dataset
+	end := r.pos + int64(length)
+
+	for length == undefinedLength || r.pos < end {
+		tag, err := r.readTag()
+		if err != nil {
+			if errors.Is(err, io.EOF) && length == undefinedLength {
+				return ds, nil
+			}
+			return nil, err
+		}
+
+		if tag == tagItemDelimitation {
+			_, err = r.readUint32()
+			return ds, err
+		}
+
+		e, err := r.readElement(tag)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", tag, err)
+		}
+		ds = append(ds, e)
+	}
+
+	return ds, nil
+}
+
+// ReadMeta reads the preamble and the file meta information of a DICOM file,
+// leaving r at the start of the data set.
+func ReadMeta(r *bufio.Reader) (Dataset, error) {
+	rd := &reader{r: r}
+	return rd.readMeta()
+}
+
+func (r *reader) readMeta() (Dataset, error) {
+	preamble, err := r.read(132)
+	if err != nil {
+		return nil, fmt.Errorf("invalid preamble: %w", err)
+	}
+	if string(preamble[128:]) != "DICM" {
+		return nil, fmt.Errorf("DICM prefix not found")
+	}
+
+	tag, err := r.readTag()
+	if err != nil {
+		return nil, err
+	}
+	if tag != TagFileMetaInformationGroupLength {
+		return nil, fmt.Errorf("file meta information group length not found")
+	}
+
+	e, err := r.readElement(tag)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Value) != 4 {
+		return nil, fmt.Errorf("invalid file meta information group length")
+	}
+
+	meta, err := r.readDataset(binary.LittleEndian.Uint32(e.Value))
+	if err != nil {
+		return nil, err
+	}
+
+	ts := meta.String(TagTransferSyntaxUID)
+	if ts == ImplicitVRLittleEndian || ts == explicitVRBigEndian {
+		return nil, fmt.Errorf("unsupported transfer syntax: %s", ts)
+	}
+
+	return append(Dataset{e}, meta...), nil
+}
+
+// Read reads a DICOM file. Only Explicit VR Little Endian data sets are supported,
+// that include the ones of encapsulated transfer syntaxes.
+func Read(r io.Reader) (*File, error) {
+	rd := &reader{r: bufio.NewReader(r)}
+
+	meta, err := rd.readMeta()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{Meta: meta}
+
+	f.Dataset, err = rd.readDataset(undefinedLength)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
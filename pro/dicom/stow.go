@@ -0,0 +1,184 @@
+package dicom
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+// Attributes of STOW-RS responses, in the DICOM JSON model.
+const (
+	jsonFailedSOPSequence        = "00081198"
+	jsonReferencedSOPInstanceUID = "00081155"
+	jsonFailureReason            = "00081197"
+)
+
+type jsonElement struct {
+	VR    string            `json:"vr"`
+	Value []json.RawMessage `json:"Value"`
+}
+
+type jsonDataset map[string]jsonElement
+
+// failedInstances returns the failure reason of each instance listed in a STOW-RS response.
+func failedInstances(body []byte) (map[string]int, error) {
+	var res jsonDataset
+	err := json.Unmarshal(body, &res)
+	if err != nil {
+		// servers can return an array with a single data set
+		var arr []jsonDataset
+		if json.Unmarshal(body, &arr) != nil || len(arr) != 1 {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		res = arr[0]
+	}
+
+	ret := make(map[string]int)
+
+	for _, raw := range res[jsonFailedSOPSequence].Value {
+		var item jsonDataset
+		err = json.Unmarshal(raw, &item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+
+		var uid string
+		if v := item[jsonReferencedSOPInstanceUID].Value; len(v) == 1 {
+			json.Unmarshal(v[0], &uid) //nolint:errcheck
+		}
+
+		var reason int
+		if v := item[jsonFailureReason].Value; len(v) == 1 {
+			json.Unmarshal(v[0], &reason) //nolint:errcheck
+		}
+
+		ret[uid] = reason
+	}
+
+	return ret, nil
+}
+
+// STOWClient sends DICOM files to a DICOMweb server with STOW-RS.
+type STOWClient struct {
+	URL      string // base URL of the DICOMweb service, files are posted to URL/studies
+	Username string // optional, HTTP basic authentication
+	Password string
+	Client   *http.Client
+}
+
+// Store sends files with a single request and returns an error for each file.
+func (c *STOWClient) Store(ctx context.Context, paths []string) []error {
+	errs := make([]error, len(paths))
+	uids := make([]string, len(paths))
+	var valid []int
+
+	for i, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		meta, err := ReadMeta(bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+
+		uids[i] = meta.String(TagMediaStorageSOPInstanceUID)
+		valid = append(valid, i)
+	}
+
+	if len(valid) == 0 {
+		return errs
+	}
+
+	failAll := func(err error) []error {
+		for _, i := range valid {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeParts(mw, paths, valid))
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.URL, "/")+"/studies", pr)
+	if err != nil {
+		pr.Close()
+		return failAll(err)
+	}
+
+	req.Header.Set("Content-Type", `multipart/related; type="application/dicom"; boundary=`+mw.Boundary())
+	req.Header.Set("Accept", "application/dicom+json")
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return failAll(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1024*1024))
+	if err != nil {
+		return failAll(err)
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return errs
+
+	// some instances failed, or have been stored with warnings
+	case http.StatusAccepted:
+		failed, err := failedInstances(body)
+		if err != nil {
+			return failAll(err)
+		}
+
+		for _, i := range valid {
+			if reason, ok := failed[uids[i]]; ok {
+				errs[i] = fmt.Errorf("STOW-RS failed with reason 0x%04X", reason)
+			}
+		}
+		return errs
+
+	default:
+		return failAll(fmt.Errorf("STOW-RS failed with status %d", res.StatusCode))
+	}
+}
+
+func writeParts(mw *multipart.Writer, paths []string, indexes []int) error {
+	for _, i := range indexes {
+		part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/dicom"}})
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(paths[i])
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(part, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
@@ -0,0 +1,95 @@
+package dicom
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSTOWClient(t *testing.T) {
+	paths := writeTestFiles(t, t.TempDir())
+
+	var parts [][]byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/dicom-web/studies", r.URL.Path)
+		require.Equal(t, "application/dicom+json", r.Header.Get("Accept"))
+
+		user, pass, ok := r.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "user", user)
+		require.Equal(t, "pass", pass)
+
+		mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		require.Equal(t, "multipart/related", mediaType)
+		require.Equal(t, "application/dicom", params["type"])
+
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			require.Equal(t, "application/dicom", part.Header.Get("Content-Type"))
+
+			buf, err := io.ReadAll(part)
+			require.NoError(t, err)
+			parts = append(parts, buf)
+		}
+
+		// the second instance fails
+		f, err := Read(bytes.NewReader(parts[1]))
+		require.NoError(t, err)
+
+		w.Header().Set("Content-Type", "application/dicom+json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"00081198":{"vr":"SQ","Value":[{` + //nolint:errcheck
+			`"00081155":{"vr":"UI","Value":["` + f.Dataset.String(TagSOPInstanceUID) + `"]},` +
+			`"00081197":{"vr":"US","Value":[272]}}]}}`))
+	}))
+	defer srv.Close()
+
+	c := &STOWClient{
+		URL:      srv.URL + "/dicom-web/",
+		Username: "user",
+		Password: "pass",
+		Client:   srv.Client(),
+	}
+
+	errs := c.Store(context.Background(), paths)
+	require.NoError(t, errs[0])
+	require.EqualError(t, errs[1], "STOW-RS failed with reason 0x0110")
+
+	require.Len(t, parts, 2)
+	for i, p := range paths {
+		buf, err := os.ReadFile(p)
+		require.NoError(t, err)
+		require.Equal(t, buf, parts[i])
+	}
+}
+
+func TestSTOWClientError(t *testing.T) {
+	paths := writeTestFiles(t, t.TempDir())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body) //nolint:errcheck
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer srv.Close()
+
+	c := &STOWClient{URL: srv.URL, Client: srv.Client()}
+
+	errs := c.Store(context.Background(), paths)
+	require.EqualError(t, errs[0], "STOW-RS failed with status 409")
+	require.EqualError(t, errs[1], "STOW-RS failed with status 409")
+}
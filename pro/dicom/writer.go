@@ -0,0 +1,266 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Transfer syntaxes.
+const (
+	ImplicitVRLittleEndian = "1.2.840.10008.1.2"
+	ExplicitVRLittleEndian = "1.2.840.10008.1.2.1"
+	JPEGBaseline           = "1.2.840.10008.1.2.4.50"
+	MPEG4AVCHPLevel41      = "1.2.840.10008.1.2.4.102"
+	MPEG4AVCHPLevel42      = "1.2.840.10008.1.2.4.104"
+)
+
+// explicitVRBigEndian is retired and not supported.
+const explicitVRBigEndian = "1.2.840.10008.1.2.2"
+
+const (
+	// ImplementationClassUID identifies files written by this package.
+	ImplementationClassUID = "2.25.160714281236593620431513519464733361573"
+
+	implementationVersionName = "MEDIAMTX_PRO"
+
+	// fragmentSize is the maximum size of fragments of encapsulated pixel data.
+	fragmentSize = 16 * 1024 * 1024
+)
+
+// longVRs are VRs whose length is encoded with 32 bits, after 2 reserved bytes.
+var longVRs = map[string]struct{}{
+	"OB": {}, "OD": {}, "OF": {}, "OL": {}, "OV": {}, "OW": {},
+	"SQ": {}, "SV": {}, "UC": {}, "UN": {}, "UR": {}, "UT": {}, "UV": {},
+}
+
+func writeTag(w io.Writer, tag Tag) error {
+	var buf [4]byte
+	binary.LittleEndian.PutUint16(buf[:], tag.Group())
+	binary.LittleEndian.PutUint16(buf[2:], tag.Element())
+	_, err := w.Write(buf[:])
+	return err
+}
+
+func writeHeader(w io.Writer, tag Tag, vr string, length uint32) error {
+	err := writeTag(w, tag)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := longVRs[vr]; ok {
+		var buf [8]byte
+		copy(buf[:], vr)
+		binary.LittleEndian.PutUint32(buf[4:], length)
+		_, err = w.Write(buf[:])
+		return err
+	}
+
+	if length > 0xFFFF {
+		return fmt.Errorf("value of %v is too long for VR %s", tag, vr)
+	}
+
+	var buf [4]byte
+	copy(buf[:], vr)
+	binary.LittleEndian.PutUint16(buf[2:], uint16(length))
+	_, err = w.Write(buf[:])
+	return err
+}
+
+// writeItem writes an item or a fragment of encapsulated pixel data, padded to an even length.
+func writeItem(w io.Writer, buf []byte) error {
+	length := len(buf) + len(buf)%2
+
+	err := writeTag(w, tagItem)
+	if err != nil {
+		return err
+	}
+
+	var l [4]byte
+	binary.LittleEndian.PutUint32(l[:], uint32(length))
+	_, err = w.Write(l[:])
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	if len(buf)%2 != 0 {
+		_, err = w.Write([]byte{0})
+	}
+	return err
+}
+
+func writeDelimitation(w io.Writer, tag Tag) error {
+	err := writeTag(w, tag)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+func writeElement(w io.Writer, e *Element) error {
+	switch {
+	case e.VR == "SQ":
+		var items bytes.Buffer
+		for _, item := range e.Items {
+			var buf bytes.Buffer
+			err := writeDataset(&buf, item)
+			if err != nil {
+				return err
+			}
+
+			err = writeItem(&items, buf.Bytes())
+			if err != nil {
+				return err
+			}
+		}
+
+		err := writeHeader(w, e.Tag, e.VR, uint32(items.Len()))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(items.Bytes())
+		return err
+
+	case e.Fragments != nil:
+		return writeEncapsulated(w, e.Tag, func(yield func([]byte) error) error {
+			for _, f := range e.Fragments {
+				err := yield(f)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+	default:
+		value := e.Value
+		if len(value)%2 != 0 {
+			value = append(append([]byte(nil), value...), 0)
+		}
+
+		err := writeHeader(w, e.Tag, e.VR, uint32(len(value)))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(value)
+		return err
+	}
+}
+
+// writeEncapsulated writes encapsulated pixel data with an empty basic offset table.
+func writeEncapsulated(w io.Writer, tag Tag, fragments func(yield func([]byte) error) error) error {
+	err := writeHeader(w, tag, "OB", undefinedLength)
+	if err != nil {
+		return err
+	}
+
+	// basic offset table
+	err = writeItem(w, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fragments(func(buf []byte) error {
+		return writeItem(w, buf)
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeDelimitation(w, tagSequenceDelimitation)
+}
+
+func writeDataset(w io.Writer, ds Dataset) error {
+	for _, e := range ds.sorted() {
+		err := writeElement(w, e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMeta(w io.Writer, sopClassUID string, sopInstanceUID string, transferSyntax string) error {
+	var meta Dataset
+	meta.set(&Element{Tag: TagFileMetaInformationVersion, VR: "OB", Value: []byte{0, 1}})
+	meta.SetString(TagMediaStorageSOPClassUID, "UI", sopClassUID)
+	meta.SetString(TagMediaStorageSOPInstanceUID, "UI", sopInstanceUID)
+	meta.SetString(TagTransferSyntaxUID, "UI", transferSyntax)
+	meta.SetString(TagImplementationClassUID, "UI", ImplementationClassUID)
+	meta.SetString(TagImplementationVersionName, "SH", implementationVersionName)
+
+	var buf bytes.Buffer
+	err := writeDataset(&buf, meta)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(make([]byte, 128))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte("DICM"))
+	if err != nil {
+		return err
+	}
+
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(buf.Len()))
+
+	err = writeElement(w, &Element{Tag: TagFileMetaInformationGroupLength, VR: "UL", Value: length})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// Write writes a DICOM file. SOP class and instance UIDs are read from the data set.
+func Write(w io.Writer, transferSyntax string, ds Dataset) error {
+	err := writeMeta(w, ds.String(TagSOPClassUID), ds.String(TagSOPInstanceUID), transferSyntax)
+	if err != nil {
+		return err
+	}
+
+	return writeDataset(w, ds)
+}
+
+// WriteEncapsulated writes a DICOM file whose pixel data is read from r
+// and split into fragments. The data set must not contain pixel data.
+func WriteEncapsulated(w io.Writer, transferSyntax string, ds Dataset, r io.Reader) error {
+	err := Write(w, transferSyntax, ds)
+	if err != nil {
+		return err
+	}
+
+	return writeEncapsulated(w, TagPixelData, func(yield func([]byte) error) error {
+		buf := make([]byte, fragmentSize)
+
+		for {
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				err2 := yield(buf[:n])
+				if err2 != nil {
+					return err2
+				}
+			}
+
+			switch err {
+			case nil:
+			case io.EOF, io.ErrUnexpectedEOF:
+				return nil
+			default:
+				return err
+			}
+		}
+	})
+}
@@ -0,0 +1,451 @@
+// Package exportjobs contains the Pro export job queue.
+package exportjobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	defaultWorkers   = 2
+	defaultMaxQueued = 100
+	defaultRetention = 24 * time.Hour
+
+	// purgeInterval is the interval between checks of expired jobs.
+	purgeInterval = time.Minute
+)
+
+// Errors.
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job is already finished")
+	ErrQueueFull   = errors.New("too many queued jobs")
+	ErrQueueClosed = errors.New("job queue is closed")
+)
+
+// Status is the status of a job.
+type Status string
+
+// Statuses.
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Job is a snapshot of the state of a job.
+type Job struct {
+	ID         string     `json:"id"`
+	Status     Status     `json:"status"`
+	Progress   int        `json:"progress"` // percent
+	Outfile    string     `json:"outfile,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Finished returns whether the job is completed, failed or canceled.
+func (j Job) Finished() bool {
+	return j.Status == StatusCompleted || j.Status == StatusFailed || j.Status == StatusCanceled
+}
+
+// RunFunc runs a job.
+// It writes its files into dir, reports progress (from 0 to 1) and returns the path of the result,
+// that must be inside dir. It must return when ctx is canceled.
+type RunFunc func(ctx context.Context, dir string, progress func(float64)) (string, error)
+
+type job struct {
+	Job
+
+	run    RunFunc
+	dir    string
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Queue runs jobs on a bounded set of workers.
+// Every job has its own folder inside WorkDir: when a job completes, everything but the result is removed;
+// when it fails or is canceled, the whole folder is removed. Finished jobs and their results
+// are removed after Retention.
+type Queue struct {
+	Workers   int           // number of jobs that run at the same time, defaults to 2
+	MaxQueued int           // number of jobs waiting for a worker, defaults to 100
+	Retention time.Duration // defaults to 24h
+	WorkDir   string
+	URL       func(fpath string) string // optional, converts the path of results into the one returned to clients
+	OnUpdate  func(Job)                 // optional, called when the status or the progress of a job changes
+	Parent    logger.Writer
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	mutex     sync.Mutex
+	jobs      map[string]*job
+	queue     chan *job
+	wg        sync.WaitGroup
+}
+
+// Initialize initializes the Queue.
+func (q *Queue) Initialize() error {
+	if q.Workers <= 0 {
+		q.Workers = defaultWorkers
+	}
+	if q.MaxQueued <= 0 {
+		q.MaxQueued = defaultMaxQueued
+	}
+	if q.Retention <= 0 {
+		q.Retention = defaultRetention
+	}
+
+	err := os.MkdirAll(q.WorkDir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	q.ctx, q.ctxCancel = context.WithCancel(context.Background())
+	q.jobs = make(map[string]*job)
+	q.queue = make(chan *job, q.MaxQueued)
+
+	// folders left by a previous run don't belong to any job
+	q.purgeFolders(time.Now())
+
+	for i := 0; i < q.Workers; i++ {
+		q.wg.Add(1)
+		go q.runWorker()
+	}
+
+	q.wg.Add(1)
+	go q.runPurger()
+
+	q.Log(logger.Info, "started with %d workers", q.Workers)
+
+	return nil
+}
+
+// Close closes the Queue. Running jobs are canceled.
+func (q *Queue) Close() {
+	q.ctxCancel()
+	q.wg.Wait()
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	// release callers of Wait()
+	for _, j := range q.jobs {
+		if j.Status == StatusQueued {
+			q.finish(j, StatusCanceled, "", "")
+		}
+	}
+}
+
+// Log implements logger.Writer.
+func (q *Queue) Log(level logger.Level, format string, args ...interface{}) {
+	q.Parent.Log(level, "[export jobs] "+format, args...)
+}
+
+// Submit adds a job to the queue.
+func (q *Queue) Submit(run RunFunc) (Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.ctx.Err() != nil {
+		return Job{}, ErrQueueClosed
+	}
+
+	j := &job{
+		Job: Job{
+			ID:        uuid.New().String(),
+			Status:    StatusQueued,
+			CreatedAt: time.Now(),
+		},
+		run:  run,
+		done: make(chan struct{}),
+	}
+	j.dir = filepath.Join(q.WorkDir, j.ID)
+	j.ctx, j.cancel = context.WithCancel(q.ctx)
+
+	select {
+	case q.queue <- j:
+	default:
+		j.cancel()
+		return Job{}, ErrQueueFull
+	}
+
+	q.jobs[j.ID] = j
+	q.Log(logger.Info, "job %s queued", j.ID)
+
+	return j.Job, nil
+}
+
+// Get returns a job.
+func (q *Queue) Get(id string) (Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	j, ok := q.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return j.Job, nil
+}
+
+// List returns all jobs, newest first.
+func (q *Queue) List() []Job {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	ret := make([]Job, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		ret = append(ret, j.Job)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].CreatedAt.After(ret[j].CreatedAt)
+	})
+
+	return ret
+}
+
+// Cancel cancels a queued or running job.
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.mutex.Lock()
+
+	j, ok := q.jobs[id]
+	if !ok {
+		q.mutex.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+
+	switch j.Status {
+	case StatusQueued:
+		// the worker that dequeues the job skips it
+		j.cancel()
+		q.finish(j, StatusCanceled, "", "")
+		ret := j.Job
+		q.mutex.Unlock()
+		q.notify(ret)
+		return ret, nil
+
+	case StatusRunning:
+		// the job is finished by its worker once RunFunc returns
+		j.cancel()
+		ret := j.Job
+		q.mutex.Unlock()
+		return ret, nil
+
+	default:
+		ret := j.Job
+		q.mutex.Unlock()
+		return ret, ErrJobFinished
+	}
+}
+
+// Wait waits until a job is finished.
+func (q *Queue) Wait(ctx context.Context, id string) (Job, error) {
+	q.mutex.Lock()
+	j, ok := q.jobs[id]
+	q.mutex.Unlock()
+
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return j.Job, nil
+}
+
+func (q *Queue) notify(j Job) {
+	if q.OnUpdate != nil {
+		q.OnUpdate(j)
+	}
+}
+
+func (q *Queue) runWorker() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case j := <-q.queue:
+			q.runJob(j)
+
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *Queue) runJob(j *job) {
+	q.mutex.Lock()
+	if j.Status != StatusQueued {
+		q.mutex.Unlock()
+		return
+	}
+	now := time.Now()
+	j.Status = StatusRunning
+	j.StartedAt = &now
+	started := j.Job
+	q.mutex.Unlock()
+
+	q.notify(started)
+	q.Log(logger.Info, "job %s started", j.ID)
+
+	result, err := q.execute(j)
+
+	q.mutex.Lock()
+	switch {
+	case err == nil:
+		q.clean(j, result)
+		q.finish(j, StatusCompleted, result, "")
+
+	case j.ctx.Err() != nil:
+		os.RemoveAll(j.dir)
+		q.finish(j, StatusCanceled, "", "")
+
+	default:
+		os.RemoveAll(j.dir)
+		q.finish(j, StatusFailed, "", err.Error())
+	}
+	finished := j.Job
+	q.mutex.Unlock()
+
+	switch finished.Status {
+	case StatusCompleted:
+		q.Log(logger.Info, "job %s completed in %v", j.ID, finished.FinishedAt.Sub(*finished.StartedAt))
+	case StatusCanceled:
+		q.Log(logger.Info, "job %s canceled", j.ID)
+	default:
+		q.Log(logger.Error, "job %s failed: %s", j.ID, finished.Error)
+	}
+
+	q.notify(finished)
+}
+
+func (q *Queue) execute(j *job) (string, error) {
+	err := os.MkdirAll(j.dir, 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	return j.run(j.ctx, j.dir, func(p float64) {
+		// percent is capped at 99 until the job is completed
+		percent := int(p * 100)
+		if percent < 0 {
+			percent = 0
+		} else if percent > 99 {
+			percent = 99
+		}
+
+		q.mutex.Lock()
+		if j.Status != StatusRunning || percent == j.Progress {
+			q.mutex.Unlock()
+			return
+		}
+		j.Progress = percent
+		cur := j.Job
+		q.mutex.Unlock()
+
+		q.notify(cur)
+	})
+}
+
+// finish sets the final state of a job. It must be called with the mutex locked.
+func (q *Queue) finish(j *job, status Status, result string, errMsg string) {
+	now := time.Now()
+	j.Status = status
+	j.FinishedAt = &now
+	j.Error = errMsg
+
+	if status == StatusCompleted {
+		j.Progress = 100
+		j.Outfile = result
+		if q.URL != nil {
+			j.Outfile = q.URL(result)
+		}
+	}
+
+	j.cancel()
+	close(j.done)
+}
+
+// clean removes intermediate files of a completed job.
+func (q *Queue) clean(j *job, result string) {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		fpath := filepath.Join(j.dir, entry.Name())
+		if fpath != filepath.Clean(result) {
+			os.RemoveAll(fpath)
+		}
+	}
+}
+
+func (q *Queue) runPurger() {
+	defer q.wg.Done()
+
+	t := time.NewTicker(purgeInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			q.purge(time.Now())
+
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
+
+// purge removes jobs that finished more than Retention ago, together with their folders.
+func (q *Queue) purge(now time.Time) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for id, j := range q.jobs {
+		if j.FinishedAt != nil && now.Sub(*j.FinishedAt) >= q.Retention {
+			os.RemoveAll(j.dir)
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// purgeFolders removes folders that don't belong to any job and are older than Retention.
+func (q *Queue) purgeFolders(now time.Time) {
+	entries, err := os.ReadDir(q.WorkDir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < q.Retention {
+			continue
+		}
+
+		fpath := filepath.Join(q.WorkDir, entry.Name())
+		q.Log(logger.Debug, "removing expired folder %s", fpath)
+		os.RemoveAll(fpath)
+	}
+}
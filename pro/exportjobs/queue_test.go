@@ -0,0 +1,209 @@
+package exportjobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+// blockingJob returns a job that writes an intermediate file and a result,
+// then waits until release is closed or the job is canceled.
+func blockingJob(started chan<- string, release <-chan struct{}) RunFunc {
+	return func(ctx context.Context, dir string, progress func(float64)) (string, error) {
+		err := os.WriteFile(filepath.Join(dir, "part.mp4"), []byte{1}, 0o644)
+		if err != nil {
+			return "", err
+		}
+
+		started <- dir
+		progress(0.5)
+
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+
+		result := filepath.Join(dir, "result.mp4")
+		return result, os.WriteFile(result, []byte{2}, 0o644)
+	}
+}
+
+func TestQueueComplete(t *testing.T) {
+	var mutex sync.Mutex
+	var updates []Job
+
+	q := &Queue{
+		WorkDir: t.TempDir(),
+		URL:     func(fpath string) string { return "/url/" + filepath.Base(fpath) },
+		OnUpdate: func(j Job) {
+			mutex.Lock()
+			updates = append(updates, j)
+			mutex.Unlock()
+		},
+		Parent: test.NilLogger,
+	}
+	err := q.Initialize()
+	require.NoError(t, err)
+	defer q.Close()
+
+	started := make(chan string, 1)
+	release := make(chan struct{})
+
+	j, err := q.Submit(blockingJob(started, release))
+	require.NoError(t, err)
+	require.Equal(t, StatusQueued, j.Status)
+
+	dir := <-started
+	close(release)
+
+	j, err = q.Wait(context.Background(), j.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCompleted, j.Status)
+	require.Equal(t, 100, j.Progress)
+	require.Equal(t, "/url/result.mp4", j.Outfile)
+
+	// intermediate files are removed, the result is kept
+	_, err = os.Stat(filepath.Join(dir, "part.mp4"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "result.mp4"))
+	require.NoError(t, err)
+
+	mutex.Lock()
+	statuses := make([]Status, len(updates))
+	progress := make([]int, len(updates))
+	for i, u := range updates {
+		statuses[i] = u.Status
+		progress[i] = u.Progress
+	}
+	mutex.Unlock()
+	require.Equal(t, []Status{StatusRunning, StatusRunning, StatusCompleted}, statuses)
+	require.Equal(t, []int{0, 50, 100}, progress)
+
+	// the job and its result are removed after the retention period
+	q.purge(time.Now().Add(q.Retention))
+	_, err = q.Get(j.ID)
+	require.Equal(t, ErrJobNotFound, err)
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestQueueFailure(t *testing.T) {
+	q := &Queue{
+		WorkDir: t.TempDir(),
+		Parent:  test.NilLogger,
+	}
+	err := q.Initialize()
+	require.NoError(t, err)
+	defer q.Close()
+
+	var dir string
+
+	j, err := q.Submit(func(_ context.Context, d string, _ func(float64)) (string, error) {
+		dir = d
+		return "", errors.New("no key frames found")
+	})
+	require.NoError(t, err)
+
+	j, err = q.Wait(context.Background(), j.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusFailed, j.Status)
+	require.Equal(t, "no key frames found", j.Error)
+
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestQueueWorkers(t *testing.T) {
+	q := &Queue{
+		Workers: 1,
+		WorkDir: t.TempDir(),
+		Parent:  test.NilLogger,
+	}
+	err := q.Initialize()
+	require.NoError(t, err)
+	defer q.Close()
+
+	started := make(chan string, 2)
+	release := make(chan struct{})
+
+	j1, err := q.Submit(blockingJob(started, release))
+	require.NoError(t, err)
+	j2, err := q.Submit(blockingJob(started, release))
+	require.NoError(t, err)
+
+	dir1 := <-started
+
+	// the second job waits for the only worker
+	select {
+	case <-started:
+		t.Fatal("second job started before the first one finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	j2, err = q.Get(j2.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusQueued, j2.Status)
+
+	// cancel the running job
+	j1, err = q.Cancel(j1.ID)
+	require.NoError(t, err)
+
+	j1, err = q.Wait(context.Background(), j1.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCanceled, j1.Status)
+
+	_, err = os.Stat(dir1)
+	require.True(t, os.IsNotExist(err))
+
+	_, err = q.Cancel(j1.ID)
+	require.Equal(t, ErrJobFinished, err)
+
+	<-started
+	close(release)
+
+	j2, err = q.Wait(context.Background(), j2.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCompleted, j2.Status)
+
+	jobs := q.List()
+	require.Len(t, jobs, 2)
+}
+
+func TestQueueCancelQueued(t *testing.T) {
+	q := &Queue{
+		Workers: 1,
+		WorkDir: t.TempDir(),
+		Parent:  test.NilLogger,
+	}
+	err := q.Initialize()
+	require.NoError(t, err)
+	defer q.Close()
+
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	defer close(release)
+
+	_, err = q.Submit(blockingJob(started, release))
+	require.NoError(t, err)
+	<-started
+
+	j, err := q.Submit(blockingJob(started, release))
+	require.NoError(t, err)
+
+	j, err = q.Cancel(j.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusCanceled, j.Status)
+	require.Nil(t, j.StartedAt)
+
+	_, err = q.Cancel("unknown")
+	require.Equal(t, ErrJobNotFound, err)
+}
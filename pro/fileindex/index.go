@@ -0,0 +1,505 @@
+// Package fileindex contains the Pro index of recordings and snapshots.
+package fileindex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+	"github.com/bluenviron/mediamtx/pro/recorder"
+)
+
+// FileName is the name of the index, in the record path.
+const FileName = "record_index.json"
+
+// saveInterval is the interval between writes of a modified index to disk.
+const saveInterval = 5 * time.Second
+
+// File types.
+const (
+	TypeVideo = "video"
+	TypeImage = "image"
+)
+
+// favoriteFolder is the folder of the record path that contains favorite files.
+const favoriteFolder = "favorite"
+
+// skippedFolders are folders of the record path that don't contain recordings.
+var skippedFolders = map[string]struct{}{
+	"tmp":   {},
+	"trash": {},
+}
+
+// Entry is a file of the index.
+type Entry struct {
+	Path       string     `json:"path"` // relative to the record path, slash separated
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	PathName   string     `json:"pathName,omitempty"`
+	SourceName string     `json:"sourceName,omitempty"`
+	GroupName  string     `json:"groupName,omitempty"`
+	Start      *time.Time `json:"start,omitempty"` // start of recordings, when known
+	End        *time.Time `json:"end,omitempty"`   // end of recordings, paused intervals included
+	Duration   float64    `json:"duration"`        // seconds, zero for snapshots
+	Size       int64      `json:"size"`
+	ModTime    time.Time  `json:"modTime"`
+	Favorite   bool       `json:"favorite"`
+	Tags       []string   `json:"tags,omitempty"` // labels of bookmarks
+}
+
+// time returns the time used to sort and filter the entry.
+func (e *Entry) time() time.Time {
+	if e.Start != nil {
+		return *e.Start
+	}
+	return e.ModTime
+}
+
+// endTime returns the end of the entry, used to filter it.
+func (e *Entry) endTime() time.Time {
+	if e.End != nil {
+		return *e.End
+	}
+	return e.time().Add(time.Duration(e.Duration * float64(time.Second)))
+}
+
+// Stats contains counters of the index.
+type Stats struct {
+	Files      int   `json:"files"`
+	Videos     int   `json:"videos"`
+	Images     int   `json:"images"`
+	Size       int64 `json:"size"`
+	Rebuilding bool  `json:"rebuilding"`
+}
+
+// fileType returns the type of a file, or an empty string when the file is not indexed.
+func fileType(fpath string) string {
+	switch strings.ToLower(filepath.Ext(fpath)) {
+	case ".mp4", ".ts", ".mkv", ".avi":
+		return TypeVideo
+
+	case ".jpg", ".jpeg", ".png":
+		return TypeImage
+	}
+	return ""
+}
+
+// Index is an index of the recordings and snapshots inside the record path,
+// that allows to count and search files without scanning folders.
+// It is saved on disk and rebuilt from disk when missing or on demand.
+type Index struct {
+	RecordPath string
+	FilePath   string                // defaults to FileName inside RecordPath
+	PathConfs  map[string]*conf.Path // provide source and group names of paths
+	Parent     logger.Writer
+
+	mutex      sync.RWMutex
+	entries    map[string]*Entry // key: relative path
+	dirty      bool
+	rebuilding bool
+	terminate  chan struct{}
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// Initialize initializes the Index.
+func (x *Index) Initialize() error {
+	if x.FilePath == "" {
+		x.FilePath = filepath.Join(x.RecordPath, FileName)
+	}
+
+	x.entries = make(map[string]*Entry)
+	x.terminate = make(chan struct{})
+	x.done = make(chan struct{})
+
+	loaded, err := x.load()
+	if err != nil {
+		x.Log(logger.Warn, "%v, rebuilding", err)
+	}
+
+	// the index is built from disk when it doesn't exist yet
+	if !loaded {
+		x.rebuilding = true
+		x.wg.Add(1)
+		go func() {
+			defer x.wg.Done()
+			x.rebuild() //nolint:errcheck
+		}()
+	}
+
+	go x.run()
+
+	return nil
+}
+
+// Close closes the Index and writes it to disk.
+func (x *Index) Close() {
+	close(x.terminate)
+	<-x.done
+	x.wg.Wait()
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if x.dirty {
+		x.save()
+	}
+}
+
+// Log implements logger.Writer.
+func (x *Index) Log(level logger.Level, format string, args ...interface{}) {
+	x.Parent.Log(level, "[file index] "+format, args...)
+}
+
+// ReloadPathConfs is called by core.Core.
+// Source and group names of existing entries are updated at the next rebuild.
+func (x *Index) ReloadPathConfs(pathConfs map[string]*conf.Path) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	x.PathConfs = pathConfs
+}
+
+func (x *Index) run() {
+	defer close(x.done)
+
+	t := time.NewTicker(saveInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			x.mutex.Lock()
+			if x.dirty {
+				x.save()
+			}
+			x.mutex.Unlock()
+
+		case <-x.terminate:
+			return
+		}
+	}
+}
+
+// relativePath converts the path of a file into the key of its entry.
+func (x *Index) relativePath(fpath string) (string, error) {
+	root, err := filepath.Abs(x.RecordPath)
+	if err != nil {
+		return "", err
+	}
+
+	fpath, err = filepath.Abs(fpath)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, fpath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the record path", fpath)
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+// describe fills source and group names of an entry. Must be called with the mutex held.
+func (x *Index) describe(e *Entry) {
+	if e.PathName == "" {
+		return
+	}
+
+	pathConf, _, err := conf.FindPathConf(x.PathConfs, e.PathName)
+	if err != nil {
+		return
+	}
+
+	if pathConf.SourceName != nil {
+		e.SourceName = *pathConf.SourceName
+	}
+	if pathConf.GroupName != nil {
+		e.GroupName = *pathConf.GroupName
+	}
+}
+
+// newEntry reads a file and its sidecar files. It returns nil when the file is not indexed.
+func newEntry(rel string, fpath string, info fs.FileInfo) *Entry {
+	typ := fileType(fpath)
+	if typ == "" {
+		return nil
+	}
+
+	e := &Entry{
+		Path:     rel,
+		Name:     filepath.Base(fpath),
+		Type:     typ,
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Favorite: strings.HasPrefix(rel, favoriteFolder+"/"),
+	}
+
+	if m, err := recordstore.ReadMetadata(fpath); err == nil {
+		e.PathName = m.PathName
+		if !m.Start.IsZero() {
+			start, end := m.Start, m.End()
+			e.Start = &start
+			e.End = &end
+		}
+		e.Duration = m.Duration
+	}
+
+	if typ == TypeVideo {
+		bookmarks, err := recorder.ReadBookmarks(fpath)
+		if err == nil {
+			seen := make(map[string]struct{})
+			for _, b := range bookmarks {
+				if _, ok := seen[b.Label]; !ok && b.Label != "" {
+					seen[b.Label] = struct{}{}
+					e.Tags = append(e.Tags, b.Label)
+				}
+			}
+		}
+	}
+
+	return e
+}
+
+// Add adds or updates a file.
+func (x *Index) Add(fpath string) error {
+	rel, err := x.relativePath(fpath)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return err
+	}
+
+	e := newEntry(rel, fpath, info)
+	if e == nil {
+		return nil
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	x.describe(e)
+	x.entries[rel] = e
+	x.dirty = true
+
+	return nil
+}
+
+// Move updates the path of a file that has been renamed or moved.
+func (x *Index) Move(oldPath string, newPath string) error {
+	oldRel, err := x.relativePath(oldPath)
+	if err != nil {
+		return err
+	}
+
+	x.mutex.Lock()
+	delete(x.entries, oldRel)
+	x.dirty = true
+	x.mutex.Unlock()
+
+	// the file is read again, since its sidecar files have been moved too
+	return x.Add(newPath)
+}
+
+// Remove removes a file.
+func (x *Index) Remove(fpath string) error {
+	rel, err := x.relativePath(fpath)
+	if err != nil {
+		return err
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if _, ok := x.entries[rel]; ok {
+		delete(x.entries, rel)
+		x.dirty = true
+	}
+
+	return nil
+}
+
+// RemoveDir removes all files inside a folder.
+func (x *Index) RemoveDir(dirPath string) error {
+	rel, err := x.relativePath(dirPath)
+	if err != nil {
+		return err
+	}
+	prefix := rel + "/"
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	for key := range x.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(x.entries, key)
+			x.dirty = true
+		}
+	}
+
+	return nil
+}
+
+// Rebuild rebuilds the index from disk and returns the number of indexed files.
+func (x *Index) Rebuild() (int, error) {
+	x.mutex.Lock()
+	if x.rebuilding {
+		x.mutex.Unlock()
+		return 0, fmt.Errorf("index is already being rebuilt")
+	}
+	x.rebuilding = true
+	x.mutex.Unlock()
+
+	return x.rebuild()
+}
+
+func (x *Index) rebuild() (int, error) {
+	started := time.Now()
+	entries := make(map[string]*Entry)
+
+	root, _ := filepath.Abs(x.RecordPath)
+
+	err := filepath.WalkDir(root, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// the record path doesn't exist yet
+			if fpath == root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return nil // skip errors
+		}
+
+		if d.IsDir() {
+			if _, ok := skippedFolders[d.Name()]; ok && filepath.Dir(fpath) == root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, fpath)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		if e := newEntry(rel, fpath, info); e != nil {
+			entries[rel] = e
+		}
+		return nil
+	})
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	x.rebuilding = false
+
+	if err != nil {
+		x.Log(logger.Error, "rebuild failed: %v", err)
+		return 0, err
+	}
+
+	for _, e := range entries {
+		x.describe(e)
+	}
+
+	x.entries = entries
+	x.save()
+
+	x.Log(logger.Info, "%d files indexed in %v", len(entries), time.Since(started).Round(time.Millisecond))
+
+	return len(entries), nil
+}
+
+// Stats returns counters of the index.
+func (x *Index) Stats() Stats {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	s := Stats{Rebuilding: x.rebuilding}
+
+	for _, e := range x.entries {
+		s.Files++
+		s.Size += e.Size
+		switch e.Type {
+		case TypeVideo:
+			s.Videos++
+		case TypeImage:
+			s.Images++
+		}
+	}
+
+	return s
+}
+
+// load reads the index from disk. It returns false when the index must be rebuilt.
+func (x *Index) load() (bool, error) {
+	buf, err := os.ReadFile(x.FilePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var entries []*Entry
+	err = json.Unmarshal(buf, &entries)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file index %s: %w", x.FilePath, err)
+	}
+
+	for _, e := range entries {
+		x.entries[e.Path] = e
+	}
+
+	x.Log(logger.Info, "%d files loaded from %s", len(entries), x.FilePath)
+
+	return true, nil
+}
+
+// save writes the index to disk. Must be called with the mutex held.
+func (x *Index) save() {
+	entries := make([]*Entry, 0, len(x.entries))
+	for _, e := range x.entries {
+		entries = append(entries, e)
+	}
+	sortEntries(entries, SortTime, true)
+
+	buf, err := json.Marshal(entries)
+	if err != nil {
+		x.Log(logger.Error, "failed to encode file index: %v", err)
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(x.FilePath), 0o755)
+	if err == nil {
+		// the file is replaced atomically, therefore a crash never leaves a partial index
+		tmpPath := x.FilePath + ".tmp"
+		err = os.WriteFile(tmpPath, buf, 0o644)
+		if err == nil {
+			err = os.Rename(tmpPath, x.FilePath)
+		}
+	}
+	if err != nil {
+		x.Log(logger.Error, "failed to write file index %s: %v", x.FilePath, err)
+		return
+	}
+
+	x.dirty = false
+}
@@ -0,0 +1,217 @@
+package fileindex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/pro/recorder"
+)
+
+func writeTestFile(t *testing.T, fpath string, size int, m *recordstore.Metadata) {
+	err := os.MkdirAll(filepath.Dir(fpath), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(fpath, make([]byte, size), 0o644)
+	require.NoError(t, err)
+
+	if m != nil {
+		err = recordstore.WriteMetadata(fpath, m)
+		require.NoError(t, err)
+	}
+}
+
+func searchPaths(res Result) []string {
+	ret := []string{}
+	for _, e := range res.Entries {
+		ret = append(ret, e.Path)
+	}
+	return ret
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+
+	start := time.Date(2024, 5, 19, 10, 0, 0, 0, time.UTC)
+	source := "Camera 1"
+	group := "ward A"
+
+	writeTestFile(t, filepath.Join(dir, "20240519", "20240519-1000-aaaaaaaa.mp4"), 100, &recordstore.Metadata{
+		PathName: "cam1",
+		Start:    start,
+		Duration: 60,
+	})
+	writeTestFile(t, filepath.Join(dir, "20240519", "20240519-1100-bbbbbbbb.ts"), 300, &recordstore.Metadata{
+		PathName: "cam2",
+		Start:    start.Add(time.Hour),
+		Duration: 600,
+	})
+	writeTestFile(t, filepath.Join(dir, "20240519", "1716112800000-snapshot.jpg"), 10, &recordstore.Metadata{
+		PathName: "cam1",
+		Start:    start.Add(2 * time.Hour),
+	})
+	writeTestFile(t, filepath.Join(dir, "favorite", "best.mp4"), 200, nil)
+
+	// files that are not recordings or are inside skipped folders are not indexed
+	writeTestFile(t, filepath.Join(dir, "record_tasks.json"), 10, nil)
+	writeTestFile(t, filepath.Join(dir, "tmp", "exports", "result.mp4"), 10, nil)
+
+	err := os.WriteFile(recorder.BookmarksPath(filepath.Join(dir, "20240519", "20240519-1000-aaaaaaaa.mp4")),
+		[]byte(`{"bookmarks":[{"label":"incision"},{"label":"suture"},{"label":"incision"}]}`), 0o644)
+	require.NoError(t, err)
+
+	x := &Index{
+		RecordPath: dir,
+		PathConfs: map[string]*conf.Path{
+			"cam1": {
+				Name:       "cam1",
+				SourceName: &source,
+				GroupName:  &group,
+			},
+		},
+		Parent: test.NilLogger,
+	}
+	err = x.Initialize()
+	require.NoError(t, err)
+	defer x.Close()
+
+	x.wg.Wait()
+
+	_, err = x.Rebuild()
+	require.NoError(t, err)
+
+	require.Equal(t, Stats{Files: 4, Videos: 3, Images: 1, Size: 610}, x.Stats())
+
+	res := x.Search(Query{})
+	require.Equal(t, 4, res.Total)
+
+	e := res.Entries[len(res.Entries)-1]
+	require.Equal(t, "20240519/20240519-1000-aaaaaaaa.mp4", e.Path)
+	require.Equal(t, "cam1", e.PathName)
+	require.Equal(t, "Camera 1", e.SourceName)
+	require.Equal(t, "ward A", e.GroupName)
+	require.Equal(t, float64(60), e.Duration)
+	require.Equal(t, []string{"incision", "suture"}, e.Tags)
+
+	favorite := true
+	minDuration := float64(100)
+	end := start.Add(90 * time.Minute)
+
+	for _, ca := range []struct {
+		name  string
+		q     Query
+		paths []string
+	}{
+		{
+			"group",
+			Query{GroupName: "ward A", Type: TypeVideo},
+			[]string{"20240519/20240519-1000-aaaaaaaa.mp4"},
+		},
+		{
+			"tag",
+			Query{Tag: "Suture"},
+			[]string{"20240519/20240519-1000-aaaaaaaa.mp4"},
+		},
+		{
+			"favorite",
+			Query{Favorite: &favorite},
+			[]string{"favorite/best.mp4"},
+		},
+		{
+			"duration",
+			Query{MinDuration: &minDuration},
+			[]string{"20240519/20240519-1100-bbbbbbbb.ts"},
+		},
+		{
+			"time range",
+			Query{Start: &start, End: &end, Sort: SortSize, Asc: true},
+			[]string{"20240519/20240519-1000-aaaaaaaa.mp4", "20240519/20240519-1100-bbbbbbbb.ts"},
+		},
+		{
+			"dir and text",
+			Query{Dir: "20240519", Text: "SNAPSHOT"},
+			[]string{"20240519/1716112800000-snapshot.jpg"},
+		},
+		{
+			"pagination",
+			Query{Sort: SortName, Asc: true, Page: 2, PageSize: 3},
+			[]string{"favorite/best.mp4"},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.paths, searchPaths(x.Search(ca.q)))
+		})
+	}
+}
+
+func TestIndexUpdates(t *testing.T) {
+	dir := t.TempDir()
+
+	x := &Index{
+		RecordPath: dir,
+		Parent:     test.NilLogger,
+	}
+	err := x.Initialize()
+	require.NoError(t, err)
+
+	// the index is rebuilt in background when missing
+	x.wg.Wait()
+
+	fpath := filepath.Join(dir, "20240519", "rec.mp4")
+	writeTestFile(t, fpath, 100, &recordstore.Metadata{PathName: "cam1"})
+
+	err = x.Add(fpath)
+	require.NoError(t, err)
+	require.Equal(t, []string{"20240519/rec.mp4"}, searchPaths(x.Search(Query{PathName: "cam1"})))
+
+	newPath := filepath.Join(dir, "favorite", "rec.mp4")
+	err = os.MkdirAll(filepath.Dir(newPath), 0o755)
+	require.NoError(t, err)
+	err = os.Rename(fpath, newPath)
+	require.NoError(t, err)
+	err = recordstore.MoveMetadata(fpath, newPath)
+	require.NoError(t, err)
+
+	err = x.Move(fpath, newPath)
+	require.NoError(t, err)
+
+	res := x.Search(Query{})
+	require.Equal(t, []string{"favorite/rec.mp4"}, searchPaths(res))
+	require.True(t, res.Entries[0].Favorite)
+	require.Equal(t, "cam1", res.Entries[0].PathName)
+
+	writeTestFile(t, filepath.Join(dir, "20240520", "rec2.mp4"), 100, nil)
+	err = x.Add(filepath.Join(dir, "20240520", "rec2.mp4"))
+	require.NoError(t, err)
+
+	err = x.Add(filepath.Join(t.TempDir(), "outside.mp4"))
+	require.Error(t, err)
+
+	// the index is saved on close and loaded at the next start
+	x.Close()
+
+	x = &Index{
+		RecordPath: dir,
+		Parent:     test.NilLogger,
+	}
+	err = x.Initialize()
+	require.NoError(t, err)
+	defer x.Close()
+
+	require.Equal(t, 2, x.Stats().Files)
+	require.False(t, x.Stats().Rebuilding)
+
+	err = x.RemoveDir(filepath.Join(dir, "20240520"))
+	require.NoError(t, err)
+
+	err = x.Remove(newPath)
+	require.NoError(t, err)
+
+	require.Equal(t, 0, x.Stats().Files)
+}
@@ -0,0 +1,189 @@
+package fileindex
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sort fields.
+const (
+	SortTime     = "time"
+	SortName     = "name"
+	SortSize     = "size"
+	SortDuration = "duration"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// Query filters and paginates the index. Empty fields are ignored.
+type Query struct {
+	Text        string // part of the file name, case insensitive
+	Dir         string // folder relative to the record path, files of subfolders are excluded
+	Type        string
+	PathName    string
+	SourceName  string
+	GroupName   string
+	Tag         string
+	Favorite    *bool
+	Start       *time.Time // files that end after Start
+	End         *time.Time // files that start before End
+	MinDuration *float64
+	MaxDuration *float64
+	MinSize     *int64
+	MaxSize     *int64
+
+	Sort     string // defaults to SortTime
+	Asc      bool   // defaults to descending order
+	Page     int    // starts from 1
+	PageSize int    // defaults to 50
+}
+
+// Result is a page of search results.
+type Result struct {
+	Entries  []Entry `json:"files"`
+	Total    int     `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"pageSize"`
+}
+
+func hasTag(e *Entry, tag string) bool {
+	for _, t := range e.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Query) match(e *Entry) bool {
+	switch {
+	case q.Text != "" && !strings.Contains(strings.ToLower(e.Name), strings.ToLower(q.Text)):
+		return false
+	case q.Dir != "" && path.Dir(e.Path) != path.Clean(q.Dir):
+		return false
+	case q.Type != "" && e.Type != q.Type:
+		return false
+	case q.PathName != "" && e.PathName != q.PathName:
+		return false
+	case q.SourceName != "" && e.SourceName != q.SourceName:
+		return false
+	case q.GroupName != "" && e.GroupName != q.GroupName:
+		return false
+	case q.Tag != "" && !hasTag(e, q.Tag):
+		return false
+	case q.Favorite != nil && e.Favorite != *q.Favorite:
+		return false
+	case q.MinDuration != nil && e.Duration < *q.MinDuration:
+		return false
+	case q.MaxDuration != nil && e.Duration > *q.MaxDuration:
+		return false
+	case q.MinSize != nil && e.Size < *q.MinSize:
+		return false
+	case q.MaxSize != nil && e.Size > *q.MaxSize:
+		return false
+	}
+
+	t := e.time()
+
+	if q.Start != nil && e.endTime().Before(*q.Start) {
+		return false
+	}
+	if q.End != nil && t.After(*q.End) {
+		return false
+	}
+
+	return true
+}
+
+func sortEntries(entries []*Entry, field string, asc bool) {
+	less := func(a, b *Entry) bool {
+		switch field {
+		case SortName:
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+		case SortSize:
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case SortDuration:
+			if a.Duration != b.Duration {
+				return a.Duration < b.Duration
+			}
+		default:
+			if !a.time().Equal(b.time()) {
+				return a.time().Before(b.time())
+			}
+		}
+		return a.Path < b.Path
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if asc {
+			return less(entries[i], entries[j])
+		}
+		return less(entries[j], entries[i])
+	})
+}
+
+// find returns the sorted entries that match a query. Must be called with the mutex held.
+func (x *Index) find(q Query) []*Entry {
+	var matches []*Entry
+	for _, e := range x.entries {
+		if q.match(e) {
+			matches = append(matches, e)
+		}
+	}
+
+	sortEntries(matches, q.Sort, q.Asc)
+	return matches
+}
+
+// List returns all the files that match a query, ignoring pagination.
+func (x *Index) List(q Query) []Entry {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	matches := x.find(q)
+
+	ret := make([]Entry, len(matches))
+	for i, e := range matches {
+		ret[i] = *e
+	}
+	return ret
+}
+
+// Search returns a page of the files that match a query.
+func (x *Index) Search(q Query) Result {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = defaultPageSize
+	} else if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	matches := x.find(q)
+
+	res := Result{
+		Entries:  []Entry{},
+		Total:    len(matches),
+		Page:     q.Page,
+		PageSize: q.PageSize,
+	}
+
+	for i := (q.Page - 1) * q.PageSize; i < len(matches) && i < q.Page*q.PageSize; i++ {
+		res.Entries = append(res.Entries, *matches[i])
+	}
+
+	return res
+}
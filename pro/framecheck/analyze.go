@@ -0,0 +1,88 @@
+package framecheck
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+const (
+	// size of the grid of pixels sampled from each frame.
+	gridWidth  = 64
+	gridHeight = 36
+
+	// ratio of dark pixels above which a frame is black.
+	blackRatio = 0.98
+)
+
+// frame contains the statistics of a sampled frame.
+type frame struct {
+	luma      []float64 // luma of the grid pixels
+	meanLuma  float64
+	deviation float64 // largest standard deviation among R, G and B
+	darkRatio float64 // ratio of pixels whose luma is not greater than the black level
+	color     [3]float64
+}
+
+// analyze samples a grid of pixels and computes their statistics.
+func analyze(img image.Image, blackLevel int) *frame {
+	bounds := img.Bounds()
+	n := gridWidth * gridHeight
+
+	f := &frame{
+		luma: make([]float64, 0, n),
+	}
+
+	var sum, sumSq [3]float64
+	dark := 0
+
+	for gy := 0; gy < gridHeight; gy++ {
+		y := bounds.Min.Y + (2*gy+1)*bounds.Dy()/(2*gridHeight)
+
+		for gx := 0; gx < gridWidth; gx++ {
+			x := bounds.Min.X + (2*gx+1)*bounds.Dx()/(2*gridWidth)
+
+			r, g, b, _ := img.At(x, y).RGBA()
+			rgb := [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+
+			for i, v := range rgb {
+				sum[i] += v
+				sumSq[i] += v * v
+			}
+
+			luma := 0.299*rgb[0] + 0.587*rgb[1] + 0.114*rgb[2]
+			f.luma = append(f.luma, luma)
+			f.meanLuma += luma
+
+			if luma <= float64(blackLevel) {
+				dark++
+			}
+		}
+	}
+
+	f.meanLuma /= float64(n)
+	f.darkRatio = float64(dark) / float64(n)
+
+	for i := range sum {
+		mean := sum[i] / float64(n)
+		f.color[i] = mean
+		f.deviation = math.Max(f.deviation, math.Sqrt(math.Max(0, sumSq[i]/float64(n)-mean*mean)))
+	}
+
+	return f
+}
+
+// difference returns the mean absolute luma difference between two frames.
+func difference(a *frame, b *frame) float64 {
+	var sum float64
+	for i := range a.luma {
+		sum += math.Abs(a.luma[i] - b.luma[i])
+	}
+	return sum / float64(len(a.luma))
+}
+
+// hexColor returns the mean color of a frame in the #rrggbb format.
+func (f *frame) hexColor() string {
+	return fmt.Sprintf("#%02x%02x%02x",
+		uint8(math.Round(f.color[0])), uint8(math.Round(f.color[1])), uint8(math.Round(f.color[2])))
+}
@@ -0,0 +1,227 @@
+// Package framecheck detects frozen, black and solid color video by analyzing decoded frames.
+package framecheck
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// interval of the synchronization of monitored paths.
+const syncInterval = 5 * time.Second
+
+// Condition is the condition of the video of a path.
+type Condition string
+
+// conditions.
+const (
+	ConditionUnknown Condition = "unknown" // no frame has been analyzed yet, or the path is not ready
+	ConditionNormal  Condition = "normal"
+	ConditionFrozen  Condition = "frozen"
+	ConditionBlack   Condition = "black"
+	ConditionSolid   Condition = "solid" // solid color, for instance the blue screen of a device without signal
+)
+
+// Abnormal returns whether the video is frozen, black or a solid color.
+func (c Condition) Abnormal() bool {
+	switch c {
+	case ConditionFrozen, ConditionBlack, ConditionSolid:
+		return true
+	}
+	return false
+}
+
+// Status is the video condition of a path.
+type Status struct {
+	Path       string     `json:"path"`
+	Condition  Condition  `json:"condition"`
+	Since      time.Time  `json:"since"` // when the condition started
+	LastSample *time.Time `json:"lastSample"`
+	MeanLuma   float64    `json:"meanLuma"`
+	Deviation  float64    `json:"deviation"`  // largest standard deviation among R, G and B
+	Difference float64    `json:"difference"` // mean luma difference from the previous sample
+	Color      string     `json:"color"`      // mean color, #rrggbb
+	Error      string     `json:"error,omitempty"`
+}
+
+// Detector samples the frames of paths with 'frameCheck' enabled
+// and detects frozen, black and solid color video.
+type Detector struct {
+	PathConfs   map[string]*conf.Path
+	PathManager pathManager
+	OnChange    func(Status) // optional, called when the condition of a path changes
+	Parent      logger.Writer
+
+	ctx         context.Context
+	ctxCancel   func()
+	wg          sync.WaitGroup
+	mutex       sync.RWMutex
+	monitors    map[string]*pathMonitor // key: pathName
+	frameGetter frameGetter
+	chSync      chan struct{}
+}
+
+type pathManager interface {
+	APIPathsList() (*defs.APIPathList, error)
+	APIPathsGet(name string) (*defs.APIPath, error)
+}
+
+type frameGetter interface {
+	GetFrame(pathName string) ([]byte, error)
+}
+
+// Initialize initializes the Detector.
+func (d *Detector) Initialize(frameGetter frameGetter) error {
+	d.ctx, d.ctxCancel = context.WithCancel(context.Background())
+	d.monitors = make(map[string]*pathMonitor)
+	d.frameGetter = frameGetter
+	d.chSync = make(chan struct{}, 1)
+
+	d.wg.Add(1)
+	go d.run()
+
+	d.Log(logger.Info, "frame detector initialized")
+	return nil
+}
+
+// Close closes the Detector.
+func (d *Detector) Close() {
+	d.ctxCancel()
+	d.wg.Wait()
+
+	d.mutex.Lock()
+	d.monitors = nil
+	d.mutex.Unlock()
+
+	d.Log(logger.Info, "frame detector closed")
+}
+
+// Log implements logger.Writer.
+func (d *Detector) Log(level logger.Level, format string, args ...interface{}) {
+	d.Parent.Log(level, "[framecheck] "+format, args...)
+}
+
+// ReloadPathConfs reloads path configurations.
+func (d *Detector) ReloadPathConfs(pathConfs map[string]*conf.Path) {
+	d.mutex.Lock()
+	d.PathConfs = pathConfs
+	d.mutex.Unlock()
+
+	select {
+	case d.chSync <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns the video condition of a path.
+// It returns false when the path is not monitored.
+func (d *Detector) Status(pathName string) (Status, bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	m, ok := d.monitors[pathName]
+	if !ok {
+		return Status{}, false
+	}
+	return m.getStatus(), true
+}
+
+// Statuses returns the video condition of all monitored paths, sorted by name.
+func (d *Detector) Statuses() []Status {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	ret := make([]Status, 0, len(d.monitors))
+	for _, m := range d.monitors {
+		ret = append(ret, m.getStatus())
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Path < ret[j].Path
+	})
+
+	return ret
+}
+
+func (d *Detector) run() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	d.syncMonitors()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.syncMonitors()
+
+		case <-d.chSync:
+			d.syncMonitors()
+
+		case <-d.ctx.Done():
+			// monitors are stopped by the same context
+			return
+		}
+	}
+}
+
+// syncMonitors starts a monitor for every path with 'frameCheck' enabled,
+// and stops the monitors of removed, disabled or reconfigured paths.
+func (d *Detector) syncMonitors() {
+	list, err := d.PathManager.APIPathsList()
+	if err != nil {
+		d.Log(logger.Debug, "unable to list paths: %v", err)
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.ctx.Err() != nil {
+		return
+	}
+
+	wanted := make(map[string]*conf.Path)
+	for _, item := range list.Items {
+		pathConf, ok := d.PathConfs[item.ConfName]
+		if ok && pathConf.FrameCheck {
+			wanted[item.Name] = pathConf
+		}
+	}
+
+	for pathName, m := range d.monitors {
+		pathConf, ok := wanted[pathName]
+		if !ok || !reflect.DeepEqual(pathConf, m.pathConf) {
+			m.ctxCancel()
+			delete(d.monitors, pathName)
+		}
+	}
+
+	for pathName, pathConf := range wanted {
+		if _, ok := d.monitors[pathName]; ok {
+			continue
+		}
+
+		ctx, ctxCancel := context.WithCancel(d.ctx)
+
+		m := &pathMonitor{
+			pathName:  pathName,
+			pathConf:  pathConf,
+			detector:  d,
+			ctx:       ctx,
+			ctxCancel: ctxCancel,
+		}
+		m.initialize()
+		d.monitors[pathName] = m
+
+		d.wg.Add(1)
+		go m.run()
+	}
+}
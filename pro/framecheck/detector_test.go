@@ -0,0 +1,185 @@
+package framecheck
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+type dummyPathManager struct{}
+
+func (dummyPathManager) APIPathsList() (*defs.APIPathList, error) {
+	return &defs.APIPathList{Items: []*defs.APIPath{
+		{Name: "cam", ConfName: "cam", Ready: true},
+		{Name: "other", ConfName: "other", Ready: true},
+	}}, nil
+}
+
+func (dummyPathManager) APIPathsGet(name string) (*defs.APIPath, error) {
+	return &defs.APIPath{Name: name, ConfName: name, Ready: true}, nil
+}
+
+type dummyFrameGetter struct {
+	mutex sync.Mutex
+	frame func() []byte
+}
+
+func (g *dummyFrameGetter) GetFrame(pathName string) ([]byte, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.frame == nil {
+		return nil, fmt.Errorf("no frame")
+	}
+	return g.frame(), nil
+}
+
+func (g *dummyFrameGetter) set(cb func() []byte) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.frame = cb
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, nil)
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func noiseImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 320, 180))
+	for i := range img.Pix {
+		img.Pix[i] = byte(rand.Intn(256))
+	}
+	return img
+}
+
+func solidImage(c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 320, 180))
+	for y := 0; y < 180; y++ {
+		for x := 0; x < 320; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestAnalyze(t *testing.T) {
+	black := analyze(solidImage(color.RGBA{5, 5, 5, 255}), 20)
+	require.Equal(t, 1.0, black.darkRatio)
+	require.Equal(t, "#050505", black.hexColor())
+
+	blue := analyze(solidImage(color.RGBA{0, 0, 200, 255}), 20)
+	require.InDelta(t, 22.8, blue.meanLuma, 0.1)
+	require.Equal(t, 0.0, blue.darkRatio)
+	require.Equal(t, 0.0, blue.deviation)
+	require.Equal(t, "#0000c8", blue.hexColor())
+
+	noise := analyze(noiseImage(), 20)
+	require.Greater(t, noise.deviation, 50.0)
+	require.Greater(t, difference(noise, analyze(noiseImage(), 20)), 50.0)
+	require.Equal(t, 0.0, difference(noise, noise))
+}
+
+func testPathConf() *conf.Path {
+	return &conf.Path{
+		FrameCheck:            true,
+		FrameCheckInterval:    conf.Duration(20 * time.Millisecond),
+		FrameCheckDuration:    conf.Duration(100 * time.Millisecond),
+		FrameBlackLevel:       20,
+		FrameSolidDeviation:   4,
+		FrameFreezeDifference: 1,
+	}
+}
+
+func TestDetector(t *testing.T) {
+	getter := &dummyFrameGetter{}
+
+	var mutex sync.Mutex
+	var changes []Status
+
+	d := &Detector{
+		PathConfs: map[string]*conf.Path{
+			"cam":   testPathConf(),
+			"other": {},
+		},
+		PathManager: dummyPathManager{},
+		OnChange: func(s Status) {
+			mutex.Lock()
+			changes = append(changes, s)
+			mutex.Unlock()
+		},
+		Parent: test.NilLogger,
+	}
+	err := d.Initialize(getter)
+	require.NoError(t, err)
+	defer d.Close()
+
+	waitCondition := func(c Condition) Status {
+		var s Status
+		require.Eventually(t, func() bool {
+			var ok bool
+			s, ok = d.Status("cam")
+			return ok && s.Condition == c
+		}, 5*time.Second, 5*time.Millisecond)
+		return s
+	}
+
+	// errors do not change the condition
+	require.Eventually(t, func() bool {
+		s, ok := d.Status("cam")
+		return ok && s.Error == "no frame"
+	}, 5*time.Second, 5*time.Millisecond)
+
+	getter.set(func() []byte { return encodeJPEG(t, noiseImage()) })
+	waitCondition(ConditionNormal)
+
+	frozen := encodeJPEG(t, noiseImage())
+	getter.set(func() []byte { return frozen })
+	s := waitCondition(ConditionFrozen)
+	require.Equal(t, 0.0, s.Difference)
+
+	getter.set(func() []byte { return encodeJPEG(t, noiseImage()) })
+	waitCondition(ConditionNormal)
+
+	black := encodeJPEG(t, solidImage(color.Black))
+	getter.set(func() []byte { return black })
+	waitCondition(ConditionBlack)
+
+	blue := encodeJPEG(t, solidImage(color.RGBA{0, 0, 200, 255}))
+	getter.set(func() []byte { return blue })
+	s = waitCondition(ConditionSolid)
+	require.Equal(t, "#0000c8", s.Color)
+
+	_, ok := d.Status("other")
+	require.False(t, ok)
+	require.Len(t, d.Statuses(), 1)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	conds := make([]Condition, len(changes))
+	for i, c := range changes {
+		conds[i] = c.Condition
+	}
+	require.Equal(t, []Condition{
+		ConditionNormal,
+		ConditionFrozen,
+		ConditionNormal,
+		ConditionBlack,
+		ConditionSolid,
+	}, conds)
+}
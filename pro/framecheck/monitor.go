@@ -0,0 +1,185 @@
+package framecheck
+
+import (
+	"bytes"
+	"context"
+	"image/jpeg"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+type pathMonitor struct {
+	pathName  string
+	pathConf  *conf.Path
+	detector  *Detector
+	ctx       context.Context
+	ctxCancel func()
+
+	// used by the monitor routine only
+	prev         *frame
+	prevTime     time.Time
+	pending      Condition
+	pendingSince time.Time
+
+	mutex  sync.Mutex
+	status Status
+}
+
+func (m *pathMonitor) initialize() {
+	m.pending = ConditionUnknown
+	m.status = Status{
+		Path:      m.pathName,
+		Condition: ConditionUnknown,
+		Since:     time.Now(),
+	}
+}
+
+func (m *pathMonitor) run() {
+	defer m.detector.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(m.pathConf.FrameCheckInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.check(time.Now())
+
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *pathMonitor) getStatus() Status {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.status
+}
+
+// classify returns the condition of a frame, without taking its duration into account.
+func (m *pathMonitor) classify(cur *frame, diff float64) Condition {
+	switch {
+	case cur.darkRatio >= blackRatio:
+		return ConditionBlack
+
+	case cur.deviation <= m.pathConf.FrameSolidDeviation:
+		return ConditionSolid
+
+	case m.prev != nil && diff <= m.pathConf.FrameFreezeDifference:
+		return ConditionFrozen
+	}
+
+	return ConditionNormal
+}
+
+// check samples a frame and updates the condition of the path.
+func (m *pathMonitor) check(now time.Time) {
+	pathData, err := m.detector.PathManager.APIPathsGet(m.pathName)
+	if err != nil || !pathData.Ready {
+		m.prev = nil
+		m.pending = ConditionUnknown
+
+		m.update(func(s *Status) {
+			since := s.Since
+			if s.Condition != ConditionUnknown {
+				since = now
+			}
+
+			*s = Status{
+				Path:      m.pathName,
+				Condition: ConditionUnknown,
+				Since:     since,
+			}
+		})
+		return
+	}
+
+	cur, err := m.sample()
+	if err != nil {
+		m.update(func(s *Status) {
+			s.Error = err.Error()
+		})
+		return
+	}
+
+	var diff float64
+	if m.prev != nil {
+		diff = difference(cur, m.prev)
+	}
+
+	cond := m.classify(cur, diff)
+
+	if cond != m.pending {
+		m.pending = cond
+		m.pendingSince = now
+
+		// a frozen frame has not changed since the previous sample
+		if cond == ConditionFrozen {
+			m.pendingSince = m.prevTime
+		}
+	}
+
+	m.prev = cur
+	m.prevTime = now
+
+	m.update(func(s *Status) {
+		s.LastSample = &now
+		s.MeanLuma = cur.meanLuma
+		s.Deviation = cur.deviation
+		s.Difference = diff
+		s.Color = cur.hexColor()
+		s.Error = ""
+
+		// abnormal conditions are reported once they last for the configured duration
+		if cond == ConditionNormal || now.Sub(m.pendingSince) >= time.Duration(m.pathConf.FrameCheckDuration) {
+			if s.Condition != cond {
+				s.Condition = cond
+				s.Since = m.pendingSince
+			}
+		}
+	})
+}
+
+func (m *pathMonitor) sample() (*frame, error) {
+	buf, err := m.detector.frameGetter.GetFrame(m.pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	return analyze(img, m.pathConf.FrameBlackLevel), nil
+}
+
+// update modifies the status and notifies changes of condition.
+func (m *pathMonitor) update(cb func(s *Status)) {
+	m.mutex.Lock()
+	prev := m.status.Condition
+	cb(&m.status)
+	s := m.status
+	m.mutex.Unlock()
+
+	if s.Condition == prev {
+		return
+	}
+
+	switch {
+	case s.Condition.Abnormal():
+		m.detector.Log(logger.Warn, "path '%s': video is %s (luma %.0f, color %s)",
+			m.pathName, s.Condition, s.MeanLuma, s.Color)
+
+	case prev.Abnormal():
+		m.detector.Log(logger.Info, "path '%s': video is no longer %s", m.pathName, prev)
+	}
+
+	if m.detector.OnChange != nil {
+		m.detector.OnChange(s)
+	}
+}
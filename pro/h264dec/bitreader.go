@@ -0,0 +1,130 @@
+package h264dec
+
+import (
+	"errors"
+)
+
+var errEndOfData = errors.New("unexpected end of data")
+
+// bitReader reads the RBSP of a NAL unit.
+type bitReader struct {
+	buf []byte
+	pos int // position in bits
+	end int // position of the rbsp_stop_one_bit
+}
+
+func newBitReader(rbsp []byte) *bitReader {
+	r := &bitReader{buf: rbsp}
+
+	// find the rbsp_stop_one_bit
+	r.end = len(rbsp) * 8
+	for i := len(rbsp) - 1; i >= 0; i-- {
+		if rbsp[i] != 0 {
+			for b := 0; b < 8; b++ {
+				if (rbsp[i]>>b)&1 != 0 {
+					r.end = i*8 + 7 - b
+					break
+				}
+			}
+			break
+		}
+	}
+
+	return r
+}
+
+func (r *bitReader) readFlag() (bool, error) {
+	v, err := r.readBit()
+	return v == 1, err
+}
+
+func (r *bitReader) readBit() (uint32, error) {
+	if r.pos >= len(r.buf)*8 {
+		return 0, errEndOfData
+	}
+	v := uint32(r.buf[r.pos>>3]>>(7-r.pos&7)) & 1
+	r.pos++
+	return v, nil
+}
+
+func (r *bitReader) readBits(n int) (uint32, error) {
+	if r.pos+n > len(r.buf)*8 {
+		return 0, errEndOfData
+	}
+	var v uint32
+	for i := 0; i < n; i++ {
+		v = (v << 1) | uint32(r.buf[r.pos>>3]>>(7-r.pos&7))&1
+		r.pos++
+	}
+	return v, nil
+}
+
+// readUE reads an unsigned Exp-Golomb code.
+func (r *bitReader) readUE() (uint32, error) {
+	leadingZeros := 0
+	for {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if b == 1 {
+			break
+		}
+		leadingZeros++
+		if leadingZeros > 31 {
+			return 0, errors.New("invalid Exp-Golomb code")
+		}
+	}
+
+	v, err := r.readBits(leadingZeros)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint32((uint64(1)<<leadingZeros)-1) + v, nil
+}
+
+// readSE reads a signed Exp-Golomb code.
+func (r *bitReader) readSE() (int32, error) {
+	v, err := r.readUE()
+	if err != nil {
+		return 0, err
+	}
+	if v&1 != 0 {
+		return int32((v + 1) >> 1), nil
+	}
+	return -int32(v >> 1), nil
+}
+
+// readUEMax reads an unsigned Exp-Golomb code and checks its range.
+func (r *bitReader) readUEMax(max uint32, name string) (uint32, error) {
+	v, err := r.readUE()
+	if err != nil {
+		return 0, err
+	}
+	if v > max {
+		return 0, errors.New("invalid " + name)
+	}
+	return v, nil
+}
+
+// readSERange reads a signed Exp-Golomb code and checks its range.
+func (r *bitReader) readSERange(min int32, max int32, name string) (int32, error) {
+	v, err := r.readSE()
+	if err != nil {
+		return 0, err
+	}
+	if v < min || v > max {
+		return 0, errors.New("invalid " + name)
+	}
+	return v, nil
+}
+
+func (r *bitReader) byteAligned() bool {
+	return r.pos&7 == 0
+}
+
+// moreRBSPData implements more_rbsp_data().
+func (r *bitReader) moreRBSPData() bool {
+	return r.pos < r.end
+}
@@ -0,0 +1,62 @@
+package h264dec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitReaderExpGolomb(t *testing.T) {
+	// ue(v): 0 = 1, 1 = 010, 2 = 011, 3 = 00100
+	// se(v): 1 = 010, -1 = 011
+	r := newBitReader([]byte{0b10100110, 0b01000100, 0b11000000})
+
+	v, err := r.readUE()
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), v)
+
+	v, err = r.readUE()
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), v)
+
+	v, err = r.readUE()
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), v)
+
+	v, err = r.readUE()
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), v)
+
+	s, err := r.readSE()
+	require.NoError(t, err)
+	require.Equal(t, int32(1), s)
+
+	s, err = r.readSE()
+	require.NoError(t, err)
+	require.Equal(t, int32(-1), s)
+
+	_, err = r.readBits(8)
+	require.Error(t, err)
+}
+
+// VLC tables must be prefix-free, otherwise decoding would depend on the order of entries.
+func TestVLCTablesPrefixFree(t *testing.T) {
+	tables := []*vlcTable{chromaDCCoeffTokenTable}
+	tables = append(tables, coeffTokenTables[:]...)
+	tables = append(tables, totalZerosTables[:]...)
+	tables = append(tables, chromaDCTotalZerosTables[:]...)
+	tables = append(tables, runBeforeTables[:]...)
+
+	for i, table := range tables {
+		for a := range table.codes {
+			for b := range table.codes {
+				aLen, bLen := a>>16, b>>16
+				if a == b || aLen > bLen {
+					continue
+				}
+				require.NotEqual(t, a&0xFFFF, (b&0xFFFF)>>(bLen-aLen),
+					"table %d: code %x is a prefix of code %x", i, a, b)
+			}
+		}
+	}
+}
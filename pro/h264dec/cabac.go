@@ -0,0 +1,483 @@
+package h264dec
+
+import (
+	"errors"
+)
+
+// rangeTabLPS is indexed by [pStateIdx][qCodIRangeIdx].
+// Specification: ITU-T Rec. H.264, table 9-44
+var rangeTabLPS = [64][4]uint32{
+	{128, 176, 208, 240}, {128, 167, 197, 227}, {128, 158, 187, 216}, {123, 150, 178, 205},
+	{116, 142, 169, 195}, {111, 135, 160, 185}, {105, 128, 152, 175}, {100, 122, 144, 166},
+	{95, 116, 137, 158}, {90, 110, 130, 150}, {85, 104, 123, 142}, {81, 99, 117, 135},
+	{77, 94, 111, 128}, {73, 89, 105, 122}, {69, 85, 100, 116}, {66, 80, 95, 110},
+	{62, 76, 90, 104}, {59, 72, 86, 99}, {56, 69, 81, 94}, {53, 65, 77, 89},
+	{51, 62, 73, 85}, {48, 59, 69, 80}, {46, 56, 66, 76}, {43, 53, 63, 72},
+	{41, 50, 59, 69}, {39, 48, 56, 65}, {37, 45, 54, 62}, {35, 43, 51, 59},
+	{33, 41, 48, 56}, {32, 39, 46, 53}, {30, 37, 43, 50}, {29, 35, 41, 48},
+	{27, 33, 39, 45}, {26, 31, 37, 43}, {24, 30, 35, 41}, {23, 28, 33, 39},
+	{22, 27, 32, 37}, {21, 26, 30, 35}, {20, 24, 29, 33}, {19, 23, 27, 31},
+	{18, 22, 26, 30}, {17, 21, 25, 28}, {16, 20, 23, 27}, {15, 19, 22, 25},
+	{14, 18, 21, 24}, {14, 17, 20, 23}, {13, 16, 19, 22}, {12, 15, 18, 21},
+	{12, 14, 17, 20}, {11, 14, 16, 19}, {11, 13, 15, 18}, {10, 12, 15, 17},
+	{10, 12, 14, 16}, {9, 11, 13, 15}, {9, 11, 12, 14}, {8, 10, 12, 14},
+	{8, 9, 11, 13}, {7, 9, 11, 12}, {7, 9, 10, 12}, {7, 8, 10, 11},
+	{6, 8, 9, 11}, {6, 7, 9, 10}, {6, 7, 8, 9}, {2, 2, 2, 2},
+}
+
+// transIdxLPS is indexed by pStateIdx.
+// Specification: ITU-T Rec. H.264, table 9-45
+var transIdxLPS = [64]uint8{
+	0, 0, 1, 2, 2, 4, 4, 5, 6, 7, 8, 9, 9, 11, 11, 12,
+	13, 13, 15, 15, 16, 16, 18, 18, 19, 19, 21, 21, 22, 22, 23, 24,
+	24, 25, 26, 26, 27, 27, 28, 29, 29, 30, 30, 30, 31, 32, 32, 33,
+	33, 33, 34, 34, 35, 35, 35, 36, 36, 36, 37, 37, 37, 38, 38, 63,
+}
+
+// ctxIdxOffset of the syntax elements of I slices.
+// Specification: ITU-T Rec. H.264, table 9-34
+const (
+	ctxMbTypeI              = 3
+	ctxMbQPDelta            = 60
+	ctxIntraChromaPredMode  = 64
+	ctxPrevIntraPredMode    = 68
+	ctxRemIntraPredMode     = 69
+	ctxCodedBlockPattern    = 73
+	ctxCodedBlockFlag       = 85
+	ctxSignificantCoeff     = 105
+	ctxLastSignificantCoeff = 166
+	ctxCoeffAbsLevel        = 227
+	ctxTransformSize8x8     = 399
+	ctxSignificantCoeff8x8  = 402
+	ctxLastSignificant8x8   = 417
+	ctxCoeffAbsLevel8x8     = 426
+
+	numContexts = 436
+)
+
+// cabacInitI contains the values of m and n of the contexts used by I slices.
+// Specification: ITU-T Rec. H.264, tables 9-12 to 9-33
+var cabacInitI = []struct {
+	first int
+	mn    [][2]int
+}{
+	// 0 - 10
+	{0, [][2]int{
+		{20, -15}, {2, 54}, {3, 74}, {20, -15}, {2, 54}, {3, 74}, {-28, 127}, {-23, 104},
+		{-6, 53}, {-1, 54}, {7, 51},
+	}},
+	// 60 - 69
+	{60, [][2]int{
+		{0, 41}, {0, 63}, {0, 63}, {0, 63}, {-9, 83}, {4, 86}, {0, 97}, {-7, 72},
+		{13, 41}, {3, 62},
+	}},
+	// 70 - 104
+	{70, [][2]int{
+		{0, 11}, {1, 55}, {0, 69}, {-17, 127}, {-13, 102}, {0, 82}, {-7, 74}, {-21, 107},
+		{-27, 127}, {-31, 127}, {-24, 127}, {-18, 95}, {-27, 127}, {-21, 114}, {-30, 127}, {-17, 123},
+		{-12, 115}, {-16, 122}, {-11, 115}, {-12, 63}, {-2, 68}, {-15, 84}, {-13, 104}, {-3, 70},
+		{-8, 93}, {-10, 90}, {-30, 127}, {-1, 74}, {-6, 97}, {-7, 91}, {-20, 127}, {-4, 56},
+		{-5, 82}, {-7, 76}, {-22, 125},
+	}},
+	// 105 - 165
+	{105, [][2]int{
+		{-7, 93}, {-11, 87}, {-3, 77}, {-5, 71}, {-4, 63}, {-4, 68}, {-12, 84}, {-7, 62},
+		{-7, 65}, {8, 61}, {5, 56}, {-2, 66}, {1, 64}, {0, 61}, {-2, 78}, {1, 50},
+		{7, 52}, {10, 35}, {0, 44}, {11, 38}, {1, 45}, {0, 46}, {5, 44}, {31, 17},
+		{1, 51}, {7, 50}, {28, 19}, {16, 33}, {14, 62}, {-13, 108}, {-15, 100}, {-13, 101},
+		{-13, 91}, {-12, 94}, {-10, 88}, {-16, 84}, {-10, 86}, {-7, 83}, {-13, 87}, {-19, 94},
+		{1, 70}, {0, 72}, {-5, 74}, {18, 59}, {-8, 102}, {-15, 100}, {0, 95}, {-4, 75},
+		{2, 72}, {-11, 75}, {-3, 71}, {15, 46}, {-13, 69}, {0, 62}, {0, 65}, {21, 37},
+		{-15, 72}, {9, 57}, {16, 54}, {0, 62}, {12, 72},
+	}},
+	// 166 - 226
+	{166, [][2]int{
+		{24, 0}, {15, 9}, {8, 25}, {13, 18}, {15, 9}, {13, 19}, {10, 37}, {12, 18},
+		{6, 29}, {20, 33}, {15, 30}, {4, 45}, {1, 58}, {0, 62}, {7, 61}, {12, 38},
+		{11, 45}, {15, 39}, {11, 42}, {13, 44}, {16, 45}, {12, 41}, {10, 49}, {30, 34},
+		{18, 42}, {10, 55}, {17, 51}, {17, 46}, {0, 89}, {26, -19}, {22, -17}, {26, -17},
+		{30, -25}, {28, -20}, {33, -23}, {37, -27}, {33, -23}, {40, -28}, {38, -17}, {33, -11},
+		{40, -15}, {41, -6}, {38, 1}, {41, 17}, {30, -6}, {27, 3}, {26, 22}, {37, -16},
+		{35, -4}, {38, -8}, {38, -3}, {37, 3}, {38, 5}, {42, 0}, {35, 16}, {39, 22},
+		{14, 48}, {27, 37}, {21, 60}, {12, 68}, {2, 97},
+	}},
+	// 227 - 275
+	{227, [][2]int{
+		{-3, 71}, {-6, 42}, {-5, 50}, {-3, 54}, {-2, 62}, {0, 58}, {1, 63}, {-2, 72},
+		{-1, 74}, {-9, 91}, {-5, 67}, {-5, 27}, {-3, 39}, {-2, 44}, {0, 46}, {-16, 64},
+		{-8, 68}, {-10, 78}, {-6, 77}, {-10, 86}, {-12, 92}, {-15, 55}, {-10, 60}, {-6, 62},
+		{-4, 65}, {-12, 73}, {-8, 76}, {-7, 80}, {-9, 88}, {-17, 110}, {-11, 97}, {-20, 84},
+		{-11, 79}, {-6, 73}, {-4, 74}, {-13, 86}, {-13, 96}, {-11, 97}, {-19, 117}, {-8, 78},
+		{-5, 33}, {-4, 48}, {-2, 53}, {-3, 62}, {-13, 71}, {-10, 79}, {-12, 86}, {-13, 90},
+		{-14, 97},
+	}},
+	// 399 - 435
+	{399, [][2]int{
+		{31, 21}, {31, 31}, {25, 50}, {-17, 120}, {-20, 112}, {-18, 114}, {-11, 85}, {-15, 92},
+		{-14, 89}, {-26, 71}, {-15, 81}, {-14, 80}, {0, 68}, {-14, 70}, {-24, 56}, {-23, 68},
+		{-24, 50}, {-11, 74}, {23, -13}, {26, -13}, {40, -15}, {49, -14}, {44, 3}, {45, 6},
+		{44, 34}, {33, 54}, {19, 82}, {-3, 75}, {-1, 23}, {1, 34}, {1, 43}, {0, 54},
+		{-2, 55}, {0, 61}, {1, 64}, {0, 68}, {-9, 92},
+	}},
+}
+
+// ctxBlockCatOffset is indexed by [syntax element][ctxBlockCat].
+// Specification: ITU-T Rec. H.264, table 9-40
+var (
+	cbfCatOffset = [5]int{0, 4, 8, 12, 16}
+	sigCatOffset = [5]int{0, 15, 29, 44, 47}
+	absCatOffset = [5]int{0, 10, 20, 30, 39}
+)
+
+// ctxIdxInc of significant_coeff_flag and last_significant_coeff_flag of 8x8 blocks.
+// Specification: ITU-T Rec. H.264, table 9-43
+var (
+	sigCoeffFlagOffset8x8 = [63]uint8{
+		0, 1, 2, 3, 4, 5, 5, 4, 4, 3, 3, 4, 4, 4, 5, 5,
+		4, 4, 4, 4, 3, 3, 6, 7, 7, 7, 8, 9, 10, 9, 8, 7,
+		7, 6, 11, 12, 13, 11, 6, 7, 8, 9, 14, 10, 9, 8, 6, 11,
+		12, 13, 11, 6, 9, 14, 10, 9, 11, 12, 13, 11, 14, 10, 12,
+	}
+
+	lastCoeffFlagOffset8x8 = [63]uint8{
+		0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+		3, 3, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4,
+		5, 5, 5, 5, 6, 6, 6, 6, 7, 7, 7, 7, 8, 8, 8,
+	}
+)
+
+// block categories.
+// Specification: ITU-T Rec. H.264, table 9-42
+const (
+	catLumaDC   = 0
+	catLumaAC   = 1
+	catLuma4x4  = 2
+	catChromaDC = 3
+	catChromaAC = 4
+	catLuma8x8  = 5
+)
+
+type cabacContext struct {
+	pStateIdx uint8
+	valMPS    uint8
+}
+
+// cabacDecoder is the arithmetic decoding engine.
+// Specification: ITU-T Rec. H.264, section 9.3.1.2 and 9.3.3.2
+type cabacDecoder struct {
+	r          *bitReader
+	codIRange  uint32
+	codIOffset uint32
+	ctx        [numContexts]cabacContext
+}
+
+// initContexts initializes the context variables of an I slice.
+func (d *cabacDecoder) initContexts(sliceQP int) {
+	qp := clip3(0, 51, sliceQP)
+
+	for _, group := range cabacInitI {
+		for i, mn := range group.mn {
+			preCtxState := clip3(1, 126, ((mn[0]*qp)>>4)+mn[1])
+
+			c := &d.ctx[group.first+i]
+			if preCtxState <= 63 {
+				c.pStateIdx = uint8(63 - preCtxState)
+				c.valMPS = 0
+			} else {
+				c.pStateIdx = uint8(preCtxState - 64)
+				c.valMPS = 1
+			}
+		}
+	}
+}
+
+// initEngine initializes the arithmetic decoding engine.
+func (d *cabacDecoder) initEngine() error {
+	d.codIRange = 510
+
+	var err error
+	d.codIOffset, err = d.r.readBits(9)
+	if err != nil {
+		return err
+	}
+
+	// codIOffset equal to 510 or 511 is not allowed
+	if d.codIOffset >= 510 {
+		return errors.New("invalid CABAC data")
+	}
+
+	return nil
+}
+
+func (d *cabacDecoder) renorm() error {
+	for d.codIRange < 256 {
+		b, err := d.r.readBit()
+		if err != nil {
+			return err
+		}
+		d.codIRange <<= 1
+		d.codIOffset = d.codIOffset<<1 | b
+	}
+	return nil
+}
+
+func (d *cabacDecoder) decodeDecision(ctxIdx int) (uint32, error) {
+	c := &d.ctx[ctxIdx]
+
+	codIRangeLPS := rangeTabLPS[c.pStateIdx][(d.codIRange>>6)&3]
+	d.codIRange -= codIRangeLPS
+
+	var binVal uint32
+
+	if d.codIOffset >= d.codIRange {
+		binVal = uint32(1 - c.valMPS)
+		d.codIOffset -= d.codIRange
+		d.codIRange = codIRangeLPS
+
+		if c.pStateIdx == 0 {
+			c.valMPS = 1 - c.valMPS
+		}
+		c.pStateIdx = transIdxLPS[c.pStateIdx]
+	} else {
+		binVal = uint32(c.valMPS)
+		if c.pStateIdx < 62 {
+			c.pStateIdx++
+		}
+	}
+
+	err := d.renorm()
+	if err != nil {
+		return 0, err
+	}
+
+	return binVal, nil
+}
+
+func (d *cabacDecoder) decodeBypass() (uint32, error) {
+	b, err := d.r.readBit()
+	if err != nil {
+		return 0, err
+	}
+
+	d.codIOffset = d.codIOffset<<1 | b
+
+	if d.codIOffset >= d.codIRange {
+		d.codIOffset -= d.codIRange
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (d *cabacDecoder) decodeTerminate() (uint32, error) {
+	d.codIRange -= 2
+
+	if d.codIOffset >= d.codIRange {
+		return 1, nil
+	}
+
+	err := d.renorm()
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// decodeMbQPDelta decodes mb_qp_delta.
+func (d *cabacDecoder) decodeMbQPDelta(prevNonZero bool) (int, error) {
+	ctxIdxInc := 0
+	if prevNonZero {
+		ctxIdxInc = 1
+	}
+
+	k := 0
+	for {
+		b, err := d.decodeDecision(ctxMbQPDelta + ctxIdxInc)
+		if err != nil {
+			return 0, err
+		}
+		if b == 0 {
+			break
+		}
+
+		k++
+		if k > 102 {
+			return 0, errors.New("invalid mb_qp_delta")
+		}
+
+		if ctxIdxInc < 2 {
+			ctxIdxInc = 2
+		} else {
+			ctxIdxInc = 3
+		}
+	}
+
+	// Specification: ITU-T Rec. H.264, table 9-3
+	if k%2 == 1 {
+		return (k + 1) / 2, nil
+	}
+	return -(k / 2), nil
+}
+
+// decodeCoeffAbsLevelMinus1 decodes coeff_abs_level_minus1, binarized with UEG0.
+func (d *cabacDecoder) decodeCoeffAbsLevelMinus1(ctxBase int, cat int, numGt1 int, numEq1 int) (int32, error) {
+	ctxIdxInc := 0
+	if numGt1 == 0 {
+		ctxIdxInc = min(4, 1+numEq1)
+	}
+
+	b, err := d.decodeDecision(ctxBase + ctxIdxInc)
+	if err != nil {
+		return 0, err
+	}
+	if b == 0 {
+		return 0, nil
+	}
+
+	maxGt1 := 4
+	if cat == catChromaDC {
+		maxGt1 = 3
+	}
+	ctxIdxInc = 5 + min(maxGt1, numGt1)
+
+	// prefix, truncated unary with cMax = 14
+	prefix := int32(1)
+	for prefix < 14 {
+		b, err = d.decodeDecision(ctxBase + ctxIdxInc)
+		if err != nil {
+			return 0, err
+		}
+		if b == 0 {
+			return prefix, nil
+		}
+		prefix++
+	}
+
+	// suffix, Exp-Golomb with k = 0
+	k := 0
+	for {
+		b, err = d.decodeBypass()
+		if err != nil {
+			return 0, err
+		}
+		if b == 0 {
+			break
+		}
+		k++
+		if k > 24 {
+			return 0, errors.New("invalid coeff_abs_level_minus1")
+		}
+	}
+
+	suffix := int32((1 << k) - 1)
+	for k > 0 {
+		k--
+		b, err = d.decodeBypass()
+		if err != nil {
+			return 0, err
+		}
+		suffix += int32(b) << k
+	}
+
+	return prefix + suffix, nil
+}
+
+// readResidualBlockCABAC implements residual_block_cabac() for blocks whose
+// coded_block_flag has already been decoded or inferred to be 1.
+// Levels are written into coeffLevel, which is indexed by scan position.
+// It returns the number of non-zero coefficients.
+// Specification: ITU-T Rec. H.264, section 7.3.5.3.3
+func (d *cabacDecoder) readResidualBlockCABAC(
+	coeffLevel []int32,
+	startIdx int,
+	endIdx int,
+	cat int,
+) (int, error) {
+	for i := startIdx; i <= endIdx; i++ {
+		coeffLevel[i] = 0
+	}
+
+	var sigBase, lastBase, absBase int
+	if cat == catLuma8x8 {
+		sigBase = ctxSignificantCoeff8x8
+		lastBase = ctxLastSignificant8x8
+		absBase = ctxCoeffAbsLevel8x8
+	} else {
+		sigBase = ctxSignificantCoeff + sigCatOffset[cat]
+		lastBase = ctxLastSignificantCoeff + sigCatOffset[cat]
+		absBase = ctxCoeffAbsLevel + absCatOffset[cat]
+	}
+
+	maxNumCoeff := endIdx - startIdx + 1
+
+	var significant [64]bool
+	numCoeff := maxNumCoeff
+
+	for i := 0; i < numCoeff-1; i++ {
+		var sigInc, lastInc int
+		switch cat {
+		case catChromaDC:
+			sigInc = min(i, 2)
+			lastInc = sigInc
+		case catLuma8x8:
+			sigInc = int(sigCoeffFlagOffset8x8[i])
+			lastInc = int(lastCoeffFlagOffset8x8[i])
+		default:
+			sigInc = i
+			lastInc = i
+		}
+
+		b, err := d.decodeDecision(sigBase + sigInc)
+		if err != nil {
+			return 0, err
+		}
+
+		if b == 1 {
+			significant[i] = true
+
+			b, err = d.decodeDecision(lastBase + lastInc)
+			if err != nil {
+				return 0, err
+			}
+			if b == 1 {
+				numCoeff = i + 1
+				break
+			}
+		}
+	}
+	significant[numCoeff-1] = true
+
+	count := 0
+	numGt1, numEq1 := 0, 0
+
+	for i := numCoeff - 1; i >= 0; i-- {
+		if !significant[i] {
+			continue
+		}
+
+		v, err := d.decodeCoeffAbsLevelMinus1(absBase, cat, numGt1, numEq1)
+		if err != nil {
+			return 0, err
+		}
+		v++
+
+		if v == 1 {
+			numEq1++
+		} else {
+			numGt1++
+		}
+
+		sign, err := d.decodeBypass()
+		if err != nil {
+			return 0, err
+		}
+		if sign == 1 {
+			v = -v
+		}
+
+		coeffLevel[startIdx+i] = v
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,413 @@
+package h264dec
+
+import (
+	"errors"
+)
+
+// coeff_token codes, indexed by [table][TotalCoeff*4+TrailingOnes].
+// Specification: ITU-T Rec. H.264, table 9-5
+var (
+	coeffTokenLen = [4][4 * 17]uint8{
+		{
+			1, 0, 0, 0,
+			6, 2, 0, 0, 8, 6, 3, 0, 9, 8, 7, 5, 10, 9, 8, 6,
+			11, 10, 9, 7, 13, 11, 10, 8, 13, 13, 11, 9, 13, 13, 13, 10,
+			14, 14, 13, 11, 14, 14, 14, 13, 15, 15, 14, 14, 15, 15, 15, 14,
+			16, 15, 15, 15, 16, 16, 16, 15, 16, 16, 16, 16, 16, 16, 16, 16,
+		},
+		{
+			2, 0, 0, 0,
+			6, 2, 0, 0, 6, 5, 3, 0, 7, 6, 6, 4, 8, 6, 6, 4,
+			8, 7, 7, 5, 9, 8, 8, 6, 11, 9, 9, 6, 11, 11, 11, 7,
+			12, 11, 11, 9, 12, 12, 12, 11, 12, 12, 12, 11, 13, 13, 13, 12,
+			13, 13, 13, 13, 13, 14, 13, 13, 14, 14, 14, 13, 14, 14, 14, 14,
+		},
+		{
+			4, 0, 0, 0,
+			6, 4, 0, 0, 6, 5, 4, 0, 6, 5, 5, 4, 7, 5, 5, 4,
+			7, 5, 5, 4, 7, 6, 6, 4, 7, 6, 6, 4, 8, 7, 7, 5,
+			8, 8, 7, 6, 9, 8, 8, 7, 9, 9, 8, 8, 9, 9, 9, 8,
+			10, 9, 9, 9, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10, 10,
+		},
+		{
+			6, 0, 0, 0,
+			6, 6, 0, 0, 6, 6, 6, 0, 6, 6, 6, 6, 6, 6, 6, 6,
+			6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6,
+			6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6,
+			6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6,
+		},
+	}
+
+	coeffTokenBits = [4][4 * 17]uint8{
+		{
+			1, 0, 0, 0,
+			5, 1, 0, 0, 7, 4, 1, 0, 7, 6, 5, 3, 7, 6, 5, 3,
+			7, 6, 5, 4, 15, 6, 5, 4, 11, 14, 5, 4, 8, 10, 13, 4,
+			15, 14, 9, 4, 11, 10, 13, 12, 15, 14, 9, 12, 11, 10, 13, 8,
+			15, 1, 9, 12, 11, 14, 13, 8, 7, 10, 9, 12, 4, 6, 5, 8,
+		},
+		{
+			3, 0, 0, 0,
+			11, 2, 0, 0, 7, 7, 3, 0, 7, 10, 9, 5, 7, 6, 5, 4,
+			4, 6, 5, 6, 7, 6, 5, 8, 15, 6, 5, 4, 11, 14, 13, 4,
+			15, 10, 9, 4, 11, 14, 13, 12, 8, 10, 9, 8, 15, 14, 13, 12,
+			11, 10, 9, 12, 7, 11, 6, 8, 9, 8, 10, 1, 7, 6, 5, 4,
+		},
+		{
+			15, 0, 0, 0,
+			15, 14, 0, 0, 11, 15, 13, 0, 8, 12, 14, 12, 15, 10, 11, 11,
+			11, 8, 9, 10, 9, 14, 13, 9, 8, 10, 9, 8, 15, 14, 13, 13,
+			11, 14, 10, 12, 15, 10, 13, 12, 11, 14, 9, 12, 8, 10, 13, 8,
+			13, 7, 9, 12, 9, 12, 11, 10, 5, 8, 7, 6, 1, 4, 3, 2,
+		},
+		{
+			3, 0, 0, 0,
+			0, 1, 0, 0, 4, 5, 6, 0, 8, 9, 10, 11, 12, 13, 14, 15,
+			16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
+			32, 33, 34, 35, 36, 37, 38, 39, 40, 41, 42, 43, 44, 45, 46, 47,
+			48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59, 60, 61, 62, 63,
+		},
+	}
+
+	chromaDCCoeffTokenLen = [4 * 5]uint8{
+		2, 0, 0, 0,
+		6, 1, 0, 0,
+		6, 6, 3, 0,
+		6, 7, 7, 6,
+		6, 8, 8, 7,
+	}
+
+	chromaDCCoeffTokenBits = [4 * 5]uint8{
+		1, 0, 0, 0,
+		7, 1, 0, 0,
+		4, 6, 1, 0,
+		3, 3, 2, 5,
+		2, 3, 2, 0,
+	}
+)
+
+// total_zeros codes, indexed by [tzVlcIndex-1][total_zeros].
+// Specification: ITU-T Rec. H.264, table 9-7, 9-8 and 9-9
+var (
+	totalZerosLen = [15][16]uint8{
+		{1, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 9},
+		{3, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 6, 6, 6, 6},
+		{4, 3, 3, 3, 4, 4, 3, 3, 4, 5, 5, 6, 5, 6},
+		{5, 3, 4, 4, 3, 3, 3, 4, 3, 4, 5, 5, 5},
+		{4, 4, 4, 3, 3, 3, 3, 3, 4, 5, 4, 5},
+		{6, 5, 3, 3, 3, 3, 3, 3, 4, 3, 6},
+		{6, 5, 3, 3, 3, 2, 3, 4, 3, 6},
+		{6, 4, 5, 3, 2, 2, 3, 3, 6},
+		{6, 6, 4, 2, 2, 3, 2, 5},
+		{5, 5, 3, 2, 2, 2, 4},
+		{4, 4, 3, 3, 1, 3},
+		{4, 4, 2, 1, 3},
+		{3, 3, 1, 2},
+		{2, 2, 1},
+		{1, 1},
+	}
+
+	totalZerosBits = [15][16]uint8{
+		{1, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 1},
+		{7, 6, 5, 4, 3, 5, 4, 3, 2, 3, 2, 3, 2, 1, 0},
+		{5, 7, 6, 5, 4, 3, 4, 3, 2, 3, 2, 1, 1, 0},
+		{3, 7, 5, 4, 6, 5, 4, 3, 3, 2, 2, 1, 0},
+		{5, 4, 3, 7, 6, 5, 4, 3, 2, 1, 1, 0},
+		{1, 1, 7, 6, 5, 4, 3, 2, 1, 1, 0},
+		{1, 1, 5, 4, 3, 3, 2, 1, 1, 0},
+		{1, 1, 1, 3, 3, 2, 2, 1, 0},
+		{1, 0, 1, 3, 2, 1, 1, 1},
+		{1, 0, 1, 3, 2, 1, 1},
+		{0, 1, 1, 2, 1, 3},
+		{0, 1, 1, 1, 1},
+		{0, 1, 1, 1},
+		{0, 1, 1},
+		{0, 1},
+	}
+
+	chromaDCTotalZerosLen = [3][4]uint8{
+		{1, 2, 3, 3},
+		{1, 2, 2},
+		{1, 1},
+	}
+
+	chromaDCTotalZerosBits = [3][4]uint8{
+		{1, 1, 1, 0},
+		{1, 1, 0},
+		{1, 0},
+	}
+)
+
+// run_before codes, indexed by [Min(zerosLeft, 7)-1][run_before].
+// Specification: ITU-T Rec. H.264, table 9-10
+var (
+	runBeforeLen = [7][15]uint8{
+		{1, 1},
+		{1, 2, 2},
+		{2, 2, 2, 2},
+		{2, 2, 2, 3, 3},
+		{2, 2, 3, 3, 3, 3},
+		{2, 3, 3, 3, 3, 3, 3},
+		{3, 3, 3, 3, 3, 3, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	}
+
+	runBeforeBits = [7][15]uint8{
+		{1, 0},
+		{1, 1, 0},
+		{3, 2, 1, 0},
+		{3, 2, 1, 1, 0},
+		{3, 2, 3, 2, 1, 0},
+		{3, 0, 1, 3, 2, 5, 4},
+		{7, 6, 5, 4, 3, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+	}
+)
+
+// vlcTable maps the codes of a variable length code to their values.
+type vlcTable struct {
+	maxLen int
+	codes  map[uint32]int // (length << 16 | code) -> value
+}
+
+func newVLCTable(lens []uint8, bits []uint8, valid func(int) bool) *vlcTable {
+	t := &vlcTable{codes: make(map[uint32]int)}
+	for i, l := range lens {
+		if l == 0 || (valid != nil && !valid(i)) {
+			continue
+		}
+		t.codes[uint32(l)<<16|uint32(bits[i])] = i
+		if int(l) > t.maxLen {
+			t.maxLen = int(l)
+		}
+	}
+	return t
+}
+
+func (t *vlcTable) read(r *bitReader) (int, error) {
+	var code uint32
+	for l := 1; l <= t.maxLen; l++ {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		code = code<<1 | b
+
+		if v, ok := t.codes[uint32(l)<<16|code]; ok {
+			return v, nil
+		}
+	}
+	return 0, errors.New("invalid VLC code")
+}
+
+var (
+	coeffTokenTables         [4]*vlcTable
+	chromaDCCoeffTokenTable  *vlcTable
+	totalZerosTables         [15]*vlcTable
+	chromaDCTotalZerosTables [3]*vlcTable
+	runBeforeTables          [7]*vlcTable
+)
+
+func init() {
+	// TrailingOnes can't be greater than TotalCoeff
+	validToken := func(i int) bool {
+		return i&3 <= i>>2
+	}
+
+	for i := range coeffTokenTables {
+		coeffTokenTables[i] = newVLCTable(coeffTokenLen[i][:], coeffTokenBits[i][:], validToken)
+	}
+	chromaDCCoeffTokenTable = newVLCTable(chromaDCCoeffTokenLen[:], chromaDCCoeffTokenBits[:], validToken)
+
+	for i := range totalZerosTables {
+		totalZerosTables[i] = newVLCTable(totalZerosLen[i][:], totalZerosBits[i][:], nil)
+	}
+	for i := range chromaDCTotalZerosTables {
+		chromaDCTotalZerosTables[i] = newVLCTable(chromaDCTotalZerosLen[i][:], chromaDCTotalZerosBits[i][:], nil)
+	}
+	for i := range runBeforeTables {
+		runBeforeTables[i] = newVLCTable(runBeforeLen[i][:], runBeforeBits[i][:], nil)
+	}
+}
+
+// readCoeffToken reads coeff_token and returns TotalCoeff and TrailingOnes.
+// nC is -1 for chroma DC coefficients.
+func readCoeffToken(r *bitReader, nC int) (int, int, error) {
+	var t *vlcTable
+	switch {
+	case nC == -1:
+		t = chromaDCCoeffTokenTable
+	case nC < 2:
+		t = coeffTokenTables[0]
+	case nC < 4:
+		t = coeffTokenTables[1]
+	case nC < 8:
+		t = coeffTokenTables[2]
+	default:
+		t = coeffTokenTables[3]
+	}
+
+	v, err := t.read(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return v >> 2, v & 3, nil
+}
+
+// readResidualBlockCAVLC implements residual_block_cavlc().
+// Levels are written into coeffLevel, which is indexed by scan position.
+// It returns TotalCoeff.
+// Specification: ITU-T Rec. H.264, section 7.3.5.3.2
+func readResidualBlockCAVLC(
+	r *bitReader,
+	coeffLevel []int32,
+	startIdx int,
+	endIdx int,
+	maxNumCoeff int,
+	nC int,
+) (int, error) {
+	for i := startIdx; i <= endIdx; i++ {
+		coeffLevel[i] = 0
+	}
+
+	totalCoeff, trailingOnes, err := readCoeffToken(r, nC)
+	if err != nil {
+		return 0, err
+	}
+
+	if totalCoeff == 0 {
+		return 0, nil
+	}
+	if totalCoeff > endIdx-startIdx+1 {
+		return 0, errors.New("invalid coeff_token")
+	}
+
+	var levelVal [16]int32
+
+	suffixLength := 0
+	if totalCoeff > 10 && trailingOnes < 3 {
+		suffixLength = 1
+	}
+
+	for i := 0; i < totalCoeff; i++ {
+		if i < trailingOnes {
+			var sign uint32
+			sign, err = r.readBit()
+			if err != nil {
+				return 0, err
+			}
+			levelVal[i] = 1 - 2*int32(sign)
+			continue
+		}
+
+		levelPrefix := 0
+		for {
+			var b uint32
+			b, err = r.readBit()
+			if err != nil {
+				return 0, err
+			}
+			if b == 1 {
+				break
+			}
+			levelPrefix++
+			if levelPrefix > 25 {
+				return 0, errors.New("invalid level_prefix")
+			}
+		}
+
+		levelCode := int32(min(15, levelPrefix) << suffixLength)
+
+		if suffixLength > 0 || levelPrefix >= 14 {
+			levelSuffixSize := suffixLength
+			switch {
+			case levelPrefix == 14 && suffixLength == 0:
+				levelSuffixSize = 4
+			case levelPrefix >= 15:
+				levelSuffixSize = levelPrefix - 3
+			}
+
+			if levelSuffixSize > 0 {
+				var levelSuffix uint32
+				levelSuffix, err = r.readBits(levelSuffixSize)
+				if err != nil {
+					return 0, err
+				}
+				levelCode += int32(levelSuffix)
+			}
+		}
+
+		if levelPrefix >= 15 && suffixLength == 0 {
+			levelCode += 15
+		}
+		if levelPrefix >= 16 {
+			levelCode += (1 << (levelPrefix - 3)) - 4096
+		}
+		if i == trailingOnes && trailingOnes < 3 {
+			levelCode += 2
+		}
+
+		if levelCode%2 == 0 {
+			levelVal[i] = (levelCode + 2) >> 1
+		} else {
+			levelVal[i] = (-levelCode - 1) >> 1
+		}
+
+		if suffixLength == 0 {
+			suffixLength = 1
+		}
+		if abs32(levelVal[i]) > (3<<(suffixLength-1)) && suffixLength < 6 {
+			suffixLength++
+		}
+	}
+
+	zerosLeft := 0
+	if totalCoeff < endIdx-startIdx+1 {
+		var t *vlcTable
+		if maxNumCoeff == 4 {
+			t = chromaDCTotalZerosTables[totalCoeff-1]
+		} else {
+			t = totalZerosTables[totalCoeff-1]
+		}
+
+		zerosLeft, err = t.read(r)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if totalCoeff+zerosLeft > endIdx-startIdx+1 {
+		return 0, errors.New("invalid total_zeros")
+	}
+
+	var runVal [16]int
+	for i := 0; i < totalCoeff-1; i++ {
+		if zerosLeft > 0 {
+			var runBefore int
+			runBefore, err = runBeforeTables[min(zerosLeft, 7)-1].read(r)
+			if err != nil {
+				return 0, err
+			}
+			if runBefore > zerosLeft {
+				return 0, errors.New("invalid run_before")
+			}
+			runVal[i] = runBefore
+			zerosLeft -= runBefore
+		}
+	}
+	runVal[totalCoeff-1] = zerosLeft
+
+	coeffNum := -1
+	for i := totalCoeff - 1; i >= 0; i-- {
+		coeffNum += runVal[i] + 1
+		coeffLevel[startIdx+coeffNum] = levelVal[i]
+	}
+
+	return totalCoeff, nil
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,237 @@
+package h264dec
+
+// deblock applies the deblocking filter to the whole picture.
+// Since all macroblocks are intra, bS is 4 on macroblock edges and 3 on internal edges.
+// Specification: ITU-T Rec. H.264, section 8.7
+func (p *picture) deblock() {
+	for addr := range p.mbs {
+		p.deblockMacroblock(addr)
+	}
+}
+
+func (p *picture) deblockMacroblock(addr int) {
+	mb := &p.mbs[addr]
+	sh := p.slices[mb.sliceNum-1]
+
+	if sh.disableDeblockingFilterIdc == 1 {
+		return
+	}
+
+	w := p.widthMbs
+	mbX, mbY := addr%w, addr/w
+
+	var left, top *macroblock
+	if mbX > 0 {
+		left = &p.mbs[addr-1]
+	}
+	if mbY > 0 {
+		top = &p.mbs[addr-w]
+	}
+
+	// edges shared with other slices are not filtered when disable_deblocking_filter_idc is 2
+	if sh.disableDeblockingFilterIdc == 2 {
+		if left != nil && left.sliceNum != mb.sliceNum {
+			left = nil
+		}
+		if top != nil && top.sliceNum != mb.sliceNum {
+			top = nil
+		}
+	}
+
+	// luma
+	lumaStep := 4
+	if mb.transform8x8 {
+		lumaStep = 8
+	}
+
+	off := mbY*16*p.yStride + mbX*16
+
+	for x := 0; x < 16; x += lumaStep {
+		p.filterLumaEdge(mb, left, x == 0, off+x, 1, p.yStride, sh)
+	}
+	for y := 0; y < 16; y += lumaStep {
+		p.filterLumaEdge(mb, top, y == 0, off+y*p.yStride, p.yStride, 1, sh)
+	}
+
+	if !p.chroma {
+		return
+	}
+
+	// chroma
+	cOff := mbY*8*p.cStride + mbX*8
+
+	for c, plane := range [][]uint8{p.cb, p.cr} {
+		offset := sh.pps.chromaQPIndexOffset[c]
+
+		for x := 0; x < 8; x += 4 {
+			p.filterChromaEdge(plane, mb, left, x == 0, cOff+x, 1, p.cStride, offset, sh)
+		}
+		for y := 0; y < 8; y += 4 {
+			p.filterChromaEdge(plane, mb, top, y == 0, cOff+y*p.cStride, p.cStride, 1, offset, sh)
+		}
+	}
+}
+
+// filterLumaEdge filters a luma edge.
+// q0 of the first line is at off; across is the distance between p0 and q0,
+// along is the distance between lines.
+func (p *picture) filterLumaEdge(
+	mb *macroblock,
+	neighbour *macroblock,
+	mbEdge bool,
+	off int,
+	across int,
+	along int,
+	sh *sliceHeader,
+) {
+	qpP := mb.qp
+	bS := 3
+
+	if mbEdge {
+		if neighbour == nil {
+			return
+		}
+		qpP = neighbour.qp
+		bS = 4
+	}
+
+	qpAv := (qpP + mb.qp + 1) >> 1
+	filterEdge(p.y, off, across, along, 16, true, bS, qpAv, sh)
+}
+
+func (p *picture) filterChromaEdge(
+	plane []uint8,
+	mb *macroblock,
+	neighbour *macroblock,
+	mbEdge bool,
+	off int,
+	across int,
+	along int,
+	qpOffset int,
+	sh *sliceHeader,
+) {
+	qpQ := chromaQP(mb.qp, qpOffset)
+	qpP := qpQ
+	bS := 3
+
+	if mbEdge {
+		if neighbour == nil {
+			return
+		}
+		qpP = chromaQP(neighbour.qp, qpOffset)
+		bS = 4
+	}
+
+	qpAv := (qpP + qpQ + 1) >> 1
+	filterEdge(plane, off, across, along, 8, false, bS, qpAv, sh)
+}
+
+// filterEdge filters the samples of an edge.
+// Specification: ITU-T Rec. H.264, section 8.7.2
+func filterEdge(
+	pix []uint8,
+	off int,
+	across int,
+	along int,
+	n int,
+	luma bool,
+	bS int,
+	qpAv int,
+	sh *sliceHeader,
+) {
+	indexA := clip3(0, 51, qpAv+sh.filterOffsetA)
+	indexB := clip3(0, 51, qpAv+sh.filterOffsetB)
+
+	alpha := alphaTable[indexA]
+	beta := betaTable[indexB]
+	if alpha == 0 || beta == 0 {
+		return
+	}
+
+	tc0 := tC0Table[indexA][min(bS, 3)-1]
+
+	for k := 0; k < n; k++ {
+		pos := off + k*along
+		filterSamples(pix, pos, across, luma, bS, alpha, beta, tc0)
+	}
+}
+
+// filterSamples filters a line of samples across an edge.
+// Specification: ITU-T Rec. H.264, section 8.7.2.3 and 8.7.2.4
+func filterSamples(pix []uint8, pos int, across int, luma bool, bS int, alpha int, beta int, tc0 int) {
+	p0 := int(pix[pos-across])
+	p1 := int(pix[pos-2*across])
+	q0 := int(pix[pos])
+	q1 := int(pix[pos+across])
+
+	if absInt(p0-q0) >= alpha || absInt(p1-p0) >= beta || absInt(q1-q0) >= beta {
+		return
+	}
+
+	if !luma {
+		if bS < 4 {
+			tc := tc0 + 1
+			delta := clip3(-tc, tc, (((q0-p0)<<2)+(p1-q1)+4)>>3)
+			pix[pos-across] = clip1(int32(p0 + delta))
+			pix[pos] = clip1(int32(q0 - delta))
+		} else {
+			pix[pos-across] = uint8((2*p1 + p0 + q1 + 2) >> 2)
+			pix[pos] = uint8((2*q1 + q0 + p1 + 2) >> 2)
+		}
+		return
+	}
+
+	p2 := int(pix[pos-3*across])
+	q2 := int(pix[pos+2*across])
+	ap := absInt(p2 - p0)
+	aq := absInt(q2 - q0)
+
+	if bS < 4 {
+		tc := tc0
+		if ap < beta {
+			tc++
+		}
+		if aq < beta {
+			tc++
+		}
+
+		delta := clip3(-tc, tc, (((q0-p0)<<2)+(p1-q1)+4)>>3)
+		pix[pos-across] = clip1(int32(p0 + delta))
+		pix[pos] = clip1(int32(q0 - delta))
+
+		if ap < beta {
+			pix[pos-2*across] = clip1(int32(p1 + clip3(-tc0, tc0, (p2+((p0+q0+1)>>1)-(p1<<1))>>1)))
+		}
+		if aq < beta {
+			pix[pos+across] = clip1(int32(q1 + clip3(-tc0, tc0, (q2+((p0+q0+1)>>1)-(q1<<1))>>1)))
+		}
+		return
+	}
+
+	strong := absInt(p0-q0) < ((alpha >> 2) + 2)
+
+	if ap < beta && strong {
+		p3 := int(pix[pos-4*across])
+		pix[pos-across] = uint8((p2 + 2*p1 + 2*p0 + 2*q0 + q1 + 4) >> 3)
+		pix[pos-2*across] = uint8((p2 + p1 + p0 + q0 + 2) >> 2)
+		pix[pos-3*across] = uint8((2*p3 + 3*p2 + p1 + p0 + q0 + 4) >> 3)
+	} else {
+		pix[pos-across] = uint8((2*p1 + p0 + q1 + 2) >> 2)
+	}
+
+	if aq < beta && strong {
+		q3 := int(pix[pos+3*across])
+		pix[pos] = uint8((p1 + 2*p0 + 2*q0 + 2*q1 + q2 + 4) >> 3)
+		pix[pos+across] = uint8((p0 + q0 + q1 + q2 + 2) >> 2)
+		pix[pos+2*across] = uint8((2*q3 + 3*q2 + q1 + q0 + p0 + 4) >> 3)
+	} else {
+		pix[pos] = uint8((2*q1 + q0 + p1 + 2) >> 2)
+	}
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,147 @@
+// Package h264dec contains a pure-Go decoder of H264 intra frames.
+package h264dec
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+)
+
+// ErrNotIntra is returned when an access unit doesn't contain an intra frame.
+var ErrNotIntra = errors.New("access unit doesn't contain an intra frame")
+
+// Decoder is a decoder of H264 intra frames (IDR frames and frames made of I slices).
+// It supports the intra tools of the Baseline, Main and High profiles:
+// CAVLC and CABAC, 4x4, 8x8 and 16x16 intra prediction, I_PCM, scaling matrices,
+// multiple slices and the deblocking filter.
+// Interlaced and 4:2:2 / 4:4:4 content is not supported.
+type Decoder struct {
+	spss       map[uint32]*sps
+	ppss       map[uint32][]byte
+	parsedPPSs map[uint32]*pps
+}
+
+// Initialize initializes a Decoder.
+func (d *Decoder) Initialize() error {
+	d.spss = make(map[uint32]*sps)
+	d.ppss = make(map[uint32][]byte)
+	d.parsedPPSs = make(map[uint32]*pps)
+	return nil
+}
+
+// Decode decodes an access unit.
+// Parameter sets can be part of the access unit or of previous ones.
+// It returns ErrNotIntra when the access unit doesn't contain an intra frame.
+func (d *Decoder) Decode(au [][]byte) (img image.Image, err error) {
+	// access units come from cameras and files, a corrupted one must not crash the server
+	defer func() {
+		if p := recover(); p != nil {
+			img = nil
+			err = fmt.Errorf("corrupted access unit: %v", p)
+		}
+	}()
+
+	return d.decode(au)
+}
+
+func (d *Decoder) decode(au [][]byte) (image.Image, error) {
+	var pic *picture
+
+	for _, nalu := range au {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		typ := h264.NALUType(nalu[0] & 0x1F)
+
+		switch typ {
+		case h264.NALUTypeSPS:
+			s, err := parseSPS(h264.EmulationPreventionRemove(nalu))
+			if err != nil {
+				return nil, fmt.Errorf("invalid SPS: %w", err)
+			}
+			d.spss[s.id] = s
+
+			// PPSs are parsed when they are used, since they depend on SPSs
+			clear(d.parsedPPSs)
+
+		case h264.NALUTypePPS:
+			rbsp := h264.EmulationPreventionRemove(nalu)
+
+			r := newBitReader(rbsp)
+			r.pos = 8
+			id, err := r.readUEMax(255, "pic_parameter_set_id")
+			if err != nil {
+				return nil, fmt.Errorf("invalid PPS: %w", err)
+			}
+			d.ppss[id] = rbsp
+			delete(d.parsedPPSs, id)
+
+		case h264.NALUTypeDataPartitionA, h264.NALUTypeDataPartitionB, h264.NALUTypeDataPartitionC:
+			return nil, fmt.Errorf("data partitioning is not supported")
+
+		case h264.NALUTypeIDR, h264.NALUTypeNonIDR:
+			r := newBitReader(h264.EmulationPreventionRemove(nalu))
+			r.pos = 8
+
+			sh, err := parseSliceHeader(r, typ, (nalu[0]>>5)&0x03, d.spss, d.pps)
+			if err != nil {
+				return nil, fmt.Errorf("invalid slice header: %w", err)
+			}
+
+			if sh.sliceType%5 != sliceTypeI {
+				return nil, ErrNotIntra
+			}
+
+			// redundant slices are not needed when primary slices are available
+			if sh.redundantPicCnt != 0 {
+				continue
+			}
+
+			if pic == nil {
+				pic = newPicture(sh.sps)
+			} else if pic.sps != sh.sps {
+				return nil, fmt.Errorf("slices refer to different SPSs")
+			}
+
+			err = pic.decodeSlice(r, sh)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if pic == nil {
+		return nil, ErrNotIntra
+	}
+
+	if pic.decodedMbs != len(pic.mbs) {
+		return nil, fmt.Errorf("frame is incomplete (%d of %d macroblocks)", pic.decodedMbs, len(pic.mbs))
+	}
+
+	pic.deblock()
+
+	return pic.image(), nil
+}
+
+// pps returns the parsed PPS with the given ID.
+func (d *Decoder) pps(id uint32) (*pps, error) {
+	if p, ok := d.parsedPPSs[id]; ok {
+		return p, nil
+	}
+
+	rbsp, ok := d.ppss[id]
+	if !ok {
+		return nil, fmt.Errorf("slice refers to a missing PPS (%d)", id)
+	}
+
+	p, err := parsePPS(rbsp, d.spss)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PPS: %w", err)
+	}
+
+	d.parsedPPSs[id] = p
+	return p, nil
+}
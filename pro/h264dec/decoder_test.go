@@ -0,0 +1,189 @@
+package h264dec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/stretchr/testify/require"
+)
+
+// hashYCbCr returns the SHA-256 of the I420 samples of an image.
+func hashYCbCr(img *image.YCbCr) string {
+	h := sha256.New()
+	w, ht := img.Rect.Dx(), img.Rect.Dy()
+
+	for y := 0; y < ht; y++ {
+		h.Write(img.Y[y*img.YStride : y*img.YStride+w])
+	}
+	for _, plane := range [][]uint8{img.Cb, img.Cr} {
+		for y := 0; y < ht/2; y++ {
+			h.Write(plane[y*img.CStride : y*img.CStride+w/2])
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestDecode(t *testing.T) {
+	// hashes have been computed with the libavcodec decoder embedded in Chromium
+	for _, ca := range []struct {
+		name   string
+		file   string
+		width  int
+		height int
+		hash   string
+	}{
+		{
+			"flat",
+			"flat.h264",
+			64,
+			64,
+			"e73a3b0168597953992650452b153d6d316f649254b2493864fb6d320a3d8f53",
+		},
+		{
+			"baseline cavlc",
+			"baseline_cavlc.h264",
+			320,
+			240,
+			"b6c4658ec90a14a71266dbfad36eff3c2c936e6ddef937c7928abdd57ab84a71",
+		},
+		{
+			"high cabac",
+			"high_cabac.h264",
+			320,
+			240,
+			"c085db002b8801e7c88b33dd5b50d8a8052d33d1bb77937998c75d9fc064f7de",
+		},
+		{
+			"high cabac 8x8",
+			"high_cabac_8x8.h264",
+			640,
+			360,
+			"7b91ad386760d44952ce2659d961eda095fc05996afd64daf5bc2e1523437c5a",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			byts, err := os.ReadFile(filepath.Join("testdata", ca.file))
+			require.NoError(t, err)
+
+			var au h264.AnnexB
+			err = au.Unmarshal(byts)
+			require.NoError(t, err)
+
+			var d Decoder
+			err = d.Initialize()
+			require.NoError(t, err)
+
+			img, err := d.Decode(au)
+			require.NoError(t, err)
+
+			ycbcr, ok := img.(*image.YCbCr)
+			require.True(t, ok)
+			require.Equal(t, image.Rect(0, 0, ca.width, ca.height), ycbcr.Rect)
+			require.Equal(t, ca.hash, hashYCbCr(ycbcr))
+		})
+	}
+}
+
+func TestDecodeParamsFromPreviousAU(t *testing.T) {
+	byts, err := os.ReadFile(filepath.Join("testdata", "high_cabac.h264"))
+	require.NoError(t, err)
+
+	var au h264.AnnexB
+	err = au.Unmarshal(byts)
+	require.NoError(t, err)
+
+	var params [][]byte
+	var frame [][]byte
+	for _, nalu := range au {
+		switch h264.NALUType(nalu[0] & 0x1F) {
+		case h264.NALUTypeSPS, h264.NALUTypePPS:
+			params = append(params, nalu)
+		default:
+			frame = append(frame, nalu)
+		}
+	}
+
+	var d Decoder
+	err = d.Initialize()
+	require.NoError(t, err)
+
+	_, err = d.Decode(params)
+	require.Equal(t, ErrNotIntra, err)
+
+	_, err = d.Decode(frame)
+	require.NoError(t, err)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	byts, err := os.ReadFile(filepath.Join("testdata", "baseline_cavlc.h264"))
+	require.NoError(t, err)
+
+	var au h264.AnnexB
+	err = au.Unmarshal(byts)
+	require.NoError(t, err)
+
+	t.Run("missing pps", func(t *testing.T) {
+		var d Decoder
+		err = d.Initialize()
+		require.NoError(t, err)
+
+		var frame [][]byte
+		for _, nalu := range au {
+			if h264.NALUType(nalu[0]&0x1F) != h264.NALUTypePPS {
+				frame = append(frame, nalu)
+			}
+		}
+
+		_, err = d.Decode(frame)
+		require.EqualError(t, err, "invalid slice header: slice refers to a missing PPS (0)")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		var d Decoder
+		err = d.Initialize()
+		require.NoError(t, err)
+
+		truncated := make([][]byte, len(au))
+		copy(truncated, au)
+		last := truncated[len(truncated)-1]
+		truncated[len(truncated)-1] = last[:len(last)/2]
+
+		_, err = d.Decode(truncated)
+		require.Error(t, err)
+	})
+
+	t.Run("not intra", func(t *testing.T) {
+		var d Decoder
+		err = d.Initialize()
+		require.NoError(t, err)
+
+		_, err = d.Decode([][]byte{{byte(h264.NALUTypeSEI), 0x80}})
+		require.Equal(t, ErrNotIntra, err)
+	})
+}
+
+// FuzzDecode calls decode directly, since Decode turns panics into errors.
+func FuzzDecode(f *testing.F) {
+	for _, file := range []string{"flat.h264", "baseline_cavlc.h264", "high_cabac.h264", "high_cabac_8x8.h264"} {
+		byts, err := os.ReadFile(filepath.Join("testdata", file))
+		require.NoError(f, err)
+		f.Add(byts)
+	}
+
+	f.Fuzz(func(_ *testing.T, b []byte) {
+		var au h264.AnnexB
+		if au.Unmarshal(b) != nil {
+			au = [][]byte{b}
+		}
+
+		var d Decoder
+		d.Initialize() //nolint:errcheck
+		d.decode(au)   //nolint:errcheck
+	})
+}
@@ -0,0 +1,787 @@
+package h264dec
+
+import (
+	"fmt"
+)
+
+// sliceDecoder decodes the macroblocks of a slice.
+type sliceDecoder struct {
+	pic                *picture
+	sh                 *sliceHeader
+	sliceNum           int
+	r                  *bitReader
+	cabac              *cabacDecoder // nil when the slice is coded with CAVLC
+	qp                 int
+	prevQPDeltaNonZero bool
+
+	levelScale4x4 [3][6][16]int32
+	levelScale8x8 [6][64]int32
+
+	// current macroblock and its neighbours (nil when not available)
+	cur  *macroblock
+	mbX  int
+	mbY  int
+	mbA  *macroblock
+	mbB  *macroblock
+	mbC  *macroblock
+	mbD  *macroblock
+	pred int // Intra16x16PredMode
+
+	// residual of the current macroblock, indexed by scan position
+	lumaDC   [16]int32
+	luma     [16][16]int32 // indexed by luma4x4BlkIdx
+	luma8x8  [4][64]int32
+	chromaDC [2][4]int32
+	chromaAC [2][4][16]int32
+}
+
+func (sd *sliceDecoder) initLevelScale() {
+	sc := &sd.sh.pps.scaling
+
+	for m := 0; m < 6; m++ {
+		// Intra Y, Intra Cb, Intra Cr
+		for c := 0; c < 3; c++ {
+			sd.levelScale4x4[c][m] = levelScale4x4(&sc.list4x4[c], m)
+		}
+		sd.levelScale8x8[m] = levelScale8x8(&sc.list8x8[0], m)
+	}
+}
+
+// available returns the macroblock with the given address when it can be used
+// for prediction, that is, when it belongs to the current slice.
+func (sd *sliceDecoder) available(addr int) *macroblock {
+	mb := &sd.pic.mbs[addr]
+	if mb.sliceNum != sd.sliceNum {
+		return nil
+	}
+	return mb
+}
+
+func (sd *sliceDecoder) setCurrent(addr int) {
+	w := sd.pic.widthMbs
+
+	sd.cur = &sd.pic.mbs[addr]
+	sd.mbX = addr % w
+	sd.mbY = addr / w
+	sd.mbA, sd.mbB, sd.mbC, sd.mbD = nil, nil, nil, nil
+
+	if sd.mbX > 0 {
+		sd.mbA = sd.available(addr - 1)
+	}
+	if sd.mbY > 0 {
+		sd.mbB = sd.available(addr - w)
+		if sd.mbX > 0 {
+			sd.mbD = sd.available(addr - w - 1)
+		}
+		if sd.mbX < w-1 {
+			sd.mbC = sd.available(addr - w + 1)
+		}
+	}
+}
+
+// decodeMacroblock decodes macroblock_layer() and reconstructs the macroblock.
+// Specification: ITU-T Rec. H.264, section 7.3.5
+func (sd *sliceDecoder) decodeMacroblock(addr int) error {
+	sd.setCurrent(addr)
+	mb := sd.cur
+	*mb = macroblock{sliceNum: sd.sliceNum}
+
+	typ, err := sd.readMbType()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case typ == 0:
+		mb.typ = mbTypeINxN
+
+	case typ == 25:
+		mb.typ = mbTypeIPCM
+		return sd.decodePCM()
+
+	default:
+		// Specification: ITU-T Rec. H.264, table 7-11
+		mb.typ = mbTypeI16x16
+		sd.pred = int(typ-1) % 4
+		mb.cbpChroma = (int(typ-1) / 4) % 3
+		if typ >= 13 {
+			mb.cbpLuma = 15
+		}
+	}
+
+	if mb.typ == mbTypeINxN {
+		if sd.sh.pps.transform8x8Mode {
+			mb.transform8x8, err = sd.readTransformSize8x8Flag()
+			if err != nil {
+				return err
+			}
+		}
+
+		err = sd.readIntraPredModes()
+		if err != nil {
+			return err
+		}
+	}
+
+	if sd.pic.chroma {
+		mb.chromaPredMode, err = sd.readIntraChromaPredMode()
+		if err != nil {
+			return err
+		}
+	}
+
+	if mb.typ == mbTypeINxN {
+		var cbp int
+		cbp, err = sd.readCodedBlockPattern()
+		if err != nil {
+			return err
+		}
+		mb.cbpLuma = cbp & 0x0F
+		mb.cbpChroma = cbp >> 4
+	}
+
+	if mb.typ == mbTypeI16x16 || mb.cbpLuma != 0 || mb.cbpChroma != 0 {
+		var delta int
+		delta, err = sd.readMbQPDelta()
+		if err != nil {
+			return err
+		}
+
+		sd.qp = (sd.qp + delta + 52) % 52
+		sd.prevQPDeltaNonZero = (delta != 0)
+
+		err = sd.readResidual()
+		if err != nil {
+			return err
+		}
+	} else {
+		sd.prevQPDeltaNonZero = false
+	}
+
+	mb.qp = sd.qp
+
+	return sd.reconstruct()
+}
+
+// decodePCM decodes the samples of an I_PCM macroblock.
+func (sd *sliceDecoder) decodePCM() error {
+	r := sd.r
+	p := sd.pic
+	mb := sd.cur
+
+	// pcm_alignment_zero_bit
+	for !r.byteAligned() {
+		_, err := r.readBit()
+		if err != nil {
+			return err
+		}
+	}
+
+	x0, y0 := sd.mbX*16, sd.mbY*16
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			v, err := r.readBits(8)
+			if err != nil {
+				return err
+			}
+			p.y[(y0+y)*p.yStride+x0+x] = uint8(v)
+		}
+	}
+
+	if p.chroma {
+		for _, plane := range [][]uint8{p.cb, p.cr} {
+			for y := 0; y < 8; y++ {
+				for x := 0; x < 8; x++ {
+					v, err := r.readBits(8)
+					if err != nil {
+						return err
+					}
+					plane[(y0/2+y)*p.cStride+x0/2+x] = uint8(v)
+				}
+			}
+		}
+	}
+
+	// the deblocking filter uses a QP equal to 0,
+	// while the QP of the following macroblock is predicted from the slice one.
+	mb.qp = 0
+	mb.cbpLuma = 15
+	mb.cbpChroma = 2
+	mb.dcFlags = 0x07
+	for i := range mb.nonZero {
+		for j := range mb.nonZero[i] {
+			mb.nonZero[i][j] = 16
+		}
+	}
+	sd.prevQPDeltaNonZero = false
+
+	if sd.cabac != nil {
+		return sd.cabac.initEngine()
+	}
+	return nil
+}
+
+// readMbType reads mb_type of an I slice.
+// Specification: ITU-T Rec. H.264, section 9.3.2.5
+func (sd *sliceDecoder) readMbType() (uint32, error) {
+	if sd.cabac == nil {
+		return sd.r.readUEMax(25, "mb_type")
+	}
+
+	d := sd.cabac
+
+	ctxIdxInc := 0
+	if sd.mbA != nil && sd.mbA.typ != mbTypeINxN {
+		ctxIdxInc++
+	}
+	if sd.mbB != nil && sd.mbB.typ != mbTypeINxN {
+		ctxIdxInc++
+	}
+
+	b, err := d.decodeDecision(ctxMbTypeI + ctxIdxInc)
+	if err != nil || b == 0 {
+		return 0, err
+	}
+
+	b, err = d.decodeTerminate()
+	if err != nil {
+		return 0, err
+	}
+	if b == 1 {
+		return 25, nil
+	}
+
+	luma, err := d.decodeDecision(ctxMbTypeI + 3)
+	if err != nil {
+		return 0, err
+	}
+
+	chroma, err := d.decodeDecision(ctxMbTypeI + 4)
+	if err != nil {
+		return 0, err
+	}
+
+	if chroma != 0 {
+		b, err = d.decodeDecision(ctxMbTypeI + 5)
+		if err != nil {
+			return 0, err
+		}
+		chroma += b
+	}
+
+	hi, err := d.decodeDecision(ctxMbTypeI + 6)
+	if err != nil {
+		return 0, err
+	}
+
+	lo, err := d.decodeDecision(ctxMbTypeI + 7)
+	if err != nil {
+		return 0, err
+	}
+
+	return 1 + (hi<<1 | lo) + 4*chroma + 12*luma, nil
+}
+
+func (sd *sliceDecoder) readTransformSize8x8Flag() (bool, error) {
+	if sd.cabac == nil {
+		return sd.r.readFlag()
+	}
+
+	ctxIdxInc := 0
+	if sd.mbA != nil && sd.mbA.transform8x8 {
+		ctxIdxInc++
+	}
+	if sd.mbB != nil && sd.mbB.transform8x8 {
+		ctxIdxInc++
+	}
+
+	b, err := sd.cabac.decodeDecision(ctxTransformSize8x8 + ctxIdxInc)
+	return b == 1, err
+}
+
+// readRemIntraPredMode reads prev_intra_pred_mode_flag and rem_intra_pred_mode.
+// It returns -1 when the predicted mode has to be used.
+func (sd *sliceDecoder) readRemIntraPredMode() (int, error) {
+	if sd.cabac == nil {
+		prev, err := sd.r.readFlag()
+		if err != nil || prev {
+			return -1, err
+		}
+
+		v, err := sd.r.readBits(3)
+		return int(v), err
+	}
+
+	b, err := sd.cabac.decodeDecision(ctxPrevIntraPredMode)
+	if err != nil || b == 1 {
+		return -1, err
+	}
+
+	v := 0
+	for i := 0; i < 3; i++ {
+		b, err = sd.cabac.decodeDecision(ctxRemIntraPredMode)
+		if err != nil {
+			return 0, err
+		}
+		v |= int(b) << i
+	}
+
+	return v, nil
+}
+
+// readIntraPredModes reads and derives Intra4x4PredMode or Intra8x8PredMode.
+// Specification: ITU-T Rec. H.264, section 8.3.1.1 and 8.3.2.1
+func (sd *sliceDecoder) readIntraPredModes() error {
+	mb := sd.cur
+
+	if mb.transform8x8 {
+		for b8 := 0; b8 < 4; b8++ {
+			rp := (b8/2)*8 + (b8%2)*2
+
+			mode, err := sd.readIntraPredMode(rp)
+			if err != nil {
+				return err
+			}
+
+			mb.predModes[rp] = mode
+			mb.predModes[rp+1] = mode
+			mb.predModes[rp+4] = mode
+			mb.predModes[rp+5] = mode
+		}
+		return nil
+	}
+
+	for blkIdx := 0; blkIdx < 16; blkIdx++ {
+		rp := blkIdxToRaster[blkIdx]
+
+		mode, err := sd.readIntraPredMode(rp)
+		if err != nil {
+			return err
+		}
+
+		mb.predModes[rp] = mode
+	}
+
+	return nil
+}
+
+// readIntraPredMode returns the prediction mode of the block whose top-left
+// 4x4 block has the given raster position.
+func (sd *sliceDecoder) readIntraPredMode(rp int) (int8, error) {
+	rem, err := sd.readRemIntraPredMode()
+	if err != nil {
+		return 0, err
+	}
+
+	mode := sd.predictIntraPredMode(rp)
+
+	if rem >= 0 {
+		if rem < int(mode) {
+			mode = int8(rem)
+		} else {
+			mode = int8(rem + 1)
+		}
+	}
+
+	return mode, nil
+}
+
+func (sd *sliceDecoder) predictIntraPredMode(rp int) int8 {
+	bx, by := rp%4, rp/4
+
+	var modeA, modeB int8
+
+	switch {
+	case bx > 0:
+		modeA = sd.cur.predModes[rp-1]
+	case sd.mbA != nil:
+		modeA = neighbourPredMode(sd.mbA, rp+3)
+	default:
+		return 2
+	}
+
+	switch {
+	case by > 0:
+		modeB = sd.cur.predModes[rp-4]
+	case sd.mbB != nil:
+		modeB = neighbourPredMode(sd.mbB, rp+12)
+	default:
+		return 2
+	}
+
+	return min(modeA, modeB)
+}
+
+func neighbourPredMode(mb *macroblock, rp int) int8 {
+	if mb.typ != mbTypeINxN {
+		return 2 // Intra_4x4_DC / Intra_8x8_DC
+	}
+	return mb.predModes[rp]
+}
+
+func (sd *sliceDecoder) readIntraChromaPredMode() (int, error) {
+	if sd.cabac == nil {
+		v, err := sd.r.readUEMax(3, "intra_chroma_pred_mode")
+		return int(v), err
+	}
+
+	ctxIdxInc := 0
+	for _, n := range []*macroblock{sd.mbA, sd.mbB} {
+		if n != nil && n.typ != mbTypeIPCM && n.chromaPredMode != 0 {
+			ctxIdxInc++
+		}
+	}
+
+	b, err := sd.cabac.decodeDecision(ctxIntraChromaPredMode + ctxIdxInc)
+	if err != nil || b == 0 {
+		return 0, err
+	}
+
+	// truncated unary with cMax = 3
+	mode := 1
+	for mode < 3 {
+		b, err = sd.cabac.decodeDecision(ctxIntraChromaPredMode + 3)
+		if err != nil {
+			return 0, err
+		}
+		if b == 0 {
+			break
+		}
+		mode++
+	}
+
+	return mode, nil
+}
+
+// readCodedBlockPattern reads coded_block_pattern.
+// Specification: ITU-T Rec. H.264, section 9.1.2 and 9.3.3.1.1.4
+func (sd *sliceDecoder) readCodedBlockPattern() (int, error) {
+	if sd.cabac == nil {
+		if sd.pic.chroma {
+			v, err := sd.r.readUEMax(47, "coded_block_pattern")
+			if err != nil {
+				return 0, err
+			}
+			return int(golombToIntraCBP[v]), nil
+		}
+
+		v, err := sd.r.readUEMax(15, "coded_block_pattern")
+		if err != nil {
+			return 0, err
+		}
+		return int(golombToIntraCBPGray[v]), nil
+	}
+
+	d := sd.cabac
+	luma := 0
+
+	for b8 := 0; b8 < 4; b8++ {
+		// condTermFlagN is 1 when the neighbouring 8x8 block has no coded coefficients
+		condA, condB := 0, 0
+
+		if b8%2 == 1 {
+			if (luma>>(b8-1))&1 == 0 {
+				condA = 1
+			}
+		} else if sd.mbA != nil && sd.mbA.typ != mbTypeIPCM && (sd.mbA.cbpLuma>>(b8+1))&1 == 0 {
+			condA = 1
+		}
+
+		if b8/2 == 1 {
+			if (luma>>(b8-2))&1 == 0 {
+				condB = 1
+			}
+		} else if sd.mbB != nil && sd.mbB.typ != mbTypeIPCM && (sd.mbB.cbpLuma>>(b8+2))&1 == 0 {
+			condB = 1
+		}
+
+		b, err := d.decodeDecision(ctxCodedBlockPattern + condA + 2*condB)
+		if err != nil {
+			return 0, err
+		}
+		luma |= int(b) << b8
+	}
+
+	if !sd.pic.chroma {
+		return luma, nil
+	}
+
+	condA, condB := 0, 0
+	if sd.mbA != nil && (sd.mbA.typ == mbTypeIPCM || sd.mbA.cbpChroma != 0) {
+		condA = 1
+	}
+	if sd.mbB != nil && (sd.mbB.typ == mbTypeIPCM || sd.mbB.cbpChroma != 0) {
+		condB = 1
+	}
+
+	b, err := d.decodeDecision(ctxCodedBlockPattern + 4 + condA + 2*condB)
+	if err != nil || b == 0 {
+		return luma, err
+	}
+
+	condA, condB = 0, 0
+	if sd.mbA != nil && (sd.mbA.typ == mbTypeIPCM || sd.mbA.cbpChroma == 2) {
+		condA = 1
+	}
+	if sd.mbB != nil && (sd.mbB.typ == mbTypeIPCM || sd.mbB.cbpChroma == 2) {
+		condB = 1
+	}
+
+	b, err = d.decodeDecision(ctxCodedBlockPattern + 8 + condA + 2*condB)
+	if err != nil {
+		return 0, err
+	}
+
+	return luma | int(1+b)<<4, nil
+}
+
+func (sd *sliceDecoder) readMbQPDelta() (int, error) {
+	if sd.cabac == nil {
+		v, err := sd.r.readSERange(-26, 25, "mb_qp_delta")
+		return int(v), err
+	}
+
+	v, err := sd.cabac.decodeMbQPDelta(sd.prevQPDeltaNonZero)
+	if err != nil {
+		return 0, err
+	}
+	if v < -26 || v > 25 {
+		return 0, fmt.Errorf("invalid mb_qp_delta")
+	}
+	return v, nil
+}
+
+// readResidual reads residual() of a 4:2:0 or monochrome macroblock.
+// Specification: ITU-T Rec. H.264, section 7.3.5.3
+func (sd *sliceDecoder) readResidual() error {
+	mb := sd.cur
+
+	if mb.typ == mbTypeI16x16 {
+		n, err := sd.readBlock(sd.lumaDC[:], 0, 15, 16, catLumaDC, 0, 0)
+		if err != nil {
+			return err
+		}
+		if n != 0 {
+			mb.dcFlags |= 0x01
+		}
+	}
+
+	for b8 := 0; b8 < 4; b8++ {
+		if (mb.cbpLuma>>b8)&1 == 0 {
+			continue
+		}
+
+		switch {
+		case mb.typ == mbTypeI16x16:
+			for blkIdx := b8 * 4; blkIdx < b8*4+4; blkIdx++ {
+				rp := blkIdxToRaster[blkIdx]
+				n, err := sd.readBlock(sd.luma[blkIdx][:], 1, 15, 15, catLumaAC, 0, rp)
+				if err != nil {
+					return err
+				}
+				mb.nonZero[0][rp] = uint8(n)
+			}
+
+		case !mb.transform8x8:
+			for blkIdx := b8 * 4; blkIdx < b8*4+4; blkIdx++ {
+				rp := blkIdxToRaster[blkIdx]
+				n, err := sd.readBlock(sd.luma[blkIdx][:], 0, 15, 16, catLuma4x4, 0, rp)
+				if err != nil {
+					return err
+				}
+				mb.nonZero[0][rp] = uint8(n)
+			}
+
+		case sd.cabac != nil:
+			_, err := sd.cabac.readResidualBlockCABAC(sd.luma8x8[b8][:], 0, 63, catLuma8x8)
+			if err != nil {
+				return err
+			}
+
+			// coded_block_flag of 8x8 blocks is inferred to be 1
+			for blkIdx := b8 * 4; blkIdx < b8*4+4; blkIdx++ {
+				mb.nonZero[0][blkIdxToRaster[blkIdx]] = 1
+			}
+
+		default:
+			// with CAVLC, 8x8 blocks are transmitted as four interleaved 4x4 blocks
+			var tmp [16]int32
+			for i4x4 := 0; i4x4 < 4; i4x4++ {
+				rp := blkIdxToRaster[b8*4+i4x4]
+				n, err := sd.readBlock(tmp[:], 0, 15, 16, catLuma4x4, 0, rp)
+				if err != nil {
+					return err
+				}
+				mb.nonZero[0][rp] = uint8(n)
+
+				for k := 0; k < 16; k++ {
+					sd.luma8x8[b8][4*k+i4x4] = tmp[k]
+				}
+			}
+		}
+	}
+
+	if !sd.pic.chroma {
+		return nil
+	}
+
+	if mb.cbpChroma&0x03 != 0 {
+		for c := 0; c < 2; c++ {
+			n, err := sd.readBlock(sd.chromaDC[c][:], 0, 3, 4, catChromaDC, c+1, 0)
+			if err != nil {
+				return err
+			}
+			if n != 0 {
+				mb.dcFlags |= 1 << (c + 1)
+			}
+		}
+	}
+
+	if mb.cbpChroma&0x02 != 0 {
+		for c := 0; c < 2; c++ {
+			for blk := 0; blk < 4; blk++ {
+				n, err := sd.readBlock(sd.chromaAC[c][blk][:], 1, 15, 15, catChromaAC, c+1, blk)
+				if err != nil {
+					return err
+				}
+				mb.nonZero[c+1][blk] = uint8(n)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readBlock reads a residual block with CAVLC or CABAC.
+// rp is the raster position of the block, in units of 4x4 blocks.
+// It returns TotalCoeff (CAVLC) or coded_block_flag (CABAC).
+func (sd *sliceDecoder) readBlock(
+	coeffLevel []int32,
+	startIdx int,
+	endIdx int,
+	maxNumCoeff int,
+	cat int,
+	plane int,
+	rp int,
+) (int, error) {
+	if sd.cabac == nil {
+		nC := -1
+		if cat != catChromaDC {
+			nC = sd.predictTotalCoeff(plane, rp)
+		}
+		return readResidualBlockCAVLC(sd.r, coeffLevel, startIdx, endIdx, maxNumCoeff, nC)
+	}
+
+	cbf, err := sd.cabac.decodeDecision(sd.codedBlockFlagCtx(cat, plane, rp))
+	if err != nil {
+		return 0, err
+	}
+
+	if cbf == 0 {
+		for i := startIdx; i <= endIdx; i++ {
+			coeffLevel[i] = 0
+		}
+		return 0, nil
+	}
+
+	_, err = sd.cabac.readResidualBlockCABAC(coeffLevel, startIdx, endIdx, cat)
+	if err != nil {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+// predictTotalCoeff computes nC.
+// Specification: ITU-T Rec. H.264, section 9.2.1
+func (sd *sliceDecoder) predictTotalCoeff(plane int, rp int) int {
+	// luma blocks are arranged in 4 columns, chroma blocks in 2
+	cols := 4
+	if plane != 0 {
+		cols = 2
+	}
+	bx, by := rp%cols, rp/cols
+
+	var nA, nB int
+	var availA, availB bool
+
+	if bx > 0 {
+		nA, availA = int(sd.cur.nonZero[plane][rp-1]), true
+	} else if sd.mbA != nil {
+		nA, availA = int(sd.mbA.nonZero[plane][rp+cols-1]), true
+	}
+
+	if by > 0 {
+		nB, availB = int(sd.cur.nonZero[plane][rp-cols]), true
+	} else if sd.mbB != nil {
+		nB, availB = int(sd.mbB.nonZero[plane][rp+cols*(cols-1)]), true
+	}
+
+	switch {
+	case availA && availB:
+		return (nA + nB + 1) >> 1
+	case availA:
+		return nA
+	case availB:
+		return nB
+	default:
+		return 0
+	}
+}
+
+// codedBlockFlagCtx returns the context of coded_block_flag.
+// Specification: ITU-T Rec. H.264, section 9.3.3.1.1.9
+func (sd *sliceDecoder) codedBlockFlagCtx(cat int, plane int, rp int) int {
+	var condA, condB int
+
+	switch cat {
+	case catLumaDC, catChromaDC:
+		bit := uint8(1) << plane
+		condA = dcCodedBlockFlag(sd.mbA, bit)
+		condB = dcCodedBlockFlag(sd.mbB, bit)
+
+	default:
+		cols := 4
+		if cat == catChromaAC {
+			cols = 2
+		}
+		bx, by := rp%cols, rp/cols
+
+		if bx > 0 {
+			condA = flagOf(sd.cur.nonZero[plane][rp-1])
+		} else {
+			condA = acCodedBlockFlag(sd.mbA, plane, rp+cols-1)
+		}
+
+		if by > 0 {
+			condB = flagOf(sd.cur.nonZero[plane][rp-cols])
+		} else {
+			condB = acCodedBlockFlag(sd.mbB, plane, rp+cols*(cols-1))
+		}
+	}
+
+	return ctxCodedBlockFlag + cbfCatOffset[cat] + condA + 2*condB
+}
+
+func flagOf(v uint8) int {
+	if v != 0 {
+		return 1
+	}
+	return 0
+}
+
+// dcCodedBlockFlag returns the coded_block_flag of a DC block of a neighbouring macroblock.
+// Unavailable neighbours of intra macroblocks count as coded.
+func dcCodedBlockFlag(mb *macroblock, bit uint8) int {
+	if mb == nil {
+		return 1
+	}
+	return flagOf(mb.dcFlags & bit)
+}
+
+func acCodedBlockFlag(mb *macroblock, plane int, rp int) int {
+	if mb == nil {
+		return 1
+	}
+	return flagOf(mb.nonZero[plane][rp])
+}
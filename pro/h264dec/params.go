@@ -0,0 +1,516 @@
+package h264dec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// default scaling lists, in zig-zag order.
+// Specification: ITU-T Rec. H.264, table 7-3 and 7-4
+var (
+	defaultScaling4x4Intra = [16]uint8{6, 13, 13, 20, 20, 20, 28, 28, 28, 28, 32, 32, 32, 37, 37, 42}
+
+	defaultScaling4x4Inter = [16]uint8{10, 14, 14, 20, 20, 20, 24, 24, 24, 24, 27, 27, 27, 30, 30, 34}
+
+	defaultScaling8x8Intra = [64]uint8{
+		6, 10, 10, 13, 11, 13, 16, 16, 16, 16, 18, 18, 18, 18, 18, 23,
+		23, 23, 23, 23, 23, 25, 25, 25, 25, 25, 25, 25, 27, 27, 27, 27,
+		27, 27, 27, 27, 29, 29, 29, 29, 29, 29, 29, 31, 31, 31, 31, 31,
+		31, 33, 33, 33, 33, 33, 36, 36, 36, 36, 38, 38, 38, 40, 40, 42,
+	}
+
+	defaultScaling8x8Inter = [64]uint8{
+		9, 13, 13, 15, 13, 15, 17, 17, 17, 17, 19, 19, 19, 19, 19, 21,
+		21, 21, 21, 21, 21, 22, 22, 22, 22, 22, 22, 22, 24, 24, 24, 24,
+		24, 24, 24, 24, 25, 25, 25, 25, 25, 25, 25, 27, 27, 27, 27, 27,
+		27, 28, 28, 28, 28, 28, 30, 30, 30, 30, 32, 32, 32, 33, 33, 35,
+	}
+)
+
+// scalingMatrix contains the 4x4 (Intra Y, Cb, Cr, Inter Y, Cb, Cr)
+// and the 8x8 (Intra Y, Inter Y) scaling lists, in zig-zag order.
+type scalingMatrix struct {
+	list4x4 [6][16]uint8
+	list8x8 [2][64]uint8
+}
+
+func flatScalingMatrix() scalingMatrix {
+	var m scalingMatrix
+	for i := range m.list4x4 {
+		for j := range m.list4x4[i] {
+			m.list4x4[i][j] = 16
+		}
+	}
+	for i := range m.list8x8 {
+		for j := range m.list8x8[i] {
+			m.list8x8[i][j] = 16
+		}
+	}
+	return m
+}
+
+// readScalingList implements scaling_list().
+// It returns false when the default list has to be used.
+func readScalingList(r *bitReader, list []uint8) (bool, error) {
+	lastScale := int32(8)
+	nextScale := int32(8)
+
+	for j := range list {
+		if nextScale != 0 {
+			delta, err := r.readSERange(-128, 127, "delta_scale")
+			if err != nil {
+				return false, err
+			}
+			nextScale = (lastScale + delta + 256) % 256
+			if j == 0 && nextScale == 0 {
+				return false, nil
+			}
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+		list[j] = uint8(lastScale)
+	}
+
+	return true, nil
+}
+
+// readScalingMatrix reads the scaling lists of a SPS or a PPS.
+// fallback contains the lists used by fall-back rule B, or is nil when fall-back rule A applies.
+func readScalingMatrix(r *bitReader, count int, fallback *scalingMatrix) (scalingMatrix, error) {
+	var m scalingMatrix
+
+	for i := 0; i < 8; i++ {
+		present := false
+		if i < count {
+			var err error
+			present, err = r.readFlag()
+			if err != nil {
+				return m, err
+			}
+		}
+
+		if i < 6 {
+			list := m.list4x4[i][:]
+
+			if present {
+				ok, err := readScalingList(r, list)
+				if err != nil {
+					return m, err
+				}
+				if !ok {
+					if i < 3 {
+						copy(list, defaultScaling4x4Intra[:])
+					} else {
+						copy(list, defaultScaling4x4Inter[:])
+					}
+				}
+				continue
+			}
+
+			switch {
+			case i != 0 && i != 3:
+				copy(list, m.list4x4[i-1][:])
+			case fallback != nil:
+				copy(list, fallback.list4x4[i][:])
+			case i == 0:
+				copy(list, defaultScaling4x4Intra[:])
+			default:
+				copy(list, defaultScaling4x4Inter[:])
+			}
+			continue
+		}
+
+		list := m.list8x8[i-6][:]
+
+		if present {
+			ok, err := readScalingList(r, list)
+			if err != nil {
+				return m, err
+			}
+			if !ok {
+				if i == 6 {
+					copy(list, defaultScaling8x8Intra[:])
+				} else {
+					copy(list, defaultScaling8x8Inter[:])
+				}
+			}
+			continue
+		}
+
+		switch {
+		case fallback != nil:
+			copy(list, fallback.list8x8[i-6][:])
+		case i == 6:
+			copy(list, defaultScaling8x8Intra[:])
+		default:
+			copy(list, defaultScaling8x8Inter[:])
+		}
+	}
+
+	return m, nil
+}
+
+// sps is a sequence parameter set.
+// Specification: ITU-T Rec. H.264, section 7.3.2.1.1
+type sps struct {
+	profileIdc              uint8
+	id                      uint32
+	chromaFormatIdc         uint32
+	scalingMatrixPresent    bool
+	scaling                 scalingMatrix
+	log2MaxFrameNum         int
+	picOrderCntType         uint32
+	log2MaxPicOrderCntLsb   int
+	deltaPicOrderAlwaysZero bool
+	widthInMbs              int
+	heightInMbs             int
+	frameMbsOnly            bool
+	mbAdaptiveFrameField    bool
+	frameCropping           bool
+	cropLeft, cropRight     int
+	cropTop, cropBottom     int
+}
+
+func parseSPS(rbsp []byte) (*sps, error) {
+	if len(rbsp) < 4 {
+		return nil, errors.New("SPS is too short")
+	}
+
+	s := &sps{
+		profileIdc:      rbsp[1],
+		chromaFormatIdc: 1,
+		scaling:         flatScalingMatrix(),
+	}
+
+	r := newBitReader(rbsp)
+	r.pos = 32
+
+	var err error
+	s.id, err = r.readUEMax(31, "seq_parameter_set_id")
+	if err != nil {
+		return nil, err
+	}
+
+	switch s.profileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		s.chromaFormatIdc, err = r.readUEMax(3, "chroma_format_idc")
+		if err != nil {
+			return nil, err
+		}
+
+		if s.chromaFormatIdc > 1 {
+			return nil, fmt.Errorf("chroma formats other than 4:2:0 and 4:0:0 are not supported")
+		}
+
+		var bitDepthLuma, bitDepthChroma uint32
+		bitDepthLuma, err = r.readUE()
+		if err != nil {
+			return nil, err
+		}
+		bitDepthChroma, err = r.readUE()
+		if err != nil {
+			return nil, err
+		}
+		if bitDepthLuma != 0 || bitDepthChroma != 0 {
+			return nil, fmt.Errorf("bit depths other than 8 are not supported")
+		}
+
+		var transformBypass bool
+		transformBypass, err = r.readFlag()
+		if err != nil {
+			return nil, err
+		}
+		if transformBypass {
+			return nil, fmt.Errorf("transform bypass is not supported")
+		}
+
+		s.scalingMatrixPresent, err = r.readFlag()
+		if err != nil {
+			return nil, err
+		}
+
+		if s.scalingMatrixPresent {
+			s.scaling, err = readScalingMatrix(r, 8, nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	v, err := r.readUEMax(12, "log2_max_frame_num_minus4")
+	if err != nil {
+		return nil, err
+	}
+	s.log2MaxFrameNum = int(v) + 4
+
+	s.picOrderCntType, err = r.readUEMax(2, "pic_order_cnt_type")
+	if err != nil {
+		return nil, err
+	}
+
+	switch s.picOrderCntType {
+	case 0:
+		v, err = r.readUEMax(12, "log2_max_pic_order_cnt_lsb_minus4")
+		if err != nil {
+			return nil, err
+		}
+		s.log2MaxPicOrderCntLsb = int(v) + 4
+
+	case 1:
+		s.deltaPicOrderAlwaysZero, err = r.readFlag()
+		if err != nil {
+			return nil, err
+		}
+
+		// offset_for_non_ref_pic, offset_for_top_to_bottom_field
+		for i := 0; i < 2; i++ {
+			_, err = r.readSE()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var numRefFramesInPicOrderCntCycle uint32
+		numRefFramesInPicOrderCntCycle, err = r.readUEMax(255, "num_ref_frames_in_pic_order_cnt_cycle")
+		if err != nil {
+			return nil, err
+		}
+
+		for i := uint32(0); i < numRefFramesInPicOrderCntCycle; i++ {
+			_, err = r.readSE()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// max_num_ref_frames
+	_, err = r.readUE()
+	if err != nil {
+		return nil, err
+	}
+
+	// gaps_in_frame_num_value_allowed_flag
+	_, err = r.readFlag()
+	if err != nil {
+		return nil, err
+	}
+
+	v, err = r.readUEMax(1023, "pic_width_in_mbs_minus1")
+	if err != nil {
+		return nil, err
+	}
+	s.widthInMbs = int(v) + 1
+
+	v, err = r.readUEMax(1023, "pic_height_in_map_units_minus1")
+	if err != nil {
+		return nil, err
+	}
+	s.heightInMbs = int(v) + 1
+
+	s.frameMbsOnly, err = r.readFlag()
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.frameMbsOnly {
+		s.heightInMbs *= 2
+
+		s.mbAdaptiveFrameField, err = r.readFlag()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// MaxFS of level 6.2
+	if s.widthInMbs*s.heightInMbs > 139264 {
+		return nil, errors.New("frame size exceeds the maximum allowed by H264 levels")
+	}
+
+	// direct_8x8_inference_flag
+	_, err = r.readFlag()
+	if err != nil {
+		return nil, err
+	}
+
+	s.frameCropping, err = r.readFlag()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.frameCropping {
+		var offsets [4]uint32
+		for i := range offsets {
+			offsets[i], err = r.readUE()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		cropUnitX, cropUnitY := 2, 2
+		if s.chromaFormatIdc == 0 {
+			cropUnitX, cropUnitY = 1, 1
+		}
+		if !s.frameMbsOnly {
+			cropUnitY *= 2
+		}
+
+		s.cropLeft = int(offsets[0]) * cropUnitX
+		s.cropRight = int(offsets[1]) * cropUnitX
+		s.cropTop = int(offsets[2]) * cropUnitY
+		s.cropBottom = int(offsets[3]) * cropUnitY
+
+		if (s.cropLeft+s.cropRight) >= s.widthInMbs*16 || (s.cropTop+s.cropBottom) >= s.heightInMbs*16 {
+			return nil, errors.New("invalid frame cropping")
+		}
+	}
+
+	// VUI parameters are not needed
+
+	return s, nil
+}
+
+// pps is a picture parameter set.
+// Specification: ITU-T Rec. H.264, section 7.3.2.2
+type pps struct {
+	id                                uint32
+	spsID                             uint32
+	entropyCodingMode                 bool
+	bottomFieldPicOrderInFramePresent bool
+	picInitQP                         int
+	chromaQPIndexOffset               [2]int
+	deblockingFilterControlPresent    bool
+	constrainedIntraPred              bool
+	redundantPicCntPresent            bool
+	transform8x8Mode                  bool
+	scaling                           scalingMatrix
+}
+
+func parsePPS(rbsp []byte, spss map[uint32]*sps) (*pps, error) {
+	p := &pps{}
+
+	r := newBitReader(rbsp)
+	r.pos = 8
+
+	var err error
+	p.id, err = r.readUEMax(255, "pic_parameter_set_id")
+	if err != nil {
+		return nil, err
+	}
+
+	p.spsID, err = r.readUEMax(31, "seq_parameter_set_id")
+	if err != nil {
+		return nil, err
+	}
+
+	s, ok := spss[p.spsID]
+	if !ok {
+		return nil, fmt.Errorf("PPS refers to a missing SPS (%d)", p.spsID)
+	}
+	p.scaling = s.scaling
+
+	p.entropyCodingMode, err = r.readFlag()
+	if err != nil {
+		return nil, err
+	}
+
+	p.bottomFieldPicOrderInFramePresent, err = r.readFlag()
+	if err != nil {
+		return nil, err
+	}
+
+	numSliceGroups, err := r.readUE()
+	if err != nil {
+		return nil, err
+	}
+	if numSliceGroups != 0 {
+		return nil, fmt.Errorf("slice groups are not supported")
+	}
+
+	// num_ref_idx_l0_default_active_minus1, num_ref_idx_l1_default_active_minus1
+	for i := 0; i < 2; i++ {
+		_, err = r.readUE()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// weighted_pred_flag, weighted_bipred_idc
+	_, err = r.readBits(3)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := r.readSERange(-26, 25, "pic_init_qp_minus26")
+	if err != nil {
+		return nil, err
+	}
+	p.picInitQP = 26 + int(v)
+
+	// pic_init_qs_minus26
+	_, err = r.readSE()
+	if err != nil {
+		return nil, err
+	}
+
+	v, err = r.readSERange(-12, 12, "chroma_qp_index_offset")
+	if err != nil {
+		return nil, err
+	}
+	p.chromaQPIndexOffset[0] = int(v)
+	p.chromaQPIndexOffset[1] = int(v)
+
+	p.deblockingFilterControlPresent, err = r.readFlag()
+	if err != nil {
+		return nil, err
+	}
+
+	p.constrainedIntraPred, err = r.readFlag()
+	if err != nil {
+		return nil, err
+	}
+
+	p.redundantPicCntPresent, err = r.readFlag()
+	if err != nil {
+		return nil, err
+	}
+
+	if r.moreRBSPData() {
+		p.transform8x8Mode, err = r.readFlag()
+		if err != nil {
+			return nil, err
+		}
+
+		var scalingMatrixPresent bool
+		scalingMatrixPresent, err = r.readFlag()
+		if err != nil {
+			return nil, err
+		}
+
+		if scalingMatrixPresent {
+			count := 6
+			if p.transform8x8Mode {
+				count += 2
+			}
+
+			var fallback *scalingMatrix
+			if s.scalingMatrixPresent {
+				fallback = &s.scaling
+			}
+
+			p.scaling, err = readScalingMatrix(r, count, fallback)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		v, err = r.readSERange(-12, 12, "second_chroma_qp_index_offset")
+		if err != nil {
+			return nil, err
+		}
+		p.chromaQPIndexOffset[1] = int(v)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,165 @@
+package h264dec
+
+import (
+	"fmt"
+	"image"
+)
+
+type mbType uint8
+
+const (
+	mbTypeINxN mbType = iota + 1
+	mbTypeI16x16
+	mbTypeIPCM
+)
+
+// macroblock contains the decoded state of a macroblock that is used
+// by the following macroblocks and by the deblocking filter.
+type macroblock struct {
+	sliceNum       int // 1-based index of the slice, 0 when not decoded yet
+	typ            mbType
+	transform8x8   bool
+	cbpLuma        int
+	cbpChroma      int
+	qp             int
+	qpDeltaNonZero bool
+	chromaPredMode int
+
+	// Intra4x4PredMode or Intra8x8PredMode, indexed by raster position of 4x4 blocks
+	predModes [16]int8
+
+	// TotalCoeff (CAVLC) or coded_block_flag (CABAC) of the 4x4 blocks,
+	// indexed by [plane][raster position]
+	nonZero [3][16]uint8
+
+	// coded_block_flag of the DC blocks (CABAC): bit 0 luma, bit 1 Cb, bit 2 Cr
+	dcFlags uint8
+}
+
+// picture is a frame being decoded.
+type picture struct {
+	sps        *sps
+	widthMbs   int
+	heightMbs  int
+	chroma     bool
+	y          []uint8
+	cb         []uint8
+	cr         []uint8
+	yStride    int
+	cStride    int
+	mbs        []macroblock
+	slices     []*sliceHeader
+	decodedMbs int
+}
+
+func newPicture(s *sps) *picture {
+	p := &picture{
+		sps:       s,
+		widthMbs:  s.widthInMbs,
+		heightMbs: s.heightInMbs,
+		chroma:    s.chromaFormatIdc != 0,
+		yStride:   s.widthInMbs * 16,
+		cStride:   s.widthInMbs * 8,
+		mbs:       make([]macroblock, s.widthInMbs*s.heightInMbs),
+	}
+
+	p.y = make([]uint8, p.yStride*p.heightMbs*16)
+	if p.chroma {
+		p.cb = make([]uint8, p.cStride*p.heightMbs*8)
+		p.cr = make([]uint8, p.cStride*p.heightMbs*8)
+	}
+
+	return p
+}
+
+// decodeSlice decodes slice_data() of an I slice.
+// Specification: ITU-T Rec. H.264, section 7.3.4
+func (p *picture) decodeSlice(r *bitReader, sh *sliceHeader) error {
+	p.slices = append(p.slices, sh)
+
+	sd := &sliceDecoder{
+		pic:      p,
+		sh:       sh,
+		sliceNum: len(p.slices),
+		r:        r,
+		qp:       sh.qp,
+	}
+	sd.initLevelScale()
+
+	if sh.pps.entropyCodingMode {
+		// cabac_alignment_one_bit
+		for !r.byteAligned() {
+			b, err := r.readBit()
+			if err != nil {
+				return err
+			}
+			if b != 1 {
+				return fmt.Errorf("invalid cabac_alignment_one_bit")
+			}
+		}
+
+		sd.cabac = &cabacDecoder{r: r}
+		sd.cabac.initContexts(sh.qp)
+
+		err := sd.cabac.initEngine()
+		if err != nil {
+			return err
+		}
+	}
+
+	for addr := sh.firstMb; ; addr++ {
+		if addr >= len(p.mbs) {
+			return fmt.Errorf("slice exceeds the frame")
+		}
+		if p.mbs[addr].sliceNum != 0 {
+			return fmt.Errorf("slices overlap")
+		}
+
+		err := sd.decodeMacroblock(addr)
+		if err != nil {
+			return fmt.Errorf("failed to decode macroblock %d: %w", addr, err)
+		}
+		p.decodedMbs++
+
+		if sd.cabac != nil {
+			var endOfSlice uint32
+			endOfSlice, err = sd.cabac.decodeTerminate()
+			if err != nil {
+				return err
+			}
+			if endOfSlice == 1 {
+				return nil
+			}
+		} else if !r.moreRBSPData() {
+			return nil
+		}
+	}
+}
+
+// image returns the cropped frame.
+func (p *picture) image() image.Image {
+	s := p.sps
+	width := p.widthMbs*16 - s.cropLeft - s.cropRight
+	height := p.heightMbs*16 - s.cropTop - s.cropBottom
+	rect := image.Rect(0, 0, width, height)
+
+	if !p.chroma {
+		return &image.Gray{
+			Pix:    p.y[s.cropTop*p.yStride+s.cropLeft:],
+			Stride: p.yStride,
+			Rect:   rect,
+		}
+	}
+
+	cOffset := (s.cropTop/2)*p.cStride + s.cropLeft/2
+
+	return &image.YCbCr{
+		Y:              p.y[s.cropTop*p.yStride+s.cropLeft:],
+		Cb:             p.cb[cOffset:],
+		Cr:             p.cr[cOffset:],
+		YStride:        p.yStride,
+		CStride:        p.cStride,
+		SubsampleRatio: image.YCbCrSubsampleRatio420,
+		Rect:           rect,
+	}
+}
@@ -0,0 +1,611 @@
+package h264dec
+
+import (
+	"errors"
+)
+
+var errPredUnavailable = errors.New("intra prediction refers to unavailable samples")
+
+// reconstruct computes the samples of the current macroblock
+// by adding the residual to the intra prediction.
+// Specification: ITU-T Rec. H.264, section 8.3 and 8.5
+func (sd *sliceDecoder) reconstruct() error {
+	mb := sd.cur
+	p := sd.pic
+	qp := mb.qp
+	stride := p.yStride
+	mbOff := sd.mbY*16*stride + sd.mbX*16
+
+	switch {
+	case mb.typ == mbTypeI16x16:
+		err := sd.predict16x16()
+		if err != nil {
+			return err
+		}
+
+		ls := &sd.levelScale4x4[0][qp%6]
+
+		var dcY [16]int32
+		lumaDCTransform(&dcY, &sd.lumaDC, ls[0], qp)
+
+		for blkIdx := 0; blkIdx < 16; blkIdx++ {
+			rp := blkIdxToRaster[blkIdx]
+
+			var coeffs [16]int32
+			if mb.cbpLuma != 0 {
+				coeffs = sd.luma[blkIdx]
+			}
+			coeffs[0] = dcY[rp]
+
+			if isZero(coeffs[:]) {
+				continue
+			}
+
+			var d [16]int32
+			scale4x4(&d, &coeffs, ls, qp, true)
+			idct4x4Add(p.y, mbOff+(rp/4)*4*stride+(rp%4)*4, stride, &d)
+		}
+
+	case mb.transform8x8:
+		ls := &sd.levelScale8x8[qp%6]
+
+		for b8 := 0; b8 < 4; b8++ {
+			err := sd.predict8x8(b8)
+			if err != nil {
+				return err
+			}
+
+			if (mb.cbpLuma>>b8)&1 == 0 || isZero(sd.luma8x8[b8][:]) {
+				continue
+			}
+
+			var d [64]int32
+			scale8x8(&d, &sd.luma8x8[b8], ls, qp)
+			idct8x8Add(p.y, mbOff+(b8/2)*8*stride+(b8%2)*8, stride, &d)
+		}
+
+	default:
+		ls := &sd.levelScale4x4[0][qp%6]
+
+		for blkIdx := 0; blkIdx < 16; blkIdx++ {
+			err := sd.predict4x4(blkIdx)
+			if err != nil {
+				return err
+			}
+
+			if (mb.cbpLuma>>(blkIdx/4))&1 == 0 || isZero(sd.luma[blkIdx][:]) {
+				continue
+			}
+
+			rp := blkIdxToRaster[blkIdx]
+
+			var d [16]int32
+			scale4x4(&d, &sd.luma[blkIdx], ls, qp, false)
+			idct4x4Add(p.y, mbOff+(rp/4)*4*stride+(rp%4)*4, stride, &d)
+		}
+	}
+
+	if !p.chroma {
+		return nil
+	}
+
+	cOff := sd.mbY*8*p.cStride + sd.mbX*8
+
+	for c, plane := range [][]uint8{p.cb, p.cr} {
+		err := sd.predictChroma(plane)
+		if err != nil {
+			return err
+		}
+
+		if mb.cbpChroma == 0 {
+			continue
+		}
+
+		qpc := chromaQP(qp, sd.sh.pps.chromaQPIndexOffset[c])
+		ls := &sd.levelScale4x4[1+c][qpc%6]
+
+		var dcC [4]int32
+		chromaDCTransform(&dcC, &sd.chromaDC[c], ls[0], qpc)
+
+		for blk := 0; blk < 4; blk++ {
+			var coeffs [16]int32
+			if mb.cbpChroma == 2 {
+				coeffs = sd.chromaAC[c][blk]
+			}
+			coeffs[0] = dcC[blk]
+
+			if isZero(coeffs[:]) {
+				continue
+			}
+
+			var d [16]int32
+			scale4x4(&d, &coeffs, ls, qpc, true)
+			idct4x4Add(plane, cOff+(blk/2)*4*p.cStride+(blk%2)*4, p.cStride, &d)
+		}
+	}
+
+	return nil
+}
+
+func isZero(coeffs []int32) bool {
+	for _, c := range coeffs {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// edges contains the neighbouring samples of a block:
+// p[-1,-1] is at index 16, p[x,-1] at index 17+x and p[-1,y] at index 15-y.
+type edges [49]int32
+
+func (e *edges) top(x int) int32 {
+	return e[17+x]
+}
+
+func (e *edges) left(y int) int32 {
+	return e[15-y]
+}
+
+func (e *edges) corner() int32 {
+	return e[16]
+}
+
+type edgeAvailability struct {
+	top      bool
+	topRight bool
+	left     bool
+	corner   bool
+}
+
+// loadEdges loads the neighbouring samples of a n x n block,
+// substituting the top-right ones when they are not available.
+func loadEdges(plane []uint8, off int, stride int, n int, avail edgeAvailability) *edges {
+	var e edges
+
+	if avail.top {
+		for x := 0; x < n; x++ {
+			e[17+x] = int32(plane[off-stride+x])
+		}
+
+		for x := n; x < 2*n; x++ {
+			if avail.topRight {
+				e[17+x] = int32(plane[off-stride+x])
+			} else {
+				e[17+x] = e[17+n-1]
+			}
+		}
+	}
+
+	if avail.left {
+		for y := 0; y < n; y++ {
+			e[15-y] = int32(plane[off+y*stride-1])
+		}
+	}
+
+	if avail.corner {
+		e[16] = int32(plane[off-stride-1])
+	}
+
+	return &e
+}
+
+// blockAvailability returns the availability of the neighbouring samples
+// of a luma block, given its position inside the macroblock in units of blocks
+// and the number of blocks per row.
+// topRightDecoded tells whether the top-right block, when inside the macroblock,
+// precedes the current block in decoding order.
+func (sd *sliceDecoder) blockAvailability(bx int, by int, cols int, topRightDecoded bool) edgeAvailability {
+	var a edgeAvailability
+
+	a.left = bx > 0 || sd.mbA != nil
+	a.top = by > 0 || sd.mbB != nil
+
+	switch {
+	case bx > 0 && by > 0:
+		a.corner = true
+	case by > 0:
+		a.corner = sd.mbA != nil
+	case bx > 0:
+		a.corner = sd.mbB != nil
+	default:
+		a.corner = sd.mbD != nil
+	}
+
+	switch {
+	case by == 0 && bx < cols-1:
+		a.topRight = sd.mbB != nil
+	case by == 0:
+		a.topRight = sd.mbC != nil
+	default:
+		a.topRight = bx < cols-1 && topRightDecoded
+	}
+
+	return a
+}
+
+// predict4x4 performs the Intra_4x4 prediction of a block.
+// Specification: ITU-T Rec. H.264, section 8.3.1.2
+func (sd *sliceDecoder) predict4x4(blkIdx int) error {
+	p := sd.pic
+	rp := blkIdxToRaster[blkIdx]
+	bx, by := rp%4, rp/4
+	off := (sd.mbY*16+by*4)*p.yStride + sd.mbX*16 + bx*4
+
+	topRightDecoded := by > 0 && bx < 3 && rasterToBlkIdx[rp-3] < blkIdx
+
+	avail := sd.blockAvailability(bx, by, 4, topRightDecoded)
+	e := loadEdges(p.y, off, p.yStride, 4, avail)
+
+	return predictDirectional(p.y, off, p.yStride, 4, int(sd.cur.predModes[rp]), e, avail)
+}
+
+// predict8x8 performs the Intra_8x8 prediction of a block.
+// Specification: ITU-T Rec. H.264, section 8.3.2.2
+func (sd *sliceDecoder) predict8x8(b8 int) error {
+	p := sd.pic
+	bx, by := b8%2, b8/2
+	off := (sd.mbY*16+by*8)*p.yStride + sd.mbX*16 + bx*8
+
+	// the top-right block of block 2 is block 1
+	avail := sd.blockAvailability(bx, by, 2, b8 == 2)
+	e := loadEdges(p.y, off, p.yStride, 8, avail)
+	e = filterEdges8x8(e, avail)
+
+	return predictDirectional(p.y, off, p.yStride, 8, int(sd.cur.predModes[by*8+bx*2]), e, avail)
+}
+
+// filterEdges8x8 applies the reference sample filtering of Intra_8x8 prediction.
+// Specification: ITU-T Rec. H.264, section 8.3.2.2.1
+func filterEdges8x8(e *edges, avail edgeAvailability) *edges {
+	var f edges
+
+	if avail.top {
+		if avail.corner {
+			f[17] = (e.corner() + 2*e.top(0) + e.top(1) + 2) >> 2
+		} else {
+			f[17] = (3*e.top(0) + e.top(1) + 2) >> 2
+		}
+
+		for x := 1; x < 15; x++ {
+			f[17+x] = (e.top(x-1) + 2*e.top(x) + e.top(x+1) + 2) >> 2
+		}
+
+		f[17+15] = (e.top(14) + 3*e.top(15) + 2) >> 2
+	}
+
+	if avail.corner {
+		switch {
+		case avail.top && avail.left:
+			f[16] = (e.top(0) + 2*e.corner() + e.left(0) + 2) >> 2
+		case avail.top:
+			f[16] = (3*e.corner() + e.top(0) + 2) >> 2
+		case avail.left:
+			f[16] = (3*e.corner() + e.left(0) + 2) >> 2
+		default:
+			f[16] = e.corner()
+		}
+	}
+
+	if avail.left {
+		if avail.corner {
+			f[15] = (e.corner() + 2*e.left(0) + e.left(1) + 2) >> 2
+		} else {
+			f[15] = (3*e.left(0) + e.left(1) + 2) >> 2
+		}
+
+		for y := 1; y < 7; y++ {
+			f[15-y] = (e.left(y-1) + 2*e.left(y) + e.left(y+1) + 2) >> 2
+		}
+
+		f[15-7] = (e.left(6) + 3*e.left(7) + 2) >> 2
+	}
+
+	return &f
+}
+
+// predictDirectional performs the Intra_4x4 and Intra_8x8 predictions,
+// whose equations are the same apart from the block size.
+func predictDirectional(dst []uint8, off int, stride int, n int, mode int, e *edges, avail edgeAvailability) error {
+	switch mode {
+	case 0, 3, 7:
+		if !avail.top {
+			return errPredUnavailable
+		}
+
+	case 1, 8:
+		if !avail.left {
+			return errPredUnavailable
+		}
+
+	case 4, 5, 6:
+		if !avail.top || !avail.left || !avail.corner {
+			return errPredUnavailable
+		}
+	}
+
+	log2n := 2
+	if n == 8 {
+		log2n = 3
+	}
+
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			var v int32
+
+			switch mode {
+			case 0: // vertical
+				v = e.top(x)
+
+			case 1: // horizontal
+				v = e.left(y)
+
+			case 2: // DC
+				v = predDC(e, n, log2n, avail.top, avail.left)
+
+			case 3: // diagonal down left
+				if x == n-1 && y == n-1 {
+					v = (e.top(2*n-2) + 3*e.top(2*n-1) + 2) >> 2
+				} else {
+					v = (e.top(x+y) + 2*e.top(x+y+1) + e.top(x+y+2) + 2) >> 2
+				}
+
+			case 4: // diagonal down right
+				switch {
+				case x > y:
+					v = (e.top(x-y-2) + 2*e.top(x-y-1) + e.top(x-y) + 2) >> 2
+				case x < y:
+					v = (e.left(y-x-2) + 2*e.left(y-x-1) + e.left(y-x) + 2) >> 2
+				default:
+					v = (e.top(0) + 2*e.corner() + e.left(0) + 2) >> 2
+				}
+
+			case 5: // vertical right
+				z := 2*x - y
+				switch {
+				case z >= 0 && z%2 == 0:
+					v = (e.top(x-(y>>1)-1) + e.top(x-(y>>1)) + 1) >> 1
+				case z >= 0:
+					v = (e.top(x-(y>>1)-2) + 2*e.top(x-(y>>1)-1) + e.top(x-(y>>1)) + 2) >> 2
+				case z == -1:
+					v = (e.left(0) + 2*e.corner() + e.top(0) + 2) >> 2
+				default:
+					v = (e.left(y-2*x-1) + 2*e.left(y-2*x-2) + e.left(y-2*x-3) + 2) >> 2
+				}
+
+			case 6: // horizontal down
+				z := 2*y - x
+				switch {
+				case z >= 0 && z%2 == 0:
+					v = (e.left(y-(x>>1)-1) + e.left(y-(x>>1)) + 1) >> 1
+				case z >= 0:
+					v = (e.left(y-(x>>1)-2) + 2*e.left(y-(x>>1)-1) + e.left(y-(x>>1)) + 2) >> 2
+				case z == -1:
+					v = (e.left(0) + 2*e.corner() + e.top(0) + 2) >> 2
+				default:
+					v = (e.top(x-2*y-1) + 2*e.top(x-2*y-2) + e.top(x-2*y-3) + 2) >> 2
+				}
+
+			case 7: // vertical left
+				if y%2 == 0 {
+					v = (e.top(x+(y>>1)) + e.top(x+(y>>1)+1) + 1) >> 1
+				} else {
+					v = (e.top(x+(y>>1)) + 2*e.top(x+(y>>1)+1) + e.top(x+(y>>1)+2) + 2) >> 2
+				}
+
+			case 8: // horizontal up
+				z := x + 2*y
+				limit := 2*n - 3
+				switch {
+				case z < limit && z%2 == 0:
+					v = (e.left(y+(x>>1)) + e.left(y+(x>>1)+1) + 1) >> 1
+				case z < limit:
+					v = (e.left(y+(x>>1)) + 2*e.left(y+(x>>1)+1) + e.left(y+(x>>1)+2) + 2) >> 2
+				case z == limit:
+					v = (e.left(n-2) + 3*e.left(n-1) + 2) >> 2
+				default:
+					v = e.left(n - 1)
+				}
+
+			default:
+				return errors.New("invalid intra prediction mode")
+			}
+
+			dst[off+y*stride+x] = uint8(v)
+		}
+	}
+
+	return nil
+}
+
+// predDC computes the DC prediction of a n x n block.
+func predDC(e *edges, n int, log2n int, hasTop bool, hasLeft bool) int32 {
+	var sumTop, sumLeft int32
+	for i := 0; i < n; i++ {
+		sumTop += e.top(i)
+		sumLeft += e.left(i)
+	}
+
+	switch {
+	case hasTop && hasLeft:
+		return (sumTop + sumLeft + int32(n)) >> (log2n + 1)
+	case hasLeft:
+		return (sumLeft + int32(n>>1)) >> log2n
+	case hasTop:
+		return (sumTop + int32(n>>1)) >> log2n
+	default:
+		return 128
+	}
+}
+
+// predict16x16 performs the Intra_16x16 prediction of the current macroblock.
+// Specification: ITU-T Rec. H.264, section 8.3.3
+func (sd *sliceDecoder) predict16x16() error {
+	p := sd.pic
+	off := sd.mbY*16*p.yStride + sd.mbX*16
+
+	avail := edgeAvailability{
+		top:    sd.mbB != nil,
+		left:   sd.mbA != nil,
+		corner: sd.mbD != nil,
+	}
+	e := loadEdges(p.y, off, p.yStride, 16, avail)
+
+	return predictPlanar(p.y, off, p.yStride, 16, sd.pred, e, avail)
+}
+
+// predictChroma performs the intra prediction of a chroma component of the current macroblock.
+// Specification: ITU-T Rec. H.264, section 8.3.4
+func (sd *sliceDecoder) predictChroma(plane []uint8) error {
+	p := sd.pic
+	off := sd.mbY*8*p.cStride + sd.mbX*8
+
+	avail := edgeAvailability{
+		top:    sd.mbB != nil,
+		left:   sd.mbA != nil,
+		corner: sd.mbD != nil,
+	}
+	e := loadEdges(plane, off, p.cStride, 8, avail)
+
+	// chroma modes are numbered differently from the Intra_16x16 ones
+	switch sd.cur.chromaPredMode {
+	case 0:
+		predictChromaDC(plane, off, p.cStride, e, avail)
+		return nil
+
+	case 1:
+		return predictPlanar(plane, off, p.cStride, 8, 1, e, avail)
+
+	case 2:
+		return predictPlanar(plane, off, p.cStride, 8, 0, e, avail)
+
+	default:
+		return predictPlanar(plane, off, p.cStride, 8, 3, e, avail)
+	}
+}
+
+// predictChromaDC performs the DC prediction of a 8x8 chroma block,
+// that is computed separately for each 4x4 block.
+func predictChromaDC(dst []uint8, off int, stride int, e *edges, avail edgeAvailability) {
+	for blk := 0; blk < 4; blk++ {
+		xO, yO := (blk%2)*4, (blk/2)*4
+
+		var sumTop, sumLeft int32
+		for i := 0; i < 4; i++ {
+			sumTop += e.top(xO + i)
+			sumLeft += e.left(yO + i)
+		}
+
+		var v int32
+
+		switch {
+		case xO == yO: // blocks on the diagonal use both neighbours
+			switch {
+			case avail.top && avail.left:
+				v = (sumTop + sumLeft + 4) >> 3
+			case avail.left:
+				v = (sumLeft + 2) >> 2
+			case avail.top:
+				v = (sumTop + 2) >> 2
+			default:
+				v = 128
+			}
+
+		case yO == 0: // top-right block prefers the top neighbours
+			switch {
+			case avail.top:
+				v = (sumTop + 2) >> 2
+			case avail.left:
+				v = (sumLeft + 2) >> 2
+			default:
+				v = 128
+			}
+
+		default: // bottom-left block prefers the left neighbours
+			switch {
+			case avail.left:
+				v = (sumLeft + 2) >> 2
+			case avail.top:
+				v = (sumTop + 2) >> 2
+			default:
+				v = 128
+			}
+		}
+
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				dst[off+(yO+y)*stride+xO+x] = uint8(v)
+			}
+		}
+	}
+}
+
+// predictPlanar performs the vertical (0), horizontal (1), DC (2) and plane (3) predictions
+// of 16x16 luma blocks and 8x8 chroma blocks.
+func predictPlanar(dst []uint8, off int, stride int, n int, mode int, e *edges, avail edgeAvailability) error {
+	switch mode {
+	case 0:
+		if !avail.top {
+			return errPredUnavailable
+		}
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				dst[off+y*stride+x] = uint8(e.top(x))
+			}
+		}
+
+	case 1:
+		if !avail.left {
+			return errPredUnavailable
+		}
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				dst[off+y*stride+x] = uint8(e.left(y))
+			}
+		}
+
+	case 2:
+		v := uint8(predDC(e, n, 4, avail.top, avail.left))
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				dst[off+y*stride+x] = v
+			}
+		}
+
+	case 3:
+		if !avail.top || !avail.left || !avail.corner {
+			return errPredUnavailable
+		}
+
+		half := n / 2
+
+		var h, v int32
+		for i := 0; i < half; i++ {
+			h += int32(i+1) * (e.top(half+i) - e.top(half-2-i))
+			v += int32(i+1) * (e.left(half+i) - e.left(half-2-i))
+		}
+
+		a := 16 * (e.left(n-1) + e.top(n-1))
+
+		var b, c int32
+		if n == 16 {
+			b = (5*h + 32) >> 6
+			c = (5*v + 32) >> 6
+		} else {
+			b = (34*h + 32) >> 6
+			c = (34*v + 32) >> 6
+		}
+
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				dst[off+y*stride+x] = clip1((a + b*int32(x-half+1) + c*int32(y-half+1) + 16) >> 5)
+			}
+		}
+
+	default:
+		return errors.New("invalid intra prediction mode")
+	}
+
+	return nil
+}
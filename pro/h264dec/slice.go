@@ -0,0 +1,236 @@
+package h264dec
+
+import (
+	"fmt"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+)
+
+// sliceTypeI is the type of I slices, modulo 5.
+// Specification: ITU-T Rec. H.264, table 7-6
+const sliceTypeI = 2
+
+// sliceHeader is the header of a slice.
+// Specification: ITU-T Rec. H.264, section 7.3.3
+type sliceHeader struct {
+	sps                        *sps
+	pps                        *pps
+	firstMb                    int
+	sliceType                  uint32
+	frameNum                   uint32
+	idrPicID                   uint32
+	redundantPicCnt            uint32
+	qp                         int
+	disableDeblockingFilterIdc uint32
+	filterOffsetA              int
+	filterOffsetB              int
+}
+
+// parseSliceHeader parses the header of a slice, stopping before the
+// header fields that are not present in I slices.
+// It returns a sliceHeader with only the slice type set when the slice is not an intra slice.
+func parseSliceHeader(
+	r *bitReader,
+	typ h264.NALUType,
+	nalRefIdc uint8,
+	spss map[uint32]*sps,
+	getPPS func(uint32) (*pps, error),
+) (*sliceHeader, error) {
+	h := &sliceHeader{}
+
+	v, err := r.readUE()
+	if err != nil {
+		return nil, err
+	}
+	h.firstMb = int(v)
+
+	h.sliceType, err = r.readUEMax(9, "slice_type")
+	if err != nil {
+		return nil, err
+	}
+
+	if h.sliceType%5 != sliceTypeI {
+		return h, nil
+	}
+
+	ppsID, err := r.readUEMax(255, "pic_parameter_set_id")
+	if err != nil {
+		return nil, err
+	}
+
+	h.pps, err = getPPS(ppsID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ok bool
+	h.sps, ok = spss[h.pps.spsID]
+	if !ok {
+		return nil, fmt.Errorf("slice refers to a missing SPS (%d)", h.pps.spsID)
+	}
+
+	if h.firstMb >= h.sps.widthInMbs*h.sps.heightInMbs {
+		return nil, fmt.Errorf("invalid first_mb_in_slice")
+	}
+
+	h.frameNum, err = r.readBits(h.sps.log2MaxFrameNum)
+	if err != nil {
+		return nil, err
+	}
+
+	if !h.sps.frameMbsOnly {
+		var fieldPic bool
+		fieldPic, err = r.readFlag()
+		if err != nil {
+			return nil, err
+		}
+		if fieldPic {
+			return nil, fmt.Errorf("field pictures are not supported")
+		}
+		if h.sps.mbAdaptiveFrameField {
+			return nil, fmt.Errorf("MBAFF frames are not supported")
+		}
+	}
+
+	if typ == h264.NALUTypeIDR {
+		h.idrPicID, err = r.readUEMax(65535, "idr_pic_id")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch h.sps.picOrderCntType {
+	case 0:
+		// pic_order_cnt_lsb
+		_, err = r.readBits(h.sps.log2MaxPicOrderCntLsb)
+		if err != nil {
+			return nil, err
+		}
+
+		if h.pps.bottomFieldPicOrderInFramePresent {
+			// delta_pic_order_cnt_bottom
+			_, err = r.readSE()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	case 1:
+		if !h.sps.deltaPicOrderAlwaysZero {
+			// delta_pic_order_cnt[0]
+			_, err = r.readSE()
+			if err != nil {
+				return nil, err
+			}
+
+			if h.pps.bottomFieldPicOrderInFramePresent {
+				// delta_pic_order_cnt[1]
+				_, err = r.readSE()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if h.pps.redundantPicCntPresent {
+		h.redundantPicCnt, err = r.readUEMax(127, "redundant_pic_cnt")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// I slices don't contain ref_pic_list_modification() and pred_weight_table()
+
+	if nalRefIdc != 0 {
+		err = skipDecRefPicMarking(r, typ == h264.NALUTypeIDR)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	qpDelta, err := r.readSE()
+	if err != nil {
+		return nil, err
+	}
+	h.qp = h.pps.picInitQP + int(qpDelta)
+	if h.qp < 0 || h.qp > 51 {
+		return nil, fmt.Errorf("invalid slice_qp_delta")
+	}
+
+	if h.pps.deblockingFilterControlPresent {
+		h.disableDeblockingFilterIdc, err = r.readUEMax(2, "disable_deblocking_filter_idc")
+		if err != nil {
+			return nil, err
+		}
+
+		if h.disableDeblockingFilterIdc != 1 {
+			var alpha, beta int32
+			alpha, err = r.readSERange(-6, 6, "slice_alpha_c0_offset_div2")
+			if err != nil {
+				return nil, err
+			}
+			beta, err = r.readSERange(-6, 6, "slice_beta_offset_div2")
+			if err != nil {
+				return nil, err
+			}
+			h.filterOffsetA = int(alpha) << 1
+			h.filterOffsetB = int(beta) << 1
+		}
+	}
+
+	return h, nil
+}
+
+// skipDecRefPicMarking skips dec_ref_pic_marking().
+// Specification: ITU-T Rec. H.264, section 7.3.3.3
+func skipDecRefPicMarking(r *bitReader, idr bool) error {
+	if idr {
+		// no_output_of_prior_pics_flag, long_term_reference_flag
+		_, err := r.readBits(2)
+		return err
+	}
+
+	adaptive, err := r.readFlag()
+	if err != nil {
+		return err
+	}
+	if !adaptive {
+		return nil
+	}
+
+	for i := 0; ; i++ {
+		if i > 66 {
+			return fmt.Errorf("too many memory_management_control_operation")
+		}
+
+		op, err := r.readUE()
+		if err != nil {
+			return err
+		}
+
+		switch op {
+		case 0:
+			return nil
+
+		case 1, 2, 4, 6:
+			_, err = r.readUE()
+			if err != nil {
+				return err
+			}
+
+		case 3:
+			for j := 0; j < 2; j++ {
+				_, err = r.readUE()
+				if err != nil {
+					return err
+				}
+			}
+
+		case 5:
+
+		default:
+			return fmt.Errorf("invalid memory_management_control_operation")
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package h264dec
+
+// zig-zag scans, that map scan positions to raster positions.
+// Specification: ITU-T Rec. H.264, section 8.5.6 and 8.5.7
+var (
+	zigzag4x4 = [16]int{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+
+	zigzag8x8 = [64]int{
+		0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5,
+		12, 19, 26, 33, 40, 48, 41, 34, 27, 20, 13, 6, 7, 14, 21, 28,
+		35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51,
+		58, 59, 52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+	}
+)
+
+// blkIdxToRaster maps luma4x4BlkIdx to the raster position of the block
+// inside the macroblock, in units of 4x4 blocks.
+var blkIdxToRaster = [16]int{0, 1, 4, 5, 2, 3, 6, 7, 8, 9, 12, 13, 10, 11, 14, 15}
+
+// rasterToBlkIdx is the inverse of blkIdxToRaster.
+var rasterToBlkIdx = [16]int{0, 1, 4, 5, 2, 3, 6, 7, 8, 9, 12, 13, 10, 11, 14, 15}
+
+// coded_block_pattern of Intra_4x4 and Intra_8x8 macroblocks, indexed by codeNum.
+// Specification: ITU-T Rec. H.264, table 9-4
+var (
+	golombToIntraCBP = [48]uint8{
+		47, 31, 15, 0, 23, 27, 29, 30, 7, 11, 13, 14, 39, 43, 45, 46,
+		16, 3, 5, 10, 12, 19, 21, 26, 28, 35, 37, 42, 44, 1, 2, 4,
+		8, 17, 18, 20, 24, 6, 9, 22, 25, 32, 33, 34, 36, 40, 38, 41,
+	}
+
+	golombToIntraCBPGray = [16]uint8{15, 0, 7, 11, 13, 14, 3, 5, 10, 12, 1, 2, 4, 8, 6, 9}
+)
+
+// normAdjust4x4 and normAdjust8x8 are the values of v.
+// Columns of normAdjust4x4 are for positions with zero, one and two odd coordinates.
+// Specification: ITU-T Rec. H.264, section 8.5.9
+var (
+	normAdjust4x4 = [6][3]int32{
+		{10, 13, 16},
+		{11, 14, 18},
+		{13, 16, 20},
+		{14, 18, 23},
+		{16, 20, 25},
+		{18, 23, 29},
+	}
+
+	normAdjust8x8 = [6][6]int32{
+		{20, 18, 32, 19, 25, 24},
+		{22, 19, 35, 21, 28, 26},
+		{26, 23, 42, 24, 33, 31},
+		{28, 25, 45, 26, 35, 33},
+		{32, 28, 51, 30, 40, 38},
+		{36, 32, 58, 34, 46, 43},
+	}
+)
+
+// chromaQPTable maps qPI to QPC.
+// Specification: ITU-T Rec. H.264, table 8-15
+var chromaQPTable = [52]int{
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+	16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 29, 30,
+	31, 32, 32, 33, 34, 34, 35, 35, 36, 36, 37, 37, 37, 38, 38, 38,
+	39, 39, 39, 39,
+}
+
+func chromaQP(qpY int, offset int) int {
+	return chromaQPTable[clip3(0, 51, qpY+offset)]
+}
+
+// levelScale4x4 returns LevelScale4x4(m, i, j) for all the raster positions of a block.
+func levelScale4x4(weights *[16]uint8, m int) [16]int32 {
+	var ls [16]int32
+	for k := 0; k < 16; k++ {
+		i, j := k/4, k%4
+
+		// normAdjust4x4 is indexed by the number of odd coordinates
+		ls[k] = normAdjust4x4[m][i%2+j%2]
+	}
+
+	// weights are in zig-zag order
+	for s, k := range zigzag4x4 {
+		ls[k] *= int32(weights[s])
+	}
+
+	return ls
+}
+
+// levelScale8x8 returns LevelScale8x8(m, i, j) for all the raster positions of a block.
+func levelScale8x8(weights *[64]uint8, m int) [64]int32 {
+	var ls [64]int32
+	for k := 0; k < 64; k++ {
+		i, j := k/8, k%8
+
+		var v int32
+		switch {
+		case i%4 == 0 && j%4 == 0:
+			v = normAdjust8x8[m][0]
+		case i%2 == 1 && j%2 == 1:
+			v = normAdjust8x8[m][1]
+		case i%4 == 2 && j%4 == 2:
+			v = normAdjust8x8[m][2]
+		case (i%4 == 0 && j%2 == 1) || (i%2 == 1 && j%4 == 0):
+			v = normAdjust8x8[m][3]
+		case (i%4 == 0 && j%4 == 2) || (i%4 == 2 && j%4 == 0):
+			v = normAdjust8x8[m][4]
+		default:
+			v = normAdjust8x8[m][5]
+		}
+
+		ls[k] = v
+	}
+
+	for s, k := range zigzag8x8 {
+		ls[k] *= int32(weights[s])
+	}
+
+	return ls
+}
+
+// deblocking filter thresholds, indexed by indexA and indexB.
+// Specification: ITU-T Rec. H.264, table 8-16 and 8-17
+var (
+	alphaTable = [52]int{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		4, 4, 5, 6, 7, 8, 9, 10, 12, 13, 15, 17, 20, 22, 25, 28,
+		32, 36, 40, 45, 50, 56, 63, 71, 80, 90, 101, 113, 127, 144, 162, 182,
+		203, 226, 255, 255,
+	}
+
+	betaTable = [52]int{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 6, 6, 7, 7, 8, 8,
+		9, 9, 10, 10, 11, 11, 12, 12, 13, 13, 14, 14, 15, 15, 16, 16,
+		17, 17, 18, 18,
+	}
+
+	// tC0Table is indexed by [indexA][bS-1].
+	tC0Table = [52][3]int{
+		{0, 0, 0}, {0, 0, 0}, {0, 0, 0}, {0, 0, 0}, {0, 0, 0}, {0, 0, 0}, {0, 0, 0}, {0, 0, 0},
+		{0, 0, 0}, {0, 0, 0}, {0, 0, 0}, {0, 0, 0}, {0, 0, 0}, {0, 0, 0}, {0, 0, 0}, {0, 0, 0},
+		{0, 0, 0}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 1, 1}, {0, 1, 1}, {1, 1, 1},
+		{1, 1, 1}, {1, 1, 1}, {1, 1, 1}, {1, 1, 2}, {1, 1, 2}, {1, 1, 2}, {1, 1, 2}, {1, 2, 3},
+		{1, 2, 3}, {2, 2, 3}, {2, 2, 4}, {2, 3, 4}, {2, 3, 4}, {3, 3, 5}, {3, 4, 6}, {3, 4, 6},
+		{4, 5, 7}, {4, 5, 8}, {4, 6, 9}, {5, 7, 10}, {6, 8, 11}, {6, 8, 13}, {7, 10, 14}, {8, 11, 16},
+		{9, 12, 18}, {10, 13, 20}, {11, 15, 23}, {13, 17, 25},
+	}
+)
+
+func clip3(lo int, hi int, v int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func clip1(v int32) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
@@ -0,0 +1,194 @@
+package h264dec
+
+// scale4x4 dequantizes the coefficients of a 4x4 block, that are in scan order,
+// and writes them in raster order into d.
+// When hasDC is true, the first coefficient is an already-scaled DC value.
+// Specification: ITU-T Rec. H.264, section 8.5.12.1
+func scale4x4(d *[16]int32, coeffs *[16]int32, ls *[16]int32, qp int, hasDC bool) {
+	start := 0
+	if hasDC {
+		d[0] = coeffs[0]
+		start = 1
+	}
+
+	for s := start; s < 16; s++ {
+		k := zigzag4x4[s]
+		c := coeffs[s]
+
+		switch {
+		case c == 0:
+			d[k] = 0
+		case qp >= 24:
+			d[k] = (c * ls[k]) << (qp/6 - 4)
+		default:
+			d[k] = (c*ls[k] + (1 << (3 - qp/6))) >> (4 - qp/6)
+		}
+	}
+}
+
+// scale8x8 dequantizes the coefficients of a 8x8 block.
+// Specification: ITU-T Rec. H.264, section 8.5.13.1
+func scale8x8(d *[64]int32, coeffs *[64]int32, ls *[64]int32, qp int) {
+	for s := 0; s < 64; s++ {
+		k := zigzag8x8[s]
+		c := coeffs[s]
+
+		switch {
+		case c == 0:
+			d[k] = 0
+		case qp >= 36:
+			d[k] = (c * ls[k]) << (qp/6 - 6)
+		default:
+			d[k] = (c*ls[k] + (1 << (5 - qp/6))) >> (6 - qp/6)
+		}
+	}
+}
+
+// lumaDCTransform computes dcY from the Intra16x16DCLevel coefficients,
+// that are in scan order. dcY is in raster order of 4x4 blocks.
+// Specification: ITU-T Rec. H.264, section 8.5.10
+func lumaDCTransform(dcY *[16]int32, coeffs *[16]int32, ls00 int32, qp int) {
+	var c [16]int32
+	for s, k := range zigzag4x4 {
+		c[k] = coeffs[s]
+	}
+
+	var f [16]int32
+
+	// rows
+	for i := 0; i < 4; i++ {
+		c0, c1, c2, c3 := c[i*4], c[i*4+1], c[i*4+2], c[i*4+3]
+		f[i*4] = c0 + c1 + c2 + c3
+		f[i*4+1] = c0 + c1 - c2 - c3
+		f[i*4+2] = c0 - c1 - c2 + c3
+		f[i*4+3] = c0 - c1 + c2 - c3
+	}
+
+	// columns
+	for j := 0; j < 4; j++ {
+		f0, f1, f2, f3 := f[j], f[4+j], f[8+j], f[12+j]
+		f[j] = f0 + f1 + f2 + f3
+		f[4+j] = f0 + f1 - f2 - f3
+		f[8+j] = f0 - f1 - f2 + f3
+		f[12+j] = f0 - f1 + f2 - f3
+	}
+
+	for k := range f {
+		if qp >= 36 {
+			dcY[k] = (f[k] * ls00) << (qp/6 - 6)
+		} else {
+			dcY[k] = (f[k]*ls00 + (1 << (5 - qp/6))) >> (6 - qp/6)
+		}
+	}
+}
+
+// chromaDCTransform computes dcC from the chroma DC coefficients of a 4:2:0 macroblock.
+// Specification: ITU-T Rec. H.264, section 8.5.11
+func chromaDCTransform(dcC *[4]int32, c *[4]int32, ls00 int32, qp int) {
+	f := [4]int32{
+		c[0] + c[1] + c[2] + c[3],
+		c[0] - c[1] + c[2] - c[3],
+		c[0] + c[1] - c[2] - c[3],
+		c[0] - c[1] - c[2] + c[3],
+	}
+
+	for k := range f {
+		dcC[k] = ((f[k] * ls00) << (qp / 6)) >> 5
+	}
+}
+
+// idct4x4Add computes the residual of a 4x4 block and adds it to the samples.
+// Specification: ITU-T Rec. H.264, section 8.5.12.2
+func idct4x4Add(dst []uint8, off int, stride int, d *[16]int32) {
+	var h [16]int32
+
+	// rows
+	for i := 0; i < 4; i++ {
+		d0, d1, d2, d3 := d[i*4], d[i*4+1], d[i*4+2], d[i*4+3]
+		e0 := d0 + d2
+		e1 := d0 - d2
+		e2 := (d1 >> 1) - d3
+		e3 := d1 + (d3 >> 1)
+		h[i*4] = e0 + e3
+		h[i*4+1] = e1 + e2
+		h[i*4+2] = e1 - e2
+		h[i*4+3] = e0 - e3
+	}
+
+	// columns
+	for j := 0; j < 4; j++ {
+		f0, f1, f2, f3 := h[j], h[4+j], h[8+j], h[12+j]
+		g0 := f0 + f2
+		g1 := f0 - f2
+		g2 := (f1 >> 1) - f3
+		g3 := f1 + (f3 >> 1)
+
+		r := [4]int32{g0 + g3, g1 + g2, g1 - g2, g0 - g3}
+		for i, v := range r {
+			p := off + i*stride + j
+			dst[p] = clip1(int32(dst[p]) + ((v + 32) >> 6))
+		}
+	}
+}
+
+// idct8x8Add computes the residual of a 8x8 block and adds it to the samples.
+// Specification: ITU-T Rec. H.264, section 8.5.13.2
+func idct8x8Add(dst []uint8, off int, stride int, d *[64]int32) {
+	var g [64]int32
+
+	// rows
+	for i := 0; i < 8; i++ {
+		var in [8]int32
+		copy(in[:], d[i*8:i*8+8])
+		out := idct8(in)
+		copy(g[i*8:i*8+8], out[:])
+	}
+
+	// columns
+	for j := 0; j < 8; j++ {
+		var in [8]int32
+		for i := 0; i < 8; i++ {
+			in[i] = g[i*8+j]
+		}
+		out := idct8(in)
+
+		for i, v := range out {
+			p := off + i*stride + j
+			dst[p] = clip1(int32(dst[p]) + ((v + 32) >> 6))
+		}
+	}
+}
+
+// idct8 is the one-dimensional 8-point inverse transform.
+func idct8(d [8]int32) [8]int32 {
+	a0 := d[0] + d[4]
+	a4 := d[0] - d[4]
+	a2 := (d[2] >> 1) - d[6]
+	a6 := d[2] + (d[6] >> 1)
+
+	b0 := a0 + a6
+	b2 := a4 + a2
+	b4 := a4 - a2
+	b6 := a0 - a6
+
+	a1 := -d[3] + d[5] - d[7] - (d[7] >> 1)
+	a3 := d[1] + d[7] - d[3] - (d[3] >> 1)
+	a5 := -d[1] + d[7] + d[5] + (d[5] >> 1)
+	a7 := d[3] + d[5] + d[1] + (d[1] >> 1)
+
+	b1 := a1 + (a7 >> 2)
+	b7 := a7 - (a1 >> 2)
+	b3 := a3 + (a5 >> 2)
+	b5 := (a3 >> 2) - a5
+
+	return [8]int32{
+		b0 + b7,
+		b2 + b5,
+		b4 + b3,
+		b6 + b1,
+		b6 - b1,
+		b4 - b3,
+		b2 - b5,
+		b0 - b7,
+	}
+}
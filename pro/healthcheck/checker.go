@@ -1,100 +1,75 @@
-// Package healthcheck implements health checking for network capture devices.
+// Package healthcheck implements health checks of paths.
 package healthcheck
 
 import (
-	"bytes"
 	"context"
-	"fmt"
-	"net/http"
-	"net/url"
-	"path/filepath"
+	"errors"
+	"reflect"
+	"sort"
 	"sync"
 	"time"
 
-	"github.com/bluenviron/gortsplib/v5/pkg/base"
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
-	"github.com/bluenviron/mediamtx/pro/deviceutil"
+	"github.com/bluenviron/mediamtx/pro/framecheck"
 )
 
-const (
-	// DeviceTypeNetworkCapture indicates a network capture card device
-	DeviceTypeNetworkCapture = "network_capture"
+const syncInterval = 5 * time.Second // 同步监控的路径列表的间隔
 
-	// Fixed health check parameters
-	checkInterval    = 5 * time.Second  // 固定60秒检查一次
-	failureThreshold = 6                // 固定失败6次后重启设备
-	rebootTimeout    = 10 * time.Second // 重启请求超时时间
-)
+// ErrPathNotFound is returned when a path is not monitored.
+var ErrPathNotFound = errors.New("path not found")
 
-// Checker monitors path health and restarts capture devices when needed.
+// Checker monitors the health of paths and restarts capture devices when needed.
 type Checker struct {
 	PathConfs   map[string]*conf.Path
 	PathManager pathManager
+	Frames      frameStatusGetter // optional, reports frozen, black and solid color video
 	Parent      logger.Writer
 
+	// OnTransition is called when the state of a path changes. Optional.
+	OnTransition func(pathName string, t Transition)
+
 	ctx       context.Context
 	ctxCancel func()
 	wg        sync.WaitGroup
 	mutex     sync.RWMutex
 	monitors  map[string]*pathMonitor // key: pathName
+	chSync    chan struct{}
 }
 
 type pathManager interface {
+	APIPathsList() (*defs.APIPathList, error)
 	APIPathsGet(name string) (*defs.APIPath, error)
+	GetStreamForRecording(pathName string) (interface{}, error)
 }
 
-type pathMonitor struct {
-	pathName       string
-	deviceIP       string
-	streamName     string
-	failureCount   int
-	checker        *Checker
-	ctx            context.Context
-	ctxCancel      func()
-	snapshotGetter snapshotGetter
-}
-
-type snapshotGetter interface {
-	GetSnapshot(pathName string) ([]byte, string, error)
+type frameStatusGetter interface {
+	Status(pathName string) (framecheck.Status, bool)
 }
 
 // Initialize initializes the Checker.
-func (c *Checker) Initialize(snapshotGetter snapshotGetter) error {
+func (c *Checker) Initialize() error {
 	c.ctx, c.ctxCancel = context.WithCancel(context.Background())
 	c.monitors = make(map[string]*pathMonitor)
+	c.chSync = make(chan struct{}, 1)
 
-	// Start monitors for all network capture device paths
-	for pathName, pathConf := range c.PathConfs {
-		if pathConf.DeviceType == DeviceTypeNetworkCapture {
-			err := c.startMonitor(pathName, pathConf, snapshotGetter)
-			if err != nil {
-				c.Log(logger.Warn, "failed to start health check for path '%s': %v", pathName, err)
-			}
-		}
-	}
+	c.wg.Add(1)
+	go c.run()
 
-	c.Log(logger.Info, "health checker initialized with %d monitors", len(c.monitors))
+	c.Log(logger.Info, "health checker initialized")
 	return nil
 }
 
 // Close closes the Checker.
 func (c *Checker) Close() {
-	if c.ctxCancel != nil {
-		c.ctxCancel()
-	}
-
+	c.ctxCancel()
 	c.wg.Wait()
 
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	for _, monitor := range c.monitors {
-		monitor.stop()
-	}
-
 	c.monitors = nil
+	c.mutex.Unlock()
+
 	c.Log(logger.Info, "health checker closed")
 }
 
@@ -104,202 +79,133 @@ func (c *Checker) Log(level logger.Level, format string, args ...interface{}) {
 }
 
 // ReloadPathConfs reloads path configurations.
-func (c *Checker) ReloadPathConfs(pathConfs map[string]*conf.Path, snapshotGetter snapshotGetter) {
+func (c *Checker) ReloadPathConfs(pathConfs map[string]*conf.Path) {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	// Stop monitors for removed or non-capture-device paths
-	for pathName, monitor := range c.monitors {
-		newConf, exists := pathConfs[pathName]
-		if !exists || newConf.DeviceType != DeviceTypeNetworkCapture {
-			c.Log(logger.Info, "stopping health check for path '%s'", pathName)
-			monitor.stop()
-			delete(c.monitors, pathName)
-		}
-	}
+	c.PathConfs = pathConfs
+	c.mutex.Unlock()
 
-	// Start monitors for new network capture device paths
-	for pathName, pathConf := range pathConfs {
-		if pathConf.DeviceType == DeviceTypeNetworkCapture {
-			if _, exists := c.monitors[pathName]; !exists {
-				err := c.startMonitor(pathName, pathConf, snapshotGetter)
-				if err != nil {
-					c.Log(logger.Warn, "failed to start health check for path '%s': %v", pathName, err)
-				}
-			}
-		}
+	// monitors are restarted by the run loop, since listing paths requires the path manager
+	select {
+	case c.chSync <- struct{}{}:
+	default:
 	}
 
-	c.PathConfs = pathConfs
-	c.Log(logger.Info, "health check configurations reloaded, active monitors: %d", len(c.monitors))
+	c.Log(logger.Info, "health check configurations reloaded")
 }
 
-// startMonitor starts a health check monitor for a path.
-func (c *Checker) startMonitor(pathName string, pathConf *conf.Path, snapshotGetter snapshotGetter) error {
-	// Parse source URL to get device IP
-	u, err := base.ParseURL(pathConf.Source)
-	if err != nil {
-		return fmt.Errorf("failed to parse source URL: %w", err)
-	}
-
-	if u.Host == "" {
-		return fmt.Errorf("source URL has no host")
-	}
+// Paths returns the health of all monitored paths, sorted by name.
+func (c *Checker) Paths() []PathHealth {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 
-	streamName := filepath.Base(u.Path)
-	if streamName == "" {
-		return fmt.Errorf("source URL has no stream name")
+	ret := make([]PathHealth, 0, len(c.monitors))
+	for _, m := range c.monitors {
+		ret = append(ret, m.health())
 	}
 
-	monitorCtx, monitorCancel := context.WithCancel(c.ctx)
-
-	monitor := &pathMonitor{
-		pathName:       pathName,
-		deviceIP:       u.Host,
-		streamName:     streamName,
-		checker:        c,
-		ctx:            monitorCtx,
-		ctxCancel:      monitorCancel,
-		snapshotGetter: snapshotGetter,
-	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
 
-	c.monitors[pathName] = monitor
+	return ret
+}
 
-	c.wg.Add(1)
-	go monitor.run()
+// Path returns the health of a path.
+func (c *Checker) Path(name string) (*PathHealth, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 
-	c.Log(logger.Info, "started health check for path '%s' (device: %s, interval: %v, threshold: %d)",
-		pathName, u.Host, checkInterval, failureThreshold)
+	m, ok := c.monitors[name]
+	if !ok {
+		return nil, ErrPathNotFound
+	}
 
-	return nil
+	h := m.health()
+	return &h, nil
 }
 
-// run is the main monitoring loop for a path.
-func (m *pathMonitor) run() {
-	defer m.checker.wg.Done()
+func (c *Checker) run() {
+	defer c.wg.Done()
 
-	ticker := time.NewTicker(checkInterval)
+	ticker := time.NewTicker(syncInterval)
 	defer ticker.Stop()
 
-	m.checker.Log(logger.Info, "health check monitor started for path '%s'", m.pathName)
+	c.syncMonitors()
 
 	for {
 		select {
-		case <-m.ctx.Done():
-			m.checker.Log(logger.Info, "health check monitor stopped for path '%s'", m.pathName)
-			return
-
 		case <-ticker.C:
-			m.performCheck()
-		}
-	}
-}
+			c.syncMonitors()
 
-// performCheck performs a single health check.
-func (m *pathMonitor) performCheck() {
-	// First, check device status via GetInputStatusIsAvalible
-	availableCount, err := deviceutil.GetInputStatusIsAvalible(m.deviceIP)
-	if err != nil || availableCount == 0 {
-		m.checker.Log(logger.Debug, "device %s not available, skipping snapshot check", m.deviceIP)
-		return
-	}
-	// Then, check snapshot
-	_, _, err = m.snapshotGetter.GetSnapshot(m.pathName)
-	if err != nil {
-		m.failureCount++
-		m.checker.Log(logger.Warn, "health check failed for path '%s' (%d/%d): %v",
-			m.pathName, m.failureCount, failureThreshold, err)
-
-		// If failure threshold reached, reboot device
-		if m.failureCount >= failureThreshold {
-			m.failureCount = 0 // Reset counter
-			m.checker.Log(logger.Error, "health check failure threshold reached for path '%s', rebooting device %s",
-				m.pathName, m.deviceIP)
-
-			err := m.rebootDevice()
-			if err != nil {
-				m.checker.Log(logger.Error, "failed to reboot device %s: %v", m.deviceIP, err)
-			} else {
-				m.checker.Log(logger.Info, "device %s reboot request sent successfully", m.deviceIP)
-			}
-		}
-	} else {
-		// Success, reset failure counter
-		if m.failureCount > 0 {
-			m.checker.Log(logger.Info, "health check recovered for path '%s', resetting failure count", m.pathName)
-			m.failureCount = 0
+		case <-c.chSync:
+			c.syncMonitors()
+
+		case <-c.ctx.Done():
+			// monitors are stopped by the same context
+			return
 		}
 	}
 }
 
-// rebootDevice sends reboot command to the capture device.
-func (m *pathMonitor) rebootDevice() error {
-	baseURL := "http://" + m.deviceIP
-
-	// Step 1: Login
-	loginURL := baseURL + "/login2.php"
-	formData := url.Values{}
-	formData.Add("name", "admin")
-	formData.Add("passwd", "admin")
-
-	req1, err := http.NewRequest("POST", loginURL, bytes.NewBufferString(formData.Encode()))
+// syncMonitors starts a monitor for every path with health checks enabled,
+// and stops the monitors of removed, disabled or reconfigured paths.
+func (c *Checker) syncMonitors() {
+	list, err := c.PathManager.APIPathsList()
 	if err != nil {
-		return fmt.Errorf("failed to create login request: %w", err)
+		c.Log(logger.Debug, "unable to list paths: %v", err)
+		return
 	}
 
-	req1.Header.Set("Accept", "application/json")
-	req1.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	client := &http.Client{Timeout: rebootTimeout}
-	resp1, err := client.Do(req1)
-	if err != nil {
-		return fmt.Errorf("login request failed: %w", err)
+	if c.ctx.Err() != nil {
+		return
 	}
-	defer resp1.Body.Close()
 
-	if resp1.StatusCode != http.StatusOK {
-		return fmt.Errorf("login request returned status %d", resp1.StatusCode)
+	wanted := make(map[string]*conf.Path)
+	for _, item := range list.Items {
+		pathConf, ok := c.PathConfs[item.ConfName]
+		if ok && pathConf.HealthCheck {
+			wanted[item.Name] = pathConf
+		}
 	}
 
-	// Get cookies from login response
-	var cookieStr string
-	cookies := resp1.Cookies()
-	for i, cookie := range cookies {
-		if i > 0 {
-			cookieStr += "; "
+	for pathName, m := range c.monitors {
+		pathConf, ok := wanted[pathName]
+		if !ok || !reflect.DeepEqual(pathConf, m.pathConf) {
+			c.Log(logger.Debug, "stopping health check for path '%s'", pathName)
+			m.stop()
+			delete(c.monitors, pathName)
 		}
-		cookieStr += fmt.Sprintf("%s=%s", cookie.Name, cookie.Value)
 	}
 
-	// Step 2: Reboot
-	rebootURL := baseURL + "/func.php?func=reboot"
-	req2, err := http.NewRequest("POST", rebootURL, bytes.NewBuffer([]byte{}))
-	if err != nil {
-		return fmt.Errorf("failed to create reboot request: %w", err)
+	for pathName, pathConf := range wanted {
+		if _, ok := c.monitors[pathName]; !ok {
+			c.startMonitor(pathName, pathConf)
+		}
 	}
+}
 
-	req2.Header.Set("Accept", "application/json")
-	req2.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	if cookieStr != "" {
-		req2.Header.Set("Cookie", cookieStr)
-	}
+// startMonitor starts a health check monitor for a path.
+func (c *Checker) startMonitor(pathName string, pathConf *conf.Path) {
+	ctx, ctxCancel := context.WithCancel(c.ctx)
 
-	resp2, err := client.Do(req2)
-	if err != nil {
-		return fmt.Errorf("reboot request failed: %w", err)
+	m := &pathMonitor{
+		pathName:  pathName,
+		pathConf:  pathConf,
+		policy:    PolicyFromConf(pathConf),
+		checker:   c,
+		ctx:       ctx,
+		ctxCancel: ctxCancel,
 	}
-	defer resp2.Body.Close()
+	m.initialize()
 
-	if resp2.StatusCode != http.StatusOK {
-		return fmt.Errorf("reboot request returned status %d", resp2.StatusCode)
-	}
+	c.monitors[pathName] = m
 
-	return nil
-}
+	c.wg.Add(1)
+	go m.run()
 
-// stop stops the path monitor.
-func (m *pathMonitor) stop() {
-	if m.ctxCancel != nil {
-		m.ctxCancel()
-	}
+	c.Log(logger.Debug, "started health check for path '%s' (interval: %v, threshold: %d)",
+		pathName, m.policy.Interval, m.policy.FailureThreshold)
 }
@@ -0,0 +1,378 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/internal/unit"
+	"github.com/bluenviron/mediamtx/pro/devicedriver"
+	"github.com/bluenviron/mediamtx/pro/framecheck"
+)
+
+type dummyPathManager struct {
+	mutex sync.Mutex
+	paths map[string]*defs.APIPath
+}
+
+func (pm *dummyPathManager) APIPathsList() (*defs.APIPathList, error) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	l := &defs.APIPathList{}
+	for _, p := range pm.paths {
+		cp := *p
+		l.Items = append(l.Items, &cp)
+	}
+	return l, nil
+}
+
+func (pm *dummyPathManager) APIPathsGet(name string) (*defs.APIPath, error) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+
+	p, ok := pm.paths[name]
+	if !ok {
+		return nil, fmt.Errorf("path not found")
+	}
+	cp := *p
+	return &cp, nil
+}
+
+func (pm *dummyPathManager) GetStreamForRecording(pathName string) (interface{}, error) {
+	return nil, fmt.Errorf("path '%s' has no active stream", pathName)
+}
+
+func (pm *dummyPathManager) addBytes(name string, n uint64) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	pm.paths[name].BytesReceived += n
+}
+
+type dummyFrames struct {
+	status framecheck.Status
+}
+
+func (f *dummyFrames) Status(pathName string) (framecheck.Status, bool) {
+	if pathName != f.status.Path {
+		return framecheck.Status{}, false
+	}
+	return f.status, true
+}
+
+type dummyDriver struct {
+	reboots int
+}
+
+func (d *dummyDriver) Snapshot(context.Context, *devicedriver.Device) ([]byte, error) {
+	return nil, devicedriver.ErrNotSupported
+}
+
+func (d *dummyDriver) InputStatus(context.Context, *devicedriver.Device) (int, error) {
+	return 0, devicedriver.ErrNotSupported
+}
+
+func (d *dummyDriver) Reboot(context.Context, *devicedriver.Device) error {
+	d.reboots++
+	return nil
+}
+
+func (d *dummyDriver) Info(context.Context, *devicedriver.Device) (*devicedriver.Info, error) {
+	return nil, devicedriver.ErrNotSupported
+}
+
+func testPathConf(name string, source string) *conf.Path {
+	return &conf.Path{
+		Name:                    name,
+		Source:                  source,
+		HealthCheck:             true,
+		HealthCheckInterval:     conf.Duration(50 * time.Millisecond),
+		HealthNoDataTimeout:     conf.Duration(200 * time.Millisecond),
+		HealthMinBitrateRatio:   0.2,
+		HealthFailureThreshold:  3,
+		HealthRecoveryThreshold: 2,
+	}
+}
+
+func TestStateMachine(t *testing.T) {
+	policy := Policy{FailureThreshold: 3, RecoveryThreshold: 2}
+	now := time.Now()
+	sm := newStateMachine(now)
+
+	for _, ca := range []struct {
+		reasons []string
+		state   State
+	}{
+		{nil, StateHealthy},
+		{[]string{"no data"}, StateDegraded},
+		{[]string{"no data"}, StateDegraded},
+		{[]string{"no data"}, StateUnhealthy},
+		{nil, StateUnhealthy},
+		{[]string{"no data"}, StateUnhealthy},
+		{nil, StateUnhealthy},
+		{nil, StateHealthy},
+	} {
+		now = now.Add(time.Second)
+		sm.update(now, ca.reasons, policy)
+		require.Equal(t, ca.state, sm.state)
+	}
+
+	require.Equal(t, []Transition{
+		{From: StateUnknown, To: StateHealthy, Time: now.Add(-7 * time.Second)},
+		{From: StateHealthy, To: StateDegraded, Time: now.Add(-6 * time.Second), Reasons: []string{"no data"}},
+		{From: StateDegraded, To: StateUnhealthy, Time: now.Add(-4 * time.Second), Reasons: []string{"no data"}},
+		{From: StateUnhealthy, To: StateHealthy, Time: now},
+	}, sm.history)
+
+	tr := sm.setIdle(now)
+	require.Equal(t, StateHealthy, tr.From)
+	require.Equal(t, StateIdle, sm.state)
+	require.Nil(t, sm.setIdle(now))
+}
+
+func TestSustainedBitrateDrop(t *testing.T) {
+	policy := Policy{MinBitrateRatio: 0.2, FailureThreshold: 3, RecoveryThreshold: 2}
+	now := time.Now()
+
+	m := &pathMonitor{policy: policy, sm: newStateMachine(now)}
+
+	var bytes uint64
+	check := func(rate uint64) *checkResult {
+		now = now.Add(time.Second)
+		bytes += rate
+		res := &checkResult{time: now}
+		m.checkBytes(res, bytes)
+		m.sm.update(res.time, res.reasons, policy)
+		return res
+	}
+
+	for range 10 {
+		check(100000)
+	}
+	require.Equal(t, StateHealthy, m.sm.state)
+	baseline := m.bitrateBaseline
+
+	// the path stays unhealthy as long as the drop continues
+	for range 50 {
+		res := check(1000)
+		require.Len(t, res.reasons, 1)
+	}
+	require.Equal(t, StateUnhealthy, m.sm.state)
+	require.Equal(t, baseline, m.bitrateBaseline)
+
+	for range 2 {
+		check(100000)
+	}
+	require.Equal(t, StateHealthy, m.sm.state)
+}
+
+func TestDeviceReboot(t *testing.T) {
+	for _, ca := range []string{"soft", "hard", "soft with reboot"} {
+		t.Run(ca, func(t *testing.T) {
+			drv := &dummyDriver{}
+			now := time.Now()
+
+			m := &pathMonitor{
+				pathName: "cam",
+				policy:   Policy{FailureThreshold: 3, RecoveryThreshold: 2, RebootOnSoftFailures: ca == "soft with reboot"},
+				checker:  &Checker{Parent: test.NilLogger},
+				ctx:      context.Background(),
+				driver:   drv,
+				device:   &devicedriver.Device{Type: "dummy", Host: "127.0.0.1"},
+				sm:       newStateMachine(now),
+			}
+
+			for range 6 {
+				now = now.Add(time.Second)
+				res := &checkResult{time: now}
+				if ca == "hard" {
+					res.reasons = []string{"no data for 10s"}
+					res.hardFailure = true
+				} else {
+					res.reasons = []string{"bitrate dropped to 0 kbps (baseline 1000 kbps)"}
+				}
+				m.apply(res)
+			}
+
+			require.Equal(t, StateUnhealthy, m.sm.state)
+
+			// soft probes change the state only, unless they are allowed to reboot the device
+			switch ca {
+			case "soft":
+				require.Equal(t, 0, drv.reboots)
+
+			default:
+				require.Equal(t, 2, drv.reboots)
+			}
+		})
+	}
+}
+
+func TestStreamProbe(t *testing.T) {
+	forma := &format.H264{PayloadTyp: 96, PacketizationMode: 1}
+	start := time.Now()
+
+	p := &streamProbe{
+		maxTimestampJump: time.Second,
+		primaryForma:     forma,
+		lastPTS:          make(map[format.Format]int64),
+	}
+
+	idr := unit.PayloadH264{{byte(h264.NALUTypeIDR)}}
+	nonIDR := unit.PayloadH264{{byte(h264.NALUTypeNonIDR)}}
+
+	p.onUnit(forma, &unit.Unit{PTS: 0, Payload: idr}, start)
+	p.onUnit(forma, &unit.Unit{PTS: 3000, Payload: nonIDR}, start.Add(40*time.Millisecond))
+	p.onUnit(forma, &unit.Unit{PTS: 6000, Payload: nonIDR}, start.Add(80*time.Millisecond))
+
+	// the source restarted its timestamps
+	p.onUnit(forma, &unit.Unit{PTS: 900000, Payload: nonIDR}, start.Add(120*time.Millisecond))
+
+	s := p.takeSample()
+	require.Equal(t, 4, s.frames)
+	require.Equal(t, 1, s.discontinuities)
+	require.Equal(t, start, s.lastKeyframe)
+
+	s = p.takeSample()
+	require.Equal(t, 0, s.frames)
+	require.Equal(t, 0, s.discontinuities)
+	require.Equal(t, start, s.lastKeyframe)
+}
+
+func TestChecker(t *testing.T) {
+	pm := &dummyPathManager{
+		paths: map[string]*defs.APIPath{
+			"cam":      {Name: "cam", ConfName: "cam", Ready: true},
+			"pub":      {Name: "pub", ConfName: "pub"},
+			"disabled": {Name: "disabled", ConfName: "disabled", Ready: true},
+		},
+	}
+
+	disabled := testPathConf("disabled", "publisher")
+	disabled.HealthCheck = false
+
+	var transitionsMutex sync.Mutex
+	transitions := make(map[string][]State)
+
+	c := &Checker{
+		PathConfs: map[string]*conf.Path{
+			"cam":      testPathConf("cam", "rtsp://127.0.0.1:8554/cam"),
+			"pub":      testPathConf("pub", "publisher"),
+			"disabled": disabled,
+		},
+		PathManager: pm,
+		Parent:      test.NilLogger,
+		OnTransition: func(pathName string, tr Transition) {
+			transitionsMutex.Lock()
+			defer transitionsMutex.Unlock()
+			transitions[pathName] = append(transitions[pathName], tr.To)
+		},
+	}
+	err := c.Initialize()
+	require.NoError(t, err)
+	defer c.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case <-time.After(10 * time.Millisecond):
+				pm.addBytes("cam", 10000)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	require.Eventually(t, func() bool {
+		h, err := c.Path("cam")
+		return err == nil && h.State == StateHealthy && h.Bitrate > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		h, err := c.Path("pub")
+		return err == nil && h.State == StateIdle
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = c.Path("disabled")
+	require.ErrorIs(t, err, ErrPathNotFound)
+
+	// the source stops sending data
+	done <- struct{}{}
+
+	require.Eventually(t, func() bool {
+		h, _ := c.Path("cam")
+		return h.State == StateUnhealthy && len(h.Reasons) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	h, err := c.Path("cam")
+	require.NoError(t, err)
+	require.Contains(t, h.Reasons[0], "bitrate dropped to 0 kbps")
+	require.Contains(t, h.Reasons[1], "no data for")
+	require.Equal(t, StateDegraded, h.History[len(h.History)-2].To)
+
+	transitionsMutex.Lock()
+	require.Equal(t, []State{StateIdle}, transitions["pub"])
+	require.Equal(t, StateUnhealthy, transitions["cam"][len(transitions["cam"])-1])
+	transitionsMutex.Unlock()
+
+	paths := c.Paths()
+	require.Len(t, paths, 2)
+	require.Equal(t, "cam", paths[0].Name)
+	require.Equal(t, "pub", paths[1].Name)
+
+	// monitors follow the path configuration
+	c.ReloadPathConfs(map[string]*conf.Path{
+		"cam": testPathConf("cam", "rtsp://127.0.0.1:8554/cam"),
+	})
+
+	require.Eventually(t, func() bool {
+		return len(c.Paths()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCheckerFrames(t *testing.T) {
+	pm := &dummyPathManager{
+		paths: map[string]*defs.APIPath{
+			"cam": {Name: "cam", ConfName: "cam", Ready: true},
+		},
+	}
+
+	c := &Checker{
+		PathConfs: map[string]*conf.Path{
+			"cam": testPathConf("cam", "publisher"),
+		},
+		PathManager: pm,
+		Frames: &dummyFrames{status: framecheck.Status{
+			Path:      "cam",
+			Condition: framecheck.ConditionSolid,
+			Since:     time.Now().Add(-10 * time.Second),
+			Color:     "#0000c8",
+		}},
+		Parent: test.NilLogger,
+	}
+	err := c.Initialize()
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.Eventually(t, func() bool {
+		h, err := c.Path("cam")
+		return err == nil && h.State == StateUnhealthy
+	}, 5*time.Second, 10*time.Millisecond)
+
+	h, err := c.Path("cam")
+	require.NoError(t, err)
+	require.Contains(t, h.Reasons, "solid color video (#0000c8) for 10s")
+	require.Equal(t, framecheck.ConditionSolid, h.Frame.Condition)
+}
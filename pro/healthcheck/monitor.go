@@ -0,0 +1,436 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/pro/devicedriver"
+	"github.com/bluenviron/mediamtx/pro/framecheck"
+)
+
+// weight of a new measurement in the bitrate and frame rate baselines,
+// which are moving averages that follow slow changes of the stream.
+const baselineWeight = 0.1
+
+// PathHealth is the health of a path.
+type PathHealth struct {
+	Name             string             `json:"name"`
+	State            State              `json:"state"`
+	Since            time.Time          `json:"since"`
+	Reasons          []string           `json:"reasons"` // failed probes of the last check
+	LastCheck        *time.Time         `json:"lastCheck"`
+	Bitrate          float64            `json:"bitrate"`   // bits per second
+	FrameRate        float64            `json:"frameRate"` // frames per second of the first video track
+	LastDataTime     *time.Time         `json:"lastDataTime"`
+	LastKeyframeTime *time.Time         `json:"lastKeyframeTime"`
+	Frame            *framecheck.Status `json:"frame,omitempty"` // paths with 'frameCheck' enabled only
+	Policy           Policy             `json:"policy"`
+	History          []Transition       `json:"history"`
+}
+
+// checkResult contains the measurements of a check.
+type checkResult struct {
+	time         time.Time
+	reasons      []string
+	bitrate      float64
+	frameRate    float64
+	lastData     time.Time
+	lastKeyframe time.Time
+	frame        *framecheck.Status
+
+	// a probe that shows the device is not working (no data, snapshot failure) failed
+	hardFailure bool
+}
+
+type pathMonitor struct {
+	pathName  string
+	pathConf  *conf.Path
+	policy    Policy
+	checker   *Checker
+	ctx       context.Context
+	ctxCancel func()
+
+	// capture devices only
+	driver devicedriver.Driver
+	device *devicedriver.Device
+
+	// used by the monitor routine only
+	probe             *streamProbe
+	lastSample        time.Time
+	lastBytes         uint64
+	lastBytesTime     time.Time
+	lastData          time.Time
+	bitrateBaseline   float64
+	frameRateBaseline float64
+	hardFailures      int // consecutive checks with a hard failure
+
+	mutex sync.Mutex
+	sm    *stateMachine
+	last  checkResult
+}
+
+func (m *pathMonitor) initialize() {
+	now := time.Now()
+
+	m.sm = newStateMachine(now)
+
+	// the grace period of the no data probe starts now
+	m.lastData = now
+
+	if m.pathConf.DeviceType != "" {
+		var err error
+		m.driver, m.device, err = devicedriver.Open(m.pathConf.DeviceType, m.pathConf)
+		if err != nil {
+			m.checker.Log(logger.Warn, "path '%s': %v, the device will not be checked nor restarted",
+				m.pathName, err)
+		}
+	}
+}
+
+func (m *pathMonitor) stop() {
+	m.ctxCancel()
+}
+
+// run is the main monitoring loop for a path.
+func (m *pathMonitor) run() {
+	defer m.checker.wg.Done()
+	defer m.closeProbe()
+
+	ticker := time.NewTicker(time.Duration(m.policy.Interval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.check(time.Now())
+
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// expectsData returns whether a path is expected to be ready at any time.
+func expectsData(pathConf *conf.Path) bool {
+	// capture devices are always connected
+	if _, ok := devicedriver.Get(pathConf.DeviceType); ok {
+		return true
+	}
+
+	switch pathConf.Source {
+	case "publisher", "redirect":
+		return false
+	}
+
+	return !pathConf.SourceOnDemand
+}
+
+func updateBaseline(baseline float64, v float64) float64 {
+	if baseline == 0 {
+		return v
+	}
+	return baseline + (v-baseline)*baselineWeight
+}
+
+// check runs all probes and updates the state of the path.
+func (m *pathMonitor) check(now time.Time) {
+	if m.device != nil {
+		// a capture device without input signal is not a failure
+		availableCount, err := m.driver.InputStatus(m.ctx, m.device)
+		if !errors.Is(err, devicedriver.ErrNotSupported) && (err != nil || availableCount == 0) {
+			m.setIdle(now)
+			return
+		}
+	}
+
+	pathData, err := m.checker.PathManager.APIPathsGet(m.pathName)
+	if err != nil || !pathData.Ready {
+		if !expectsData(m.pathConf) {
+			m.setIdle(now)
+			return
+		}
+
+		m.closeProbe()
+		m.lastBytesTime = time.Time{}
+
+		res := &checkResult{time: now, lastData: m.lastData}
+		m.checkNoData(res)
+		m.apply(res)
+		return
+	}
+
+	res := &checkResult{time: now}
+	m.checkBytes(res, pathData.BytesReceived)
+	m.checkNoData(res)
+	m.checkStream(res)
+	m.checkFrame(res)
+
+	if m.device != nil {
+		_, err = m.driver.Snapshot(m.ctx, m.device)
+		if err != nil && !errors.Is(err, devicedriver.ErrNotSupported) {
+			res.reasons = append(res.reasons, fmt.Sprintf("snapshot failed: %v", err))
+			res.hardFailure = true
+		}
+	}
+
+	m.apply(res)
+}
+
+func (m *pathMonitor) checkNoData(res *checkResult) {
+	elapsed := res.time.Sub(m.lastData)
+
+	if m.policy.NoDataTimeout > 0 && elapsed >= time.Duration(m.policy.NoDataTimeout) {
+		res.reasons = append(res.reasons, fmt.Sprintf("no data for %v", elapsed.Truncate(time.Second)))
+		res.hardFailure = true
+	}
+}
+
+func (m *pathMonitor) checkBytes(res *checkResult, bytes uint64) {
+	if bytes != m.lastBytes {
+		m.lastData = res.time
+	}
+	res.lastData = m.lastData
+
+	// the first check after the path becomes ready is used as reference
+	if !m.lastBytesTime.IsZero() && bytes >= m.lastBytes {
+		res.bitrate = float64(bytes-m.lastBytes) * 8 / res.time.Sub(m.lastBytesTime).Seconds()
+
+		if m.policy.MinBitrateRatio > 0 && m.bitrateBaseline > 0 &&
+			res.bitrate < m.bitrateBaseline*m.policy.MinBitrateRatio {
+			res.reasons = append(res.reasons, fmt.Sprintf("bitrate dropped to %.0f kbps (baseline %.0f kbps)",
+				res.bitrate/1000, m.bitrateBaseline/1000))
+		} else {
+			// the baseline is frozen during a drop, otherwise it would decay toward the bad value
+			m.bitrateBaseline = updateBaseline(m.bitrateBaseline, res.bitrate)
+		}
+	}
+
+	m.lastBytes = bytes
+	m.lastBytesTime = res.time
+}
+
+func (m *pathMonitor) checkStream(res *checkResult) {
+	m.attachProbe(res.time)
+	if m.probe == nil {
+		return
+	}
+
+	sample := m.probe.takeSample()
+	elapsed := res.time.Sub(m.lastSample).Seconds()
+	m.lastSample = res.time
+
+	if sample.discontinuities != 0 {
+		res.reasons = append(res.reasons, fmt.Sprintf("%d timestamp discontinuities", sample.discontinuities))
+	}
+
+	if !m.probe.hasVideo() {
+		return
+	}
+
+	if elapsed > 0 {
+		res.frameRate = float64(sample.frames) / elapsed
+
+		if m.policy.MinFrameRateRatio > 0 && m.frameRateBaseline > 0 &&
+			res.frameRate < m.frameRateBaseline*m.policy.MinFrameRateRatio {
+			res.reasons = append(res.reasons, fmt.Sprintf("frame rate dropped to %.1f fps (baseline %.1f fps)",
+				res.frameRate, m.frameRateBaseline))
+		} else {
+			m.frameRateBaseline = updateBaseline(m.frameRateBaseline, res.frameRate)
+		}
+	}
+
+	if !sample.lastKeyframe.IsZero() {
+		res.lastKeyframe = sample.lastKeyframe
+
+		stalled := res.time.Sub(sample.lastKeyframe)
+		if m.policy.KeyframeTimeout > 0 && stalled >= time.Duration(m.policy.KeyframeTimeout) {
+			res.reasons = append(res.reasons, fmt.Sprintf("no keyframe for %v", stalled.Truncate(time.Second)))
+		}
+	}
+}
+
+// checkFrame adds a reason when the frame checker reports frozen, black or solid color video.
+func (m *pathMonitor) checkFrame(res *checkResult) {
+	if m.checker.Frames == nil {
+		return
+	}
+
+	status, ok := m.checker.Frames.Status(m.pathName)
+	if !ok {
+		return
+	}
+	res.frame = &status
+
+	if !status.Condition.Abnormal() {
+		return
+	}
+
+	elapsed := res.time.Sub(status.Since).Truncate(time.Second)
+
+	switch status.Condition {
+	case framecheck.ConditionSolid:
+		res.reasons = append(res.reasons, fmt.Sprintf("solid color video (%s) for %v", status.Color, elapsed))
+
+	default:
+		res.reasons = append(res.reasons, fmt.Sprintf("%s video for %v", status.Condition, elapsed))
+	}
+}
+
+// attachProbe attaches a probe to the current stream of the path.
+func (m *pathMonitor) attachProbe(now time.Time) {
+	streamInterface, err := m.checker.PathManager.GetStreamForRecording(m.pathName)
+	if err != nil {
+		m.closeProbe()
+		return
+	}
+
+	streamObj, ok := streamInterface.(*stream.Stream)
+	if !ok {
+		m.closeProbe()
+		return
+	}
+
+	if m.probe != nil && m.probe.stream == streamObj {
+		return
+	}
+
+	m.closeProbe()
+
+	m.probe = &streamProbe{
+		stream:           streamObj,
+		maxTimestampJump: time.Duration(m.policy.MaxTimestampJump),
+		parent:           m.checker,
+	}
+	m.probe.initialize(now)
+	m.lastSample = now
+	m.frameRateBaseline = 0
+}
+
+func (m *pathMonitor) closeProbe() {
+	if m.probe != nil {
+		m.probe.close()
+		m.probe = nil
+	}
+}
+
+// setIdle moves the path into the idle state, where probes are not run.
+func (m *pathMonitor) setIdle(now time.Time) {
+	m.closeProbe()
+	m.lastBytesTime = time.Time{}
+
+	// the grace period of the no data probe restarts when the path leaves the idle state
+	m.lastData = now
+	m.hardFailures = 0
+
+	m.mutex.Lock()
+	t := m.sm.setIdle(now)
+	m.last = checkResult{time: now}
+	m.mutex.Unlock()
+
+	if t != nil {
+		m.notifyTransition(t)
+	}
+}
+
+func (m *pathMonitor) notifyTransition(t *Transition) {
+	if m.checker.OnTransition != nil {
+		m.checker.OnTransition(m.pathName, *t)
+	}
+}
+
+// apply updates the state machine with the result of a check.
+func (m *pathMonitor) apply(res *checkResult) {
+	m.mutex.Lock()
+	t := m.sm.update(res.time, res.reasons, m.policy)
+	state := m.sm.state
+	failures := m.sm.failures
+	m.last = *res
+	m.mutex.Unlock()
+
+	if res.hardFailure {
+		m.hardFailures++
+	} else {
+		m.hardFailures = 0
+	}
+
+	if t != nil {
+		switch t.To {
+		case StateUnhealthy:
+			m.checker.Log(logger.Error, "path '%s' is unhealthy: %s", m.pathName, strings.Join(t.Reasons, ", "))
+
+		case StateDegraded:
+			m.checker.Log(logger.Warn, "path '%s' is degraded: %s", m.pathName, strings.Join(t.Reasons, ", "))
+
+		case StateHealthy:
+			if t.From == StateDegraded || t.From == StateUnhealthy {
+				m.checker.Log(logger.Info, "path '%s' recovered", m.pathName)
+			}
+		}
+
+		m.notifyTransition(t)
+	}
+
+	// capture devices are restarted every time the failure threshold is reached.
+	// Only hard failures count by default: a drop of bitrate or frame rate, a timestamp jump
+	// or a frozen picture are usually caused by the scene or by the network, not by the device.
+	if !m.policy.RebootOnSoftFailures {
+		failures = m.hardFailures
+	}
+
+	if m.device != nil && state == StateUnhealthy && failures != 0 && failures%m.policy.FailureThreshold == 0 {
+		m.checker.Log(logger.Error, "health check failure threshold reached for path '%s', rebooting device %s",
+			m.pathName, m.device.Host)
+
+		err := m.driver.Reboot(m.ctx, m.device)
+		switch {
+		case errors.Is(err, devicedriver.ErrNotSupported):
+			m.checker.Log(logger.Warn, "device %s (%s) can't be rebooted", m.device.Host, m.device.Type)
+
+		case err != nil:
+			m.checker.Log(logger.Error, "failed to reboot device %s: %v", m.device.Host, err)
+
+		default:
+			m.checker.Log(logger.Info, "device %s reboot request sent successfully", m.device.Host)
+		}
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// health returns the current health of the path.
+func (m *pathMonitor) health() PathHealth {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	reasons := m.last.reasons
+	if reasons == nil {
+		reasons = []string{}
+	}
+
+	return PathHealth{
+		Name:             m.pathName,
+		State:            m.sm.state,
+		Since:            m.sm.since,
+		Reasons:          reasons,
+		LastCheck:        timePtr(m.last.time),
+		Bitrate:          m.last.bitrate,
+		FrameRate:        m.last.frameRate,
+		LastDataTime:     timePtr(m.last.lastData),
+		LastKeyframeTime: timePtr(m.last.lastKeyframe),
+		Frame:            m.last.frame,
+		Policy:           m.policy,
+		History:          append([]Transition{}, m.sm.history...),
+	}
+}
@@ -0,0 +1,35 @@
+package healthcheck
+
+import "github.com/bluenviron/mediamtx/internal/conf"
+
+// Policy contains the thresholds used to check the health of a path.
+// A zero duration or ratio disables the related probe.
+type Policy struct {
+	Interval          conf.Duration `json:"interval"`
+	NoDataTimeout     conf.Duration `json:"noDataTimeout"`
+	MinBitrateRatio   float64       `json:"minBitrateRatio"`
+	MinFrameRateRatio float64       `json:"minFrameRateRatio"`
+	MaxTimestampJump  conf.Duration `json:"maxTimestampJump"`
+	KeyframeTimeout   conf.Duration `json:"keyframeTimeout"`
+	FailureThreshold  int           `json:"failureThreshold"`
+	RecoveryThreshold int           `json:"recoveryThreshold"`
+
+	// capture devices are rebooted after failures of any probe,
+	// not only of the no data and snapshot probes
+	RebootOnSoftFailures bool `json:"rebootOnSoftFailures"`
+}
+
+// PolicyFromConf returns the policy of a path configuration.
+func PolicyFromConf(pathConf *conf.Path) Policy {
+	return Policy{
+		Interval:             pathConf.HealthCheckInterval,
+		NoDataTimeout:        pathConf.HealthNoDataTimeout,
+		MinBitrateRatio:      pathConf.HealthMinBitrateRatio,
+		MinFrameRateRatio:    pathConf.HealthMinFrameRateRatio,
+		MaxTimestampJump:     pathConf.HealthMaxTimestampJump,
+		KeyframeTimeout:      pathConf.HealthKeyframeTimeout,
+		FailureThreshold:     pathConf.HealthFailureThreshold,
+		RecoveryThreshold:    pathConf.HealthRecoveryThreshold,
+		RebootOnSoftFailures: pathConf.HealthRebootOnSoftFailures,
+	}
+}
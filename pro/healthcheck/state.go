@@ -0,0 +1,106 @@
+package healthcheck
+
+import "time"
+
+// maximum number of transitions kept for each path.
+const historySize = 50
+
+// State is the health state of a path.
+type State string
+
+// states.
+const (
+	StateUnknown   State = "unknown"   // no check has been performed yet
+	StateIdle      State = "idle"      // the path is not ready and is not expected to be
+	StateHealthy   State = "healthy"   // all probes pass
+	StateDegraded  State = "degraded"  // some probes fail, the failure threshold has not been reached
+	StateUnhealthy State = "unhealthy" // probes failed for the configured number of checks
+)
+
+// Transition is a change of state.
+type Transition struct {
+	From    State     `json:"from"`
+	To      State     `json:"to"`
+	Time    time.Time `json:"time"`
+	Reasons []string  `json:"reasons,omitempty"`
+}
+
+// stateMachine computes the state of a path from the results of consecutive checks.
+type stateMachine struct {
+	state     State
+	since     time.Time
+	failures  int // consecutive failed checks
+	successes int // consecutive successful checks
+	history   []Transition
+}
+
+func newStateMachine(now time.Time) *stateMachine {
+	return &stateMachine{
+		state: StateUnknown,
+		since: now,
+	}
+}
+
+// update applies the result of a check, where reasons are the failed probes,
+// and returns the transition, if any.
+func (sm *stateMachine) update(now time.Time, reasons []string, policy Policy) *Transition {
+	var next State
+
+	if len(reasons) != 0 {
+		sm.failures++
+		sm.successes = 0
+
+		// an unhealthy path stays unhealthy until it recovers
+		if sm.failures >= policy.FailureThreshold || sm.state == StateUnhealthy {
+			next = StateUnhealthy
+		} else {
+			next = StateDegraded
+		}
+	} else {
+		sm.successes++
+		sm.failures = 0
+
+		switch sm.state {
+		case StateDegraded, StateUnhealthy:
+			if sm.successes >= policy.RecoveryThreshold {
+				next = StateHealthy
+			} else {
+				next = sm.state
+			}
+
+		default:
+			next = StateHealthy
+		}
+	}
+
+	return sm.set(now, next, reasons)
+}
+
+// setIdle moves the state machine into the idle state, resetting counters.
+func (sm *stateMachine) setIdle(now time.Time) *Transition {
+	sm.failures = 0
+	sm.successes = 0
+	return sm.set(now, StateIdle, nil)
+}
+
+func (sm *stateMachine) set(now time.Time, next State, reasons []string) *Transition {
+	if next == sm.state {
+		return nil
+	}
+
+	t := Transition{
+		From:    sm.state,
+		To:      next,
+		Time:    now,
+		Reasons: reasons,
+	}
+
+	sm.state = next
+	sm.since = now
+	sm.history = append(sm.history, t)
+	if len(sm.history) > historySize {
+		sm.history = sm.history[len(sm.history)-historySize:]
+	}
+
+	return &t
+}
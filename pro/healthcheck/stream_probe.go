@@ -0,0 +1,127 @@
+package healthcheck
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+// streamSample contains what a streamProbe observed since the previous sample.
+type streamSample struct {
+	frames          int       // frames of the primary video track
+	discontinuities int       // timestamp jumps of any track
+	lastKeyframe    time.Time // zero if the primary video track has no detectable keyframes
+}
+
+// streamProbe is a passive stream reader that counts frames, keyframes and timestamp discontinuities.
+type streamProbe struct {
+	stream           *stream.Stream
+	maxTimestampJump time.Duration
+	parent           logger.Writer
+
+	reader       *stream.Reader
+	primaryForma format.Format
+	mutex        sync.Mutex
+	lastPTS      map[format.Format]int64
+	sample       streamSample
+}
+
+func (p *streamProbe) initialize(now time.Time) {
+	p.lastPTS = make(map[format.Format]int64)
+
+	p.reader = &stream.Reader{
+		SkipBytesSent: true,
+		Parent:        p.parent,
+	}
+
+	for _, media := range p.stream.Desc.Medias {
+		for _, forma := range media.Formats {
+			if p.primaryForma == nil && media.Type == description.MediaTypeVideo {
+				p.primaryForma = forma
+
+				switch forma.(type) {
+				case *format.H264, *format.H265:
+					// the grace period of the keyframe probe starts now
+					p.sample.lastKeyframe = now
+				}
+			}
+
+			cforma := forma
+			p.reader.OnData(media, forma, func(u *unit.Unit) error {
+				p.onUnit(cforma, u, time.Now())
+				return nil
+			})
+		}
+	}
+
+	p.stream.AddReader(p.reader)
+}
+
+func (p *streamProbe) close() {
+	p.stream.RemoveReader(p.reader)
+}
+
+func (p *streamProbe) isKeyframe(forma format.Format, u *unit.Unit) bool {
+	switch forma.(type) {
+	case *format.H264:
+		return h264.IsRandomAccess(u.Payload.(unit.PayloadH264))
+
+	case *format.H265:
+		return h265.IsRandomAccess(u.Payload.(unit.PayloadH265))
+	}
+	return false
+}
+
+func (p *streamProbe) onUnit(forma format.Format, u *unit.Unit, now time.Time) {
+	if u.NilPayload() {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.maxTimestampJump > 0 {
+		if last, ok := p.lastPTS[forma]; ok {
+			jump := time.Duration(u.PTS-last) * time.Second / time.Duration(forma.ClockRate())
+			if jump < 0 {
+				jump = -jump
+			}
+			if jump > p.maxTimestampJump {
+				p.sample.discontinuities++
+			}
+		}
+		p.lastPTS[forma] = u.PTS
+	}
+
+	if forma == p.primaryForma {
+		p.sample.frames++
+
+		if p.isKeyframe(forma, u) {
+			p.sample.lastKeyframe = now
+		}
+	}
+}
+
+// takeSample returns the sample and starts a new one.
+func (p *streamProbe) takeSample() streamSample {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	s := p.sample
+	p.sample.frames = 0
+	p.sample.discontinuities = 0
+	return s
+}
+
+// hasVideo returns whether the stream has a video track.
+func (p *streamProbe) hasVideo() bool {
+	return p.primaryForma != nil
+}
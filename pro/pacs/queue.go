@@ -0,0 +1,493 @@
+// Package pacs contains the queue that sends DICOM files to PACS.
+package pacs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/pro/dicom"
+	"github.com/bluenviron/mediamtx/pro/retryqueue"
+)
+
+// FileName is the name of the queue, in the record path.
+const FileName = "record_pacs_jobs.json"
+
+const (
+	// maxAttempts is the number of attempts before a job is marked as failed.
+	maxAttempts = 10
+
+	// finishedCount is the number of done and failed jobs kept for inspection.
+	finishedCount = 500
+
+	// sendTimeout is the timeout of an attempt, that sends all the files of a job.
+	sendTimeout = 10 * time.Minute
+)
+
+// Errors.
+var (
+	ErrJobNotFound         = errors.New("job not found")
+	ErrJobBusy             = errors.New("job is being sent or has been sent")
+	ErrDestinationNotFound = errors.New("destination not found")
+)
+
+// Status is the status of a job or of a file.
+type Status string
+
+// Statuses.
+const (
+	StatusPending Status = "pending"
+	StatusSending Status = "sending"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+// File is a file of a job.
+type File struct {
+	Path   string `json:"path"`   // relative to the record path
+	Status Status `json:"status"` // pending, done or failed
+	Error  string `json:"error,omitempty"`
+}
+
+// Job sends DICOM files to a destination.
+// Files that have been accepted by the destination are not sent again in the next attempts.
+type Job struct {
+	ID            string     `json:"id"`
+	Destination   string     `json:"destination"`
+	Files         []File     `json:"files"`
+	Status        Status     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	LastAttemptAt *time.Time `json:"lastAttemptAt,omitempty"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+}
+
+func (j *Job) clone() Job {
+	c := *j
+	c.Files = append([]File(nil), j.Files...)
+	return c
+}
+
+// backoff is the wait between attempts. It is longer than the one of webhooks,
+// since an attempt sends whole studies.
+var backoff = retryqueue.Backoff{Min: 10 * time.Second, Max: 30 * time.Minute}
+
+// storer sends files and returns an error for each file.
+type storer interface {
+	Store(ctx context.Context, paths []string) []error
+}
+
+// Queue sends DICOM files to the configured destinations.
+// Jobs are saved on disk and retried with exponential backoff,
+// therefore they survive PACS outages and restarts of the server.
+type Queue struct {
+	RecordPath   string
+	AETitle      string // calling AE title of C-STORE
+	Destinations conf.DICOMDestinations
+	OnUpdate     func(Job) // optional, called when the status of a job changes
+	Parent       logger.Writer
+
+	mutex     sync.Mutex
+	jobs      []*Job
+	client    *http.Client
+	ctx       context.Context
+	ctxCancel func()
+	wake      chan struct{}
+	done      chan struct{}
+}
+
+// Initialize initializes the Queue.
+func (q *Queue) Initialize() error {
+	q.client = &http.Client{
+		Timeout: sendTimeout,
+	}
+	q.ctx, q.ctxCancel = context.WithCancel(context.Background())
+	q.wake = make(chan struct{}, 1)
+	q.done = make(chan struct{})
+
+	err := q.load()
+	if err != nil {
+		q.ctxCancel()
+		return err
+	}
+
+	go q.run()
+
+	return nil
+}
+
+// Close closes the Queue. The attempt in progress is interrupted and repeated at the next start.
+func (q *Queue) Close() {
+	q.ctxCancel()
+	<-q.done
+}
+
+// Log implements logger.Writer.
+func (q *Queue) Log(level logger.Level, format string, args ...interface{}) {
+	q.Parent.Log(level, "[pacs] "+format, args...)
+}
+
+func (q *Queue) filePath() string {
+	return filepath.Join(q.RecordPath, FileName)
+}
+
+// Enqueue creates a job that sends files, given relative to the record path, to a destination.
+func (q *Queue) Enqueue(destination string, paths []string) (*Job, error) {
+	if _, ok := q.Destinations.Find(destination); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDestinationNotFound, destination)
+	}
+
+	now := time.Now()
+
+	j := &Job{
+		ID:            uuid.New().String(),
+		Destination:   destination,
+		Status:        StatusPending,
+		CreatedAt:     now,
+		NextAttemptAt: &now,
+	}
+	for _, p := range paths {
+		j.Files = append(j.Files, File{Path: p, Status: StatusPending})
+	}
+
+	q.mutex.Lock()
+	q.jobs = append(q.jobs, j)
+	q.save()
+	c := j.clone()
+	q.mutex.Unlock()
+
+	q.notify()
+
+	return &c, nil
+}
+
+// List returns the jobs with the given status (all jobs if empty), newest first.
+func (q *Queue) List(status Status) []Job {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	ret := []Job{}
+	for i := len(q.jobs) - 1; i >= 0; i-- {
+		if status == "" || q.jobs[i].Status == status {
+			ret = append(ret, q.jobs[i].clone())
+		}
+	}
+	return ret
+}
+
+// Get returns a job.
+func (q *Queue) Get(id string) (*Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, j := range q.jobs {
+		if j.ID == id {
+			c := j.clone()
+			return &c, nil
+		}
+	}
+	return nil, ErrJobNotFound
+}
+
+// Retry sends a failed job again, or a pending one without waiting for the next attempt.
+// Only the files that have not been accepted are sent.
+func (q *Queue) Retry(id string) (*Job, error) {
+	q.mutex.Lock()
+
+	var j *Job
+	for _, cur := range q.jobs {
+		if cur.ID == id {
+			j = cur
+			break
+		}
+	}
+	if j == nil {
+		q.mutex.Unlock()
+		return nil, ErrJobNotFound
+	}
+
+	if j.Status != StatusPending && j.Status != StatusFailed {
+		q.mutex.Unlock()
+		return nil, ErrJobBusy
+	}
+
+	if j.Status == StatusFailed {
+		j.Status = StatusPending
+		j.Attempts = 0
+		j.FinishedAt = nil
+		for i := range j.Files {
+			if j.Files[i].Status == StatusFailed {
+				j.Files[i].Status = StatusPending
+			}
+		}
+	}
+
+	now := time.Now()
+	j.NextAttemptAt = &now
+	q.save()
+	c := j.clone()
+
+	q.mutex.Unlock()
+
+	q.onUpdate(c)
+	q.notify()
+
+	return &c, nil
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) onUpdate(j Job) {
+	if q.OnUpdate != nil {
+		q.OnUpdate(j)
+	}
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-q.wake:
+		case <-q.ctx.Done():
+			return
+		}
+
+		q.sendDue()
+
+		timer.Reset(q.nextWait())
+	}
+}
+
+// nextWait returns the time until the next scheduled attempt.
+func (q *Queue) nextWait() time.Duration {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	wait := backoff.Max
+	for _, j := range q.jobs {
+		if j.Status == StatusPending && j.NextAttemptAt != nil {
+			if w := time.Until(*j.NextAttemptAt); w < wait {
+				wait = w
+			}
+		}
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// sendDue sends the jobs whose attempt is due, oldest first.
+func (q *Queue) sendDue() {
+	for {
+		q.mutex.Lock()
+		var due *Job
+		now := time.Now()
+		for _, j := range q.jobs {
+			if j.Status == StatusPending && j.NextAttemptAt != nil && !j.NextAttemptAt.After(now) {
+				due = j
+				break
+			}
+		}
+		if due == nil {
+			q.mutex.Unlock()
+			return
+		}
+		due.Status = StatusSending
+		c := due.clone()
+		dest, ok := q.Destinations.Find(due.Destination)
+		q.mutex.Unlock()
+
+		q.onUpdate(c)
+
+		var paths []string
+		var indexes []int
+		for i, f := range c.Files {
+			if f.Status == StatusPending {
+				paths = append(paths, filepath.Join(q.RecordPath, filepath.FromSlash(f.Path)))
+				indexes = append(indexes, i)
+			}
+		}
+
+		errs := make([]error, len(paths))
+		if ok {
+			errs = q.storer(dest).Store(q.ctx, paths)
+		} else {
+			for i := range errs {
+				errs[i] = fmt.Errorf("%w: %s", ErrDestinationNotFound, c.Destination)
+			}
+		}
+
+		// the server is shutting down, the attempt is repeated at the next start
+		if q.ctx.Err() != nil {
+			q.mutex.Lock()
+			due.Status = StatusPending
+			q.save()
+			q.mutex.Unlock()
+			return
+		}
+
+		q.mutex.Lock()
+		q.onAttempt(due, indexes, errs)
+		q.save()
+		c = due.clone()
+		q.mutex.Unlock()
+
+		q.onUpdate(c)
+	}
+}
+
+func (q *Queue) storer(dest conf.DICOMDestination) storer {
+	if dest.STOWRS() {
+		return &dicom.STOWClient{
+			URL:      dest.URL,
+			Username: dest.Username,
+			Password: dest.Password,
+			Client:   q.client,
+		}
+	}
+
+	return &dicom.StoreSCU{
+		Address:        net.JoinHostPort(dest.Host, strconv.Itoa(dest.Port)),
+		CallingAETitle: q.AETitle,
+		CalledAETitle:  dest.AETitle,
+		Timeout:        sendTimeout,
+	}
+}
+
+// onAttempt updates a job after an attempt. Must be called with the mutex held.
+func (q *Queue) onAttempt(j *Job, indexes []int, errs []error) {
+	now := time.Now()
+	j.Attempts++
+	j.LastAttemptAt = &now
+	j.LastError = ""
+
+	sent := 0
+	for k, i := range indexes {
+		if errs[k] == nil {
+			j.Files[i].Status = StatusDone
+			j.Files[i].Error = ""
+			sent++
+		} else {
+			j.Files[i].Error = errs[k].Error()
+			if j.LastError == "" {
+				j.LastError = errs[k].Error()
+			}
+		}
+	}
+
+	if sent == len(indexes) {
+		j.Status = StatusDone
+		j.NextAttemptAt = nil
+		j.FinishedAt = &now
+		q.Log(logger.Info, "job %s: %d files sent to %s (attempt %d)", j.ID, len(j.Files), j.Destination, j.Attempts)
+		return
+	}
+
+	if j.Attempts >= maxAttempts {
+		j.Status = StatusFailed
+		j.NextAttemptAt = nil
+		j.FinishedAt = &now
+		for _, i := range indexes {
+			if j.Files[i].Status == StatusPending {
+				j.Files[i].Status = StatusFailed
+			}
+		}
+		q.Log(logger.Error, "job %s to %s failed after %d attempts: %s", j.ID, j.Destination, j.Attempts, j.LastError)
+		return
+	}
+
+	j.Status = StatusPending
+	next := now.Add(backoff.Wait(j.Attempts))
+	j.NextAttemptAt = &next
+	q.Log(logger.Warn, "job %s to %s: %d/%d files failed (attempt %d/%d), retrying at %s: %s",
+		j.ID, j.Destination, len(indexes)-sent, len(indexes), j.Attempts, maxAttempts, next.Format(time.RFC3339), j.LastError)
+}
+
+func (q *Queue) load() error {
+	err := retryqueue.ReadJSON(q.filePath(), &q.jobs)
+	if err != nil {
+		return fmt.Errorf("failed to read PACS queue %s: %w", q.filePath(), err)
+	}
+
+	pending := 0
+	for _, j := range q.jobs {
+		// the server has been stopped during an attempt
+		if j.Status == StatusSending {
+			j.Status = StatusPending
+		}
+		if j.Status == StatusPending {
+			pending++
+		}
+	}
+	if pending != 0 {
+		q.Log(logger.Info, "%d pending jobs loaded from %s", pending, q.filePath())
+	}
+
+	return nil
+}
+
+// save trims the history and writes the queue to disk. Must be called with the mutex held.
+func (q *Queue) save() {
+	q.jobs = trim(q.jobs)
+
+	err := retryqueue.WriteJSON(q.filePath(), q.jobs)
+	if err != nil {
+		q.Log(logger.Error, "failed to write PACS queue %s: %v", q.filePath(), err)
+	}
+}
+
+// trim removes the oldest finished jobs. Pending jobs are always kept.
+func trim(jobs []*Job) []*Job {
+	finished := 0
+	for _, j := range jobs {
+		if j.Status == StatusDone || j.Status == StatusFailed {
+			finished++
+		}
+	}
+
+	if finished <= finishedCount {
+		return jobs
+	}
+
+	sorted := make([]*Job, len(jobs))
+	copy(sorted, jobs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+
+	ret := make([]*Job, 0, len(sorted))
+	for _, j := range sorted {
+		if (j.Status == StatusDone || j.Status == StatusFailed) && finished > finishedCount {
+			finished--
+			continue
+		}
+		ret = append(ret, j)
+	}
+
+	return ret
+}
@@ -0,0 +1,167 @@
+package pacs
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/pro/dicom"
+)
+
+func writeTestFile(t *testing.T, fpath string) {
+	var src bytes.Buffer
+	err := jpeg.Encode(&src, image.NewGray(image.Rect(0, 0, 16, 16)), nil)
+	require.NoError(t, err)
+
+	err = os.MkdirAll(filepath.Dir(fpath), 0o755)
+	require.NoError(t, err)
+
+	f, err := os.Create(fpath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = dicom.WriteImage(f, src.Bytes(), dicom.Metadata{PatientID: "P001"}, dicom.Options{})
+	require.NoError(t, err)
+}
+
+func TestQueue(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "20260301", "a.dcm"))
+	writeTestFile(t, filepath.Join(dir, "20260301", "b.dcm"))
+
+	var mutex sync.Mutex
+	requests := 0
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body) //nolint:errcheck
+
+		mutex.Lock()
+		requests++
+		n := requests
+		mutex.Unlock()
+
+		// the PACS is down at the first attempt
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer s.Close()
+
+	var updates []Job
+
+	q := &Queue{
+		RecordPath:   dir,
+		AETitle:      "MEDIAMTX",
+		Destinations: conf.DICOMDestinations{{Name: "pacs", URL: s.URL}},
+		OnUpdate: func(j Job) {
+			mutex.Lock()
+			updates = append(updates, j)
+			mutex.Unlock()
+		},
+		Parent: test.NilLogger,
+	}
+	err := q.Initialize()
+	require.NoError(t, err)
+	defer q.Close()
+
+	_, err = q.Enqueue("other", []string{"20260301/a.dcm"})
+	require.ErrorIs(t, err, ErrDestinationNotFound)
+
+	j, err := q.Enqueue("pacs", []string{"20260301/a.dcm", "20260301/b.dcm"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		j2, _ := q.Get(j.ID)
+		return j2.Attempts == 1 && j2.Status == StatusPending
+	}, 5*time.Second, 10*time.Millisecond)
+
+	j2, err := q.Get(j.ID)
+	require.NoError(t, err)
+	require.Equal(t, "STOW-RS failed with status 503", j2.LastError)
+	require.NotNil(t, j2.NextAttemptAt)
+
+	// retry without waiting for the backoff
+	_, err = q.Retry(j.ID)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		j2, _ = q.Get(j.ID)
+		return j2.Status == StatusDone
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.Equal(t, 2, j2.Attempts)
+	require.Empty(t, j2.LastError)
+	require.Equal(t, []File{
+		{Path: "20260301/a.dcm", Status: StatusDone},
+		{Path: "20260301/b.dcm", Status: StatusDone},
+	}, j2.Files)
+
+	_, err = q.Retry(j.ID)
+	require.ErrorIs(t, err, ErrJobBusy)
+
+	mutex.Lock()
+	require.Equal(t, StatusSending, updates[0].Status)
+	require.Equal(t, StatusDone, updates[len(updates)-1].Status)
+	mutex.Unlock()
+
+	// jobs are persisted
+	q.Close()
+
+	q = &Queue{
+		RecordPath:   dir,
+		Destinations: q.Destinations,
+		Parent:       test.NilLogger,
+	}
+	err = q.Initialize()
+	require.NoError(t, err)
+
+	jobs := q.List(StatusDone)
+	require.Len(t, jobs, 1)
+	require.Equal(t, j.ID, jobs[0].ID)
+}
+
+func TestQueuePartialFailure(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.dcm"))
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body) //nolint:errcheck
+	}))
+	defer s.Close()
+
+	q := &Queue{
+		RecordPath:   dir,
+		Destinations: conf.DICOMDestinations{{Name: "pacs", URL: s.URL}},
+		Parent:       test.NilLogger,
+	}
+	err := q.Initialize()
+	require.NoError(t, err)
+	defer q.Close()
+
+	// the missing file is retried, the other one is not sent again
+	j, err := q.Enqueue("pacs", []string{"a.dcm", "missing.dcm"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		j2, _ := q.Get(j.ID)
+		return j2.Attempts == 1 && j2.Status == StatusPending
+	}, 5*time.Second, 10*time.Millisecond)
+
+	j2, err := q.Get(j.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusDone, j2.Files[0].Status)
+	require.Equal(t, StatusPending, j2.Files[1].Status)
+	require.NotEmpty(t, j2.Files[1].Error)
+}
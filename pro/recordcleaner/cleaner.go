@@ -21,6 +21,7 @@ var datePattern = regexp.MustCompile(`^\d{8}$`)
 type Cleaner struct {
 	RecordPath string // Pro recorder root path
 	PathConfs  map[string]*conf.Path
+	OnRemove   func(folderPath string) // optional, called when a folder has been removed
 	Parent     logger.Writer
 
 	ctx       context.Context
@@ -146,6 +147,9 @@ func (c *Cleaner) doRun() {
 				c.Log(logger.Warn, "failed to remove folder %s: %v", folderName, err)
 			} else {
 				deletedCount++
+				if c.OnRemove != nil {
+					c.OnRemove(folderPath)
+				}
 			}
 		}
 	}
@@ -0,0 +1,117 @@
+package recorder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// bookmarksSuffix is appended to the path of a recording to obtain the path of its sidecar file.
+const bookmarksSuffix = ".bookmarks.json"
+
+// ErrBookmarkNotFound is returned when a bookmark doesn't exist.
+var ErrBookmarkNotFound = errors.New("bookmark not found")
+
+// Bookmark is a point of a recording marked while it was being written.
+type Bookmark struct {
+	ID        string          `json:"id"`
+	TaskID    string          `json:"taskId"`
+	PathName  string          `json:"pathName"`
+	FilePath  string          `json:"filePath"` // relative path of the recording
+	Offset    float64         `json:"offset"`   // media time in the recording, in seconds
+	Label     string          `json:"label"`
+	Data      json.RawMessage `json:"data,omitempty"` // free-form JSON provided by the client
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// bookmarkFile is the content of a sidecar file.
+type bookmarkFile struct {
+	FilePath  string     `json:"filePath"`
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+// BookmarksPath returns the path of the sidecar file of a recording.
+func BookmarksPath(fullPath string) string {
+	return fullPath + bookmarksSuffix
+}
+
+// ReadBookmarks reads the bookmarks of a recording, ordered by offset.
+// A recording without sidecar file has no bookmarks.
+func ReadBookmarks(fullPath string) ([]Bookmark, error) {
+	buf, err := os.ReadFile(BookmarksPath(fullPath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Bookmark{}, nil
+		}
+		return nil, err
+	}
+
+	var f bookmarkFile
+	err = json.Unmarshal(buf, &f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bookmark file: %w", err)
+	}
+
+	sortBookmarks(f.Bookmarks)
+	return f.Bookmarks, nil
+}
+
+// FindBookmark returns the bookmark of a recording with the given ID.
+func FindBookmark(fullPath string, id string) (*Bookmark, error) {
+	bookmarks, err := ReadBookmarks(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range bookmarks {
+		if bookmarks[i].ID == id {
+			return &bookmarks[i], nil
+		}
+	}
+
+	return nil, ErrBookmarkNotFound
+}
+
+// MoveBookmarks moves the sidecar file of a recording that has been renamed or moved.
+func MoveBookmarks(oldPath string, newPath string) error {
+	err := os.Rename(BookmarksPath(oldPath), BookmarksPath(newPath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// RemoveBookmarks removes the sidecar file of a recording that has been deleted.
+func RemoveBookmarks(fullPath string) error {
+	err := os.Remove(BookmarksPath(fullPath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ClipAround returns the interval of a recording that surrounds a bookmark.
+// The interval starts no earlier than the beginning of the recording.
+func (b *Bookmark) ClipAround(before time.Duration, after time.Duration) (float64, float64) {
+	start := b.Offset - before.Seconds()
+	if start < 0 {
+		start = 0
+	}
+	return start, b.Offset + after.Seconds()
+}
+
+func writeBookmarks(fullPath string, relativePath string, bookmarks []Bookmark) error {
+	return writeJSONFile(BookmarksPath(fullPath), &bookmarkFile{
+		FilePath:  relativePath,
+		Bookmarks: bookmarks,
+	})
+}
+
+func sortBookmarks(bookmarks []Bookmark) {
+	sort.SliceStable(bookmarks, func(i, j int) bool {
+		return bookmarks[i].Offset < bookmarks[j].Offset
+	})
+}
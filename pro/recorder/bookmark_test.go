@@ -0,0 +1,73 @@
+package recorder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookmarksReadWrite(t *testing.T) {
+	dir := t.TempDir()
+	fullPath := filepath.Join(dir, "a.mp4")
+
+	// a recording without sidecar file has no bookmarks
+	bookmarks, err := ReadBookmarks(fullPath)
+	require.NoError(t, err)
+	require.Empty(t, bookmarks)
+
+	created := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	err = writeBookmarks(fullPath, "/20260301/a.mp4", []Bookmark{
+		{ID: "2", FilePath: "/20260301/a.mp4", Offset: 75.5, Label: "lesion", CreatedAt: created},
+		{ID: "1", FilePath: "/20260301/a.mp4", Offset: 12, Label: "entry", Data: json.RawMessage(`{"organ":"stomach"}`), CreatedAt: created},
+	})
+	require.NoError(t, err)
+
+	bookmarks, err = ReadBookmarks(fullPath)
+	require.NoError(t, err)
+	require.Len(t, bookmarks, 2)
+	require.Equal(t, "1", bookmarks[0].ID)
+	require.JSONEq(t, `{"organ":"stomach"}`, string(bookmarks[0].Data))
+
+	b, err := FindBookmark(fullPath, "2")
+	require.NoError(t, err)
+	require.Equal(t, "lesion", b.Label)
+
+	_, err = FindBookmark(fullPath, "3")
+	require.ErrorIs(t, err, ErrBookmarkNotFound)
+
+	newPath := filepath.Join(dir, "b.mp4")
+	err = MoveBookmarks(fullPath, newPath)
+	require.NoError(t, err)
+
+	bookmarks, err = ReadBookmarks(newPath)
+	require.NoError(t, err)
+	require.Len(t, bookmarks, 2)
+
+	err = RemoveBookmarks(newPath)
+	require.NoError(t, err)
+
+	_, err = os.Stat(BookmarksPath(newPath))
+	require.True(t, os.IsNotExist(err))
+
+	// recordings without bookmarks can be moved and removed
+	require.NoError(t, MoveBookmarks(fullPath, newPath))
+	require.NoError(t, RemoveBookmarks(fullPath))
+}
+
+func TestBookmarkClipAround(t *testing.T) {
+	b := &Bookmark{Offset: 30}
+
+	start, end := b.ClipAround(10*time.Second, 5*time.Second)
+	require.Equal(t, 20.0, start)
+	require.Equal(t, 35.0, end)
+
+	// clips don't start before the recording
+	start, end = b.ClipAround(time.Minute, 5*time.Second)
+	require.Equal(t, 0.0, start)
+	require.Equal(t, 35.0, end)
+}
@@ -0,0 +1,100 @@
+package recorder
+
+import (
+	"time"
+)
+
+// types of RecordingEvent.
+const (
+	RecordingEventStart = "start"
+	RecordingEventStop  = "stop"
+	RecordingEventError = "error"
+)
+
+// reasons of the stop events.
+const (
+	stopReasonRequested = "stopped" // stopped by the API, a schedule or the shutdown of the server
+	stopReasonTimeout   = "timeout"
+	stopReasonFailed    = "failed" // the recorder couldn't be restarted
+)
+
+// RecordingEvent is a change of state of a recording task.
+// A task emits a start event each time its recorder starts writing a file,
+// an error event each time the recorder fails, and a stop event when it ends.
+type RecordingEvent struct {
+	Type     string    `json:"type"`
+	TaskID   string    `json:"taskId"`
+	PathName string    `json:"path"`
+	FileName string    `json:"fileName,omitempty"`
+	FilePath string    `json:"filePath,omitempty"`
+	Time     time.Time `json:"time"`
+	Reason   string    `json:"reason,omitempty"` // stop events only
+	Error    string    `json:"error,omitempty"`  // error events only
+}
+
+// SetEventHandler sets the callback that receives the events of the recording tasks.
+// It is called by the goroutines of the tasks and must not block.
+func (m *Manager) SetEventHandler(cb func(RecordingEvent)) {
+	m.eventMutex.Lock()
+	defer m.eventMutex.Unlock()
+
+	m.onEvent = cb
+}
+
+// onTaskEvent is called by tasks when their state changes.
+func (m *Manager) onTaskEvent(e RecordingEvent) {
+	m.eventMutex.Lock()
+	cb := m.onEvent
+	m.eventMutex.Unlock()
+
+	if cb != nil {
+		cb(e)
+	}
+}
+
+// RecordingEvents returns a start event for each running task.
+func (m *Manager) RecordingEvents() []RecordingEvent {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	ret := make([]RecordingEvent, 0, len(m.tasks))
+	for pathName, task := range m.tasks {
+		ret = append(ret, RecordingEvent{
+			Type:     RecordingEventStart,
+			TaskID:   task.ID,
+			PathName: pathName,
+			FileName: task.FileName,
+			FilePath: task.RelativePath,
+			Time:     task.StartTime,
+		})
+	}
+	return ret
+}
+
+func (t *Task) emitEvent(typ string, reason string, err error) {
+	e := RecordingEvent{
+		Type:     typ,
+		TaskID:   t.ID,
+		PathName: t.PathName,
+		FileName: t.FileName,
+		FilePath: t.RelativePath,
+		Time:     time.Now(),
+		Reason:   reason,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	t.Parent.onTaskEvent(e)
+}
+
+// stopReason returns why the task ended. It must be called after the end of the run loop.
+func (t *Task) stopReason() string {
+	switch {
+	case t.stopRequested:
+		return stopReasonRequested
+	case t.timedOut():
+		return stopReasonTimeout
+	default:
+		return stopReasonFailed
+	}
+}
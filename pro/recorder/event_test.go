@@ -0,0 +1,56 @@
+package recorder
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestRecordingEvents(t *testing.T) {
+	m := &Manager{Parent: test.NilLogger}
+
+	var events []RecordingEvent
+	m.SetEventHandler(func(e RecordingEvent) {
+		events = append(events, e)
+	})
+
+	task := &Task{
+		ID:           "1",
+		PathName:     "cam",
+		FileName:     "cam.mp4",
+		RelativePath: "cam/cam.mp4",
+		EndTime:      time.Now().Add(time.Hour),
+		Parent:       m,
+	}
+
+	task.emitEvent(RecordingEventStart, "", nil)
+	task.emitEvent(RecordingEventError, "", errors.New("path is not ready"))
+	task.emitEvent(RecordingEventStop, task.stopReason(), nil)
+
+	require.Len(t, events, 3)
+	require.Equal(t, RecordingEvent{
+		Type:     RecordingEventError,
+		TaskID:   "1",
+		PathName: "cam",
+		FileName: "cam.mp4",
+		FilePath: "cam/cam.mp4",
+		Time:     events[1].Time,
+		Error:    "path is not ready",
+	}, events[1])
+	require.Equal(t, stopReasonFailed, events[2].Reason)
+
+	task.EndTime = time.Now()
+	require.Equal(t, stopReasonTimeout, task.stopReason())
+
+	task.stopRequested = true
+	require.Equal(t, stopReasonRequested, task.stopReason())
+
+	// events are dropped when there's no handler
+	m.SetEventHandler(nil)
+	task.emitEvent(RecordingEventStart, "", nil)
+	require.Len(t, events, 3)
+}
@@ -0,0 +1,148 @@
+package recorder
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// journalFileName is the name of the task journal, in the record path.
+	journalFileName = "record_tasks.json"
+
+	// journalInterruptionCount is the number of interruptions kept in the journal.
+	journalInterruptionCount = 100
+)
+
+// journalEntry is a running task, as saved in the journal.
+type journalEntry struct {
+	ID              string           `json:"id"`
+	PathName        string           `json:"pathName"`
+	Format          string           `json:"format"`
+	CustomFileName  string           `json:"customFileName,omitempty"`
+	IsAutoRecord    bool             `json:"isAutoRecord,omitempty"`
+	ScheduleID      string           `json:"scheduleId,omitempty"`
+	SessionID       string           `json:"sessionId,omitempty"`
+	StartTime       time.Time        `json:"startTime"`
+	EndTime         time.Time        `json:"endTime"`
+	Paused          bool             `json:"paused,omitempty"`
+	PausedIntervals []PausedInterval `json:"pausedIntervals,omitempty"`
+	Files           []string         `json:"files"` // relative paths of the files written by the task, oldest first
+}
+
+// journalSession is an active recording session, as saved in the journal.
+type journalSession struct {
+	ID           string               `json:"id"`
+	Name         string               `json:"name,omitempty"`
+	Format       string               `json:"format"`
+	Paths        []string             `json:"paths"`
+	StartTime    time.Time            `json:"startTime"`
+	References   map[string]time.Time `json:"references,omitempty"` // start time in the clock of each path
+	ManifestPath string               `json:"manifestPath"`         // relative path of the manifest
+	Files        []SessionFile        `json:"files"`                // files of the session, oldest first
+}
+
+// TaskInterruption is a task that was running when the server stopped.
+type TaskInterruption struct {
+	TaskID        string    `json:"taskId"`
+	PathName      string    `json:"pathName"`
+	InterruptedAt time.Time `json:"interruptedAt"` // last time the task was known to be running
+	DetectedAt    time.Time `json:"detectedAt"`    // server start
+	Duration      float64   `json:"duration"`      // seconds not recorded because of the interruption
+	Resumed       bool      `json:"resumed"`
+	Reason        string    `json:"reason,omitempty"` // why the task was not resumed
+	PreviousFile  string    `json:"previousFile,omitempty"`
+	NewFile       string    `json:"newFile,omitempty"`
+}
+
+// taskJournal is the on-disk state of the running tasks.
+// It's rewritten when tasks change and periodically, therefore UpdatedAt
+// tells when the server was last seen running.
+type taskJournal struct {
+	UpdatedAt     time.Time          `json:"updatedAt"`
+	Tasks         []journalEntry     `json:"tasks"`
+	Sessions      []journalSession   `json:"sessions,omitempty"`
+	Interruptions []TaskInterruption `json:"interruptions"`
+}
+
+// readJournal reads the journal. A missing journal is empty.
+func readJournal(fullPath string) (*taskJournal, error) {
+	buf, err := os.ReadFile(fullPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &taskJournal{}, nil
+		}
+		return nil, err
+	}
+
+	var j taskJournal
+	err = json.Unmarshal(buf, &j)
+	if err != nil {
+		return nil, err
+	}
+
+	return &j, nil
+}
+
+// planResume decides whether a task found in the journal can be resumed.
+// Tasks are resumed until their original end time; the time during which
+// the server was stopped counts against it, except for paused tasks.
+func planResume(e journalEntry, lastSeen time.Time, now time.Time) TaskInterruption {
+	if lastSeen.IsZero() || lastSeen.Before(e.StartTime) {
+		lastSeen = e.StartTime
+	}
+
+	it := TaskInterruption{
+		TaskID:        e.ID,
+		PathName:      e.PathName,
+		InterruptedAt: lastSeen,
+		DetectedAt:    now,
+	}
+
+	if len(e.Files) != 0 {
+		it.PreviousFile = e.Files[len(e.Files)-1]
+	}
+
+	if !e.Paused && !now.Before(e.EndTime) {
+		it.Reason = "end time reached while the server was stopped"
+		if e.EndTime.After(lastSeen) {
+			it.Duration = e.EndTime.Sub(lastSeen).Seconds()
+		}
+		return it
+	}
+
+	it.Resumed = true
+	it.Duration = now.Sub(lastSeen).Seconds()
+	return it
+}
+
+// writeJSONFile writes a value to disk as JSON.
+// The file is replaced atomically, therefore readers never see a partial file.
+func writeJSONFile(fullPath string, v interface{}) error {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(fullPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := fullPath + ".tmp"
+
+	err = os.WriteFile(tmpPath, buf, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpPath, fullPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
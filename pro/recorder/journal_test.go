@@ -0,0 +1,161 @@
+package recorder
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestJournalReadWrite(t *testing.T) {
+	fullPath := filepath.Join(t.TempDir(), journalFileName)
+
+	// a missing journal is empty
+	j, err := readJournal(fullPath)
+	require.NoError(t, err)
+	require.Empty(t, j.Tasks)
+
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	pauseEnd := start.Add(5 * time.Minute)
+
+	j = &taskJournal{
+		UpdatedAt: start.Add(10 * time.Minute),
+		Tasks: []journalEntry{{
+			ID:        "task1",
+			PathName:  "cam1",
+			Format:    "mp4",
+			StartTime: start,
+			EndTime:   start.Add(30 * time.Minute),
+			PausedIntervals: []PausedInterval{
+				{Start: start.Add(4 * time.Minute), End: &pauseEnd},
+			},
+			Files: []string{"/20260301/a.mp4"},
+		}},
+		Interruptions: []TaskInterruption{},
+	}
+
+	err = writeJSONFile(fullPath, j)
+	require.NoError(t, err)
+
+	j2, err := readJournal(fullPath)
+	require.NoError(t, err)
+	require.Equal(t, j, j2)
+}
+
+func TestPlanResume(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	lastSeen := start.Add(10 * time.Minute)
+
+	e := journalEntry{
+		ID:        "task1",
+		PathName:  "cam1",
+		StartTime: start,
+		EndTime:   start.Add(30 * time.Minute),
+		Files:     []string{"/20260301/a.mp4", "/20260301/b.mp4"},
+	}
+
+	// restarted before the end time
+	it := planResume(e, lastSeen, start.Add(12*time.Minute))
+	require.True(t, it.Resumed)
+	require.Equal(t, lastSeen, it.InterruptedAt)
+	require.Equal(t, 120.0, it.Duration)
+	require.Equal(t, "/20260301/b.mp4", it.PreviousFile)
+
+	// restarted after the end time: the rest of the task is lost
+	it = planResume(e, lastSeen, start.Add(time.Hour))
+	require.False(t, it.Resumed)
+	require.NotEmpty(t, it.Reason)
+	require.Equal(t, 1200.0, it.Duration)
+
+	// paused tasks don't time out
+	e.Paused = true
+	it = planResume(e, lastSeen, start.Add(time.Hour))
+	require.True(t, it.Resumed)
+
+	// journal without heartbeat
+	it = planResume(e, time.Time{}, start.Add(time.Minute))
+	require.Equal(t, start, it.InterruptedAt)
+}
+
+func TestResumeSession(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-10 * time.Minute)
+	fileStart := start.Add(time.Second)
+
+	err := writeJSONFile(filepath.Join(dir, journalFileName), &taskJournal{
+		UpdatedAt: start.Add(5 * time.Minute),
+		Tasks: []journalEntry{
+			{
+				ID:        "task1",
+				PathName:  "cam1",
+				Format:    "mp4",
+				SessionID: "8f0c2a4e-session",
+				StartTime: start,
+				EndTime:   start.Add(30 * time.Minute),
+				Files:     []string{"/20260301/a.mp4"},
+			},
+			{
+				ID:        "task2",
+				PathName:  "cam2",
+				Format:    "mp4",
+				SessionID: "8f0c2a4e-session",
+				StartTime: start,
+				EndTime:   start.Add(time.Minute),
+				Files:     []string{"/20260301/b.mp4"},
+			},
+		},
+		Sessions: []journalSession{{
+			ID:           "8f0c2a4e-session",
+			Name:         "interview",
+			Format:       "mp4",
+			Paths:        []string{"cam1", "cam2"},
+			StartTime:    start,
+			ManifestPath: "/20260301/20260301-1000-session-8f0c2a4e.json",
+			Files: []SessionFile{
+				{PathName: "cam1", FileName: "a.mp4", FilePath: "/20260301/a.mp4", StartNTP: &fileStart},
+				{PathName: "cam2", FileName: "b.mp4", FilePath: "/20260301/b.mp4", StartNTP: &fileStart},
+			},
+		}},
+	})
+	require.NoError(t, err)
+
+	m := &Manager{
+		RecordPath:  dir,
+		PathManager: notReadyPathManager{},
+		Parent:      test.NilLogger,
+	}
+	err = m.Initialize()
+	require.NoError(t, err)
+	defer m.Close()
+
+	// the session is active again and contains the resumed task only
+	manifest, err := m.GetSession("8f0c2a4e-session")
+	require.NoError(t, err)
+	require.True(t, manifest.Active)
+	require.Equal(t, "interview", manifest.Name)
+	require.Equal(t, start.Unix(), manifest.StartTime.Unix())
+	require.Equal(t, []string{"a.mp4", "b.mp4"}, []string{manifest.Files[0].FileName, manifest.Files[1].FileName})
+
+	m.mutex.RLock()
+	s := m.sessions["8f0c2a4e-session"]
+	require.Len(t, s.tasks, 1)
+	require.Same(t, m.tasks["cam1"], s.tasks["cam1"])
+	m.mutex.RUnlock()
+
+	j, err := readJournal(filepath.Join(dir, journalFileName))
+	require.NoError(t, err)
+	require.Len(t, j.Sessions, 1)
+	require.Equal(t, "/20260301/20260301-1000-session-8f0c2a4e.json", j.Sessions[0].ManifestPath)
+
+	// the session ends with its last task
+	_, err = m.StopRecording("cam1")
+	require.NoError(t, err)
+
+	manifest, err = m.GetSession("8f0c2a4e-session")
+	require.NoError(t, err)
+	require.False(t, manifest.Active)
+	require.FileExists(t, filepath.Join(dir, "20260301", "20260301-1000-session-8f0c2a4e.json"))
+}
@@ -3,16 +3,20 @@ package recorder
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sync"
 	"time"
 
-	"github.com/bluenviron/gortsplib/v5/pkg/base"
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
-	"github.com/bluenviron/mediamtx/pro/deviceutil"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/pro/devicedriver"
+	"github.com/bluenviron/mediamtx/pro/framecheck"
+	"github.com/bluenviron/mediamtx/pro/webhook"
 	"github.com/google/uuid"
 )
 
@@ -24,15 +28,28 @@ type Manager struct {
 	PathConfs    map[string]*conf.Path // path configurations for auto recording
 	PathDefaults *conf.Path            // default path configuration (for webhooks)
 	PathManager  defs.APIPathManager
+	Webhooks     *webhook.Outbox       // delivers the record create webhook
+	OnFileClosed func(fullPath string) // optional, called when a recorder closes a file
 	Parent       logger.Writer
 	ColorChecker colorChecker // For smart recording
-
-	mutex     sync.RWMutex
-	tasks     map[string]*Task // key: pathName
-	baseURL   string           // cached base URL
-	ctx       context.Context
-	ctxCancel func()
-	wg        sync.WaitGroup
+	FrameChecker frameChecker // For smart recording, optional
+
+	mutex           sync.RWMutex
+	tasks           map[string]*Task          // key: pathName
+	preBuffers      map[string]*PreBuffer     // key: pathName
+	preBuffersMutex sync.Mutex                // separate from mutex, since tasks read buffers while the manager waits for them
+	schedules       map[string]*scheduleState // key: pathName/scheduleID
+	sessions        map[string]*session       // key: session ID
+	journalPath     string                    // on-disk journal of the running tasks
+	journalIdle     bool                      // the journal contains no tasks
+	interruptions   []TaskInterruption        // tasks interrupted by a restart of the server
+	baseURL         string                    // cached base URL
+	ctx             context.Context
+	ctxCancel       func()
+	wg              sync.WaitGroup
+
+	eventMutex sync.Mutex // separate from mutex, since tasks emit events while the manager waits for them
+	onEvent    func(RecordingEvent)
 }
 
 // colorChecker checks if the video has colorful content.
@@ -40,13 +57,24 @@ type colorChecker interface {
 	IsColorful(pathName string) (int, error)
 }
 
+// frameChecker returns whether the video is frozen, black or a solid color.
+type frameChecker interface {
+	Status(pathName string) (framecheck.Status, bool)
+}
+
 // Initialize initializes the Manager.
 func (m *Manager) Initialize() error {
 	m.tasks = make(map[string]*Task)
+	m.preBuffers = make(map[string]*PreBuffer)
+	m.schedules = make(map[string]*scheduleState)
+	m.sessions = make(map[string]*session)
 
-	// Build base URL for file access
+	// Build base URL for file access, used by the manifests of resumed sessions too
 	m.baseURL = conf.BuildAPIBaseURL(m.APIDomain, m.APIAddress)
 
+	m.syncSchedules()
+	m.resumeTasks()
+
 	// Create context for lifecycle management
 	m.ctx, m.ctxCancel = context.WithCancel(context.Background())
 
@@ -61,7 +89,7 @@ func (m *Manager) Initialize() error {
 }
 
 // InitializeSmartRecording initializes smart recording (called after API is ready).
-func (m *Manager) InitializeSmartRecording(colorChecker colorChecker) error {
+func (m *Manager) InitializeSmartRecording(colorChecker colorChecker, frameChecker frameChecker) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -70,6 +98,10 @@ func (m *Manager) InitializeSmartRecording(colorChecker colorChecker) error {
 		m.Log(logger.Info, "smart recording for network capture devices enabled")
 	}
 
+	if frameChecker != nil {
+		m.FrameChecker = frameChecker
+	}
+
 	return nil
 }
 
@@ -87,10 +119,27 @@ func (m *Manager) Close() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	// tasks are kept in the journal, in order to resume them at the next start
+	m.saveJournal()
+
 	for _, task := range m.tasks {
 		task.Stop()
 	}
 	m.tasks = nil
+
+	for _, s := range m.sessions {
+		if s.endTime == nil {
+			m.finishSession(s)
+		}
+	}
+
+	m.preBuffersMutex.Lock()
+	for _, b := range m.preBuffers {
+		b.Close()
+	}
+	m.preBuffers = nil
+	m.preBuffersMutex.Unlock()
+
 	m.Log(logger.Info, "recording manager closed")
 }
 
@@ -167,6 +216,7 @@ func (m *Manager) StartRecording(params *StartParams) (*StartResponse, error) {
 	}
 
 	m.tasks[params.Name] = task
+	m.saveJournal()
 
 	// Generate file URL using base URL
 	fileURL := m.baseURL + "/res" + task.RelativePath
@@ -211,18 +261,73 @@ func (m *Manager) StopRecording(pathName string) (*StopResponse, error) {
 
 	// Remove from map
 	delete(m.tasks, pathName)
+	m.onSessionTaskEnded(task)
+	m.saveJournal()
 
 	return response, nil
 }
 
+// PauseRecording pauses the recording task of a path.
+func (m *Manager) PauseRecording(pathName string) (*TaskStatus, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	task, exists := m.tasks[pathName]
+	if !exists {
+		return nil, fmt.Errorf("no recording task found for path: %s", pathName)
+	}
+
+	err := task.Pause()
+	if err != nil {
+		return nil, err
+	}
+	m.saveJournal()
+
+	return m.taskStatus(pathName, task), nil
+}
+
+// ResumeRecording resumes the paused recording task of a path.
+func (m *Manager) ResumeRecording(pathName string) (*TaskStatus, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	task, exists := m.tasks[pathName]
+	if !exists {
+		return nil, fmt.Errorf("no recording task found for path: %s", pathName)
+	}
+
+	err := task.Resume()
+	if err != nil {
+		return nil, err
+	}
+	m.saveJournal()
+
+	return m.taskStatus(pathName, task), nil
+}
+
+// AddBookmark marks the current media time of the recording of a path.
+func (m *Manager) AddBookmark(params *BookmarkParams) (*Bookmark, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	task, exists := m.tasks[params.Name]
+	if !exists {
+		return nil, fmt.Errorf("no recording task found for path: %s", params.Name)
+	}
+
+	return task.AddBookmark(params.Label, params.Data)
+}
+
 // OnTaskComplete is called when a task completes (timeout or error).
 func (m *Manager) OnTaskComplete(pathName string) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	if _, exists := m.tasks[pathName]; exists {
+	if task, exists := m.tasks[pathName]; exists {
 		m.Log(logger.Info, "task for path '%s' completed", pathName)
 		delete(m.tasks, pathName)
+		m.onSessionTaskEnded(task)
+		m.saveJournal()
 	}
 }
 
@@ -247,11 +352,44 @@ type StartResponse struct {
 	TaskEndTime time.Time `json:"taskEndTime"`
 }
 
-// StopParams contains parameters for stopping a recording.
+// TaskStatus is the status of a recording task.
+type TaskStatus struct {
+	ID                string    `json:"id"`
+	PathName          string    `json:"pathName"`
+	FileName          string    `json:"fileName"`
+	FilePath          string    `json:"filePath"`
+	Format            string    `json:"format"`
+	IsAutoRecord      bool      `json:"isAutoRecord"`
+	ScheduleID        string    `json:"scheduleId,omitempty"` // set when the task was started by a schedule rule
+	SessionID         string    `json:"sessionId,omitempty"`  // set when the task belongs to a recording session
+	IsRecording       bool      `json:"isRecording"`
+	TaskStartTime     time.Time `json:"taskStartTime"`
+	TaskEndTime       time.Time `json:"taskEndTime"`
+	PreBufferDuration float64   `json:"preBufferDuration"` // configured pre-event buffer, in seconds
+	PreBufferDepth    float64   `json:"preBufferDepth"`    // buffered content at the start of the file, in seconds
+
+	IsPaused        bool             `json:"isPaused"`
+	PausedIntervals []PausedInterval `json:"pausedIntervals"`
+	PausedDuration  float64          `json:"pausedDuration"` // total paused time, in seconds
+
+	PreviousFiles []string           `json:"previousFiles,omitempty"` // files written before a restart of the server
+	Interruptions []TaskInterruption `json:"interruptions,omitempty"` // restarts of the server during the task
+
+	Bookmarks []Bookmark `json:"bookmarks,omitempty"`
+}
+
+// StopParams contains parameters for stopping, pausing or resuming a recording.
 type StopParams struct {
 	Name string `json:"name" binding:"required"`
 }
 
+// BookmarkParams contains parameters for adding a bookmark to a recording.
+type BookmarkParams struct {
+	Name  string          `json:"name" binding:"required"`
+	Label string          `json:"label"`
+	Data  json.RawMessage `json:"data"` // free-form JSON
+}
+
 // StopResponse is the response for stop recording request.
 type StopResponse struct {
 	Success  bool   `json:"success"`
@@ -310,7 +448,10 @@ func (m *Manager) monitorAutoRecording() {
 			return
 
 		case <-ticker.C:
+			m.updatePreBuffers()
 			m.checkAndStartAutoRecording()
+			m.checkSchedules(time.Now())
+			m.updateJournal()
 		}
 	}
 }
@@ -338,8 +479,8 @@ func (m *Manager) checkAndStartAutoRecording() {
 			continue
 		}
 
-		// For network capture devices, check if colorful content is present
-		if pathConf.DeviceType == "network_capture" {
+		// For capture devices, check if colorful content is present
+		if _, ok := devicedriver.Get(pathConf.DeviceType); ok {
 			m.Log(logger.Info, "checking network capture device '%s' for colorful content", pathName)
 			if !m.shouldStartNetworkCaptureRecording(pathName, pathConf) {
 				continue
@@ -385,6 +526,15 @@ func (m *Manager) checkAndStartAutoRecording() {
 // shouldStartNetworkCaptureRecording checks if a network capture device should start recording.
 // It maintains state for each path to track colorful content over multiple checks.
 func (m *Manager) shouldStartNetworkCaptureRecording(pathName string, pathConf *conf.Path) bool {
+	// A frozen, black or solid color video means that the endoscope is not connected to the capture device
+	if m.FrameChecker != nil {
+		if status, ok := m.FrameChecker.Status(pathName); ok && status.Condition.Abnormal() {
+			m.Log(logger.Debug, "network capture device '%s' has %s video, skipping smart check", pathName, status.Condition)
+			m.getOrCreateCaptureState(pathName).reset()
+			return false
+		}
+	}
+
 	// Check if we have color checker available
 	if m.ColorChecker == nil {
 		m.Log(logger.Warn, "color checker not available for network capture device '%s', skipping smart check", pathName)
@@ -395,14 +545,14 @@ func (m *Manager) shouldStartNetworkCaptureRecording(pathName string, pathConf *
 	state := m.getOrCreateCaptureState(pathName)
 
 	// Check device status first
-	deviceIP, err := parseDeviceIP(pathConf.Source)
+	drv, dev, err := devicedriver.Open(pathConf.DeviceType, pathConf)
 	if err != nil {
-		m.Log(logger.Warn, "failed to parse device IP for '%s': %v", pathName, err)
+		m.Log(logger.Warn, "failed to find the device of '%s': %v", pathName, err)
 		return false
 	}
 
-	availableCount, err := deviceutil.GetInputStatusIsAvalible(deviceIP)
-	if err != nil || availableCount == 0 {
+	availableCount, err := drv.InputStatus(context.Background(), dev)
+	if !errors.Is(err, devicedriver.ErrNotSupported) && (err != nil || availableCount == 0) {
 		// Device not available, reset state
 		state.reset()
 		return false
@@ -469,29 +619,67 @@ func (m *Manager) getOrCreateCaptureState(pathName string) *captureState {
 	return state
 }
 
-// parseDeviceIP extracts device IP from source URL
-func parseDeviceIP(source string) (string, error) {
-	u, err := base.ParseURL(source)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse source URL: %w", err)
-	}
-
-	if u.Host == "" {
-		return "", fmt.Errorf("source URL has no host")
-	}
-
-	return u.Host, nil
-}
-
 // ReloadPathConfs reloads path configurations.
 func (m *Manager) ReloadPathConfs(pathConfs map[string]*conf.Path) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	m.PathConfs = pathConfs
+	m.syncSchedules()
+	m.saveJournal()
 	m.Log(logger.Info, "path configurations reloaded")
 }
 
+// GetTaskStatus returns the status of the recording task of a path.
+func (m *Manager) GetTaskStatus(pathName string) (*TaskStatus, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	task, exists := m.tasks[pathName]
+	if !exists {
+		return nil, fmt.Errorf("no recording task found for path: %s", pathName)
+	}
+
+	return m.taskStatus(pathName, task), nil
+}
+
+// taskStatus returns the status of a task. Must be called with the mutex held.
+func (m *Manager) taskStatus(pathName string, task *Task) *TaskStatus {
+	paused, intervals, pausedDuration := task.PauseState()
+
+	status := &TaskStatus{
+		ID:             task.ID,
+		PathName:       pathName,
+		FileName:       task.FileName,
+		FilePath:       task.RelativePath,
+		Format:         task.Format,
+		IsAutoRecord:   task.IsAutoRecord,
+		ScheduleID:     task.ScheduleID,
+		SessionID:      task.SessionID,
+		IsRecording:    true,
+		TaskStartTime:  task.StartTime,
+		TaskEndTime:    task.EndTime,
+		PreBufferDepth: task.PreBufferDepth.Seconds(),
+
+		IsPaused:        paused,
+		PausedIntervals: intervals,
+		PausedDuration:  pausedDuration.Seconds(),
+
+		PreviousFiles: task.PreviousFiles,
+		Interruptions: m.taskInterruptions(task.ID),
+
+		Bookmarks: task.Bookmarks(),
+	}
+
+	m.preBuffersMutex.Lock()
+	if b, ok := m.preBuffers[pathName]; ok {
+		status.PreBufferDuration = b.Duration.Seconds()
+	}
+	m.preBuffersMutex.Unlock()
+
+	return status
+}
+
 // GetRecordingStates returns the end time for all currently recording paths.
 func (m *Manager) GetRecordingStates() map[string]*time.Time {
 	m.mutex.RLock()
@@ -505,12 +693,39 @@ func (m *Manager) GetRecordingStates() map[string]*time.Time {
 	return states
 }
 
+// IsRecordingFile returns whether a file is being written by a recording task.
+func (m *Manager) IsRecordingFile(fullPath string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	absPath, err := filepath.Abs(fullPath)
+	if err != nil {
+		return false
+	}
+
+	for _, task := range m.tasks {
+		taskPath, err := filepath.Abs(task.FullPath)
+		if err == nil && taskPath == absPath {
+			return true
+		}
+	}
+	return false
+}
+
 // OnPathNotReady is called by pathManager when a path becomes not ready.
 // This is used to stop automatic recording tasks when the stream disconnects.
 func (m *Manager) OnPathNotReady(pathName string) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	// The stream is going away, the pre-event buffer is recreated when the path is ready again
+	m.preBuffersMutex.Lock()
+	if b, ok := m.preBuffers[pathName]; ok {
+		b.Close()
+		delete(m.preBuffers, pathName)
+	}
+	m.preBuffersMutex.Unlock()
+
 	task, exists := m.tasks[pathName]
 	if !exists {
 		return
@@ -524,6 +739,7 @@ func (m *Manager) OnPathNotReady(pathName string) {
 	m.Log(logger.Info, "path '%s' is no longer ready, stopping automatic recording", pathName)
 	task.Stop()
 	delete(m.tasks, pathName)
+	m.saveJournal()
 
 	// Reset capture state for network capture devices
 	captureStatesMutex.Lock()
@@ -532,3 +748,97 @@ func (m *Manager) OnPathNotReady(pathName string) {
 	}
 	captureStatesMutex.Unlock()
 }
+
+// updatePreBuffers creates or closes the pre-event buffers of paths, following their configuration.
+func (m *Manager) updatePreBuffers() {
+	// collect durations without holding the lock while querying the path manager
+	m.mutex.RLock()
+	durations := make(map[string]time.Duration)
+	for pathName, pathConf := range m.PathConfs {
+		if pathConf.RecordPreEventDuration > 0 {
+			durations[pathName] = time.Duration(pathConf.RecordPreEventDuration)
+		}
+	}
+	m.mutex.RUnlock()
+
+	streams := make(map[string]*stream.Stream)
+	for pathName := range durations {
+		pathData, err := m.PathManager.APIPathsGet(pathName)
+		if err != nil || !pathData.Ready {
+			continue
+		}
+
+		streamInterface, err := m.PathManager.GetStreamForRecording(pathName)
+		if err != nil {
+			continue
+		}
+
+		if streamObj, ok := streamInterface.(*stream.Stream); ok {
+			streams[pathName] = streamObj
+		}
+	}
+
+	m.preBuffersMutex.Lock()
+	defer m.preBuffersMutex.Unlock()
+
+	if m.preBuffers == nil {
+		return
+	}
+
+	// close buffers that are disabled, reconfigured or attached to an old stream
+	for pathName, b := range m.preBuffers {
+		if b.Duration != durations[pathName] || b.Stream != streams[pathName] {
+			b.Close()
+			delete(m.preBuffers, pathName)
+		}
+	}
+
+	for pathName, streamObj := range streams {
+		if _, ok := m.preBuffers[pathName]; ok {
+			continue
+		}
+
+		b := &PreBuffer{
+			Stream:   streamObj,
+			Duration: durations[pathName],
+			Parent:   m,
+		}
+		b.Initialize()
+		m.preBuffers[pathName] = b
+	}
+}
+
+// enqueueWebhook queues a webhook event for delivery.
+func (m *Manager) enqueueWebhook(event string, url string, payload interface{}) {
+	if m.Webhooks == nil {
+		m.Log(logger.Warn, "webhook outbox is not available, %s event to %s dropped", event, url)
+		return
+	}
+
+	d, err := m.Webhooks.Enqueue(event, url, payload)
+	if err != nil {
+		m.Log(logger.Error, "failed to queue %s webhook: %v", event, err)
+		return
+	}
+
+	m.Log(logger.Info, "%s webhook queued for %s (id %s)", event, url, d.ID)
+}
+
+// onFileClosed is called by tasks when a file has been written.
+func (m *Manager) onFileClosed(fullPath string) {
+	if m.OnFileClosed != nil {
+		m.OnFileClosed(fullPath)
+	}
+}
+
+// getPreBuffer returns the pre-event buffer of a path, if it is attached to the given stream.
+func (m *Manager) getPreBuffer(pathName string, s *stream.Stream) *PreBuffer {
+	m.preBuffersMutex.Lock()
+	defer m.preBuffersMutex.Unlock()
+
+	b, ok := m.preBuffers[pathName]
+	if !ok || b.Stream != s {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,198 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// errMoovNotLast is returned when the movie box is not at the end of the file,
+// as in fragmented files, therefore it can't be extended in place.
+var errMoovNotLast = errors.New("moov box is not at the end of the file")
+
+// mp4MaxChapters is the maximum number of chapters of a Nero chapter box.
+const mp4MaxChapters = 255
+
+// mp4BookmarksBox is the user data box that contains the bookmarks as JSON.
+const mp4BookmarksBox = "bkmk"
+
+type mp4BoxHeader struct {
+	offset     int64
+	size       int64 // 0 means that the box extends to the end of the file
+	headerSize int64
+	typ        string
+}
+
+// readMP4BoxHeaders returns the top-level boxes of a file.
+func readMP4BoxHeaders(f *os.File) ([]mp4BoxHeader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fileSize := fi.Size()
+
+	var boxes []mp4BoxHeader
+	offset := int64(0)
+
+	for offset < fileSize {
+		var buf [16]byte
+		_, err = f.ReadAt(buf[:8], offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read box header at %d: %w", offset, err)
+		}
+
+		h := mp4BoxHeader{
+			offset:     offset,
+			size:       int64(binary.BigEndian.Uint32(buf[:4])),
+			headerSize: 8,
+			typ:        string(buf[4:8]),
+		}
+
+		if h.size == 1 {
+			_, err = f.ReadAt(buf[8:16], offset+8)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read box header at %d: %w", offset, err)
+			}
+			h.size = int64(binary.BigEndian.Uint64(buf[8:16]))
+			h.headerSize = 16
+		}
+
+		boxes = append(boxes, h)
+
+		if h.size == 0 {
+			break
+		}
+		if h.size < h.headerSize {
+			return nil, fmt.Errorf("invalid size of box '%s' at %d", h.typ, offset)
+		}
+		offset += h.size
+	}
+
+	if offset > fileSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return boxes, nil
+}
+
+func mp4Box(typ string, payload []byte) []byte {
+	buf := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)))
+	copy(buf[4:], typ)
+	copy(buf[8:], payload)
+	return buf
+}
+
+// truncateUTF8 truncates a string to n bytes, without splitting characters.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// mp4BookmarksUserData returns a user data box that contains the bookmarks
+// as chapters (Nero 'chpl' box) and as JSON.
+func mp4BookmarksUserData(bookmarks []Bookmark) ([]byte, error) {
+	chapters := bookmarks
+	if len(chapters) > mp4MaxChapters {
+		chapters = chapters[:mp4MaxChapters]
+	}
+
+	var chpl bytes.Buffer
+	chpl.Write([]byte{1, 0, 0, 0}) // version 1, flags
+	chpl.Write([]byte{0, 0, 0, 0}) // reserved
+	chpl.WriteByte(byte(len(chapters)))
+
+	for _, b := range chapters {
+		var start [8]byte
+		binary.BigEndian.PutUint64(start[:], uint64(b.Offset*1e7)) // 100ns units
+		chpl.Write(start[:])
+
+		title := truncateUTF8(b.Label, 255)
+		chpl.WriteByte(byte(len(title)))
+		chpl.WriteString(title)
+	}
+
+	js, err := json.Marshal(bookmarks)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := append(mp4Box("chpl", chpl.Bytes()), mp4Box(mp4BookmarksBox, js)...)
+	return mp4Box("udta", payload), nil
+}
+
+// writeMP4Chapters appends the bookmarks to the movie box of a finalized MP4 file.
+// The movie box must be the last box of the file, as written by the standard (non-fragmented) muxer.
+func writeMP4Chapters(fullPath string, bookmarks []Bookmark) error {
+	if len(bookmarks) == 0 {
+		return nil
+	}
+
+	sorted := append([]Bookmark{}, bookmarks...)
+	sortBookmarks(sorted)
+
+	udta, err := mp4BookmarksUserData(sorted)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fullPath, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	boxes, err := readMP4BoxHeaders(f)
+	if err != nil {
+		return err
+	}
+
+	if len(boxes) == 0 || boxes[len(boxes)-1].typ != "moov" {
+		return errMoovNotLast
+	}
+	moov := boxes[len(boxes)-1]
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteAt(udta, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	// a box that extends to the end of the file doesn't need to be resized
+	if moov.size != 0 {
+		newSize := moov.size + int64(len(udta))
+
+		if moov.headerSize == 16 {
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], uint64(newSize))
+			_, err = f.WriteAt(buf[:], moov.offset+8)
+		} else {
+			if newSize > 0xFFFFFFFF {
+				f.Truncate(fi.Size()) //nolint:errcheck
+				return fmt.Errorf("moov box is too big")
+			}
+			var buf [4]byte
+			binary.BigEndian.PutUint32(buf[:], uint32(newSize))
+			_, err = f.WriteAt(buf[:], moov.offset)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return f.Sync()
+}
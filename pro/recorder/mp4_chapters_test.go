@@ -0,0 +1,89 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteMP4Chapters(t *testing.T) {
+	fullPath := filepath.Join(t.TempDir(), "a.mp4")
+
+	moov := mp4Box("moov", mp4Box("mvhd", make([]byte, 100)))
+	var file []byte
+	file = append(file, mp4Box("ftyp", []byte("isom\x00\x00\x02\x00"))...)
+	file = append(file, mp4Box("mdat", make([]byte, 1000))...)
+	file = append(file, moov...)
+
+	err := os.WriteFile(fullPath, file, 0644)
+	require.NoError(t, err)
+
+	err = writeMP4Chapters(fullPath, []Bookmark{
+		{ID: "2", Offset: 75.5, Label: "lesion"},
+		{ID: "1", Offset: 12, Label: "entry"},
+	})
+	require.NoError(t, err)
+
+	f, err := os.Open(fullPath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	boxes, err := readMP4BoxHeaders(f)
+	require.NoError(t, err)
+	require.Len(t, boxes, 3)
+	require.Equal(t, "moov", boxes[2].typ)
+
+	buf, err := os.ReadFile(fullPath)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(buf)), boxes[2].offset+boxes[2].size)
+
+	// moov contains mvhd and udta, udta contains chpl and the bookmarks
+	udta := buf[int(boxes[2].offset)+len(moov):]
+	require.Equal(t, "udta", string(udta[4:8]))
+
+	chpl := udta[8:]
+	chplSize := int(binary.BigEndian.Uint32(chpl))
+	require.Equal(t, "chpl", string(chpl[4:8]))
+	require.Equal(t, byte(2), chpl[16])
+
+	// chapters are ordered by offset, in 100ns units
+	require.Equal(t, uint64(12e7), binary.BigEndian.Uint64(chpl[17:25]))
+	require.Equal(t, byte(len("entry")), chpl[25])
+	require.Equal(t, "entry", string(chpl[26:31]))
+	require.Equal(t, uint64(75.5e7), binary.BigEndian.Uint64(chpl[31:39]))
+
+	bkmk := chpl[chplSize:]
+	require.Equal(t, mp4BookmarksBox, string(bkmk[4:8]))
+	require.True(t, bytes.Contains(bkmk, []byte(`"label":"lesion"`)))
+}
+
+func TestWriteMP4ChaptersFragmented(t *testing.T) {
+	fullPath := filepath.Join(t.TempDir(), "a.mp4")
+
+	var file []byte
+	file = append(file, mp4Box("ftyp", []byte("isom\x00\x00\x02\x00"))...)
+	file = append(file, mp4Box("moov", make([]byte, 100))...)
+	file = append(file, mp4Box("moof", make([]byte, 50))...)
+	file = append(file, mp4Box("mdat", make([]byte, 1000))...)
+
+	err := os.WriteFile(fullPath, file, 0644)
+	require.NoError(t, err)
+
+	err = writeMP4Chapters(fullPath, []Bookmark{{ID: "1", Offset: 12, Label: "entry"}})
+	require.ErrorIs(t, err, errMoovNotLast)
+
+	// the file is left untouched
+	buf, err := os.ReadFile(fullPath)
+	require.NoError(t, err)
+	require.Equal(t, file, buf)
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	require.Equal(t, "abc", truncateUTF8("abc", 5))
+	require.Equal(t, "ab", truncateUTF8("abc", 2))
+	require.Equal(t, "病", truncateUTF8("病灶", 4))
+}
@@ -5,34 +5,58 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/bluenviron/gortsplib/v5/pkg/description"
 	"github.com/bluenviron/gortsplib/v5/pkg/format"
 	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
 	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/opus"
 	"github.com/yapingcat/gomedia/go-mp4"
 
 	"github.com/bluenviron/mediamtx/internal/codecprocessor"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/stream"
 	"github.com/bluenviron/mediamtx/internal/unit"
+	"github.com/bluenviron/mediamtx/pro/recordrepair"
 )
 
+// mp4FragmentDuration is the minimum duration of a fragment in fragmented mode.
+// Fragments start at keyframes, therefore the actual duration depends on the GOP size.
+const mp4FragmentDuration = 2 * time.Second
+
 // MP4Recorder records stream to standard MP4 format using gomedia library.
 type MP4Recorder struct {
-	Stream   *stream.Stream
-	FilePath string
-	Parent   logger.Writer
-	ErrorCh  chan<- error // 错误通道，用于通知外部录制错误
+	Stream     *stream.Stream
+	PreBuffer  *PreBuffer // optional, the file starts at the oldest buffered keyframe
+	FilePath   string
+	Fragmented bool      // 分片写入：崩溃或断电后文件仍可播放，最多丢失最后一个分片
+	NotBefore  time.Time // optional, the file starts at the first keyframe at or after this NTP time
+	Parent     logger.Writer
+	ErrorCh    chan<- error // 错误通道，用于通知外部录制错误
 
 	file         *os.File
 	muxer        *mp4.Movmuxer
-	reader       *stream.Reader
+	source       *unitSource
 	videoTrack   uint32
 	hasVideo     bool
 	initialized  bool
 	mutex        sync.Mutex
 	dtsExtractor interface{}
+	audioTracks  []*mp4AudioTrack
+
+	// audio/video alignment
+	waitVideo bool          // stream has a video track, audio is dropped until its first keyframe
+	started   bool          // first sample has been written
+	startDTS  time.Duration // timestamp of the first sample, subtracted from every track
+	firstNTP  time.Time     // NTP timestamp of the first sample
+	position  time.Duration // media time of the last written sample
+
+	lastFragment time.Duration // timestamp of the last fragment, in fragmented mode
+
+	pause pauseTimeline
 
 	terminate chan struct{}
 	done      chan struct{}
@@ -55,34 +79,68 @@ func (r *MP4Recorder) Initialize() error {
 	r.file = file
 
 	// Create MP4 muxer
-	muxer, err := mp4.CreateMp4Muxer(file)
+	var muxerOptions []mp4.MuxerOption
+	if r.Fragmented {
+		muxerOptions = append(muxerOptions, mp4.WithMp4Flag(mp4.MP4_FLAG_FRAGMENT))
+	}
+
+	muxer, err := mp4.CreateMp4Muxer(file, muxerOptions...)
 	if err != nil {
 		file.Close()
 		return fmt.Errorf("failed to create MP4 muxer: %w", err)
 	}
 	r.muxer = muxer
 
-	// Create stream reader
-	r.reader = &stream.Reader{
-		SkipBytesSent: true,
-		Parent:        r,
+	// Create unit source (stream reader or pre-event buffer)
+	r.source = &unitSource{
+		Stream:    r.Stream,
+		PreBuffer: r.PreBuffer,
+		NotBefore: r.NotBefore,
+		Parent:    r,
 	}
 
 	// Setup callbacks for each media/format in the stream
+	trackCount := 0
 	for _, media := range r.Stream.Desc.Medias {
 		for _, forma := range media.Formats {
-			r.setupTrack(media, forma)
+			if r.setupTrack(media, forma) {
+				trackCount++
+			} else {
+				r.Log(logger.Warn, "skipping track with unsupported codec %s", forma.Codec())
+			}
 		}
 	}
 
-	// Add reader to stream
-	r.Stream.AddReader(r.reader)
+	if trackCount == 0 {
+		file.Close()
+		os.Remove(r.FilePath)
+		return fmt.Errorf("the stream doesn't contain any supported codec")
+	}
+
+	err = r.writeTracksHint()
+	if err != nil {
+		file.Close()
+		os.Remove(r.FilePath)
+		return err
+	}
+
+	// Start reading
+	err = r.source.start()
+	if err != nil {
+		file.Close()
+		os.Remove(r.FilePath)
+		return err
+	}
 
 	r.terminate = make(chan struct{})
 	r.done = make(chan struct{})
 	r.initialized = true
 
-	r.Log(logger.Info, "MP4 recorder initialized for %s", r.FilePath)
+	if r.Fragmented {
+		r.Log(logger.Info, "MP4 recorder initialized for %s (fragmented)", r.FilePath)
+	} else {
+		r.Log(logger.Info, "MP4 recorder initialized for %s", r.FilePath)
+	}
 
 	go r.run()
 
@@ -101,14 +159,12 @@ func (r *MP4Recorder) Close() {
 	close(r.terminate)
 	<-r.done
 
+	// Stop reading before locking, since callbacks lock the mutex too
+	r.source.stop()
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	// Remove reader from stream
-	if r.Stream != nil && r.reader != nil {
-		r.Stream.RemoveReader(r.reader)
-	}
-
 	// Write MP4 trailer
 	if r.muxer != nil {
 		r.muxer.WriteTrailer()
@@ -123,6 +179,61 @@ func (r *MP4Recorder) Close() {
 	r.Log(logger.Info, "MP4 recorder closed for %s", r.FilePath)
 }
 
+// Pause stops writing samples, keeping the file open.
+// It can be called before Initialize, in order to start the recorder paused.
+func (r *MP4Recorder) Pause() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.pause.pause()
+
+	// in fragmented mode, the samples written before the pause are flushed to disk
+	if r.Fragmented && r.started {
+		err := r.muxer.FlushFragment()
+		if err == nil {
+			err = r.file.Sync()
+		}
+		if err != nil {
+			r.Log(logger.Warn, "failed to flush fragment: %v", err)
+		}
+	}
+}
+
+// Resume resumes writing samples, starting from the next keyframe.
+// The paused interval is removed from the timeline of the file.
+func (r *MP4Recorder) Resume() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.pause.resume()
+}
+
+// FirstNTP returns the NTP timestamp of the first sample of the file,
+// or a zero time if nothing has been written yet.
+func (r *MP4Recorder) FirstNTP() time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.firstNTP
+}
+
+// Position returns the media time of the last sample written into the file.
+func (r *MP4Recorder) Position() time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.position
+}
+
+// Metadata returns the metadata of the file, without the path name,
+// or nil if nothing has been written yet.
+func (r *MP4Recorder) Metadata() *recordstore.Metadata {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return fileMetadata(r.firstNTP, r.startDTS, r.position, r.pause.parts)
+}
+
 // Log implements logger.Writer.
 func (r *MP4Recorder) Log(level logger.Level, format string, args ...interface{}) {
 	r.Parent.Log(level, "[mp4-recorder] "+format, args...)
@@ -132,7 +243,7 @@ func (r *MP4Recorder) run() {
 	defer close(r.done)
 
 	select {
-	case err := <-r.reader.Error():
+	case err := <-r.source.Error():
 		r.Log(logger.Error, "reader error: %v", err)
 		// 通知外部发生了错误
 		if r.ErrorCh != nil {
@@ -146,7 +257,9 @@ func (r *MP4Recorder) run() {
 	}
 }
 
-func (r *MP4Recorder) setupTrack(media *description.Media, forma format.Format) {
+// setupTrack registers the reader callback of a format.
+// It returns false when the format can't be muxed into MP4.
+func (r *MP4Recorder) setupTrack(media *description.Media, forma format.Format) bool {
 	switch forma := forma.(type) {
 	case *format.H264:
 		sps, pps := forma.SafeParams()
@@ -155,7 +268,9 @@ func (r *MP4Recorder) setupTrack(media *description.Media, forma format.Format)
 			pps = codecprocessor.H264DefaultPPS
 		}
 
-		r.reader.OnData(media, forma, r.onH264)
+		r.waitVideo = true
+		r.source.OnData(media, forma, r.onH264)
+		return true
 
 	case *format.H265:
 		vps, sps, pps := forma.SafeParams()
@@ -165,8 +280,314 @@ func (r *MP4Recorder) setupTrack(media *description.Media, forma format.Format)
 			pps = codecprocessor.H265DefaultPPS
 		}
 
-		r.reader.OnData(media, forma, r.onH265)
+		r.waitVideo = true
+		r.source.OnData(media, forma, r.onH265)
+		return true
+
+	case *format.MPEG4Audio:
+		if forma.Config == nil {
+			return false
+		}
+
+		config := forma.Config
+		configBytes, err := config.Marshal()
+		if err != nil {
+			return false
+		}
+
+		clockRate := forma.ClockRate()
+		track := r.addAudioTrack(mp4.MP4_CODEC_AAC,
+			recordrepair.HintTrack{
+				Codec:        recordrepair.HintCodecAAC,
+				SampleRate:   config.SampleRate,
+				ChannelCount: config.ChannelCount,
+				Config:       configBytes,
+			},
+			mp4.WithAudioSampleRate(uint32(config.SampleRate)),
+			mp4.WithAudioChannelCount(uint8(config.ChannelCount)))
+
+		r.source.OnData(media, forma, func(u *unit.Unit) error {
+			if u.NilPayload() {
+				return nil
+			}
+
+			for i, au := range u.Payload.(unit.PayloadMPEG4Audio) {
+				pts := u.PTS + int64(i)*mpeg4audio.SamplesPerAccessUnit
+
+				frame, err := adtsFrame(config, au)
+				if err != nil {
+					return err
+				}
+
+				ntp := addToNTP(u.NTP, timestampToDuration(pts-u.PTS, clockRate))
+
+				err = r.writeAudio(track, frame, timestampToDuration(pts, clockRate), ntp)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		return true
+
+	case *format.Opus:
+		// channel mapping family 0 is valid for mono and stereo only, while the muxer
+		// can't write the mapping table of family 1, therefore multichannel Opus is skipped.
+		if forma.ChannelCount > 2 {
+			return false
+		}
+
+		clockRate := forma.ClockRate()
+		head := opusHead(forma.ChannelCount)
+		track := r.addAudioTrack(mp4.MP4_CODEC_OPUS,
+			recordrepair.HintTrack{
+				Codec:        recordrepair.HintCodecOpus,
+				SampleRate:   48000,
+				ChannelCount: forma.ChannelCount,
+				Config:       head,
+			},
+			mp4.WithAudioSampleRate(48000),
+			mp4.WithAudioChannelCount(uint8(forma.ChannelCount)),
+			mp4.WithExtraData(head))
+
+		r.source.OnData(media, forma, func(u *unit.Unit) error {
+			if u.NilPayload() {
+				return nil
+			}
+
+			pts := u.PTS
+
+			for _, packet := range u.Payload.(unit.PayloadOpus) {
+				ntp := addToNTP(u.NTP, timestampToDuration(pts-u.PTS, clockRate))
+
+				err := r.writeAudio(track, packet, timestampToDuration(pts, clockRate), ntp)
+				if err != nil {
+					return err
+				}
+
+				pts += opus.PacketDuration2(packet)
+			}
+
+			return nil
+		})
+		return true
+
+	case *format.G711:
+		codec := mp4.MP4_CODEC_G711A
+		hintCodec := recordrepair.HintCodecG711A
+		if forma.MULaw {
+			codec = mp4.MP4_CODEC_G711U
+			hintCodec = recordrepair.HintCodecG711U
+		}
+
+		clockRate := forma.ClockRate()
+		track := r.addAudioTrack(codec,
+			recordrepair.HintTrack{
+				Codec:        hintCodec,
+				SampleRate:   forma.SampleRate,
+				ChannelCount: forma.ChannelCount,
+			},
+			mp4.WithAudioSampleRate(uint32(forma.SampleRate)),
+			mp4.WithAudioChannelCount(uint8(forma.ChannelCount)))
+
+		r.source.OnData(media, forma, func(u *unit.Unit) error {
+			if u.NilPayload() {
+				return nil
+			}
+
+			return r.writeAudio(track, u.Payload.(unit.PayloadG711), timestampToDuration(u.PTS, clockRate), u.NTP)
+		})
+		return true
+
+	case *format.LPCM:
+		// the MP4 muxer has no raw PCM sample entry, therefore 16-bit LPCM is stored as G711 µ-law.
+		if forma.BitDepth != 16 {
+			return false
+		}
+
+		clockRate := forma.ClockRate()
+		track := r.addAudioTrack(mp4.MP4_CODEC_G711U,
+			recordrepair.HintTrack{
+				Codec:        recordrepair.HintCodecG711U,
+				SampleRate:   forma.SampleRate,
+				ChannelCount: forma.ChannelCount,
+			},
+			mp4.WithAudioSampleRate(uint32(forma.SampleRate)),
+			mp4.WithAudioChannelCount(uint8(forma.ChannelCount)))
+
+		r.source.OnData(media, forma, func(u *unit.Unit) error {
+			if u.NilPayload() {
+				return nil
+			}
+
+			return r.writeAudio(track, lpcmToMulaw(u.Payload.(unit.PayloadLPCM)),
+				timestampToDuration(u.PTS, clockRate), u.NTP)
+		})
+		return true
+	}
+
+	return false
+}
+
+func (r *MP4Recorder) addAudioTrack(
+	codec mp4.MP4_CODEC_TYPE,
+	hint recordrepair.HintTrack,
+	options ...mp4.TrackOption,
+) *mp4AudioTrack {
+	track := &mp4AudioTrack{
+		codec:   codec,
+		options: options,
+		hint:    hint,
+		index:   len(r.audioTracks),
+	}
+	r.audioTracks = append(r.audioTracks, track)
+	return track
+}
+
+// writeTracksHint writes the description of audio tracks at the beginning of the sample data
+// of non-fragmented files, in order to allow to repair them after a crash.
+func (r *MP4Recorder) writeTracksHint() error {
+	if r.Fragmented || len(r.audioTracks) == 0 {
+		return nil
+	}
+
+	tracks := make([]recordrepair.HintTrack, len(r.audioTracks))
+	for i, track := range r.audioTracks {
+		tracks[i] = track.hint
+	}
+
+	hint, err := recordrepair.TracksHint(tracks)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.file.Write(hint)
+	if err != nil {
+		return fmt.Errorf("failed to write recovery hint: %w", err)
+	}
+	return nil
+}
+
+// start sets the timeline origin of the file. Must be called with the mutex held.
+func (r *MP4Recorder) start(dts time.Duration, ntp time.Time) {
+	r.started = true
+	r.startDTS = dts
+	r.firstNTP = ntp
+	r.lastFragment = dts
+
+	// in fragmented mode the track list is written with the first fragment,
+	// therefore audio tracks can't be added later.
+	if r.Fragmented {
+		for _, track := range r.audioTracks {
+			r.addToMuxer(track)
+		}
+	}
+}
+
+func (r *MP4Recorder) addToMuxer(track *mp4AudioTrack) {
+	if !track.added {
+		track.id = r.muxer.AddAudioTrack(track.codec, track.options...)
+		track.added = true
+	}
+}
+
+// flushFragment writes pending samples into a fragment and syncs the file to disk,
+// in order to limit the data lost by a crash to the last fragment. Must be called with the mutex held.
+func (r *MP4Recorder) flushFragment(dts time.Duration) error {
+	if !r.Fragmented || (dts-r.lastFragment) < mp4FragmentDuration {
+		return nil
+	}
+	r.lastFragment = dts
+
+	err := r.muxer.FlushFragment()
+	if err != nil {
+		return fmt.Errorf("failed to flush fragment: %w", err)
 	}
+
+	return r.file.Sync()
+}
+
+// toMilliseconds converts a stream timestamp into a timestamp of the file.
+func (r *MP4Recorder) toMilliseconds(v time.Duration) uint64 {
+	return uint64((v - r.startDTS) / time.Millisecond)
+}
+
+// advance updates the media time of the file after a sample has been written. Must be called with the mutex held.
+func (r *MP4Recorder) advance(v time.Duration) {
+	if v-r.startDTS > r.position {
+		r.position = v - r.startDTS
+	}
+}
+
+func (r *MP4Recorder) writeAudio(track *mp4AudioTrack, frame []byte, pts time.Duration, ntp time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.waitVideo {
+		if !r.pause.otherSample(pts) {
+			return nil
+		}
+	} else if !r.pause.mainSample(pts, ntp, true) {
+		return nil
+	}
+	pts -= r.pause.offset
+
+	if !r.started {
+		// audio is written only after the first video keyframe, in order to start the file with a keyframe.
+		if r.waitVideo {
+			return nil
+		}
+		r.start(pts, ntp)
+	}
+
+	// drop samples that precede the start of the file
+	if pts < r.startDTS {
+		return nil
+	}
+
+	r.addToMuxer(track)
+
+	// audio-only streams have no keyframes, fragments are cut at any sample
+	if !r.waitVideo {
+		err := r.flushFragment(pts)
+		if err != nil {
+			return err
+		}
+	}
+
+	ts := r.toMilliseconds(pts)
+
+	// after a pause, audio may overlap with the last samples written before it
+	if track.written && ts < track.lastTS {
+		return nil
+	}
+
+	// in non-fragmented mode, audio samples can't be told apart from video samples
+	// when the index is missing, therefore each of them is preceded by a hint.
+	if !r.Fragmented {
+		size := len(frame)
+		if track.codec == mp4.MP4_CODEC_AAC {
+			size -= 7 // the muxer strips the ADTS header
+		}
+
+		_, err := r.file.Write(recordrepair.SampleHint(track.index, ts, size))
+		if err != nil {
+			return fmt.Errorf("failed to write recovery hint: %w", err)
+		}
+	}
+
+	err := r.muxer.Write(track.id, frame, ts, ts)
+	if err != nil {
+		r.Log(logger.Error, "failed to write audio: %v", err)
+		return err
+	}
+
+	track.written = true
+	track.lastTS = ts
+	r.advance(pts)
+
+	return nil
 }
 
 func (r *MP4Recorder) onH264(u *unit.Unit) error {
@@ -178,19 +599,10 @@ func (r *MP4Recorder) onH264(u *unit.Unit) error {
 	defer r.mutex.Unlock()
 
 	nalus := u.Payload.(unit.PayloadH264)
+	randomAccess := h264.IsRandomAccess(nalus)
 
 	// Check if we need to initialize DTS extractor
 	if r.dtsExtractor == nil {
-		// Check for IDR frame
-		randomAccess := false
-		for _, nalu := range nalus {
-			typ := h264.NALUType(nalu[0] & 0x1F)
-			if typ == h264.NALUTypeIDR {
-				randomAccess = true
-				break
-			}
-		}
-
 		if !randomAccess {
 			return nil
 		}
@@ -206,12 +618,33 @@ func (r *MP4Recorder) onH264(u *unit.Unit) error {
 		return err
 	}
 
+	dtsDuration := timestampToDuration(dts, 90000)
+	ptsDuration := timestampToDuration(u.PTS, 90000)
+
+	if !r.pause.mainSample(dtsDuration, u.NTP, randomAccess) {
+		return nil
+	}
+	dtsDuration -= r.pause.offset
+	ptsDuration -= r.pause.offset
+
+	if !r.started {
+		r.start(dtsDuration, u.NTP)
+	}
+
 	// Add video track if not added yet
 	if !r.hasVideo {
 		r.videoTrack = r.muxer.AddVideoTrack(mp4.MP4_CODEC_H264)
 		r.hasVideo = true
 	}
 
+	// fragments start at keyframes
+	if randomAccess {
+		err = r.flushFragment(dtsDuration)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Convert NALUs to Annex-B format for gomedia
 	var buf bytes.Buffer
 	for _, nalu := range nalus {
@@ -221,16 +654,15 @@ func (r *MP4Recorder) onH264(u *unit.Unit) error {
 		buf.Write(nalu)
 	}
 
-	// Write to muxer with PTS/DTS in milliseconds
-	pts := uint64(u.PTS / 90) // Convert from 90kHz to milliseconds
-	dtsMs := uint64(dts / 90)
-
-	err = r.muxer.Write(r.videoTrack, buf.Bytes(), pts, dtsMs)
+	// Write to muxer with PTS/DTS in milliseconds, relative to the start of the file
+	err = r.muxer.Write(r.videoTrack, buf.Bytes(), r.toMilliseconds(ptsDuration), r.toMilliseconds(dtsDuration))
 	if err != nil {
 		r.Log(logger.Error, "failed to write H264: %v", err)
 		return err
 	}
 
+	r.advance(dtsDuration)
+
 	return nil
 }
 
@@ -243,19 +675,10 @@ func (r *MP4Recorder) onH265(u *unit.Unit) error {
 	defer r.mutex.Unlock()
 
 	nalus := u.Payload.(unit.PayloadH265)
+	randomAccess := h265.IsRandomAccess(nalus)
 
 	// Check if we need to initialize DTS extractor
 	if r.dtsExtractor == nil {
-		// Check for IDR/CRA frame
-		randomAccess := false
-		for _, nalu := range nalus {
-			typ := h265.NALUType((nalu[0] >> 1) & 0b111111)
-			if typ == h265.NALUType_IDR_W_RADL || typ == h265.NALUType_IDR_N_LP || typ == h265.NALUType_CRA_NUT {
-				randomAccess = true
-				break
-			}
-		}
-
 		if !randomAccess {
 			return nil
 		}
@@ -271,12 +694,33 @@ func (r *MP4Recorder) onH265(u *unit.Unit) error {
 		return err
 	}
 
+	dtsDuration := timestampToDuration(dts, 90000)
+	ptsDuration := timestampToDuration(u.PTS, 90000)
+
+	if !r.pause.mainSample(dtsDuration, u.NTP, randomAccess) {
+		return nil
+	}
+	dtsDuration -= r.pause.offset
+	ptsDuration -= r.pause.offset
+
+	if !r.started {
+		r.start(dtsDuration, u.NTP)
+	}
+
 	// Add video track if not added yet
 	if !r.hasVideo {
 		r.videoTrack = r.muxer.AddVideoTrack(mp4.MP4_CODEC_H265)
 		r.hasVideo = true
 	}
 
+	// fragments start at keyframes
+	if randomAccess {
+		err = r.flushFragment(dtsDuration)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Convert NALUs to Annex-B format for gomedia
 	var buf bytes.Buffer
 	for _, nalu := range nalus {
@@ -286,15 +730,14 @@ func (r *MP4Recorder) onH265(u *unit.Unit) error {
 		buf.Write(nalu)
 	}
 
-	// Write to muxer with PTS/DTS in milliseconds
-	pts := uint64(u.PTS / 90) // Convert from 90kHz to milliseconds
-	dtsMs := uint64(dts / 90)
-
-	err = r.muxer.Write(r.videoTrack, buf.Bytes(), pts, dtsMs)
+	// Write to muxer with PTS/DTS in milliseconds, relative to the start of the file
+	err = r.muxer.Write(r.videoTrack, buf.Bytes(), r.toMilliseconds(ptsDuration), r.toMilliseconds(dtsDuration))
 	if err != nil {
 		r.Log(logger.Error, "failed to write H265: %v", err)
 		return err
 	}
 
+	r.advance(dtsDuration)
+
 	return nil
 }
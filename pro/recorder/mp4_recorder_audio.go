@@ -0,0 +1,120 @@
+package recorder
+
+import (
+	"fmt"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/yapingcat/gomedia/go-mp4"
+
+	"github.com/bluenviron/mediamtx/pro/recordrepair"
+)
+
+// mp4AudioTrack is an audio track of the MP4 recorder.
+// The track is added to the muxer when the first sample is written.
+type mp4AudioTrack struct {
+	codec   mp4.MP4_CODEC_TYPE
+	options []mp4.TrackOption
+	hint    recordrepair.HintTrack // description written into non-fragmented files, used to repair them
+	index   int                    // position of the track in the recovery hint
+	id      uint32
+	added   bool
+
+	// timestamp of the last written sample, in milliseconds
+	written bool
+	lastTS  uint64
+}
+
+var adtsSampleRates = []int{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+// adtsFrame wraps an AAC access unit into an ADTS frame, which is the input format of the MP4 muxer.
+func adtsFrame(config *mpeg4audio.AudioSpecificConfig, au []byte) ([]byte, error) {
+	sampleRateIndex := -1
+	for i, rate := range adtsSampleRates {
+		if rate == config.SampleRate {
+			sampleRateIndex = i
+			break
+		}
+	}
+	if sampleRateIndex < 0 {
+		return nil, fmt.Errorf("unsupported AAC sample rate: %d", config.SampleRate)
+	}
+
+	var channelConfig int
+	switch {
+	case config.ChannelCount >= 1 && config.ChannelCount <= 6:
+		channelConfig = config.ChannelCount
+	case config.ChannelCount == 8:
+		channelConfig = 7
+	default:
+		return nil, fmt.Errorf("unsupported AAC channel count: %d", config.ChannelCount)
+	}
+
+	frameLen := len(au) + 7
+	if frameLen > 0x1FFF {
+		return nil, fmt.Errorf("AAC access unit is too big")
+	}
+
+	profile := int(config.Type) - 1
+
+	frame := make([]byte, frameLen)
+	frame[0] = 0xFF
+	frame[1] = 0xF1 // MPEG-4, layer 0, no CRC
+	frame[2] = byte(profile<<6) | byte(sampleRateIndex<<2) | byte((channelConfig>>2)&0x01)
+	frame[3] = byte((channelConfig&0x03)<<6) | byte((frameLen>>11)&0x03)
+	frame[4] = byte((frameLen >> 3) & 0xFF)
+	frame[5] = byte((frameLen&0x07)<<5) | 0x1F
+	frame[6] = 0xFC
+	copy(frame[7:], au)
+
+	return frame, nil
+}
+
+// opusHead returns the identification header of a mono or stereo Opus track.
+func opusHead(channelCount int) []byte {
+	return []byte{
+		'O', 'p', 'u', 's', 'H', 'e', 'a', 'd',
+		1,                  // version
+		byte(channelCount), // channel count
+		0x38, 0x01,         // pre-skip (312)
+		0x80, 0xBB, 0, 0, // input sample rate (48000)
+		0, 0, // output gain
+		0, // channel mapping family (mono or stereo)
+	}
+}
+
+// lpcmToMulaw encodes 16-bit big-endian LPCM samples into G711 µ-law.
+func lpcmToMulaw(lpcm []byte) []byte {
+	out := make([]byte, len(lpcm)/2)
+	for i := range out {
+		out[i] = mulawEncode(int16(uint16(lpcm[i*2])<<8 | uint16(lpcm[i*2+1])))
+	}
+	return out
+}
+
+func mulawEncode(sample int16) byte {
+	const (
+		bias = 0x84
+		clip = 32635
+	)
+
+	v := int(sample)
+	sign := 0
+	if v < 0 {
+		v = -v
+		sign = 0x80
+	}
+	if v > clip {
+		v = clip
+	}
+	v += bias
+
+	exponent := 7
+	for mask := 0x4000; v&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (v >> (exponent + 3)) & 0x0F
+
+	return ^byte(sign | exponent<<4 | mantissa)
+}
@@ -0,0 +1,124 @@
+package recorder
+
+import (
+	"testing"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/stretchr/testify/require"
+)
+
+func TestADTSFrame(t *testing.T) {
+	for _, ca := range []struct {
+		name         string
+		sampleRate   int
+		channelCount int
+		au           []byte
+		expected     []byte
+		err          string
+	}{
+		{
+			"44100 stereo",
+			44100, 2,
+			[]byte{1, 2},
+			[]byte{0xFF, 0xF1, 0x50, 0x80, 0x01, 0x3F, 0xFC, 1, 2},
+			"",
+		},
+		{
+			"48000 mono",
+			48000, 1,
+			[]byte{1},
+			[]byte{0xFF, 0xF1, 0x4C, 0x40, 0x01, 0x1F, 0xFC, 1},
+			"",
+		},
+		{
+			"48000 7.1",
+			48000, 8,
+			[]byte{1},
+			[]byte{0xFF, 0xF1, 0x4D, 0xC0, 0x01, 0x1F, 0xFC, 1},
+			"",
+		},
+		{
+			"unsupported sample rate",
+			44000, 2,
+			[]byte{1},
+			nil,
+			"unsupported AAC sample rate: 44000",
+		},
+		{
+			"unsupported channel count",
+			48000, 7,
+			[]byte{1},
+			nil,
+			"unsupported AAC channel count: 7",
+		},
+		{
+			"too big",
+			48000, 2,
+			make([]byte, 0x1FFF),
+			nil,
+			"AAC access unit is too big",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			frame, err := adtsFrame(&mpeg4audio.AudioSpecificConfig{
+				Type:         mpeg4audio.ObjectTypeAACLC,
+				SampleRate:   ca.sampleRate,
+				ChannelCount: ca.channelCount,
+			}, ca.au)
+
+			if ca.err != "" {
+				require.EqualError(t, err, ca.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, ca.expected, frame)
+		})
+	}
+}
+
+func TestMulawEncode(t *testing.T) {
+	for _, ca := range []struct {
+		sample   int16
+		expected byte
+	}{
+		{0, 0xFF},
+		{1, 0xFF},
+		{-1, 0x7F},
+		{100, 0xF2},
+		{-100, 0x72},
+		{1000, 0xCE},
+		{-1000, 0x4E},
+		{8159, 0x9F},
+		{32767, 0x80},
+		{-32768, 0x00},
+	} {
+		require.Equal(t, ca.expected, mulawEncode(ca.sample), "sample %d", ca.sample)
+	}
+
+	// LPCM samples are big-endian, a trailing odd byte is dropped
+	require.Equal(t, []byte{0xFF, 0xCE, 0x4E}, lpcmToMulaw([]byte{0x00, 0x00, 0x03, 0xE8, 0xFC, 0x18, 0x01}))
+}
+
+func TestOpusHead(t *testing.T) {
+	for _, ca := range []struct {
+		channelCount int
+		expected     []byte
+	}{
+		{1, []byte{'O', 'p', 'u', 's', 'H', 'e', 'a', 'd', 0x01, 0x01, 0x38, 0x01, 0x80, 0xBB, 0, 0, 0, 0, 0}},
+		{2, []byte{'O', 'p', 'u', 's', 'H', 'e', 'a', 'd', 0x01, 0x02, 0x38, 0x01, 0x80, 0xBB, 0, 0, 0, 0, 0}},
+	} {
+		require.Equal(t, ca.expected, opusHead(ca.channelCount))
+	}
+}
+
+func TestMP4MultichannelOpus(t *testing.T) {
+	forma := &format.Opus{PayloadTyp: 96, ChannelCount: 6}
+	media := &description.Media{Type: description.MediaTypeAudio, Formats: []format.Format{forma}}
+	r := &MP4Recorder{}
+
+	// the track is skipped, since its identification header would be invalid
+	require.False(t, r.setupTrack(media, forma))
+	require.Empty(t, r.audioTracks)
+}
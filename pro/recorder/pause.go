@@ -0,0 +1,137 @@
+package recorder
+
+import (
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+)
+
+// defaultFrameDuration is the distance between the last sample written before a pause
+// and the first sample written after it, when the sample rate is not known yet.
+const defaultFrameDuration = 40 * time.Millisecond
+
+// pauseTimeline removes paused intervals from the timeline of a recording.
+// Samples are dropped while paused. When resumed, the recording restarts from the next
+// keyframe, which is placed right after the last sample written before the pause,
+// therefore the file has a continuous timeline.
+//
+// The main track is the video track. In audio-only streams, every track is a main track.
+type pauseTimeline struct {
+	paused     bool
+	resuming   bool          // resumed, waiting for a keyframe of the main track
+	offset     time.Duration // total paused duration, subtracted from stream timestamps
+	restarted  bool
+	restartDTS time.Duration // stream timestamp of the last restart, other tracks are dropped before it
+
+	written   bool
+	lastDTS   time.Duration // timestamp of the last sample of the main track, offset applied
+	lastDelta time.Duration // distance between the last two samples of the main track
+
+	// intervals of the file in which samples were written, separated by pauses
+	parts []timelinePart
+}
+
+// timelinePart is an interval of a file in which samples were written without pauses.
+type timelinePart struct {
+	ntp time.Time     // NTP timestamp of the first sample
+	dts time.Duration // timestamp of the first sample, offset applied
+}
+
+func (p *pauseTimeline) pause() {
+	p.paused = true
+	p.resuming = false
+}
+
+func (p *pauseTimeline) resume() {
+	if !p.paused {
+		return
+	}
+	p.paused = false
+
+	// the file must start with a keyframe even when nothing has been written yet,
+	// since the stream may have been started on a keyframe received during the pause
+	p.resuming = true
+}
+
+// mainSample returns whether a sample of the main track must be written.
+func (p *pauseTimeline) mainSample(dts time.Duration, ntp time.Time, randomAccess bool) bool {
+	if p.paused {
+		return false
+	}
+
+	newPart := !p.written
+
+	if p.resuming {
+		if !randomAccess {
+			return false
+		}
+
+		// nothing has been written yet, the file starts normally
+		if p.written {
+			delta := p.lastDelta
+			if delta <= 0 {
+				delta = defaultFrameDuration
+			}
+
+			p.offset = dts - (p.lastDTS + delta)
+			newPart = true
+		}
+		p.restarted = true
+		p.restartDTS = dts
+		p.resuming = false
+	}
+
+	adjusted := dts - p.offset
+	if p.written {
+		p.lastDelta = adjusted - p.lastDTS
+	}
+	p.lastDTS = adjusted
+	p.written = true
+
+	if newPart {
+		p.parts = append(p.parts, timelinePart{ntp: ntp, dts: adjusted})
+	}
+
+	return true
+}
+
+// otherSample returns whether a sample of a track that is not the main track must be written.
+func (p *pauseTimeline) otherSample(dts time.Duration) bool {
+	if p.paused || p.resuming {
+		return false
+	}
+	return !p.restarted || dts >= p.restartDTS
+}
+
+// fileMetadata returns the metadata of a file whose timeline starts at startDTS,
+// or nil when nothing has been written yet. Files that were paused are split into parts,
+// since paused intervals are not part of their timeline.
+func fileMetadata(firstNTP time.Time, startDTS time.Duration, position time.Duration,
+	parts []timelinePart,
+) *recordstore.Metadata {
+	if firstNTP.IsZero() {
+		return nil
+	}
+
+	m := &recordstore.Metadata{
+		Start:    firstNTP,
+		Duration: position.Seconds(),
+	}
+
+	if len(parts) > 1 {
+		for i, part := range parts {
+			end := startDTS + position
+			if i < len(parts)-1 {
+				end = parts[i+1].dts
+			}
+
+			m.Parts = append(m.Parts, recordstore.MetadataPart{
+				Start:    part.ntp,
+				Offset:   (part.dts - startDTS).Seconds(),
+				Duration: (end - part.dts).Seconds(),
+			})
+		}
+	}
+
+	return m
+}
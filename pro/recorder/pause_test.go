@@ -0,0 +1,72 @@
+package recorder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+)
+
+func TestPauseTimeline(t *testing.T) {
+	var p pauseTimeline
+	ms := time.Millisecond
+	start := time.Date(2008, 11, 7, 11, 22, 0, 0, time.UTC)
+	ntp := func(dts time.Duration) time.Time {
+		return start.Add(dts - 1000*ms)
+	}
+
+	require.True(t, p.mainSample(1000*ms, ntp(1000*ms), true))
+	require.True(t, p.mainSample(1040*ms, ntp(1040*ms), false))
+	require.True(t, p.otherSample(1050*ms))
+
+	p.pause()
+	require.False(t, p.mainSample(1080*ms, ntp(1080*ms), true))
+	require.False(t, p.otherSample(1090*ms))
+
+	// samples are dropped until the next keyframe
+	p.resume()
+	require.False(t, p.otherSample(5000*ms))
+	require.False(t, p.mainSample(5000*ms, ntp(5000*ms), false))
+	require.True(t, p.mainSample(5040*ms, ntp(5040*ms), true))
+	require.Equal(t, 5040*ms-1080*ms, p.offset)
+	require.Equal(t, 1080*ms, p.lastDTS)
+
+	// other tracks restart with the keyframe
+	require.False(t, p.otherSample(5030*ms))
+	require.True(t, p.otherSample(5050*ms))
+
+	// the file is split into a part for each interval between pauses
+	require.Equal(t, []timelinePart{
+		{ntp: start, dts: 1000 * ms},
+		{ntp: ntp(5040 * ms), dts: 1080 * ms},
+	}, p.parts)
+
+	require.Equal(t, &recordstore.Metadata{
+		Start:    start,
+		Duration: 0.12,
+		Parts: []recordstore.MetadataPart{
+			{Start: start, Offset: 0, Duration: 0.08},
+			{Start: ntp(5040 * ms), Offset: 0.08, Duration: 0.04},
+		},
+	}, fileMetadata(start, 1000*ms, 120*ms, p.parts))
+}
+
+func TestPauseTimelineBeforeStart(t *testing.T) {
+	var p pauseTimeline
+
+	p.pause()
+	require.False(t, p.mainSample(0, time.Time{}, true))
+
+	// the file starts with a keyframe
+	p.resume()
+	require.False(t, p.mainSample(time.Second, time.Time{}, false))
+	require.True(t, p.mainSample(1040*time.Millisecond, time.Time{}, true))
+	require.Equal(t, time.Duration(0), p.offset)
+	require.Len(t, p.parts, 1)
+
+	// files without pauses are not split
+	require.Nil(t, fileMetadata(time.Time{}, 0, 0, p.parts))
+	require.Nil(t, fileMetadata(time.Unix(1, 0), 0, time.Second, p.parts).Parts)
+}
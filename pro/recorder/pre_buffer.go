@@ -0,0 +1,251 @@
+package recorder
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+// audio-only streams have no keyframes, therefore they are split into fixed-size groups.
+const preBufferAudioGroupDuration = 1 * time.Second
+
+type preBufferEntry struct {
+	media *description.Media
+	forma format.Format
+	unit  *unit.Unit
+}
+
+// preBufferGOP is a group of units that starts with a keyframe of the primary video track.
+type preBufferGOP struct {
+	received time.Time
+	entries  []preBufferEntry
+}
+
+// preBufferReader receives the buffered units first, then the live ones.
+type preBufferReader struct {
+	onUnit  func(*description.Media, format.Format, *unit.Unit) error
+	pending []preBufferEntry
+	err     chan error
+}
+
+// PreBuffer keeps the last GOPs of a stream in memory, in order to allow
+// recordings to start at the oldest buffered keyframe instead of the next one.
+type PreBuffer struct {
+	Stream   *stream.Stream
+	Duration time.Duration
+	Parent   logger.Writer
+
+	reader       *stream.Reader
+	primaryForma format.Format
+	mutex        sync.Mutex
+	deliverMutex sync.Mutex
+	gops         []*preBufferGOP
+	readers      map[*preBufferReader]struct{}
+	closed       bool
+
+	terminate chan struct{}
+	done      chan struct{}
+}
+
+// Initialize initializes PreBuffer.
+func (b *PreBuffer) Initialize() {
+	b.readers = make(map[*preBufferReader]struct{})
+
+	b.reader = &stream.Reader{
+		SkipBytesSent: true,
+		Parent:        b,
+	}
+
+	for _, media := range b.Stream.Desc.Medias {
+		for _, forma := range media.Formats {
+			switch forma.(type) {
+			case *format.H264, *format.H265:
+				if b.primaryForma == nil {
+					b.primaryForma = forma
+				}
+			}
+
+			cmedia := media
+			cforma := forma
+			b.reader.OnData(media, forma, func(u *unit.Unit) error {
+				b.onUnit(cmedia, cforma, u, time.Now())
+				return nil
+			})
+		}
+	}
+
+	b.Stream.AddReader(b.reader)
+
+	b.terminate = make(chan struct{})
+	b.done = make(chan struct{})
+
+	go b.run()
+
+	b.Log(logger.Info, "pre-event buffer started, duration: %v", b.Duration)
+}
+
+// Close closes PreBuffer.
+func (b *PreBuffer) Close() {
+	close(b.terminate)
+	<-b.done
+
+	b.Stream.RemoveReader(b.reader)
+
+	b.mutex.Lock()
+	b.closed = true
+	b.gops = nil
+	for r := range b.readers {
+		r.err <- fmt.Errorf("pre-event buffer closed")
+	}
+	b.readers = nil
+	b.mutex.Unlock()
+
+	b.Log(logger.Info, "pre-event buffer closed")
+}
+
+// Log implements logger.Writer.
+func (b *PreBuffer) Log(level logger.Level, format string, args ...interface{}) {
+	b.Parent.Log(level, "[pre-buffer] "+format, args...)
+}
+
+// Depth returns the duration of the buffered content.
+func (b *PreBuffer) Depth() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.gops) == 0 {
+		return 0
+	}
+	return time.Since(b.gops[0].received)
+}
+
+func (b *PreBuffer) run() {
+	defer close(b.done)
+
+	select {
+	case err := <-b.reader.Error():
+		b.Log(logger.Warn, "reader error: %v", err)
+	case <-b.terminate:
+	}
+}
+
+func (b *PreBuffer) isGroupStart(forma format.Format, u *unit.Unit, now time.Time) bool {
+	if b.primaryForma == nil {
+		return len(b.gops) == 0 || now.Sub(b.gops[len(b.gops)-1].received) >= preBufferAudioGroupDuration
+	}
+
+	if forma != b.primaryForma {
+		return false
+	}
+
+	switch forma.(type) {
+	case *format.H264:
+		return h264.IsRandomAccess(u.Payload.(unit.PayloadH264))
+
+	case *format.H265:
+		return h265.IsRandomAccess(u.Payload.(unit.PayloadH265))
+	}
+
+	return false
+}
+
+// onUnit buffers a unit received at the given time and delivers it to readers.
+func (b *PreBuffer) onUnit(media *description.Media, forma format.Format, u *unit.Unit, now time.Time) {
+	if u.NilPayload() {
+		return
+	}
+
+	entry := preBufferEntry{media: media, forma: forma, unit: u}
+
+	b.mutex.Lock()
+
+	if b.isGroupStart(forma, u, now) {
+		b.gops = append(b.gops, &preBufferGOP{received: now})
+
+		// remove GOPs that are entirely older than the buffer duration
+		for len(b.gops) > 1 && now.Sub(b.gops[1].received) >= b.Duration {
+			b.gops[0] = nil
+			b.gops = b.gops[1:]
+		}
+	}
+
+	// units that precede the first keyframe are discarded
+	if len(b.gops) != 0 {
+		gop := b.gops[len(b.gops)-1]
+		gop.entries = append(gop.entries, entry)
+	}
+
+	readers := make([]*preBufferReader, 0, len(b.readers))
+	for r := range b.readers {
+		readers = append(readers, r)
+	}
+
+	b.deliverMutex.Lock()
+	b.mutex.Unlock()
+	defer b.deliverMutex.Unlock()
+
+	for _, r := range readers {
+		err := b.deliver(r, entry)
+		if err != nil {
+			b.mutex.Lock()
+			if _, ok := b.readers[r]; ok {
+				delete(b.readers, r)
+				r.err <- err
+			}
+			b.mutex.Unlock()
+		}
+	}
+}
+
+func (b *PreBuffer) deliver(r *preBufferReader, entry preBufferEntry) error {
+	for _, e := range r.pending {
+		err := r.onUnit(e.media, e.forma, e.unit)
+		if err != nil {
+			return err
+		}
+	}
+	r.pending = nil
+
+	return r.onUnit(entry.media, entry.forma, entry.unit)
+}
+
+// addReader adds a reader that receives the buffered units, then the live ones.
+func (b *PreBuffer) addReader(r *preBufferReader) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return fmt.Errorf("pre-event buffer closed")
+	}
+
+	r.err = make(chan error, 1)
+
+	for _, gop := range b.gops {
+		r.pending = append(r.pending, gop.entries...)
+	}
+
+	b.readers[r] = struct{}{}
+
+	return nil
+}
+
+// removeReader removes a reader and waits for any running delivery to finish.
+func (b *PreBuffer) removeReader(r *preBufferReader) {
+	b.mutex.Lock()
+	if b.readers != nil {
+		delete(b.readers, r)
+	}
+	b.mutex.Unlock()
+
+	b.deliverMutex.Lock()
+	b.deliverMutex.Unlock() //nolint:staticcheck
+}
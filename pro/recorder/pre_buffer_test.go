@@ -0,0 +1,99 @@
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+func TestPreBuffer(t *testing.T) {
+	media := test.UniqueMediaH264()
+	forma := media.Formats[0]
+
+	b := &PreBuffer{
+		Duration:     2 * time.Second,
+		Parent:       test.NilLogger,
+		primaryForma: forma,
+		readers:      make(map[*preBufferReader]struct{}),
+	}
+
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	// one GOP per second, made of a keyframe and a non-keyframe
+	writeGOP := func(i int) {
+		for j, nalu := range [][]byte{{5}, {1}} {
+			d := time.Duration(i)*time.Second + time.Duration(j)*500*time.Millisecond
+			au := unit.PayloadH264{nalu}
+			if j == 0 {
+				au = unit.PayloadH264{test.FormatH264.SPS, test.FormatH264.PPS, nalu}
+			}
+			b.onUnit(media, forma, &unit.Unit{
+				PTS:     int64(d) * 90000 / int64(time.Second),
+				NTP:     start.Add(d),
+				Payload: au,
+			}, start.Add(d))
+		}
+	}
+
+	for i := range 5 {
+		writeGOP(i)
+	}
+
+	// the buffer keeps the GOPs that cover the last 2 seconds
+	require.Len(t, b.gops, 3)
+	require.Equal(t, start.Add(2*time.Second), b.gops[0].received)
+
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "rec.ts")
+
+	r := &TSRecorder{
+		Stream:    &stream.Stream{Desc: &description.Session{Medias: []*description.Media{media}}},
+		PreBuffer: b,
+		FilePath:  fpath,
+		Parent:    test.NilLogger,
+	}
+	err := r.Initialize()
+	require.NoError(t, err)
+
+	// buffered units are written when the next live unit is received
+	writeGOP(5)
+	writeGOP(6)
+	r.Close()
+
+	require.Equal(t, start.Add(2*time.Second), r.FirstNTP())
+
+	f, err := os.Open(fpath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	mr := &mpegts.Reader{R: f}
+	err = mr.Initialize()
+	require.NoError(t, err)
+
+	var pts []int64
+	mr.OnDataH264(mr.Tracks()[0], func(p int64, _ int64, _ [][]byte) error {
+		pts = append(pts, p)
+		return nil
+	})
+
+	for {
+		err = mr.Read()
+		if err != nil {
+			break
+		}
+	}
+
+	// the recording starts with the oldest buffered keyframe
+	require.GreaterOrEqual(t, len(pts), 6)
+	require.Equal(t, []int64{2 * 90000, 2*90000 + 45000, 3 * 90000, 3*90000 + 45000, 4 * 90000, 4*90000 + 45000},
+		pts[:6])
+}
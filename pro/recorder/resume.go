@@ -0,0 +1,229 @@
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+	"github.com/bluenviron/mediamtx/pro/clipexport"
+)
+
+// resumeTasks restarts the tasks that were running when the server stopped.
+// Each task continues into a new file, until its original end time.
+func (m *Manager) resumeTasks() {
+	m.journalPath = filepath.Join(m.RecordPath, journalFileName)
+
+	j, err := readJournal(m.journalPath)
+	if err != nil {
+		m.Log(logger.Warn, "failed to read task journal %s: %v", m.journalPath, err)
+		return
+	}
+
+	m.interruptions = j.Interruptions
+	now := time.Now()
+
+	// sessions are restored first, in order to add the resumed tasks to them
+	for _, e := range j.Sessions {
+		m.restoreSession(e)
+	}
+
+	for _, e := range j.Tasks {
+		it := planResume(e, j.UpdatedAt, now)
+
+		if it.PreviousFile != "" {
+			m.probeMetadata(e.PathName, filepath.Join(m.RecordPath, filepath.FromSlash(it.PreviousFile)))
+		}
+
+		if _, exists := m.tasks[e.PathName]; exists {
+			it.Resumed = false
+			it.Reason = "path is already recording"
+		}
+
+		if it.Resumed {
+			task := &Task{
+				ID:             e.ID,
+				PathName:       e.PathName,
+				Format:         e.Format,
+				RecordPath:     m.RecordPath,
+				Timeout:        e.EndTime.Sub(e.StartTime),
+				CustomFileName: e.CustomFileName,
+				PathManager:    m.PathManager,
+				PathConf:       m.PathConfs[e.PathName],
+				PathDefaults:   m.PathDefaults,
+				Parent:         m,
+				IsAutoRecord:   e.IsAutoRecord,
+				ScheduleID:     e.ScheduleID,
+				SessionID:      e.SessionID,
+				PreviousFiles:  e.Files,
+				StartTime:      e.StartTime,
+			}
+			task.restorePause(e.Paused, e.PausedIntervals)
+
+			// the path may not be ready yet: like any other task, the recorder is retried until the end time
+			err = task.Start()
+			if err != nil {
+				it.Resumed = false
+				it.Reason = err.Error()
+			} else {
+				m.tasks[e.PathName] = task
+				m.markScheduleStarted(task)
+				it.NewFile = task.RelativePath
+
+				if s, ok := m.sessions[e.SessionID]; ok {
+					s.tasks[e.PathName] = task
+				}
+			}
+		}
+
+		if it.Resumed {
+			m.Log(logger.Warn, "recording of path '%s' was interrupted for %.1fs, resumed into %s",
+				e.PathName, it.Duration, it.NewFile)
+		} else {
+			m.Log(logger.Warn, "recording of path '%s' was interrupted and can't be resumed: %s",
+				e.PathName, it.Reason)
+		}
+
+		m.interruptions = append(m.interruptions, it)
+	}
+
+	// sessions without resumed tasks are finished, their manifest lists the files written before the restart
+	for _, s := range m.sessions {
+		if len(s.tasks) == 0 {
+			m.finishSession(s)
+		}
+	}
+
+	if len(m.interruptions) > journalInterruptionCount {
+		m.interruptions = m.interruptions[len(m.interruptions)-journalInterruptionCount:]
+	}
+
+	m.saveJournal()
+}
+
+// probeMetadata updates the metadata of a file that was interrupted by a restart of the server
+// with the duration read from the file, since the last update of the metadata may precede the interruption.
+// Files without metadata get one, with the start estimated from the modification time.
+// Files that can't be read, like non-fragmented MP4 files that have not been repaired, are left untouched.
+func (m *Manager) probeMetadata(pathName string, fpath string) {
+	d, err := clipexport.Duration(fpath, m)
+	if err != nil {
+		m.Log(logger.Debug, "failed to read duration of %s: %v", fpath, err)
+		return
+	}
+
+	md, err := recordstore.ReadMetadata(fpath)
+	if err != nil {
+		info, err2 := os.Stat(fpath)
+		if err2 != nil {
+			return
+		}
+
+		md = &recordstore.Metadata{
+			PathName: pathName,
+			Start:    info.ModTime().Add(-d),
+		}
+	}
+
+	md.SetDuration(d)
+
+	err = recordstore.WriteMetadata(fpath, md)
+	if err != nil {
+		m.Log(logger.Warn, "failed to write metadata of %s: %v", fpath, err)
+	}
+}
+
+// markScheduleStarted binds a resumed task to the current window of its schedule rule,
+// so that the window is not reported as missed and no other task is started in it.
+func (m *Manager) markScheduleStarted(task *Task) {
+	if task.ScheduleID == "" {
+		return
+	}
+
+	state, ok := m.schedules[scheduleKey(task.PathName, task.ScheduleID)]
+	if !ok {
+		return
+	}
+
+	start, end, ok := state.rule.NextWindow(time.Now())
+	if !ok || time.Now().Before(start) {
+		return
+	}
+
+	state.window = &ScheduleRun{Start: start, End: end}
+	state.started = true
+	state.taskID = task.ID
+}
+
+// saveJournal writes the running tasks into the journal. Must be called with the mutex held.
+func (m *Manager) saveJournal() {
+	if m.journalPath == "" {
+		return
+	}
+
+	j := &taskJournal{
+		UpdatedAt:     time.Now(),
+		Tasks:         []journalEntry{},
+		Interruptions: m.interruptions,
+	}
+
+	for _, task := range m.tasks {
+		j.Tasks = append(j.Tasks, task.journalEntry())
+	}
+
+	sort.Slice(j.Tasks, func(i, k int) bool {
+		return j.Tasks[i].PathName < j.Tasks[k].PathName
+	})
+
+	for _, s := range m.sessions {
+		if s.endTime == nil {
+			j.Sessions = append(j.Sessions, m.journalSession(s))
+		}
+	}
+
+	sort.Slice(j.Sessions, func(i, k int) bool {
+		return j.Sessions[i].StartTime.Before(j.Sessions[k].StartTime)
+	})
+
+	err := writeJSONFile(m.journalPath, j)
+	if err != nil {
+		m.Log(logger.Warn, "failed to write task journal %s: %v", m.journalPath, err)
+		return
+	}
+
+	m.journalIdle = len(j.Tasks) == 0 && len(j.Sessions) == 0
+}
+
+// updateJournal refreshes the journal, in order to know when the server was last seen running.
+// Nothing is written while there are no tasks.
+func (m *Manager) updateJournal() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.journalIdle && len(m.tasks) == 0 {
+		return
+	}
+
+	m.saveJournal()
+}
+
+// taskInterruptions returns the interruptions of a task. Must be called with the mutex held.
+func (m *Manager) taskInterruptions(id string) []TaskInterruption {
+	var ret []TaskInterruption
+	for _, it := range m.interruptions {
+		if it.TaskID == id {
+			ret = append(ret, it)
+		}
+	}
+	return ret
+}
+
+// GetInterruptions returns the tasks that were interrupted by a restart of the server, oldest first.
+func (m *Manager) GetInterruptions() []TaskInterruption {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return append([]TaskInterruption{}, m.interruptions...)
+}
@@ -0,0 +1,298 @@
+package recorder
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	// scheduleUpcomingCount is the number of upcoming runs reported for each rule.
+	scheduleUpcomingCount = 5
+
+	// scheduleMissedCount is the number of missed runs kept for each rule.
+	scheduleMissedCount = 20
+)
+
+// ScheduleRun is a window of a schedule rule.
+type ScheduleRun struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason,omitempty"` // why the run was missed
+}
+
+// ScheduleStatus is the status of a schedule rule.
+type ScheduleStatus struct {
+	PathName  string              `json:"pathName"`
+	Rule      conf.RecordSchedule `json:"rule"`
+	Active    bool                `json:"active"`    // a window is in progress
+	Recording bool                `json:"recording"` // a task started by the rule is recording
+	TaskID    string              `json:"taskId,omitempty"`
+	Current   *ScheduleRun        `json:"current,omitempty"`
+	Upcoming  []ScheduleRun       `json:"upcoming"`
+	Missed    []ScheduleRun       `json:"missed"`
+}
+
+// scheduleState is the runtime state of a schedule rule.
+// It's kept across configuration reloads, as long as the rule exists.
+type scheduleState struct {
+	pathName string
+	rule     conf.RecordSchedule
+
+	// current window
+	window     *ScheduleRun
+	started    bool   // a task has been started in the current window
+	taskID     string // task started in the current window
+	lastReason string // why the task couldn't be started yet
+
+	missed []ScheduleRun
+}
+
+func scheduleKey(pathName string, id string) string {
+	return pathName + "/" + id
+}
+
+// miss records a window in which no task could be started.
+func (s *scheduleState) miss(run ScheduleRun) {
+	s.missed = append(s.missed, run)
+	if len(s.missed) > scheduleMissedCount {
+		s.missed = s.missed[len(s.missed)-scheduleMissedCount:]
+	}
+}
+
+// syncSchedules creates the states of new rules and removes the states of deleted or disabled rules,
+// stopping their tasks. Must be called with the mutex held.
+func (m *Manager) syncSchedules() {
+	rules := make(map[string]*scheduleState)
+
+	for pathName, pathConf := range m.PathConfs {
+		// regular expression-based paths can't have schedules
+		if strings.HasPrefix(pathName, "~") {
+			continue
+		}
+
+		for _, rule := range pathConf.RecordSchedules {
+			if rule.Disabled {
+				continue
+			}
+
+			key := scheduleKey(pathName, rule.ID)
+
+			state, ok := m.schedules[key]
+			if !ok {
+				state = &scheduleState{pathName: pathName}
+			} else if !reflect.DeepEqual(state.rule, rule) {
+				// the recording of a modified rule restarts following the new rule
+				m.stopScheduledTask(state, "has been modified")
+				state.window = nil
+				state.started = false
+				state.taskID = ""
+				state.lastReason = ""
+			}
+			state.rule = rule
+			rules[key] = state
+		}
+	}
+
+	for key, state := range m.schedules {
+		if _, ok := rules[key]; ok {
+			continue
+		}
+
+		m.stopScheduledTask(state, "has been removed")
+	}
+
+	m.schedules = rules
+}
+
+// stopScheduledTask stops the task started by a rule, if it's still running. Must be called with the mutex held.
+func (m *Manager) stopScheduledTask(state *scheduleState, reason string) {
+	task, ok := m.tasks[state.pathName]
+	if !ok || state.taskID == "" || task.ID != state.taskID {
+		return
+	}
+
+	m.Log(logger.Info, "schedule '%s' of path '%s' %s, stopping its recording", state.rule.ID, state.pathName, reason)
+	task.Stop()
+	delete(m.tasks, state.pathName)
+}
+
+// checkSchedules starts and stops tasks following the schedule rules.
+func (m *Manager) checkSchedules(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, key := range sortedScheduleKeys(m.schedules) {
+		state := m.schedules[key]
+
+		// the current window is over
+		if state.window != nil && !now.Before(state.window.End) {
+			if !state.started {
+				run := *state.window
+				run.Reason = state.lastReason
+				state.miss(run)
+				m.Log(logger.Warn, "schedule '%s' of path '%s' missed the run %s - %s: %s",
+					state.rule.ID, state.pathName, run.Start.Format(time.RFC3339), run.End.Format(time.RFC3339), run.Reason)
+			}
+
+			state.window = nil
+			state.started = false
+			state.taskID = ""
+			state.lastReason = ""
+		}
+
+		start, end, ok := state.rule.NextWindow(now)
+		if !ok || now.Before(start) {
+			continue
+		}
+
+		if state.window == nil || !state.window.Start.Equal(start) {
+			state.window = &ScheduleRun{Start: start, End: end}
+			state.started = false
+			state.taskID = ""
+			state.lastReason = ""
+		}
+
+		// a task is started once per window. Tasks stopped through the API are not restarted.
+		if state.started {
+			continue
+		}
+
+		reason := m.startScheduledTask(state, end)
+		if reason != "" {
+			state.lastReason = reason
+		}
+	}
+}
+
+// startScheduledTask starts the task of a window. It returns the reason of a failure.
+func (m *Manager) startScheduledTask(state *scheduleState, end time.Time) string {
+	if _, exists := m.tasks[state.pathName]; exists {
+		return "path is already recording"
+	}
+
+	pathData, err := m.PathManager.APIPathsGet(state.pathName)
+	if err != nil || !pathData.Ready {
+		return "path is not ready"
+	}
+
+	format := state.rule.Format
+	if format == "" {
+		format = "mp4"
+	}
+
+	task := &Task{
+		ID:           uuid.New().String(),
+		PathName:     state.pathName,
+		Format:       format,
+		RecordPath:   m.RecordPath,
+		Timeout:      time.Until(end),
+		PathManager:  m.PathManager,
+		PathConf:     m.PathConfs[state.pathName],
+		PathDefaults: m.PathDefaults,
+		Parent:       m,
+		ScheduleID:   state.rule.ID,
+	}
+
+	err = task.Start()
+	if err != nil {
+		m.Log(logger.Warn, "failed to start scheduled recording for path '%s': %v", state.pathName, err)
+		return err.Error()
+	}
+
+	m.tasks[state.pathName] = task
+	state.started = true
+	state.taskID = task.ID
+
+	m.Log(logger.Info, "scheduled recording started for path '%s' (schedule '%s'), until %s",
+		state.pathName, state.rule.ID, end.Format(time.RFC3339))
+
+	return ""
+}
+
+// GetScheduleStatuses returns the status of the schedule rules of all paths.
+func (m *Manager) GetScheduleStatuses() []*ScheduleStatus {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	now := time.Now()
+	statuses := []*ScheduleStatus{}
+
+	for _, pathName := range sortedPathNames(m.PathConfs) {
+		for _, rule := range m.PathConfs[pathName].RecordSchedules {
+			status := &ScheduleStatus{
+				PathName: pathName,
+				Rule:     rule,
+				Upcoming: []ScheduleRun{},
+				Missed:   []ScheduleRun{},
+			}
+
+			if !rule.Disabled {
+				status.Upcoming = upcomingRuns(rule, now)
+			}
+
+			if state, ok := m.schedules[scheduleKey(pathName, rule.ID)]; ok {
+				if state.window != nil {
+					current := *state.window
+					current.Reason = state.lastReason
+					status.Active = true
+					status.Current = &current
+				}
+
+				if task, ok := m.tasks[pathName]; ok && state.taskID != "" && task.ID == state.taskID {
+					status.Recording = true
+					status.TaskID = task.ID
+				}
+
+				status.Missed = append(status.Missed, state.missed...)
+			}
+
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses
+}
+
+// upcomingRuns returns the next windows of a rule that start after now.
+func upcomingRuns(rule conf.RecordSchedule, now time.Time) []ScheduleRun {
+	runs := []ScheduleRun{}
+	t := now
+
+	for len(runs) < scheduleUpcomingCount {
+		start, end, ok := rule.NextWindow(t)
+		if !ok {
+			break
+		}
+
+		if start.After(now) {
+			runs = append(runs, ScheduleRun{Start: start, End: end})
+		}
+		t = end
+	}
+
+	return runs
+}
+
+func sortedScheduleKeys(m map[string]*scheduleState) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedPathNames(m map[string]*conf.Path) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,210 @@
+package recorder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+// notReadyPathManager reports every path as not ready, therefore scheduled tasks are never started.
+type notReadyPathManager struct {
+	defs.APIPathManager
+}
+
+func (notReadyPathManager) APIPathsGet(string) (*defs.APIPath, error) {
+	return &defs.APIPath{Ready: false}, nil
+}
+
+func scheduleRunString(run *ScheduleRun) string {
+	if run == nil {
+		return ""
+	}
+	return run.Start.Format(time.RFC3339) + " " + run.End.Format(time.RFC3339) + " " + run.Reason
+}
+
+func TestCheckSchedules(t *testing.T) {
+	loc := time.FixedZone("test", 8*3600)
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2025, 10, day, hour, minute, 0, 0, loc) // 15 is a wednesday
+	}
+
+	hourly := conf.RecordSchedule{
+		ID:       "hourly",
+		Type:     conf.RecordScheduleTypeCron,
+		Cron:     "0 * * * *",
+		Duration: conf.Duration(45 * time.Minute),
+	}
+
+	for _, ca := range []struct {
+		name      string
+		rules     conf.RecordSchedules
+		recording bool // the path is already recording
+		steps     []time.Time
+		current   []string // current window of each rule
+		missed    [][]string
+	}{
+		{
+			"cron in progress",
+			conf.RecordSchedules{hourly},
+			false,
+			[]time.Time{at(15, 14, 30)},
+			[]string{"2025-10-15T14:00:00+08:00 2025-10-15T14:45:00+08:00 path is not ready"},
+			[][]string{nil},
+		},
+		{
+			"cron between windows",
+			conf.RecordSchedules{hourly},
+			false,
+			[]time.Time{at(15, 14, 50)},
+			[]string{""},
+			[][]string{nil},
+		},
+		{
+			"cron window over",
+			conf.RecordSchedules{hourly},
+			false,
+			[]time.Time{at(15, 14, 30), at(15, 14, 45), at(15, 15, 10)},
+			[]string{"2025-10-15T15:00:00+08:00 2025-10-15T15:45:00+08:00 path is not ready"},
+			[][]string{{"2025-10-15T14:00:00+08:00 2025-10-15T14:45:00+08:00 path is not ready"}},
+		},
+		{
+			"cron across midnight",
+			conf.RecordSchedules{{
+				ID:       "night",
+				Type:     conf.RecordScheduleTypeCron,
+				Cron:     "30 23 * * *",
+				Duration: conf.Duration(time.Hour),
+			}},
+			false,
+			[]time.Time{at(15, 23, 45), at(16, 0, 15)},
+			[]string{"2025-10-15T23:30:00+08:00 2025-10-16T00:30:00+08:00 path is not ready"},
+			[][]string{nil},
+		},
+		{
+			"once before start",
+			conf.RecordSchedules{{
+				ID:    "once",
+				Type:  conf.RecordScheduleTypeOnce,
+				Start: "2025-10-15T15:00:00+08:00",
+				End:   "2025-10-15T16:00:00+08:00",
+			}},
+			false,
+			[]time.Time{at(15, 14, 30)},
+			[]string{""},
+			[][]string{nil},
+		},
+		{
+			"once elapsed",
+			conf.RecordSchedules{{
+				ID:    "once",
+				Type:  conf.RecordScheduleTypeOnce,
+				Start: "2025-10-15T15:00:00+08:00",
+				End:   "2025-10-15T16:00:00+08:00",
+			}},
+			false,
+			[]time.Time{at(15, 15, 10), at(15, 16, 0), at(15, 16, 30)},
+			[]string{""},
+			[][]string{{"2025-10-15T15:00:00+08:00 2025-10-15T16:00:00+08:00 path is not ready"}},
+		},
+		{
+			"weekly across midnight",
+			conf.RecordSchedules{{
+				ID:    "weekly",
+				Type:  conf.RecordScheduleTypeWeekly,
+				Start: "22:00",
+				End:   "02:00",
+				Days:  []string{"tue"},
+			}},
+			false,
+			[]time.Time{at(14, 23, 30), at(15, 1, 0)},
+			[]string{"2025-10-14T22:00:00+08:00 2025-10-15T02:00:00+08:00 path is not ready"},
+			[][]string{nil},
+		},
+		{
+			"weekly across midnight over",
+			conf.RecordSchedules{{
+				ID:    "weekly",
+				Type:  conf.RecordScheduleTypeWeekly,
+				Start: "22:00",
+				End:   "02:00",
+				Days:  []string{"tue"},
+			}},
+			false,
+			[]time.Time{at(14, 23, 30), at(15, 1, 0), at(15, 2, 0), at(15, 23, 0)},
+			[]string{""},
+			[][]string{{"2025-10-14T22:00:00+08:00 2025-10-15T02:00:00+08:00 path is not ready"}},
+		},
+		{
+			"weekly window of the previous day",
+			conf.RecordSchedules{{
+				ID:    "weekly",
+				Type:  conf.RecordScheduleTypeWeekly,
+				Start: "22:00",
+				End:   "02:00",
+				Days:  []string{"wed"},
+			}},
+			false,
+			[]time.Time{at(15, 1, 0)},
+			[]string{""},
+			[][]string{nil},
+		},
+		{
+			"overlapping rules",
+			conf.RecordSchedules{hourly, {
+				ID:    "afternoon",
+				Type:  conf.RecordScheduleTypeWeekly,
+				Start: "14:15",
+				End:   "15:00",
+			}},
+			true,
+			[]time.Time{at(15, 14, 10), at(15, 14, 20), at(15, 14, 50)},
+			[]string{
+				"",
+				"2025-10-15T14:15:00+08:00 2025-10-15T15:00:00+08:00 path is already recording",
+			},
+			[][]string{
+				{"2025-10-15T14:00:00+08:00 2025-10-15T14:45:00+08:00 path is already recording"},
+				nil,
+			},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			m := &Manager{
+				PathConfs:   map[string]*conf.Path{"cam1": {RecordSchedules: ca.rules}},
+				PathManager: notReadyPathManager{},
+				Parent:      test.NilLogger,
+				tasks:       make(map[string]*Task),
+				schedules:   make(map[string]*scheduleState),
+			}
+			if ca.recording {
+				m.tasks["cam1"] = &Task{ID: "manual", PathName: "cam1"}
+			}
+			m.syncSchedules()
+
+			for _, now := range ca.steps {
+				m.checkSchedules(now)
+			}
+
+			statuses := m.GetScheduleStatuses()
+			require.Len(t, statuses, len(ca.rules))
+
+			for i, status := range statuses {
+				require.Equal(t, ca.rules[i].ID, status.Rule.ID)
+				require.Equal(t, ca.current[i], scheduleRunString(status.Current), status.Rule.ID)
+				require.Equal(t, ca.current[i] != "", status.Active)
+				require.False(t, status.Recording)
+
+				var missed []string
+				for _, run := range status.Missed {
+					missed = append(missed, scheduleRunString(&run))
+				}
+				require.Equal(t, ca.missed[i], missed, status.Rule.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/google/uuid"
+)
+
+// sessionHistoryCount is the number of finished sessions kept in memory.
+// Their manifests are kept on disk anyway.
+const sessionHistoryCount = 50
+
+// ErrSessionNotFound is returned when a session doesn't exist or has been removed from memory.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionParams contains parameters for starting a recording session.
+type SessionParams struct {
+	Name           string   `json:"name"`
+	Paths          []string `json:"paths" binding:"required"`
+	VideoFormat    string   `json:"videoFormat" binding:"required"`
+	TaskOutMinutes float64  `json:"taskOutMinutes"`
+}
+
+// session is a group of tasks that record several paths against a shared time reference.
+type session struct {
+	id        string
+	name      string
+	format    string
+	paths     []string
+	startTime time.Time // shared reference, in wall clock time
+	endTime   *time.Time
+	tasks     map[string]*Task // key: pathName
+
+	// the shared reference in the NTP clock of the stream of each path:
+	// every file starts at the first keyframe at or after it.
+	references map[string]time.Time // key: pathName
+
+	// files written before a restart of the server, restored from the journal
+	previousFiles []SessionFile
+
+	manifestFullPath     string
+	manifestRelativePath string
+}
+
+// StartSession starts a recording task for each path of a session.
+// All tasks share the same start reference and the same timeout; if a task can't be started,
+// the tasks already started are stopped and no session is created.
+func (m *Manager) StartSession(params *SessionParams) (*SessionManifest, error) {
+	paths := make([]string, 0, len(params.Paths))
+	seen := make(map[string]struct{})
+	for _, pathName := range params.Paths {
+		if _, ok := seen[pathName]; ok {
+			continue
+		}
+		seen[pathName] = struct{}{}
+		paths = append(paths, pathName)
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("a session must contain at least one path")
+	}
+
+	// streams are read without the mutex, since it takes sessionClockWindow
+	clockOffsets := m.measureClockOffsets(paths)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// check every path before starting anything
+	for _, pathName := range paths {
+		pathData, err := m.PathManager.APIPathsGet(pathName)
+		if err != nil {
+			return nil, fmt.Errorf("path '%s' not found", pathName)
+		}
+
+		if !pathData.Ready {
+			return nil, fmt.Errorf("no one is publishing to path '%s'", pathName)
+		}
+
+		if _, exists := m.tasks[pathName]; exists {
+			return nil, fmt.Errorf("path '%s' is already recording", pathName)
+		}
+	}
+
+	if params.TaskOutMinutes <= 0 {
+		params.TaskOutMinutes = 30
+	}
+
+	s := &session{
+		id:         uuid.New().String(),
+		name:       params.Name,
+		format:     params.VideoFormat,
+		paths:      paths,
+		startTime:  time.Now(),
+		tasks:      make(map[string]*Task),
+		references: make(map[string]time.Time),
+	}
+	s.manifestFullPath, s.manifestRelativePath = sessionManifestPath(m.RecordPath, s.id, s.startTime)
+
+	for _, pathName := range paths {
+		s.references[pathName] = s.startTime.Add(clockOffsets[pathName])
+	}
+
+	for _, pathName := range paths {
+		var pathConf *conf.Path
+		if m.PathConfs != nil {
+			pathConf = m.PathConfs[pathName]
+		}
+
+		task := &Task{
+			ID:           uuid.New().String(),
+			PathName:     pathName,
+			Format:       params.VideoFormat,
+			RecordPath:   m.RecordPath,
+			Timeout:      time.Duration(params.TaskOutMinutes * float64(time.Minute)),
+			PathManager:  m.PathManager,
+			PathConf:     pathConf,
+			PathDefaults: m.PathDefaults,
+			Parent:       m,
+			SessionID:    s.id,
+			NotBefore:    s.references[pathName],
+		}
+
+		err := task.Start()
+		if err != nil {
+			m.stopSessionTasks(s)
+			return nil, fmt.Errorf("failed to start recording of path '%s': %w", pathName, err)
+		}
+
+		m.tasks[pathName] = task
+		s.tasks[pathName] = task
+	}
+
+	m.sessions[s.id] = s
+	m.saveJournal()
+
+	manifest := m.sessionManifest(s)
+
+	// the manifest is written at start too, in order to find the files of a session that was interrupted
+	err := writeSessionManifest(s.manifestFullPath, manifest)
+	if err != nil {
+		m.Log(logger.Warn, "failed to write manifest of session '%s': %v", s.id, err)
+	}
+
+	m.Log(logger.Info, "recording session '%s' started with paths %v", s.id, s.paths)
+
+	return manifest, nil
+}
+
+// measureClockOffsets returns the offset between the NTP timestamps of the stream of each path
+// and the wall clock. Streams are read in parallel; paths whose offset can't be measured are missing,
+// and the wall clock is used as their reference.
+func (m *Manager) measureClockOffsets(paths []string) map[string]time.Duration {
+	var mutex sync.Mutex
+	offsets := make(map[string]time.Duration)
+	var wg sync.WaitGroup
+
+	for _, pathName := range paths {
+		streamInterface, err := m.PathManager.GetStreamForRecording(pathName)
+		if err != nil {
+			continue
+		}
+
+		streamObj, ok := streamInterface.(*stream.Stream)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(pathName string) {
+			defer wg.Done()
+
+			offset, ok := streamClockOffset(streamObj, sessionClockWindow, m)
+			if !ok {
+				m.Log(logger.Debug, "path '%s' has no NTP timestamps, the session uses the wall clock", pathName)
+				return
+			}
+
+			mutex.Lock()
+			offsets[pathName] = offset
+			mutex.Unlock()
+		}(pathName)
+	}
+
+	wg.Wait()
+
+	return offsets
+}
+
+// reference returns the shared reference of a session in the clock of the stream of a path.
+func (s *session) reference(pathName string) time.Time {
+	if ref, ok := s.references[pathName]; ok {
+		return ref
+	}
+	return s.startTime
+}
+
+// StopSession stops all the tasks of a session together and writes the session manifest.
+func (m *Manager) StopSession(id string) (*SessionManifest, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	if s.endTime != nil {
+		return nil, fmt.Errorf("session '%s' is already finished", id)
+	}
+
+	m.Log(logger.Info, "stopping recording session '%s'", id)
+	m.stopSessionTasks(s)
+	m.finishSession(s)
+	m.saveJournal()
+
+	return m.sessionManifest(s), nil
+}
+
+// stopSessionTasks stops the running tasks of a session in parallel,
+// in order to end their files at the same time. Must be called with the mutex held.
+func (m *Manager) stopSessionTasks(s *session) {
+	var wg sync.WaitGroup
+
+	for pathName, task := range s.tasks {
+		if m.tasks[pathName] != task {
+			continue
+		}
+
+		wg.Add(1)
+		go func(task *Task) {
+			defer wg.Done()
+			task.Stop()
+		}(task)
+
+		delete(m.tasks, pathName)
+	}
+
+	wg.Wait()
+}
+
+// onSessionTaskEnded finishes the session of a task when all its tasks have ended.
+// Must be called with the mutex held, after the task has been removed.
+func (m *Manager) onSessionTaskEnded(task *Task) {
+	if task.SessionID == "" {
+		return
+	}
+
+	s, ok := m.sessions[task.SessionID]
+	if !ok || s.endTime != nil {
+		return
+	}
+
+	for pathName, t := range s.tasks {
+		if m.tasks[pathName] == t {
+			return
+		}
+	}
+
+	m.finishSession(s)
+}
+
+// finishSession marks a session as finished and writes its manifest. Must be called with the mutex held.
+func (m *Manager) finishSession(s *session) {
+	now := time.Now()
+	s.endTime = &now
+
+	err := writeSessionManifest(s.manifestFullPath, m.sessionManifest(s))
+	if err != nil {
+		m.Log(logger.Warn, "failed to write manifest of session '%s': %v", s.id, err)
+	} else {
+		m.Log(logger.Info, "recording session '%s' finished, manifest: %s", s.id, s.manifestFullPath)
+	}
+
+	m.trimSessions()
+}
+
+// trimSessions removes the oldest finished sessions from memory. Must be called with the mutex held.
+func (m *Manager) trimSessions() {
+	var finished []*session
+	for _, s := range m.sessions {
+		if s.endTime != nil {
+			finished = append(finished, s)
+		}
+	}
+
+	if len(finished) <= sessionHistoryCount {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].startTime.Before(finished[j].startTime)
+	})
+
+	for _, s := range finished[:len(finished)-sessionHistoryCount] {
+		delete(m.sessions, s.id)
+	}
+}
+
+// sessionManifest returns the manifest of a session. Must be called with the mutex held.
+func (m *Manager) sessionManifest(s *session) *SessionManifest {
+	manifest := &SessionManifest{
+		ID:           s.id,
+		Name:         s.name,
+		Format:       s.format,
+		Paths:        s.paths,
+		Active:       s.endTime == nil,
+		StartTime:    s.startTime,
+		EndTime:      s.endTime,
+		ManifestPath: s.manifestRelativePath,
+		ManifestURL:  m.baseURL + "/res" + s.manifestRelativePath,
+		Files:        []SessionFile{},
+	}
+
+	for _, pathName := range s.paths {
+		for _, f := range s.previousFiles {
+			if f.PathName == pathName {
+				manifest.Files = append(manifest.Files, f)
+			}
+		}
+
+		task, ok := s.tasks[pathName]
+		if !ok {
+			continue
+		}
+		manifest.Files = append(manifest.Files, sessionFiles(pathName, s.reference(pathName), task.Files(), m.baseURL)...)
+	}
+
+	return manifest
+}
+
+// journalSession returns the state of an active session to save in the journal.
+// Must be called with the mutex held.
+func (m *Manager) journalSession(s *session) journalSession {
+	return journalSession{
+		ID:           s.id,
+		Name:         s.name,
+		Format:       s.format,
+		Paths:        s.paths,
+		StartTime:    s.startTime,
+		References:   s.references,
+		ManifestPath: s.manifestRelativePath,
+		Files:        m.sessionManifest(s).Files,
+	}
+}
+
+// restoreSession restores a session found in the journal, before its tasks are resumed.
+// Must be called with the mutex held.
+func (m *Manager) restoreSession(e journalSession) {
+	m.sessions[e.ID] = &session{
+		id:                   e.ID,
+		name:                 e.Name,
+		format:               e.Format,
+		paths:                e.Paths,
+		startTime:            e.StartTime,
+		tasks:                make(map[string]*Task),
+		references:           e.References,
+		previousFiles:        e.Files,
+		manifestFullPath:     filepath.Join(m.RecordPath, e.ManifestPath),
+		manifestRelativePath: e.ManifestPath,
+	}
+}
+
+// GetSessions returns the active sessions and the most recent finished ones, newest first.
+func (m *Manager) GetSessions() []*SessionManifest {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	sessions := make([]*session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].startTime.After(sessions[j].startTime)
+	})
+
+	manifests := make([]*SessionManifest, 0, len(sessions))
+	for _, s := range sessions {
+		manifests = append(manifests, m.sessionManifest(s))
+	}
+
+	return manifests
+}
+
+// GetSession returns the manifest of a session.
+func (m *Manager) GetSession(id string) (*SessionManifest, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	return m.sessionManifest(s), nil
+}
@@ -0,0 +1,78 @@
+package recorder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+// sessionClockWindow is how long the streams of a session are read in order to measure their clocks.
+const sessionClockWindow = 500 * time.Millisecond
+
+// clockSampler measures the difference between the NTP timestamps of a stream and the wall clock.
+//
+// NTP timestamps are either estimated from the arrival time of the data (ntpestimator), and then lag
+// behind the wall clock by a variable amount, or taken from the source when 'useAbsoluteTimestamp' is
+// enabled, and then follow the clock of the source. In both cases, the wall clock time at which
+// a session starts must be translated into the clock of each stream before it is compared with
+// the timestamps of the stream.
+type clockSampler struct {
+	mutex  sync.Mutex
+	offset time.Duration
+	ok     bool
+}
+
+func (c *clockSampler) onUnit(u *unit.Unit, now time.Time) {
+	if u.NTP.IsZero() {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// the least delayed unit gives the best estimate. Cached key frames, that are replayed
+	// to new readers, are older than live units and are discarded too.
+	d := u.NTP.Sub(now)
+	if !c.ok || d > c.offset {
+		c.offset = d
+		c.ok = true
+	}
+}
+
+// result returns the offset between the NTP timestamps and the wall clock,
+// and false when no unit with a NTP timestamp has been received.
+func (c *clockSampler) result() (time.Duration, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.offset, c.ok
+}
+
+// streamClockOffset reads a stream for the given time and returns the offset between its NTP timestamps
+// and the wall clock.
+func streamClockOffset(strm *stream.Stream, window time.Duration, parent logger.Writer) (time.Duration, bool) {
+	c := &clockSampler{}
+
+	reader := &stream.Reader{
+		SkipBytesSent: true,
+		Parent:        parent,
+	}
+
+	for _, media := range strm.Desc.Medias {
+		for _, forma := range media.Formats {
+			reader.OnData(media, forma, func(u *unit.Unit) error {
+				c.onUnit(u, time.Now())
+				return nil
+			})
+		}
+	}
+
+	strm.AddReader(reader)
+	time.Sleep(window)
+	strm.RemoveReader(reader)
+
+	return c.result()
+}
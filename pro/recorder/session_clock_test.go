@@ -0,0 +1,35 @@
+package recorder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+func TestClockSampler(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	c := &clockSampler{}
+
+	_, ok := c.result()
+	require.False(t, ok)
+
+	// the clock of the source is 3s ahead of the wall clock
+	for _, u := range []struct {
+		ntp     time.Time
+		arrival time.Time
+	}{
+		{now.Add(1 * time.Second), now},                             // replayed key frame
+		{time.Time{}, now},                                          // no NTP timestamp
+		{now.Add(3 * time.Second), now.Add(100 * time.Millisecond)}, // delayed
+		{now.Add(3040 * time.Millisecond), now.Add(40 * time.Millisecond)},
+	} {
+		c.onUnit(&unit.Unit{NTP: u.ntp}, u.arrival)
+	}
+
+	offset, ok := c.result()
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, offset)
+}
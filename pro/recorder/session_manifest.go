@@ -0,0 +1,73 @@
+package recorder
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// SessionFile is a file of a recording session.
+type SessionFile struct {
+	PathName string     `json:"pathName"`
+	FileName string     `json:"fileName"`
+	FilePath string     `json:"filePath"`
+	FileURL  string     `json:"fileURL"`
+	StartNTP *time.Time `json:"startNTP,omitempty"` // NTP timestamp of the first sample of the file
+	Offset   *float64   `json:"offset,omitempty"`   // seconds between the session start time and the first sample
+}
+
+// SessionManifest describes a recording session.
+// The offset of each file allows to play the recordings of the session in sync.
+type SessionManifest struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name,omitempty"`
+	Format       string        `json:"format"`
+	Paths        []string      `json:"paths"`
+	Active       bool          `json:"active"`
+	StartTime    time.Time     `json:"startTime"` // shared reference of the session, offsets are relative to it
+	EndTime      *time.Time    `json:"endTime,omitempty"`
+	ManifestPath string        `json:"manifestPath"`
+	ManifestURL  string        `json:"manifestURL"`
+	Files        []SessionFile `json:"files"`
+}
+
+// sessionManifestPath returns the path of the manifest of a session.
+// Format: /YYYYMMDD/YYYYMMDD-HHMM-session-<shortid>.json
+func sessionManifestPath(recordPath string, id string, startTime time.Time) (fullPath, relativePath string) {
+	dateDir := startTime.Format("20060102")
+	fileName := fmt.Sprintf("%s-session-%s.json", startTime.Format("20060102-1504"), id[:8])
+
+	relativePath = filepath.Join("/", dateDir, fileName)
+	fullPath = filepath.Join(recordPath, dateDir, fileName)
+
+	return fullPath, relativePath
+}
+
+// sessionFiles returns the entries of the manifest for the files written by the task of a path.
+func sessionFiles(pathName string, startTime time.Time, files []RecordedFile, baseURL string) []SessionFile {
+	entries := make([]SessionFile, 0, len(files))
+
+	for _, f := range files {
+		entry := SessionFile{
+			PathName: pathName,
+			FileName: f.FileName,
+			FilePath: f.RelativePath,
+			FileURL:  baseURL + "/res" + f.RelativePath,
+			StartNTP: f.StartNTP,
+		}
+
+		if f.StartNTP != nil {
+			offset := f.StartNTP.Sub(startTime).Seconds()
+			entry.Offset = &offset
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// writeSessionManifest writes a manifest to disk.
+func writeSessionManifest(fullPath string, manifest *SessionManifest) error {
+	return writeJSONFile(fullPath, manifest)
+}
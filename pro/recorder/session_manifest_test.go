@@ -0,0 +1,77 @@
+package recorder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionFiles(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	ntp1 := start.Add(1500 * time.Millisecond)
+	ntp2 := start.Add(2 * time.Minute)
+
+	files := sessionFiles("endoscope", start, []RecordedFile{
+		{FileName: "a.mp4", RelativePath: "/20260301/a.mp4", StartNTP: &ntp1},
+		{FileName: "b.mp4", RelativePath: "/20260301/b.mp4", StartNTP: &ntp2},
+		{FileName: "c.mp4", RelativePath: "/20260301/c.mp4"},
+	}, "http://localhost:9997")
+
+	require.Len(t, files, 3)
+
+	require.Equal(t, "endoscope", files[0].PathName)
+	require.Equal(t, "http://localhost:9997/res/20260301/a.mp4", files[0].FileURL)
+	require.NotNil(t, files[0].Offset)
+	require.Equal(t, 1.5, *files[0].Offset)
+
+	require.NotNil(t, files[1].Offset)
+	require.Equal(t, 120.0, *files[1].Offset)
+
+	// nothing has been written into the file
+	require.Nil(t, files[2].StartNTP)
+	require.Nil(t, files[2].Offset)
+}
+
+func TestWriteSessionManifest(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC)
+
+	fullPath, relativePath := sessionManifestPath(dir, "0123456789abcdef", start)
+	require.Equal(t, filepath.Join("/", "20260301", "20260301-1005-session-01234567.json"), relativePath)
+	require.Equal(t, filepath.Join(dir, "20260301", "20260301-1005-session-01234567.json"), fullPath)
+
+	offset := 0.04
+	manifest := &SessionManifest{
+		ID:        "0123456789abcdef",
+		Format:    "mp4",
+		Paths:     []string{"endoscope", "room"},
+		StartTime: start,
+		Files: []SessionFile{
+			{PathName: "endoscope", FileName: "a.mp4", Offset: &offset},
+		},
+	}
+
+	err := writeSessionManifest(fullPath, manifest)
+	require.NoError(t, err)
+
+	// the manifest is replaced when the session ends
+	manifest.Files = append(manifest.Files, SessionFile{PathName: "room", FileName: "b.mp4"})
+
+	err = writeSessionManifest(fullPath, manifest)
+	require.NoError(t, err)
+
+	buf, err := os.ReadFile(fullPath)
+	require.NoError(t, err)
+
+	var decoded SessionManifest
+	err = json.Unmarshal(buf, &decoded)
+	require.NoError(t, err)
+	require.Equal(t, *manifest, decoded)
+
+	_, err = os.Stat(fullPath + ".tmp")
+	require.True(t, os.IsNotExist(err))
+}
@@ -1,25 +1,52 @@
 package recorder
 
 import (
-	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
-	"github.com/bluenviron/mediamtx/internal/recorder"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/pro/webhook"
+	"github.com/google/uuid"
 )
 
 type taskParent interface {
 	logger.Writer
 	OnTaskComplete(pathName string)
+	getPreBuffer(pathName string, s *stream.Stream) *PreBuffer
+	enqueueWebhook(event string, url string, payload interface{})
+	onFileClosed(fullPath string)
+	onTaskEvent(e RecordingEvent)
 }
 
+// PausedInterval is an interval during which a task was paused.
+type PausedInterval struct {
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"` // nil while the task is paused
+}
+
+// RecordedFile is a file written by a task. A task writes a new file each time the recorder is restarted.
+type RecordedFile struct {
+	FileName     string     `json:"fileName"`
+	RelativePath string     `json:"filePath"`
+	FullPath     string     `json:"fullPath"`
+	StartNTP     *time.Time `json:"startNTP,omitempty"` // NTP timestamp of the first sample, nil if nothing was written
+}
+
+// pausedCheckInterval is the interval between timeout checks while a task is paused.
+const pausedCheckInterval = time.Hour
+
+// metadataInterval is the interval between updates of the metadata of the file being written.
+const metadataInterval = 2 * time.Second
+
 // Task represents a recording task.
 type Task struct {
 	ID             string
@@ -32,32 +59,59 @@ type Task struct {
 	PathConf       *conf.Path // Path-specific configuration (for sourceName)
 	PathDefaults   *conf.Path // PathDefaults configuration (for webhook URL)
 	Parent         taskParent
-	IsAutoRecord   bool // 是否为自动录制（true=自动录制，false=API调用）
+	IsAutoRecord   bool   // 是否为自动录制（true=自动录制，false=API调用）
+	ScheduleID     string // 启动该任务的定时录制规则 ID（为空表示非定时录制）
+	SessionID      string // 所属录制会话 ID（为空表示不属于会话）
+
+	// NotBefore is the shared reference of a session: files start at the first keyframe at or after it.
+	NotBefore time.Time
+
+	// PreviousFiles are the files written before a restart of the server, oldest first.
+	// A resumed task continues into a new file.
+	PreviousFiles []string
 
 	// Runtime fields
 	FileName     string
 	FullPath     string
 	RelativePath string
 	FileURL      string
-	EndTime      time.Time
-	StartTime    time.Time
-
-	recorder      *recorder.Recorder // For TS format
-	mp4Recorder   *MP4Recorder       // For MP4 format
-	retryCount    int                // 重试次数
-	maxRetries    int                // 最大重试次数
-	retryInterval time.Duration      // 重试间隔
+	EndTime      time.Time // 暂停时长不计入 Timeout，恢复时顺延
+	StartTime    time.Time // 恢复的任务保留原始开始时间
+
+	// PreBufferDepth is the buffered content written at the start of the file.
+	PreBufferDepth time.Duration
+
+	tsRecorder    *TSRecorder   // For TS format
+	mp4Recorder   *MP4Recorder  // For MP4 format
+	retryCount    int           // 重试次数
+	maxRetries    int           // 最大重试次数
+	retryInterval time.Duration // 重试间隔
+
+	// mutex protects the pause state, EndTime, the recorders, the file list and the bookmarks,
+	// which are accessed by both the run goroutine and Pause/Resume.
+	mutex           sync.Mutex
+	paused          bool
+	pausedIntervals []PausedInterval
+	stateChanged    chan struct{}
+	files           []RecordedFile
+	bookmarks       []Bookmark
 
 	terminate       chan struct{}
 	done            chan struct{}
 	stopRequested   bool       // 标记是否有明确的外部 stop 调用
 	recorderErrors  chan error // 录制器错误通道
 	webhookNotified bool       // 标记是否已经调用过 webhook
+
+	// file and duration of the last metadata written, used by the run goroutine only
+	metadataPath     string
+	metadataDuration float64
 }
 
 // Start starts the recording task.
 func (t *Task) Start() error {
-	t.StartTime = time.Now()
+	if t.StartTime.IsZero() {
+		t.StartTime = time.Now()
+	}
 	t.EndTime = t.StartTime.Add(t.Timeout)
 	t.maxRetries = 100                // 最大重试100次（基本上会一直重试直到timeout）
 	t.retryInterval = 5 * time.Second // 重试间隔5秒
@@ -77,6 +131,12 @@ func (t *Task) Start() error {
 		if filepath.Ext(t.FileName) == "" {
 			t.FileName = t.FileName + "." + ext
 		}
+
+		// 恢复的任务写入新文件，避免覆盖重启前的文件
+		if len(t.PreviousFiles) != 0 {
+			ext = filepath.Ext(t.FileName)
+			t.FileName = fmt.Sprintf("%s-resume%d%s", t.FileName[:len(t.FileName)-len(ext)], len(t.PreviousFiles), ext)
+		}
 	} else {
 		t.FileName = generateFileName(t.Format)
 	}
@@ -93,6 +153,7 @@ func (t *Task) Start() error {
 
 	t.terminate = make(chan struct{})
 	t.done = make(chan struct{})
+	t.stateChanged = make(chan struct{}, 1)
 
 	// Start recording goroutine (will handle retries)
 	go t.run()
@@ -111,6 +172,270 @@ func (t *Task) Stop() {
 	<-t.done
 }
 
+// Pause pauses the recording. The output file is kept open and samples are dropped until Resume is called.
+// The paused time doesn't count against Timeout.
+func (t *Task) Pause() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.paused {
+		return fmt.Errorf("recording of path '%s' is already paused", t.PathName)
+	}
+
+	t.paused = true
+	t.pausedIntervals = append(t.pausedIntervals, PausedInterval{Start: time.Now()})
+
+	if t.mp4Recorder != nil {
+		t.mp4Recorder.Pause()
+	}
+	if t.tsRecorder != nil {
+		t.tsRecorder.Pause()
+	}
+
+	t.notifyStateChanged()
+
+	t.Log(logger.Info, "recording paused for path '%s'", t.PathName)
+	return nil
+}
+
+// Resume resumes a paused recording. Writing restarts from the next keyframe, in the same file,
+// and EndTime is extended by the paused time.
+func (t *Task) Resume() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.paused {
+		return fmt.Errorf("recording of path '%s' is not paused", t.PathName)
+	}
+
+	now := time.Now()
+	interval := &t.pausedIntervals[len(t.pausedIntervals)-1]
+	interval.End = &now
+
+	t.paused = false
+	t.EndTime = t.EndTime.Add(now.Sub(interval.Start))
+
+	if t.mp4Recorder != nil {
+		t.mp4Recorder.Resume()
+	}
+	if t.tsRecorder != nil {
+		t.tsRecorder.Resume()
+	}
+
+	t.notifyStateChanged()
+
+	t.Log(logger.Info, "recording resumed for path '%s', new end time: %s",
+		t.PathName, t.EndTime.Format(time.RFC3339))
+	return nil
+}
+
+// PauseState returns whether the task is paused, its paused intervals and the total paused time.
+func (t *Task) PauseState() (bool, []PausedInterval, time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	intervals := make([]PausedInterval, len(t.pausedIntervals))
+	copy(intervals, t.pausedIntervals)
+
+	var total time.Duration
+	for _, interval := range intervals {
+		if interval.End != nil {
+			total += interval.End.Sub(interval.Start)
+		} else {
+			total += time.Since(interval.Start)
+		}
+	}
+
+	return t.paused, intervals, total
+}
+
+// restorePause restores the pause state of a task found in the journal. Must be called before Start.
+func (t *Task) restorePause(paused bool, intervals []PausedInterval) {
+	t.paused = paused
+	t.pausedIntervals = intervals
+}
+
+// journalEntry returns the state of the task to save in the journal.
+func (t *Task) journalEntry() journalEntry {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	files := append([]string{}, t.PreviousFiles...)
+	for _, f := range t.files {
+		files = append(files, f.RelativePath)
+	}
+
+	return journalEntry{
+		ID:              t.ID,
+		PathName:        t.PathName,
+		Format:          t.Format,
+		CustomFileName:  t.CustomFileName,
+		IsAutoRecord:    t.IsAutoRecord,
+		ScheduleID:      t.ScheduleID,
+		SessionID:       t.SessionID,
+		StartTime:       t.StartTime,
+		EndTime:         t.EndTime,
+		Paused:          t.paused,
+		PausedIntervals: append([]PausedInterval{}, t.pausedIntervals...),
+		Files:           files,
+	}
+}
+
+// Files returns the files written by the task.
+func (t *Task) Files() []RecordedFile {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	files := make([]RecordedFile, len(t.files))
+	copy(files, t.files)
+
+	// the last file may still be written by the running recorder
+	if len(files) != 0 && files[len(files)-1].StartNTP == nil {
+		var firstNTP time.Time
+		if t.mp4Recorder != nil {
+			firstNTP = t.mp4Recorder.FirstNTP()
+		} else if t.tsRecorder != nil {
+			firstNTP = t.tsRecorder.FirstNTP()
+		}
+		if !firstNTP.IsZero() {
+			files[len(files)-1].StartNTP = &firstNTP
+		}
+	}
+
+	return files
+}
+
+// AddBookmark marks the current media time of the file being written.
+// The bookmarks of a file are saved into its sidecar file, and into the file itself when it is closed.
+func (t *Task) AddBookmark(label string, data json.RawMessage) (*Bookmark, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var filePath string
+	var position time.Duration
+
+	switch {
+	case t.mp4Recorder != nil:
+		filePath = t.mp4Recorder.FilePath
+		position = t.mp4Recorder.Position()
+	case t.tsRecorder != nil:
+		filePath = t.tsRecorder.FilePath
+		position = t.tsRecorder.Position()
+	}
+
+	// the recorder is added to the file list once it has been initialized
+	if len(t.files) == 0 || t.files[len(t.files)-1].FullPath != filePath {
+		return nil, fmt.Errorf("recording of path '%s' has no file being written", t.PathName)
+	}
+	file := t.files[len(t.files)-1]
+
+	if len(data) != 0 && !json.Valid(data) {
+		return nil, fmt.Errorf("bookmark data is not valid JSON")
+	}
+
+	b := Bookmark{
+		ID:        uuid.New().String(),
+		TaskID:    t.ID,
+		PathName:  t.PathName,
+		FilePath:  filepath.ToSlash(file.RelativePath),
+		Offset:    position.Round(time.Millisecond).Seconds(),
+		Label:     label,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+	t.bookmarks = append(t.bookmarks, b)
+
+	err := writeBookmarks(file.FullPath, b.FilePath, t.fileBookmarks(file.FullPath))
+	if err != nil {
+		t.bookmarks = t.bookmarks[:len(t.bookmarks)-1]
+		return nil, fmt.Errorf("failed to save bookmark: %w", err)
+	}
+
+	t.Log(logger.Info, "bookmark '%s' added to %s at %.3fs", label, file.RelativePath, b.Offset)
+
+	return &b, nil
+}
+
+// Bookmarks returns the bookmarks added to the task.
+func (t *Task) Bookmarks() []Bookmark {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]Bookmark{}, t.bookmarks...)
+}
+
+// fileBookmarks returns the bookmarks of a file. Must be called with the mutex held.
+func (t *Task) fileBookmarks(fullPath string) []Bookmark {
+	relativePath := filepath.ToSlash(t.relativePathOf(fullPath))
+
+	var ret []Bookmark
+	for _, b := range t.bookmarks {
+		if b.FilePath == relativePath {
+			ret = append(ret, b)
+		}
+	}
+	return ret
+}
+
+// relativePathOf returns the relative path of a file written by the task. Must be called with the mutex held.
+func (t *Task) relativePathOf(fullPath string) string {
+	for _, f := range t.files {
+		if f.FullPath == fullPath {
+			return f.RelativePath
+		}
+	}
+	return ""
+}
+
+// writeChapters writes the bookmarks of a closed MP4 file into the file.
+func (t *Task) writeChapters(fullPath string) {
+	t.mutex.Lock()
+	bookmarks := t.fileBookmarks(fullPath)
+	t.mutex.Unlock()
+
+	err := writeMP4Chapters(fullPath, bookmarks)
+	if err != nil {
+		if errors.Is(err, errMoovNotLast) {
+			t.Log(logger.Info, "chapters can't be written into fragmented file %s, bookmarks are kept in %s",
+				fullPath, BookmarksPath(fullPath))
+		} else {
+			t.Log(logger.Warn, "failed to write chapters into %s: %v", fullPath, err)
+		}
+		return
+	}
+
+	if len(bookmarks) != 0 {
+		t.Log(logger.Info, "%d chapters written into %s", len(bookmarks), fullPath)
+	}
+}
+
+func (t *Task) notifyStateChanged() {
+	select {
+	case t.stateChanged <- struct{}{}:
+	default:
+	}
+}
+
+// timedOut returns whether the task reached its end time. Paused tasks never time out.
+func (t *Task) timedOut() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return !t.paused && !time.Now().Before(t.EndTime)
+}
+
+// remainingTime returns the time left before the end of the task.
+func (t *Task) remainingTime() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// the timer is reset when the task is resumed
+	if t.paused {
+		return pausedCheckInterval
+	}
+	return time.Until(t.EndTime)
+}
+
 // Log implements logger.Writer.
 func (t *Task) Log(level logger.Level, format string, args ...interface{}) {
 	t.Parent.Log(level, format, args...)
@@ -119,13 +444,16 @@ func (t *Task) Log(level logger.Level, format string, args ...interface{}) {
 func (t *Task) run() {
 	defer close(t.done)
 	defer close(t.recorderErrors)
+	defer func() {
+		t.emitEvent(RecordingEventStop, t.stopReason(), nil)
+	}()
 
-	// 计算总的结束时间
-	absoluteEndTime := time.Now().Add(t.Timeout)
+	metadataTicker := time.NewTicker(metadataInterval)
+	defer metadataTicker.Stop()
 
 	for {
-		// 检查是否已经超时
-		if time.Now().After(absoluteEndTime) {
+		// 检查是否已经超时（暂停期间不会超时）
+		if t.timedOut() {
 			t.Log(logger.Info, "recording timeout for path '%s'", t.PathName)
 			t.Parent.OnTaskComplete(t.PathName)
 			return
@@ -144,6 +472,7 @@ func (t *Task) run() {
 		err := t.startRecorder()
 		if err != nil {
 			t.Log(logger.Warn, "failed to start recorder for path '%s': %v", t.PathName, err)
+			t.emitEvent(RecordingEventError, "", err)
 
 			// 如果是外部停止请求，不重试
 			if t.stopRequested {
@@ -175,65 +504,82 @@ func (t *Task) run() {
 		}
 
 		// 录制器启动成功，等待其运行
-		remainingTime := time.Until(absoluteEndTime)
-		if remainingTime <= 0 {
+		t.emitEvent(RecordingEventStart, "", nil)
+
+		if t.timedOut() {
 			t.Log(logger.Info, "recording timeout for path '%s'", t.PathName)
 			t.closeRecorders()
 			t.Parent.OnTaskComplete(t.PathName)
 			return
 		}
 
-		timeoutTimer := time.NewTimer(remainingTime)
-
-		select {
-		case <-timeoutTimer.C:
-			// 正常超时结束
-			t.Log(logger.Info, "recording completed (timeout) for path '%s'", t.PathName)
-			t.closeRecorders()
-			t.Parent.OnTaskComplete(t.PathName)
-			timeoutTimer.Stop()
-			return
+		timeoutTimer := time.NewTimer(t.remainingTime())
 
-		case err := <-t.recorderErrors:
-			// 录制过程中出错
-			timeoutTimer.Stop()
-			t.closeRecorders()
+	waitLoop:
+		for {
+			select {
+			case <-timeoutTimer.C:
+				// 暂停或恢复后结束时间可能已经改变
+				if !t.timedOut() {
+					timeoutTimer.Reset(t.remainingTime())
+					continue
+				}
+
+				// 正常超时结束
+				t.Log(logger.Info, "recording completed (timeout) for path '%s'", t.PathName)
+				t.closeRecorders()
+				t.Parent.OnTaskComplete(t.PathName)
+				return
 
-			t.Log(logger.Error, "recorder error for path '%s': %v", t.PathName, err)
+			case <-t.stateChanged:
+				// 暂停或恢复，重新计算剩余时间
+				timeoutTimer.Reset(t.remainingTime())
 
-			// 如果是外部停止请求，不重试
-			if t.stopRequested {
-				return
-			}
+			case <-metadataTicker.C:
+				t.updateMetadata()
 
-			// 检查是否还能重试
-			if t.retryCount >= t.maxRetries {
-				t.Log(logger.Error, "max retries reached for path '%s' after error, giving up", t.PathName)
-				t.Parent.OnTaskComplete(t.PathName)
-				return
-			}
+			case err := <-t.recorderErrors:
+				// 录制过程中出错
+				timeoutTimer.Stop()
+				t.closeRecorders()
 
-			t.retryCount++
-			t.Log(logger.Info, "will retry recording for path '%s' after error in %v (attempt %d/%d)",
-				t.PathName, t.retryInterval, t.retryCount, t.maxRetries)
+				t.Log(logger.Error, "recorder error for path '%s': %v", t.PathName, err)
+				t.emitEvent(RecordingEventError, "", err)
+
+				// 如果是外部停止请求，不重试
+				if t.stopRequested {
+					return
+				}
+
+				// 检查是否还能重试
+				if t.retryCount >= t.maxRetries {
+					t.Log(logger.Error, "max retries reached for path '%s' after error, giving up", t.PathName)
+					t.Parent.OnTaskComplete(t.PathName)
+					return
+				}
+
+				t.retryCount++
+				t.Log(logger.Info, "will retry recording for path '%s' after error in %v (attempt %d/%d)",
+					t.PathName, t.retryInterval, t.retryCount, t.maxRetries)
+
+				// 等待重试间隔
+				select {
+				case <-time.After(t.retryInterval):
+					// 为重试生成新的文件名，避免覆盖已经完成的文件
+					t.generateNewFileName()
+					break waitLoop // 重试
+				case <-t.terminate:
+					t.Log(logger.Info, "recording terminated during error retry wait for path '%s'", t.PathName)
+					return
+				}
 
-			// 等待重试间隔
-			select {
-			case <-time.After(t.retryInterval):
-				// 为重试生成新的文件名，避免覆盖已经完成的文件
-				t.generateNewFileName()
-				continue // 重试
 			case <-t.terminate:
-				t.Log(logger.Info, "recording terminated during error retry wait for path '%s'", t.PathName)
+				// 外部停止请求
+				t.Log(logger.Info, "recording terminated for path '%s'", t.PathName)
+				timeoutTimer.Stop()
+				t.closeRecorders()
 				return
 			}
-
-		case <-t.terminate:
-			// 外部停止请求
-			t.Log(logger.Info, "recording terminated for path '%s'", t.PathName)
-			timeoutTimer.Stop()
-			t.closeRecorders()
-			return
 		}
 	}
 }
@@ -261,51 +607,173 @@ func (t *Task) startRecorder() error {
 		return fmt.Errorf("failed to cast stream object")
 	}
 
-	// 根据格式启动相应的录制器
+	// 仅首次启动时使用预录缓存，重试生成的新文件从实时流开始。
+	// 会话任务从共同的参考时间开始，不使用预录缓存
+	var preBuffer *PreBuffer
+	if t.retryCount == 0 && t.NotBefore.IsZero() {
+		preBuffer = t.Parent.getPreBuffer(t.PathName, streamObj)
+		if preBuffer != nil {
+			t.PreBufferDepth = preBuffer.Depth()
+		}
+	}
+
+	// 根据格式启动相应的录制器，任务暂停时录制器以暂停状态启动
 	if t.Format == "mp4" {
-		t.mp4Recorder = &MP4Recorder{
-			Stream:   streamObj,
-			FilePath: t.FullPath,
-			Parent:   t,
-			ErrorCh:  t.recorderErrors, // 传递错误通道
+		rec := &MP4Recorder{
+			Stream:     streamObj,
+			PreBuffer:  preBuffer,
+			FilePath:   t.FullPath,
+			Fragmented: t.fragmentedMP4(),
+			NotBefore:  t.NotBefore,
+			Parent:     t,
+			ErrorCh:    t.recorderErrors, // 传递错误通道
 		}
-		err = t.mp4Recorder.Initialize()
+
+		t.mutex.Lock()
+		if t.paused {
+			rec.Pause()
+		}
+		t.mp4Recorder = rec
+		t.mutex.Unlock()
+
+		err = rec.Initialize()
 		if err != nil {
+			t.mutex.Lock()
 			t.mp4Recorder = nil
+			t.mutex.Unlock()
 			return fmt.Errorf("failed to initialize MP4 recorder: %w", err)
 		}
 	} else {
-		t.recorder = &recorder.Recorder{
-			PathFormat:      t.FullPath,
-			Format:          conf.RecordFormatMPEGTS,
-			PartDuration:    t.Timeout,
-			MaxPartSize:     conf.StringSize(100 * 1024 * 1024),
-			SegmentDuration: t.Timeout,
-			PathName:        t.PathName,
-			Stream:          streamObj,
-			Parent:          t,
+		rec := &TSRecorder{
+			Stream:    streamObj,
+			PreBuffer: preBuffer,
+			FilePath:  t.FullPath,
+			NotBefore: t.NotBefore,
+			Parent:    t,
+			ErrorCh:   t.recorderErrors, // 传递错误通道
+		}
+
+		t.mutex.Lock()
+		if t.paused {
+			rec.Pause()
+		}
+		t.tsRecorder = rec
+		t.mutex.Unlock()
+
+		err = rec.Initialize()
+		if err != nil {
+			t.mutex.Lock()
+			t.tsRecorder = nil
+			t.mutex.Unlock()
+			return fmt.Errorf("failed to initialize TS recorder: %w", err)
 		}
-		t.recorder.Initialize()
 	}
 
+	t.mutex.Lock()
+	t.files = append(t.files, RecordedFile{
+		FileName:     t.FileName,
+		RelativePath: t.RelativePath,
+		FullPath:     t.FullPath,
+	})
+	t.mutex.Unlock()
+
 	t.Log(logger.Info, "recorder started successfully for path '%s'", t.PathName)
 
 	// Call webhook if configured (only once per task)
-	go t.callRecordCreateWebhook()
+	t.callRecordCreateWebhook()
 
 	return nil
 }
 
+// fragmentedMP4 returns whether the MP4 file is written in fragmented (crash-safe) mode.
+// Paths without a dedicated configuration use pathDefaults.
+func (t *Task) fragmentedMP4() bool {
+	if t.PathConf != nil {
+		return t.PathConf.RecordMP4Fragmented
+	}
+	return t.PathDefaults != nil && t.PathDefaults.RecordMP4Fragmented
+}
+
 // closeRecorders 关闭录制器
 func (t *Task) closeRecorders() {
-	if t.mp4Recorder != nil {
-		t.mp4Recorder.Close()
-		t.mp4Recorder = nil
+	t.mutex.Lock()
+	mp4Recorder, tsRecorder := t.mp4Recorder, t.tsRecorder
+	t.mp4Recorder, t.tsRecorder = nil, nil
+	t.mutex.Unlock()
+
+	var filePath string
+	var md *recordstore.Metadata
+
+	if mp4Recorder != nil {
+		mp4Recorder.Close()
+		filePath = mp4Recorder.FilePath
+		md = mp4Recorder.Metadata()
+		t.writeChapters(mp4Recorder.FilePath)
 	}
-	if t.recorder != nil {
-		t.recorder.Close()
-		t.recorder = nil
+	if tsRecorder != nil {
+		tsRecorder.Close()
+		filePath = tsRecorder.FilePath
+		md = tsRecorder.Metadata()
 	}
+
+	// the recorder that has just been closed wrote the last file
+	if md != nil {
+		firstNTP := md.Start
+
+		t.mutex.Lock()
+		if len(t.files) != 0 {
+			t.files[len(t.files)-1].StartNTP = &firstNTP
+		}
+		t.mutex.Unlock()
+
+		t.writeMetadata(filePath, md)
+	}
+
+	if filePath != "" {
+		t.Parent.onFileClosed(filePath)
+	}
+}
+
+// updateMetadata writes the metadata of the file being written, once its first sample has been written,
+// and then each time it grows, so that files that are being written, or that are interrupted by a crash,
+// can be found by the playback server.
+func (t *Task) updateMetadata() {
+	t.mutex.Lock()
+	mp4Recorder, tsRecorder := t.mp4Recorder, t.tsRecorder
+	t.mutex.Unlock()
+
+	var filePath string
+	var md *recordstore.Metadata
+
+	if mp4Recorder != nil {
+		filePath = mp4Recorder.FilePath
+		md = mp4Recorder.Metadata()
+	}
+	if tsRecorder != nil {
+		filePath = tsRecorder.FilePath
+		md = tsRecorder.Metadata()
+	}
+
+	if md == nil || (filePath == t.metadataPath && md.Duration == t.metadataDuration) {
+		return
+	}
+
+	t.writeMetadata(filePath, md)
+}
+
+// writeMetadata saves path name, start, duration and parts of a file,
+// that are used by the playback server to find recordings.
+func (t *Task) writeMetadata(fullPath string, md *recordstore.Metadata) {
+	md.PathName = t.PathName
+
+	err := recordstore.WriteMetadata(fullPath, md)
+	if err != nil {
+		t.Log(logger.Warn, "failed to write metadata of %s: %v", fullPath, err)
+		return
+	}
+
+	t.metadataPath = fullPath
+	t.metadataDuration = md.Duration
 }
 
 // generateNewFileName 为重试生成新的文件名
@@ -343,7 +811,19 @@ func (t *Task) generateNewFileName() {
 	t.Log(logger.Info, "generated new filename for retry: %s", t.FileName)
 }
 
-// callRecordCreateWebhook calls the record create webhook if configured.
+// recordCreatePayload is the payload of the record create webhook.
+type recordCreatePayload struct {
+	ResType   string `json:"resType"`
+	ResID     int    `json:"resId"`
+	ResName   string `json:"resName"`
+	ResDesc   string `json:"resDesc"`
+	PathName  string `json:"pathName"`
+	Thumbnail string `json:"thumbnail"`
+	ResPath   string `json:"resPath"`
+}
+
+// callRecordCreateWebhook queues the record create webhook if configured.
+// The delivery is retried by the webhook outbox until the receiver accepts it.
 func (t *Task) callRecordCreateWebhook() {
 	// Check if webhook is configured in PathDefaults
 	if t.PathDefaults == nil || t.PathDefaults.RecordCreateWebhook == "" {
@@ -364,45 +844,12 @@ func (t *Task) callRecordCreateWebhook() {
 		resName = *t.PathConf.SourceName + "-" + t.FileName
 	}
 
-	// Convert file path to slash format for consistency
-	filePath := filepath.ToSlash(t.RelativePath)
-
-	// Prepare JSON payload
-	jsonData := []byte(fmt.Sprintf(
-		`{"resType":"VIDEO","resId":0,"resName":"%s","resDesc":"%s","pathName":"%s","thumbnail":"","resPath":"%s"}`,
-		resName,
-		t.PathName,
-		t.PathName,
-		filePath,
-	))
-
-	t.Log(logger.Info, "calling record create webhook: %s", t.PathDefaults.RecordCreateWebhook)
-
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 1500 * time.Millisecond,
-	}
-
-	// Create POST request
-	req, err := http.NewRequest("POST", t.PathDefaults.RecordCreateWebhook, bytes.NewBuffer(jsonData))
-	if err != nil {
-		t.Log(logger.Error, "failed to create webhook request: %v", err)
-		return
-	}
-
-	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
-
-	// Send request
-	resp, err := client.Do(req)
-	if err != nil {
-		t.Log(logger.Error, "webhook request failed: %v", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		t.Log(logger.Info, "webhook called successfully, status: %d", resp.StatusCode)
-	} else {
-		t.Log(logger.Warn, "webhook returned non-success status: %d", resp.StatusCode)
-	}
+	t.Parent.enqueueWebhook(webhook.EventRecordCreate, t.PathDefaults.RecordCreateWebhook, &recordCreatePayload{
+		ResType:  "VIDEO",
+		ResName:  resName,
+		ResDesc:  t.PathName,
+		PathName: t.PathName,
+		// Convert file path to slash format for consistency
+		ResPath: filepath.ToSlash(t.RelativePath),
+	})
 }
@@ -0,0 +1,28 @@
+package recorder
+
+import (
+	"time"
+)
+
+// multiplyAndDivide computes v*m/d without overflowing when v is large.
+func multiplyAndDivide[T int64 | time.Duration](v, m, d T) T {
+	secs := v / d
+	dec := v % d
+	return (secs*m + dec*m/d)
+}
+
+func timestampToDuration(t int64, clockRate int) time.Duration {
+	return multiplyAndDivide(time.Duration(t), time.Second, time.Duration(clockRate))
+}
+
+func durationToTimestamp(d time.Duration, clockRate int) int64 {
+	return int64(multiplyAndDivide(d, time.Duration(clockRate), time.Second))
+}
+
+// addToNTP adds a duration to a NTP timestamp. Missing timestamps are left unset.
+func addToNTP(ntp time.Time, d time.Duration) time.Time {
+	if ntp.IsZero() {
+		return ntp
+	}
+	return ntp.Add(d)
+}
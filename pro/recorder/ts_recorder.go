@@ -0,0 +1,373 @@
+package recorder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+const (
+	tsBufferSize    = 64 * 1024
+	tsFlushInterval = 1 * time.Second
+)
+
+// TSRecorder records stream to a single MPEG-TS file.
+// It replaces the recorder of the standard record path (internal/recorder), that reads the stream directly
+// and splits files into segments, in order to start from the pre-event buffer and to support pauses.
+// Samples are written in the same way, as checked by TestTSRecorderMatchesUpstream.
+type TSRecorder struct {
+	Stream    *stream.Stream
+	PreBuffer *PreBuffer // optional, the file starts at the oldest buffered keyframe
+	FilePath  string
+	NotBefore time.Time // optional, the file starts at the first keyframe at or after this NTP time
+	Parent    logger.Writer
+	ErrorCh   chan<- error // 错误通道，用于通知外部录制错误
+
+	file        *os.File
+	bw          *bufio.Writer
+	mw          *mpegts.Writer
+	source      *unitSource
+	initialized bool
+	mutex       sync.Mutex
+
+	waitVideo bool          // stream has a video track, audio is dropped until its first keyframe
+	started   bool          // first sample has been written
+	firstNTP  time.Time     // NTP timestamp of the first sample
+	startDTS  time.Duration // timestamp of the first sample
+	position  time.Duration // media time of the last written sample
+	lastFlush time.Duration // timestamp of the last flush to disk
+
+	pause pauseTimeline
+
+	terminate chan struct{}
+	done      chan struct{}
+}
+
+// Initialize initializes the TS recorder.
+func (r *TSRecorder) Initialize() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.initialized {
+		return nil
+	}
+
+	r.source = &unitSource{
+		Stream:    r.Stream,
+		PreBuffer: r.PreBuffer,
+		NotBefore: r.NotBefore,
+		Parent:    r,
+	}
+
+	var tracks []*mpegts.Track
+
+	for _, media := range r.Stream.Desc.Medias {
+		for _, forma := range media.Formats {
+			track := r.setupTrack(media, forma)
+			if track != nil {
+				tracks = append(tracks, track)
+			} else {
+				r.Log(logger.Warn, "skipping track with unsupported codec %s", forma.Codec())
+			}
+		}
+	}
+
+	if len(tracks) == 0 {
+		return fmt.Errorf("the stream doesn't contain any supported codec")
+	}
+
+	file, err := os.OpenFile(r.FilePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create TS file: %w", err)
+	}
+	r.file = file
+
+	r.bw = bufio.NewWriterSize(file, tsBufferSize)
+	r.mw = &mpegts.Writer{W: r.bw, Tracks: tracks}
+	err = r.mw.Initialize()
+	if err != nil {
+		file.Close()
+		os.Remove(r.FilePath)
+		return fmt.Errorf("failed to create TS muxer: %w", err)
+	}
+
+	err = r.source.start()
+	if err != nil {
+		file.Close()
+		os.Remove(r.FilePath)
+		return err
+	}
+
+	r.terminate = make(chan struct{})
+	r.done = make(chan struct{})
+	r.initialized = true
+
+	r.Log(logger.Info, "TS recorder initialized for %s", r.FilePath)
+
+	go r.run()
+
+	return nil
+}
+
+// Close closes the TS recorder.
+func (r *TSRecorder) Close() {
+	r.mutex.Lock()
+	if !r.initialized {
+		r.mutex.Unlock()
+		return
+	}
+	r.mutex.Unlock()
+
+	close(r.terminate)
+	<-r.done
+
+	// Stop reading before locking, since callbacks lock the mutex too
+	r.source.stop()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.bw.Flush() //nolint:errcheck
+	r.file.Close()
+
+	r.initialized = false
+	r.Log(logger.Info, "TS recorder closed for %s", r.FilePath)
+}
+
+// Pause stops writing samples, keeping the file open.
+// It can be called before Initialize, in order to start the recorder paused.
+func (r *TSRecorder) Pause() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.pause.pause()
+
+	if r.started {
+		err := r.bw.Flush()
+		if err != nil {
+			r.Log(logger.Warn, "failed to flush: %v", err)
+		}
+	}
+}
+
+// Resume resumes writing samples, starting from the next keyframe.
+// The paused interval is removed from the timeline of the file.
+func (r *TSRecorder) Resume() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.pause.resume()
+}
+
+// FirstNTP returns the NTP timestamp of the first sample of the file,
+// or a zero time if nothing has been written yet.
+func (r *TSRecorder) FirstNTP() time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.firstNTP
+}
+
+// Position returns the media time of the last sample written into the file.
+func (r *TSRecorder) Position() time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.position
+}
+
+// Metadata returns the metadata of the file, without the path name,
+// or nil if nothing has been written yet.
+func (r *TSRecorder) Metadata() *recordstore.Metadata {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return fileMetadata(r.firstNTP, r.startDTS, r.position, r.pause.parts)
+}
+
+// Log implements logger.Writer.
+func (r *TSRecorder) Log(level logger.Level, format string, args ...interface{}) {
+	r.Parent.Log(level, "[ts-recorder] "+format, args...)
+}
+
+func (r *TSRecorder) run() {
+	defer close(r.done)
+
+	select {
+	case err := <-r.source.Error():
+		r.Log(logger.Error, "reader error: %v", err)
+		if r.ErrorCh != nil {
+			select {
+			case r.ErrorCh <- err:
+			default:
+			}
+		}
+	case <-r.terminate:
+	}
+}
+
+func (r *TSRecorder) setupTrack(media *description.Media, forma format.Format) *mpegts.Track {
+	clockRate := forma.ClockRate()
+
+	switch forma := forma.(type) {
+	case *format.H264:
+		track := &mpegts.Track{Codec: &mpegts.CodecH264{}}
+		var dtsExtractor *h264.DTSExtractor
+		r.waitVideo = true
+
+		r.source.OnData(media, forma, func(u *unit.Unit) error {
+			if u.NilPayload() {
+				return nil
+			}
+
+			randomAccess := h264.IsRandomAccess(u.Payload.(unit.PayloadH264))
+
+			if dtsExtractor == nil {
+				if !randomAccess {
+					return nil
+				}
+				dtsExtractor = &h264.DTSExtractor{}
+				dtsExtractor.Initialize()
+			}
+
+			dts, err := dtsExtractor.Extract(u.Payload.(unit.PayloadH264), u.PTS)
+			if err != nil {
+				return err
+			}
+
+			return r.write(timestampToDuration(dts, clockRate), u.NTP, true, randomAccess, func(offset int64) error {
+				return r.mw.WriteH264(track, u.PTS-offset, dts-offset, u.Payload.(unit.PayloadH264))
+			})
+		})
+		return track
+
+	case *format.H265:
+		track := &mpegts.Track{Codec: &mpegts.CodecH265{}}
+		var dtsExtractor *h265.DTSExtractor
+		r.waitVideo = true
+
+		r.source.OnData(media, forma, func(u *unit.Unit) error {
+			if u.NilPayload() {
+				return nil
+			}
+
+			randomAccess := h265.IsRandomAccess(u.Payload.(unit.PayloadH265))
+
+			if dtsExtractor == nil {
+				if !randomAccess {
+					return nil
+				}
+				dtsExtractor = &h265.DTSExtractor{}
+				dtsExtractor.Initialize()
+			}
+
+			dts, err := dtsExtractor.Extract(u.Payload.(unit.PayloadH265), u.PTS)
+			if err != nil {
+				return err
+			}
+
+			return r.write(timestampToDuration(dts, clockRate), u.NTP, true, randomAccess, func(offset int64) error {
+				return r.mw.WriteH265(track, u.PTS-offset, dts-offset, u.Payload.(unit.PayloadH265))
+			})
+		})
+		return track
+
+	case *format.MPEG4Audio:
+		if forma.Config == nil {
+			return nil
+		}
+
+		track := &mpegts.Track{Codec: &mpegts.CodecMPEG4Audio{Config: *forma.Config}}
+
+		r.source.OnData(media, forma, func(u *unit.Unit) error {
+			if u.NilPayload() {
+				return nil
+			}
+
+			return r.write(timestampToDuration(u.PTS, clockRate), u.NTP, false, true, func(offset int64) error {
+				return r.mw.WriteMPEG4Audio(
+					track,
+					multiplyAndDivide(u.PTS, 90000, int64(clockRate))-offset,
+					u.Payload.(unit.PayloadMPEG4Audio))
+			})
+		})
+		return track
+
+	case *format.Opus:
+		track := &mpegts.Track{Codec: &mpegts.CodecOpus{ChannelCount: forma.ChannelCount}}
+
+		r.source.OnData(media, forma, func(u *unit.Unit) error {
+			if u.NilPayload() {
+				return nil
+			}
+
+			return r.write(timestampToDuration(u.PTS, clockRate), u.NTP, false, true, func(offset int64) error {
+				return r.mw.WriteOpus(
+					track,
+					multiplyAndDivide(u.PTS, 90000, int64(clockRate))-offset,
+					u.Payload.(unit.PayloadOpus))
+			})
+		})
+		return track
+	}
+
+	return nil
+}
+
+// write writes a sample. writeCB receives the paused duration to subtract from timestamps, in 90kHz units.
+func (r *TSRecorder) write(dts time.Duration, ntp time.Time, isVideo bool, randomAccess bool, writeCB func(offset int64) error) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if isVideo || !r.waitVideo {
+		if !r.pause.mainSample(dts, ntp, randomAccess) {
+			return nil
+		}
+	} else if !r.pause.otherSample(dts) {
+		return nil
+	}
+	dts -= r.pause.offset
+
+	if !r.started {
+		// audio is written only after the first video keyframe, in order to start the file with a keyframe.
+		if r.waitVideo && !isVideo {
+			return nil
+		}
+		r.started = true
+		r.firstNTP = ntp
+		r.startDTS = dts
+		r.lastFlush = dts
+	}
+
+	if (dts - r.lastFlush) >= tsFlushInterval {
+		err := r.bw.Flush()
+		if err != nil {
+			return err
+		}
+		r.lastFlush = dts
+	}
+
+	err := writeCB(durationToTimestamp(r.pause.offset, 90000))
+	if err != nil {
+		return err
+	}
+
+	if dts-r.startDTS > r.position {
+		r.position = dts - r.startDTS
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	upstream "github.com/bluenviron/mediamtx/internal/recorder"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+type tsSample struct {
+	track   int
+	pts     int64
+	dts     int64
+	payload [][]byte
+}
+
+func readTSSamples(t *testing.T, fpath string) []tsSample {
+	f, err := os.Open(fpath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	r := &mpegts.Reader{R: f}
+	err = r.Initialize()
+	require.NoError(t, err)
+
+	var samples []tsSample
+
+	for i, track := range r.Tracks() {
+		switch track.Codec.(type) {
+		case *mpegts.CodecH264:
+			r.OnDataH264(track, func(pts int64, dts int64, au [][]byte) error {
+				samples = append(samples, tsSample{i, pts, dts, au})
+				return nil
+			})
+
+		case *mpegts.CodecMPEG4Audio:
+			r.OnDataMPEG4Audio(track, func(pts int64, aus [][]byte) error {
+				samples = append(samples, tsSample{i, pts, pts, aus})
+				return nil
+			})
+		}
+	}
+
+	for {
+		err = r.Read()
+		if err != nil {
+			break
+		}
+	}
+
+	return samples
+}
+
+// TestTSRecorderMatchesUpstream checks that the TS recorder writes the same samples
+// as the recorder of the standard record path, when both read the same stream.
+// With a pre-event buffer, the TS recorder is started later and writes the buffered samples first.
+func TestTSRecorderMatchesUpstream(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{
+		{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.H264{
+				PayloadTyp:        96,
+				PacketizationMode: 1,
+			}},
+		},
+		{
+			Type: description.MediaTypeAudio,
+			Formats: []format.Format{&format.MPEG4Audio{
+				PayloadTyp: 96,
+				Config: &mpeg4audio.AudioSpecificConfig{
+					Type:         2,
+					SampleRate:   44100,
+					ChannelCount: 2,
+				},
+				SizeLength:       13,
+				IndexLength:      3,
+				IndexDeltaLength: 3,
+			}},
+		},
+	}}
+
+	start := time.Date(2008, 5, 20, 22, 15, 25, 0, time.UTC)
+
+	// video at 25 fps with a keyframe every second, and the audio that goes with it
+	a := 0
+	writeUnits := func(strm *stream.Stream, from int, to int) {
+		for i := from; i < to; i++ {
+			pts := 90000 + int64(i)*3600
+			ntp := start.Add(time.Duration(i) * 40 * time.Millisecond)
+
+			au := unit.PayloadH264{{0x41, 0x9a, 0x24, 0x6c, 0x42, 0xff, 0xff, 0xff, byte(i)}}
+			if i%25 == 0 {
+				au = unit.PayloadH264{
+					test.FormatH264.SPS,
+					test.FormatH264.PPS,
+					{0x65, 0x88, 0x84, 0x00, 0x33, 0xff, 0xff, 0xff, byte(i)},
+				}
+			}
+
+			strm.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.Unit{
+				PTS:     pts,
+				NTP:     ntp,
+				Payload: au,
+			})
+
+			for ; int64(a)*1024*90000/44100 <= int64(i)*3600; a++ {
+				strm.WriteUnit(desc.Medias[1], desc.Medias[1].Formats[0], &unit.Unit{
+					PTS:     44100 + int64(a)*1024,
+					NTP:     start.Add(time.Duration(a) * 1024 * time.Second / 44100),
+					Payload: unit.PayloadMPEG4Audio{{byte(a), 1, 2, 3}},
+				})
+			}
+		}
+	}
+
+	for _, ca := range []string{"live", "pre-buffer"} {
+		t.Run(ca, func(t *testing.T) {
+			strm := &stream.Stream{
+				WriteQueueSize:     512,
+				RTPMaxPayloadSize:  1450,
+				Desc:               desc,
+				GenerateRTPPackets: true,
+				Parent:             test.NilLogger,
+			}
+			err := strm.Initialize()
+			require.NoError(t, err)
+			defer strm.Close()
+
+			dir := t.TempDir()
+			segDone := make(chan string, 1)
+
+			up := &upstream.Recorder{
+				PathFormat:      filepath.Join(dir, "upstream", "%path_%Y-%m-%d_%H-%M-%S-%f"),
+				Format:          conf.RecordFormatMPEGTS,
+				PartDuration:    time.Second,
+				MaxPartSize:     50 * 1024 * 1024,
+				SegmentDuration: time.Hour,
+				PathName:        "mypath",
+				Stream:          strm,
+				OnSegmentComplete: func(segPath string, _ time.Duration) {
+					segDone <- segPath
+				},
+				Parent: test.NilLogger,
+			}
+			up.Initialize()
+
+			r := &TSRecorder{
+				Stream:   strm,
+				FilePath: filepath.Join(dir, "pro.ts"),
+				Parent:   test.NilLogger,
+			}
+
+			a = 0
+
+			if ca == "pre-buffer" {
+				b := &PreBuffer{
+					Stream:   strm,
+					Duration: time.Hour,
+					Parent:   test.NilLogger,
+				}
+				b.Initialize()
+				defer b.Close()
+
+				writeUnits(strm, 0, 40)
+
+				// readers are asynchronous
+				time.Sleep(100 * time.Millisecond)
+
+				r.PreBuffer = b
+				err = r.Initialize()
+				require.NoError(t, err)
+			} else {
+				err = r.Initialize()
+				require.NoError(t, err)
+
+				writeUnits(strm, 0, 40)
+			}
+
+			writeUnits(strm, 40, 75)
+			time.Sleep(100 * time.Millisecond)
+
+			up.Close()
+			r.Close()
+
+			expected := readTSSamples(t, <-segDone)
+			require.Len(t, expected, 75+a)
+			require.Equal(t, expected, readTSSamples(t, r.FilePath))
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package recorder
+
+import (
+	"time"
+
+	"github.com/bluenviron/gortsplib/v5/pkg/description"
+	"github.com/bluenviron/gortsplib/v5/pkg/format"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+// unitSource delivers the units of a stream to a recorder.
+// When a pre-event buffer is available, the recorder receives the buffered units
+// before the live ones, otherwise it reads the stream directly.
+type unitSource struct {
+	Stream    *stream.Stream
+	PreBuffer *PreBuffer
+	NotBefore time.Time // optional, units with an earlier NTP timestamp are dropped
+	Parent    logger.Writer
+
+	callbacks map[format.Format]stream.OnDataFunc
+	medias    map[format.Format]*description.Media
+	reader    *stream.Reader
+	pbReader  *preBufferReader
+}
+
+// OnData registers a callback that is called when data from given format is available.
+func (s *unitSource) OnData(media *description.Media, forma format.Format, cb stream.OnDataFunc) {
+	if s.callbacks == nil {
+		s.callbacks = make(map[format.Format]stream.OnDataFunc)
+		s.medias = make(map[format.Format]*description.Media)
+	}
+
+	if !s.NotBefore.IsZero() {
+		notBefore := s.NotBefore
+		next := cb
+		cb = func(u *unit.Unit) error {
+			// units without NTP timestamp can't be compared with the reference and are kept
+			if !u.NTP.IsZero() && u.NTP.Before(notBefore) {
+				return nil
+			}
+			return next(u)
+		}
+	}
+
+	s.callbacks[forma] = cb
+	s.medias[forma] = media
+}
+
+func (s *unitSource) start() error {
+	if s.PreBuffer != nil {
+		s.pbReader = &preBufferReader{
+			onUnit: func(_ *description.Media, forma format.Format, u *unit.Unit) error {
+				cb, ok := s.callbacks[forma]
+				if !ok {
+					return nil
+				}
+				return cb(u)
+			},
+		}
+		return s.PreBuffer.addReader(s.pbReader)
+	}
+
+	s.reader = &stream.Reader{
+		SkipBytesSent: true,
+		Parent:        s.Parent,
+	}
+	for forma, cb := range s.callbacks {
+		s.reader.OnData(s.medias[forma], forma, cb)
+	}
+	s.Stream.AddReader(s.reader)
+
+	return nil
+}
+
+// stop stops the delivery of units. No callback is called after it returns.
+func (s *unitSource) stop() {
+	if s.pbReader != nil {
+		s.PreBuffer.removeReader(s.pbReader)
+		return
+	}
+	s.Stream.RemoveReader(s.reader)
+}
+
+// Error returns a channel that receives reading errors.
+func (s *unitSource) Error() chan error {
+	if s.pbReader != nil {
+		return s.pbReader.err
+	}
+	return s.reader.Error()
+}
@@ -0,0 +1,244 @@
+package recordrepair
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/yapingcat/gomedia/go-mp4"
+)
+
+// Recovery hints are written by the MP4 recorder into the mdat box of non-fragmented files.
+// They are not referenced by the sample tables, therefore players ignore them.
+// They allow to rebuild audio tracks, whose samples can't be told apart from the sample data alone:
+// a tracks hint at the beginning of the sample data describes the audio tracks,
+// and a sample hint precedes every audio sample.
+const (
+	tracksHintType = "mtxt"
+	sampleHintType = "mtxa"
+	sampleHintSize = 24
+
+	// maxTracksHintSize prevents a corrupted hint from causing huge allocations.
+	maxTracksHintSize = 64 * 1024
+)
+
+// audio codecs of hints.
+const (
+	HintCodecAAC   = "aac"
+	HintCodecOpus  = "opus"
+	HintCodecG711A = "g711a"
+	HintCodecG711U = "g711u"
+)
+
+// HintTrack describes an audio track of a non-fragmented file.
+type HintTrack struct {
+	Codec        string `json:"codec"`
+	SampleRate   int    `json:"sampleRate"`
+	ChannelCount int    `json:"channelCount"`
+	Config       []byte `json:"config,omitempty"` // AudioSpecificConfig (AAC) or identification header (Opus)
+}
+
+// TracksHint returns the hint that describes the audio tracks of a file.
+// It must be written at the beginning of the sample data.
+func TracksHint(tracks []HintTrack) ([]byte, error) {
+	payload, err := json.Marshal(tracks)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(buf)))
+	copy(buf[4:8], tracksHintType)
+	copy(buf[8:], payload)
+	return buf, nil
+}
+
+// SampleHint returns the hint that precedes an audio sample.
+// track is the index of the track in the tracks hint, dts is in milliseconds,
+// size is the size of the sample as stored in the file.
+func SampleHint(track int, dts uint64, size int) []byte {
+	buf := make([]byte, sampleHintSize)
+	binary.BigEndian.PutUint32(buf[:4], sampleHintSize)
+	copy(buf[4:8], sampleHintType)
+	binary.BigEndian.PutUint32(buf[8:12], uint32(track))
+	binary.BigEndian.PutUint64(buf[12:20], dts)
+	binary.BigEndian.PutUint32(buf[20:24], uint32(size))
+	return buf
+}
+
+// readTracksHint reads the tracks hint at the beginning of the sample data, if present,
+// and returns the audio tracks and the offset of the first sample.
+func readTracksHint(r io.ReaderAt, l *mp4Layout) ([]HintTrack, int64) {
+	var header [8]byte
+	if (l.mdatEnd-l.mdatStart) < 8 || readFull(r, header[:], l.mdatStart) != nil {
+		return nil, l.mdatStart
+	}
+
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	if string(header[4:8]) != tracksHintType || size < 8 || size > maxTracksHintSize ||
+		l.mdatStart+size > l.mdatEnd {
+		return nil, l.mdatStart
+	}
+
+	payload := make([]byte, size-8)
+	if readFull(r, payload, l.mdatStart+8) != nil {
+		return nil, l.mdatStart
+	}
+
+	var tracks []HintTrack
+	if json.Unmarshal(payload, &tracks) != nil {
+		return nil, l.mdatStart
+	}
+
+	return tracks, l.mdatStart + size
+}
+
+func readFull(r io.ReaderAt, buf []byte, off int64) error {
+	n, err := r.ReadAt(buf, off)
+	if n == len(buf) {
+		return nil
+	}
+	return err
+}
+
+// audioSample is an audio sample located through its hint.
+type audioSample struct {
+	track  int
+	dts    uint64
+	offset int64
+	size   int64
+}
+
+// sampleHintAt reads the sample hint located at given offset, if present.
+// The sample itself may be truncated.
+func (s *naluScanner) sampleHintAt(off int64) (audioSample, bool) {
+	buf := s.br.read(off, sampleHintSize)
+	if buf == nil || binary.BigEndian.Uint32(buf[:4]) != sampleHintSize || string(buf[4:8]) != sampleHintType {
+		return audioSample{}, false
+	}
+
+	return audioSample{
+		track:  int(binary.BigEndian.Uint32(buf[8:12])),
+		dts:    binary.BigEndian.Uint64(buf[12:20]),
+		offset: off + sampleHintSize,
+		size:   int64(binary.BigEndian.Uint32(buf[20:24])),
+	}, true
+}
+
+// skipAudio skips the hinted audio samples located at the current position.
+func (s *naluScanner) skipAudio() {
+	for {
+		sample, ok := s.sampleHintAt(s.pos)
+
+		// the file may end in the middle of the sample
+		if !ok || sample.offset+sample.size > s.br.end {
+			return
+		}
+
+		s.audio = append(s.audio, sample)
+		s.pos = sample.offset + sample.size
+		s.validEnd = s.pos
+	}
+}
+
+// audioRebuilder writes hinted audio samples into a new file.
+type audioRebuilder struct {
+	r       io.ReaderAt
+	muxer   *mp4.Movmuxer
+	tracks  []HintTrack
+	ids     []uint32 // IDs of tracks in the new file, tracks are added with their first sample
+	configs []*mpeg4audio.AudioSpecificConfig
+	written int // samples of the scanner that have been written
+}
+
+func newAudioRebuilder(r io.ReaderAt, muxer *mp4.Movmuxer, tracks []HintTrack) *audioRebuilder {
+	return &audioRebuilder{
+		r:       r,
+		muxer:   muxer,
+		tracks:  tracks,
+		ids:     make([]uint32, len(tracks)),
+		configs: make([]*mpeg4audio.AudioSpecificConfig, len(tracks)),
+	}
+}
+
+// write writes the audio samples found by the scanner since the last call.
+func (a *audioRebuilder) write(s *naluScanner) error {
+	for ; a.written < len(s.audio); a.written++ {
+		sample := s.audio[a.written]
+		if sample.track >= len(a.tracks) {
+			continue
+		}
+
+		buf := make([]byte, sample.size)
+		err := readFull(a.r, buf, sample.offset)
+		if err != nil {
+			return err
+		}
+
+		if a.ids[sample.track] == 0 {
+			a.ids[sample.track], err = a.addTrack(sample.track)
+			if err != nil {
+				return err
+			}
+		}
+
+		// the muxer takes AAC access units wrapped into ADTS frames
+		if config := a.configs[sample.track]; config != nil {
+			buf, err = mpeg4audio.ADTSPackets{{
+				Type:         config.Type,
+				SampleRate:   config.SampleRate,
+				ChannelCount: config.ChannelCount,
+				AU:           buf,
+			}}.Marshal()
+			if err != nil {
+				return err
+			}
+		}
+
+		err = a.muxer.Write(a.ids[sample.track], buf, sample.dts, sample.dts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *audioRebuilder) addTrack(i int) (uint32, error) {
+	track := a.tracks[i]
+	options := []mp4.TrackOption{
+		mp4.WithAudioSampleRate(uint32(track.SampleRate)),
+		mp4.WithAudioChannelCount(uint8(track.ChannelCount)),
+	}
+
+	var codec mp4.MP4_CODEC_TYPE
+
+	switch track.Codec {
+	case HintCodecAAC:
+		codec = mp4.MP4_CODEC_AAC
+
+		var config mpeg4audio.AudioSpecificConfig
+		err := config.Unmarshal(track.Config)
+		if err != nil {
+			return 0, fmt.Errorf("invalid AAC configuration in recovery hint: %w", err)
+		}
+		a.configs[i] = &config
+
+	case HintCodecOpus:
+		codec = mp4.MP4_CODEC_OPUS
+		options = append(options, mp4.WithExtraData(track.Config))
+
+	case HintCodecG711A:
+		codec = mp4.MP4_CODEC_G711A
+
+	case HintCodecG711U:
+		codec = mp4.MP4_CODEC_G711U
+
+	default:
+		return 0, fmt.Errorf("unsupported audio codec in recovery hint: %s", track.Codec)
+	}
+
+	return a.muxer.AddAudioTrack(codec, options...), nil
+}
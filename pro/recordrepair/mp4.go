@@ -0,0 +1,434 @@
+package recordrepair
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// mp4Box is a box located in a file.
+type mp4Box struct {
+	typ        string
+	offset     int64 // offset of the header
+	headerSize int64
+	size       int64 // size including the header, as declared in the header
+}
+
+func (b mp4Box) end() int64 {
+	return b.offset + b.size
+}
+
+func validBoxType(typ []byte) bool {
+	for _, c := range typ {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// readBoxHeader reads the header of the box located at offset.
+func readBoxHeader(r io.ReaderAt, offset int64, fileSize int64) (mp4Box, error) {
+	if (fileSize - offset) < 8 {
+		return mp4Box{}, fmt.Errorf("truncated box header")
+	}
+
+	var buf [16]byte
+	_, err := r.ReadAt(buf[:8], offset)
+	if err != nil {
+		return mp4Box{}, err
+	}
+
+	if !validBoxType(buf[4:8]) {
+		return mp4Box{}, fmt.Errorf("invalid box type at offset %d", offset)
+	}
+
+	b := mp4Box{
+		typ:        string(buf[4:8]),
+		offset:     offset,
+		headerSize: 8,
+		size:       int64(binary.BigEndian.Uint32(buf[:4])),
+	}
+
+	switch b.size {
+	case 0: // box extends to the end of the file
+		b.size = fileSize - offset
+
+	case 1: // 64-bit size
+		if (fileSize - offset) < 16 {
+			return mp4Box{}, fmt.Errorf("truncated box header")
+		}
+
+		_, err = r.ReadAt(buf[8:16], offset+8)
+		if err != nil {
+			return mp4Box{}, err
+		}
+
+		b.headerSize = 16
+		b.size = int64(binary.BigEndian.Uint64(buf[8:16]))
+	}
+
+	return b, nil
+}
+
+// mp4Layout is the top-level structure of a MP4 file.
+type mp4Layout struct {
+	moov *mp4Box
+
+	// payload of the mdat box of a non-fragmented file
+	mdatStart int64
+	mdatEnd   int64
+
+	// complete moof+mdat pairs of a fragmented file
+	fragments []mp4Box
+
+	// end of the last complete box that doesn't belong to an incomplete fragment
+	validEnd int64
+}
+
+func (l *mp4Layout) fragmented() bool {
+	return len(l.fragments) != 0
+}
+
+// scanMP4 reads the top-level boxes of a file, stopping at the first truncated or corrupted one.
+func scanMP4(r io.ReaderAt, fileSize int64) (*mp4Layout, error) {
+	l := &mp4Layout{}
+	offset := int64(0)
+	var pendingMoof *mp4Box
+
+	for offset < fileSize {
+		b, err := readBoxHeader(r, offset, fileSize)
+		if err != nil {
+			break
+		}
+
+		if b.typ == "mdat" && l.moov == nil && pendingMoof == nil {
+			// the mdat of a non-fragmented file is sized when the file is finalized,
+			// after a crash the declared size is a placeholder and the samples run up to the end of the file.
+			if !boxSizeValid(r, b, fileSize) {
+				l.mdatStart = b.offset + b.headerSize
+				l.mdatEnd = fileSize
+				break
+			}
+		}
+
+		if b.size < b.headerSize || b.end() > fileSize {
+			break
+		}
+
+		switch b.typ {
+		case "moov":
+			moov := b
+			l.moov = &moov
+
+		case "moof":
+			moof := b
+			pendingMoof = &moof
+
+		case "mdat":
+			if pendingMoof != nil {
+				l.fragments = append(l.fragments, *pendingMoof)
+				pendingMoof = nil
+			} else if l.moov == nil {
+				l.mdatStart = b.offset + b.headerSize
+				l.mdatEnd = b.end()
+			}
+		}
+
+		if pendingMoof == nil {
+			l.validEnd = b.end()
+		}
+
+		offset = b.end()
+	}
+
+	return l, nil
+}
+
+// boxSizeValid checks whether the declared size of a box points to the end of the file or to another box.
+func boxSizeValid(r io.ReaderAt, b mp4Box, fileSize int64) bool {
+	if b.size < b.headerSize || b.end() > fileSize {
+		return false
+	}
+	if b.end() == fileSize {
+		return true
+	}
+	next, err := readBoxHeader(r, b.end(), fileSize)
+
+	// recovery hints at the beginning of the sample data look like boxes
+	return err == nil && next.typ != tracksHintType && next.typ != sampleHintType
+}
+
+// rawBox is a box loaded in memory.
+type rawBox struct {
+	typ     string
+	payload []byte
+}
+
+// parseChildren parses the boxes contained in the payload of a container box.
+func parseChildren(buf []byte) []rawBox {
+	var boxes []rawBox
+
+	for len(buf) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(buf[:4]))
+		typ := string(buf[4:8])
+		headerSize := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(buf))
+
+		case 1:
+			if len(buf) < 16 {
+				return boxes
+			}
+			size = binary.BigEndian.Uint64(buf[8:16])
+			headerSize = 16
+		}
+
+		if size < headerSize || size > uint64(len(buf)) {
+			return boxes
+		}
+
+		boxes = append(boxes, rawBox{typ: typ, payload: buf[headerSize:size]})
+		buf = buf[size:]
+	}
+
+	return boxes
+}
+
+func findChild(boxes []rawBox, typ string) []byte {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b.payload
+		}
+	}
+	return nil
+}
+
+// mp4Track contains the track parameters needed to compute the duration of fragments.
+type mp4Track struct {
+	timeScale       uint32
+	defaultDuration uint32
+
+	// timeline covered by fragments
+	started bool
+	start   uint64
+	end     uint64
+}
+
+// parseMoov extracts track parameters from a moov box payload.
+func parseMoov(payload []byte) map[uint32]*mp4Track {
+	tracks := make(map[uint32]*mp4Track)
+	children := parseChildren(payload)
+
+	for _, b := range children {
+		if b.typ != "trak" {
+			continue
+		}
+
+		trak := parseChildren(b.payload)
+
+		tkhd := findChild(trak, "tkhd")
+		mdhd := findChild(parseChildren(findChild(trak, "mdia")), "mdhd")
+		if len(tkhd) < 4 || len(mdhd) < 4 {
+			continue
+		}
+
+		var trackID, timeScale uint32
+
+		if tkhd[0] == 1 {
+			if len(tkhd) < 24 {
+				continue
+			}
+			trackID = binary.BigEndian.Uint32(tkhd[20:24])
+		} else {
+			if len(tkhd) < 16 {
+				continue
+			}
+			trackID = binary.BigEndian.Uint32(tkhd[12:16])
+		}
+
+		if mdhd[0] == 1 {
+			if len(mdhd) < 24 {
+				continue
+			}
+			timeScale = binary.BigEndian.Uint32(mdhd[20:24])
+		} else {
+			if len(mdhd) < 16 {
+				continue
+			}
+			timeScale = binary.BigEndian.Uint32(mdhd[12:16])
+		}
+
+		tracks[trackID] = &mp4Track{timeScale: timeScale}
+	}
+
+	for _, b := range parseChildren(findChild(children, "mvex")) {
+		if b.typ != "trex" || len(b.payload) < 20 {
+			continue
+		}
+
+		if track, ok := tracks[binary.BigEndian.Uint32(b.payload[4:8])]; ok {
+			track.defaultDuration = binary.BigEndian.Uint32(b.payload[16:20])
+		}
+	}
+
+	return tracks
+}
+
+// parseMoof updates the timeline of tracks with the content of a moof box payload,
+// and returns the number of samples it contains.
+func parseMoof(payload []byte, tracks map[uint32]*mp4Track) int {
+	samples := 0
+
+	for _, b := range parseChildren(payload) {
+		if b.typ != "traf" {
+			continue
+		}
+
+		traf := parseChildren(b.payload)
+
+		tfhd := findChild(traf, "tfhd")
+		if len(tfhd) < 8 {
+			continue
+		}
+
+		track, ok := tracks[binary.BigEndian.Uint32(tfhd[4:8])]
+		if !ok {
+			continue
+		}
+
+		defaultDuration := track.defaultDuration
+		flags := binary.BigEndian.Uint32(tfhd[:4]) & 0xFFFFFF
+		pos := 8
+		if flags&0x01 != 0 { // base-data-offset
+			pos += 8
+		}
+		if flags&0x02 != 0 { // sample-description-index
+			pos += 4
+		}
+		if flags&0x08 != 0 && len(tfhd) >= pos+4 { // default-sample-duration
+			defaultDuration = binary.BigEndian.Uint32(tfhd[pos : pos+4])
+		}
+
+		var baseTime uint64
+		if tfdt := findChild(traf, "tfdt"); len(tfdt) >= 8 {
+			if tfdt[0] == 1 && len(tfdt) >= 12 {
+				baseTime = binary.BigEndian.Uint64(tfdt[4:12])
+			} else {
+				baseTime = uint64(binary.BigEndian.Uint32(tfdt[4:8]))
+			}
+		} else {
+			baseTime = track.end
+		}
+
+		duration := uint64(0)
+
+		for _, tb := range traf {
+			if tb.typ != "trun" || len(tb.payload) < 8 {
+				continue
+			}
+
+			count, runDuration := parseTrun(tb.payload, defaultDuration)
+			samples += count
+			duration += runDuration
+		}
+
+		if !track.started {
+			track.started = true
+			track.start = baseTime
+		}
+		if end := baseTime + duration; end > track.end {
+			track.end = end
+		}
+	}
+
+	return samples
+}
+
+// parseTrun returns the sample count and the duration of a trun box payload.
+func parseTrun(payload []byte, defaultDuration uint32) (int, uint64) {
+	flags := binary.BigEndian.Uint32(payload[:4]) & 0xFFFFFF
+	count := int(binary.BigEndian.Uint32(payload[4:8]))
+
+	pos := 8
+	if flags&0x01 != 0 { // data-offset
+		pos += 4
+	}
+	if flags&0x04 != 0 { // first-sample-flags
+		pos += 4
+	}
+
+	if flags&0x100 == 0 { // no sample durations
+		return count, uint64(count) * uint64(defaultDuration)
+	}
+
+	entrySize := 4
+	for _, f := range []uint32{0x200, 0x400, 0x800} {
+		if flags&f != 0 {
+			entrySize += 4
+		}
+	}
+
+	duration := uint64(0)
+	for i := 0; i < count; i++ {
+		if len(payload) < pos+4 {
+			break
+		}
+		duration += uint64(binary.BigEndian.Uint32(payload[pos : pos+4]))
+		pos += entrySize
+	}
+
+	return count, duration
+}
+
+// fragmentsSummary reads the moov and moof boxes of a fragmented file
+// and returns the number of samples and the duration of the content, in seconds.
+func fragmentsSummary(r io.ReaderAt, l *mp4Layout) (int, float64, error) {
+	moov, err := readPayload(r, *l.moov)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tracks := parseMoov(moov)
+	samples := 0
+
+	for _, moof := range l.fragments {
+		var payload []byte
+		payload, err = readPayload(r, moof)
+		if err != nil {
+			return 0, 0, err
+		}
+		samples += parseMoof(payload, tracks)
+	}
+
+	duration := 0.0
+	for _, track := range tracks {
+		if track.timeScale == 0 || !track.started {
+			continue
+		}
+		if d := float64(track.end-track.start) / float64(track.timeScale); d > duration {
+			duration = d
+		}
+	}
+
+	return samples, duration, nil
+}
+
+// maxMetadataBoxSize prevents a corrupted header from causing huge allocations.
+const maxMetadataBoxSize = 64 * 1024 * 1024
+
+func readPayload(r io.ReaderAt, b mp4Box) ([]byte, error) {
+	size := b.size - b.headerSize
+	if size > maxMetadataBoxSize {
+		return nil, fmt.Errorf("%s box is too big (%d bytes)", b.typ, size)
+	}
+
+	buf := make([]byte, size)
+	_, err := r.ReadAt(buf, b.offset+b.headerSize)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,313 @@
+package recordrepair
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+type videoCodec int
+
+const (
+	codecUnknown videoCodec = iota
+	codecH264
+	codecH265
+)
+
+func (c videoCodec) String() string {
+	switch c {
+	case codecH264:
+		return "H264"
+	case codecH265:
+		return "H265"
+	}
+	return "unknown"
+}
+
+// maxNALUSize is the maximum size of a NALU found in sample data.
+// Bigger lengths are considered garbage, i.e. a non-video sample.
+const maxNALUSize = 16 * 1024 * 1024
+
+// resyncWindow is the maximum amount of bytes that are skipped between two NALUs,
+// the size of the biggest audio sample that can be interleaved with video samples.
+const resyncWindow = 512 * 1024
+
+func validH264Header(h []byte) bool {
+	if h[0]&0x80 != 0 {
+		return false
+	}
+	typ := h[0] & 0x1F
+	return typ >= 1 && typ <= 12
+}
+
+func validH265Header(h []byte) bool {
+	if len(h) < 2 || h[0]&0x81 != 0 || h[1]>>3 != 0 || h[1]&0x07 == 0 {
+		return false
+	}
+	typ := (h[0] >> 1) & 0x3F
+	return typ <= 9 || (typ >= 16 && typ <= 21) || (typ >= 32 && typ <= 40)
+}
+
+func validNALUHeader(codec videoCodec, h []byte) bool {
+	switch codec {
+	case codecH264:
+		return validH264Header(h)
+	case codecH265:
+		return validH265Header(h)
+	}
+	return false
+}
+
+// blockReader serves small reads of a mostly sequential scan from a buffered block.
+type blockReader struct {
+	r     io.ReaderAt
+	end   int64
+	off   int64
+	block []byte
+}
+
+func (br *blockReader) read(off int64, n int) []byte {
+	if off < 0 || off+int64(n) > br.end {
+		return nil
+	}
+
+	if off < br.off || off+int64(n) > br.off+int64(len(br.block)) {
+		size := int64(1024 * 1024)
+		if int64(n) > size {
+			size = int64(n)
+		}
+		if off+size > br.end {
+			size = br.end - off
+		}
+
+		buf := make([]byte, size)
+		read, err := br.r.ReadAt(buf, off)
+		if err != nil && (err != io.EOF || int64(read) < size) {
+			return nil
+		}
+
+		br.off = off
+		br.block = buf
+	}
+
+	start := off - br.off
+	return br.block[start : start+int64(n)]
+}
+
+// naluScanner reads length-prefixed NALUs from the sample data of a MP4 file,
+// skipping non-video samples that are interleaved with them.
+type naluScanner struct {
+	br    *blockReader
+	pos   int64
+	codec videoCodec
+
+	// end of the last complete NALU or hinted audio sample
+	validEnd int64
+
+	// hinted audio samples found so far
+	audio []audioSample
+}
+
+func newNALUScanner(r io.ReaderAt, start int64, end int64, codec videoCodec) *naluScanner {
+	return &naluScanner{
+		br:       &blockReader{r: r, end: end},
+		pos:      start,
+		codec:    codec,
+		validEnd: start,
+	}
+}
+
+// plausibleAt checks whether a NALU starts at given offset, and returns its size.
+func (s *naluScanner) plausibleAt(off int64) (int64, bool) {
+	buf := s.br.read(off, 6)
+	if buf == nil {
+		return 0, false
+	}
+
+	size := int64(binary.BigEndian.Uint32(buf[:4]))
+	if size < 2 || size > maxNALUSize || !validNALUHeader(s.codec, buf[4:]) {
+		return 0, false
+	}
+
+	if off+4+size > s.br.end {
+		return 0, false
+	}
+
+	return size, true
+}
+
+// confirmed checks whether the NALU at given offset is followed by another NALU.
+func (s *naluScanner) confirmed(off int64, size int64) bool {
+	end := off + 4 + size
+
+	// the file may end in the middle of the header of the following NALU
+	if (s.br.end - end) < 6 {
+		return true
+	}
+
+	if _, ok := s.sampleHintAt(end); ok {
+		return true
+	}
+
+	_, ok := s.plausibleAt(end)
+	return ok
+}
+
+// resync returns the first offset in given range where a confirmed NALU starts.
+func (s *naluScanner) resync(from int64, to int64) (int64, int64, bool) {
+	if to > s.br.end {
+		to = s.br.end
+	}
+
+	for off := from; off < to; off++ {
+		size, ok := s.plausibleAt(off)
+		if ok && s.confirmed(off, size) {
+			return off, size, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// next returns the next NALU, or io.EOF when the sample data is over.
+func (s *naluScanner) next() ([]byte, error) {
+	s.skipAudio()
+
+	size, ok := s.plausibleAt(s.pos)
+
+	switch {
+	case !ok:
+		// non-video sample, skip it
+		var off int64
+		off, size, ok = s.resync(s.pos+1, s.pos+resyncWindow)
+		if !ok {
+			return nil, io.EOF
+		}
+		s.pos = off
+
+	case !s.confirmed(s.pos, size):
+		// this is either the last NALU before a non-video sample, or a non-video sample that looks like a NALU.
+		// Emulation prevention makes NALU payloads unlikely to contain valid length prefixes,
+		// therefore a NALU found inside the candidate means that the candidate is garbage.
+		off, offSize, found := s.resync(s.pos+1, s.pos+4+size)
+		if found {
+			s.pos = off
+			size = offSize
+		}
+	}
+
+	buf := s.br.read(s.pos+4, int(size))
+	if buf == nil {
+		return nil, io.EOF
+	}
+
+	nalu := make([]byte, size)
+	copy(nalu, buf)
+
+	s.pos += 4 + size
+	s.validEnd = s.pos
+
+	return nalu, nil
+}
+
+// detectCodec guesses the codec of the length-prefixed NALUs that start at given offset.
+func detectCodec(r io.ReaderAt, start int64, end int64) videoCodec {
+	for _, codec := range []videoCodec{codecH265, codecH264} {
+		s := newNALUScanner(r, start, end, codec)
+
+		// the file starts with the parameters of the first keyframe,
+		// that may be preceded by audio samples since the muxer writes video samples with a delay.
+		s.skipAudio()
+
+		size, ok := s.plausibleAt(s.pos)
+		if ok && s.confirmed(s.pos, size) {
+			return codec
+		}
+	}
+
+	return codecUnknown
+}
+
+func naluType(codec videoCodec, nalu []byte) int {
+	if codec == codecH265 {
+		return int((nalu[0] >> 1) & 0x3F)
+	}
+	return int(nalu[0] & 0x1F)
+}
+
+func isVCL(codec videoCodec, typ int) bool {
+	if codec == codecH265 {
+		return typ < 32
+	}
+	return typ == 1 || typ == 5
+}
+
+func isKeyframe(codec videoCodec, typ int) bool {
+	if codec == codecH265 {
+		return typ >= 16 && typ <= 21
+	}
+	return typ == 5
+}
+
+// isParameterSet returns whether the NALU is a VPS, SPS or PPS.
+func isParameterSet(codec videoCodec, typ int) bool {
+	if codec == codecH265 {
+		return typ >= 32 && typ <= 34
+	}
+	return typ == 7 || typ == 8
+}
+
+func isSPS(codec videoCodec, typ int) bool {
+	if codec == codecH265 {
+		return typ == 33
+	}
+	return typ == 7
+}
+
+// firstSliceOfPicture returns whether a VCL NALU is the first slice of a picture.
+func firstSliceOfPicture(codec videoCodec, nalu []byte) bool {
+	if codec == codecH265 {
+		return len(nalu) > 2 && nalu[2]&0x80 != 0
+	}
+	// first_mb_in_slice is 0
+	return len(nalu) > 1 && nalu[1]&0x80 != 0
+}
+
+// accessUnit is a group of NALUs that belong to the same picture.
+type accessUnit struct {
+	nalus [][]byte
+	key   bool
+	vcl   bool
+}
+
+// walkAccessUnits groups the NALUs of the sample data into access units.
+// The last access unit is discarded, since the file may end in the middle of it.
+func walkAccessUnits(s *naluScanner, cb func(au *accessUnit) error) error {
+	cur := &accessUnit{}
+
+	for {
+		nalu, err := s.next()
+		if err == io.EOF {
+			return nil
+		}
+
+		typ := naluType(s.codec, nalu)
+		vcl := isVCL(s.codec, typ)
+
+		// an access unit ends when a new picture starts or when non-VCL data follows a picture
+		if cur.vcl && (!vcl || firstSliceOfPicture(s.codec, nalu)) {
+			err = cb(cur)
+			if err != nil {
+				return err
+			}
+			cur = &accessUnit{}
+		}
+
+		cur.nalus = append(cur.nalus, nalu)
+		if vcl {
+			cur.vcl = true
+		}
+		if isKeyframe(s.codec, typ) {
+			cur.key = true
+		}
+	}
+}
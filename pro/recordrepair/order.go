@@ -0,0 +1,253 @@
+package recordrepair
+
+import (
+	"sort"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/bits"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+)
+
+// maxSliceHeaderSize is the amount of bytes of a slice header that are read to find the picture order count.
+const maxSliceHeaderSize = 32
+
+// pictureOrder reads the picture order count (POC) of access units, that gives their presentation order.
+// When the POC can't be read, access units are presented in decoding order.
+type pictureOrder struct {
+	codec   videoCodec
+	h264SPS *h264.SPS
+	h265SPS *h265.SPS
+	h265PPS *h265.PPS
+
+	failed  bool
+	started bool
+	prevLsb uint32
+	prev    int64
+	max     int64
+}
+
+// next returns the POC of an access unit, unwrapped and increasing across keyframes that reset it.
+func (p *pictureOrder) next(au *accessUnit) int64 {
+	if p.failed {
+		return 0
+	}
+
+	for _, nalu := range au.nalus {
+		if typ := naluType(p.codec, nalu); isSPS(p.codec, typ) || (p.codec == codecH265 && typ == 34) {
+			p.parseParams(nalu)
+		}
+	}
+
+	var vcl []byte
+	for _, nalu := range au.nalus {
+		if isVCL(p.codec, naluType(p.codec, nalu)) {
+			vcl = nalu
+			break
+		}
+	}
+
+	lsb, reset, ok := p.readLsb(vcl)
+	if !ok {
+		p.failed = true
+		return 0
+	}
+
+	var poc int64
+	switch {
+	case !p.started:
+		poc = int64(lsb)
+		p.started = true
+
+	case reset:
+		// pictures that follow a reset are presented after the previous ones
+		poc = p.max + 1 + int64(lsb)
+
+	default:
+		poc = p.prev + int64(p.lsbDiff(lsb, p.prevLsb))
+	}
+
+	p.prevLsb = lsb
+	p.prev = poc
+	if poc > p.max {
+		p.max = poc
+	}
+
+	return poc
+}
+
+func (p *pictureOrder) parseParams(nalu []byte) {
+	switch {
+	case p.codec == codecH264:
+		var sps h264.SPS
+		if sps.Unmarshal(nalu) == nil {
+			p.h264SPS = &sps
+		}
+
+	case naluType(p.codec, nalu) == 33:
+		var sps h265.SPS
+		if sps.Unmarshal(nalu) == nil {
+			p.h265SPS = &sps
+		}
+
+	default:
+		var pps h265.PPS
+		if pps.Unmarshal(nalu) == nil {
+			p.h265PPS = &pps
+		}
+	}
+}
+
+func (p *pictureOrder) lsbBits() int {
+	if p.codec == codecH265 {
+		return int(p.h265SPS.Log2MaxPicOrderCntLsbMinus4 + 4)
+	}
+	return int(p.h264SPS.Log2MaxPicOrderCntLsbMinus4 + 4)
+}
+
+// lsbDiff returns the difference between two POC LSBs, taking wrap-around into account.
+func (p *pictureOrder) lsbDiff(a uint32, b uint32) int32 {
+	maxVal := uint32(1) << p.lsbBits()
+	d := (a - b) & (maxVal - 1)
+	if d > maxVal/2 {
+		return int32(d) - int32(maxVal)
+	}
+	return int32(d)
+}
+
+// readLsb reads the POC LSB from the header of the first slice of a picture,
+// and returns whether the picture resets the POC.
+func (p *pictureOrder) readLsb(nalu []byte) (uint32, bool, bool) {
+	if nalu == nil {
+		return 0, false, false
+	}
+
+	if p.codec == codecH265 {
+		return p.readH265Lsb(nalu)
+	}
+	return p.readH264Lsb(nalu)
+}
+
+func (p *pictureOrder) readH264Lsb(nalu []byte) (uint32, bool, bool) {
+	// POC types 1 and 2 are not supported, type 2 means that pictures are presented in decoding order
+	if p.h264SPS == nil || p.h264SPS.PicOrderCntType != 0 || len(nalu) < 2 {
+		return 0, false, false
+	}
+
+	idr := naluType(codecH264, nalu) == 5
+	buf := h264.EmulationPreventionRemove(nalu[1:min(len(nalu), maxSliceHeaderSize)])
+	pos := 0
+
+	for range 3 { // first_mb_in_slice, slice_type, pic_parameter_set_id
+		if _, err := bits.ReadGolombUnsigned(buf, &pos); err != nil {
+			return 0, false, false
+		}
+	}
+
+	n := int(p.h264SPS.Log2MaxFrameNumMinus4 + 4) // frame_num
+	if p.h264SPS.SeparateColourPlaneFlag {
+		n += 2 // colour_plane_id
+	}
+	if _, err := bits.ReadBits(buf, &pos, n); err != nil {
+		return 0, false, false
+	}
+
+	if !p.h264SPS.FrameMbsOnlyFlag {
+		fieldPic, err := bits.ReadFlag(buf, &pos)
+		if err != nil {
+			return 0, false, false
+		}
+		if fieldPic {
+			pos++ // bottom_field_flag
+		}
+	}
+
+	if idr {
+		if _, err := bits.ReadGolombUnsigned(buf, &pos); err != nil { // idr_pic_id
+			return 0, false, false
+		}
+	}
+
+	lsb, err := bits.ReadBits(buf, &pos, p.lsbBits())
+	if err != nil {
+		return 0, false, false
+	}
+
+	return uint32(lsb), idr, true
+}
+
+func (p *pictureOrder) readH265Lsb(nalu []byte) (uint32, bool, bool) {
+	if p.h265SPS == nil || p.h265PPS == nil || len(nalu) < 3 {
+		return 0, false, false
+	}
+
+	typ := h265.NALUType(naluType(codecH265, nalu))
+
+	// IDR pictures have a POC of zero
+	if typ == h265.NALUType_IDR_W_RADL || typ == h265.NALUType_IDR_N_LP {
+		return 0, true, true
+	}
+
+	buf := h264.EmulationPreventionRemove(nalu[2:min(len(nalu), maxSliceHeaderSize)])
+	pos := 0
+
+	first, err := bits.ReadFlag(buf, &pos)
+	if err != nil || !first {
+		return 0, false, false
+	}
+
+	if typ >= h265.NALUType_BLA_W_LP && typ <= h265.NALUType_RSV_IRAP_VCL23 {
+		pos++ // no_output_of_prior_pics_flag
+	}
+
+	if _, err = bits.ReadGolombUnsigned(buf, &pos); err != nil { // slice_pic_parameter_set_id
+		return 0, false, false
+	}
+
+	pos += int(p.h265PPS.NumExtraSliceHeaderBits)
+
+	if _, err = bits.ReadGolombUnsigned(buf, &pos); err != nil { // slice_type
+		return 0, false, false
+	}
+
+	if p.h265PPS.OutputFlagPresentFlag {
+		pos++ // pic_output_flag
+	}
+	if p.h265SPS.SeparateColourPlaneFlag {
+		pos += 2 // colour_plane_id
+	}
+
+	lsb, err := bits.ReadBits(buf, &pos, p.lsbBits())
+	if err != nil {
+		return 0, false, false
+	}
+
+	return uint32(lsb), false, true
+}
+
+// presentationOffsets returns, for every access unit in decoding order, the difference
+// between its position in presentation order and its position in decoding order, in frames.
+// Offsets are shifted in order to be positive, since presentation can't precede decoding.
+func presentationOffsets(pocs []int64) []int {
+	order := make([]int, len(pocs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return pocs[order[a]] < pocs[order[b]]
+	})
+
+	offsets := make([]int, len(pocs))
+	delay := 0
+	for rank, i := range order {
+		offsets[i] = rank - i
+		if -offsets[i] > delay {
+			delay = -offsets[i]
+		}
+	}
+
+	for i := range offsets {
+		offsets[i] += delay
+	}
+
+	return offsets
+}
@@ -0,0 +1,235 @@
+package recordrepair
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+	"github.com/yapingcat/gomedia/go-mp4"
+)
+
+const (
+	defaultFPS = 25
+	minFPS     = 1
+	maxFPS     = 120
+)
+
+// videoSummary is the result of the analysis of the sample data of a non-fragmented file.
+type videoSummary struct {
+	codec     videoCodec
+	frames    int
+	validEnd  int64
+	fps       float64
+	fpsSource string
+
+	// presentation offsets of frames, in frames, nil when frames are presented in decoding order
+	ptsOffsets []int
+
+	// audio tracks and samples found through recovery hints
+	dataStart    int64
+	audioTracks  []HintTrack
+	audioSamples int
+}
+
+// analyzeSamples counts the decodable access units of the sample data and estimates the frame rate.
+func analyzeSamples(r io.ReaderAt, l *mp4Layout, filePath string, modTime time.Time) (*videoSummary, error) {
+	audioTracks, dataStart := readTracksHint(r, l)
+
+	codec := detectCodec(r, dataStart, l.mdatEnd)
+	if codec == codecUnknown {
+		return nil, fmt.Errorf("no H264/H265 samples found, audio-only recordings can't be rebuilt")
+	}
+
+	sum := &videoSummary{
+		codec:       codec,
+		dataStart:   dataStart,
+		audioTracks: audioTracks,
+	}
+	s := newNALUScanner(r, dataStart, l.mdatEnd, codec)
+	started := false
+	order := &pictureOrder{codec: codec}
+	var pocs []int64
+
+	err := walkAccessUnits(s, func(au *accessUnit) error {
+		if !started {
+			if !au.key || !hasParameterSets(codec, au) {
+				return nil
+			}
+			started = true
+
+			for _, nalu := range au.nalus {
+				if isSPS(codec, naluType(codec, nalu)) {
+					sum.fps = spsFPS(codec, nalu)
+				}
+			}
+		}
+
+		sum.frames++
+		pocs = append(pocs, order.next(au))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if sum.frames == 0 {
+		return nil, fmt.Errorf("no keyframe with parameter sets found")
+	}
+
+	sum.validEnd = s.validEnd
+
+	if !order.failed {
+		sum.ptsOffsets = presentationOffsets(pocs)
+	}
+
+	for _, sample := range s.audio {
+		if sample.track < len(audioTracks) {
+			sum.audioSamples++
+		}
+	}
+
+	switch {
+	case sum.fps >= minFPS && sum.fps <= maxFPS:
+		sum.fpsSource = "SPS"
+
+	default:
+		// the file name starts with the recording start time (YYYYMMDD-HHMM),
+		// while the modification time is the time of the last write.
+		if start, ok := fileNameTime(filePath); ok {
+			if elapsed := modTime.Sub(start).Seconds(); elapsed > 0 {
+				if fps := float64(sum.frames) / elapsed; fps >= minFPS && fps <= maxFPS {
+					sum.fps = fps
+					sum.fpsSource = "file time"
+					break
+				}
+			}
+		}
+
+		sum.fps = defaultFPS
+		sum.fpsSource = "default"
+	}
+
+	return sum, nil
+}
+
+func hasParameterSets(codec videoCodec, au *accessUnit) bool {
+	count := 0
+	for _, nalu := range au.nalus {
+		if isParameterSet(codec, naluType(codec, nalu)) {
+			count++
+		}
+	}
+
+	if codec == codecH265 {
+		return count >= 3
+	}
+	return count >= 2
+}
+
+func spsFPS(codec videoCodec, nalu []byte) float64 {
+	if codec == codecH265 {
+		var sps h265.SPS
+		if sps.Unmarshal(nalu) != nil {
+			return 0
+		}
+		return sps.FPS()
+	}
+
+	var sps h264.SPS
+	if sps.Unmarshal(nalu) != nil {
+		return 0
+	}
+	return sps.FPS()
+}
+
+func fileNameTime(filePath string) (time.Time, bool) {
+	name := filepath.Base(filePath)
+	if len(name) < 13 {
+		return time.Time{}, false
+	}
+
+	t, err := time.ParseInLocation("20060102-1504", name[:13], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// rebuildMP4 writes the samples of a non-fragmented file into a new, finalized MP4 file.
+// Video timestamps are not part of the sample data, therefore they are generated with the estimated frame rate,
+// while audio samples are written only when recovery hints are present.
+func rebuildMP4(r io.ReaderAt, l *mp4Layout, sum *videoSummary, outPath string) error {
+	f, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	muxer, err := mp4.CreateMp4Muxer(f)
+	if err != nil {
+		return err
+	}
+
+	var track uint32
+	if sum.codec == codecH265 {
+		track = muxer.AddVideoTrack(mp4.MP4_CODEC_H265)
+	} else {
+		track = muxer.AddVideoTrack(mp4.MP4_CODEC_H264)
+	}
+
+	audio := newAudioRebuilder(r, muxer, sum.audioTracks)
+
+	s := newNALUScanner(r, sum.dataStart, l.mdatEnd, sum.codec)
+	started := false
+	frame := 0
+
+	err = walkAccessUnits(s, func(au *accessUnit) error {
+		// audio samples are written in the same order as in the original file
+		err2 := audio.write(s)
+		if err2 != nil {
+			return err2
+		}
+
+		if !started {
+			if !au.key || !hasParameterSets(sum.codec, au) {
+				return nil
+			}
+			started = true
+		}
+
+		var buf bytes.Buffer
+		for _, nalu := range au.nalus {
+			buf.Write([]byte{0, 0, 0, 1})
+			buf.Write(nalu)
+		}
+
+		dts := uint64(float64(frame) * 1000 / sum.fps)
+		pts := dts
+		if frame < len(sum.ptsOffsets) {
+			pts = uint64(float64(frame+sum.ptsOffsets[frame]) * 1000 / sum.fps)
+		}
+		frame++
+
+		return muxer.Write(track, buf.Bytes(), pts, dts)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = audio.write(s)
+	if err != nil {
+		return err
+	}
+
+	err = muxer.WriteTrailer()
+	if err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
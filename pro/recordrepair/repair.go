@@ -0,0 +1,452 @@
+// Package recordrepair contains the Pro recording repair tool.
+// It rebuilds recordings that were left truncated by a crash or a power cut.
+package recordrepair
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+)
+
+const (
+	// backupSuffix is appended to the name of the original file when it's replaced by a rebuilt one.
+	backupSuffix = ".corrupt"
+	tempSuffix   = ".repair.tmp"
+)
+
+// datePattern matches YYYYMMDD format directories
+var datePattern = regexp.MustCompile(`^\d{8}$`)
+
+// Status is the outcome of the repair of a file.
+type Status string
+
+// statuses.
+const (
+	StatusOK            Status = "ok"
+	StatusRepaired      Status = "repaired"
+	StatusRepairable    Status = "repairable" // dry run
+	StatusUnrecoverable Status = "unrecoverable"
+	StatusSkipped       Status = "skipped"
+	StatusFailed        Status = "failed"
+)
+
+// FileResult is the result of the repair of a file.
+type FileResult struct {
+	Path          string  `json:"path"`   // relative to the record path, e.g. /20250116/20250116-1430-abc12345.mp4
+	Format        string  `json:"format"` // "mp4", "fmp4" or "ts"
+	Status        Status  `json:"status"`
+	Detail        string  `json:"detail,omitempty"`
+	OriginalSize  int64   `json:"originalSize"`
+	RecoveredSize int64   `json:"recoveredSize"`
+	Samples       int     `json:"samples"`  // recovered samples (video frames for rebuilt MP4 files, PES packets for TS files)
+	Duration      float64 `json:"duration"` // recovered content, in seconds
+	BackupPath    string  `json:"backupPath,omitempty"`
+}
+
+// Report is the result of a repair run.
+type Report struct {
+	DryRun        bool          `json:"dryRun"`
+	StartTime     time.Time     `json:"startTime"`
+	EndTime       time.Time     `json:"endTime"`
+	Scanned       int           `json:"scanned"`
+	OK            int           `json:"ok"`
+	Repaired      int           `json:"repaired"`
+	Repairable    int           `json:"repairable"`
+	Unrecoverable int           `json:"unrecoverable"`
+	Skipped       int           `json:"skipped"`
+	Failed        int           `json:"failed"`
+	Files         []*FileResult `json:"files"` // files that are not ok
+}
+
+func (r *Report) add(res *FileResult) {
+	r.Scanned++
+
+	switch res.Status {
+	case StatusOK:
+		r.OK++
+		return
+	case StatusRepaired:
+		r.Repaired++
+	case StatusRepairable:
+		r.Repairable++
+	case StatusUnrecoverable:
+		r.Unrecoverable++
+	case StatusSkipped:
+		r.Skipped++
+	case StatusFailed:
+		r.Failed++
+	}
+
+	r.Files = append(r.Files, res)
+}
+
+// Repairer scans the date folders of the recording directory and repairs truncated MP4 and TS files.
+type Repairer struct {
+	RecordPath string
+	Date       string // optional, limits the scan to a date folder (YYYYMMDD)
+	DryRun     bool   // only report, don't modify files
+	IsActive   func(fullPath string) bool
+	Parent     logger.Writer
+}
+
+// Log implements logger.Writer.
+func (r *Repairer) Log(level logger.Level, format string, args ...interface{}) {
+	r.Parent.Log(level, "[record repair] "+format, args...)
+}
+
+// Run runs the repair.
+func (r *Repairer) Run() (*Report, error) {
+	if r.Date != "" && !datePattern.MatchString(r.Date) {
+		return nil, fmt.Errorf("invalid date '%s', expected YYYYMMDD", r.Date)
+	}
+
+	info, err := os.Stat(r.RecordPath)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("record path '%s' not found", r.RecordPath)
+	}
+
+	report := &Report{
+		DryRun:    r.DryRun,
+		StartTime: time.Now(),
+		Files:     []*FileResult{},
+	}
+
+	files, err := r.listFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fpath := range files {
+		res := r.repairFile(fpath)
+
+		if res.Status != StatusOK {
+			r.Log(logger.Info, "%s: %s %s", res.Path, res.Status, res.Detail)
+		}
+
+		report.add(res)
+	}
+
+	report.EndTime = time.Now()
+
+	r.Log(logger.Info, "scanned %d files: %d repaired, %d repairable, %d unrecoverable, %d skipped, %d failed",
+		report.Scanned, report.Repaired, report.Repairable, report.Unrecoverable, report.Skipped, report.Failed)
+
+	return report, nil
+}
+
+func (r *Repairer) listFiles() ([]string, error) {
+	entries, err := os.ReadDir(r.RecordPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !datePattern.MatchString(entry.Name()) {
+			continue
+		}
+		if r.Date != "" && entry.Name() != r.Date {
+			continue
+		}
+
+		dir := filepath.Join(r.RecordPath, entry.Name())
+
+		var dirEntries []os.DirEntry
+		dirEntries, err = os.ReadDir(dir)
+		if err != nil {
+			r.Log(logger.Warn, "failed to read folder %s: %v", entry.Name(), err)
+			continue
+		}
+
+		for _, fe := range dirEntries {
+			if fe.IsDir() {
+				continue
+			}
+
+			switch strings.ToLower(filepath.Ext(fe.Name())) {
+			case ".mp4", ".ts":
+				files = append(files, filepath.Join(dir, fe.Name()))
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func (r *Repairer) relativePath(fpath string) string {
+	rel, err := filepath.Rel(r.RecordPath, fpath)
+	if err != nil {
+		return fpath
+	}
+	return "/" + filepath.ToSlash(rel)
+}
+
+func (r *Repairer) repairFile(fpath string) *FileResult {
+	res := &FileResult{
+		Path:   r.relativePath(fpath),
+		Format: strings.TrimPrefix(strings.ToLower(filepath.Ext(fpath)), "."),
+	}
+
+	if r.IsActive != nil && r.IsActive(fpath) {
+		res.Status = StatusSkipped
+		res.Detail = "recording in progress"
+		return res
+	}
+
+	f, err := os.Open(fpath)
+	if err != nil {
+		res.Status = StatusFailed
+		res.Detail = err.Error()
+		return res
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		res.Status = StatusFailed
+		res.Detail = err.Error()
+		return res
+	}
+	res.OriginalSize = info.Size()
+
+	var apply func() error
+	if res.Format == "ts" {
+		apply, err = r.repairTS(f, fpath, res)
+	} else {
+		apply, err = r.repairMP4(f, fpath, info.ModTime(), res)
+	}
+
+	// the original file is closed before being truncated or replaced
+	f.Close()
+
+	if err != nil {
+		res.Status = StatusFailed
+		res.Detail = err.Error()
+		return res
+	}
+
+	if apply == nil {
+		return res
+	}
+
+	if r.DryRun {
+		res.Status = StatusRepairable
+		return res
+	}
+
+	err = apply()
+	if err != nil {
+		res.Status = StatusFailed
+		res.Detail = err.Error()
+		return res
+	}
+
+	res.Status = StatusRepaired
+	r.updateMetadata(fpath, res)
+	return res
+}
+
+// updateMetadata sets the duration of the recovered content into the metadata of a repaired file,
+// since the last update of the metadata written by the recorder may precede the interruption.
+func (r *Repairer) updateMetadata(fpath string, res *FileResult) {
+	if res.Duration <= 0 {
+		return
+	}
+
+	m, err := recordstore.ReadMetadata(fpath)
+	if err != nil {
+		return
+	}
+
+	m.SetDuration(time.Duration(res.Duration * float64(time.Second)))
+
+	err = recordstore.WriteMetadata(fpath, m)
+	if err != nil {
+		res.Detail += fmt.Sprintf(", failed to update metadata: %v", err)
+	}
+}
+
+// repairMP4 analyzes a MP4 file and returns the action that repairs it, if needed.
+func (r *Repairer) repairMP4(f *os.File, fpath string, modTime time.Time, res *FileResult) (func() error, error) {
+	l, err := scanMP4(f, res.OriginalSize)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case l.moov != nil && l.fragmented():
+		res.Format = "fmp4"
+		return r.repairFragmented(f, fpath, l, res)
+
+	case l.moov != nil:
+		res.Status = StatusOK
+		res.RecoveredSize = res.OriginalSize
+		return nil, nil
+
+	case l.mdatEnd > l.mdatStart:
+		return r.rebuild(f, fpath, l, modTime, res)
+
+	default:
+		res.Status = StatusUnrecoverable
+		res.Detail = "no media data"
+		return nil, nil
+	}
+}
+
+// repairFragmented removes the incomplete fragment at the end of a fragmented file.
+func (r *Repairer) repairFragmented(f *os.File, fpath string, l *mp4Layout, res *FileResult) (func() error, error) {
+	samples, duration, err := fragmentsSummary(f, l)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Samples = samples
+	res.Duration = duration
+	res.RecoveredSize = l.validEnd
+
+	if l.validEnd == res.OriginalSize {
+		res.Status = StatusOK
+		return nil, nil
+	}
+
+	res.Detail = fmt.Sprintf("%d bytes of incomplete fragment removed after %d complete fragments",
+		res.OriginalSize-l.validEnd, len(l.fragments))
+
+	return func() error {
+		return os.Truncate(fpath, l.validEnd)
+	}, nil
+}
+
+// rebuild writes a new file with the samples of a non-finalized file.
+func (r *Repairer) rebuild(f *os.File, fpath string, l *mp4Layout, modTime time.Time, res *FileResult) (func() error, error) {
+	sum, err := analyzeSamples(f, l, fpath, modTime)
+	if err != nil {
+		res.Status = StatusUnrecoverable
+		res.Detail = err.Error()
+		return nil, nil
+	}
+
+	res.Samples = sum.frames
+	res.Duration = float64(sum.frames) / sum.fps
+	res.RecoveredSize = sum.validEnd - l.mdatStart
+	res.Detail = fmt.Sprintf("index missing, %s video rebuilt at %.2f fps (%s)", sum.codec, sum.fps, sum.fpsSource)
+	if sum.audioTracks != nil {
+		res.Detail += fmt.Sprintf(", %d audio samples recovered", sum.audioSamples)
+	} else {
+		// video-only files, or files written before recovery hints were introduced
+		res.Detail += ", audio is not recovered"
+	}
+
+	if r.DryRun {
+		return func() error { return nil }, nil
+	}
+
+	tempPath := fpath + tempSuffix
+
+	err = rebuildMP4(f, l, sum, tempPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+
+	return func() error {
+		return r.replace(fpath, tempPath, res)
+	}, nil
+}
+
+// repairTS analyzes a MPEG-TS file and returns the action that repairs it, if needed.
+func (r *Repairer) repairTS(f *os.File, fpath string, res *FileResult) (func() error, error) {
+	l := scanTS(f, res.OriginalSize)
+
+	res.Samples = l.pes
+	res.Duration = l.duration()
+	res.RecoveredSize = l.validSize()
+
+	if l.packets == 0 {
+		res.Status = StatusUnrecoverable
+		res.Detail = "no MPEG-TS packets"
+		return nil, nil
+	}
+
+	if res.RecoveredSize == res.OriginalSize {
+		res.Status = StatusOK
+		return nil, nil
+	}
+
+	res.Detail = fmt.Sprintf("%d bytes of truncated or corrupted packets removed", res.OriginalSize-res.RecoveredSize)
+
+	// a single run at the beginning of the file means that only the last packet is truncated
+	if len(l.runs) == 1 && l.runs[0].start == 0 {
+		return func() error {
+			return os.Truncate(fpath, l.runs[0].end)
+		}, nil
+	}
+
+	if r.DryRun {
+		return func() error { return nil }, nil
+	}
+
+	tempPath := fpath + tempSuffix
+
+	err := copyRuns(f, l.runs, tempPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+
+	return func() error {
+		return r.replace(fpath, tempPath, res)
+	}, nil
+}
+
+func copyRuns(r io.ReaderAt, runs []tsRun, outPath string) error {
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	for _, run := range runs {
+		_, err = io.Copy(out, io.NewSectionReader(r, run.start, run.end-run.start))
+		if err != nil {
+			return err
+		}
+	}
+
+	return out.Sync()
+}
+
+// replace moves the original file to a backup and the rebuilt file in its place.
+func (r *Repairer) replace(fpath string, tempPath string, res *FileResult) error {
+	backupPath := fpath + backupSuffix
+
+	err := os.Rename(fpath, backupPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	err = os.Rename(tempPath, fpath)
+	if err != nil {
+		os.Rename(backupPath, fpath) //nolint:errcheck
+		os.Remove(tempPath)
+		return err
+	}
+
+	if info, err := os.Stat(fpath); err == nil {
+		res.RecoveredSize = info.Size()
+	}
+	res.BackupPath = r.relativePath(backupPath)
+
+	return nil
+}
@@ -0,0 +1,508 @@
+package recordrepair
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/stretchr/testify/require"
+	"github.com/yapingcat/gomedia/go-mp4"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func testBox(typ string, payload ...[]byte) []byte {
+	var buf bytes.Buffer
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	binary.Write(&buf, binary.BigEndian, uint32(size)) //nolint:errcheck
+	buf.WriteString(typ)
+	for _, p := range payload {
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
+
+func testUint32(vals ...uint32) []byte {
+	buf := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		binary.BigEndian.PutUint32(buf[i*4:], v)
+	}
+	return buf
+}
+
+func testFragment(baseTime uint32, samples uint32) []byte {
+	moof := testBox("moof",
+		testBox("traf",
+			testBox("tfhd", testUint32(0x000008, 1, 3000)), // default-sample-duration
+			testBox("tfdt", testUint32(0, baseTime)),
+			testBox("trun", testUint32(0, samples))))
+	return append(moof, testBox("mdat", make([]byte, 100))...)
+}
+
+func TestScanFragmentedMP4(t *testing.T) {
+	moov := testBox("moov",
+		testBox("trak",
+			testBox("tkhd", testUint32(0, 0, 0, 1, 0)),
+			testBox("mdia", testBox("mdhd", testUint32(0, 0, 0, 90000, 0)))))
+
+	var buf bytes.Buffer
+	buf.Write(testBox("ftyp", []byte("iso5")))
+	buf.Write(moov)
+	buf.Write(testFragment(0, 30))
+	buf.Write(testFragment(90000, 30))
+	complete := int64(buf.Len())
+
+	// truncated fragment
+	buf.Write(testFragment(180000, 30)[:50])
+
+	r := bytes.NewReader(buf.Bytes())
+	l, err := scanMP4(r, int64(buf.Len()))
+	require.NoError(t, err)
+	require.NotNil(t, l.moov)
+	require.Len(t, l.fragments, 2)
+	require.Equal(t, complete, l.validEnd)
+
+	samples, duration, err := fragmentsSummary(r, l)
+	require.NoError(t, err)
+	require.Equal(t, 60, samples)
+	require.Equal(t, 2.0, duration)
+}
+
+func testNALU(nalu ...byte) []byte {
+	return append(testUint32(uint32(len(nalu))), nalu...)
+}
+
+func TestScanTruncatedMP4(t *testing.T) {
+	var mdat bytes.Buffer
+	mdat.Write(testNALU(0x67, 0x42, 0x00, 0x1e)) // SPS
+	mdat.Write(testNALU(0x68, 0xce, 0x38, 0x80)) // PPS
+	mdat.Write(testNALU(0x65, 0x88, 0x84, 0x00)) // IDR
+	mdat.Write([]byte{0x21, 0x10, 0x05, 0x20, 0xa4, 0x1b, 0xff, 0xc0})
+	mdat.Write(testNALU(0x41, 0x9a, 0x02, 0x03)) // non-IDR
+	mdat.Write(testNALU(0x41, 0x9a, 0x04, 0x05)) // non-IDR
+	mdat.Write(testNALU(0x41, 0x9a, 0x06, 0x07)[:6])
+
+	var buf bytes.Buffer
+	buf.Write(testBox("ftyp", []byte("isom")))
+	buf.Write([]byte{0, 0, 0, 8, 'm', 'd', 'a', 't'}) // placeholder size
+	buf.Write(mdat.Bytes())
+
+	r := bytes.NewReader(buf.Bytes())
+	l, err := scanMP4(r, int64(buf.Len()))
+	require.NoError(t, err)
+	require.Nil(t, l.moov)
+	require.Equal(t, int64(buf.Len()), l.mdatEnd)
+
+	codec := detectCodec(r, l.mdatStart, l.mdatEnd)
+	require.Equal(t, codecH264, codec)
+
+	var aus []*accessUnit
+	err = walkAccessUnits(newNALUScanner(r, l.mdatStart, l.mdatEnd, codec), func(au *accessUnit) error {
+		aus = append(aus, au)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, aus, 2)
+	require.True(t, aus[0].key)
+	require.Len(t, aus[0].nalus, 3)
+	require.True(t, hasParameterSets(codec, aus[0]))
+	require.False(t, aus[1].key)
+}
+
+func testTSPacket(pusi bool, payload []byte) []byte {
+	pkt := make([]byte, tsPacketSize)
+	pkt[0] = tsSyncByte
+	pkt[1] = 0x01 // PID 256
+	if pusi {
+		pkt[1] |= 0x40
+	}
+	pkt[3] = 0x10 // payload only
+	copy(pkt[4:], payload)
+	return pkt
+}
+
+func testPES(pts int64) []byte {
+	return []byte{
+		0, 0, 1, 0xE0, 0, 0, 0x80, 0x80, 5,
+		byte(0x21 | (pts>>29)&0x0E), byte(pts >> 22), byte(0x01 | (pts>>14)&0xFE),
+		byte(pts >> 7), byte(0x01 | (pts<<1)&0xFE),
+	}
+}
+
+func TestScanTS(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(testTSPacket(true, testPES(90000)))
+	buf.Write(testTSPacket(false, nil))
+	buf.Write([]byte{1, 2, 3}) // garbage
+	buf.Write(testTSPacket(true, testPES(3*90000)))
+	buf.Write(testTSPacket(true, testPES(5*90000))[:100]) // truncated
+
+	l := scanTS(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.Equal(t, []tsRun{{0, 376}, {379, 567}}, l.runs)
+	require.Equal(t, int64(3), l.packets)
+	require.Equal(t, 2, l.pes)
+	require.Equal(t, 2.0, l.duration())
+	require.Equal(t, int64(3*tsPacketSize), l.validSize())
+}
+
+// testBits writes the bitstream of H264 parameter sets and slice headers.
+type testBits struct {
+	buf []byte
+	n   int
+}
+
+func (b *testBits) write(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if b.n%8 == 0 {
+			b.buf = append(b.buf, 0)
+		}
+		b.buf[len(b.buf)-1] |= byte((v>>i)&1) << (7 - b.n%8)
+		b.n++
+	}
+}
+
+func (b *testBits) golomb(v uint64) {
+	n := 0
+	for (v+1)>>n > 1 {
+		n++
+	}
+	b.write(0, n)
+	b.write(v+1, n+1)
+}
+
+func (b *testBits) bytes() []byte {
+	b.write(1, 1) // rbsp_stop_one_bit
+	return b.buf
+}
+
+// testSPS is a H264 SPS with pic_order_cnt_type 0 and 6-bit POC LSBs.
+func testSPS() []byte {
+	b := &testBits{}
+	b.write(0x67, 8)
+	b.write(77, 8) // profile_idc
+	b.write(0, 8)
+	b.write(30, 8) // level_idc
+	b.golomb(0)    // seq_parameter_set_id
+	b.golomb(0)    // log2_max_frame_num_minus4
+	b.golomb(0)    // pic_order_cnt_type
+	b.golomb(2)    // log2_max_pic_order_cnt_lsb_minus4
+	b.golomb(2)    // max_num_ref_frames
+	b.write(0, 1)  // gaps_in_frame_num_value_allowed_flag
+	b.golomb(19)   // pic_width_in_mbs_minus1
+	b.golomb(14)   // pic_height_in_map_units_minus1
+	b.write(1, 1)  // frame_mbs_only_flag
+	b.write(1, 1)  // direct_8x8_inference_flag
+	b.write(0, 1)  // frame_cropping_flag
+	b.write(0, 1)  // vui_parameters_present_flag
+	return b.bytes()
+}
+
+func testPPS() []byte {
+	b := &testBits{}
+	b.write(0x68, 8)
+	b.golomb(0)   // pic_parameter_set_id
+	b.golomb(0)   // seq_parameter_set_id
+	b.write(0, 2) // entropy_coding_mode_flag, bottom_field_pic_order_in_frame_present_flag
+	b.golomb(0)   // num_slice_groups_minus1
+	b.golomb(0)   // num_ref_idx_l0_default_active_minus1
+	b.golomb(0)   // num_ref_idx_l1_default_active_minus1
+	b.write(0, 3) // weighted_pred_flag, weighted_bipred_idc
+	b.golomb(0)   // pic_init_qp_minus26
+	b.golomb(0)   // pic_init_qs_minus26
+	b.golomb(0)   // chroma_qp_index_offset
+	b.write(0, 3) // deblocking_filter_control_present_flag, constrained_intra_pred_flag, redundant_pic_cnt_present_flag
+	return b.bytes()
+}
+
+func testSlice(idr bool, sliceType uint64, poc uint64) []byte {
+	b := &testBits{}
+	if idr {
+		b.write(0x65, 8)
+	} else {
+		b.write(0x41, 8)
+	}
+	b.golomb(0)         // first_mb_in_slice
+	b.golomb(sliceType) // slice_type
+	b.golomb(0)         // pic_parameter_set_id
+	b.write(0, 4)       // frame_num
+	if idr {
+		b.golomb(0) // idr_pic_id
+	}
+	b.write(poc, 6) // pic_order_cnt_lsb
+	return append(b.bytes(), 0xAA, 0xBB, 0xCC)
+}
+
+func testAnnexB(nalus ...[]byte) []byte {
+	var buf bytes.Buffer
+	for _, nalu := range nalus {
+		buf.Write([]byte{0, 0, 0, 1})
+		buf.Write(nalu)
+	}
+	return buf.Bytes()
+}
+
+var testAACConfig = &mpeg4audio.AudioSpecificConfig{
+	Type:         mpeg4audio.ObjectTypeAACLC,
+	SampleRate:   44100,
+	ChannelCount: 2,
+}
+
+func testADTS(t *testing.T, au []byte) []byte {
+	buf, err := mpeg4audio.ADTSPackets{{
+		Type:         testAACConfig.Type,
+		SampleRate:   testAACConfig.SampleRate,
+		ChannelCount: testAACConfig.ChannelCount,
+		AU:           au,
+	}}.Marshal()
+	require.NoError(t, err)
+	return buf
+}
+
+type testPacket struct {
+	pts uint64
+	dts uint64
+}
+
+// readTestMP4 reads the tracks and the packets of a MP4 file.
+func readTestMP4(t *testing.T, fpath string) ([]mp4.TrackInfo, map[int][]testPacket) {
+	f, err := os.Open(fpath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	d := mp4.CreateMp4Demuxer(f)
+	tracks, err := d.ReadHead()
+	require.NoError(t, err)
+
+	packets := make(map[int][]testPacket)
+	for {
+		pkt, err := d.ReadPacket()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		packets[pkt.TrackId] = append(packets[pkt.TrackId], testPacket{pkt.Pts, pkt.Dts})
+	}
+
+	return tracks, packets
+}
+
+func testRecordDir(t *testing.T) (string, string) {
+	recordPath := t.TempDir()
+	err := os.Mkdir(filepath.Join(recordPath, "20260101"), 0o755)
+	require.NoError(t, err)
+	return recordPath, filepath.Join(recordPath, "20260101", "rec.mp4")
+}
+
+func TestRunFragmentedMP4(t *testing.T) {
+	recordPath, fpath := testRecordDir(t)
+
+	f, err := os.Create(fpath)
+	require.NoError(t, err)
+
+	muxer, err := mp4.CreateMp4Muxer(f, mp4.WithMp4Flag(mp4.MP4_FLAG_FRAGMENT))
+	require.NoError(t, err)
+
+	video := muxer.AddVideoTrack(mp4.MP4_CODEC_H264)
+	audio := muxer.AddAudioTrack(mp4.MP4_CODEC_AAC,
+		mp4.WithAudioSampleRate(44100), mp4.WithAudioChannelCount(2))
+
+	// fragments start at keyframes, one every 5 frames
+	for i := range 16 {
+		var au []byte
+		if i%5 == 0 {
+			au = testAnnexB(testSPS(), testPPS(), testSlice(true, 7, 0))
+		} else {
+			au = testAnnexB(testSlice(false, 5, uint64(i%5)*2))
+		}
+
+		ts := uint64(i) * 40
+		err = muxer.Write(video, au, ts, ts)
+		require.NoError(t, err)
+
+		err = muxer.Write(audio, testADTS(t, []byte{0x21, 0x10, byte(i)}), ts, ts)
+		require.NoError(t, err)
+	}
+
+	// the last fragment is truncated
+	size, err := f.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	err = muxer.FlushFragment()
+	require.NoError(t, err)
+	f.Close()
+
+	err = os.Truncate(fpath, size+50)
+	require.NoError(t, err)
+
+	report, err := (&Repairer{RecordPath: recordPath, Parent: test.NilLogger}).Run()
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Repaired)
+	require.Equal(t, "fmp4", report.Files[0].Format)
+
+	tracks, packets := readTestMP4(t, fpath)
+	require.Len(t, tracks, 2)
+	require.Equal(t, mp4.MP4_CODEC_H264, tracks[0].Cid)
+	require.Equal(t, mp4.MP4_CODEC_AAC, tracks[1].Cid)
+	require.Len(t, packets[tracks[0].TrackId], 15)
+	require.Len(t, packets[tracks[1].TrackId], 15)
+}
+
+func TestRunTruncatedMP4(t *testing.T) {
+	recordPath, fpath := testRecordDir(t)
+
+	f, err := os.Create(fpath)
+	require.NoError(t, err)
+
+	muxer, err := mp4.CreateMp4Muxer(f)
+	require.NoError(t, err)
+
+	video := muxer.AddVideoTrack(mp4.MP4_CODEC_H264)
+	audio := muxer.AddAudioTrack(mp4.MP4_CODEC_AAC,
+		mp4.WithAudioSampleRate(44100), mp4.WithAudioChannelCount(2))
+
+	// recovery hints are written in the same way as the recorder
+	config, err := testAACConfig.Marshal()
+	require.NoError(t, err)
+	hint, err := TracksHint([]HintTrack{{
+		Codec:        HintCodecAAC,
+		SampleRate:   44100,
+		ChannelCount: 2,
+		Config:       config,
+	}})
+	require.NoError(t, err)
+	_, err = f.Write(hint)
+	require.NoError(t, err)
+
+	// I P B B P B B, in decoding order
+	frames := []struct {
+		idr       bool
+		sliceType uint64
+		poc       uint64
+	}{
+		{true, 7, 0},
+		{false, 5, 6},
+		{false, 6, 2},
+		{false, 6, 4},
+		{false, 5, 12},
+		{false, 6, 8},
+		{false, 6, 10},
+		{false, 5, 18},
+		{false, 5, 24},
+	}
+
+	for i, fr := range frames {
+		au := testAnnexB(testSlice(fr.idr, fr.sliceType, fr.poc))
+		if fr.idr {
+			au = testAnnexB(testSPS(), testPPS(), testSlice(fr.idr, fr.sliceType, fr.poc))
+		}
+
+		ts := uint64(i) * 40
+		err = muxer.Write(video, au, ts+40, ts)
+		require.NoError(t, err)
+
+		sample := []byte{0x21, 0x10, byte(i)}
+		_, err = f.Write(SampleHint(0, ts, len(sample)))
+		require.NoError(t, err)
+		err = muxer.Write(audio, testADTS(t, sample), ts, ts)
+		require.NoError(t, err)
+	}
+
+	// the file is left without index
+	f.Close()
+
+	report, err := (&Repairer{RecordPath: recordPath, Parent: test.NilLogger}).Run()
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Repaired)
+	require.Equal(t, "index missing, H264 video rebuilt at 25.00 fps (default), 9 audio samples recovered",
+		report.Files[0].Detail)
+
+	// the last access unit of the sample data is discarded, since it may be truncated
+	require.Equal(t, 7, report.Files[0].Samples)
+
+	tracks, packets := readTestMP4(t, fpath)
+	require.Len(t, tracks, 2)
+	require.Equal(t, mp4.MP4_CODEC_H264, tracks[0].Cid)
+	require.Equal(t, mp4.MP4_CODEC_AAC, tracks[1].Cid)
+	require.Equal(t, uint32(44100), tracks[1].SampleRate)
+	require.Equal(t, uint8(2), tracks[1].ChannelCount)
+
+	require.Equal(t, []testPacket{
+		{40, 0},
+		{160, 40},
+		{80, 80},
+		{120, 120},
+		{280, 160},
+		{200, 200},
+		{240, 240},
+	}, packets[tracks[0].TrackId])
+
+	var audioDTS []uint64
+	for _, pkt := range packets[tracks[1].TrackId] {
+		audioDTS = append(audioDTS, pkt.dts)
+	}
+	require.Equal(t, []uint64{0, 40, 80, 120, 160, 200, 240, 280, 320}, audioDTS)
+
+	_, err = os.Stat(fpath + backupSuffix)
+	require.NoError(t, err)
+}
+
+func TestPresentationOffsets(t *testing.T) {
+	for _, ca := range []struct {
+		name     string
+		pocs     []int64
+		expected []int
+	}{
+		{
+			"decoding order",
+			[]int64{0, 2, 4, 6},
+			[]int{0, 0, 0, 0},
+		},
+		{
+			"b-frames",
+			[]int64{0, 6, 2, 4, 12, 8, 10},
+			[]int{1, 3, 0, 0, 3, 0, 0},
+		},
+		{
+			"pyramid",
+			[]int64{0, 8, 4, 2, 6},
+			[]int{2, 5, 2, 0, 1},
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.expected, presentationOffsets(ca.pocs))
+		})
+	}
+}
+
+func TestPictureOrder(t *testing.T) {
+	var pocs []int64
+	o := &pictureOrder{codec: codecH264}
+
+	// POC LSBs wrap around at 64, and are reset by IDR pictures
+	for _, au := range []*accessUnit{
+		{nalus: [][]byte{testSPS(), testPPS(), testSlice(true, 7, 0)}},
+		{nalus: [][]byte{testSlice(false, 5, 30)}},
+		{nalus: [][]byte{testSlice(false, 5, 60)}},
+		{nalus: [][]byte{testSlice(false, 5, 10)}},
+		{nalus: [][]byte{testSlice(false, 6, 2)}},
+		{nalus: [][]byte{testSlice(true, 7, 0)}},
+		{nalus: [][]byte{testSlice(false, 5, 4)}},
+	} {
+		pocs = append(pocs, o.next(au))
+	}
+
+	require.False(t, o.failed)
+	require.Equal(t, []int64{0, 30, 60, 74, 66, 75, 79}, pocs)
+
+	// POC type 2 means that pictures are presented in decoding order
+	o = &pictureOrder{codec: codecH264}
+	o.next(&accessUnit{nalus: [][]byte{test.FormatH264.SPS, test.FormatH264.PPS, {0x65, 0x88}}})
+	require.True(t, o.failed)
+}
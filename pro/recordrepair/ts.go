@@ -0,0 +1,168 @@
+package recordrepair
+
+import (
+	"io"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+)
+
+// tsRun is a sequence of consecutive, aligned packets.
+type tsRun struct {
+	start int64
+	end   int64
+}
+
+// tsLayout is the result of the scan of a MPEG-TS file.
+type tsLayout struct {
+	runs    []tsRun
+	packets int64
+	pes     int
+
+	// PTS range of the elementary stream with the most PES packets
+	ptsRanges map[uint16]*ptsRange
+}
+
+type ptsRange struct {
+	count int
+	first int64
+	last  int64
+}
+
+func (l *tsLayout) validSize() int64 {
+	size := int64(0)
+	for _, run := range l.runs {
+		size += run.end - run.start
+	}
+	return size
+}
+
+// duration returns the duration of the content, in seconds.
+func (l *tsLayout) duration() float64 {
+	var best *ptsRange
+	for _, r := range l.ptsRanges {
+		if best == nil || r.count > best.count {
+			best = r
+		}
+	}
+
+	if best == nil || best.last < best.first {
+		return 0
+	}
+	return float64(best.last-best.first) / 90000
+}
+
+// tsSyncedAt checks whether a packet starts at given offset,
+// by looking for the sync byte of the following packet too.
+func tsSyncedAt(br *blockReader, off int64) bool {
+	b := br.read(off, 1)
+	if b == nil || b[0] != tsSyncByte {
+		return false
+	}
+
+	// the last packet of the file
+	if (br.end - off) < 2*tsPacketSize {
+		return (br.end - off) >= tsPacketSize
+	}
+
+	b = br.read(off+tsPacketSize, 1)
+	return b != nil && b[0] == tsSyncByte
+}
+
+// scanTS finds the complete packets of a MPEG-TS file, skipping garbage and a truncated last packet.
+func scanTS(r io.ReaderAt, fileSize int64) *tsLayout {
+	l := &tsLayout{ptsRanges: make(map[uint16]*ptsRange)}
+	br := &blockReader{r: r, end: fileSize}
+	off := int64(0)
+
+	for (fileSize - off) >= tsPacketSize {
+		pkt := br.read(off, tsPacketSize)
+		if pkt == nil {
+			break
+		}
+
+		if pkt[0] != tsSyncByte {
+			// lost sync, look for the next packet
+			found := false
+			for off++; (fileSize - off) >= tsPacketSize; off++ {
+				if tsSyncedAt(br, off) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				break
+			}
+			continue
+		}
+
+		if n := len(l.runs); n != 0 && l.runs[n-1].end == off {
+			l.runs[n-1].end = off + tsPacketSize
+		} else {
+			l.runs = append(l.runs, tsRun{start: off, end: off + tsPacketSize})
+		}
+
+		l.packets++
+		l.parsePacket(pkt)
+		off += tsPacketSize
+	}
+
+	return l
+}
+
+// parsePacket reads the PTS of PES packets that start in a TS packet.
+func (l *tsLayout) parsePacket(pkt []byte) {
+	if pkt[1]&0x40 == 0 { // payload_unit_start_indicator
+		return
+	}
+
+	pid := uint16(pkt[1]&0x1F)<<8 | uint16(pkt[2])
+	pos := 4
+
+	switch (pkt[3] >> 4) & 0x03 { // adaptation_field_control
+	case 0, 2: // no payload
+		return
+
+	case 3:
+		pos += 1 + int(pkt[4])
+	}
+
+	if len(pkt) < pos+14 {
+		return
+	}
+
+	pes := pkt[pos:]
+	if pes[0] != 0 || pes[1] != 0 || pes[2] != 1 {
+		return
+	}
+
+	// audio and video streams only
+	if pes[3] < 0xC0 || pes[3] > 0xEF {
+		return
+	}
+
+	l.pes++
+
+	if pes[7]&0x80 == 0 { // PTS_DTS_flags
+		return
+	}
+
+	p := pes[9:14]
+	pts := int64(p[0]>>1&0x07)<<30 | int64(p[1])<<22 | int64(p[2]>>1)<<15 | int64(p[3])<<7 | int64(p[4]>>1)
+
+	r, ok := l.ptsRanges[pid]
+	if !ok {
+		r = &ptsRange{first: pts}
+		l.ptsRanges[pid] = r
+	}
+
+	r.count++
+	if pts > r.last {
+		r.last = pts
+	}
+	if pts < r.first {
+		r.first = pts
+	}
+}
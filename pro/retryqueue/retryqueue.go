@@ -0,0 +1,66 @@
+// Package retryqueue contains the helpers shared by the persistent queues
+// that retry failed operations, like the webhook outbox and the PACS queue.
+package retryqueue
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Backoff is an exponential backoff.
+// The wait between attempts starts at Min and doubles after each failure, up to Max.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// Wait returns the wait after the given number of failed attempts.
+func (b Backoff) Wait(attempts int) time.Duration {
+	d := b.Min
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= b.Max {
+			return b.Max
+		}
+	}
+	return d
+}
+
+// ReadJSON decodes a file written by WriteJSON into v.
+// A missing file is not an error and leaves v untouched.
+func ReadJSON(fpath string, v interface{}) error {
+	buf, err := os.ReadFile(fpath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(buf, v)
+}
+
+// WriteJSON encodes v into a file.
+// The file is replaced atomically, therefore a crash never leaves a partial queue.
+func WriteJSON(fpath string, v interface{}) error {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(fpath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := fpath + ".tmp"
+	err = os.WriteFile(tmpPath, buf, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, fpath)
+}
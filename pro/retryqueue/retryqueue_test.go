@@ -0,0 +1,47 @@
+package retryqueue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Min: 5 * time.Second, Max: 30 * time.Minute}
+
+	require.Equal(t, 5*time.Second, b.Wait(0))
+	require.Equal(t, 5*time.Second, b.Wait(1))
+	require.Equal(t, 10*time.Second, b.Wait(2))
+	require.Equal(t, 40*time.Second, b.Wait(4))
+	require.Equal(t, 1280*time.Second, b.Wait(9))
+	require.Equal(t, 30*time.Minute, b.Wait(10))
+	require.Equal(t, 30*time.Minute, b.Wait(1000))
+}
+
+func TestJSON(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "sub", "queue.json")
+
+	var items []string
+	err := ReadJSON(fpath, &items)
+	require.NoError(t, err)
+	require.Nil(t, items)
+
+	err = WriteJSON(fpath, []string{"a", "b"})
+	require.NoError(t, err)
+
+	err = ReadJSON(fpath, &items)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, items)
+
+	_, err = os.Stat(fpath + ".tmp")
+	require.True(t, os.IsNotExist(err))
+
+	err = os.WriteFile(fpath, []byte("{"), 0o644)
+	require.NoError(t, err)
+
+	err = ReadJSON(fpath, &items)
+	require.Error(t, err)
+}
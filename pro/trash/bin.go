@@ -0,0 +1,399 @@
+// Package trash contains the Pro recycle bin of deleted files.
+package trash
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+	"github.com/bluenviron/mediamtx/pro/recorder"
+)
+
+// FolderName is the name of the recycle bin, in the record path.
+const FolderName = "trash"
+
+const (
+	// fileSuffix is appended to deleted files, in order to hide them from the playback server and the file index.
+	fileSuffix = ".deleted"
+
+	// itemSuffix is appended to deleted files to obtain the path of the file that describes them.
+	itemSuffix = ".item.json"
+
+	defaultRetention = 7 * 24 * time.Hour
+
+	// purgeInterval is the interval between checks of expired items.
+	purgeInterval = time.Hour
+)
+
+// Errors.
+var (
+	ErrItemNotFound = errors.New("item not found")
+	ErrFileExists   = errors.New("a file with the same path already exists")
+)
+
+// Item is a deleted file.
+type Item struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	RecordPath   string    `json:"recordPath"`   // record path of the bin
+	OriginalPath string    `json:"originalPath"` // relative to the record path, slash separated
+	Size         int64     `json:"size"`
+	DeletedAt    time.Time `json:"deletedAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+
+	// path of the deleted file, relative to the record path
+	path string
+}
+
+// Bin moves deleted files into per-day folders of FolderName (trash/YYYYMMDD),
+// together with their sidecar files and the original path.
+// Files can be restored until they are purged, manually or when Retention expires.
+type Bin struct {
+	RecordPath string
+	Retention  time.Duration   // defaults to 7 days
+	OnPurge    func(item Item) // optional, called when a file has been removed permanently
+	Parent     logger.Writer
+
+	mutex     sync.Mutex
+	terminate chan struct{}
+	done      chan struct{}
+}
+
+// Initialize initializes the Bin.
+func (b *Bin) Initialize() {
+	if b.Retention <= 0 {
+		b.Retention = defaultRetention
+	}
+
+	b.terminate = make(chan struct{})
+	b.done = make(chan struct{})
+
+	go b.run()
+}
+
+// Close closes the Bin.
+func (b *Bin) Close() {
+	close(b.terminate)
+	<-b.done
+}
+
+// Log implements logger.Writer.
+func (b *Bin) Log(level logger.Level, format string, args ...interface{}) {
+	b.Parent.Log(level, "[trash] "+format, args...)
+}
+
+func (b *Bin) run() {
+	defer close(b.done)
+
+	b.PurgeExpired(time.Now())
+
+	t := time.NewTicker(purgeInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			b.PurgeExpired(time.Now())
+
+		case <-b.terminate:
+			return
+		}
+	}
+}
+
+func (b *Bin) fullPath(rel string) string {
+	return filepath.Join(b.RecordPath, filepath.FromSlash(rel))
+}
+
+// moveFile moves a file and its sidecar files.
+func moveFile(oldPath string, newPath string) error {
+	err := os.MkdirAll(filepath.Dir(newPath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	err = recorder.MoveBookmarks(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+
+	return recordstore.MoveMetadata(oldPath, newPath)
+}
+
+// Delete moves a file of the record path into the bin.
+func (b *Bin) Delete(fullPath string) (Item, error) {
+	root, _ := filepath.Abs(b.RecordPath)
+	abs, _ := filepath.Abs(fullPath)
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return Item{}, fmt.Errorf("%s is outside of the record path", fullPath)
+	}
+	rel = filepath.ToSlash(rel)
+
+	if strings.HasPrefix(rel, FolderName+"/") {
+		return Item{}, fmt.Errorf("%s is already in the trash", fullPath)
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return Item{}, err
+	}
+	if info.IsDir() {
+		return Item{}, fmt.Errorf("%s is a directory", fullPath)
+	}
+
+	now := time.Now()
+
+	item := Item{
+		ID:           uuid.New().String(),
+		Name:         filepath.Base(fullPath),
+		RecordPath:   b.RecordPath,
+		OriginalPath: rel,
+		Size:         info.Size(),
+		DeletedAt:    now,
+		ExpiresAt:    now.Add(b.Retention),
+	}
+	item.path = FolderName + "/" + now.Format("20060102") + "/" + item.ID + fileSuffix
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	err = moveFile(fullPath, b.fullPath(item.path))
+	if err != nil {
+		return Item{}, err
+	}
+
+	err = writeItem(b.fullPath(item.path), &item)
+	if err != nil {
+		moveFile(b.fullPath(item.path), fullPath) //nolint:errcheck
+		return Item{}, err
+	}
+
+	b.Log(logger.Info, "%s moved to the trash", rel)
+
+	return item, nil
+}
+
+// List returns the items of the bin, newest first.
+func (b *Bin) List() []Item {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	items := b.items()
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+
+	return items
+}
+
+// Restore moves an item back to its original path.
+func (b *Bin) Restore(id string) (Item, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	item, err := b.find(id)
+	if err != nil {
+		return Item{}, err
+	}
+
+	dest := b.fullPath(item.OriginalPath)
+
+	if _, err = os.Stat(dest); err == nil {
+		return Item{}, ErrFileExists
+	}
+
+	err = moveFile(b.fullPath(item.path), dest)
+	if err != nil {
+		return Item{}, err
+	}
+
+	os.Remove(b.fullPath(item.path) + itemSuffix)
+	b.removeEmptyFolder(item.path)
+
+	b.Log(logger.Info, "%s restored", item.OriginalPath)
+
+	return item, nil
+}
+
+// Purge removes items permanently. When ids is empty, the whole bin is emptied.
+func (b *Bin) Purge(ids []string) ([]Item, error) {
+	b.mutex.Lock()
+
+	var targets []Item
+
+	if len(ids) == 0 {
+		targets = b.items()
+	} else {
+		for _, id := range ids {
+			item, err := b.find(id)
+			if err != nil {
+				b.mutex.Unlock()
+				return nil, fmt.Errorf("%w: %s", err, id)
+			}
+			targets = append(targets, item)
+		}
+	}
+
+	purged := b.purge(targets)
+	b.mutex.Unlock()
+
+	b.notify(purged)
+
+	return purged, nil
+}
+
+// PurgeExpired removes items whose retention has expired.
+func (b *Bin) PurgeExpired(now time.Time) {
+	b.mutex.Lock()
+
+	var targets []Item
+	for _, item := range b.items() {
+		if !now.Before(item.ExpiresAt) {
+			targets = append(targets, item)
+		}
+	}
+
+	purged := b.purge(targets)
+	b.mutex.Unlock()
+
+	if len(purged) != 0 {
+		b.Log(logger.Info, "%d expired files removed", len(purged))
+	}
+
+	b.notify(purged)
+}
+
+func (b *Bin) notify(items []Item) {
+	if b.OnPurge != nil {
+		for _, item := range items {
+			b.OnPurge(item)
+		}
+	}
+}
+
+// purge removes items. Must be called with the mutex held.
+func (b *Bin) purge(items []Item) []Item {
+	purged := []Item{}
+
+	for _, item := range items {
+		fpath := b.fullPath(item.path)
+
+		err := os.Remove(fpath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			b.Log(logger.Warn, "failed to remove %s: %v", fpath, err)
+			continue
+		}
+
+		recorder.RemoveBookmarks(fpath)   //nolint:errcheck
+		recordstore.RemoveMetadata(fpath) //nolint:errcheck
+		os.Remove(fpath + itemSuffix)
+		b.removeEmptyFolder(item.path)
+
+		b.Log(logger.Info, "%s removed permanently", item.OriginalPath)
+		purged = append(purged, item)
+	}
+
+	return purged
+}
+
+// removeEmptyFolder removes the day folder of an item when it's empty.
+func (b *Bin) removeEmptyFolder(rel string) {
+	dir := filepath.Dir(b.fullPath(rel))
+
+	entries, err := os.ReadDir(dir)
+	if err == nil && len(entries) == 0 {
+		os.Remove(dir)
+	}
+}
+
+func (b *Bin) has(id string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	_, err := b.find(id)
+	return err == nil
+}
+
+// find returns an item. Must be called with the mutex held.
+func (b *Bin) find(id string) (Item, error) {
+	for _, item := range b.items() {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return Item{}, ErrItemNotFound
+}
+
+// items reads the items of all day folders. Must be called with the mutex held.
+func (b *Bin) items() []Item {
+	items := []Item{}
+
+	days, err := os.ReadDir(b.fullPath(FolderName))
+	if err != nil {
+		return items
+	}
+
+	for _, day := range days {
+		if !day.IsDir() {
+			continue
+		}
+
+		matches, _ := filepath.Glob(filepath.Join(b.fullPath(FolderName), day.Name(), "*"+fileSuffix+itemSuffix))
+
+		for _, match := range matches {
+			item, err := readItem(strings.TrimSuffix(match, itemSuffix))
+			if err != nil {
+				b.Log(logger.Warn, "%v", err)
+				continue
+			}
+
+			item.RecordPath = b.RecordPath
+			item.path = FolderName + "/" + day.Name() + "/" + strings.TrimSuffix(filepath.Base(match), itemSuffix)
+			items = append(items, *item)
+		}
+	}
+
+	return items
+}
+
+func readItem(fpath string) (*Item, error) {
+	buf, err := os.ReadFile(fpath + itemSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var item Item
+	err = json.Unmarshal(buf, &item)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trash item %s: %w", fpath+itemSuffix, err)
+	}
+
+	return &item, nil
+}
+
+func writeItem(fpath string, item *Item) error {
+	buf, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fpath+itemSuffix, buf, 0o644)
+}
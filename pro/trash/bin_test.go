@@ -0,0 +1,231 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/pro/recorder"
+)
+
+func writeTestFile(t *testing.T, fpath string) {
+	err := os.MkdirAll(filepath.Dir(fpath), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(fpath, []byte("content"), 0o644)
+	require.NoError(t, err)
+
+	err = recordstore.WriteMetadata(fpath, &recordstore.Metadata{PathName: "cam1", Duration: 1})
+	require.NoError(t, err)
+
+	err = os.WriteFile(recorder.BookmarksPath(fpath), []byte(`{"bookmarks":[]}`), 0o644)
+	require.NoError(t, err)
+}
+
+func TestBinRestore(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "20240519", "20240519-1000-aaaaaaaa.mp4")
+	writeTestFile(t, fpath)
+
+	b := &Bin{
+		RecordPath: dir,
+		Parent:     test.NilLogger,
+	}
+	b.Initialize()
+	defer b.Close()
+
+	item, err := b.Delete(fpath)
+	require.NoError(t, err)
+	require.Equal(t, "20240519/20240519-1000-aaaaaaaa.mp4", item.OriginalPath)
+	require.Equal(t, "20240519-1000-aaaaaaaa.mp4", item.Name)
+	require.Equal(t, int64(7), item.Size)
+	require.Equal(t, 7*24*time.Hour, item.ExpiresAt.Sub(item.DeletedAt))
+
+	_, err = os.Stat(fpath)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(recordstore.MetadataPath(fpath))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// deleted files are not recordings anymore
+	segs, err := recordstore.FindSegments(&conf.Path{RecordPath: dir}, "cam1", nil, nil)
+	require.Error(t, err)
+	require.Nil(t, segs)
+
+	items := b.List()
+	require.Len(t, items, 1)
+	require.Equal(t, item.ID, items[0].ID)
+
+	_, err = b.Restore("invalid")
+	require.ErrorIs(t, err, ErrItemNotFound)
+
+	// a new file with the same path prevents restoring
+	err = os.WriteFile(fpath, []byte("other"), 0o644)
+	require.NoError(t, err)
+
+	_, err = b.Restore(item.ID)
+	require.ErrorIs(t, err, ErrFileExists)
+
+	err = os.Remove(fpath)
+	require.NoError(t, err)
+
+	_, err = b.Restore(item.ID)
+	require.NoError(t, err)
+
+	buf, err := os.ReadFile(fpath)
+	require.NoError(t, err)
+	require.Equal(t, []byte("content"), buf)
+
+	m, err := recordstore.ReadMetadata(fpath)
+	require.NoError(t, err)
+	require.Equal(t, "cam1", m.PathName)
+
+	_, err = os.Stat(recorder.BookmarksPath(fpath))
+	require.NoError(t, err)
+
+	require.Empty(t, b.List())
+
+	// empty day folders are removed
+	entries, err := os.ReadDir(filepath.Join(dir, FolderName))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestBinPurge(t *testing.T) {
+	dir := t.TempDir()
+
+	var purged []string
+
+	b := &Bin{
+		RecordPath: dir,
+		Retention:  time.Hour,
+		OnPurge: func(item Item) {
+			purged = append(purged, item.OriginalPath)
+		},
+		Parent: test.NilLogger,
+	}
+	b.Initialize()
+	defer b.Close()
+
+	var ids []string
+
+	for _, name := range []string{"a.mp4", "b.mp4", "c.jpg"} {
+		fpath := filepath.Join(dir, "20240519", name)
+		writeTestFile(t, fpath)
+
+		item, err := b.Delete(fpath)
+		require.NoError(t, err)
+		ids = append(ids, item.ID)
+	}
+
+	_, err := b.Delete(filepath.Join(dir, "20240519", "missing.mp4"))
+	require.Error(t, err)
+
+	_, err = b.Purge([]string{"invalid"})
+	require.ErrorIs(t, err, ErrItemNotFound)
+	require.Len(t, b.List(), 3)
+
+	items, err := b.Purge(ids[:1])
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, []string{"20240519/a.mp4"}, purged)
+	require.Len(t, b.List(), 2)
+
+	// items are kept until the retention expires
+	b.PurgeExpired(time.Now())
+	require.Len(t, b.List(), 2)
+
+	b.PurgeExpired(time.Now().Add(time.Hour))
+	require.Empty(t, b.List())
+	require.ElementsMatch(t, []string{"20240519/a.mp4", "20240519/b.mp4", "20240519/c.jpg"}, purged)
+
+	entries, err := os.ReadDir(filepath.Join(dir, FolderName))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// the whole bin can be emptied at once
+	fpath := filepath.Join(dir, "20240520", "d.mp4")
+	writeTestFile(t, fpath)
+	_, err = b.Delete(fpath)
+	require.NoError(t, err)
+
+	items, err = b.Purge(nil)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Empty(t, b.List())
+}
+
+func TestBins(t *testing.T) {
+	dir1 := t.TempDir()
+	dir2 := t.TempDir()
+
+	purged := make(map[string]string)
+
+	s := &Bins{
+		OnPurge: func(recordPath string, item Item) {
+			purged[item.OriginalPath] = recordPath
+		},
+		Parent: test.NilLogger,
+	}
+	s.Initialize()
+	defer s.Close()
+
+	var ids []string
+
+	for _, fpath := range []string{
+		filepath.Join(dir1, "20240519", "a.mp4"),
+		filepath.Join(dir2, "cam2", "20240519", "b.mp4"),
+		filepath.Join(dir2, "cam2", "20240519", "c.mp4"),
+	} {
+		writeTestFile(t, fpath)
+
+		recordPath := dir1
+		if filepath.Base(fpath) != "a.mp4" {
+			recordPath = dir2
+		}
+
+		item, err := s.Get(recordPath).Delete(fpath)
+		require.NoError(t, err)
+		require.Equal(t, recordPath, item.RecordPath)
+		ids = append(ids, item.ID)
+	}
+
+	// every record path has its own bin
+	require.Same(t, s.Get(dir1), s.Get(dir1+"/"))
+	_, err := os.Stat(filepath.Join(dir2, FolderName))
+	require.NoError(t, err)
+
+	items := s.List()
+	require.Len(t, items, 3)
+	require.Equal(t, ids[2], items[0].ID)
+	require.Equal(t, dir2, items[0].RecordPath)
+	require.Equal(t, "cam2/20240519/c.mp4", items[0].OriginalPath)
+
+	item, err := s.Restore(ids[1])
+	require.NoError(t, err)
+	require.Equal(t, dir2, item.RecordPath)
+	_, err = os.Stat(filepath.Join(dir2, "cam2", "20240519", "b.mp4"))
+	require.NoError(t, err)
+
+	_, err = s.Restore("invalid")
+	require.ErrorIs(t, err, ErrItemNotFound)
+
+	// nothing is purged when an item is missing
+	_, err = s.Purge([]string{ids[0], "invalid"})
+	require.ErrorIs(t, err, ErrItemNotFound)
+	require.Len(t, s.List(), 2)
+
+	items, err = s.Purge([]string{ids[0], ids[2]})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	require.Equal(t, map[string]string{
+		"20240519/a.mp4":      dir1,
+		"cam2/20240519/c.mp4": dir2,
+	}, purged)
+	require.Empty(t, s.List())
+}
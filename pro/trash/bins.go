@@ -0,0 +1,149 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// Bins are the recycle bins of several record paths, since paths can have their own record path.
+// Every record path has its own bin, therefore files are never moved to another file system.
+type Bins struct {
+	Retention time.Duration                      // defaults to 7 days
+	OnPurge   func(recordPath string, item Item) // optional, called when a file has been removed permanently
+	Parent    logger.Writer
+
+	mutex sync.Mutex
+	bins  map[string]*Bin
+}
+
+// Initialize initializes Bins.
+func (s *Bins) Initialize() {
+	s.bins = make(map[string]*Bin)
+}
+
+// Close closes all bins.
+func (s *Bins) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, b := range s.bins {
+		b.Close()
+	}
+}
+
+// Get returns the bin of a record path, starting it when needed.
+func (s *Bins) Get(recordPath string) *Bin {
+	recordPath = filepath.Clean(recordPath)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, ok := s.bins[recordPath]
+	if !ok {
+		b = &Bin{
+			RecordPath: recordPath,
+			Retention:  s.Retention,
+			Parent:     s.Parent,
+		}
+		if s.OnPurge != nil {
+			b.OnPurge = func(item Item) {
+				s.OnPurge(recordPath, item)
+			}
+		}
+		b.Initialize()
+		s.bins[recordPath] = b
+	}
+
+	return b
+}
+
+// all returns the started bins, sorted by record path.
+func (s *Bins) all() []*Bin {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	bins := make([]*Bin, 0, len(s.bins))
+	for _, b := range s.bins {
+		bins = append(bins, b)
+	}
+
+	sort.Slice(bins, func(i, j int) bool {
+		return bins[i].RecordPath < bins[j].RecordPath
+	})
+
+	return bins
+}
+
+// List returns the items of all bins, newest first.
+func (s *Bins) List() []Item {
+	items := []Item{}
+	for _, b := range s.all() {
+		items = append(items, b.List()...)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+
+	return items
+}
+
+// Restore moves an item back to its original path.
+func (s *Bins) Restore(id string) (Item, error) {
+	for _, b := range s.all() {
+		item, err := b.Restore(id)
+		if !errors.Is(err, ErrItemNotFound) {
+			return item, err
+		}
+	}
+	return Item{}, ErrItemNotFound
+}
+
+// Purge removes items permanently. When ids is empty, all bins are emptied.
+func (s *Bins) Purge(ids []string) ([]Item, error) {
+	bins := s.all()
+	purged := []Item{}
+
+	if len(ids) == 0 {
+		for _, b := range bins {
+			items, err := b.Purge(nil)
+			if err != nil {
+				return nil, err
+			}
+			purged = append(purged, items...)
+		}
+		return purged, nil
+	}
+
+	// items are looked up before purging anything, like in Bin.Purge
+	byBin := make(map[*Bin][]string)
+
+outer:
+	for _, id := range ids {
+		for _, b := range bins {
+			if b.has(id) {
+				byBin[b] = append(byBin[b], id)
+				continue outer
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrItemNotFound, id)
+	}
+
+	for _, b := range bins {
+		if binIDs, ok := byBin[b]; ok {
+			items, err := b.Purge(binIDs)
+			if err != nil {
+				return nil, err
+			}
+			purged = append(purged, items...)
+		}
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,458 @@
+// Package webhook contains the Pro webhook outbox.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/pro/retryqueue"
+)
+
+// FileName is the name of the outbox, in the record path.
+const FileName = "record_webhooks.json"
+
+const (
+	// maxAttempts is the number of attempts before a delivery is marked as failed.
+	maxAttempts = 12
+
+	// deliveredCount is the number of delivered events kept for inspection.
+	deliveredCount = 200
+
+	// failedCount is the number of failed events kept for replay.
+	failedCount = 1000
+
+	requestTimeout = 10 * time.Second
+)
+
+// Events.
+const (
+	EventRecordCreate = "record.create"
+	EventRecordDelete = "record.delete"
+)
+
+// Headers of webhook requests.
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	HeaderEvent          = "X-Webhook-Event"
+	HeaderTimestamp      = "X-Webhook-Timestamp"
+	HeaderSignature      = "X-Webhook-Signature"
+)
+
+// ErrDeliveryNotFound is returned when replaying a delivery that doesn't exist.
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// Status is the status of a delivery.
+type Status string
+
+// Statuses.
+const (
+	StatusPending   Status = "pending"
+	StatusDelivered Status = "delivered"
+	StatusFailed    Status = "failed"
+)
+
+// Delivery is a webhook event and its delivery state.
+// ID is sent as idempotency key: it doesn't change across retries and replays,
+// therefore the receiver can discard duplicates.
+type Delivery struct {
+	ID             string          `json:"id"`
+	Event          string          `json:"event"`
+	URL            string          `json:"url"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         Status          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	LastAttemptAt  *time.Time      `json:"lastAttemptAt,omitempty"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+	LastStatusCode int             `json:"lastStatusCode,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+}
+
+// Sign returns the signature of a request: the hex-encoded HMAC-SHA256 of "<timestamp>.<body>",
+// computed with the shared secret.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff is the wait between delivery attempts.
+var backoff = retryqueue.Backoff{Min: 5 * time.Second, Max: 30 * time.Minute}
+
+// Outbox delivers webhook events.
+// Events are saved on disk before being sent and retried with exponential backoff,
+// therefore they survive receiver outages and restarts of the server.
+type Outbox struct {
+	FilePath string
+	Secret   string // optional, requests are signed when set
+	Parent   logger.Writer
+
+	mutex      sync.Mutex
+	deliveries []*Delivery
+	client     *http.Client
+	wake       chan struct{}
+	terminate  chan struct{}
+	done       chan struct{}
+}
+
+// Initialize initializes the Outbox.
+func (o *Outbox) Initialize() error {
+	o.client = &http.Client{
+		Timeout: requestTimeout,
+	}
+	o.wake = make(chan struct{}, 1)
+	o.terminate = make(chan struct{})
+	o.done = make(chan struct{})
+
+	err := o.load()
+	if err != nil {
+		return err
+	}
+
+	go o.run()
+
+	return nil
+}
+
+// Close closes the Outbox. Pending deliveries are sent at the next start.
+func (o *Outbox) Close() {
+	close(o.terminate)
+	<-o.done
+}
+
+// Log implements logger.Writer.
+func (o *Outbox) Log(level logger.Level, format string, args ...interface{}) {
+	o.Parent.Log(level, "[webhook] "+format, args...)
+}
+
+// SetSecret changes the secret used to sign requests.
+func (o *Outbox) SetSecret(secret string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.Secret = secret
+}
+
+// Enqueue saves an event and schedules its delivery.
+func (o *Outbox) Enqueue(event string, url string, payload interface{}) (*Delivery, error) {
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	d := &Delivery{
+		ID:            uuid.New().String(),
+		Event:         event,
+		URL:           url,
+		Payload:       buf,
+		Status:        StatusPending,
+		CreatedAt:     now,
+		NextAttemptAt: &now,
+	}
+
+	o.mutex.Lock()
+	o.deliveries = append(o.deliveries, d)
+	o.save()
+	o.mutex.Unlock()
+
+	o.notify()
+
+	return d, nil
+}
+
+// Deliveries returns the deliveries with the given status (all deliveries if empty), newest first.
+func (o *Outbox) Deliveries(status Status) []*Delivery {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	ret := []*Delivery{}
+	for i := len(o.deliveries) - 1; i >= 0; i-- {
+		d := o.deliveries[i]
+		if status == "" || d.Status == status {
+			c := *d
+			ret = append(ret, &c)
+		}
+	}
+	return ret
+}
+
+// Replay schedules failed deliveries to be sent again, with the same idempotency key.
+// When ids is empty, all failed deliveries are replayed.
+func (o *Outbox) Replay(ids []string) ([]*Delivery, error) {
+	o.mutex.Lock()
+
+	byID := make(map[string]*Delivery)
+	for _, d := range o.deliveries {
+		byID[d.ID] = d
+	}
+
+	var targets []*Delivery
+
+	if len(ids) == 0 {
+		for _, d := range o.deliveries {
+			if d.Status == StatusFailed {
+				targets = append(targets, d)
+			}
+		}
+	} else {
+		for _, id := range ids {
+			d, ok := byID[id]
+			if !ok {
+				o.mutex.Unlock()
+				return nil, fmt.Errorf("%w: %s", ErrDeliveryNotFound, id)
+			}
+			if d.Status == StatusPending {
+				o.mutex.Unlock()
+				return nil, fmt.Errorf("delivery '%s' is still pending", id)
+			}
+			targets = append(targets, d)
+		}
+	}
+
+	now := time.Now()
+	ret := make([]*Delivery, 0, len(targets))
+
+	for _, d := range targets {
+		d.Status = StatusPending
+		d.Attempts = 0
+		d.NextAttemptAt = &now
+		d.DeliveredAt = nil
+		c := *d
+		ret = append(ret, &c)
+	}
+
+	if len(targets) != 0 {
+		o.save()
+	}
+
+	o.mutex.Unlock()
+
+	o.notify()
+
+	return ret, nil
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) run() {
+	defer close(o.done)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-o.wake:
+		case <-o.terminate:
+			return
+		}
+
+		o.deliverDue()
+
+		timer.Reset(o.nextWait())
+	}
+}
+
+// nextWait returns the time until the next scheduled attempt.
+func (o *Outbox) nextWait() time.Duration {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	wait := backoff.Max
+	for _, d := range o.deliveries {
+		if d.Status == StatusPending && d.NextAttemptAt != nil {
+			if w := time.Until(*d.NextAttemptAt); w < wait {
+				wait = w
+			}
+		}
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// deliverDue sends the deliveries whose attempt is due, oldest first.
+func (o *Outbox) deliverDue() {
+	for {
+		o.mutex.Lock()
+		var due *Delivery
+		now := time.Now()
+		for _, d := range o.deliveries {
+			if d.Status == StatusPending && d.NextAttemptAt != nil && !d.NextAttemptAt.After(now) {
+				due = d
+				break
+			}
+		}
+		if due == nil {
+			o.mutex.Unlock()
+			return
+		}
+		d := *due
+		secret := o.Secret
+		o.mutex.Unlock()
+
+		statusCode, err := o.send(&d, secret)
+
+		o.mutex.Lock()
+		o.onAttempt(due, statusCode, err)
+		o.save()
+		o.mutex.Unlock()
+
+		select {
+		case <-o.terminate:
+			return
+		default:
+		}
+	}
+}
+
+// send performs an attempt.
+func (o *Outbox) send(d *Delivery, secret string) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set(HeaderIdempotencyKey, d.ID)
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if secret != "" {
+		req.Header.Set(HeaderSignature, Sign(secret, timestamp, d.Payload))
+	}
+
+	res, err := o.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("non-success status: %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// onAttempt updates a delivery after an attempt. Must be called with the mutex held.
+func (o *Outbox) onAttempt(d *Delivery, statusCode int, err error) {
+	// the delivery has been replayed or removed in the meantime
+	if d.Status != StatusPending {
+		return
+	}
+
+	now := time.Now()
+	d.Attempts++
+	d.LastAttemptAt = &now
+	d.LastStatusCode = statusCode
+
+	if err == nil {
+		d.Status = StatusDelivered
+		d.DeliveredAt = &now
+		d.NextAttemptAt = nil
+		d.LastError = ""
+		o.Log(logger.Info, "%s delivered to %s (attempt %d)", d.Event, d.URL, d.Attempts)
+		return
+	}
+
+	d.LastError = err.Error()
+
+	if d.Attempts >= maxAttempts {
+		d.Status = StatusFailed
+		d.NextAttemptAt = nil
+		o.Log(logger.Error, "%s to %s failed after %d attempts: %v", d.Event, d.URL, d.Attempts, err)
+		return
+	}
+
+	next := now.Add(backoff.Wait(d.Attempts))
+	d.NextAttemptAt = &next
+	o.Log(logger.Warn, "%s to %s failed (attempt %d/%d), retrying at %s: %v",
+		d.Event, d.URL, d.Attempts, maxAttempts, next.Format(time.RFC3339), err)
+}
+
+func (o *Outbox) load() error {
+	err := retryqueue.ReadJSON(o.FilePath, &o.deliveries)
+	if err != nil {
+		return fmt.Errorf("failed to read webhook outbox %s: %w", o.FilePath, err)
+	}
+
+	pending := 0
+	for _, d := range o.deliveries {
+		if d.Status == StatusPending {
+			pending++
+		}
+	}
+	if pending != 0 {
+		o.Log(logger.Info, "%d pending deliveries loaded from %s", pending, o.FilePath)
+	}
+
+	return nil
+}
+
+// save trims the history and writes the outbox to disk. Must be called with the mutex held.
+func (o *Outbox) save() {
+	o.deliveries = trim(o.deliveries)
+
+	err := retryqueue.WriteJSON(o.FilePath, o.deliveries)
+	if err != nil {
+		o.Log(logger.Error, "failed to write webhook outbox %s: %v", o.FilePath, err)
+	}
+}
+
+// trim removes the oldest delivered and failed deliveries. Pending deliveries are always kept.
+func trim(deliveries []*Delivery) []*Delivery {
+	count := map[Status]int{}
+	for _, d := range deliveries {
+		count[d.Status]++
+	}
+
+	limits := map[Status]int{
+		StatusDelivered: deliveredCount,
+		StatusFailed:    failedCount,
+	}
+
+	sorted := make([]*Delivery, len(deliveries))
+	copy(sorted, deliveries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+
+	ret := make([]*Delivery, 0, len(sorted))
+	for _, d := range sorted {
+		if limit, ok := limits[d.Status]; ok && count[d.Status] > limit {
+			count[d.Status]--
+			continue
+		}
+		ret = append(ret, d)
+	}
+
+	return ret
+}
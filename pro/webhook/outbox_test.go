@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestSign(t *testing.T) {
+	require.Equal(t,
+		"sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686",
+		Sign("secret", "1700000000", []byte(`{"a":1}`)))
+
+	// the signature covers both the timestamp and the body
+	require.NotEqual(t, Sign("secret", "1", []byte("a")), Sign("secret", "2", []byte("a")))
+	require.NotEqual(t, Sign("secret", "1", []byte("a")), Sign("secret", "1", []byte("b")))
+	require.NotEqual(t, Sign("secret", "1", []byte("a")), Sign("other", "1", []byte("a")))
+}
+
+func TestOutboxDelivery(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []*http.Request
+	var bodies [][]byte
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mutex.Lock()
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		n := len(requests)
+		mutex.Unlock()
+
+		// the receiver is down at the first attempt
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}))
+	defer s.Close()
+
+	filePath := filepath.Join(t.TempDir(), FileName)
+
+	o := &Outbox{
+		FilePath: filePath,
+		Secret:   "secret",
+		Parent:   test.NilLogger,
+	}
+	err := o.Initialize()
+	require.NoError(t, err)
+	defer o.Close()
+
+	d, err := o.Enqueue(EventRecordCreate, s.URL, map[string]string{"resPath": "/20260301/a.mp4"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		ds := o.Deliveries("")
+		return ds[0].Attempts == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ds := o.Deliveries("")
+	require.Equal(t, StatusPending, ds[0].Status)
+	require.Equal(t, http.StatusServiceUnavailable, ds[0].LastStatusCode)
+
+	// skip the backoff
+	o.mutex.Lock()
+	now := time.Now()
+	o.deliveries[0].NextAttemptAt = &now
+	o.mutex.Unlock()
+	o.notify()
+
+	require.Eventually(t, func() bool {
+		return len(o.Deliveries(StatusDelivered)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	require.Len(t, requests, 2)
+	for i, r := range requests {
+		require.Equal(t, d.ID, r.Header.Get(HeaderIdempotencyKey))
+		require.Equal(t, EventRecordCreate, r.Header.Get(HeaderEvent))
+		require.Equal(t, Sign("secret", r.Header.Get(HeaderTimestamp), bodies[i]), r.Header.Get(HeaderSignature))
+		require.JSONEq(t, `{"resPath":"/20260301/a.mp4"}`, string(bodies[i]))
+	}
+
+	// deliveries survive restarts
+	o2 := &Outbox{
+		FilePath: filePath,
+		Parent:   test.NilLogger,
+	}
+	err = o2.load()
+	require.NoError(t, err)
+	require.Len(t, o2.deliveries, 1)
+	require.Equal(t, StatusDelivered, o2.deliveries[0].Status)
+}
+
+func TestOutboxReplay(t *testing.T) {
+	o := &Outbox{
+		FilePath: filepath.Join(t.TempDir(), FileName),
+		Parent:   test.NilLogger,
+		wake:     make(chan struct{}, 1),
+	}
+
+	d := &Delivery{ID: "1", Status: StatusPending, CreatedAt: time.Now()}
+	o.deliveries = []*Delivery{d}
+
+	for i := 0; i < maxAttempts; i++ {
+		o.onAttempt(d, 0, errors.New("connection refused"))
+	}
+	require.Equal(t, StatusFailed, d.Status)
+	require.Equal(t, maxAttempts, d.Attempts)
+	require.Nil(t, d.NextAttemptAt)
+
+	_, err := o.Replay([]string{"2"})
+	require.ErrorIs(t, err, ErrDeliveryNotFound)
+
+	replayed, err := o.Replay(nil)
+	require.NoError(t, err)
+	require.Len(t, replayed, 1)
+	require.Equal(t, "1", replayed[0].ID)
+	require.Equal(t, StatusPending, d.Status)
+	require.Equal(t, 0, d.Attempts)
+	require.NotNil(t, d.NextAttemptAt)
+
+	// pending deliveries can't be replayed
+	_, err = o.Replay([]string{"1"})
+	require.Error(t, err)
+}
+
+func TestTrim(t *testing.T) {
+	var deliveries []*Delivery
+	start := time.Now()
+
+	for i := 0; i < deliveredCount+10; i++ {
+		deliveries = append(deliveries, &Delivery{
+			ID:        "d",
+			Status:    StatusDelivered,
+			CreatedAt: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	deliveries = append(deliveries, &Delivery{ID: "p", Status: StatusPending, CreatedAt: start})
+
+	trimmed := trim(deliveries)
+	require.Len(t, trimmed, deliveredCount+1)
+
+	// the oldest delivered events are removed, pending ones are kept
+	require.Equal(t, "p", trimmed[0].ID)
+	require.Equal(t, start.Add(10*time.Second), trimmed[1].CreatedAt)
+}
@@ -0,0 +1,192 @@
+package websocketapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	// built-in command that authenticates the client.
+	cmdAuth = "auth"
+
+	// query parameter that contains the token, the same used by the HTTP API.
+	tokenParam = "access_token"
+
+	// Time allowed to send the token after the connection is opened.
+	authWait = 10 * time.Second
+)
+
+// ErrPermissionDenied is returned when the permissions of a client don't allow an action.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Permissions are the topics a client can receive and the commands it can run.
+type Permissions struct {
+	// Topics are patterns of the topics the client can receive, like subscription topics.
+	// nil allows all topics.
+	Topics []string
+
+	// Commands are the commands the client can run, besides subscribe, unsubscribe and auth.
+	// nil allows all commands.
+	Commands []string
+
+	// Expires is the time at which the connection is closed. Zero means never.
+	Expires time.Time
+}
+
+func (p *Permissions) allowsTopic(topic string) bool {
+	if p.Topics == nil {
+		return true
+	}
+
+	for _, t := range p.Topics {
+		if matchTopic(t, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Permissions) allowsCommand(cmd string) bool {
+	if p.Commands == nil {
+		return true
+	}
+
+	for _, c := range p.Commands {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator verifies the token of a client and returns its permissions.
+type Authenticator func(token string) (*Permissions, error)
+
+// SetAuthenticator enables authentication. Clients send their token in the access_token
+// query parameter or in an "auth" command, that must be the first message.
+// It must be called before clients connect.
+func (h *Hub) SetAuthenticator(a Authenticator) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.authenticate = a
+}
+
+// SetAllowOrigin sets the origin allowed to connect, like the Access-Control-Allow-Origin
+// header of the HTTP API. "*" allows all origins. Connections from the same host
+// and from clients that don't send an Origin header are always allowed.
+// It must be called before clients connect.
+func (h *Hub) SetAllowOrigin(origin string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.allowOrigin = origin
+}
+
+func (h *Hub) getAuthenticator() Authenticator {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.authenticate
+}
+
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	h.mu.RLock()
+	allowOrigin := h.allowOrigin
+	h.mu.RUnlock()
+
+	if allowOrigin == "*" || origin == allowOrigin {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// setPermissions sets the permissions of an authenticated client
+// and schedules the closure of the connection when they expire.
+func (c *Client) setPermissions(p *Permissions) {
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	c.perms = p
+
+	if c.expiryTimer != nil {
+		c.expiryTimer.Stop()
+		c.expiryTimer = nil
+	}
+
+	if !p.Expires.IsZero() {
+		c.expiryTimer = time.AfterFunc(time.Until(p.Expires), func() {
+			c.hub.Log(logger.Info, "token of client %s expired", c.id)
+			c.closeWithReason(websocket.ClosePolicyViolation, "token expired")
+		})
+	}
+}
+
+// permissions returns the permissions of the client, nil when it is not authenticated.
+func (c *Client) permissions() *Permissions {
+	c.subsMutex.RLock()
+	defer c.subsMutex.RUnlock()
+
+	return c.perms
+}
+
+func (c *Client) stopExpiryTimer() {
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	if c.expiryTimer != nil {
+		c.expiryTimer.Stop()
+		c.expiryTimer = nil
+	}
+}
+
+// auth runs the auth command. A client can send a new token before the current one
+// expires, in order to keep the connection open.
+func (c *Client) auth(params json.RawMessage) error {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil || req.Token == "" {
+		return fmt.Errorf("token not provided")
+	}
+
+	cb := c.hub.getAuthenticator()
+	if cb == nil {
+		return fmt.Errorf("authentication is not enabled")
+	}
+
+	p, err := cb(req.Token)
+	if err != nil {
+		return err
+	}
+
+	c.setPermissions(p)
+	return nil
+}
+
+// closeWithReason sends a close message to the client and closes the connection.
+func (c *Client) closeWithReason(code int, reason string) {
+	c.conn.WriteControl(websocket.CloseMessage, //nolint:errcheck
+		websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+	c.cancel()
+	c.conn.Close()
+}
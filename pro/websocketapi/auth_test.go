@@ -0,0 +1,169 @@
+package websocketapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	h := NewHub(test.NilLogger)
+	defer h.Close()
+
+	req := func(origin string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://server:9997/ws", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+
+	h.SetAllowOrigin("https://app.example.com")
+	require.True(t, h.checkOrigin(req("")))
+	require.True(t, h.checkOrigin(req("https://app.example.com")))
+	require.True(t, h.checkOrigin(req("http://server:9997")))
+	require.False(t, h.checkOrigin(req("https://evil.example.com")))
+
+	h.SetAllowOrigin("*")
+	require.True(t, h.checkOrigin(req("https://evil.example.com")))
+}
+
+func TestPermissions(t *testing.T) {
+	h := NewHub(test.NilLogger)
+	defer h.Close()
+
+	h.Handle("record.bookmark", func(json.RawMessage) (interface{}, error) {
+		return "ok", nil
+	})
+	h.SetAuthenticator(func(token string) (*Permissions, error) {
+		if token != "valid" {
+			return nil, errors.New("invalid token")
+		}
+		return &Permissions{Topics: []string{"path.*"}, Commands: []string{}}, nil
+	})
+
+	c := &Client{hub: h, send: make(chan interface{}, 16), id: "test"}
+
+	recv := func() *CommandResponse {
+		select {
+		case m := <-c.send:
+			return m.(*CommandResponse)
+		default:
+			return nil
+		}
+	}
+
+	// clients that are not authenticated receive nothing and can't run commands
+	require.False(t, c.wants("path.ready", "cam1"))
+
+	c.handleMessage([]byte(`{"id":"1","cmd":"subscribe","params":{"topics":["*"]}}`))
+	require.Equal(t, "authentication required", recv().Error)
+
+	c.handleMessage([]byte(`{"id":"2","cmd":"auth","params":{"token":"wrong"}}`))
+	require.Equal(t, "invalid token", recv().Error)
+
+	c.handleMessage([]byte(`{"id":"3","cmd":"auth","params":{"token":"valid"}}`))
+	require.True(t, recv().Success)
+
+	// events are delivered after subscribing
+	require.False(t, c.wants("path.ready", "cam1"))
+	require.False(t, c.wants("record.start", "cam1"))
+	require.False(t, c.wants(topicMessage, ""))
+
+	c.handleMessage([]byte(`{"id":"4","cmd":"subscribe","params":{"topics":["record.start"]}}`))
+	require.Equal(t, "permission denied: topic 'record.start'", recv().Error)
+
+	c.handleMessage([]byte(`{"id":"5","cmd":"subscribe","params":{"topics":["*"]}}`))
+	require.True(t, recv().Success)
+	require.True(t, c.wants("path.notready", "cam1"))
+	require.False(t, c.wants("record.stop", "cam1"))
+
+	c.handleMessage([]byte(`{"id":"6","cmd":"record.bookmark","params":{}}`))
+	require.Equal(t, "permission denied", recv().Error)
+}
+
+func TestServeWSAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	h := NewHub(test.NilLogger)
+	defer h.Close()
+	go h.Run()
+
+	h.SetAllowOrigin("*")
+	h.SetAuthenticator(func(token string) (*Permissions, error) {
+		switch token {
+		case "short":
+			return &Permissions{Expires: time.Now().Add(200 * time.Millisecond)}, nil
+		case "long":
+			return &Permissions{Expires: time.Now().Add(time.Hour)}, nil
+		}
+		return nil, errors.New("invalid token")
+	})
+
+	router := gin.New()
+	router.GET("/ws", func(c *gin.Context) {
+		ServeWS(h, c)
+	})
+
+	s := httptest.NewServer(router)
+	defer s.Close()
+
+	u := "ws" + strings.TrimPrefix(s.URL, "http") + "/ws"
+
+	_, res, err := websocket.DefaultDialer.Dial(u+"?access_token=wrong", nil)
+	require.Error(t, err)
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	res.Body.Close()
+
+	// the connection is closed when the token expires
+	conn, res, err := websocket.DefaultDialer.Dial(u+"?access_token=short", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	_, _, err = conn.ReadMessage()
+	var ce *websocket.CloseError
+	require.ErrorAs(t, err, &ce)
+	require.Equal(t, websocket.ClosePolicyViolation, ce.Code)
+	require.Equal(t, "token expired", ce.Text)
+
+	// the token can be sent in the first message
+	conn2, res, err := websocket.DefaultDialer.Dial(u, nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	defer conn2.Close()
+
+	err = conn2.WriteJSON(&Command{ID: "1", Cmd: cmdAuth, Params: json.RawMessage(`{"token":"long"}`)})
+	require.NoError(t, err)
+
+	var cr CommandResponse
+	conn2.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	err = conn2.ReadJSON(&cr)
+	require.NoError(t, err)
+	require.True(t, cr.Success)
+
+	err = conn2.WriteJSON(&Command{ID: "2", Cmd: cmdSubscribe, Params: json.RawMessage(`{"topics":["export.*"]}`)})
+	require.NoError(t, err)
+
+	err = conn2.ReadJSON(&cr)
+	require.NoError(t, err)
+	require.True(t, cr.Success)
+
+	h.BroadcastEvent("export.job", 1)
+
+	var e Event
+	err = conn2.ReadJSON(&e)
+	require.NoError(t, err)
+	require.Equal(t, "export.job", e.Event)
+}
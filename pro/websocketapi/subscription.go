@@ -0,0 +1,202 @@
+package websocketapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// built-in commands.
+	cmdSubscribe   = "subscribe"
+	cmdUnsubscribe = "unsubscribe"
+
+	// topic of the free-form messages sent with Broadcast.
+	topicMessage = "message"
+
+	// Maximum number of subscriptions of a client
+	maxSubscriptions = 32
+)
+
+// Subscription selects the events delivered to a client.
+type Subscription struct {
+	ID string `json:"id"`
+
+	// Topics are event names, like "record.start", or prefixes ending with ".*", like "record.*".
+	// "*" selects all events.
+	Topics []string `json:"topics"`
+
+	// Paths are patterns of path names, like "cam*" (see path.Match).
+	// When empty, events of all paths and events that are not related to a path are delivered.
+	Paths []string `json:"paths,omitempty"`
+}
+
+func (s *Subscription) validate() error {
+	if len(s.Topics) == 0 {
+		return errors.New("no topics provided")
+	}
+
+	for _, t := range s.Topics {
+		if t == "" || strings.Contains(strings.TrimSuffix(t, "*"), "*") {
+			return fmt.Errorf("invalid topic: '%s'", t)
+		}
+	}
+
+	for _, p := range s.Paths {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid path pattern: '%s'", p)
+		}
+	}
+
+	return nil
+}
+
+func matchTopic(pattern string, topic string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(topic, prefix)
+	}
+	return pattern == topic
+}
+
+func (s *Subscription) matches(topic string, pathName string) bool {
+	ok := false
+	for _, t := range s.Topics {
+		if matchTopic(t, topic) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return false
+	}
+
+	if len(s.Paths) == 0 {
+		return true
+	}
+
+	// events that are not related to a path are not delivered to subscriptions restricted to paths
+	if pathName == "" {
+		return false
+	}
+
+	for _, p := range s.Paths {
+		if m, _ := path.Match(p, pathName); m {
+			return true
+		}
+	}
+	return false
+}
+
+// wants returns whether a message must be delivered to the client.
+// Clients that never subscribed receive only plain messages, events are delivered after subscribing.
+func (c *Client) wants(topic string, pathName string) bool {
+	c.subsMutex.RLock()
+	defer c.subsMutex.RUnlock()
+
+	if c.perms == nil || !c.perms.allowsTopic(topic) {
+		return false
+	}
+
+	if !c.subscribed {
+		return topic == topicMessage
+	}
+
+	for _, s := range c.subs {
+		if s.matches(topic, pathName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) subscribe(params json.RawMessage) (*Subscription, error) {
+	var sub Subscription
+	if err := json.Unmarshal(params, &sub); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	}
+
+	if err := sub.validate(); err != nil {
+		return nil, err
+	}
+
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	// topics without wildcards must be allowed, the others are filtered when events are delivered
+	for _, t := range sub.Topics {
+		if !strings.HasSuffix(t, "*") && !c.perms.allowsTopic(t) {
+			return nil, fmt.Errorf("%w: topic '%s'", ErrPermissionDenied, t)
+		}
+	}
+
+	if len(c.subs) >= maxSubscriptions {
+		return nil, fmt.Errorf("too many subscriptions (max %d)", maxSubscriptions)
+	}
+
+	sub.ID = uuid.New().String()
+	c.subs = append(c.subs, &sub)
+	c.subscribed = true
+
+	return &sub, nil
+}
+
+// unsubscribe removes a subscription, or all subscriptions when the ID is empty.
+// The client keeps receiving only the events it subscribed to, so removing all
+// subscriptions stops the delivery of events.
+func (c *Client) unsubscribe(params json.RawMessage) (int, error) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if len(params) != 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return 0, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+
+	if req.ID == "" {
+		n := len(c.subs)
+		c.subs = nil
+		c.subscribed = true
+		return n, nil
+	}
+
+	for i, s := range c.subs {
+		if s.ID == req.ID {
+			c.subs = append(c.subs[:i], c.subs[i+1:]...)
+			return 1, nil
+		}
+	}
+
+	return 0, fmt.Errorf("subscription not found: %s", req.ID)
+}
+
+// replay sends the events that describe the current state and match a subscription.
+func (c *Client) replay(sub *Subscription) {
+	cb := c.hub.getReplay()
+	if cb == nil {
+		return
+	}
+
+	perms := c.permissions()
+
+	for _, e := range cb() {
+		if !sub.matches(e.Event, e.Path) || !perms.allowsTopic(e.Event) {
+			continue
+		}
+
+		cp := *e
+		cp.Type = "event"
+		cp.Replay = true
+		c.enqueue(&cp)
+	}
+}
@@ -0,0 +1,113 @@
+package websocketapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestSubscriptionMatches(t *testing.T) {
+	s := &Subscription{Topics: []string{"record.*", "health.transition"}, Paths: []string{"cam*"}}
+	require.NoError(t, s.validate())
+
+	require.True(t, s.matches("record.start", "cam1"))
+	require.True(t, s.matches("health.transition", "cam2"))
+	require.False(t, s.matches("record.start", "mic1"))
+	require.False(t, s.matches("path.ready", "cam1"))
+	require.False(t, s.matches("export.job", ""))
+
+	s = &Subscription{Topics: []string{"*"}}
+	require.True(t, s.matches("export.job", ""))
+	require.True(t, s.matches("path.ready", "cam1"))
+
+	require.EqualError(t, (&Subscription{}).validate(), "no topics provided")
+	require.EqualError(t, (&Subscription{Topics: []string{"re*cord"}}).validate(), "invalid topic: 're*cord'")
+	require.EqualError(t, (&Subscription{Topics: []string{"*"}, Paths: []string{"["}}).validate(),
+		"invalid path pattern: '['")
+}
+
+func TestSubscribe(t *testing.T) {
+	h := NewHub(test.NilLogger)
+	defer h.Close()
+
+	h.SetReplay(func() []*Event {
+		return []*Event{
+			{Event: "path.ready", Path: "cam1"},
+			{Event: "path.ready", Path: "mic1"},
+		}
+	})
+
+	c := &Client{hub: h, send: make(chan interface{}, 16), id: "test", perms: &Permissions{}}
+	h.mu.Lock()
+	h.clients[c.id] = c
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, c.id)
+		h.mu.Unlock()
+	}()
+
+	recv := func() interface{} {
+		select {
+		case m := <-c.send:
+			return m
+		default:
+			return nil
+		}
+	}
+
+	// clients that didn't subscribe receive plain messages only
+	h.Broadcast("hello")
+	require.Equal(t, "hello", recv())
+
+	h.BroadcastEvent("export.job", 1)
+	h.BroadcastPathEvent("path.notready", "cam1", nil)
+	require.Nil(t, recv())
+
+	c.handleMessage([]byte(`{"id":"1","cmd":"subscribe","params":{"topics":["path.*"],"paths":["cam*"]}}`))
+	res := recv().(*CommandResponse)
+	require.True(t, res.Success)
+	sub := res.Result.(*Subscription)
+
+	require.Equal(t, &Event{Type: "event", Event: "path.ready", Path: "cam1", Replay: true}, recv())
+	require.Nil(t, recv())
+
+	h.Broadcast("hello")
+	h.BroadcastEvent("export.job", 1)
+	h.BroadcastPathEvent("path.notready", "mic1", nil)
+	require.Nil(t, recv())
+
+	h.BroadcastPathEvent("path.notready", "cam1", nil)
+	require.Equal(t, &Event{Type: "event", Event: "path.notready", Path: "cam1"}, recv())
+
+	c.handleMessage([]byte(`{"id":"2","cmd":"subscribe","params":{"topics":[]}}`))
+	res = recv().(*CommandResponse)
+	require.Equal(t, "no topics provided", res.Error)
+
+	c.handleMessage([]byte(`{"id":"3","cmd":"unsubscribe","params":{"id":"` + sub.ID + `"}}`))
+	res = recv().(*CommandResponse)
+	require.True(t, res.Success)
+	require.Equal(t, map[string]int{"removed": 1}, res.Result)
+
+	// after unsubscribing, the client doesn't go back to receiving everything
+	h.BroadcastPathEvent("path.notready", "cam1", nil)
+	h.Broadcast("hello")
+	require.Nil(t, recv())
+
+	c.handleMessage([]byte(`{"id":"4","cmd":"unsubscribe","params":{"id":"unknown"}}`))
+	res = recv().(*CommandResponse)
+	require.Equal(t, "subscription not found: unknown", res.Error)
+
+	// other commands are run by the handlers
+	h.Handle("echo", func(params json.RawMessage) (interface{}, error) {
+		return string(params), nil
+	})
+	c.handleMessage([]byte(`{"id":"5","cmd":"echo","params":"x"}`))
+	res = recv().(*CommandResponse)
+	require.True(t, res.Success)
+	require.Equal(t, `"x"`, res.Result)
+}
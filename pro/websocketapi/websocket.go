@@ -1,8 +1,9 @@
-// Package websocketapi provides WebSocket API for real-time message broadcasting.
+// Package websocketapi provides WebSocket API for real-time events and commands.
 package websocketapi
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"sync"
 	"time"
@@ -23,8 +24,8 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Maximum message size allowed from peer. Commands may carry free-form data.
+	maxMessageSize = 16 * 1024
 
 	// Maximum number of clients
 	maxClients = 1000
@@ -37,18 +38,37 @@ var upgrader = websocket.Upgrader{
 	HandshakeTimeout: 10 * time.Second,
 	ReadBufferSize:   1024,
 	WriteBufferSize:  1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// TODO: Implement proper origin check for production
-		// For now, allow same origin only in production
-		origin := r.Header.Get("Origin")
-		if origin == "" {
-			return true // Allow requests without Origin header (non-browser clients)
-		}
-		// You should validate against your allowed origins
-		return true
-	},
 }
 
+// Command is a request sent by a client.
+type Command struct {
+	ID     string          `json:"id"` // chosen by the client, echoed in the response
+	Cmd    string          `json:"cmd"`
+	Params json.RawMessage `json:"params"`
+}
+
+// CommandResponse is the response to a command. It is sent only to the client that sent the command.
+type CommandResponse struct {
+	Type    string      `json:"type"` // always "response"
+	ID      string      `json:"id"`
+	Cmd     string      `json:"cmd"`
+	Success bool        `json:"success"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// Event is a notification sent by the server to the clients that subscribed to it.
+type Event struct {
+	Type   string      `json:"type"` // always "event"
+	Event  string      `json:"event"`
+	Path   string      `json:"path,omitempty"`   // path the event is related to
+	Replay bool        `json:"replay,omitempty"` // true when the event describes the state at the time of the subscription
+	Data   interface{} `json:"data"`
+}
+
+// CommandHandler handles a command and returns its result.
+type CommandHandler func(params json.RawMessage) (interface{}, error)
+
 // Hub maintains the set of active clients and broadcasts messages to the clients.
 type Hub struct {
 	// Registered clients.
@@ -63,7 +83,19 @@ type Hub struct {
 	// Unregister requests from clients.
 	unregister chan *Client
 
-	// Mutex for clients map
+	// Command handlers, key: command name.
+	handlers map[string]CommandHandler
+
+	// Returns the events that describe the current state, sent on subscribe.
+	replay func() []*Event
+
+	// Verifies the tokens of clients, nil when authentication is disabled.
+	authenticate Authenticator
+
+	// Origin allowed to connect, see SetAllowOrigin.
+	allowOrigin string
+
+	// Mutex for clients map and handlers
 	mu sync.RWMutex
 
 	// Logger
@@ -87,6 +119,14 @@ type Client struct {
 	// Client ID
 	id string
 
+	// Subscriptions and permissions. Once the client subscribes, it receives only the events it subscribed to.
+	// Clients that are not authenticated (perms is nil) receive nothing.
+	subsMutex   sync.RWMutex
+	subs        []*Subscription
+	subscribed  bool
+	perms       *Permissions
+	expiryTimer *time.Timer // closes the connection when the token expires or is not sent in time
+
 	// Context for client lifecycle
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -100,6 +140,7 @@ func NewHub(parent logger.Writer) *Hub {
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[string]*Client),
+		handlers:   make(map[string]CommandHandler),
 		logger:     parent,
 		ctx:        ctx,
 		cancel:     cancel,
@@ -119,8 +160,9 @@ func (h *Hub) Run() {
 				continue
 			}
 			h.clients[client.id] = client
+			total := len(h.clients)
 			h.mu.Unlock()
-			h.Log(logger.Info, "websocket client connected: %s (total: %d)", client.id, len(h.clients))
+			h.Log(logger.Info, "websocket client connected: %s (total: %d)", client.id, total)
 
 		case client := <-h.unregister:
 			h.mu.Lock()
@@ -138,22 +180,90 @@ func (h *Hub) Run() {
 	}
 }
 
-// Broadcast sends a message to all connected clients.
+// Broadcast sends a free-form message to the clients that didn't subscribe
+// or that subscribed to the "message" topic.
 func (h *Hub) Broadcast(message interface{}) {
+	h.deliver(topicMessage, "", message)
+}
+
+// BroadcastEvent sends an event that is not related to a path.
+func (h *Hub) BroadcastEvent(event string, data interface{}) {
+	h.BroadcastPathEvent(event, "", data)
+}
+
+// BroadcastPathEvent sends an event related to a path.
+func (h *Hub) BroadcastPathEvent(event string, pathName string, data interface{}) {
+	h.deliver(event, pathName, &Event{
+		Type:  "event",
+		Event: event,
+		Path:  pathName,
+		Data:  data,
+	})
+}
+
+func (h *Hub) deliver(topic string, pathName string, message interface{}) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	for id, client := range h.clients {
-		select {
-		case client.send <- message:
-			// Message sent successfully
-		default:
-			// Send channel is full, client is slow or stuck
-			h.Log(logger.Warn, "client %s send buffer full, skipping message", id)
+	for _, client := range h.clients {
+		if client.wants(topic, pathName) {
+			client.enqueue(message)
 		}
 	}
 }
 
+// SetReplay sets the callback that returns the events describing the current state.
+// They are sent to a client when it subscribes, filtered by the subscription.
+func (h *Hub) SetReplay(cb func() []*Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.replay = cb
+}
+
+func (h *Hub) getReplay() func() []*Event {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.replay
+}
+
+// Handle registers the handler of a command.
+func (h *Hub) Handle(cmd string, handler CommandHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.handlers[cmd] = handler
+}
+
+// handleCommand runs a command sent by a client and returns the response.
+func (h *Hub) handleCommand(msg []byte) *CommandResponse {
+	var cmd Command
+	err := json.Unmarshal(msg, &cmd)
+	if err != nil || cmd.Cmd == "" {
+		return &CommandResponse{Type: "response", ID: cmd.ID, Error: "invalid command"}
+	}
+
+	return h.runCommand(&cmd)
+}
+
+func (h *Hub) runCommand(cmd *Command) *CommandResponse {
+	h.mu.RLock()
+	handler, ok := h.handlers[cmd.Cmd]
+	h.mu.RUnlock()
+
+	if !ok {
+		return &CommandResponse{Type: "response", ID: cmd.ID, Cmd: cmd.Cmd, Error: "unknown command: " + cmd.Cmd}
+	}
+
+	result, err := handler(cmd.Params)
+	if err != nil {
+		return &CommandResponse{Type: "response", ID: cmd.ID, Cmd: cmd.Cmd, Error: err.Error()}
+	}
+
+	return &CommandResponse{Type: "response", ID: cmd.ID, Cmd: cmd.Cmd, Success: true, Result: result}
+}
+
 // Close shuts down the hub.
 func (h *Hub) Close() {
 	h.cancel()
@@ -184,6 +294,7 @@ func (h *Hub) Log(level logger.Level, format string, args ...interface{}) {
 // readPump pumps messages from the websocket connection to the hub.
 func (c *Client) readPump() {
 	defer func() {
+		c.stopExpiryTimer()
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
@@ -200,16 +311,88 @@ func (c *Client) readPump() {
 		case <-c.ctx.Done():
 			return
 		default:
-			// Read messages from client (currently we just discard them)
-			// In the future, you can process client messages here
-			_, _, err := c.conn.ReadMessage()
+			// Read commands from client, the response is sent to the same client
+			_, msg, err := c.conn.ReadMessage()
 			if err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 					c.hub.Log(logger.Warn, "websocket error for client %s: %v", c.id, err)
 				}
 				return
 			}
+
+			c.handleMessage(msg)
+		}
+	}
+}
+
+// handleMessage runs a command sent by the client. Subscriptions are handled by the hub,
+// other commands by the registered handlers.
+func (c *Client) handleMessage(msg []byte) {
+	var cmd Command
+	err := json.Unmarshal(msg, &cmd)
+	if err != nil || cmd.Cmd == "" {
+		c.enqueue(&CommandResponse{Type: "response", ID: cmd.ID, Error: "invalid command"})
+		return
+	}
+
+	if cmd.Cmd == cmdAuth {
+		err := c.auth(cmd.Params)
+		if err != nil {
+			c.hub.Log(logger.Info, "client %s failed to authenticate: %v", c.id, err)
+			c.enqueue(&CommandResponse{Type: "response", ID: cmd.ID, Cmd: cmd.Cmd, Error: err.Error()})
+			return
+		}
+
+		c.enqueue(&CommandResponse{Type: "response", ID: cmd.ID, Cmd: cmd.Cmd, Success: true})
+		return
+	}
+
+	perms := c.permissions()
+	if perms == nil {
+		c.enqueue(&CommandResponse{Type: "response", ID: cmd.ID, Cmd: cmd.Cmd, Error: "authentication required"})
+		return
+	}
+
+	switch cmd.Cmd {
+	case cmdSubscribe:
+		sub, err := c.subscribe(cmd.Params)
+		if err != nil {
+			c.enqueue(&CommandResponse{Type: "response", ID: cmd.ID, Cmd: cmd.Cmd, Error: err.Error()})
+			return
+		}
+
+		// the response is sent before the current state
+		c.enqueue(&CommandResponse{Type: "response", ID: cmd.ID, Cmd: cmd.Cmd, Success: true, Result: sub})
+		c.replay(sub)
+
+	case cmdUnsubscribe:
+		n, err := c.unsubscribe(cmd.Params)
+		if err != nil {
+			c.enqueue(&CommandResponse{Type: "response", ID: cmd.ID, Cmd: cmd.Cmd, Error: err.Error()})
+			return
+		}
+
+		c.enqueue(&CommandResponse{
+			Type: "response", ID: cmd.ID, Cmd: cmd.Cmd, Success: true,
+			Result: map[string]int{"removed": n},
+		})
+
+	default:
+		if !perms.allowsCommand(cmd.Cmd) {
+			c.enqueue(&CommandResponse{Type: "response", ID: cmd.ID, Cmd: cmd.Cmd, Error: ErrPermissionDenied.Error()})
+			return
 		}
+
+		c.enqueue(c.hub.runCommand(&cmd))
+	}
+}
+
+// enqueue queues a message for the client, dropping it when the client is too slow.
+func (c *Client) enqueue(message interface{}) {
+	select {
+	case c.send <- message:
+	default:
+		c.hub.Log(logger.Warn, "client %s send buffer full, skipping message", c.id)
 	}
 }
 
@@ -249,8 +432,30 @@ func (c *Client) writePump() {
 }
 
 // ServeWS handles websocket requests from the peer.
+// When authentication is enabled, the token can be sent in the access_token query parameter;
+// otherwise the client must send it with the auth command within authWait.
 func ServeWS(hub *Hub, c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	perms := &Permissions{}
+
+	authenticate := hub.getAuthenticator()
+	if authenticate != nil {
+		perms = nil
+
+		if token := c.Query(tokenParam); token != "" {
+			var err error
+			perms, err = authenticate(token)
+			if err != nil {
+				hub.Log(logger.Info, "connection %s failed to authenticate: %v", c.ClientIP(), err)
+				c.String(http.StatusUnauthorized, err.Error())
+				return
+			}
+		}
+	}
+
+	u := upgrader
+	u.CheckOrigin = hub.checkOrigin
+
+	conn, err := u.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		hub.Log(logger.Error, "websocket upgrade failed: %v", err)
 		return
@@ -266,6 +471,17 @@ func ServeWS(hub *Hub, c *gin.Context) {
 		cancel: cancel,
 	}
 
+	if perms != nil {
+		client.setPermissions(perms)
+	} else {
+		client.expiryTimer = time.AfterFunc(authWait, func() {
+			if client.permissions() == nil {
+				hub.Log(logger.Info, "client %s didn't authenticate in time", client.id)
+				client.closeWithReason(websocket.ClosePolicyViolation, "authentication required")
+			}
+		})
+	}
+
 	hub.register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
@@ -0,0 +1,50 @@
+package websocketapi
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestHandleCommand(t *testing.T) {
+	h := NewHub(test.NilLogger)
+	defer h.Close()
+
+	h.Handle("echo", func(params json.RawMessage) (interface{}, error) {
+		var v map[string]string
+		err := json.Unmarshal(params, &v)
+		if err != nil {
+			return nil, err
+		}
+		if v["fail"] != "" {
+			return nil, errors.New(v["fail"])
+		}
+		return v, nil
+	})
+
+	res := h.handleCommand([]byte(`{"id":"1","cmd":"echo","params":{"a":"b"}}`))
+	require.Equal(t, &CommandResponse{
+		Type:    "response",
+		ID:      "1",
+		Cmd:     "echo",
+		Success: true,
+		Result:  map[string]string{"a": "b"},
+	}, res)
+
+	res = h.handleCommand([]byte(`{"id":"2","cmd":"echo","params":{"fail":"no publisher"}}`))
+	require.False(t, res.Success)
+	require.Equal(t, "2", res.ID)
+	require.Equal(t, "no publisher", res.Error)
+
+	res = h.handleCommand([]byte(`{"id":"3","cmd":"other"}`))
+	require.False(t, res.Success)
+	require.Equal(t, "unknown command: other", res.Error)
+
+	res = h.handleCommand([]byte(`not json`))
+	require.False(t, res.Success)
+	require.Equal(t, "invalid command", res.Error)
+}